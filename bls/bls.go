@@ -0,0 +1,207 @@
+// Package bls holds BLS12-381 keys as Ethereum validators use them: public
+// keys in G1, signatures in G2 under the proof-of-possession ciphersuite,
+// derived from a seed per EIP-2333 and EIP-2334, and stored in EIP-2335
+// keystores.
+package bls
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	PublicKeyLength = 48
+	SignatureLength = 96
+
+	// ValidatorBasePath is the EIP-2334 path of validator signing keys;
+	// validator i's is ValidatorBasePath/i/0/0.
+	ValidatorBasePath = "m/12381/3600"
+)
+
+// dst is the domain separation tag of the ciphersuite Ethereum signs with.
+var dst = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+
+var (
+	ErrInvalidPath      = errors.New("invalid BLS derivation path")
+	ErrInvalidKey       = errors.New("invalid BLS secret key")
+	ErrInvalidPublicKey = errors.New("invalid BLS public key")
+	ErrInvalidSignature = errors.New("invalid BLS signature")
+)
+
+// SecretKey is a BLS12-381 secret key, a nonzero scalar.
+type SecretKey struct {
+	scalar *big.Int
+}
+
+// GenerateKey makes a key from 32 random bytes, as EIP-2333 makes a master
+// key from a seed.
+func GenerateKey() (*SecretKey, error) {
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, ikm); err != nil {
+		return nil, err
+	}
+
+	return &SecretKey{scalar: hkdfModR(ikm)}, nil
+}
+
+// DeriveKey derives the key at path, such as m/12381/3600/0/0/0, from a
+// seed, per EIP-2333.
+func DeriveKey(seed []byte, path string) (*SecretKey, error) {
+	if len(seed) < 32 {
+		return nil, errors.New("seed must be at least 32 bytes")
+	}
+	indexes, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	scalar := hkdfModR(seed)
+	for _, index := range indexes {
+		scalar = deriveChild(scalar, index)
+	}
+
+	return &SecretKey{scalar: scalar}, nil
+}
+
+// ValidatorPath is the EIP-2334 path of validator index's signing key.
+func ValidatorPath(index uint32) string {
+	return fmt.Sprintf("%s/%d/0/0", ValidatorBasePath, index)
+}
+
+// SecretKeyFromBytes parses a 32-byte big-endian secret key.
+func SecretKeyFromBytes(b []byte) (*SecretKey, error) {
+	if len(b) != 32 {
+		return nil, ErrInvalidKey
+	}
+	scalar := new(big.Int).SetBytes(b)
+	if scalar.Sign() == 0 || scalar.Cmp(fr.Modulus()) >= 0 {
+		return nil, ErrInvalidKey
+	}
+
+	return &SecretKey{scalar: scalar}, nil
+}
+
+func (k *SecretKey) Bytes() []byte {
+	return k.scalar.FillBytes(make([]byte, 32))
+}
+
+// PublicKey returns the compressed G1 public key.
+func (k *SecretKey) PublicKey() []byte {
+	var publicKey bls12381.G1Affine
+	publicKey.ScalarMultiplicationBase(k.scalar)
+	compressed := publicKey.Bytes()
+	return compressed[:]
+}
+
+// Sign returns the compressed G2 signature of message.
+func (k *SecretKey) Sign(message []byte) ([]byte, error) {
+	point, err := bls12381.HashToG2(message, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature bls12381.G2Affine
+	signature.ScalarMultiplication(&point, k.scalar)
+	compressed := signature.Bytes()
+	return compressed[:], nil
+}
+
+// Verify checks a signature of message by publicKey.
+func Verify(publicKey, message, signature []byte) (bool, error) {
+	var pub bls12381.G1Affine
+	if _, err := pub.SetBytes(publicKey); err != nil || pub.IsInfinity() {
+		return false, ErrInvalidPublicKey
+	}
+	var sig bls12381.G2Affine
+	if _, err := sig.SetBytes(signature); err != nil {
+		return false, ErrInvalidSignature
+	}
+	point, err := bls12381.HashToG2(message, dst)
+	if err != nil {
+		return false, err
+	}
+
+	// e(pub, H(m)) == e(g1, sig)
+	_, _, g1, _ := bls12381.Generators()
+	var negG1 bls12381.G1Affine
+	negG1.Neg(&g1)
+	return bls12381.PairingCheck([]bls12381.G1Affine{pub, negG1}, []bls12381.G2Affine{point, sig})
+}
+
+// hkdfModR is EIP-2333's HKDF_mod_r, which turns keying material into a
+// nonzero scalar.
+func hkdfModR(ikm []byte) *big.Int {
+	salt := []byte("BLS-SIG-KEYGEN-SALT-")
+	ikm = append(append([]byte{}, ikm...), 0)
+	for {
+		digest := sha256.Sum256(salt)
+		salt = digest[:]
+
+		okm := make([]byte, 48)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte{0, 48}), okm); err != nil {
+			panic(err)
+		}
+		scalar := new(big.Int).SetBytes(okm)
+		scalar.Mod(scalar, fr.Modulus())
+		if scalar.Sign() != 0 {
+			return scalar
+		}
+	}
+}
+
+// deriveChild is EIP-2333's derive_child_SK, which hashes a Lamport public
+// key made from the parent key and index, so that a child key reveals
+// nothing of its parent.
+func deriveChild(parent *big.Int, index uint32) *big.Int {
+	salt := binary.BigEndian.AppendUint32(nil, index)
+	ikm := parent.FillBytes(make([]byte, 32))
+	notIKM := make([]byte, len(ikm))
+	for i, b := range ikm {
+		notIKM[i] = ^b
+	}
+
+	lamportPK := sha256.New()
+	for _, material := range [][]byte{ikm, notIKM} {
+		okm := make([]byte, 255*32)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, material, salt, nil), okm); err != nil {
+			panic(err)
+		}
+		for i := 0; i < len(okm); i += 32 {
+			chunk := sha256.Sum256(okm[i : i+32])
+			lamportPK.Write(chunk[:])
+		}
+	}
+
+	return hkdfModR(lamportPK.Sum(nil))
+}
+
+// parsePath parses an EIP-2334 path. Every level is hardened in EIP-2333,
+// so indexes take no ' marks.
+func parsePath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, fmt.Errorf("%w: %q must start with m", ErrInvalidPath, path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPath, path)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+
+	return indexes, nil
+}
@@ -0,0 +1,215 @@
+package bls
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Scrypt costs of new keystores. The light ones are for tests and small
+// machines, as go-ethereum's are.
+const (
+	StandardScryptN = 1 << 18
+	LightScryptN    = 1 << 12
+)
+
+var ErrWrongPassword = errors.New("wrong keystore password")
+
+// Keystore is an EIP-2335 keystore, the format validator clients import.
+type Keystore struct {
+	Crypto      KeystoreCrypto `json:"crypto"`
+	Description string         `json:"description"`
+	PublicKey   string         `json:"pubkey"`
+	Path        string         `json:"path"`
+	UUID        string         `json:"uuid"`
+	Version     int            `json:"version"`
+}
+
+type KeystoreCrypto struct {
+	KDF      KeystoreModule `json:"kdf"`
+	Checksum KeystoreModule `json:"checksum"`
+	Cipher   KeystoreModule `json:"cipher"`
+}
+
+type KeystoreModule struct {
+	Function string                 `json:"function"`
+	Params   map[string]interface{} `json:"params"`
+	Message  string                 `json:"message"`
+}
+
+// EncryptKeystore encrypts key under password with scrypt of cost scryptN
+// and AES-128-CTR. path is the key's EIP-2334 path, empty if it has none.
+func EncryptKeystore(key *SecretKey, password, path string, scryptN int) (*Keystore, error) {
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	for _, b := range [][]byte{salt, iv} {
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return nil, err
+		}
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	derived, err := scrypt.Key(normalizePassword(password), salt, scryptN, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := aesCTR(derived[:16], iv, key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keystore{
+		Crypto: KeystoreCrypto{
+			KDF: KeystoreModule{
+				Function: "scrypt",
+				Params:   map[string]interface{}{"dklen": 32, "n": scryptN, "r": 8, "p": 1, "salt": hex.EncodeToString(salt)},
+			},
+			Checksum: KeystoreModule{
+				Function: "sha256",
+				Params:   map[string]interface{}{},
+				Message:  hex.EncodeToString(checksum(derived, ciphertext)),
+			},
+			Cipher: KeystoreModule{
+				Function: "aes-128-ctr",
+				Params:   map[string]interface{}{"iv": hex.EncodeToString(iv)},
+				Message:  hex.EncodeToString(ciphertext),
+			},
+		},
+		PublicKey: hex.EncodeToString(key.PublicKey()),
+		Path:      path,
+		UUID:      id.String(),
+		Version:   4,
+	}, nil
+}
+
+// DecryptKeystore decrypts a keystore with either KDF EIP-2335 allows.
+func DecryptKeystore(keystore *Keystore, password string) (*SecretKey, error) {
+	if keystore.Version != 4 {
+		return nil, fmt.Errorf("unsupported keystore version %d", keystore.Version)
+	}
+	c := keystore.Crypto
+	if c.Checksum.Function != "sha256" || c.Cipher.Function != "aes-128-ctr" {
+		return nil, fmt.Errorf("unsupported keystore checksum %q or cipher %q", c.Checksum.Function, c.Cipher.Function)
+	}
+
+	salt, err := hexParam(c.KDF.Params, "salt")
+	if err != nil {
+		return nil, err
+	}
+	dklen := intParam(c.KDF.Params, "dklen")
+	if dklen < 32 {
+		return nil, errors.New("keystore dklen must be at least 32")
+	}
+	var derived []byte
+	switch c.KDF.Function {
+	case "scrypt":
+		derived, err = scrypt.Key(normalizePassword(password), salt, intParam(c.KDF.Params, "n"), intParam(c.KDF.Params, "r"), intParam(c.KDF.Params, "p"), dklen)
+		if err != nil {
+			return nil, err
+		}
+	case "pbkdf2":
+		if prf, _ := c.KDF.Params["prf"].(string); prf != "hmac-sha256" {
+			return nil, fmt.Errorf("unsupported keystore PRF %q", prf)
+		}
+		derived = pbkdf2.Key(normalizePassword(password), salt, intParam(c.KDF.Params, "c"), dklen, sha256.New)
+	default:
+		return nil, fmt.Errorf("unsupported keystore KDF %q", c.KDF.Function)
+	}
+
+	ciphertext, err := hex.DecodeString(c.Cipher.Message)
+	if err != nil {
+		return nil, errors.New("malformed keystore cipher message")
+	}
+	want, err := hex.DecodeString(c.Checksum.Message)
+	if err != nil || !bytes.Equal(checksum(derived, ciphertext), want) {
+		return nil, ErrWrongPassword
+	}
+	iv, err := hexParam(c.Cipher.Params, "iv")
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aesCTR(derived[:16], iv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := SecretKeyFromBytes(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if keystore.PublicKey != "" && !strings.EqualFold(strings.TrimPrefix(keystore.PublicKey, "0x"), hex.EncodeToString(key.PublicKey())) {
+		return nil, errors.New("keystore public key does not match its secret key")
+	}
+
+	return key, nil
+}
+
+func checksum(derived, ciphertext []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, derived[16:32]...), ciphertext...))
+	return sum[:]
+}
+
+func aesCTR(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("keystore IV must be 16 bytes")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+
+	return out, nil
+}
+
+// normalizePassword applies NFKD and drops control characters, so that the
+// same password typed on different systems decrypts the same keystore.
+func normalizePassword(password string) []byte {
+	var normalized strings.Builder
+	for _, r := range norm.NFKD.String(password) {
+		if r < 0x20 || (r >= 0x7f && r <= 0x9f) {
+			continue
+		}
+		normalized.WriteRune(r)
+	}
+
+	return []byte(normalized.String())
+}
+
+func hexParam(params map[string]interface{}, name string) ([]byte, error) {
+	value, _ := params[name].(string)
+	decoded, err := hex.DecodeString(value)
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf("malformed keystore %s", name)
+	}
+
+	return decoded, nil
+}
+
+// intParam reads a number param, which JSON decodes as a float64.
+func intParam(params map[string]interface{}, name string) int {
+	switch value := params[name].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	}
+
+	return 0
+}
@@ -0,0 +1,172 @@
+// Command import migrates keys from other wallets into this wallet's storage.
+//
+// Usage:
+//
+//	import [-dir wallet-dir] [-dry-run] [-metamask vault.json] [-keystore dir] [-keys dir]
+//
+// Passwords are read from IMPORT_METAMASK_PASSWORD and IMPORT_KEYSTORE_PASSWORD,
+// or from the files named by -metamask-password-file and -keystore-password-file.
+// Imported keys are stored in the wallet's keystore under the password in
+// IMPORT_WALLET_PASSWORD or the file named by -wallet-password-file.
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// candidate is one key found in a source, before it is imported.
+type candidate struct {
+	source     string
+	label      string
+	privateKey *ecdsa.PrivateKey
+	err        error
+}
+
+func main() {
+	dir := flag.String("dir", ".", "wallet working directory")
+	dryRun := flag.Bool("dry-run", false, "report what would be imported without writing anything")
+	metamaskVault := flag.String("metamask", "", "MetaMask vault JSON or exported state file")
+	metamaskPasswordFile := flag.String("metamask-password-file", "", "file containing the MetaMask password")
+	keystoreDir := flag.String("keystore", "", "geth keystore directory")
+	keystorePasswordFile := flag.String("keystore-password-file", "", "file containing the keystore password")
+	keysDir := flag.String("keys", "", "directory of raw hex private key files")
+	walletPasswordFile := flag.String("wallet-password-file", "", "file containing the password to store imported keys under")
+	flag.Parse()
+
+	if *metamaskVault == "" && *keystoreDir == "" && *keysDir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := os.Chdir(*dir); err != nil {
+		log.Fatal(err)
+	}
+	if err := services.InitDataEncryption(); err != nil {
+		log.Fatal(err)
+	}
+
+	var walletPassword string
+	if !*dryRun {
+		password, err := readPassword("IMPORT_WALLET_PASSWORD", *walletPasswordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if password == "" {
+			log.Fatal(services.ErrPasswordRequired)
+		}
+		walletPassword = password
+	}
+
+	var candidates []candidate
+	if *metamaskVault != "" {
+		password, err := readPassword("IMPORT_METAMASK_PASSWORD", *metamaskPasswordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		found, err := readMetaMask(*metamaskVault, password)
+		if err != nil {
+			log.Fatalf("metamask: %v", err)
+		}
+		candidates = append(candidates, found...)
+	}
+	if *keystoreDir != "" {
+		password, err := readPassword("IMPORT_KEYSTORE_PASSWORD", *keystorePasswordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		found, err := readKeystore(*keystoreDir, password)
+		if err != nil {
+			log.Fatalf("keystore: %v", err)
+		}
+		candidates = append(candidates, found...)
+	}
+	if *keysDir != "" {
+		found, err := readKeyFiles(*keysDir)
+		if err != nil {
+			log.Fatalf("keys: %v", err)
+		}
+		candidates = append(candidates, found...)
+	}
+
+	existing, _, err := services.ListAccounts()
+	if err != nil {
+		log.Fatal(err)
+	}
+	known := map[string]bool{}
+	for _, account := range existing {
+		known[strings.ToLower(account.Address)] = true
+	}
+
+	report := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(report, "SOURCE\tADDRESS\tLABEL\tRESULT")
+
+	seen := map[string]bool{}
+	imported, failed := 0, 0
+	for _, c := range candidates {
+		if c.err != nil {
+			failed++
+			fmt.Fprintf(report, "%s\t-\t%s\terror: %v\n", c.source, c.label, c.err)
+			continue
+		}
+
+		address := crypto.PubkeyToAddress(c.privateKey.PublicKey).Hex()
+		result := "imported"
+		switch {
+		case known[strings.ToLower(address)]:
+			result = "skipped: already in wallet"
+		case seen[strings.ToLower(address)]:
+			result = "skipped: duplicate"
+		case *dryRun:
+			result = "would import"
+			imported++
+		default:
+			if _, err := services.ImportAccount(c.label, c.privateKey, walletPassword); err != nil && !errors.Is(err, services.ErrAccountExists) {
+				failed++
+				result = "error: " + err.Error()
+			} else {
+				imported++
+			}
+		}
+		seen[strings.ToLower(address)] = true
+
+		fmt.Fprintf(report, "%s\t%s\t%s\t%s\n", c.source, address, c.label, result)
+	}
+	report.Flush()
+
+	verb := "imported"
+	if *dryRun {
+		verb = "to import"
+	}
+	fmt.Printf("\n%d %s, %d failed, %d found\n", imported, verb, failed, len(candidates))
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func readPassword(env, file string) (string, error) {
+	if file != "" {
+		password, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(password), "\r\n"), nil
+	}
+
+	password, ok := os.LookupEnv(env)
+	if !ok {
+		return "", fmt.Errorf("%s is not set", env)
+	}
+
+	return password, nil
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jabbala-dev/go-wallet/hdwallet"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// MetaMask encrypts its vault with AES-GCM under a PBKDF2-SHA256 key; older
+// vaults omit keyMetadata and use 10000 iterations.
+const metamaskDefaultIterations = 10000
+
+type metamaskVault struct {
+	Data        string `json:"data"`
+	IV          string `json:"iv"`
+	Salt        string `json:"salt"`
+	KeyMetadata *struct {
+		Params struct {
+			Iterations int `json:"iterations"`
+		} `json:"params"`
+	} `json:"keyMetadata"`
+}
+
+type metamaskKeyring struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// readMetaMask accepts either the bare vault JSON or a state dump containing
+// KeyringController.vault, in which case account names are carried over from
+// the preferences or accounts controller.
+func readMetaMask(path, password string) ([]candidate, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state struct {
+		KeyringController *struct {
+			Vault string `json:"vault"`
+		} `json:"KeyringController"`
+		PreferencesController *struct {
+			Identities map[string]struct {
+				Name string `json:"name"`
+			} `json:"identities"`
+		} `json:"PreferencesController"`
+		AccountsController *struct {
+			InternalAccounts struct {
+				Accounts map[string]struct {
+					Address  string `json:"address"`
+					Metadata struct {
+						Name string `json:"name"`
+					} `json:"metadata"`
+				} `json:"accounts"`
+			} `json:"internalAccounts"`
+		} `json:"AccountsController"`
+	}
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{}
+	if state.PreferencesController != nil {
+		for address, identity := range state.PreferencesController.Identities {
+			labels[strings.ToLower(address)] = identity.Name
+		}
+	}
+	if state.AccountsController != nil {
+		for _, account := range state.AccountsController.InternalAccounts.Accounts {
+			labels[strings.ToLower(account.Address)] = account.Metadata.Name
+		}
+	}
+
+	vaultJSON := raw
+	if state.KeyringController != nil {
+		vaultJSON = []byte(state.KeyringController.Vault)
+	}
+
+	var vault metamaskVault
+	if err := json.Unmarshal(vaultJSON, &vault); err != nil {
+		return nil, fmt.Errorf("invalid vault: %w", err)
+	}
+
+	plaintext, err := decryptMetaMaskVault(vault, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyrings []metamaskKeyring
+	if err := json.Unmarshal(plaintext, &keyrings); err != nil {
+		return nil, fmt.Errorf("invalid vault contents: %w", err)
+	}
+
+	var candidates []candidate
+	for i, keyring := range keyrings {
+		source := fmt.Sprintf("metamask:%d", i)
+
+		var found []candidate
+		switch keyring.Type {
+		case "HD Key Tree":
+			found, err = metamaskHDAccounts(source, keyring.Data)
+		case "Simple Key Pair":
+			found, err = metamaskSimpleKeys(source, keyring.Data)
+		default:
+			err = fmt.Errorf("unsupported keyring type %q", keyring.Type)
+		}
+		if err != nil {
+			candidates = append(candidates, candidate{source: source, err: err})
+			continue
+		}
+
+		for _, c := range found {
+			if c.err == nil {
+				c.label = labels[strings.ToLower(crypto.PubkeyToAddress(c.privateKey.PublicKey).Hex())]
+			}
+			candidates = append(candidates, c)
+		}
+	}
+
+	return candidates, nil
+}
+
+func decryptMetaMaskVault(vault metamaskVault, password string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(vault.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault salt: %w", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(vault.IV)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault iv: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(vault.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault data: %w", err)
+	}
+
+	iterations := metamaskDefaultIterations
+	if vault.KeyMetadata != nil && vault.KeyMetadata.Params.Iterations > 0 {
+		iterations = vault.KeyMetadata.Params.Iterations
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, iv, data, nil)
+	if err != nil {
+		return nil, errors.New("incorrect password or corrupted vault")
+	}
+
+	return plaintext, nil
+}
+
+func metamaskHDAccounts(source string, raw json.RawMessage) ([]candidate, error) {
+	var data struct {
+		Mnemonic         json.RawMessage `json:"mnemonic"`
+		NumberOfAccounts int             `json:"numberOfAccounts"`
+		HDPath           string          `json:"hdPath"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	// Newer vaults serialise the mnemonic as an array of UTF-8 bytes.
+	var mnemonic string
+	if err := json.Unmarshal(data.Mnemonic, &mnemonic); err != nil {
+		var bytes []byte
+		var codes []int
+		if err := json.Unmarshal(data.Mnemonic, &codes); err != nil {
+			return nil, errors.New("unrecognised mnemonic encoding")
+		}
+		for _, code := range codes {
+			bytes = append(bytes, byte(code))
+		}
+		mnemonic = string(bytes)
+	}
+
+	if data.HDPath == "" {
+		data.HDPath = hdwallet.DefaultBasePath
+	}
+	if data.NumberOfAccounts == 0 {
+		data.NumberOfAccounts = 1
+	}
+
+	master, err := hdwallet.NewMaster(hdwallet.MnemonicToSeed(mnemonic, ""))
+	if err != nil {
+		return nil, err
+	}
+	base, err := master.Derive(data.HDPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []candidate
+	for i := 0; i < data.NumberOfAccounts; i++ {
+		child, err := base.Child(uint32(i))
+		if err != nil {
+			candidates = append(candidates, candidate{source: fmt.Sprintf("%s/%d", source, i), err: err})
+			continue
+		}
+		privateKey, err := child.PrivateKey()
+		candidates = append(candidates, candidate{source: fmt.Sprintf("%s/%d", source, i), privateKey: privateKey, err: err})
+	}
+
+	return candidates, nil
+}
+
+func metamaskSimpleKeys(source string, raw json.RawMessage) ([]candidate, error) {
+	var keys []string
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return nil, err
+	}
+
+	var candidates []candidate
+	for i, key := range keys {
+		c := candidate{source: fmt.Sprintf("%s/%d", source, i)}
+		c.privateKey, c.err = parseHexKey(key)
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
+
+// readKeystore decrypts every V3 keystore file in dir with one password.
+func readKeystore(dir, password string) ([]candidate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []candidate
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		c := candidate{source: "keystore:" + entry.Name()}
+		keyJSON, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			c.err = err
+		} else if key, err := keystore.DecryptKey(keyJSON, password); err != nil {
+			c.err = err
+		} else {
+			c.privateKey = key.PrivateKey
+		}
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
+
+// readKeyFiles reads one hex private key per file, using the file name
+// (without extension) as the account label.
+func readKeyFiles(dir string) ([]candidate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []candidate
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		c := candidate{
+			source: "keys:" + entry.Name(),
+			label:  strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())),
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			c.err = err
+		} else {
+			c.privateKey, c.err = parseHexKey(string(raw))
+		}
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
+
+func parseHexKey(value string) (*ecdsa.PrivateKey, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(value), "0x"))
+	if err != nil {
+		return nil, errors.New("not a hex private key")
+	}
+
+	return crypto.ToECDSA(raw)
+}
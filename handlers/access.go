@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+const clientKey = "client"
+
+// RestrictAccess applies the access policy's address and country rules for
+// the route's endpoint group, before the caller is authenticated.
+func RestrictAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		decision, err := services.CheckAccess(accessGroup(c.Request.Method, c.FullPath()), c.Request.RemoteAddr, c.GetHeader("X-Forwarded-For"))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, err.Error())
+			c.Abort()
+			return
+		}
+		if !decision.Allowed {
+			respondError(c, http.StatusForbidden, "Access denied from this address")
+			c.Abort()
+			return
+		}
+
+		c.Set(clientKey, decision.Client)
+		c.Next()
+	}
+}
+
+// accessGroup follows the scope a route needs: admin:config routes are admin
+// routes, accounts:read routes are read routes and the rest change wallet
+// state and are signing routes. Public and unknown routes are read routes.
+func accessGroup(method, path string) string {
+	if path == "" || publicRoutes[method+" "+path] {
+		return services.AccessRead
+	}
+
+	switch requiredScope(method, path) {
+	case services.ScopeAdminConfig:
+		return services.AccessAdmin
+	case services.ScopeAccountsRead:
+		return services.AccessRead
+	}
+	return services.AccessSigning
+}
+
+func GetAccessPolicy(c *gin.Context) {
+	policy, err := services.GetAccessPolicy()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+func SetAccessPolicy(c *gin.Context) {
+	var request services.AccessPolicy
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	policy, err := services.SetAccessPolicy(request, c.GetString(clientKey))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidAccessPolicy) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
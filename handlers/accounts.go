@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+	"github.com/skip2/go-qrcode"
+)
+
+var accountList = listSpec{
+	fields: map[string]int{"name": fieldText, "address": fieldText, "key_storage": fieldText, "locked": fieldBool},
+	key:    "address",
+	sort:   "name",
+}
+
+func ListAccounts(c *gin.Context) {
+	query, ok := listQueryFrom(c, accountList)
+	if !ok {
+		return
+	}
+
+	accounts, selected, err := services.ListAccounts()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	usage, err := services.ListAccountUsage()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	addresses := make([]string, len(accounts))
+	for i, account := range accounts {
+		addresses[i] = account.Address
+	}
+	names := services.ENSNames(addresses)
+
+	type accountWithUsage struct {
+		services.Account
+		KeyStorage string                `json:"key_storage"`
+		Locked     bool                  `json:"locked"`
+		Usage      services.AccountUsage `json:"usage"`
+		ENS        *services.ENSProfile  `json:"ens,omitempty"`
+	}
+
+	list := make([]accountWithUsage, 0, len(accounts))
+	for _, account := range accounts {
+		address := common.HexToAddress(account.Address)
+		counters, ok := usage[address]
+		if !ok {
+			counters = services.AccountUsage{ValueMoved: "0"}
+		}
+		storage, unlocked := services.AccountKeyStorage(account.Address)
+		list = append(list, accountWithUsage{
+			Account:    account,
+			KeyStorage: storage,
+			Locked:     !unlocked,
+			Usage:      counters,
+			ENS:        names[address.Hex()],
+		})
+	}
+
+	list, next, err := pageList(query, list)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	items, err := query.selectFields(list)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": items, "selected": selected, "next_cursor": next})
+}
+
+func CreateAccount(c *gin.Context) {
+	var request struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	account, err := services.CreateAccount(request.Name, request.Password)
+	if err != nil {
+		respondError(c, accountErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// AddWatchOnlyAccount adds an address, or an xpub's addresses, that the
+// wallet follows without being able to sign for.
+func AddWatchOnlyAccount(c *gin.Context) {
+	var request struct {
+		Name    string `json:"name"`
+		Address string `json:"address"`
+		XPub    string `json:"xpub"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if (request.Address == "") == (request.XPub == "") {
+		respondError(c, http.StatusBadRequest, "An address or an xpub is required")
+		return
+	}
+
+	if request.XPub != "" {
+		hd, err := services.WatchXPub(request.Name, request.XPub)
+		if err != nil {
+			respondHDError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"hd_account": hd})
+		return
+	}
+
+	if !common.IsHexAddress(request.Address) {
+		respondError(c, http.StatusBadRequest, "Invalid address")
+		return
+	}
+	account, err := services.AddWatchOnlyAccount(request.Name, request.Address)
+	if err != nil {
+		respondError(c, accountErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"account": account})
+}
+
+func SelectAccount(c *gin.Context) {
+	var request struct {
+		Address string `json:"address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if err := services.SelectAccount(request.Address); err != nil {
+		respondError(c, accountErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"selected": request.Address})
+}
+
+// RenameAccount renames the account given by address or name in the path.
+func RenameAccount(c *gin.Context) {
+	var request struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	account, err := services.RenameAccount(c.Param("account"), request.Name)
+	if err != nil {
+		respondError(c, accountErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// DeleteAccount removes an account and deletes its key files, which cannot
+// be undone.
+func DeleteAccount(c *gin.Context) {
+	account, err := services.DeleteAccount(c.Param("account"))
+	if err != nil {
+		respondError(c, accountErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": account})
+}
+
+func accountErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrAccountNameTaken), errors.Is(err, services.ErrAccountExists):
+		return http.StatusConflict
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
+
+// UnlockAccount decrypts an account's keystore key so it can sign, for
+// duration seconds or five minutes. Without an address the selected account
+// is unlocked.
+func UnlockAccount(c *gin.Context) {
+	var request struct {
+		Address  string `json:"address"`
+		Password string `json:"password"`
+		Duration int64  `json:"duration"`
+	}
+
+	if err := c.BindJSON(&request); err != nil || request.Duration < 0 {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	expires, err := services.UnlockAccount(request.Address, request.Password, time.Duration(request.Duration)*time.Second)
+	if err != nil {
+		respondError(c, keystoreErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unlocked_until": expires})
+}
+
+func LockAccount(c *gin.Context) {
+	var request struct {
+		Address string `json:"address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if err := services.LockAccount(request.Address); err != nil {
+		respondError(c, keystoreErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"locked": true})
+}
+
+// EncryptAccountKey moves a plain-text key into the keystore.
+func EncryptAccountKey(c *gin.Context) {
+	var request struct {
+		Address  string `json:"address"`
+		Password string `json:"password"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if err := services.EncryptAccountKey(request.Address, request.Password); err != nil {
+		respondError(c, keystoreErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key_storage": services.KeyStorageKeystore})
+}
+
+func keystoreErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotInKeystore):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrAlreadyEncrypted):
+		return http.StatusConflict
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
+
+func GetAddressQR(c *gin.Context) {
+	address := c.Query("address")
+	if address == "" {
+		var err error
+		address, err = services.GetAddress("")
+		if err != nil {
+			respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+			return
+		}
+	}
+
+	png, err := qrcode.Encode("ethereum:"+address, qrcode.Medium, 256)
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	c.Data(http.StatusOK, "image/png", png)
+}
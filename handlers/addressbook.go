@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// ListAddressBook lists the address book by name, only the entries with
+// ?label= if given.
+func ListAddressBook(c *gin.Context) {
+	entries, err := services.ListAddressBook(c.Query("label"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+func GetAddressBookEntry(c *gin.Context) {
+	entries, err := services.GetAddressBookEntries(c.Param("address"))
+	if err != nil {
+		respondError(c, addressBookErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// SaveAddressBookEntry adds a named address, replacing any entry for it on
+// the same chain.
+func SaveAddressBookEntry(c *gin.Context) {
+	var entry services.AddressBookEntry
+	if err := c.BindJSON(&entry); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	saved, err := services.SaveAddressBookEntry(entry)
+	if err != nil {
+		respondError(c, addressBookErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// DeleteAddressBookEntry removes an address's entries, only the one for
+// ?chain_id= if given.
+func DeleteAddressBookEntry(c *gin.Context) {
+	var chainID *uint64
+	if value := c.Query("chain_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid chain ID")
+			return
+		}
+		chainID = &id
+	}
+
+	if err := services.DeleteAddressBookEntry(c.Param("address"), chainID); err != nil {
+		respondError(c, addressBookErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": c.Param("address")})
+}
+
+func addressBookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidAddressBookEntry):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrAddressBookEntryNotFound):
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+type airdropRequest struct {
+	Distributor string                 `json:"distributor"`
+	Proofs      services.AirdropProofs `json:"proofs"`
+	Addresses   []string               `json:"addresses"`
+	ChainID     chainSelector          `json:"chain_id"`
+}
+
+// CheckAirdrop reports which addresses, every account if none are given,
+// can claim from a Merkle distributor with the proof file sent.
+func CheckAirdrop(c *gin.Context) {
+	var request airdropRequest
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	if !chainAddresses(c, chain, &request.Distributor) {
+		return
+	}
+	for i := range request.Addresses {
+		if !chainAddresses(c, chain, &request.Addresses[i]) {
+			return
+		}
+	}
+
+	check, err := services.CheckAirdrop(chain, request.Distributor, request.Proofs, request.Addresses)
+	if err != nil {
+		respondError(c, airdropErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"airdrop": check})
+}
+
+// ClaimAirdrop claims the unclaimed airdrops of the addresses, paid for by
+// the selected account.
+func ClaimAirdrop(c *gin.Context) {
+	var request airdropRequest
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	if !chainAddresses(c, chain, &request.Distributor) {
+		return
+	}
+	for i := range request.Addresses {
+		if !chainAddresses(c, chain, &request.Addresses[i]) {
+			return
+		}
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(nil))
+	if !ok {
+		return
+	}
+
+	claim, err := services.ClaimAirdrop(chain, request.Distributor, request.Proofs, request.Addresses)
+	if err != nil {
+		if claim == nil || len(claim.Transactions) == 0 {
+			refund()
+		}
+		respondSendError(c, airdropErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"airdrop": claim})
+}
+
+func airdropErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidAirdropProofs):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrAirdropRootMismatch), errors.Is(err, services.ErrNothingToClaim):
+		return http.StatusConflict
+	}
+
+	return errorStatus(err, http.StatusBadRequest)
+}
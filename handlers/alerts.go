@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func ListAlerts(c *gin.Context) {
+	alerts, err := services.ListAlerts(c.Query("all") == "true")
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	if alerts == nil {
+		alerts = []*services.Alert{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+}
+
+func AcknowledgeAlert(c *gin.Context) {
+	if err := services.AcknowledgeAlert(c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrAlertNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"acknowledged": c.Param("id")})
+}
+
+func ApproveAlert(c *gin.Context) {
+	if err := services.ApproveAlert(c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrAlertNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrAlertNotApprovable):
+			status = http.StatusConflict
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"approved": c.Param("id")})
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/models"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// SignBatchAttestation signs the Merkle root of a batch of messages,
+// returning a proof for each message.
+func SignBatchAttestation(c *gin.Context) {
+	var request struct {
+		Account  string   `json:"account"`
+		Messages []string `json:"messages"`
+		Scheme   string   `json:"scheme"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := models.CheckSignScheme(request.Scheme); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	attestation, err := services.SignBatchAttestation(request.Account, request.Messages, request.Scheme)
+	if err != nil {
+		refund()
+		respondError(c, attestationErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, attestation)
+}
+
+// VerifyBatchAttestation checks one message of a batch against the batch's
+// root and returns who signed the root.
+func VerifyBatchAttestation(c *gin.Context) {
+	var request struct {
+		Message   string   `json:"message"`
+		Proof     []string `json:"proof"`
+		Root      string   `json:"root"`
+		Signature string   `json:"signature"`
+		Scheme    string   `json:"scheme"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	included, signer, err := services.VerifyBatchAttestation(request.Message, request.Proof, request.Root, request.Signature, request.Scheme)
+	if err != nil {
+		respondError(c, attestationErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"included": included, "signer": signer})
+}
+
+func attestationErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidBatch) {
+		return http.StatusBadRequest
+	}
+
+	return signErrorStatus(err)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func ListAuditEvents(c *gin.Context) {
+	filter := services.AuditFilter{Kind: c.Query("kind")}
+
+	if since := c.Query("since"); since != "" {
+		var err error
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid since timestamp")
+			return
+		}
+	}
+
+	events, err := services.ListAuditEvents(filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if events == nil {
+		events = []services.AuditEvent{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// GetSIEMStatus shows whether the audit log is being streamed to a SIEM
+// collector and how far behind it is.
+func GetSIEMStatus(c *gin.Context) {
+	status, err := services.GetSIEMStatus()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/i18n"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// sessionCookie carries the access token for the browser UI. It is
+// SameSite=Strict, so other sites cannot make requests that carry it.
+const sessionCookie = "wallet_session"
+
+const principalKey = "principal"
+
+// publicRoutes are served without authentication.
+var publicRoutes = map[string]bool{
+	"GET /":                  true,
+	"GET /public/*filepath":  true,
+	"HEAD /public/*filepath": true,
+	"GET /i18n":              true,
+	"GET /readyz":            true,
+	"GET /openapi.json":      true,
+	"GET /identity":          true,
+	"GET /auth/login":        true,
+	"GET /auth/callback":     true,
+	"POST /auth/token":       true,
+	"POST /auth/logout":      true,
+	"POST /auth/revoke":      true,
+}
+
+// routeScopes is the scope each route requires. GET routes not listed need
+// accounts:read; any other route not listed needs admin:config, so a route
+// added without an entry is closed rather than open.
+var routeScopes = map[string]string{
+	// Read-only checks sent as POST.
+	"POST /verify":              services.ScopeAccountsRead,
+	"POST /verify/batch":        services.ScopeAccountsRead,
+	"POST /recover":             services.ScopeAccountsRead,
+	"POST /estimate":            services.ScopeAccountsRead,
+	"POST /estimate/calldata":   services.ScopeAccountsRead,
+	"POST /token/check":         services.ScopeAccountsRead,
+	"POST /airdrops/check":      services.ScopeAccountsRead,
+	"POST /contract/:name/call": services.ScopeAccountsRead,
+	"POST /snapshot/diff":       services.ScopeAccountsRead,
+
+	// One-time challenges for others to sign; only their own store changes.
+	"POST /verify/challenge": services.ScopeAccountsRead,
+	"POST /verify/consume":   services.ScopeAccountsRead,
+
+	// Tokens for the caller, with no more than the caller's own scopes.
+	"POST /auth/tokens": services.ScopeAccountsRead,
+
+	// Lists a hardware wallet's addresses; a POST to keep its PIN out of URLs.
+	"POST /hardware/addresses": services.ScopeAccountsRead,
+
+	"POST /generate":                                     services.ScopeAccountsWrite,
+	"POST /accounts":                                     services.ScopeAccountsWrite,
+	"POST /accounts/watch":                               services.ScopeAccountsWrite,
+	"POST /accounts/select":                              services.ScopeAccountsWrite,
+	"POST /networks/select":                              services.ScopeAccountsWrite,
+	"POST /accounts/unlock":                              services.ScopeAccountsWrite,
+	"POST /accounts/lock":                                services.ScopeAccountsWrite,
+	"POST /accounts/encrypt":                             services.ScopeAccountsWrite,
+	"PUT /accounts/:account":                             services.ScopeAccountsWrite,
+	"POST /alerts/:id/ack":                               services.ScopeAccountsWrite,
+	"POST /nfts/collections":                             services.ScopeAccountsWrite,
+	"POST /nfts/scan":                                    services.ScopeAccountsWrite,
+	"POST /contracts":                                    services.ScopeAccountsWrite,
+	"DELETE /contracts/:name":                            services.ScopeAccountsWrite,
+	"POST /ipfs/upload":                                  services.ScopeAccountsWrite,
+	"POST /hd/accounts/:id/derive":                       services.ScopeAccountsWrite,
+	"POST /hd/accounts/:id/scan":                         services.ScopeAccountsWrite,
+	"POST /hardware/accounts":                            services.ScopeAccountsWrite,
+	"POST /keystore/keys":                                services.ScopeAccountsWrite,
+	"POST /validators/keys":                              services.ScopeAccountsWrite,
+	"POST /validators/keys/import":                       services.ScopeAccountsWrite,
+	"POST /smart-accounts":                               services.ScopeAccountsWrite,
+	"POST /safes/:address/sync":                          services.ScopeAccountsWrite,
+	"POST /safes/:address/transactions/:hash/signatures": services.ScopeAccountsWrite,
+	"POST /ledger/prices":                                services.ScopeAccountsWrite,
+	"DELETE /ledger/prices":                              services.ScopeAccountsWrite,
+	"POST /ledger/lots":                                  services.ScopeAccountsWrite,
+	"DELETE /ledger/lots/:id":                            services.ScopeAccountsWrite,
+
+	"POST /sign":                                              services.ScopeTxSend,
+	"POST /sign/typed":                                        services.ScopeTxSend,
+	"POST /sign/batch":                                        services.ScopeTxSend,
+	"POST /validators/keys/:pubkey/deposit":                   services.ScopeTxSend,
+	"POST /validators/keys/:pubkey/exit":                      services.ScopeTxSend,
+	"POST /hd/accounts/:id/sign":                              services.ScopeTxSend,
+	"POST /transaction":                                       services.ScopeTxSend,
+	"POST /contract/deploy":                                   services.ScopeTxSend,
+	"POST /contract/:name/send":                               services.ScopeTxSend,
+	"POST /transaction/build":                                 services.ScopeAccountsRead,
+	"POST /transaction/sign":                                  services.ScopeTxSend,
+	"POST /transaction/broadcast":                             services.ScopeTxSend,
+	"POST /transaction/preview":                               services.ScopeTxSend,
+	"POST /transaction/preview/:id/approve":                   services.ScopeTxSend,
+	"POST /transaction/preview/:id/reject":                    services.ScopeTxSend,
+	"POST /transaction/scheduled":                             services.ScopeTxSend,
+	"DELETE /transaction/scheduled/:id":                       services.ScopeTxSend,
+	"POST /transaction/:hash/speedup":                         services.ScopeTxSend,
+	"POST /transaction/:hash/cancel":                          services.ScopeTxSend,
+	"POST /payouts":                                           services.ScopeTxSend,
+	"DELETE /payouts/:id":                                     services.ScopeTxSend,
+	"POST /nfts/mint":                                         services.ScopeTxSend,
+	"POST /nfts/transfer":                                     services.ScopeTxSend,
+	"POST /ens/primary":                                       services.ScopeTxSend,
+	"POST /ens/registrations":                                 services.ScopeTxSend,
+	"POST /ens/registrations/:id/register":                    services.ScopeTxSend,
+	"POST /ens/renew":                                         services.ScopeTxSend,
+	"PUT /ens/records/:name":                                  services.ScopeTxSend,
+	"POST /smart-accounts/:address/send":                      services.ScopeTxSend,
+	"POST /smart-accounts/:address/guardians":                 services.ScopeTxSend,
+	"DELETE /smart-accounts/:address/guardians/:guardian":     services.ScopeTxSend,
+	"PUT /smart-accounts/:address/guardians/threshold":        services.ScopeTxSend,
+	"POST /smart-accounts/:address/recoveries":                services.ScopeTxSend,
+	"POST /smart-accounts/:address/recoveries/:id/signatures": services.ScopeTxSend,
+	"POST /smart-accounts/:address/recoveries/:id/execute":    services.ScopeTxSend,
+	"POST /delegations":                                       services.ScopeTxSend,
+	"POST /delegations/authorizations":                        services.ScopeTxSend,
+	"POST /airdrops/claims":                                   services.ScopeTxSend,
+	"POST /safes/:address/transactions":                       services.ScopeTxSend,
+	"POST /safes/:address/transactions/:hash/confirmations":   services.ScopeTxSend,
+	"POST /safes/:address/transactions/:hash/execute":         services.ScopeTxSend,
+
+	"POST /token/transfer":              services.ScopeTokensTransfer,
+	"POST /token/transfer-from":         services.ScopeTokensTransfer,
+	"POST /token/authorizations":        services.ScopeTokensTransfer,
+	"POST /token/authorizations/submit": services.ScopeTokensTransfer,
+
+	// Admin reads, on top of every unlisted write. Approving a held send
+	// also needs admin:config, being more than the right to send.
+	"GET /access":                  services.ScopeAdminConfig,
+	"GET /bans":                    services.ScopeAdminConfig,
+	"GET /policy":                  services.ScopeAdminConfig,
+	"GET /audit":                   services.ScopeAdminConfig,
+	"GET /audit/export":            services.ScopeAdminConfig,
+	"GET /retention":               services.ScopeAdminConfig,
+	"GET /config/reload":           services.ScopeAdminConfig,
+	"GET /webhooks":                services.ScopeAdminConfig,
+	"GET /webhooks/:id":            services.ScopeAdminConfig,
+	"GET /webhooks/:id/deliveries": services.ScopeAdminConfig,
+	"GET /breakglass":              services.ScopeAdminConfig,
+	"GET /ceremonies":              services.ScopeAdminConfig,
+	"GET /ceremonies/:id/report":   services.ScopeAdminConfig,
+	"GET /maintenance/held":        services.ScopeAdminConfig,
+	"GET /maintenance/held/:id":    services.ScopeAdminConfig,
+	"GET /apikeys":                 services.ScopeAdminConfig,
+	"GET /apikeys/:id/usage":       services.ScopeAdminConfig,
+}
+
+// Authenticate resolves the caller from an Authorization bearer token, an
+// X-API-Key header or the session cookie, and checks that they hold the
+// route's scope. It does nothing unless services.AuthRequired.
+func Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		if c.FullPath() == "" || publicRoutes[route] || !services.AuthRequired() {
+			c.Next()
+			return
+		}
+
+		// A request held for maintenance is carried out as the caller who
+		// made it, as long as they would still be let in.
+		var principal *services.Principal
+		var err error
+		if held, replayed := heldRequest(c); replayed && held.Principal != nil {
+			principal, err = held.Principal, services.RecheckPrincipal(held.Principal)
+		} else {
+			principal, err = services.Authenticate(requestCredential(c))
+			if errors.Is(err, services.ErrInvalidToken) {
+				services.RecordAuthFailure(c.GetString(clientKey))
+			}
+		}
+		if err != nil {
+			status := http.StatusUnauthorized
+			if !errors.Is(err, services.ErrUnauthenticated) && !errors.Is(err, services.ErrInvalidToken) {
+				status = http.StatusInternalServerError
+			}
+			respondAuthError(c, status, err)
+			c.Abort()
+			return
+		}
+
+		if !principal.HasScope(requiredScope(c.Request.Method, c.FullPath())) {
+			respondError(c, http.StatusForbidden, "Insufficient scope")
+			c.Abort()
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+func requiredScope(method, path string) string {
+	if scope, ok := routeScopes[method+" "+path]; ok {
+		return scope
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return services.ScopeAccountsRead
+	}
+	return services.ScopeAdminConfig
+}
+
+func requestCredential(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return token
+		}
+	}
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if cookie, err := c.Cookie(sessionCookie); err == nil {
+		return cookie
+	}
+
+	return ""
+}
+
+// respondAuthError tells the browser UI where to sign in when OIDC login is
+// available.
+func respondAuthError(c *gin.Context, status int, err error) {
+	message := "Authentication required"
+	if errors.Is(err, services.ErrInvalidToken) {
+		message = "Invalid or expired credentials"
+	} else if status == http.StatusInternalServerError {
+		message = err.Error()
+	}
+
+	body := gin.H{"error": i18n.T(language(c), message)}
+	if services.OIDCEnabled() {
+		body["login_url"] = "/auth/login"
+	}
+	c.JSON(status, body)
+}
+
+// OIDCLogin sends the browser to the identity provider.
+func OIDCLogin(c *gin.Context) {
+	loginURL, err := services.OIDCLoginURL()
+	if err != nil {
+		respondOIDCError(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, loginURL)
+}
+
+// OIDCCallback completes a browser login, sets the session cookie and returns
+// to the UI.
+func OIDCCallback(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		respondError(c, http.StatusUnauthorized, "Sign-in was cancelled or refused")
+		return
+	}
+
+	token, err := services.CompleteOIDCLogin(c.Query("state"), c.Query("code"))
+	if err != nil {
+		respondOIDCError(c, err)
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token.Token,
+		Path:     "/",
+		MaxAge:   int(token.ExpiresIn),
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+	c.Redirect(http.StatusFound, "/")
+}
+
+// ExchangeIDToken issues an access token for an ID token from the identity
+// provider, for API clients that sign in without a browser.
+func ExchangeIDToken(c *gin.Context) {
+	var request struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := c.BindJSON(&request); err != nil || request.IDToken == "" {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	token, err := services.ExchangeIDToken(request.IDToken)
+	if err != nil {
+		respondOIDCError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+func GetSession(c *gin.Context) {
+	principal, ok := c.Get(principalKey)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"authenticated": false, "auth_required": services.AuthRequired()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authenticated": true, "auth_required": true, "principal": principal})
+}
+
+// Logout clears the session cookie and revokes the access token the
+// request carries, so a copy of it cannot be used either.
+func Logout(c *gin.Context) {
+	if token := requestCredential(c); token != "" {
+		services.RevokeAccessToken(token)
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	c.JSON(http.StatusOK, gin.H{"logged_out": true})
+}
+
+// IssueAccessToken issues the caller a bearer token, narrowed to some of
+// their scopes and for a shorter time if asked.
+func IssueAccessToken(c *gin.Context) {
+	var request struct {
+		Scopes     []string `json:"scopes"`
+		TTLSeconds int64    `json:"ttl_seconds"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	principal, ok := c.Get(principalKey)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Authentication is not enabled")
+		return
+	}
+
+	token, err := services.IssueAccessToken(principal.(*services.Principal), request.Scopes, time.Duration(request.TTLSeconds)*time.Second)
+	if err != nil {
+		respondError(c, tokenErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// RevokeAccessToken revokes the access token in the body. Holding a token
+// is enough to revoke it.
+func RevokeAccessToken(c *gin.Context) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := c.BindJSON(&request); err != nil || request.Token == "" {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	principal, err := services.RevokeAccessToken(request.Token)
+	if err != nil {
+		respondError(c, tokenErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": true, "token_id": principal.TokenID})
+}
+
+func tokenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidTokenRequest), errors.Is(err, services.ErrInvalidScope):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidToken):
+		return http.StatusUnauthorized
+	}
+
+	return http.StatusInternalServerError
+}
+
+func respondOIDCError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOIDCDisabled):
+		respondError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrOIDCLogin):
+		respondError(c, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, services.ErrNoRoleForGroups):
+		respondError(c, http.StatusForbidden, err.Error())
+	default:
+		respondError(c, http.StatusBadGateway, err.Error())
+	}
+}
+
+func CreateAPIKey(c *gin.Context) {
+	var request struct {
+		Name   string                `json:"name"`
+		Role   string                `json:"role"`
+		Scopes []string              `json:"scopes"`
+		Quota  *services.APIKeyQuota `json:"quota"`
+	}
+	if err := c.BindJSON(&request); err != nil || request.Name == "" {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	key, token, err := services.CreateAPIKey(request.Name, request.Role, request.Scopes, request.Quota)
+	if err != nil {
+		respondError(c, apiKeyErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_key": key, "key": token})
+}
+
+func ListAPIKeys(c *gin.Context) {
+	keys, err := services.ListAPIKeys()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if keys == nil {
+		keys = []*services.APIKey{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	if err := services.RevokeAPIKey(c.Param("id")); err != nil {
+		respondError(c, apiKeyErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": true})
+}
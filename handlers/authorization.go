@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// SignTransferAuthorization signs an EIP-3009 authorization that a relayer
+// can submit on the selected account's behalf.
+func SignTransferAuthorization(c *gin.Context) {
+	var request struct {
+		Kind        string        `json:"kind"`
+		Token       string        `json:"token"`
+		To          string        `json:"to"`
+		Amount      string        `json:"amount"`
+		ValidAfter  time.Time     `json:"valid_after"`
+		ValidBefore time.Time     `json:"valid_before"`
+		Version     string        `json:"version"`
+		ChainID     chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	amount, ok := parseAmount(request.Amount)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	if !chainAddresses(c, chain, &request.Token, &request.To) {
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	auth, err := services.SignTransferAuthorization(chain, services.AuthorizationRequest{
+		Kind:        request.Kind,
+		Token:       request.Token,
+		To:          request.To,
+		Value:       amount,
+		ValidAfter:  request.ValidAfter,
+		ValidBefore: request.ValidBefore,
+		Version:     request.Version,
+	})
+	if err != nil {
+		refund()
+		respondError(c, errorStatus(err, http.StatusBadRequest), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, auth)
+}
+
+// SubmitTransferAuthorization relays a signed authorization, paying the gas
+// from the selected account. The chain defaults to the authorization's own.
+func SubmitTransferAuthorization(c *gin.Context) {
+	var auth services.TransferAuthorization
+
+	if err := c.BindJSON(&auth); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	var selector chainSelector
+	if auth.ChainID != 0 {
+		selector = chainSelector(fmt.Sprint(auth.ChainID))
+	}
+	chain, ok := requestChain(c, selector)
+	if !ok {
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(nil))
+	if !ok {
+		return
+	}
+
+	txHash, err := services.SubmitTransferAuthorization(chain, auth)
+	if err != nil {
+		refund()
+		switch {
+		case errors.Is(err, services.ErrAuthorizationUsed):
+			respondError(c, http.StatusConflict, err.Error())
+		case errors.Is(err, services.ErrAuthorizationExpired), errors.Is(err, services.ErrAuthorizationNotYetValid):
+			respondError(c, http.StatusUnprocessableEntity, err.Error())
+		case errors.Is(err, services.ErrAuthorizationSignature):
+			respondError(c, http.StatusBadRequest, err.Error())
+		default:
+			respondSendError(c, errorStatus(err, http.StatusBadRequest), err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transaction_hash": txHash})
+}
+
+func GetAuthorizationState(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	used, err := services.AuthorizationState(chain, c.Query("token"), c.Query("authorizer"), c.Query("nonce"))
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusBadRequest), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": c.Query("token"), "authorizer": c.Query("authorizer"), "nonce": c.Query("nonce"), "used": used})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func CreateBreakGlassEntry(c *gin.Context) {
+	var request struct {
+		Label      string        `json:"label"`
+		ToAddress  string        `json:"to_address"`
+		Value      int64         `json:"value"`
+		Nonce      *uint64       `json:"nonce"`
+		GasPrice   string        `json:"gas_price"`
+		RawTx      string        `json:"raw_tx"`
+		Passphrase string        `json:"passphrase"`
+		ChainID    chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	var gasPrice *big.Int
+	if request.GasPrice != "" {
+		var ok bool
+		if gasPrice, ok = new(big.Int).SetString(request.GasPrice, 10); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid request")
+			return
+		}
+	}
+
+	// A raw transaction was signed elsewhere, so only one signed here is
+	// charged.
+	var charge services.QuotaCharge
+	if request.RawTx == "" {
+		charge = sendCharge(big.NewInt(request.Value))
+	}
+	refund, ok := chargeQuota(c, charge)
+	if !ok {
+		return
+	}
+
+	entry, err := services.CreateBreakGlassEntry(services.BreakGlassRequest{
+		Chain:      chain,
+		Label:      request.Label,
+		ToAddress:  request.ToAddress,
+		Value:      request.Value,
+		Nonce:      request.Nonce,
+		GasPrice:   gasPrice,
+		RawTx:      request.RawTx,
+		Passphrase: request.Passphrase,
+	})
+	if err != nil {
+		refund()
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+func ListBreakGlassEntries(c *gin.Context) {
+	entries, err := services.ListBreakGlassEntries()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	if entries == nil {
+		entries = []*services.BreakGlassEntry{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+func BroadcastBreakGlassEntry(c *gin.Context) {
+	var request struct {
+		Passphrase string `json:"passphrase"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	txHash, err := services.BroadcastBreakGlassEntry(c.Param("id"), request.Passphrase)
+	if err != nil {
+		status := errorStatus(err, http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, services.ErrBreakGlassNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrBreakGlassPassphrase):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrBreakGlassBroadcast):
+			status = http.StatusConflict
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transaction_hash": txHash})
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func CreateKeyCeremony(c *gin.Context) {
+	var request struct {
+		Label             string   `json:"label"`
+		RequiredApprovals int      `json:"required_approvals"`
+		Operators         []string `json:"operators"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	ceremony, err := services.CreateKeyCeremony(request.Label, request.RequiredApprovals, request.Operators)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, ceremony)
+}
+
+func ListKeyCeremonies(c *gin.Context) {
+	ceremonies, err := services.ListKeyCeremonies()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	if ceremonies == nil {
+		ceremonies = []*services.KeyCeremony{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ceremonies": ceremonies})
+}
+
+func ApproveKeyCeremony(c *gin.Context) {
+	var request struct {
+		Operator  string `json:"operator"`
+		Statement string `json:"statement"`
+		Entropy   string `json:"entropy"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	entropy, ok := parseHexData(request.Entropy)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid entropy")
+		return
+	}
+
+	ceremony, err := services.ApproveKeyCeremony(c.Param("id"), request.Operator, request.Statement, entropy)
+	if err != nil {
+		respondCeremonyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ceremony)
+}
+
+func CompleteKeyCeremony(c *gin.Context) {
+	var request struct {
+		Password string `json:"password"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	ceremony, err := services.CompleteKeyCeremony(c.Param("id"), request.Password)
+	if err != nil {
+		respondCeremonyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ceremony)
+}
+
+func GetKeyCeremonyReport(c *gin.Context) {
+	report, err := services.KeyCeremonyReport(c.Param("id"))
+	if err != nil {
+		respondCeremonyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func respondCeremonyError(c *gin.Context, err error) {
+	status := errorStatus(err, http.StatusInternalServerError)
+	switch {
+	case errors.Is(err, services.ErrCeremonyNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrOperatorNotListed):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrCeremonyCompleted), errors.Is(err, services.ErrCeremonyNotApproved), errors.Is(err, services.ErrOperatorApproved):
+		status = http.StatusConflict
+	}
+
+	respondError(c, status, err.Error())
+}
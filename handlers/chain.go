@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// chainSelector is the optional chain_id of a request body: a chain ID or the
+// name of a configured chain, as a JSON number or string.
+type chainSelector string
+
+func (s *chainSelector) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*s = chainSelector(name)
+		return nil
+	}
+
+	var id json.Number
+	if err := json.Unmarshal(data, &id); err != nil {
+		return errors.New("chain_id must be a chain ID or name")
+	}
+
+	*s = chainSelector(id.String())
+	return nil
+}
+
+// requestChain resolves the chain a request targets, or responds with an
+// error and returns false. An empty selector is the default chain.
+func requestChain(c *gin.Context, selector chainSelector) (*services.Chain, bool) {
+	chain, err := services.ResolveChain(string(selector))
+	if err != nil {
+		status := errorStatus(err, http.StatusBadGateway)
+		if errors.Is(err, services.ErrUnknownChain) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return nil, false
+	}
+
+	return chain, true
+}
+
+// resolvedNamesKey holds the ENS names chainAddresses resolved for a
+// request.
+const resolvedNamesKey = "resolved_names"
+
+// chainAddresses strips the EIP-3770 prefixes from a request's addresses in
+// place, and resolves those that are ENS names to the address for the
+// request's chain. If one is prefixed for another chain than the request's,
+// or a name does not resolve, it responds with an error and returns false.
+func chainAddresses(c *gin.Context, chain *services.Chain, addresses ...*string) bool {
+	if !stripChainPrefixes(c, chain, addresses...) {
+		return false
+	}
+
+	for _, address := range addresses {
+		if !services.IsENSName(*address) {
+			continue
+		}
+		resolution, err := services.ResolveRecipient(chain, *address)
+		if err != nil {
+			respondError(c, ensErrorStatus(err), err.Error())
+			return false
+		}
+		*address = resolution.Address
+		c.Set(resolvedNamesKey, append(resolvedNames(c), resolution))
+	}
+
+	return true
+}
+
+// stripChainPrefixes is chainAddresses without resolving names, for
+// handlers that resolve them themselves.
+func stripChainPrefixes(c *gin.Context, chain *services.Chain, addresses ...*string) bool {
+	for _, address := range addresses {
+		plain, err := services.ParseChainAddress(chain, *address)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return false
+		}
+		*address = plain
+	}
+
+	return true
+}
+
+// resolvedNames are the ENS names resolved for the request so far, for the
+// response to show where its addresses came from.
+func resolvedNames(c *gin.Context) []*services.NameResolution {
+	names, _ := c.Value(resolvedNamesKey).([]*services.NameResolution)
+	return names
+}
+
+func ListChains(c *gin.Context) {
+	chains, err := services.ListChains()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusBadGateway), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"chains": chains})
+}
+
+func ListNetworks(c *gin.Context) {
+	networks, err := services.ListNetworks()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusBadGateway), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"networks": networks})
+}
+
+// SelectNetwork sets the network requests without a chain_id go to.
+func SelectNetwork(c *gin.Context) {
+	var request struct {
+		Network chainSelector `json:"network"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, err := services.SelectNetwork(string(request.Network))
+	if err != nil {
+		status := errorStatus(err, http.StatusBadGateway)
+		if errors.Is(err, services.ErrUnknownChain) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"selected": chain})
+}
+
+// GetAddressProfile reports whether an address is a contract on each
+// configured chain.
+func GetAddressProfile(c *gin.Context) {
+	observations, err := services.ProfileAddress(c.Param("address"))
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusBadRequest), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"address": c.Param("address"), "chains": observations})
+}
+
+// GetBalance reports an account's balance with an ETag, answering 304 Not
+// Modified if it is unchanged from the one If-None-Match names.
+func GetBalance(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	address := c.Query("address")
+	if !chainAddresses(c, chain, &address) {
+		return
+	}
+	if address == "" {
+		var err error
+		if address, err = services.SelectedAddress(); err != nil {
+			respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+			return
+		}
+	}
+
+	balance, err := services.GetBalance(chain, address)
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusBadRequest), err.Error())
+		return
+	}
+
+	respondWithETag(c, gin.H{
+		"address":       balance.Address,
+		"chain_address": services.FormatChainAddress(chain, balance.Address),
+		"chain_id":      balance.ChainID,
+		"balance":       balance.Confirmed.Wei,
+		"confirmed":     balance.Confirmed,
+		"pending":       balance.Pending,
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// IssueChallenge issues a message for someone to sign and hand back to
+// /verify/consume, for logins and other one-time proofs of an address.
+func IssueChallenge(c *gin.Context) {
+	var request struct {
+		Address    string `json:"address"`
+		Statement  string `json:"statement"`
+		TTLSeconds int    `json:"ttl_seconds"`
+		Container  bool   `json:"container"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	challenge, err := services.IssueChallenge(request.Address, request.Statement, time.Duration(request.TTLSeconds)*time.Second, request.Container)
+	if err != nil {
+		respondError(c, challengeErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, challenge)
+}
+
+// ConsumeChallenge verifies a signature over an issued challenge once.
+func ConsumeChallenge(c *gin.Context) {
+	var request struct {
+		Nonce     string `json:"nonce"`
+		Signature string `json:"signature"`
+		Scheme    string `json:"scheme"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	valid, challenge, err := services.ConsumeChallenge(request.Nonce, request.Signature, request.Scheme)
+	if err != nil {
+		respondError(c, challengeErrorStatus(err), err.Error())
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusOK, gin.H{"valid": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": true, "signer": challenge.Signer, "nonce": challenge.Nonce})
+}
+
+func challengeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrChallengeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrChallengeConsumed):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrChallengeExpired):
+		return http.StatusGone
+	case errors.Is(err, services.ErrInvalidChallenge):
+		return http.StatusBadRequest
+	}
+
+	return signErrorStatus(err)
+}
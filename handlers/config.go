@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// ReloadConfig applies changes to the reloadable settings without a restart.
+// If any of them is invalid, none is applied.
+func ReloadConfig(c *gin.Context) {
+	report, err := services.ReloadConfig("api")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidConfig) {
+			status = http.StatusUnprocessableEntity
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func GetConfigReload(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"last_reload": services.LastConfigReload()})
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// DeployContract deploys bytecode, with constructor arguments encoded
+// against the ABI given alongside it.
+func DeployContract(c *gin.Context) {
+	var request struct {
+		Account  string            `json:"account"`
+		Bytecode string            `json:"bytecode"`
+		ABI      json.RawMessage   `json:"abi"`
+		Args     []json.RawMessage `json:"args"`
+		Value    string            `json:"value"`
+		ChainID  chainSelector     `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	bytecode, ok := parseHexData(request.Bytecode)
+	if !ok || len(bytecode) == 0 {
+		respondError(c, http.StatusBadRequest, "Invalid bytecode")
+		return
+	}
+	value := new(big.Int)
+	if request.Value != "" {
+		if value, ok = parseAmount(request.Value); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(value))
+	if !ok {
+		return
+	}
+
+	deployment, err := services.DeployContract(chain, request.Account, bytecode, request.ABI, request.Args, value)
+	if err != nil {
+		refund()
+		status := transactionErrorStatus(err)
+		if errors.Is(err, services.ErrInvalidDeployment) {
+			status = http.StatusBadRequest
+		}
+		respondSendError(c, status, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deployment)
+}
+
+// RegisterContract registers a contract's ABI by name for /contract/:name
+// calls.
+func RegisterContract(c *gin.Context) {
+	// ChainID shadows the contract's own field so a chain name is accepted.
+	var request struct {
+		services.Contract
+		ChainID chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+	request.Contract.ChainID = chain.ID.Uint64()
+
+	contract, err := services.RegisterContract(request.Contract)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidContract) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, contract)
+}
+
+func ListContracts(c *gin.Context) {
+	contracts, err := services.ListContracts()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"contracts": contracts})
+}
+
+func DeleteContract(c *gin.Context) {
+	if err := services.DeleteContract(c.Param("name")); err != nil {
+		respondError(c, contractErrorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": c.Param("name")})
+}
+
+// CallContract reads a method of a registered contract without sending
+// anything.
+func CallContract(c *gin.Context) {
+	var request struct {
+		Method string            `json:"method"`
+		Args   []json.RawMessage `json:"args"`
+		From   string            `json:"from"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	result, err := services.CallContractMethod(c.Param("name"), request.Method, request.Args, request.From)
+	if err != nil {
+		respondError(c, contractErrorStatus(err, errorStatus(err, http.StatusBadGateway)), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// SendContract sends a transaction calling a method of a registered
+// contract.
+func SendContract(c *gin.Context) {
+	var request struct {
+		Account string            `json:"account"`
+		Method  string            `json:"method"`
+		Args    []json.RawMessage `json:"args"`
+		Value   string            `json:"value"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	value := new(big.Int)
+	if request.Value != "" {
+		var ok bool
+		if value, ok = parseAmount(request.Value); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(value))
+	if !ok {
+		return
+	}
+
+	result, err := services.SendContractMethod(c.Param("name"), request.Method, request.Args, request.Account, value)
+	if err != nil {
+		refund()
+		respondSendError(c, contractErrorStatus(err, transactionErrorStatus(err)), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func contractErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, services.ErrContractNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidContractCall):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrContractReverted):
+		return http.StatusUnprocessableEntity
+	}
+
+	return fallback
+}
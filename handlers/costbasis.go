@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// ListFiatPrices lists the recorded prices, only ?chain_id='s if given.
+func ListFiatPrices(c *gin.Context) {
+	chainID, ok := ledgerChainID(c)
+	if !ok {
+		return
+	}
+
+	prices, err := services.ListFiatPrices(chainID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"prices": prices, "currency": services.FiatCurrency()})
+}
+
+// SaveFiatPrices records a list of prices, such as a day-by-day history
+// exported from a price source.
+func SaveFiatPrices(c *gin.Context) {
+	var req struct {
+		Prices []services.FiatPrice `json:"prices"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	saved, err := services.SaveFiatPrices(req.Prices)
+	if err != nil {
+		respondError(c, costBasisErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"prices": saved})
+}
+
+// DeleteFiatPrice removes the price for ?chain_id= at ?at=.
+func DeleteFiatPrice(c *gin.Context) {
+	chainID, err := strconv.ParseUint(c.Query("chain_id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid chain ID")
+		return
+	}
+	at, err := time.Parse(time.RFC3339, c.Query("at"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid at timestamp")
+		return
+	}
+
+	if err := services.DeleteFiatPrice(chainID, at); err != nil {
+		respondError(c, costBasisErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": gin.H{"chain_id": chainID, "at": at}})
+}
+
+func ListCostLots(c *gin.Context) {
+	chainID, ok := ledgerChainID(c)
+	if !ok {
+		return
+	}
+
+	lots, err := services.ListCostLots(chainID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lots": lots})
+}
+
+// AddCostLot records an acquisition the ledger has no transaction for.
+func AddCostLot(c *gin.Context) {
+	var lot services.CostLot
+	if err := c.BindJSON(&lot); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	saved, err := services.AddCostLot(lot)
+	if err != nil {
+		respondError(c, costBasisErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+func DeleteCostLot(c *gin.Context) {
+	if err := services.DeleteCostLot(c.Param("id")); err != nil {
+		respondError(c, costBasisErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": c.Param("id")})
+}
+
+// GetGainsReport reports the realized gains on ?chain_id= between ?since=
+// and ?until=, matching lots by ?method= (fifo or lifo). With ?format=csv
+// it is a CSV file of one row per lot a disposal used up, for tax
+// preparation.
+func GetGainsReport(c *gin.Context) {
+	chainID, ok := ledgerChainID(c)
+	if !ok {
+		return
+	}
+	if chainID == 0 {
+		respondError(c, http.StatusBadRequest, "Invalid chain ID")
+		return
+	}
+
+	var since, until time.Time
+	if raw := c.Query("since"); raw != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, raw); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid since timestamp")
+			return
+		}
+	}
+	if raw := c.Query("until"); raw != "" {
+		var err error
+		if until, err = time.Parse(time.RFC3339, raw); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid until timestamp")
+			return
+		}
+	}
+
+	report, err := services.GainsReportFor(chainID, c.Query("method"), since, until)
+	if err != nil {
+		respondError(c, costBasisErrorStatus(err), err.Error())
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	data, err := gainsCSV(report)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="gains-%d-%s.csv"`, report.ChainID, report.Until.Format("2006-01-02")))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
+
+// gainsCSV writes a row for each lot a disposal used up, and one for the
+// part of a disposal no lot covered, with amounts in whole coins.
+func gainsCSV(report *services.GainsReport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	currency := report.Currency
+	rows := [][]string{{"transaction", "kind", "amount", "acquired", "disposed", "term",
+		"proceeds_" + currency, "cost_basis_" + currency, "gain_" + currency, "lot"}}
+	for _, disposal := range report.Disposals {
+		disposed := disposal.DisposedAt.Format(time.RFC3339)
+		for _, match := range disposal.Lots {
+			term := "short"
+			if match.LongTerm {
+				term = "long"
+			}
+			rows = append(rows, []string{disposal.EntryID, disposal.Kind, coins(match.Amount), match.AcquiredAt.Format(time.RFC3339),
+				disposed, term, match.Proceeds, match.CostBasis, match.Gain, match.LotID})
+		}
+		if disposal.Unmatched != "" {
+			// What is left of the proceeds once the lots' shares are taken
+			// out is the unmatched part's, and all of it is gain.
+			proceeds, _ := new(big.Rat).SetString(disposal.Proceeds)
+			for _, match := range disposal.Lots {
+				share, _ := new(big.Rat).SetString(match.Proceeds)
+				proceeds.Sub(proceeds, share)
+			}
+			rows = append(rows, []string{disposal.EntryID, disposal.Kind, coins(disposal.Unmatched), "",
+				disposed, "short", proceeds.FloatString(2), "0.00", proceeds.FloatString(2), ""})
+		}
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func coins(wei string) string {
+	amount, ok := new(big.Int).SetString(wei, 10)
+	if !ok {
+		return wei
+	}
+
+	return services.FormatTokenAmount(amount, 18)
+}
+
+func costBasisErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidPrice), errors.Is(err, services.ErrInvalidLot),
+		errors.Is(err, services.ErrInvalidCostBasis):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrPriceNotFound), errors.Is(err, services.ErrLotNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNoFiatPrice):
+		return http.StatusUnprocessableEntity
+	}
+
+	return ledgerErrorStatus(err)
+}
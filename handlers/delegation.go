@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// GetDelegation reports the EIP-7702 delegation an account has on a chain.
+func GetDelegation(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	delegation, err := services.GetDelegation(chain, c.Param("address"))
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusBadRequest), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"delegation": delegation})
+}
+
+// SignDelegationAuthorization signs an EIP-7702 authorization for the
+// selected account, for another account to submit.
+func SignDelegationAuthorization(c *gin.Context) {
+	var request struct {
+		Delegate string        `json:"delegate"`
+		Nonce    *uint64       `json:"nonce"`
+		ChainID  chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	auth, err := services.SignDelegationAuthorization(chain, request.Delegate, request.Nonce)
+	if err != nil {
+		refund()
+		respondError(c, errorStatus(err, http.StatusBadRequest), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization": auth})
+}
+
+// SetDelegation sends a set-code transaction delegating the selected
+// account to a contract, or clearing its delegation.
+func SetDelegation(c *gin.Context) {
+	var request struct {
+		Delegate string        `json:"delegate"`
+		Value    string        `json:"value"`
+		Data     string        `json:"data"`
+		ChainID  chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	value := new(big.Int)
+	if request.Value != "" {
+		var ok bool
+		if value, ok = new(big.Int).SetString(request.Value, 10); !ok || value.Sign() < 0 {
+			respondError(c, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+	}
+	data, ok := parseHexData(request.Data)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid data")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(value))
+	if !ok {
+		return
+	}
+
+	txHash, err := services.SetDelegation(chain, services.DelegationRequest{
+		Delegate: request.Delegate,
+		Value:    value,
+		Data:     data,
+	})
+	if err != nil {
+		refund()
+		respondSendError(c, errorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transaction_hash": txHash})
+}
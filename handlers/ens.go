@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// GetENSProfile returns an address's primary ENS name and avatar, resolved
+// now rather than from the cache when refresh is true.
+func GetENSProfile(c *gin.Context) {
+	profile, err := services.ResolveENS(c.Param("address"), c.Query("refresh") == "true")
+	if err != nil {
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ens": profile})
+}
+
+func SetPrimaryENSName(c *gin.Context) {
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := c.BindJSON(&request); err != nil || request.Name == "" {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(nil))
+	if !ok {
+		return
+	}
+
+	txHash, err := services.SetPrimaryENSName(request.Name)
+	if err != nil {
+		refund()
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tx_hash": txHash})
+}
+
+// CheckENSName reports whether a .eth name is available and its price for
+// duration seconds, a year if not given.
+func CheckENSName(c *gin.Context) {
+	var duration uint64
+	if raw := c.Query("duration"); raw != "" {
+		var err error
+		if duration, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid duration")
+			return
+		}
+	}
+
+	availability, err := services.CheckENSAvailability(c.Param("name"), duration)
+	if err != nil {
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"availability": availability})
+}
+
+// CommitENSRegistration is the first step of registering a .eth name; the
+// second is CompleteENSRegistration, a minute or so later.
+func CommitENSRegistration(c *gin.Context) {
+	var request struct {
+		Name     string `json:"name"`
+		Duration uint64 `json:"duration"`
+		Primary  bool   `json:"primary"`
+	}
+	if err := c.BindJSON(&request); err != nil || request.Name == "" {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(nil))
+	if !ok {
+		return
+	}
+
+	registration, err := services.CommitENSRegistration(request.Name, request.Duration, request.Primary)
+	if err != nil {
+		refund()
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"registration": registration})
+}
+
+func CompleteENSRegistration(c *gin.Context) {
+	value, err := services.ENSRegistrationPrice(c.Param("id"))
+	if err != nil {
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(value))
+	if !ok {
+		return
+	}
+
+	registration, err := services.RegisterENSName(c.Param("id"))
+	if err != nil {
+		refund()
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"registration": registration})
+}
+
+func ListENSRegistrations(c *gin.Context) {
+	registrations, err := services.ListENSRegistrations()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if registrations == nil {
+		registrations = []services.ENSRegistration{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"registrations": registrations})
+}
+
+func RenewENSName(c *gin.Context) {
+	var request struct {
+		Name     string `json:"name"`
+		Duration uint64 `json:"duration"`
+	}
+	if err := c.BindJSON(&request); err != nil || request.Name == "" {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	value, err := services.ENSRenewalPrice(request.Name, request.Duration)
+	if err != nil {
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(value))
+	if !ok {
+		return
+	}
+
+	txHash, err := services.RenewENSName(request.Name, request.Duration)
+	if err != nil {
+		refund()
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tx_hash": txHash})
+}
+
+func SetENSRecords(c *gin.Context) {
+	var request services.ENSRecords
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(nil))
+	if !ok {
+		return
+	}
+
+	txHash, err := services.SetENSRecords(c.Param("name"), request)
+	if err != nil {
+		refund()
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tx_hash": txHash})
+}
+
+// ResolveENSName resolves a name to the address a payment to it on the
+// chain would go to.
+func ResolveENSName(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	resolution, err := services.ResolveRecipient(chain, c.Param("name"))
+	if err != nil {
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"resolution": resolution})
+}
+
+// ReverseENSName returns an address's primary name, only if the name
+// resolves back to the address, or 404 if it has none.
+func ReverseENSName(c *gin.Context) {
+	address := c.Param("address")
+	if !common.IsHexAddress(address) {
+		respondError(c, http.StatusBadRequest, "Invalid address")
+		return
+	}
+
+	profile, err := services.ResolveENS(address, c.Query("refresh") == "true")
+	if err != nil {
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+	if profile.Name == "" {
+		respondError(c, http.StatusNotFound, "The address has no primary ENS name")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"address": profile.Address, "name": profile.Name})
+}
+
+func ensErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidENSName), errors.Is(err, services.ErrENSNameMismatch), errors.Is(err, services.ErrNameNotResolved),
+		errors.Is(err, services.ErrInvalidENSDuration), errors.Is(err, services.ErrInvalidENSRecords),
+		errors.Is(err, services.ErrENSResolverNotSet):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrRegistrationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrENSNameUnavailable), errors.Is(err, services.ErrRegistrationNotReady),
+		errors.Is(err, services.ErrRegistrationExpired), errors.Is(err, services.ErrRegistrationComplete):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrENSUnavailable):
+		return http.StatusServiceUnavailable
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/i18n"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{"error": i18n.T(language(c), message)})
+}
+
+// respondSendError reports a failed send, including the shortfall when the
+// account cannot cover the value and fee, or the alert to approve when the
+// send was held as unusual.
+func respondSendError(c *gin.Context, status int, err error) {
+	var fundsErr *services.InsufficientFundsError
+	if errors.As(err, &fundsErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":     i18n.T(language(c), "insufficient funds for value and network fee"),
+			"balance":   fundsErr.Balance.String(),
+			"required":  fundsErr.Required.String(),
+			"shortfall": fundsErr.Shortfall().String(),
+		})
+		return
+	}
+
+	var anomalyErr *services.AnomalyError
+	if errors.As(err, &anomalyErr) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":    i18n.T(language(c), "unusual send held for approval"),
+			"alert_id": anomalyErr.AlertID,
+			"reasons":  anomalyErr.Reasons,
+		})
+		return
+	}
+
+	respondError(c, status, err.Error())
+}
+
+// errorStatus maps service errors that mean the same thing everywhere to a
+// status code, falling back to the handler's own choice.
+func errorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, services.ErrCircuitOpen), errors.Is(err, services.ErrRPCUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, services.ErrPolicyViolation):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrNoAccountSelected):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrPasswordRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrWrongPassword):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrAccountLocked), errors.Is(err, services.ErrHardwareNeedsUnlock):
+		return http.StatusLocked
+	case errors.Is(err, services.ErrHardwareAccount), errors.Is(err, services.ErrHardwareNotSupported),
+		errors.Is(err, services.ErrRemoteKey), errors.Is(err, services.ErrKeyNotExportable), errors.Is(err, services.ErrKeyNotImportable),
+		errors.Is(err, services.ErrWatchOnly):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrDeviceNotConnected), errors.Is(err, services.ErrKeyStoreUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, services.ErrHardwareUnsupported):
+		return http.StatusNotImplemented
+	}
+
+	return fallback
+}
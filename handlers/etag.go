@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondWithETag sends body as JSON with an ETag naming its content, or
+// 304 Not Modified and no body if If-None-Match already names it. The tag
+// is returned so that callers can remember it.
+func respondWithETag(c *gin.Context, body interface{}) string {
+	data, err := json.Marshal(body)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	// Clients may keep the response but must ask again before using it.
+	c.Header("Cache-Control", "no-cache")
+	c.Header("ETag", tag)
+
+	if etagMatches(c.GetHeader("If-None-Match"), tag) {
+		c.Status(http.StatusNotModified)
+		return tag
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+	return tag
+}
+
+// etagMatches reports whether an If-None-Match header names tag. Weak tags
+// match their strong form, as the comparison for GET is weak.
+func etagMatches(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// etagCacheTTL bounds how long an unchanged history answers a matching
+// If-None-Match without being read. It is short, as the ENS names in the
+// response can change while the history does not.
+const etagCacheTTL = time.Minute
+
+// historyTag is the tag last sent for a /transactions query, and the state
+// of the history it was made from.
+type historyTag struct {
+	tag     string
+	version uint64
+	pending bool
+	at      time.Time
+}
+
+var (
+	historyTagsMu sync.Mutex
+	historyTags   = map[string]historyTag{}
+)
+
+// notModifiedSince answers 304 if the client already holds the response to
+// this query and the history has not changed since it was made. Responses
+// with pending transactions are always made again, as reading them is what
+// moves them on once they are mined.
+func notModifiedSince(c *gin.Context, version uint64) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	historyTagsMu.Lock()
+	cached, ok := historyTags[c.Request.URL.RequestURI()]
+	historyTagsMu.Unlock()
+
+	if !ok || cached.pending || cached.version != version || time.Since(cached.at) > etagCacheTTL || !etagMatches(header, cached.tag) {
+		return false
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("ETag", cached.tag)
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+func rememberHistoryTag(c *gin.Context, tag string, version uint64, pending bool) {
+	historyTagsMu.Lock()
+	defer historyTagsMu.Unlock()
+
+	now := time.Now()
+	for uri, cached := range historyTags {
+		if now.Sub(cached.at) > etagCacheTTL {
+			delete(historyTags, uri)
+		}
+	}
+	historyTags[c.Request.URL.RequestURI()] = historyTag{tag: tag, version: version, pending: pending, at: now}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func ListExchangeAddresses(c *gin.Context) {
+	exchanges, err := services.ListExchangeAddresses()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exchanges": exchanges})
+}
+
+// SaveExchangeAddress records a deposit address an exchange credits by
+// memo or destination tag, replacing any entry for it on the same chain.
+func SaveExchangeAddress(c *gin.Context) {
+	var exchange services.ExchangeAddress
+	if err := c.BindJSON(&exchange); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	saved, err := services.SaveExchangeAddress(exchange)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidExchange) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+func DeleteExchangeAddress(c *gin.Context) {
+	if err := services.DeleteExchangeAddress(c.Param("address")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrExchangeNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": c.Param("address")})
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxSelectedFields bounds how many fields one fields= parameter can name.
+const maxSelectedFields = 64
+
+// fieldSelection is a fields= parameter as a tree: each key is a JSON field
+// to keep, whole if its subtree is nil and otherwise only the fields the
+// subtree names, so fields=hash,usage.sends keeps hash and the sends
+// counter of usage.
+type fieldSelection map[string]fieldSelection
+
+func parseFieldSelection(raw string) (fieldSelection, error) {
+	paths := strings.Split(raw, ",")
+	if len(paths) > maxSelectedFields {
+		return nil, fmt.Errorf("%w: at most %d fields can be selected", errInvalidListQuery, maxSelectedFields)
+	}
+
+	selection := fieldSelection{}
+	for _, path := range paths {
+		names := strings.Split(strings.TrimSpace(path), ".")
+		node := selection
+		for i, name := range names {
+			if name == "" {
+				return nil, fmt.Errorf("%w: %q is not a field", errInvalidListQuery, path)
+			}
+			child, seen := node[name]
+			if seen && child == nil {
+				// Already kept whole.
+				break
+			}
+			if i == len(names)-1 {
+				node[name] = nil
+				break
+			}
+			if child == nil {
+				child = fieldSelection{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+
+	return selection, nil
+}
+
+// apply keeps the selected fields of each object in value, however deep in
+// arrays it is. Fields an object does not have are left out.
+func (s fieldSelection) apply(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		kept := make(map[string]interface{}, len(s))
+		for name, child := range s {
+			field, ok := value[name]
+			if !ok {
+				continue
+			}
+			if child != nil {
+				field = child.apply(field)
+			}
+			kept[name] = field
+		}
+		return kept
+	case []interface{}:
+		kept := make([]interface{}, len(value))
+		for i, element := range value {
+			kept[i] = s.apply(element)
+		}
+		return kept
+	}
+
+	return value
+}
+
+// selectFields narrows items to the fields the query selected, or returns
+// them as they are if it selected none. Numbers are kept as written.
+func (q *listQuery) selectFields(items interface{}) (interface{}, error) {
+	if q.fields == nil {
+		return items, nil
+	}
+
+	encoded, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	return q.fields.apply(decoded), nil
+}
@@ -1,26 +1,73 @@
 package handlers
 
 import (
+	"encoding/hex"
+	"errors"
+	"math/big"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/i18n"
+	"github.com/jabbala-dev/go-wallet/models"
 	"github.com/jabbala-dev/go-wallet/services"
 )
 
+// GenerateKeyPair creates an account; with mnemonic=12 or 24 (or true, for
+// 12) its key comes from a new mnemonic, returned with it.
 func GenerateKeyPair(c *gin.Context) {
-	privateKey, address, err := services.GenerateKeyPair()
+	words := 0
+	if raw := c.Query("mnemonic"); raw == "true" {
+		words = 12
+	} else if raw != "" {
+		var err error
+		if words, err = strconv.Atoi(raw); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid mnemonic length")
+			return
+		}
+	}
+
+	var request struct {
+		Password string `json:"password"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	privateKey, address, mnemonic, err := services.GenerateKeyPair(words, request.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, mnemonicErrorStatus(err), err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"private_key": privateKey, "address": address})
+	response := gin.H{"private_key": privateKey, "address": address}
+	if mnemonic != "" {
+		response["mnemonic"] = mnemonic
+	}
+	c.JSON(http.StatusOK, response)
 }
 
+// GetAddress returns the address of the account given by address or name
+// in the account query, the selected account's without one, and with
+// chain_id its EIP-3770 form for that chain too.
 func GetAddress(c *gin.Context) {
-	address, err := services.GetAddress()
+	address, err := services.GetAddress(c.Query("account"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, accountErrorStatus(err), err.Error())
+		return
+	}
+
+	if selector := c.Query("chain_id"); selector != "" {
+		chain, ok := requestChain(c, chainSelector(selector))
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"address": address, "chain_address": services.FormatChainAddress(chain, address)})
 		return
 	}
 
@@ -28,18 +75,36 @@ func GetAddress(c *gin.Context) {
 }
 
 func SignMessage(c *gin.Context) {
-	var request struct {
-		Message string `json:"message"`
+	var request models.SignatureRequest
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := request.Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	if err := c.BindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	if request.Container != nil {
+		signed, err := services.SignContainer(request.Account, *request.Container, request.Scheme)
+		if err != nil {
+			refund()
+			respondError(c, signErrorStatus(err), err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, signed)
 		return
 	}
 
-	signature, err := services.SignMessage(request.Message)
+	signature, err := services.SignMessage(request.Account, request.Message, request.Scheme)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		refund()
+		respondError(c, signErrorStatus(err), err.Error())
 		return
 	}
 
@@ -47,41 +112,414 @@ func SignMessage(c *gin.Context) {
 }
 
 func VerifyMessage(c *gin.Context) {
+	var request struct {
+		Account   string                   `json:"account"`
+		Message   string                   `json:"message"`
+		Container *models.SigningContainer `json:"container"`
+		Signature string                   `json:"signature"`
+		Scheme    string                   `json:"scheme"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if request.Container != nil {
+		if err := request.Container.Validate(); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		isValid, err := services.VerifyContainer(request.Account, *request.Container, request.Signature, request.Scheme)
+		if err != nil {
+			respondError(c, signErrorStatus(err), err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"valid": isValid, "expired": request.Container.Expired(time.Now())})
+		return
+	}
+
+	isValid, err := services.VerifyMessage(request.Account, request.Message, request.Signature, request.Scheme)
+	if err != nil {
+		respondError(c, signErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": isValid})
+}
+
+// RecoverSigner returns the address that signed a message, whoever signed
+// it, where /verify only checks against the wallet's own accounts.
+func RecoverSigner(c *gin.Context) {
 	var request struct {
 		Message   string `json:"message"`
 		Signature string `json:"signature"`
+		Scheme    string `json:"scheme"`
 	}
 
 	if err := c.BindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		respondError(c, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	isValid, err := services.VerifyMessage(request.Message, request.Signature)
+	signer, err := services.RecoverSigner(request.Message, request.Signature, request.Scheme)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, signErrorStatus(err), err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"valid": isValid})
+	c.JSON(http.StatusOK, gin.H{"address": signer})
+}
+
+// SignTypedData signs EIP-712 typed data, given as eth_signTypedData_v4
+// takes it: types, primaryType, domain and message.
+func SignTypedData(c *gin.Context) {
+	var request struct {
+		Account string `json:"account"`
+		apitypes.TypedData
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	signature, err := services.SignTypedData(request.Account, request.TypedData)
+	if err != nil {
+		refund()
+		respondError(c, signErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, signature)
+}
+
+func signErrorStatus(err error) int {
+	if errors.Is(err, services.ErrUnknownSignScheme) || errors.Is(err, services.ErrInvalidTypedData) ||
+		errors.Is(err, services.ErrInvalidSignature) || errors.Is(err, services.ErrContainerExpired) {
+		return http.StatusBadRequest
+	}
+
+	return accountErrorStatus(err)
 }
 
 func CreateAndSendTransaction(c *gin.Context) {
 	var request struct {
-		ToAddress string `json:"to_address"`
-		Value     int64  `json:"value"`
+		Account   string        `json:"account"`
+		ToAddress string        `json:"to_address"`
+		Value     int64         `json:"value"`
+		Data      string        `json:"data"`
+		Memo      string        `json:"memo"`
+		Tag       *uint32       `json:"destination_tag"`
+		ChainID   chainSelector `json:"chain_id"`
+		Nonce     *uint64       `json:"nonce"`
+
+		TxType               string `json:"tx_type"`
+		MaxFeePerGas         string `json:"max_fee_per_gas"`
+		MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	data, ok := parseHexData(request.Data)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid data")
+		return
+	}
+
+	fees := services.FeeOptions{Type: request.TxType, Nonce: request.Nonce}
+	if request.MaxFeePerGas != "" {
+		if fees.MaxFeePerGas, ok = parseAmount(request.MaxFeePerGas); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid fee")
+			return
+		}
+	}
+	if request.MaxPriorityFeePerGas != "" {
+		if fees.MaxPriorityFeePerGas, ok = parseAmount(request.MaxPriorityFeePerGas); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid fee")
+			return
+		}
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	if !chainAddresses(c, chain, &request.ToAddress) {
+		return
+	}
+	destination := models.Destination{Address: request.ToAddress, Memo: request.Memo, Tag: request.Tag}
+	data, warnings, ok := withDestination(c, chain, destination, data)
+	if !ok {
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(big.NewInt(request.Value)))
+	if !ok {
+		return
+	}
+
+	txHash, err := services.CreateAndSendTransaction(chain, request.Account, request.ToAddress, request.Value, data, fees)
+	if err != nil {
+		refund()
+		respondSendError(c, transactionErrorStatus(err), err)
+		return
+	}
+
+	response := gin.H{"transaction_hash": txHash}
+	if destination.Reference() != "" {
+		response["memo_gas"] = services.MemoGas(data)
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	if names := resolvedNames(c); len(names) > 0 {
+		response["resolved_names"] = names
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func transactionErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidFees) || errors.Is(err, services.ErrDynamicFeesUnsupported) ||
+		errors.Is(err, services.ErrInvalidUnsignedTx) || errors.Is(err, services.ErrInvalidRawTx) ||
+		errors.Is(err, services.ErrInvalidMemo) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, services.ErrGasEstimation) {
+		return http.StatusUnprocessableEntity
+	}
+	if errors.Is(err, services.ErrNonceTooLow) || errors.Is(err, services.ErrNonceInUse) {
+		return http.StatusConflict
+	}
+
+	return accountErrorStatus(err)
+}
+
+func PreviewTransaction(c *gin.Context) {
+	var request struct {
+		ToAddress string        `json:"to_address"`
+		Value     int64         `json:"value"`
+		Data      string        `json:"data"`
+		ChainID   chainSelector `json:"chain_id"`
 	}
 
 	if err := c.BindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	data, ok := parseHexData(request.Data)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid data")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
 		return
 	}
 
-	txHash, err := services.CreateAndSendTransaction(request.ToAddress, request.Value)
+	// The preview resolves names itself, to say where the address came from.
+	if !stripChainPrefixes(c, chain, &request.ToAddress) {
+		return
+	}
+
+	preview, err := services.PreviewTransaction(chain, request.ToAddress, request.Value, data)
+	if err != nil {
+		respondError(c, ensErrorStatus(err), err.Error())
+		return
+	}
+
+	preview.Summary = i18n.Sprintf(language(c), "Send %s wei from %s to %s with a network fee of up to %s wei (total %s wei)",
+		preview.Value, preview.From, preview.To, preview.Fee, preview.Total)
+	if recipient := preview.Recipient; recipient != nil {
+		preview.Provenance = i18n.Sprintf(language(c), "%s resolved to %s from its %s record", recipient.Name, recipient.Address, recipient.Source)
+		if recipient.Gateway != "" {
+			preview.Provenance += ", " + i18n.Sprintf(language(c), "served by the gateway %s and verified by the resolver", recipient.Gateway)
+		}
+		if recipient.DNS {
+			preview.Provenance += ". " + i18n.T(language(c), "It is a DNS name, in ENS by proof of its DNSSEC records")
+		}
+		preview.Summary += ". " + preview.Provenance
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+func ApproveTransaction(c *gin.Context) {
+	preview, err := services.GetPreview(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	value, _ := new(big.Int).SetString(preview.Value, 10)
+	refund, ok := chargeQuota(c, sendCharge(value))
+	if !ok {
+		return
+	}
+
+	txHash, err := services.ApproveTransaction(c.Param("id"))
+	if err != nil {
+		refund()
+		status := errorStatus(err, http.StatusInternalServerError)
+		if errors.Is(err, services.ErrPreviewNotFound) {
+			status = http.StatusNotFound
+		}
+		respondSendError(c, status, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"transaction_hash": txHash})
 }
+
+func RejectTransaction(c *gin.Context) {
+	if err := services.RejectTransaction(c.Param("id")); err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rejected": c.Param("id")})
+}
+
+// EstimateTransaction reports the gas limit a transaction would be sent
+// with and its fee at slow, standard and fast tiers, without sending it.
+func EstimateTransaction(c *gin.Context) {
+	var request struct {
+		Account   string        `json:"account"`
+		ToAddress string        `json:"to_address"`
+		Value     string        `json:"value"`
+		Data      string        `json:"data"`
+		Memo      string        `json:"memo"`
+		Tag       *uint32       `json:"destination_tag"`
+		ChainID   chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	value := new(big.Int)
+	if request.Value != "" {
+		var ok bool
+		if value, ok = parseAmount(request.Value); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+	}
+	data, ok := parseHexData(request.Data)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid data")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+	if !chainAddresses(c, chain, &request.ToAddress) {
+		return
+	}
+	destination := models.Destination{Address: request.ToAddress, Memo: request.Memo, Tag: request.Tag}
+	if data, _, ok = withDestination(c, chain, destination, data); !ok {
+		return
+	}
+
+	estimate, err := services.EstimateTransaction(chain, request.Account, request.ToAddress, value, data)
+	if err != nil {
+		respondError(c, transactionErrorStatus(err), err.Error())
+		return
+	}
+	if destination.Reference() != "" {
+		estimate.MemoGas = services.MemoGas(data)
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
+
+func EstimateCalldata(c *gin.Context) {
+	var request struct {
+		Data string `json:"data"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	data, ok := parseHexData(request.Data)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid data")
+		return
+	}
+
+	c.JSON(http.StatusOK, services.AnalyzeCalldata(data))
+}
+
+// withDestination turns a destination's memo or tag, if it has one, into
+// the data of a plain transfer, which cannot have data of its own, and
+// checks the destination against the known exchange addresses.
+func withDestination(c *gin.Context, chain *services.Chain, destination models.Destination, data []byte) ([]byte, []services.DestinationWarning, bool) {
+	if err := destination.Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	}
+
+	reference := destination.Reference()
+	if reference != "" {
+		if len(data) > 0 {
+			respondError(c, http.StatusBadRequest, "A memo cannot be sent with data")
+			return nil, nil, false
+		}
+
+		var err error
+		if data, err = services.MemoData(chain, destination.Address, reference); err != nil {
+			respondError(c, transactionErrorStatus(err), err.Error())
+			return nil, nil, false
+		}
+	}
+
+	warnings, err := services.CheckDestination(chain, destination.Address, reference)
+	if err != nil {
+		respondError(c, errorStatus(err, transactionErrorStatus(err)), err.Error())
+		return nil, nil, false
+	}
+
+	return data, warnings, true
+}
+
+func parseHexData(value string) ([]byte, bool) {
+	data, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+func GetRPCStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"endpoints": services.RPCStatus(), "health": services.RPCHealth()})
+}
+
+// GetReadiness reports 503 until local state has been reconciled against the
+// chain at startup. Discrepancies found along the way are listed either way.
+func GetReadiness(c *gin.Context) {
+	status := services.ReconciliationStatus()
+
+	code := http.StatusOK
+	if !status.Completed {
+		code = http.StatusServiceUnavailable
+	}
+
+	c.JSON(code, gin.H{"ready": status.Completed, "reconciliation": status})
+}
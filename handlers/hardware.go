@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// ListHardwareDevices lists the Ledger and Trezor devices plugged in.
+func ListHardwareDevices(c *gin.Context) {
+	devices, err := services.ListHardwareDevices()
+	if err != nil {
+		respondError(c, hardwareErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+// DeriveHardwareAddresses lists a device's addresses to choose one to add.
+// It is a POST so that a Trezor PIN stays out of the URL.
+func DeriveHardwareAddresses(c *gin.Context) {
+	var request struct {
+		Device string `json:"device"`
+		Path   string `json:"path"`
+		Count  int    `json:"count"`
+		PIN    string `json:"pin"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	addresses, err := services.DeriveHardwareAddresses(request.Device, request.Path, request.PIN, request.Count)
+	if err != nil {
+		respondError(c, hardwareErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"addresses": addresses})
+}
+
+func ListHardwareAccounts(c *gin.Context) {
+	accounts, err := services.ListHardwareAccounts()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+// AddHardwareAccount adds a device's address at a path as an account that
+// signs on the device.
+func AddHardwareAccount(c *gin.Context) {
+	var request struct {
+		Device string `json:"device"`
+		Path   string `json:"path"`
+		PIN    string `json:"pin"`
+		Name   string `json:"name"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	account, hardware, err := services.AddHardwareAccount(request.Device, request.Path, request.PIN, request.Name)
+	if err != nil {
+		respondError(c, hardwareErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"account": account, "hardware": hardware})
+}
+
+func hardwareErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidHardwareRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrAccountExists):
+		return http.StatusConflict
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
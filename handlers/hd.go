@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func CreateHDAccount(c *gin.Context) {
+	var request struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	account, err := services.CreateHDAccount(request.Name, request.Password)
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+func ImportXPub(c *gin.Context) {
+	var request struct {
+		Name string `json:"name"`
+		XPub string `json:"xpub"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	account, err := services.ImportXPub(request.Name, request.XPub)
+	if err != nil {
+		respondHDError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+func ListHDAccounts(c *gin.Context) {
+	accounts, err := services.ListHDAccounts()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	if accounts == nil {
+		accounts = []*services.HDAccount{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+func GetHDAccountXPub(c *gin.Context) {
+	account, err := services.GetHDAccount(c.Param("id"))
+	if err != nil {
+		respondHDError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"xpub": account.XPub, "path": account.Path, "watch_only": account.WatchOnly})
+}
+
+func DeriveHDAddress(c *gin.Context) {
+	address, err := services.DeriveHDAddress(c.Param("id"))
+	if err != nil {
+		respondHDError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, address)
+}
+
+// SignWithHDAddress signs with the HD account's address at a given index.
+func SignWithHDAddress(c *gin.Context) {
+	var request struct {
+		Index   uint32 `json:"index"`
+		Message string `json:"message"`
+		Scheme  string `json:"scheme"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	address, signature, err := services.SignWithHDAddress(c.Param("id"), request.Index, request.Message, request.Scheme)
+	if err != nil {
+		refund()
+		respondHDError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"address": address.Address, "index": address.Index, "signature": signature})
+}
+
+// RestoreHDAccount restores from a mnemonic (or watch-only from an xpub) and
+// scans for used addresses.
+func RestoreHDAccount(c *gin.Context) {
+	var request struct {
+		Name       string `json:"name"`
+		Mnemonic   string `json:"mnemonic"`
+		Passphrase string `json:"passphrase"`
+		XPub       string `json:"xpub"`
+		Password   string `json:"password"`
+		GapLimit   int    `json:"gap_limit"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if request.Mnemonic == "" && request.XPub == "" {
+		respondError(c, http.StatusBadRequest, "A mnemonic or an xpub is required")
+		return
+	}
+	if request.Mnemonic != "" && request.XPub != "" {
+		respondError(c, http.StatusBadRequest, "Provide either a mnemonic or an xpub, not both")
+		return
+	}
+
+	result, err := services.RestoreHDAccount(request.Name, request.Mnemonic, request.Passphrase, request.XPub, request.Password, request.GapLimit)
+	if err != nil {
+		respondHDError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func ScanHDAccount(c *gin.Context) {
+	limit := 0
+	if raw := c.Query("gap_limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			respondError(c, http.StatusBadRequest, "Invalid gap limit")
+			return
+		}
+	}
+
+	result, err := services.ScanHDAccount(c.Param("id"), limit)
+	if err != nil {
+		respondHDError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func respondHDError(c *gin.Context, err error) {
+	status := errorStatus(err, http.StatusInternalServerError)
+	switch {
+	case errors.Is(err, services.ErrHDAccountNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidXPub), errors.Is(err, services.ErrWatchOnly), errors.Is(err, services.ErrHDIndexNotDerived),
+		errors.Is(err, services.ErrUnknownSignScheme):
+		status = http.StatusBadRequest
+	}
+
+	respondError(c, status, err.Error())
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// transactionList filters on the record's fields; address (either side),
+// chain_id (by name too), since and until are as before.
+var transactionList = listSpec{
+	fields: map[string]int{
+		"hash": fieldText, "chain_id": fieldNumber, "from": fieldText, "to": fieldText,
+		"value": fieldNumber, "nonce": fieldNumber, "gas": fieldNumber, "gas_used": fieldNumber,
+		"block_number": fieldNumber, "status": fieldText, "created_at": fieldTime,
+		"updated_at": fieldTime, "mined_at": fieldTime,
+	},
+	key:    "hash",
+	sort:   "-created_at",
+	params: []string{"address", "chain_id", "since", "until"},
+}
+
+// ListTransactions lists the history with an ETag. A client sending it back
+// in If-None-Match gets 304 Not Modified, without the history being read if
+// it has not changed since.
+func ListTransactions(c *gin.Context) {
+	query, ok := listQueryFrom(c, transactionList)
+	if !ok {
+		return
+	}
+
+	// Read before the history, so that changes made while it is read are
+	// taken as made after it.
+	version := services.HistoryVersion()
+	if notModifiedSince(c, version) {
+		return
+	}
+
+	filter := services.TransactionFilter{Address: c.Query("address")}
+
+	// Without a chain_id, history across every chain is listed.
+	if selector := c.Query("chain_id"); selector != "" {
+		chain, ok := requestChain(c, chainSelector(selector))
+		if !ok {
+			return
+		}
+		filter.ChainID = chain.ID.Uint64()
+	}
+
+	var err error
+	if since := c.Query("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid since timestamp")
+			return
+		}
+	}
+	if until := c.Query("until"); until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid until timestamp")
+			return
+		}
+	}
+
+	records, err := services.ListTransactions(filter)
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	records, next, err := pageList(query, records)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Primary names of both sides, keyed by checksummed address.
+	var addresses []string
+	pending := false
+	for _, record := range records {
+		addresses = append(addresses, record.From, record.To)
+		pending = pending || record.Status == services.StatusPending
+	}
+
+	items, err := query.selectFields(records)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tag := respondWithETag(c, gin.H{"transactions": items, "names": services.ENSNames(addresses), "next_cursor": next})
+	if tag != "" {
+		rememberHistoryTag(c, tag, version, pending)
+	}
+}
+
+// maxStatusWait bounds the wait parameter of GetTransactionStatus.
+const maxStatusWait = time.Minute
+
+// GetTransactionStatus reports whether a transaction sent through the wallet
+// is pending, confirmed or failed, with its receipt once it is mined. With
+// wait (a duration, at most a minute) a transaction not yet confirmed or
+// failed is reported once it is, or when the wait runs out.
+func GetTransactionStatus(c *gin.Context) {
+	var wait time.Duration
+	if raw := c.Query("wait"); raw != "" {
+		var err error
+		if wait, err = time.ParseDuration(raw); err != nil || wait < 0 || wait > maxStatusWait {
+			respondError(c, http.StatusBadRequest, "Invalid wait")
+			return
+		}
+	}
+
+	status, err := services.WaitForTransactionStatus(c.Request.Context(), c.Param("hash"), wait)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, services.ErrTransactionNotFound) {
+			code = http.StatusNotFound
+		}
+		respondError(c, code, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// SpeedUpTransaction resends a pending transaction with the same nonce and
+// fees raised by FEE_BUMP_PERCENT.
+func SpeedUpTransaction(c *gin.Context) {
+	replaceTransaction(c, services.SpeedUpTransaction, false)
+}
+
+// CancelTransaction replaces a pending transaction with an empty transfer
+// to the sending account, with the same nonce and raised fees.
+func CancelTransaction(c *gin.Context) {
+	replaceTransaction(c, services.CancelTransaction, true)
+}
+
+func replaceTransaction(c *gin.Context, replace func(hash string) (string, error), cancel bool) {
+	hash := c.Param("hash")
+
+	value, err := services.ReplacementValue(hash, cancel)
+	if err != nil {
+		respondReplaceError(c, err)
+		return
+	}
+	refund, ok := chargeQuota(c, sendCharge(value))
+	if !ok {
+		return
+	}
+
+	txHash, err := replace(hash)
+	if err != nil {
+		refund()
+		respondReplaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transaction_hash": txHash, "replaces": hash})
+}
+
+func respondReplaceError(c *gin.Context, err error) {
+	code := transactionErrorStatus(err)
+	switch {
+	case errors.Is(err, services.ErrTransactionNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, services.ErrNotReplaceable):
+		code = http.StatusConflict
+	}
+	respondSendError(c, code, err)
+}
+
+// GetNonceStatus shows an account's nonces on a chain: the node's next one,
+// those in flight, and any gaps the next sends will fill.
+func GetNonceStatus(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	status, err := services.GetNonceStatus(chain, c.Query("account"))
+	if err != nil {
+		respondError(c, accountErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// ListSigningJournal shows sends whose outcome is not yet known, or every
+// journalled send with all=true.
+func ListSigningJournal(c *gin.Context) {
+	entries, err := services.ListSigningJournal(c.Query("all") == "true")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if entries == nil {
+		entries = []*services.SigningJournalEntry{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"journal": entries})
+}
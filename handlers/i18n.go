@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/i18n"
+)
+
+func language(c *gin.Context) string {
+	lang := i18n.Match(c.GetHeader("Accept-Language"))
+	c.Header("Content-Language", lang)
+	return lang
+}
+
+func GetMessages(c *gin.Context) {
+	lang := language(c)
+	c.JSON(http.StatusOK, gin.H{"language": lang, "languages": i18n.Languages(), "messages": i18n.Messages(lang)})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// RegisterHoneypots adds the decoy routes. They are public, so a caller
+// without credentials trips them too, and answer like an unknown route.
+func RegisterHoneypots(r *gin.Engine) {
+	for _, path := range services.HoneypotPaths() {
+		r.Any(path, Honeypot)
+		for _, method := range []string{
+			http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodHead,
+			http.MethodOptions, http.MethodDelete, http.MethodConnect, http.MethodTrace,
+		} {
+			publicRoutes[method+" "+path] = true
+		}
+	}
+}
+
+func Honeypot(c *gin.Context) {
+	services.TripHoneypot(c.GetString(clientKey), c.Request.Method, c.Request.URL.Path)
+	c.String(http.StatusNotFound, "404 page not found")
+}
+
+func ListBans(c *gin.Context) {
+	bans, err := services.ListBans()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if bans == nil {
+		bans = []*services.Ban{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bans": bans})
+}
+
+func LiftBan(c *gin.Context) {
+	if err := services.LiftBan(c.Param("client")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrBanNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lifted": true})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+const maxIPFSUpload = 32 << 20
+
+func UploadToIPFS(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxIPFSUpload+1))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if len(data) > maxIPFSUpload {
+		respondError(c, http.StatusRequestEntityTooLarge, "File too large")
+		return
+	}
+
+	pin, err := services.UploadToIPFS(header.Filename, data)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, pin)
+}
+
+func ListIPFSPins(c *gin.Context) {
+	pins, err := services.ListIPFSPins()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	if pins == nil {
+		pins = []*services.IPFSPin{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pins": pins})
+}
+
+func GetIPFSPin(c *gin.Context) {
+	pin, err := services.GetIPFSPin(c.Param("cid"))
+	if err != nil {
+		status := errorStatus(err, http.StatusInternalServerError)
+		if errors.Is(err, services.ErrPinNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, pin)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func CreateJob(c *gin.Context) {
+	var request struct {
+		Name     string        `json:"name"`
+		Kind     string        `json:"kind"`
+		Schedule string        `json:"schedule"`
+		Timezone string        `json:"timezone"`
+		Jitter   string        `json:"jitter"`
+		ChainID  chainSelector `json:"chain_id"`
+		Account  string        `json:"account"`
+		To       string        `json:"to"`
+		Value    string        `json:"value"`
+		Keep     string        `json:"keep"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	// Pruning is not on any chain, so it does not need one reachable.
+	var chain *services.Chain
+	if request.Kind != services.JobKindPrune {
+		var ok bool
+		if chain, ok = requestChain(c, request.ChainID); !ok {
+			return
+		}
+		if request.To != "" && !chainAddresses(c, chain, &request.To) {
+			return
+		}
+	}
+
+	job, err := services.CreateJob(chain, services.Job{
+		Name:     request.Name,
+		Kind:     request.Kind,
+		Schedule: request.Schedule,
+		Timezone: request.Timezone,
+		Jitter:   request.Jitter,
+		Account:  request.Account,
+		To:       request.To,
+		Value:    request.Value,
+		Keep:     request.Keep,
+	})
+	if err != nil {
+		respondError(c, jobErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func ListJobs(c *gin.Context) {
+	jobs, err := services.ListJobs()
+	if err != nil {
+		respondError(c, jobErrorStatus(err), err.Error())
+		return
+	}
+
+	if jobs == nil {
+		jobs = []*services.Job{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+func GetJob(c *gin.Context) {
+	job, err := services.GetJob(c.Param("id"))
+	if err != nil {
+		respondError(c, jobErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func DeleteJob(c *gin.Context) {
+	if err := services.DeleteJob(c.Param("id")); err != nil {
+		respondError(c, jobErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": c.Param("id")})
+}
+
+// RunJob runs a job as soon as a slot is free rather than at its next
+// scheduled time.
+func RunJob(c *gin.Context) {
+	respondJob(c, services.RunJob)
+}
+
+func PauseJob(c *gin.Context) {
+	respondJob(c, services.PauseJob)
+}
+
+func ResumeJob(c *gin.Context) {
+	respondJob(c, services.ResumeJob)
+}
+
+func respondJob(c *gin.Context, update func(string) (*services.Job, error)) {
+	job, err := update(c.Param("id"))
+	if err != nil {
+		respondError(c, jobErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func ListStatements(c *gin.Context) {
+	statements, err := services.ListStatements(c.Query("job_id"))
+	if err != nil {
+		respondError(c, jobErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"statements": statements})
+}
+
+func GetStatement(c *gin.Context) {
+	statement, err := services.GetStatement(c.Param("id"))
+	if err != nil {
+		respondError(c, jobErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, statement)
+}
+
+func jobErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidJob), errors.Is(err, services.ErrAccountNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrJobNotFound), errors.Is(err, services.ErrStatementNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrJobRunning), errors.Is(err, services.ErrJobPaused):
+		return http.StatusConflict
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
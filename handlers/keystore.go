@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// GetKeyStore reports the key store new keys go to and lists the keys kept
+// outside the file store.
+func GetKeyStore(c *gin.Context) {
+	store, err := services.ActiveKeyStore()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	keys, err := services.KeyStoreKeys()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"store": store.Name(), "keys": keys})
+}
+
+// AddKMSKey adds a key already created in the active KMS as an account.
+func AddKMSKey(c *gin.Context) {
+	var request struct {
+		KeyID string `json:"key_id"`
+		Name  string `json:"name"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	account, err := services.AddKMSKey(request.KeyID, request.Name)
+	if err != nil {
+		respondError(c, keyStoreErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+func keyStoreErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidKMSKey):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrAccountExists):
+		return http.StatusConflict
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// ledgerList filters on the entry's fields; account (a posting's account,
+// or a wallet address for its asset account) and chain_id (by name too)
+// are handled first.
+var ledgerList = listSpec{
+	fields: map[string]int{
+		"id": fieldText, "chain_id": fieldNumber, "direction": fieldText, "counterparty": fieldText,
+		"category": fieldText, "value": fieldNumber, "fee": fieldNumber, "status": fieldText,
+		"mined_at": fieldTime, "booked_at": fieldTime,
+	},
+	key:    "id",
+	sort:   "booked_at",
+	params: []string{"account", "chain_id"},
+}
+
+// ListLedgerEntries lists the journal entries booked from confirmed and
+// failed transactions.
+func ListLedgerEntries(c *gin.Context) {
+	query, ok := listQueryFrom(c, ledgerList)
+	if !ok {
+		return
+	}
+	chainID, ok := ledgerChainID(c)
+	if !ok {
+		return
+	}
+
+	account := c.Query("account")
+	if common.IsHexAddress(account) {
+		account = services.LedgerWalletAccount(account)
+	}
+
+	entries, err := services.ListLedgerEntries(chainID, account)
+	if err != nil {
+		respondError(c, ledgerErrorStatus(err), err.Error())
+		return
+	}
+
+	entries, next, err := pageList(query, entries)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	items, err := query.selectFields(entries)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": items, "next_cursor": next})
+}
+
+// GetLedgerBalances sums each ledger account, for the transactions mined
+// by ?until= if given.
+func GetLedgerBalances(c *gin.Context) {
+	chainID, ok := ledgerChainID(c)
+	if !ok {
+		return
+	}
+
+	var until time.Time
+	if raw := c.Query("until"); raw != "" {
+		var err error
+		if until, err = time.Parse(time.RFC3339, raw); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid until timestamp")
+			return
+		}
+	}
+
+	balances, err := services.LedgerBalances(chainID, until)
+	if err != nil {
+		respondError(c, ledgerErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"balances": balances})
+}
+
+// ledgerChainID is the chain of ?chain_id=, or zero for every chain.
+func ledgerChainID(c *gin.Context) (uint64, bool) {
+	selector := c.Query("chain_id")
+	if selector == "" {
+		return 0, true
+	}
+	chain, ok := requestChain(c, chainSelector(selector))
+	if !ok {
+		return 0, false
+	}
+
+	return chain.ID.Uint64(), true
+}
+
+func ledgerErrorStatus(err error) int {
+	if errors.Is(err, services.ErrLedgerDisabled) {
+		return http.StatusNotFound
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
@@ -0,0 +1,434 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List endpoints share one set of query parameters, parsed by listQueryFrom:
+//
+//	limit=100              page size, 1 to 500 (default 100)
+//	cursor=...             next_cursor from the previous page
+//	sort=-created_at,name  fields to sort on, descending with a leading -
+//	status=confirmed       a field equals a value
+//	value[gte]=1000        a field compared with ne, gt, gte, lt, lte, in
+//	                       (comma-separated values) or contains
+//	fields=hash,status     only these fields of each item, dotted for the
+//	                       fields of nested objects (usage.sends)
+//
+// Only the fields an endpoint names can be filtered and sorted on. Text is
+// compared without regard to case, so addresses match however they are
+// checksummed, and a list field (such as a webhook's events) equals a value
+// when it holds it. Pages follow on from the position of the last item
+// rather than an offset, so items added or removed between requests are not
+// repeated or skipped. next_cursor is empty on the last page.
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 500
+)
+
+// Kinds of list field, which decide how values compare.
+const (
+	fieldText = iota
+	fieldNumber
+	fieldTime
+	fieldBool
+	fieldList
+)
+
+var listOperators = map[string]bool{"eq": true, "ne": true, "gt": true, "gte": true, "lt": true, "lte": true, "in": true, "contains": true}
+
+var errInvalidListQuery = errors.New("invalid list query")
+
+// listSpec describes a list endpoint. Key is a field unique to each item,
+// which orders items the sort leaves tied. Params are query parameters the
+// endpoint handles itself.
+type listSpec struct {
+	fields map[string]int
+	key    string
+	sort   string
+	params []string
+}
+
+type listQuery struct {
+	spec    listSpec
+	filters []listFilter
+	sort    []sortKey
+	limit   int
+	after   []interface{}
+	fields  fieldSelection
+}
+
+type listFilter struct {
+	field  string
+	op     string
+	values []interface{}
+}
+
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+// listCursor is the position of the last item on a page: its sort values,
+// then its key, under the sort it was listed with.
+type listCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+// listQueryFrom parses a list request's query, answering 400 if it is not
+// valid for the endpoint.
+func listQueryFrom(c *gin.Context, spec listSpec) (*listQuery, bool) {
+	query, err := parseListQuery(c, spec)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	return query, true
+}
+
+func parseListQuery(c *gin.Context, spec listSpec) (*listQuery, error) {
+	query := &listQuery{spec: spec, limit: defaultListLimit}
+
+	for name, values := range c.Request.URL.Query() {
+		value := values[len(values)-1]
+		switch {
+		case name == "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxListLimit {
+				return nil, fmt.Errorf("%w: limit must be 1 to %d", errInvalidListQuery, maxListLimit)
+			}
+			query.limit = limit
+		case name == "fields":
+			fields, err := parseFieldSelection(value)
+			if err != nil {
+				return nil, err
+			}
+			query.fields = fields
+		case name == "cursor", name == "sort":
+		case containsString(spec.params, name):
+		default:
+			filter, err := parseListFilter(spec, name, value)
+			if err != nil {
+				return nil, err
+			}
+			query.filters = append(query.filters, filter)
+		}
+	}
+
+	sortSpec := c.DefaultQuery("sort", spec.sort)
+	for _, field := range strings.Split(sortSpec, ",") {
+		key := sortKey{field: strings.TrimPrefix(field, "-"), desc: strings.HasPrefix(field, "-")}
+		kind, ok := spec.fields[key.field]
+		if !ok || kind == fieldList {
+			return nil, fmt.Errorf("%w: cannot sort on %q", errInvalidListQuery, key.field)
+		}
+		query.sort = append(query.sort, key)
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		after, err := decodeListCursor(raw, sortSpec, len(query.sort)+1)
+		if err != nil {
+			return nil, err
+		}
+		query.after = after
+	}
+
+	return query, nil
+}
+
+// parseListFilter parses a filter parameter, field or field[op].
+func parseListFilter(spec listSpec, name, value string) (listFilter, error) {
+	filter := listFilter{field: name, op: "eq"}
+	if open := strings.IndexByte(name, '['); open > 0 && strings.HasSuffix(name, "]") {
+		filter.field, filter.op = name[:open], name[open+1:len(name)-1]
+	}
+
+	kind, ok := spec.fields[filter.field]
+	if !ok {
+		return filter, fmt.Errorf("%w: unknown parameter %q", errInvalidListQuery, name)
+	}
+	if !listOperators[filter.op] || (filter.op == "contains" && kind != fieldText && kind != fieldList) {
+		return filter, fmt.Errorf("%w: %q cannot be used on %s", errInvalidListQuery, filter.op, filter.field)
+	}
+
+	values := []string{value}
+	if filter.op == "in" {
+		values = strings.Split(value, ",")
+	}
+	for _, raw := range values {
+		parsed, ok := fieldValue(kind, raw)
+		if !ok || parsed == nil {
+			return filter, fmt.Errorf("%w: %q is not a valid %s", errInvalidListQuery, raw, filter.field)
+		}
+		filter.values = append(filter.values, parsed)
+	}
+
+	return filter, nil
+}
+
+// pageList filters, sorts and pages items by the JSON fields they encode
+// to, returning the page and the cursor for the next.
+func pageList[T any](query *listQuery, items []T) ([]T, string, error) {
+	type row struct {
+		item   T
+		fields map[string]interface{}
+	}
+
+	var rows []row
+	for _, item := range items {
+		fields, err := listFields(item)
+		if err != nil {
+			return nil, "", err
+		}
+		if query.matches(fields) {
+			rows = append(rows, row{item, fields})
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return query.compare(query.position(rows[i].fields), query.position(rows[j].fields)) < 0
+	})
+
+	start := 0
+	if query.after != nil {
+		start = sort.Search(len(rows), func(i int) bool {
+			return query.compare(query.position(rows[i].fields), query.after) > 0
+		})
+	}
+
+	page := []T{}
+	for _, r := range rows[start:min(start+query.limit, len(rows))] {
+		page = append(page, r.item)
+	}
+
+	next := ""
+	if start+query.limit < len(rows) {
+		raw := query.position(rows[start+query.limit-1].fields)
+		encoded, err := json.Marshal(listCursor{Sort: query.sortSpec(), Values: raw})
+		if err != nil {
+			return nil, "", err
+		}
+		next = base64.RawURLEncoding.EncodeToString(encoded)
+	}
+
+	return page, next, nil
+}
+
+func (q *listQuery) matches(fields map[string]interface{}) bool {
+	for _, filter := range q.filters {
+		kind := q.spec.fields[filter.field]
+		if !filterMatches(kind, filter, fields[filter.field]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func filterMatches(kind int, filter listFilter, raw interface{}) bool {
+	if kind == fieldList {
+		elements, _ := raw.([]interface{})
+		held := false
+		for _, element := range elements {
+			value, _ := fieldValue(fieldText, element)
+			for _, wanted := range filter.values {
+				if value == wanted || (filter.op == "contains" && strings.Contains(value.(string), wanted.(string))) {
+					held = true
+				}
+			}
+		}
+		return held == (filter.op != "ne")
+	}
+
+	value, ok := fieldValue(kind, raw)
+	if !ok || value == nil {
+		return filter.op == "ne"
+	}
+
+	switch filter.op {
+	case "contains":
+		return strings.Contains(value.(string), filter.values[0].(string))
+	case "in":
+		for _, wanted := range filter.values {
+			if compareField(kind, value, wanted) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	order := compareField(kind, value, filter.values[0])
+	switch filter.op {
+	case "ne":
+		return order != 0
+	case "gt":
+		return order > 0
+	case "gte":
+		return order >= 0
+	case "lt":
+		return order < 0
+	case "lte":
+		return order <= 0
+	}
+	return order == 0
+}
+
+// position is an item's sort values followed by its key.
+func (q *listQuery) position(fields map[string]interface{}) []interface{} {
+	position := make([]interface{}, 0, len(q.sort)+1)
+	for _, key := range q.sort {
+		position = append(position, fields[key.field])
+	}
+
+	return append(position, fields[q.spec.key])
+}
+
+func (q *listQuery) compare(a, b []interface{}) int {
+	for i, key := range append(q.sort, sortKey{field: q.spec.key}) {
+		kind := q.spec.fields[key.field]
+		x, _ := fieldValue(kind, a[i])
+		y, _ := fieldValue(kind, b[i])
+		order := compareField(kind, x, y)
+		if key.desc {
+			order = -order
+		}
+		if order != 0 {
+			return order
+		}
+	}
+
+	return 0
+}
+
+func (q *listQuery) sortSpec() string {
+	fields := make([]string, len(q.sort))
+	for i, key := range q.sort {
+		fields[i] = key.field
+		if key.desc {
+			fields[i] = "-" + key.field
+		}
+	}
+
+	return strings.Join(fields, ",")
+}
+
+func decodeListCursor(raw, sortSpec string, size int) ([]interface{}, error) {
+	encoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", errInvalidListQuery)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var cursor listCursor
+	if err := decoder.Decode(&cursor); err != nil || len(cursor.Values) != size {
+		return nil, fmt.Errorf("%w: malformed cursor", errInvalidListQuery)
+	}
+	if cursor.Sort != sortSpec {
+		return nil, fmt.Errorf("%w: cursor is for sort=%s", errInvalidListQuery, cursor.Sort)
+	}
+
+	return cursor.Values, nil
+}
+
+// listFields is an item's JSON fields, with numbers left as written.
+func listFields(item interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// fieldValue is a field's value, from its JSON or a query parameter, in a
+// form compareField orders: lowercased text, a number, a time or a bool.
+// A missing value is nil.
+func fieldValue(kind int, raw interface{}) (interface{}, bool) {
+	if raw == nil {
+		return nil, true
+	}
+
+	switch value := raw.(type) {
+	case bool:
+		return value, kind == fieldBool
+	case json.Number:
+		raw = value.String()
+	}
+	text, ok := raw.(string)
+	if !ok {
+		return nil, false
+	}
+
+	switch kind {
+	case fieldNumber:
+		number, ok := new(big.Float).SetString(text)
+		return number, ok
+	case fieldTime:
+		parsed, err := time.Parse(time.RFC3339Nano, text)
+		return parsed, err == nil
+	case fieldBool:
+		parsed, err := strconv.ParseBool(text)
+		return parsed, err == nil
+	}
+	return strings.ToLower(text), true
+}
+
+// compareField orders two values of a kind from fieldValue, missing values
+// first.
+func compareField(kind int, a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	switch kind {
+	case fieldNumber:
+		return a.(*big.Float).Cmp(b.(*big.Float))
+	case fieldTime:
+		return a.(time.Time).Compare(b.(time.Time))
+	case fieldBool:
+		if a.(bool) == b.(bool) {
+			return 0
+		} else if b.(bool) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// maxHeldBody bounds the body of a request held for maintenance.
+const maxHeldBody = 1 << 20
+
+// heldHeaders are the request headers a held request is carried out with.
+// Credentials are not among them; the caller is remembered instead.
+var heldHeaders = []string{"Content-Type", "Accept-Language", "X-Forwarded-For", "X-Forwarded-Proto"}
+
+// heldRequestKey marks a request being carried out after maintenance, in the
+// request's context so that it cannot be set from outside.
+type heldRequestKey struct{}
+
+// HoldDuringMaintenance accepts requests that sign or send while the wallet
+// is in maintenance and holds them until it ends, answering 202 with their
+// place in the queue. Everything else is served as usual.
+func HoldDuringMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, replayed := heldRequest(c); replayed || !holdsForMaintenance(c.Request.Method, c.FullPath()) || !services.InMaintenance() {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxHeldBody))
+		if err != nil {
+			respondError(c, http.StatusRequestEntityTooLarge, "Request body too large")
+			c.Abort()
+			return
+		}
+
+		request := services.HeldRequest{
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.RequestURI(),
+			Header:     map[string]string{},
+			Body:       body,
+			RemoteAddr: c.Request.RemoteAddr,
+		}
+		for _, name := range heldHeaders {
+			if value := c.GetHeader(name); value != "" {
+				request.Header[name] = value
+			}
+		}
+		if principal, exists := c.Get(principalKey); exists {
+			request.Principal = principal.(*services.Principal)
+		}
+
+		held, err := services.HoldRequest(request)
+		if errors.Is(err, services.ErrNotInMaintenance) {
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			c.Next()
+			return
+		}
+		if err != nil {
+			respondError(c, maintenanceErrorStatus(err), err.Error())
+			c.Abort()
+			return
+		}
+
+		c.Header("Location", "/maintenance/held/"+held.ID)
+		c.JSON(http.StatusAccepted, held)
+		c.Abort()
+	}
+}
+
+// holdsForMaintenance reports whether a route signs or sends. Cancelling
+// something already queued does neither, and goes ahead.
+func holdsForMaintenance(method, path string) bool {
+	if path == "" || method == http.MethodDelete {
+		return false
+	}
+
+	switch routeScopes[method+" "+path] {
+	case services.ScopeTxSend, services.ScopeTokensTransfer:
+		return true
+	}
+	return false
+}
+
+func heldRequest(c *gin.Context) (*services.HeldRequest, bool) {
+	held, ok := c.Request.Context().Value(heldRequestKey{}).(*services.HeldRequest)
+	return held, ok
+}
+
+// ReplayHeldRequest carries out held requests through the router, as the
+// caller who made them, so they meet the same checks they would have met had
+// they not been held.
+func ReplayHeldRequest(r *gin.Engine) func(*services.HeldRequest) services.HeldResponse {
+	return func(held *services.HeldRequest) services.HeldResponse {
+		ctx := context.WithValue(context.Background(), heldRequestKey{}, held)
+		request, err := http.NewRequestWithContext(ctx, held.Method, held.Path, bytes.NewReader(held.Body))
+		if err != nil {
+			body, _ := json.Marshal(gin.H{"error": err.Error()})
+			return services.HeldResponse{Status: http.StatusInternalServerError, Body: body}
+		}
+		for name, value := range held.Header {
+			request.Header.Set(name, value)
+		}
+		request.RemoteAddr = held.RemoteAddr
+
+		recorder := &heldResponseWriter{header: http.Header{}, status: http.StatusOK}
+		r.ServeHTTP(recorder, request)
+
+		body := recorder.body.Bytes()
+		if !json.Valid(body) {
+			body, _ = json.Marshal(recorder.body.String())
+		}
+		return services.HeldResponse{Status: recorder.status, Body: body}
+	}
+}
+
+// heldResponseWriter keeps the response to a held request.
+type heldResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *heldResponseWriter) Header() http.Header { return w.header }
+
+func (w *heldResponseWriter) Write(data []byte) (int, error) { return w.body.Write(data) }
+
+func (w *heldResponseWriter) WriteHeader(status int) { w.status = status }
+
+func GetMaintenance(c *gin.Context) {
+	maintenance, err := services.GetMaintenance()
+	if err != nil {
+		respondError(c, maintenanceErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, maintenance)
+}
+
+// StartMaintenance puts the wallet in maintenance, optionally until a time
+// or for a duration such as "30m".
+func StartMaintenance(c *gin.Context) {
+	var request struct {
+		Reason   string     `json:"reason"`
+		Until    *time.Time `json:"until"`
+		Duration string     `json:"duration"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if request.Duration != "" {
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil || duration <= 0 || request.Until != nil {
+			respondError(c, http.StatusBadRequest, "Invalid request")
+			return
+		}
+		until := time.Now().Add(duration).UTC()
+		request.Until = &until
+	}
+
+	maintenance, err := services.StartMaintenance(request.Reason, request.Until)
+	if err != nil {
+		respondError(c, maintenanceErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, maintenance)
+}
+
+// EndMaintenance ends maintenance; the held requests are then carried out in
+// the order they arrived.
+func EndMaintenance(c *gin.Context) {
+	maintenance, err := services.EndMaintenance()
+	if err != nil {
+		respondError(c, maintenanceErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, maintenance)
+}
+
+func ListHeldRequests(c *gin.Context) {
+	held, err := services.ListHeldRequests()
+	if err != nil {
+		respondError(c, maintenanceErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"held": held})
+}
+
+// GetHeldRequest shows a held request's place in the queue or, once it has
+// been carried out, the response it got.
+func GetHeldRequest(c *gin.Context) {
+	held, err := services.GetHeldRequest(c.Param("id"))
+	if err != nil {
+		respondError(c, maintenanceErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, held)
+}
+
+func CancelHeldRequest(c *gin.Context) {
+	held, err := services.CancelHeldRequest(c.Param("id"))
+	if err != nil {
+		respondError(c, maintenanceErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, held)
+}
+
+func maintenanceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidMaintenance):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrHeldNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotInMaintenance), errors.Is(err, services.ErrHeldNotQueued):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrHeldQueueFull):
+		return http.StatusServiceUnavailable
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/hdwallet"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func GenerateMnemonic(c *gin.Context) {
+	var request struct {
+		Name       string `json:"name"`
+		Words      int    `json:"words"`
+		Passphrase string `json:"passphrase"`
+		Password   string `json:"password"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	account, err := services.GenerateMnemonic(request.Name, request.Words, request.Passphrase, request.Password)
+	if err != nil {
+		respondError(c, mnemonicErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+func RecoverMnemonic(c *gin.Context) {
+	var request struct {
+		Name       string `json:"name"`
+		Mnemonic   string `json:"mnemonic"`
+		Passphrase string `json:"passphrase"`
+		Password   string `json:"password"`
+		GapLimit   int    `json:"gap_limit"`
+	}
+
+	if err := c.BindJSON(&request); err != nil || request.Mnemonic == "" {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	result, err := services.RecoverMnemonic(request.Name, request.Mnemonic, request.Passphrase, request.Password, request.GapLimit)
+	if err != nil {
+		respondError(c, mnemonicErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func mnemonicErrorStatus(err error) int {
+	if errors.Is(err, hdwallet.ErrInvalidMnemonic) {
+		return http.StatusBadRequest
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
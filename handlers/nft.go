@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func RegisterNFTCollection(c *gin.Context) {
+	// ChainID shadows the collection's own field so a chain name is accepted.
+	var request struct {
+		services.NFTCollection
+		ChainID chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+	request.NFTCollection.ChainID = chain.ID.Uint64()
+
+	collection, err := services.RegisterNFTCollection(request.NFTCollection)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+func ListNFTCollections(c *gin.Context) {
+	collections, err := services.ListNFTCollections()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collections": collections})
+}
+
+func MintNFT(c *gin.Context) {
+	var request struct {
+		Collection string            `json:"collection"`
+		Args       []json.RawMessage `json:"args"`
+		Value      string            `json:"value"`
+		Metadata   json.RawMessage   `json:"metadata"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	var value *big.Int
+	if request.Value != "" {
+		var ok bool
+		if value, ok = parseAmount(request.Value); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(value))
+	if !ok {
+		return
+	}
+
+	result, err := services.MintNFT(request.Collection, request.Args, value, request.Metadata)
+	if err != nil {
+		refund()
+		status := errorStatus(err, http.StatusBadRequest)
+		if errors.Is(err, services.ErrCollectionNotFound) {
+			status = http.StatusNotFound
+		}
+		respondSendError(c, status, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func ListNFTs(c *gin.Context) {
+	tokens, err := services.ListNFTs(c.Query("owner"))
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	if tokens == nil {
+		tokens = []services.NFTToken{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"nfts": tokens})
+}
+
+// ScanNFTs refreshes an account's NFTs on a chain from its transfer events
+// and returns them.
+func ScanNFTs(c *gin.Context) {
+	var request struct {
+		Account string        `json:"account"`
+		ChainID chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	tokens, err := services.ScanNFTs(chain, request.Account)
+	if err != nil {
+		respondError(c, accountErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"nfts": tokens})
+}
+
+func GetNFTMetadata(c *gin.Context) {
+	tokenID, ok := parseAmount(c.Query("token_id"))
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	metadata, err := services.GetNFTMetadata(chain, c.Query("contract"), tokenID)
+	if err != nil {
+		respondError(c, nftErrorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
+
+// TransferNFT sends ERC-721 or ERC-1155 tokens with safeTransferFrom, or
+// several ERC-1155 tokens with one safeBatchTransferFrom.
+func TransferNFT(c *gin.Context) {
+	var request struct {
+		Account   string        `json:"account"`
+		Contract  string        `json:"contract"`
+		ToAddress string        `json:"to_address"`
+		TokenIDs  []string      `json:"token_ids"`
+		Amounts   []string      `json:"amounts"`
+		Data      string        `json:"data"`
+		ChainID   chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	tokenIDs, ok := parseAmounts(request.TokenIDs)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+	amounts, ok := parseAmounts(request.Amounts)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+	data, ok := parseHexData(request.Data)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid data")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+	if !chainAddresses(c, chain, &request.Contract, &request.ToAddress) {
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(nil))
+	if !ok {
+		return
+	}
+
+	result, err := services.TransferNFT(chain, request.Account, request.Contract, request.ToAddress, tokenIDs, amounts, data)
+	if err != nil {
+		refund()
+		respondSendError(c, nftErrorStatus(err, transactionErrorStatus(err)), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func parseAmounts(values []string) ([]*big.Int, bool) {
+	amounts := make([]*big.Int, 0, len(values))
+	for _, value := range values {
+		amount, ok := parseAmount(value)
+		if !ok {
+			return nil, false
+		}
+		amounts = append(amounts, amount)
+	}
+
+	return amounts, true
+}
+
+func nftErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, services.ErrNotNFT), errors.Is(err, services.ErrInvalidNFTTransfer):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrNFTMetadata):
+		return http.StatusBadGateway
+	}
+
+	return fallback
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// OpenAPI serves an OpenAPI description of r's routes, generated from the
+// router and the scope table so it cannot drift from what is enforced. Each
+// operation lists the scope it needs in its security requirements and in
+// x-scope.
+func OpenAPI(r *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		paths := map[string]map[string]interface{}{}
+
+		routes := r.Routes()
+		sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+		for _, route := range routes {
+			// Decoy routes are left out; advertising them would defeat them.
+			if strings.Contains(route.Path, "*") || route.Method == http.MethodHead || strings.HasSuffix(route.Handler, ".Honeypot") {
+				continue
+			}
+
+			path, parameters := openAPIPath(route.Path)
+			operation := map[string]interface{}{
+				"responses": map[string]interface{}{
+					"default": map[string]interface{}{"description": "JSON response; errors have an error field"},
+				},
+			}
+			if name := route.Handler[strings.LastIndex(route.Handler, ".")+1:]; !strings.HasPrefix(name, "func") {
+				operation["operationId"] = name
+			}
+			if len(parameters) > 0 {
+				operation["parameters"] = parameters
+			}
+
+			if publicRoutes[route.Method+" "+route.Path] {
+				operation["security"] = []interface{}{}
+			} else {
+				scope := requiredScope(route.Method, route.Path)
+				operation["x-scope"] = scope
+				operation["security"] = []map[string][]string{
+					{"bearer": {scope}},
+					{"apiKey": {scope}},
+				}
+			}
+
+			if paths[path] == nil {
+				paths[path] = map[string]interface{}{}
+			}
+			paths[path][strings.ToLower(route.Method)] = operation
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"openapi": "3.1.0",
+			"info": gin.H{
+				"title":   "go-wallet",
+				"version": "1",
+			},
+			"paths": paths,
+			"components": gin.H{
+				"securitySchemes": gin.H{
+					"bearer": gin.H{
+						"type":         "http",
+						"scheme":       "bearer",
+						"bearerFormat": "JWT",
+						"description":  "An access token from /auth/callback or /auth/token, or an API key",
+					},
+					"apiKey": gin.H{
+						"type": "apiKey",
+						"in":   "header",
+						"name": "X-API-Key",
+					},
+				},
+				"x-scopes": services.ScopeDescriptions,
+			},
+		})
+	}
+}
+
+// openAPIPath turns gin's :name parameters into OpenAPI {name} form.
+func openAPIPath(path string) (string, []gin.H) {
+	var parameters []gin.H
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+			parameters = append(parameters, gin.H{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   gin.H{"type": "string"},
+			})
+		}
+	}
+
+	return strings.Join(segments, "/"), parameters
+}
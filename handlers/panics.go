@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jabbala-dev/go-wallet/i18n"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+const requestIDKey = "request_id"
+
+// requestIDPattern is what a caller's X-Request-ID must look like to be
+// kept, so that it is safe to log.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RecoverPanics tags every request with an ID, the caller's X-Request-ID if
+// it gave a usable one, and returns it in X-Request-ID. A panic while
+// serving the request is answered with a 500 carrying that ID, and reported
+// with it by services.ReportPanic, so the two can be matched up.
+func RecoverPanics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Set(requestIDKey, requestID)
+		c.Header("X-Request-ID", requestID)
+		// Middleware that buffers the response may not get to pass it on.
+		writer := c.Writer
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// The client is gone; there is nothing to report.
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			services.ReportPanic(services.NewPanicReport(requestID, c.Request.Method, c.Request.URL.RequestURI(), recovered, debug.Stack()))
+
+			c.Writer = writer
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":      i18n.T(language(c), "Internal server error"),
+				"request_id": requestID,
+			})
+		}()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// CreatePayoutBatch schedules a batch of payouts from the selected account,
+// with optional privacy: shuffled order, jitter between sends and a fresh
+// derived sender per payout.
+func CreatePayoutBatch(c *gin.Context) {
+	var request struct {
+		Payouts []services.Payout      `json:"payouts"`
+		Privacy services.PayoutPrivacy `json:"privacy"`
+		ChainID chainSelector          `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	for i := range request.Payouts {
+		if !chainAddresses(c, chain, &request.Payouts[i].To) {
+			return
+		}
+	}
+
+	total := new(big.Int)
+	for _, payout := range request.Payouts {
+		if value, ok := new(big.Int).SetString(payout.Value, 10); ok {
+			total.Add(total, value)
+		}
+	}
+	refund, ok := chargeQuota(c, services.QuotaCharge{Signs: len(request.Payouts), Transactions: len(request.Payouts), Value: total})
+	if !ok {
+		return
+	}
+
+	batch, err := services.CreatePayoutBatch(chain, request.Payouts, request.Privacy)
+	if err != nil {
+		refund()
+		respondError(c, payoutErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"batch": batch})
+}
+
+func GetPayoutBatch(c *gin.Context) {
+	batch, err := services.GetPayoutBatch(c.Param("id"))
+	if err != nil {
+		respondError(c, payoutErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"batch": batch})
+}
+
+// CancelPayoutBatch cancels whatever of a batch has not been sent yet.
+func CancelPayoutBatch(c *gin.Context) {
+	cancelled, err := services.CancelPayoutBatch(c.Param("id"))
+	if err != nil {
+		respondError(c, payoutErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cancelled": cancelled})
+}
+
+func payoutErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPayoutBatchNotFound), errors.Is(err, services.ErrHDAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPayoutBatch), errors.Is(err, services.ErrWatchOnly):
+		return http.StatusBadRequest
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// chargeQuota charges a signing request to the caller's API key quota. When
+// it is over quota the response is written and ok is false; otherwise the
+// returned refund should be called if the request then fails.
+func chargeQuota(c *gin.Context, charge services.QuotaCharge) (refund func(), ok bool) {
+	var principal *services.Principal
+	if value, exists := c.Get(principalKey); exists {
+		principal = value.(*services.Principal)
+	}
+
+	refund, err := services.ChargeQuota(principal, charge)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			status = http.StatusTooManyRequests
+		}
+		respondError(c, status, err.Error())
+		return nil, false
+	}
+
+	return refund, true
+}
+
+// signCharge and sendCharge are the charges for a signature and for a
+// transaction sending value wei.
+var signCharge = services.QuotaCharge{Signs: 1}
+
+func sendCharge(value *big.Int) services.QuotaCharge {
+	return services.QuotaCharge{Signs: 1, Transactions: 1, Value: value}
+}
+
+func SetAPIKeyQuota(c *gin.Context) {
+	var request struct {
+		Quota *services.APIKeyQuota `json:"quota"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	key, err := services.SetAPIKeyQuota(c.Param("id"), request.Quota)
+	if err != nil {
+		respondError(c, apiKeyErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_key": key})
+}
+
+func GetAPIKeyUsage(c *gin.Context) {
+	usage, err := services.GetAPIKeyUsage(c.Param("id"))
+	if err != nil {
+		respondError(c, apiKeyErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+func apiKeyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrInvalidScope), errors.Is(err, services.ErrInvalidQuota):
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// BuildTransaction returns an unsigned transaction and its signing payload,
+// for signing on another machine. Nothing is signed or reserved.
+func BuildTransaction(c *gin.Context) {
+	var request struct {
+		Account   string        `json:"account"`
+		ToAddress string        `json:"to_address"`
+		Value     string        `json:"value"`
+		Data      string        `json:"data"`
+		ChainID   chainSelector `json:"chain_id"`
+		Nonce     *uint64       `json:"nonce"`
+
+		TxType               string `json:"tx_type"`
+		MaxFeePerGas         string `json:"max_fee_per_gas"`
+		MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	value := new(big.Int)
+	ok := true
+	if request.Value != "" {
+		if value, ok = parseAmount(request.Value); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+	}
+	data, ok := parseHexData(request.Data)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid data")
+		return
+	}
+
+	fees := services.FeeOptions{Type: request.TxType, Nonce: request.Nonce}
+	if request.MaxFeePerGas != "" {
+		if fees.MaxFeePerGas, ok = parseAmount(request.MaxFeePerGas); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid fee")
+			return
+		}
+	}
+	if request.MaxPriorityFeePerGas != "" {
+		if fees.MaxPriorityFeePerGas, ok = parseAmount(request.MaxPriorityFeePerGas); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid fee")
+			return
+		}
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+	if !chainAddresses(c, chain, &request.ToAddress) {
+		return
+	}
+
+	unsigned, err := services.BuildTransaction(chain, request.Account, request.ToAddress, value, data, fees)
+	if err != nil {
+		respondError(c, transactionErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, unsigned)
+}
+
+// SignTransaction signs an unsigned transaction payload with an account's
+// key and returns it without broadcasting it.
+func SignTransaction(c *gin.Context) {
+	var request struct {
+		Account  string `json:"account"`
+		Unsigned string `json:"unsigned_transaction"`
+	}
+
+	if err := c.BindJSON(&request); err != nil || request.Unsigned == "" {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	signed, err := services.SignUnsignedTransaction(request.Account, request.Unsigned)
+	if err != nil {
+		refund()
+		respondSendError(c, transactionErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, signed)
+}
+
+// BroadcastTransaction sends a transaction signed elsewhere.
+func BroadcastTransaction(c *gin.Context) {
+	var request struct {
+		RawTx string `json:"raw_transaction"`
+	}
+
+	if err := c.BindJSON(&request); err != nil || request.RawTx == "" {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(nil))
+	if !ok {
+		return
+	}
+
+	txHash, status, err := services.BroadcastRawTransaction(request.RawTx)
+	if err != nil {
+		refund()
+		respondError(c, transactionErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transaction_hash": txHash, "status": status})
+}
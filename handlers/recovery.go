@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// GetGuardians returns a smart account's guardians and recovery threshold.
+func GetGuardians(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	set, err := services.GetGuardians(chain, c.Param("address"))
+	if err != nil {
+		respondError(c, recoveryErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"guardians": set})
+}
+
+func AddGuardian(c *gin.Context) {
+	var request struct {
+		Guardian string        `json:"guardian"`
+		ChainID  chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	result, err := services.AddGuardian(chain, c.Param("address"), request.Guardian)
+	if err != nil {
+		refund()
+		respondSendError(c, recoveryErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_operation": result})
+}
+
+func RemoveGuardian(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	result, err := services.RemoveGuardian(chain, c.Param("address"), c.Param("guardian"))
+	if err != nil {
+		refund()
+		respondSendError(c, recoveryErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_operation": result})
+}
+
+func SetGuardianThreshold(c *gin.Context) {
+	var request struct {
+		Threshold uint64        `json:"threshold"`
+		ChainID   chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	result, err := services.SetGuardianThreshold(chain, c.Param("address"), request.Threshold)
+	if err != nil {
+		refund()
+		respondSendError(c, recoveryErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_operation": result})
+}
+
+// StartRecovery opens a recovery of a smart account to a new owner and
+// returns the typed data its guardians sign.
+func StartRecovery(c *gin.Context) {
+	var request struct {
+		NewOwner string        `json:"new_owner"`
+		ChainID  chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	recovery, err := services.StartRecovery(chain, c.Param("address"), request.NewOwner)
+	if err != nil {
+		respondError(c, recoveryErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery": recovery})
+}
+
+func GetRecovery(c *gin.Context) {
+	recovery, err := services.GetRecovery(c.Param("address"), c.Param("id"))
+	if err != nil {
+		respondError(c, recoveryErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery": recovery})
+}
+
+// AddRecoverySignature adds a guardian's signature to a recovery. With no
+// signature given, the wallet signs as the guardian, if it holds its key.
+func AddRecoverySignature(c *gin.Context) {
+	var request struct {
+		Guardian  string `json:"guardian"`
+		Signature string `json:"signature"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	var charge services.QuotaCharge
+	if request.Signature == "" {
+		charge = signCharge
+	}
+	refund, ok := chargeQuota(c, charge)
+	if !ok {
+		return
+	}
+
+	recovery, err := services.AddRecoverySignature(c.Param("address"), c.Param("id"), request.Guardian, request.Signature)
+	if err != nil {
+		refund()
+		respondError(c, recoveryErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery": recovery})
+}
+
+// ExecuteRecovery submits a recovery once enough guardians have signed.
+func ExecuteRecovery(c *gin.Context) {
+	refund, ok := chargeQuota(c, sendCharge(nil))
+	if !ok {
+		return
+	}
+
+	recovery, err := services.ExecuteRecovery(c.Param("address"), c.Param("id"))
+	if err != nil {
+		refund()
+		respondSendError(c, recoveryErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery": recovery})
+}
+
+func recoveryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRecoveryNotFound), errors.Is(err, services.ErrSmartAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotGuardian), errors.Is(err, services.ErrInvalidThreshold):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrThresholdNotMet), errors.Is(err, services.ErrRecoveryStale),
+		errors.Is(err, services.ErrRecoveryNotCollecting), errors.Is(err, services.ErrSmartAccountMismatch):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrRecoveryUnavailable), errors.Is(err, services.ErrBundlerUnavailable),
+		errors.Is(err, services.ErrSmartAccountsUnavailable):
+		return http.StatusServiceUnavailable
+	}
+
+	return errorStatus(err, http.StatusBadRequest)
+}
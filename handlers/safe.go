@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// ListSafes returns the Safes the wallet's accounts own, as the Safe
+// Transaction Service reports them.
+func ListSafes(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	safes, err := services.ListSafes(chain)
+	if err != nil {
+		respondError(c, safeErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"safes": safes})
+}
+
+func GetSafe(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	safe, err := services.GetSafe(chain, c.Param("address"))
+	if err != nil {
+		respondError(c, safeErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"safe": safe})
+}
+
+// ListSafeTransactions returns the Safe's transactions as of the last sync.
+func ListSafeTransactions(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	transactions, err := services.ListSafeTransactions(chain, c.Param("address"))
+	if err != nil {
+		respondError(c, safeErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transactions": transactions})
+}
+
+// SyncSafeTransactions pushes the Safe's local proposals and confirmations
+// to the service and pulls its pending transactions.
+func SyncSafeTransactions(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	transactions, err := services.SyncSafeTransactions(chain, c.Param("address"))
+	if err != nil {
+		respondError(c, safeErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transactions": transactions})
+}
+
+func ProposeSafeTransaction(c *gin.Context) {
+	var request struct {
+		To      string        `json:"to"`
+		Value   string        `json:"value"`
+		Data    string        `json:"data"`
+		Nonce   *uint64       `json:"nonce"`
+		Owner   string        `json:"owner"`
+		ChainID chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	proposal := services.SafeProposal{To: request.To, Nonce: request.Nonce, Owner: request.Owner}
+	if request.Value != "" {
+		var ok bool
+		if proposal.Value, ok = parseAmount(request.Value); !ok {
+			respondError(c, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+	}
+	data, ok := parseHexData(request.Data)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid data")
+		return
+	}
+	proposal.Data = data
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	if !chainAddresses(c, chain, &request.To, &request.Owner) {
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	tx, err := services.ProposeSafeTransaction(chain, c.Param("address"), proposal)
+	if err != nil {
+		refund()
+		respondError(c, safeErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transaction": tx})
+}
+
+// ConfirmSafeTransaction signs a pending Safe transaction with one of the
+// wallet's owner accounts.
+func ConfirmSafeTransaction(c *gin.Context) {
+	var request struct {
+		Owner   string        `json:"owner"`
+		All     bool          `json:"all"`
+		ChainID chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if request.All && request.Owner != "" {
+		respondError(c, http.StatusBadRequest, "Give an owner or all, not both")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	var tx *services.SafeTransaction
+	var err error
+	if request.All {
+		tx, err = services.CollectSafeConfirmations(chain, c.Param("address"), c.Param("hash"))
+	} else {
+		tx, err = services.ConfirmSafeTransaction(chain, c.Param("address"), c.Param("hash"), request.Owner)
+	}
+	if err != nil {
+		refund()
+		respondError(c, safeErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transaction": tx})
+}
+
+// ExportSafeTransaction returns a pending Safe transaction as a bundle for
+// owners to sign offline, with who has signed it and who has not.
+func ExportSafeTransaction(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	bundle, err := services.ExportSafeTransaction(chain, c.Param("address"), c.Param("hash"))
+	if err != nil {
+		respondError(c, safeErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bundle": bundle})
+}
+
+// ImportSafeSignatures adds the signatures offline owners made from a
+// bundle.
+func ImportSafeSignatures(c *gin.Context) {
+	var request struct {
+		Signatures []string      `json:"signatures"`
+		ChainID    chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	tx, err := services.ImportSafeSignatures(chain, c.Param("address"), c.Param("hash"), request.Signatures)
+	if err != nil {
+		respondError(c, safeErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transaction": tx})
+}
+
+// ExecuteSafeTransaction executes a Safe transaction once its threshold of
+// owners have signed, sent from a wallet account that pays the gas.
+func ExecuteSafeTransaction(c *gin.Context) {
+	var request struct {
+		Account string        `json:"account"`
+		ChainID chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(new(big.Int)))
+	if !ok {
+		return
+	}
+
+	tx, err := services.ExecuteSafeTransaction(chain, c.Param("address"), c.Param("hash"), request.Account)
+	if err != nil {
+		refund()
+		respondSendError(c, safeErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transaction": tx})
+}
+
+func safeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSafeTxNotFound), errors.Is(err, services.ErrAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSafeTxClosed), errors.Is(err, services.ErrAlreadyConfirmed),
+		errors.Is(err, services.ErrSafeTxHashMismatch), errors.Is(err, services.ErrSafeTxNotNext):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrSafeThresholdNotMet), errors.Is(err, services.ErrGasEstimation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrSafeServiceUnavailable):
+		return http.StatusServiceUnavailable
+	}
+
+	return errorStatus(err, http.StatusBadRequest)
+}
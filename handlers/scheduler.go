@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func ScheduleTransaction(c *gin.Context) {
+	var request struct {
+		ToAddress      string        `json:"to_address"`
+		Value          int64         `json:"value"`
+		NotBefore      time.Time     `json:"not_before"`
+		NotBeforeBlock uint64        `json:"not_before_block"`
+		ChainID        chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	if !chainAddresses(c, chain, &request.ToAddress) {
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(big.NewInt(request.Value)))
+	if !ok {
+		return
+	}
+
+	scheduled, err := services.ScheduleTransaction(chain, request.ToAddress, request.Value, request.NotBefore, request.NotBeforeBlock)
+	if err != nil {
+		refund()
+		status := errorStatus(err, http.StatusInternalServerError)
+		if errors.Is(err, services.ErrScheduleNoLock) || errors.Is(err, services.ErrSchedulePast) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduled)
+}
+
+func ListScheduledTransactions(c *gin.Context) {
+	schedule, err := services.ListScheduledTransactions()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	if schedule == nil {
+		schedule = []*services.ScheduledTransaction{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled": schedule})
+}
+
+func CancelScheduledTransaction(c *gin.Context) {
+	if err := services.CancelScheduledTransaction(c.Param("id")); err != nil {
+		status := errorStatus(err, http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, services.ErrScheduleNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrScheduleReleased):
+			status = http.StatusConflict
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cancelled": c.Param("id")})
+}
+
+// GetQueue lists everything still waiting to go out: scheduled transactions
+// that have not been released and signed transactions awaiting broadcast.
+func GetQueue(c *gin.Context) {
+	schedule, err := services.ListScheduledTransactions()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	broadcast, err := services.ListPendingBroadcasts()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	scheduled := []*services.ScheduledTransaction{}
+	for _, entry := range schedule {
+		if entry.Status == services.ScheduleStatusScheduled {
+			scheduled = append(scheduled, entry)
+		}
+	}
+
+	if broadcast == nil {
+		broadcast = []*services.PendingBroadcast{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled": scheduled, "broadcast": broadcast})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// bufferedWriter holds the response body back so it can be signed before
+// anything reaches the client.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// SignResponses signs every response with the server identity key. The
+// signature covers "<timestamp>\n<method> <path>\n<body>" and is sent in
+// X-Signature (base64 Ed25519) with the timestamp in X-Signature-Timestamp.
+func SignResponses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		payload := []byte(timestamp + "\n" + c.Request.Method + " " + c.Request.URL.RequestURI() + "\n")
+		payload = append(payload, writer.body.Bytes()...)
+
+		signature, err := services.SignWithIdentity(payload)
+		if err != nil {
+			log.Printf("failed to sign response: %v", err)
+		} else {
+			c.Header("X-Signature", base64.StdEncoding.EncodeToString(signature))
+			c.Header("X-Signature-Timestamp", timestamp)
+		}
+
+		c.Writer.Write(writer.body.Bytes())
+	}
+}
+
+func GetIdentity(c *gin.Context) {
+	publicKey, err := services.IdentityPublicKey()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":  "ed25519",
+		"public_key": hex.EncodeToString(publicKey),
+	})
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// CreateSmartAccount returns the counterfactual address of a new smart
+// account for the selected account. It can receive funds at once; the
+// contract is deployed by its first send.
+func CreateSmartAccount(c *gin.Context) {
+	var request struct {
+		Salt    string        `json:"salt"`
+		ChainID chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	var salt *big.Int
+	if request.Salt != "" {
+		var ok bool
+		if salt, ok = new(big.Int).SetString(request.Salt, 10); !ok || salt.Sign() < 0 {
+			respondError(c, http.StatusBadRequest, "Invalid salt")
+			return
+		}
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	account, err := services.CreateSmartAccount(chain, salt)
+	if err != nil {
+		respondError(c, smartAccountErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"smart_account": account})
+}
+
+func ListSmartAccounts(c *gin.Context) {
+	accounts, err := services.ListSmartAccounts()
+	if err != nil {
+		respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	if accounts == nil {
+		accounts = []*services.SmartAccount{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"smart_accounts": accounts})
+}
+
+// GetSmartAccount reports whether a smart account is deployed on a chain
+// yet, and its balance there.
+func GetSmartAccount(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	status, err := services.GetSmartAccount(chain, c.Param("address"))
+	if err != nil {
+		respondError(c, smartAccountErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"smart_account": status})
+}
+
+// SendUserOperation sends from a smart account through the bundler,
+// deploying the account first if this is its first send on the chain.
+func SendUserOperation(c *gin.Context) {
+	var request struct {
+		To      string        `json:"to"`
+		Value   string        `json:"value"`
+		Data    string        `json:"data"`
+		ChainID chainSelector `json:"chain_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	value := new(big.Int)
+	if request.Value != "" {
+		var ok bool
+		if value, ok = new(big.Int).SetString(request.Value, 10); !ok || value.Sign() < 0 {
+			respondError(c, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+	}
+	data, ok := parseHexData(request.Data)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid data")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	if !chainAddresses(c, chain, &request.To) {
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(value))
+	if !ok {
+		return
+	}
+
+	result, err := services.SendUserOperation(chain, c.Param("address"), request.To, value, data)
+	if err != nil {
+		refund()
+		respondSendError(c, smartAccountErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_operation": result})
+}
+
+// GetUserOperationReceipt returns a UserOperation's receipt, with pending
+// set while the bundler has not yet included it.
+func GetUserOperationReceipt(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	receipt, err := services.GetUserOperationReceipt(chain, c.Param("hash"))
+	if err != nil {
+		respondError(c, smartAccountErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pending": receipt == nil, "receipt": receipt})
+}
+
+func smartAccountErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSmartAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSmartAccountExists), errors.Is(err, services.ErrSmartAccountMismatch):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrBundlerUnavailable), errors.Is(err, services.ErrSmartAccountsUnavailable):
+		return http.StatusServiceUnavailable
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// GetSnapshot snapshots the wallet's accounts, or those in ?accounts=, at
+// ?block=, the latest block if it is not given.
+func GetSnapshot(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	var block *big.Int
+	if value := c.Query("block"); value != "" && value != "latest" {
+		if block, ok = new(big.Int).SetString(value, 10); !ok || block.Sign() < 0 {
+			respondError(c, http.StatusBadRequest, "Invalid block number")
+			return
+		}
+	}
+	accounts := splitList(c.Query("accounts"))
+	for i := range accounts {
+		if !chainAddresses(c, chain, &accounts[i]) {
+			return
+		}
+	}
+
+	snapshot, err := services.TakeSnapshot(chain, accounts, block)
+	if err != nil {
+		respondError(c, snapshotErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// DiffSnapshots compares two snapshots taken by GetSnapshot.
+func DiffSnapshots(c *gin.Context) {
+	var request struct {
+		From *services.Snapshot `json:"from"`
+		To   *services.Snapshot `json:"to"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	diff, err := services.DiffSnapshots(request.From, request.To)
+	if err != nil {
+		respondError(c, snapshotErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+func snapshotErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidSnapshot):
+		return http.StatusBadRequest
+	case errors.Is(err, ethereum.NotFound):
+		return http.StatusNotFound
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+const (
+	streamPingInterval = 30 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// streamUpgrader refuses cross-origin upgrades, so a page elsewhere cannot
+// open a stream with the browser's credentials.
+var streamUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+// Stream upgrades to a WebSocket and sends the chosen topics (new_heads,
+// incoming, transactions, comma-separated) as JSON messages until the
+// client goes away.
+func Stream(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	subscription, err := services.Subscribe(chain, splitList(c.Query("topics")), splitList(c.Query("accounts")))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidSubscription) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+	defer subscription.Close()
+
+	conn, err := streamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already answered.
+		return
+	}
+	defer conn.Close()
+
+	// Nothing is read from the client; reading notices when it leaves and
+	// answers its pings.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		case message, open := <-subscription.C:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if !open {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind"))
+				return
+			}
+			if err := conn.WriteJSON(message); err != nil {
+				log.Printf("stream: %v", err)
+				return
+			}
+		}
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
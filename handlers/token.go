@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/i18n"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// GetTokenInfo returns an ERC-20 token's name, symbol, decimals and total
+// supply.
+func GetTokenInfo(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	token := c.Query("token")
+	if !chainAddresses(c, chain, &token) {
+		return
+	}
+
+	info, err := services.GetTokenInfo(chain, token)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// GetTokenBalance returns what an owner, the selected account by default,
+// holds of an ERC-20 token, with an ETag as for GetBalance.
+func GetTokenBalance(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	token, owner := c.Query("token"), c.Query("owner")
+	if !chainAddresses(c, chain, &token, &owner) {
+		return
+	}
+	if owner == "" {
+		var err error
+		if owner, err = services.SelectedAddress(); err != nil {
+			respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+			return
+		}
+	}
+
+	balance, err := services.GetTokenBalance(chain, token, owner)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	respondWithETag(c, balance)
+}
+
+func GetTokenAllowance(c *gin.Context) {
+	chain, ok := requestChain(c, chainSelector(c.Query("chain_id")))
+	if !ok {
+		return
+	}
+
+	token, owner, spender := c.Query("token"), c.Query("owner"), c.Query("spender")
+	if !chainAddresses(c, chain, &token, &owner, &spender) {
+		return
+	}
+	if spender == "" {
+		var err error
+		if spender, err = services.GetAddress(""); err != nil {
+			respondError(c, errorStatus(err, http.StatusInternalServerError), err.Error())
+			return
+		}
+	}
+
+	allowance, err := services.TokenAllowance(chain, token, owner, spender)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "owner": owner, "spender": spender, "allowance": allowance.String()})
+}
+
+// CheckTokenTransfer reports what a transfer of a token would do, including
+// any fee-on-transfer or rebasing warnings, without sending it.
+func CheckTokenTransfer(c *gin.Context) {
+	var request struct {
+		Token         string        `json:"token"`
+		From          string        `json:"from"`
+		To            string        `json:"to"`
+		Amount        string        `json:"amount"`
+		DisplayAmount string        `json:"display_amount"`
+		MinReceived   string        `json:"min_received"`
+		MaxSlippage   int64         `json:"max_slippage_bps"`
+		ChainID       chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	amount, ok := tokenAmount(request.Amount, request.DisplayAmount)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
+	guard, ok := receiveGuard(request.MinReceived, request.MaxSlippage)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	if !chainAddresses(c, chain, &request.Token, &request.From, &request.To) {
+		return
+	}
+
+	check, err := services.CheckTokenTransfer(chain, request.Token, request.From, request.To, amount, guard)
+	if err != nil {
+		respondTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, check)
+}
+
+func TransferERC20(c *gin.Context) {
+	var request struct {
+		Token         string        `json:"token"`
+		To            string        `json:"to"`
+		Amount        string        `json:"amount"`
+		DisplayAmount string        `json:"display_amount"`
+		MinReceived   string        `json:"min_received"`
+		MaxSlippage   int64         `json:"max_slippage_bps"`
+		ChainID       chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	amount, ok := tokenAmount(request.Amount, request.DisplayAmount)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
+	guard, ok := receiveGuard(request.MinReceived, request.MaxSlippage)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	if !chainAddresses(c, chain, &request.Token, &request.To) {
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(nil))
+	if !ok {
+		return
+	}
+
+	txHash, check, err := services.TransferERC20(chain, request.Token, request.To, amount, guard)
+	if err != nil {
+		refund()
+		respondTokenError(c, err)
+		return
+	}
+
+	response := gin.H{"transaction_hash": txHash, "check": check}
+	if names := resolvedNames(c); len(names) > 0 {
+		response["resolved_names"] = names
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func TransferFromERC20(c *gin.Context) {
+	var request struct {
+		Token         string        `json:"token"`
+		From          string        `json:"from"`
+		To            string        `json:"to"`
+		Amount        string        `json:"amount"`
+		DisplayAmount string        `json:"display_amount"`
+		MinReceived   string        `json:"min_received"`
+		MaxSlippage   int64         `json:"max_slippage_bps"`
+		ChainID       chainSelector `json:"chain_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	amount, ok := tokenAmount(request.Amount, request.DisplayAmount)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
+	guard, ok := receiveGuard(request.MinReceived, request.MaxSlippage)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
+	chain, ok := requestChain(c, request.ChainID)
+	if !ok {
+		return
+	}
+
+	if !chainAddresses(c, chain, &request.Token, &request.From, &request.To) {
+		return
+	}
+
+	refund, ok := chargeQuota(c, sendCharge(nil))
+	if !ok {
+		return
+	}
+
+	txHash, check, err := services.TransferFromERC20(chain, request.Token, request.From, request.To, amount, guard)
+	if err != nil {
+		refund()
+		respondTokenError(c, err)
+		return
+	}
+
+	response := gin.H{"transaction_hash": txHash, "check": check}
+	if names := resolvedNames(c); len(names) > 0 {
+		response["resolved_names"] = names
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func respondTokenError(c *gin.Context, err error) {
+	var allowanceErr *services.AllowanceError
+	if errors.As(err, &allowanceErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":     i18n.T(language(c), allowanceErr.Reason),
+			"available": allowanceErr.Available.String(),
+			"required":  allowanceErr.Required.String(),
+			"shortfall": new(big.Int).Sub(allowanceErr.Required, allowanceErr.Available).String(),
+		})
+		return
+	}
+
+	var slippageErr *services.SlippageError
+	if errors.As(err, &slippageErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":        i18n.T(language(c), "recipient would receive less than the minimum"),
+			"sent":         slippageErr.Sent.String(),
+			"received":     slippageErr.Received.String(),
+			"min_received": slippageErr.Minimum.String(),
+			"delta":        new(big.Int).Sub(slippageErr.Sent, slippageErr.Received).String(),
+		})
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrInvalidTokenAddress), errors.Is(err, services.ErrInvalidTokenOwner),
+		errors.Is(err, services.ErrTokenNoCode),
+		errors.Is(err, services.ErrNotERC20), errors.Is(err, services.ErrAmountPrecision),
+		errors.Is(err, services.ErrInvalidSlippage):
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, services.ErrTransferWouldRevert), errors.Is(err, services.ErrReceivedUnverified):
+		respondError(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	respondSendError(c, errorStatus(err, http.StatusInternalServerError), err)
+}
+
+// tokenAmount accepts exactly one of a base-unit amount and a whole-token
+// display amount; the latter is converted once the token's decimals are known.
+func tokenAmount(amount, display string) (services.TokenAmount, bool) {
+	if (amount == "") == (display == "") {
+		return services.TokenAmount{}, false
+	}
+	if display != "" {
+		return services.TokenAmount{Display: display}, true
+	}
+
+	base, ok := parseAmount(amount)
+	return services.TokenAmount{Base: base}, ok
+}
+
+// receiveGuard builds the optional minimum-received guard of a token send.
+func receiveGuard(minReceived string, maxSlippageBPS int64) (services.ReceiveGuard, bool) {
+	guard := services.ReceiveGuard{MaxSlippageBPS: maxSlippageBPS}
+	if minReceived != "" {
+		var ok bool
+		if guard.MinReceived, ok = parseAmount(minReceived); !ok {
+			return guard, false
+		}
+	}
+
+	return guard, true
+}
+
+func parseAmount(value string) (*big.Int, bool) {
+	amount, ok := new(big.Int).SetString(value, 10)
+	if !ok || amount.Sign() < 0 {
+		return nil, false
+	}
+
+	return amount, true
+}
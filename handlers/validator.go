@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/bls"
+	"github.com/jabbala-dev/go-wallet/hdwallet"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+func ListValidatorKeys(c *gin.Context) {
+	keys, err := services.ListValidatorKeys()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// CreateValidatorKeys creates validator keys, random or derived from a
+// mnemonic, each in a keystore under the given password.
+func CreateValidatorKeys(c *gin.Context) {
+	var request struct {
+		Password   string `json:"password"`
+		Mnemonic   string `json:"mnemonic"`
+		Passphrase string `json:"passphrase"`
+		StartIndex uint32 `json:"start_index"`
+		Count      int    `json:"count"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	keys, err := services.CreateValidatorKeys(request.Password, request.Mnemonic, request.Passphrase, request.StartIndex, request.Count)
+	if err != nil {
+		respondError(c, validatorErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// ImportValidatorKeystore adds an EIP-2335 keystore given with its
+// password.
+func ImportValidatorKeystore(c *gin.Context) {
+	var request struct {
+		Keystore bls.Keystore `json:"keystore"`
+		Password string       `json:"password"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	key, err := services.ImportValidatorKeystore(request.Keystore, request.Password)
+	if err != nil {
+		respondError(c, validatorErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// GetValidatorKeystore returns a key's EIP-2335 keystore, still encrypted,
+// for a validator client to import.
+func GetValidatorKeystore(c *gin.Context) {
+	keystore, err := services.ValidatorKeystore(c.Param("pubkey"))
+	if err != nil {
+		respondError(c, validatorErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, keystore)
+}
+
+// SignDeposit signs a validator's deposit data.
+func SignDeposit(c *gin.Context) {
+	var request struct {
+		Password string `json:"password"`
+		services.DepositRequest
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	deposit, err := services.SignDeposit(c.Param("pubkey"), request.Password, request.DepositRequest)
+	if err != nil {
+		refund()
+		respondError(c, validatorErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, deposit)
+}
+
+// SignVoluntaryExit signs a validator's voluntary exit, for the caller to
+// submit to a beacon node.
+func SignVoluntaryExit(c *gin.Context) {
+	var request struct {
+		Password       string  `json:"password"`
+		Network        string  `json:"network"`
+		ValidatorIndex *uint64 `json:"validator_index"`
+		Epoch          uint64  `json:"epoch"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if request.ValidatorIndex == nil {
+		respondError(c, http.StatusBadRequest, "validator_index is required")
+		return
+	}
+
+	refund, ok := chargeQuota(c, signCharge)
+	if !ok {
+		return
+	}
+
+	exit, err := services.SignVoluntaryExit(c.Param("pubkey"), request.Password, request.Network, *request.ValidatorIndex, request.Epoch)
+	if err != nil {
+		refund()
+		respondError(c, validatorErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, exit)
+}
+
+func validatorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidValidatorRequest), errors.Is(err, hdwallet.ErrInvalidMnemonic):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrValidatorKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrValidatorKeyExists):
+		return http.StatusConflict
+	}
+
+	return errorStatus(err, http.StatusInternalServerError)
+}
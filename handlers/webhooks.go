@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jabbala-dev/go-wallet/services"
+)
+
+// CreateWebhook subscribes a URL to wallet events. The response carries the
+// webhook's signing secret, which is not shown again.
+func CreateWebhook(c *gin.Context) {
+	var request services.Webhook
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	webhook, err := services.CreateWebhook(request)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+var webhookList = listSpec{
+	fields: map[string]int{
+		"id": fieldText, "url": fieldText, "description": fieldText, "accounts": fieldList,
+		"chain_ids": fieldList, "events": fieldList, "created_at": fieldTime,
+	},
+	key:  "id",
+	sort: "created_at",
+}
+
+func ListWebhooks(c *gin.Context) {
+	query, ok := listQueryFrom(c, webhookList)
+	if !ok {
+		return
+	}
+
+	webhooks, err := services.ListWebhooks()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	webhooks, next, err := pageList(query, webhooks)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	items, err := query.selectFields(webhooks)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": items, "next_cursor": next})
+}
+
+func GetWebhook(c *gin.Context) {
+	webhook, err := services.GetWebhook(c.Param("id"))
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+func UpdateWebhook(c *gin.Context) {
+	var request services.Webhook
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	webhook, err := services.UpdateWebhook(c.Param("id"), request)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+func DeleteWebhook(c *gin.Context) {
+	if err := services.DeleteWebhook(c.Param("id")); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": c.Param("id")})
+}
+
+func RotateWebhookSecret(c *gin.Context) {
+	webhook, err := services.RotateWebhookSecret(c.Param("id"))
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+func ListWebhookDeliveries(c *gin.Context) {
+	filter := services.DeliveryFilter{Status: c.Query("status")}
+
+	if since := c.Query("since"); since != "" {
+		var err error
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid since timestamp")
+			return
+		}
+	}
+
+	deliveries, err := services.ListWebhookDeliveries(c.Param("id"), filter)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = []*services.WebhookDelivery{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// ReplayWebhookDeliveries re-sends the listed deliveries, or every delivery
+// matching status and since (by default, every failed one).
+func ReplayWebhookDeliveries(c *gin.Context) {
+	var request struct {
+		DeliveryIDs []string  `json:"delivery_ids"`
+		Status      string    `json:"status"`
+		Since       time.Time `json:"since"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	replayed, err := services.ReplayWebhookDeliveries(c.Param("id"), services.DeliveryFilter{
+		IDs:    request.DeliveryIDs,
+		Status: request.Status,
+		Since:  request.Since,
+	})
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed})
+}
+
+func respondWebhookError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound), errors.Is(err, services.ErrDeliveryNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidWebhook):
+		status = http.StatusBadRequest
+	}
+
+	respondError(c, status, err.Error())
+}
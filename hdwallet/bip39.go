@@ -0,0 +1,98 @@
+package hdwallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// english.txt is the BIP-39 English wordlist.
+//
+//go:embed english.txt
+var englishWords string
+
+var (
+	wordlist  = strings.Fields(englishWords)
+	wordIndex = func() map[string]int {
+		index := make(map[string]int, len(wordlist))
+		for i, word := range wordlist {
+			index[word] = i
+		}
+		return index
+	}()
+)
+
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// GenerateMnemonic returns a new BIP-39 mnemonic of 12, 15, 18, 21 or 24
+// words from the English wordlist.
+func GenerateMnemonic(words int) (string, error) {
+	if words < 12 || words > 24 || words%3 != 0 {
+		return "", fmt.Errorf("%w: a mnemonic has 12, 15, 18, 21 or 24 words", ErrInvalidMnemonic)
+	}
+
+	entropy := make([]byte, words*4/3)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+
+	return entropyToMnemonic(entropy), nil
+}
+
+// ValidateMnemonic checks that every word is on the English wordlist and
+// that the checksum matches.
+func ValidateMnemonic(mnemonic string) error {
+	words := strings.Fields(norm.NFKD.String(mnemonic))
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return fmt.Errorf("%w: a mnemonic has 12, 15, 18, 21 or 24 words, not %d", ErrInvalidMnemonic, len(words))
+	}
+
+	bits := new(big.Int)
+	for i, word := range words {
+		index, ok := wordIndex[strings.ToLower(word)]
+		if !ok {
+			return fmt.Errorf("%w: word %d, %q, is not on the wordlist", ErrInvalidMnemonic, i+1, word)
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(int64(index)))
+	}
+
+	// Every three words carry 32 bits of entropy and one of checksum.
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(bits, big.NewInt(int64(1)<<checksumBits-1))
+	entropy := new(big.Int).Rsh(bits, checksumBits).FillBytes(make([]byte, len(words)*4/3))
+
+	if checksum.Cmp(entropyChecksum(entropy, checksumBits)) != 0 {
+		return fmt.Errorf("%w: the checksum does not match; check the words and their order", ErrInvalidMnemonic)
+	}
+
+	return nil
+}
+
+func entropyToMnemonic(entropy []byte) string {
+	checksumBits := uint(len(entropy) / 4)
+	bits := new(big.Int).SetBytes(entropy)
+	bits.Lsh(bits, checksumBits)
+	bits.Or(bits, entropyChecksum(entropy, checksumBits))
+
+	words := make([]string, (len(entropy)*8+int(checksumBits))/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = wordlist[new(big.Int).And(bits, mask).Int64()]
+		bits.Rsh(bits, 11)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// entropyChecksum is the first n bits of the entropy's SHA-256.
+func entropyChecksum(entropy []byte, n uint) *big.Int {
+	hash := sha256.Sum256(entropy)
+	return big.NewInt(int64(hash[0] >> (8 - n)))
+}
@@ -0,0 +1,85 @@
+package hdwallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// BIP-39 English vectors, with the passphrase TREZOR.
+var bip39Vectors = []struct {
+	entropy  string
+	mnemonic string
+	seed     string
+}{
+	{
+		entropy:  "00000000000000000000000000000000",
+		mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		seed:     "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		entropy:  "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		mnemonic: "legal winner thank year wave sausage worth useful legal winner thank yellow",
+		seed:     "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+	},
+	{
+		entropy:  "ffffffffffffffffffffffffffffffff",
+		mnemonic: "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+		seed:     "ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+	},
+	{
+		entropy:  "0000000000000000000000000000000000000000000000000000000000000000",
+		mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+		seed:     "bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+	},
+}
+
+func TestBIP39Vectors(t *testing.T) {
+	for _, test := range bip39Vectors {
+		entropy, _ := hex.DecodeString(test.entropy)
+		if got := entropyToMnemonic(entropy); got != test.mnemonic {
+			t.Errorf("entropy %s:\n got %s\nwant %s", test.entropy, got, test.mnemonic)
+		}
+		if err := ValidateMnemonic(test.mnemonic); err != nil {
+			t.Errorf("%s: %v", test.mnemonic, err)
+		}
+		if got := hex.EncodeToString(MnemonicToSeed(test.mnemonic, "TREZOR")); got != test.seed {
+			t.Errorf("seed of %s:\n got %s\nwant %s", test.mnemonic, got, test.seed)
+		}
+	}
+}
+
+func TestValidateMnemonicRejects(t *testing.T) {
+	for _, mnemonic := range []string{
+		// Bad checksum.
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		// Not on the wordlist.
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon bitcoinz",
+		// Too short.
+		"abandon abandon abandon about",
+	} {
+		if err := ValidateMnemonic(mnemonic); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("%q: got %v, want ErrInvalidMnemonic", mnemonic, err)
+		}
+	}
+}
+
+func TestGenerateMnemonic(t *testing.T) {
+	for _, words := range []int{12, 15, 18, 21, 24} {
+		mnemonic, err := GenerateMnemonic(words)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(strings.Fields(mnemonic)); got != words {
+			t.Errorf("asked for %d words, got %d", words, got)
+		}
+		if err := ValidateMnemonic(mnemonic); err != nil {
+			t.Errorf("generated %q: %v", mnemonic, err)
+		}
+	}
+
+	if _, err := GenerateMnemonic(13); !errors.Is(err, ErrInvalidMnemonic) {
+		t.Errorf("13 words: got %v, want ErrInvalidMnemonic", err)
+	}
+}
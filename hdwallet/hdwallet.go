@@ -0,0 +1,296 @@
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	HardenedOffset uint32 = 0x80000000
+
+	// DefaultBasePath is the BIP-44 Ethereum path; account i is DefaultBasePath/i.
+	DefaultBasePath = "m/44'/60'/0'/0"
+
+	// DefaultAccountPath is the BIP-44 account level whose xpub is exported.
+	// Receive addresses are its external chain, DefaultAccountPath/0/i.
+	DefaultAccountPath = "m/44'/60'/0'"
+)
+
+// Mainnet version bytes for serialised extended keys.
+var (
+	versionPrivate = []byte{0x04, 0x88, 0xad, 0xe4}
+	versionPublic  = []byte{0x04, 0x88, 0xb2, 0x1e}
+)
+
+var (
+	ErrInvalidPath      = errors.New("invalid derivation path")
+	ErrInvalidKey       = errors.New("invalid extended key")
+	ErrHardenedFromPub  = errors.New("cannot derive a hardened child from a public key")
+	ErrNotPrivate       = errors.New("extended key has no private part")
+	errMaxDepthExceeded = errors.New("maximum derivation depth reached")
+)
+
+// ExtendedKey is a BIP-32 extended key. Public keys hold the compressed
+// point in key; private keys hold the 32-byte scalar.
+type ExtendedKey struct {
+	key         []byte
+	chainCode   []byte
+	depth       uint8
+	parent      [4]byte
+	childNumber uint32
+	private     bool
+}
+
+// MnemonicToSeed derives the BIP-39 seed for a mnemonic and optional
+// passphrase. It does not validate the mnemonic's wordlist or checksum.
+func MnemonicToSeed(mnemonic, passphrase string) []byte {
+	mnemonic = norm.NFKD.String(strings.Join(strings.Fields(mnemonic), " "))
+	salt := norm.NFKD.String("mnemonic" + passphrase)
+
+	return pbkdf2.Key([]byte(mnemonic), []byte(salt), 2048, 64, sha512.New)
+}
+
+func NewMaster(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, errors.New("seed must be between 16 and 64 bytes")
+	}
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	if !validScalar(sum[:32]) {
+		return nil, errors.New("invalid master key")
+	}
+
+	return &ExtendedKey{key: sum[:32], chainCode: sum[32:], private: true}, nil
+}
+
+// ParseExtendedKey decodes a serialised xprv or xpub.
+func ParseExtendedKey(encoded string) (*ExtendedKey, error) {
+	payload, err := base58CheckDecode(strings.TrimSpace(encoded))
+	if err != nil || len(payload) != 78 {
+		return nil, ErrInvalidKey
+	}
+
+	k := &ExtendedKey{
+		depth:       payload[4],
+		childNumber: binary.BigEndian.Uint32(payload[9:13]),
+		chainCode:   append([]byte{}, payload[13:45]...),
+	}
+	copy(k.parent[:], payload[5:9])
+
+	version := payload[:4]
+	switch {
+	case string(version) == string(versionPrivate) && payload[45] == 0 && validScalar(payload[46:]):
+		k.private = true
+		k.key = append([]byte{}, payload[46:]...)
+	case string(version) == string(versionPublic):
+		if _, err := crypto.DecompressPubkey(payload[45:]); err != nil {
+			return nil, ErrInvalidKey
+		}
+		k.key = append([]byte{}, payload[45:]...)
+	default:
+		return nil, ErrInvalidKey
+	}
+
+	return k, nil
+}
+
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if k.depth == 255 {
+		return nil, errMaxDepthExceeded
+	}
+	if index >= HardenedOffset && !k.private {
+		return nil, ErrHardenedFromPub
+	}
+
+	var data []byte
+	if index >= HardenedOffset {
+		data = append([]byte{0}, k.key...)
+	} else {
+		data = k.publicKeyBytes()
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	if !validScalar(sum[:32]) {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+
+	child := &ExtendedKey{
+		chainCode:   sum[32:],
+		depth:       k.depth + 1,
+		parent:      k.Fingerprint(),
+		childNumber: index,
+		private:     k.private,
+	}
+
+	curve := crypto.S256()
+	if k.private {
+		scalar := new(big.Int).SetBytes(sum[:32])
+		scalar.Add(scalar, new(big.Int).SetBytes(k.key))
+		scalar.Mod(scalar, curve.Params().N)
+		if scalar.Sign() == 0 {
+			return nil, fmt.Errorf("invalid child key at index %d", index)
+		}
+		child.key = scalar.FillBytes(make([]byte, 32))
+		return child, nil
+	}
+
+	parent, err := crypto.DecompressPubkey(k.key)
+	if err != nil {
+		return nil, err
+	}
+	x, y := curve.ScalarBaseMult(sum[:32])
+	x, y = curve.Add(x, y, parent.X, parent.Y)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	child.key = crypto.CompressPubkey(&ecdsa.PublicKey{Curve: curve, X: x, Y: y})
+
+	return child, nil
+}
+
+// Derive walks a path such as "m/44'/60'/0'/0/0" from k.
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := k
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// Neuter returns the public half of k.
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.private {
+		return k
+	}
+
+	return &ExtendedKey{
+		key:         k.publicKeyBytes(),
+		chainCode:   k.chainCode,
+		depth:       k.depth,
+		parent:      k.parent,
+		childNumber: k.childNumber,
+	}
+}
+
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.private
+}
+
+func (k *ExtendedKey) Depth() uint8 {
+	return k.depth
+}
+
+func (k *ExtendedKey) PrivateKey() (*ecdsa.PrivateKey, error) {
+	if !k.private {
+		return nil, ErrNotPrivate
+	}
+
+	return crypto.ToECDSA(k.key)
+}
+
+func (k *ExtendedKey) PublicKey() *ecdsa.PublicKey {
+	publicKey, _ := crypto.DecompressPubkey(k.publicKeyBytes())
+	return publicKey
+}
+
+func (k *ExtendedKey) Address() common.Address {
+	return crypto.PubkeyToAddress(*k.PublicKey())
+}
+
+// Fingerprint is the first four bytes of HASH160 of the public key.
+func (k *ExtendedKey) Fingerprint() [4]byte {
+	sha := sha256.Sum256(k.publicKeyBytes())
+	hash := ripemd160.New()
+	hash.Write(sha[:])
+
+	var fingerprint [4]byte
+	copy(fingerprint[:], hash.Sum(nil))
+	return fingerprint
+}
+
+// String serialises k as an xprv or xpub.
+func (k *ExtendedKey) String() string {
+	payload := make([]byte, 0, 78)
+	if k.private {
+		payload = append(payload, versionPrivate...)
+	} else {
+		payload = append(payload, versionPublic...)
+	}
+	payload = append(payload, k.depth)
+	payload = append(payload, k.parent[:]...)
+	payload = binary.BigEndian.AppendUint32(payload, k.childNumber)
+	payload = append(payload, k.chainCode...)
+	if k.private {
+		payload = append(payload, 0)
+	}
+	payload = append(payload, k.key...)
+
+	return base58CheckEncode(payload)
+}
+
+func (k *ExtendedKey) publicKeyBytes() []byte {
+	if !k.private {
+		return k.key
+	}
+
+	privateKey, _ := crypto.ToECDSA(k.key)
+	return crypto.CompressPubkey(&privateKey.PublicKey)
+}
+
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, ErrInvalidPath
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		part = strings.TrimRight(part, "'h")
+
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedOffset {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPath, path)
+		}
+		if hardened {
+			index += uint64(HardenedOffset)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+
+	return indexes, nil
+}
+
+func validScalar(b []byte) bool {
+	scalar := new(big.Int).SetBytes(b)
+	return scalar.Sign() > 0 && scalar.Cmp(crypto.S256().Params().N) < 0
+}
@@ -0,0 +1,97 @@
+package hdwallet
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// BIP-32 test vector 1.
+func TestBIP32Vector1(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMaster(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		path string
+		xprv string
+		xpub string
+	}{
+		{
+			path: "m",
+			xprv: "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+			xpub: "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8",
+		},
+		{
+			path: "m/0'/1/2'/2/1000000000",
+			xprv: "xprvA41z7zogVVwxVSgdKUHDy1SKmdb533PjDz7J6N6mV6uS3ze1ai8FHa8kmHScGpWmj4WggLyQjgPie1rFSruoUihUZREPSL39UNdE3BBDu76",
+			xpub: "xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy",
+		},
+	} {
+		key, err := master.Derive(test.path)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if got := key.String(); got != test.xprv {
+			t.Errorf("%s xprv:\n got %s\nwant %s", test.path, got, test.xprv)
+		}
+		if got := key.Neuter().String(); got != test.xpub {
+			t.Errorf("%s xpub:\n got %s\nwant %s", test.path, got, test.xpub)
+		}
+
+		for _, encoded := range []string{test.xprv, test.xpub} {
+			parsed, err := ParseExtendedKey(encoded)
+			if err != nil {
+				t.Fatalf("%s: parse %s: %v", test.path, encoded, err)
+			}
+			if got := parsed.String(); got != encoded {
+				t.Errorf("%s: %s does not round-trip, got %s", test.path, encoded, got)
+			}
+		}
+	}
+}
+
+// The non-hardened steps of the path can be taken from the parent's xpub
+// alone.
+func TestBIP32PublicDerivation(t *testing.T) {
+	parent, err := ParseExtendedKey("xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := parent.Child(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err = child.Child(1000000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy"
+	if got := child.String(); got != want {
+		t.Errorf("m/0'/1/2'/2/1000000000 from m/0'/1/2' xpub:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	indexes, err := ParsePath("m/44'/60'/0'/0/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint32{HardenedOffset + 44, HardenedOffset + 60, HardenedOffset, 0, 7}
+	if len(indexes) != len(want) {
+		t.Fatalf("got %v, want %v", indexes, want)
+	}
+	for i := range want {
+		if indexes[i] != want[i] {
+			t.Fatalf("got %v, want %v", indexes, want)
+		}
+	}
+
+	for _, path := range []string{"", "44'/60'", "m/x", "m/2147483648"} {
+		if _, err := ParsePath(path); err == nil {
+			t.Errorf("%q was accepted", path)
+		}
+	}
+}
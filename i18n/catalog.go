@@ -0,0 +1,416 @@
+package i18n
+
+var builtinCatalogs = map[string]map[string]string{
+	"es": {
+		// API errors
+		"Invalid request":                          "Solicitud no válida",
+		"Invalid since timestamp":                  "Marca de tiempo 'since' no válida",
+		"Invalid until timestamp":                  "Marca de tiempo 'until' no válida",
+		"no account is selected":                   "no hay ninguna cuenta seleccionada",
+		"account not found":                        "cuenta no encontrada",
+		"invalid recipient address":                "dirección de destinatario no válida",
+		"transaction preview not found or expired": "vista previa de transacción no encontrada o caducada",
+
+		// Transaction preview
+		"Send %s wei from %s to %s with a network fee of up to %s wei (total %s wei)": "Enviar %s wei de %s a %s con una comisión de red de hasta %s wei (total %s wei)",
+
+		// UI
+		"Blockchain Wallet":       "Billetera Blockchain",
+		"Account":                 "Cuenta",
+		"New account name":        "Nombre de la nueva cuenta",
+		"New Account":             "Nueva cuenta",
+		"Generate Key Pair":       "Generar par de claves",
+		"Receive":                 "Recibir",
+		"Send Transaction":        "Enviar transacción",
+		"Recipient Address":       "Dirección del destinatario",
+		"Value (in Wei)":          "Valor (en Wei)",
+		"Preview":                 "Vista previa",
+		"From":                    "De",
+		"To":                      "Para",
+		"Value (Wei)":             "Valor (Wei)",
+		"Gas Limit":               "Límite de gas",
+		"Gas Price (Wei)":         "Precio del gas (Wei)",
+		"Fee (Wei)":               "Comisión (Wei)",
+		"Total (Wei)":             "Total (Wei)",
+		"Approve & Send":          "Aprobar y enviar",
+		"Reject":                  "Rechazar",
+		"History":                 "Historial",
+		"All statuses":            "Todos los estados",
+		"Pending":                 "Pendiente",
+		"Confirmed":               "Confirmada",
+		"Failed":                  "Fallida",
+		"Filter by address":       "Filtrar por dirección",
+		"Refresh":                 "Actualizar",
+		"Time":                    "Hora",
+		"Hash":                    "Hash",
+		"Status":                  "Estado",
+		"Sign Message":            "Firmar mensaje",
+		"Enter message to sign":   "Introduzca el mensaje a firmar",
+		"Sign":                    "Firmar",
+		"Verify Message":          "Verificar mensaje",
+		"Enter message to verify": "Introduzca el mensaje a verificar",
+		"Enter signature":         "Introduzca la firma",
+		"Verify":                  "Verificar",
+		"Error":                   "Error",
+		"Address":                 "Dirección",
+		"Private Key":             "Clave privada",
+		"Signature":               "Firma",
+		"Valid":                   "Válida",
+		"Created":                 "Creada",
+		"Transaction Hash":        "Hash de la transacción",
+		"Transaction rejected":    "Transacción rechazada",
+		"Preview expires at":      "La vista previa caduca a las",
+		"No account yet. Create or generate one above.": "Aún no hay cuentas. Cree o genere una arriba.",
+
+		// Scheduled transactions
+		"scheduled transaction not found":                 "transacción programada no encontrada",
+		"scheduled transaction has already been released": "la transacción programada ya ha sido liberada",
+		"not_before or not_before_block is required":      "se requiere not_before o not_before_block",
+		"release time must be in the future":              "el momento de liberación debe estar en el futuro",
+
+		// Tokens
+		"Invalid amount":             "Importe no válido",
+		"invalid token address":      "dirección de token no válida",
+		"invalid owner address":      "dirección del propietario no válida",
+		"insufficient allowance":     "autorización insuficiente",
+		"insufficient owner balance": "saldo del propietario insuficiente",
+
+		// Gas estimation
+		"Invalid data": "Datos no válidos",
+
+		// RPC
+		"RPC endpoint unavailable: circuit breaker open": "Endpoint RPC no disponible: disyuntor abierto",
+
+		// Funds
+		"insufficient funds for value and network fee": "fondos insuficientes para el valor y la comisión de red",
+
+		// Key ceremonies
+		"Invalid entropy":                                   "Entropía no válida",
+		"key ceremony not found":                            "ceremonia de claves no encontrada",
+		"key ceremony has already completed":                "la ceremonia de claves ya ha finalizado",
+		"key ceremony does not have the required approvals": "la ceremonia de claves no tiene las aprobaciones necesarias",
+		"operator is not part of this ceremony":             "el operador no forma parte de esta ceremonia",
+		"operator has already approved this ceremony":       "el operador ya ha aprobado esta ceremonia",
+
+		// Alerts
+		"alert not found":                   "alerta no encontrada",
+		"alert does not hold a transaction": "la alerta no retiene ninguna transacción",
+		"unusual send held for approval":    "envío inusual retenido para aprobación",
+
+		// HD accounts
+		"HD account not found":                           "cuenta HD no encontrada",
+		"invalid xpub":                                   "xpub no válida",
+		"A mnemonic or an xpub is required":              "Se requiere una mnemónica o una xpub",
+		"An address or an xpub is required":              "Se requiere una dirección o una xpub",
+		"Give an owner or all, not both":                 "Indique owner o all, no ambos",
+		"Provide either a mnemonic or an xpub, not both": "Indique una mnemónica o una xpub, no ambas",
+		"Invalid gap limit":                              "Límite de huecos no válido",
+
+		// Chains
+		"invalid address":              "dirección no válida",
+		"unknown chain":                "cadena desconocida",
+		"address is for another chain": "la dirección es de otra cadena",
+
+		// Token authorizations
+		"authorization nonce has already been used":                      "el nonce de la autorización ya se ha usado",
+		"authorization has expired":                                      "la autorización ha caducado",
+		"authorization is not valid yet":                                 "la autorización aún no es válida",
+		"authorization signature does not match its signer":              "la firma de la autorización no coincide con su firmante",
+		"amount must be positive":                                        "el importe debe ser positivo",
+		"token does not support EIP-3009 authorizations":                 "el token no admite autorizaciones EIP-3009",
+		"a receive authorization can only be submitted by its recipient": "una autorización de recepción solo puede enviarla su destinatario",
+
+		// Token checks
+		"insufficient token balance": "saldo de tokens insuficiente",
+		"token has no contract code; it was never deployed or has self-destructed":                     "el token no tiene código de contrato; nunca se desplegó o se ha autodestruido",
+		"recipient would receive less than the minimum":                                                "el destinatario recibiría menos del mínimo",
+		"the amount received could not be simulated, so the minimum-received guard cannot be enforced": "no se pudo simular el importe recibido, por lo que no se puede aplicar el mínimo a recibir",
+
+		// Webhooks
+		"webhook not found":          "webhook no encontrado",
+		"webhook delivery not found": "entrega de webhook no encontrada",
+
+		// Authentication
+		"Authentication required":          "Se requiere autenticación",
+		"Invalid or expired credentials":   "Credenciales no válidas o caducadas",
+		"Insufficient scope":               "Permiso insuficiente",
+		"Sign-in was cancelled or refused": "El inicio de sesión se canceló o se rechazó",
+		"Access denied from this address":  "Acceso denegado desde esta dirección",
+		"Authentication is not enabled":    "La autenticación no está activada",
+
+		// ENS
+		"%s resolved to %s from its %s record":                    "%s se resolvió a %s a partir de su registro %s",
+		"served by the gateway %s and verified by the resolver":   "servido por el gateway %s y verificado por el resolver",
+		"It is a DNS name, in ENS by proof of its DNSSEC records": "Es un nombre DNS, incluido en ENS mediante la prueba de sus registros DNSSEC",
+		"Resolved from":                       "Resuelto desde",
+		"Invalid mnemonic length":             "Longitud de mnemónico no válida",
+		"Invalid duration":                    "Duración no válida",
+		"The address has no primary ENS name": "La dirección no tiene un nombre ENS principal",
+
+		// Smart accounts
+		"Invalid salt": "Salt no válido",
+
+		// Keystore
+		"Password":       "Contraseña",
+		"Unlock":         "Desbloquear",
+		"Unlocked until": "Desbloqueada hasta",
+		"Locked":         "Bloqueada",
+
+		// Accounts
+		"Rename":  "Renombrar",
+		"Renamed": "Renombrada",
+		"Delete":  "Eliminar",
+		"Deleted": "Eliminada",
+		"Delete this account and its key? This cannot be undone.": "¿Eliminar esta cuenta y su clave? No se puede deshacer.",
+
+		// Transaction fees
+		"Invalid fee": "Comisión no válida",
+
+		// Address book
+		"Invalid chain ID": "ID de cadena no válido",
+
+		// Snapshots
+		"Invalid block number": "Número de bloque no válido",
+
+		// Cost basis
+		"Invalid at timestamp": "Marca de tiempo 'at' no válida",
+
+		// Memos
+		"A memo cannot be sent with data": "No se puede enviar una nota junto con datos",
+
+		// Message signing
+		"unknown signature scheme": "esquema de firma desconocido",
+		"invalid typed data":       "datos tipados no válidos",
+		"invalid signature":        "firma no válida",
+
+		// Jobs
+		"invalid job":            "trabajo no válido",
+		"job not found":          "trabajo no encontrado",
+		"job is already running": "el trabajo ya se está ejecutando",
+		"job is paused":          "el trabajo está en pausa",
+		"statement not found":    "extracto no encontrado",
+
+		// Configuration
+		"invalid configuration": "configuración no válida",
+
+		// Maintenance
+		"the wallet is not in maintenance":           "la cartera no está en mantenimiento",
+		"too many requests are held for maintenance": "hay demasiadas solicitudes retenidas por mantenimiento",
+		"held request not found":                     "solicitud retenida no encontrada",
+		"held request is no longer queued":           "la solicitud retenida ya no está en cola",
+		"invalid maintenance":                        "mantenimiento no válido",
+		"Request body too large":                     "Cuerpo de la solicitud demasiado grande",
+
+		// Validator keys
+		"validator_index is required":  "se requiere validator_index",
+		"validator key not found":      "clave de validador no encontrada",
+		"validator key already exists": "la clave de validador ya existe",
+		"invalid validator request":    "solicitud de validador no válida",
+	},
+	"de": {
+		// API errors
+		"Invalid request":                          "Ungültige Anfrage",
+		"Invalid since timestamp":                  "Ungültiger 'since'-Zeitstempel",
+		"Invalid until timestamp":                  "Ungültiger 'until'-Zeitstempel",
+		"no account is selected":                   "Es ist kein Konto ausgewählt",
+		"account not found":                        "Konto nicht gefunden",
+		"invalid recipient address":                "Ungültige Empfängeradresse",
+		"transaction preview not found or expired": "Transaktionsvorschau nicht gefunden oder abgelaufen",
+
+		// Transaction preview
+		"Send %s wei from %s to %s with a network fee of up to %s wei (total %s wei)": "%s Wei von %s an %s senden, Netzwerkgebühr bis zu %s Wei (insgesamt %s Wei)",
+
+		// UI
+		"Blockchain Wallet":       "Blockchain-Wallet",
+		"Account":                 "Konto",
+		"New account name":        "Name des neuen Kontos",
+		"New Account":             "Neues Konto",
+		"Generate Key Pair":       "Schlüsselpaar erzeugen",
+		"Receive":                 "Empfangen",
+		"Send Transaction":        "Transaktion senden",
+		"Recipient Address":       "Empfängeradresse",
+		"Value (in Wei)":          "Betrag (in Wei)",
+		"Preview":                 "Vorschau",
+		"From":                    "Von",
+		"To":                      "An",
+		"Value (Wei)":             "Betrag (Wei)",
+		"Gas Limit":               "Gaslimit",
+		"Gas Price (Wei)":         "Gaspreis (Wei)",
+		"Fee (Wei)":               "Gebühr (Wei)",
+		"Total (Wei)":             "Gesamt (Wei)",
+		"Approve & Send":          "Freigeben und senden",
+		"Reject":                  "Ablehnen",
+		"History":                 "Verlauf",
+		"All statuses":            "Alle Status",
+		"Pending":                 "Ausstehend",
+		"Confirmed":               "Bestätigt",
+		"Failed":                  "Fehlgeschlagen",
+		"Filter by address":       "Nach Adresse filtern",
+		"Refresh":                 "Aktualisieren",
+		"Time":                    "Zeit",
+		"Hash":                    "Hash",
+		"Status":                  "Status",
+		"Sign Message":            "Nachricht signieren",
+		"Enter message to sign":   "Zu signierende Nachricht eingeben",
+		"Sign":                    "Signieren",
+		"Verify Message":          "Nachricht prüfen",
+		"Enter message to verify": "Zu prüfende Nachricht eingeben",
+		"Enter signature":         "Signatur eingeben",
+		"Verify":                  "Prüfen",
+		"Error":                   "Fehler",
+		"Address":                 "Adresse",
+		"Private Key":             "Privater Schlüssel",
+		"Signature":               "Signatur",
+		"Valid":                   "Gültig",
+		"Created":                 "Erstellt",
+		"Transaction Hash":        "Transaktionshash",
+		"Transaction rejected":    "Transaktion abgelehnt",
+		"Preview expires at":      "Vorschau läuft ab um",
+		"No account yet. Create or generate one above.": "Noch kein Konto. Legen Sie oben eines an oder erzeugen Sie eines.",
+
+		// Scheduled transactions
+		"scheduled transaction not found":                 "Geplante Transaktion nicht gefunden",
+		"scheduled transaction has already been released": "Die geplante Transaktion wurde bereits freigegeben",
+		"not_before or not_before_block is required":      "not_before oder not_before_block ist erforderlich",
+		"release time must be in the future":              "Der Freigabezeitpunkt muss in der Zukunft liegen",
+
+		// Tokens
+		"Invalid amount":             "Ungültiger Betrag",
+		"invalid token address":      "Ungültige Token-Adresse",
+		"invalid owner address":      "Ungültige Eigentümeradresse",
+		"insufficient allowance":     "Unzureichende Freigabe",
+		"insufficient owner balance": "Unzureichendes Guthaben des Inhabers",
+
+		// Gas estimation
+		"Invalid data": "Ungültige Daten",
+
+		// RPC
+		"RPC endpoint unavailable: circuit breaker open": "RPC-Endpunkt nicht verfügbar: Schutzschalter offen",
+
+		// Funds
+		"insufficient funds for value and network fee": "Unzureichendes Guthaben für Betrag und Netzwerkgebühr",
+
+		// Key ceremonies
+		"Invalid entropy":                                   "Ungültige Entropie",
+		"key ceremony not found":                            "Schlüsselzeremonie nicht gefunden",
+		"key ceremony has already completed":                "Die Schlüsselzeremonie ist bereits abgeschlossen",
+		"key ceremony does not have the required approvals": "Der Schlüsselzeremonie fehlen die erforderlichen Freigaben",
+		"operator is not part of this ceremony":             "Der Operator ist nicht Teil dieser Zeremonie",
+		"operator has already approved this ceremony":       "Der Operator hat diese Zeremonie bereits freigegeben",
+
+		// Alerts
+		"alert not found":                   "Warnung nicht gefunden",
+		"alert does not hold a transaction": "Die Warnung hält keine Transaktion zurück",
+		"unusual send held for approval":    "Ungewöhnliche Überweisung zur Freigabe zurückgehalten",
+
+		// HD accounts
+		"HD account not found":                           "HD-Konto nicht gefunden",
+		"invalid xpub":                                   "ungültiger xpub",
+		"A mnemonic or an xpub is required":              "Eine Mnemonik oder ein xpub ist erforderlich",
+		"An address or an xpub is required":              "Eine Adresse oder ein xpub ist erforderlich",
+		"Give an owner or all, not both":                 "Entweder owner oder all angeben, nicht beides",
+		"Provide either a mnemonic or an xpub, not both": "Entweder eine Mnemonik oder einen xpub angeben, nicht beides",
+		"Invalid gap limit":                              "Ungültiges Lückenlimit",
+
+		// Chains
+		"invalid address":              "ungültige Adresse",
+		"unknown chain":                "unbekannte Chain",
+		"address is for another chain": "die Adresse gehört zu einer anderen Chain",
+
+		// Token authorizations
+		"authorization nonce has already been used":                      "die Nonce der Autorisierung wurde bereits verwendet",
+		"authorization has expired":                                      "die Autorisierung ist abgelaufen",
+		"authorization is not valid yet":                                 "die Autorisierung ist noch nicht gültig",
+		"authorization signature does not match its signer":              "die Signatur der Autorisierung passt nicht zu ihrem Unterzeichner",
+		"amount must be positive":                                        "der Betrag muss positiv sein",
+		"token does not support EIP-3009 authorizations":                 "der Token unterstützt keine EIP-3009-Autorisierungen",
+		"a receive authorization can only be submitted by its recipient": "eine Empfangsautorisierung kann nur von ihrem Empfänger eingereicht werden",
+
+		// Token checks
+		"insufficient token balance": "Unzureichendes Token-Guthaben",
+		"token has no contract code; it was never deployed or has self-destructed":                     "der Token hat keinen Vertragscode; er wurde nie bereitgestellt oder hat sich selbst zerstört",
+		"recipient would receive less than the minimum":                                                "der Empfänger würde weniger als das Minimum erhalten",
+		"the amount received could not be simulated, so the minimum-received guard cannot be enforced": "der empfangene Betrag konnte nicht simuliert werden, daher kann der Mindestbetrag nicht durchgesetzt werden",
+
+		// Webhooks
+		"webhook not found":          "Webhook nicht gefunden",
+		"webhook delivery not found": "Webhook-Zustellung nicht gefunden",
+
+		// Authentication
+		"Authentication required":          "Anmeldung erforderlich",
+		"Invalid or expired credentials":   "Ungültige oder abgelaufene Anmeldedaten",
+		"Insufficient scope":               "Unzureichende Berechtigung",
+		"Sign-in was cancelled or refused": "Die Anmeldung wurde abgebrochen oder abgelehnt",
+		"Access denied from this address":  "Zugriff von dieser Adresse verweigert",
+		"Authentication is not enabled":    "Die Authentifizierung ist nicht aktiviert",
+
+		// ENS
+		"%s resolved to %s from its %s record":                    "%[1]s wurde über seinen %[3]s-Eintrag zu %[2]s aufgelöst",
+		"served by the gateway %s and verified by the resolver":   "vom Gateway %s geliefert und vom Resolver geprüft",
+		"It is a DNS name, in ENS by proof of its DNSSEC records": "Es ist ein DNS-Name, der über den Nachweis seiner DNSSEC-Einträge in ENS ist",
+		"Resolved from":                       "Aufgelöst aus",
+		"Invalid mnemonic length":             "Ungültige Länge der Mnemonik",
+		"Invalid duration":                    "Ungültige Dauer",
+		"The address has no primary ENS name": "Die Adresse hat keinen primären ENS-Namen",
+
+		// Smart accounts
+		"Invalid salt": "Ungültiger Salt",
+
+		// Keystore
+		"Password":       "Passwort",
+		"Unlock":         "Entsperren",
+		"Unlocked until": "Entsperrt bis",
+		"Locked":         "Gesperrt",
+
+		// Accounts
+		"Rename":  "Umbenennen",
+		"Renamed": "Umbenannt",
+		"Delete":  "Löschen",
+		"Deleted": "Gelöscht",
+		"Delete this account and its key? This cannot be undone.": "Dieses Konto und seinen Schlüssel löschen? Das kann nicht rückgängig gemacht werden.",
+
+		// Transaction fees
+		"Invalid fee": "Ungültige Gebühr",
+
+		// Address book
+		"Invalid chain ID": "Ungültige Chain-ID",
+
+		// Snapshots
+		"Invalid block number": "Ungültige Blocknummer",
+
+		// Cost basis
+		"Invalid at timestamp": "Ungültiger 'at'-Zeitstempel",
+
+		// Memos
+		"A memo cannot be sent with data": "Eine Notiz kann nicht zusammen mit Daten gesendet werden",
+
+		// Message signing
+		"unknown signature scheme": "unbekanntes Signaturschema",
+		"invalid typed data":       "ungültige typisierte Daten",
+		"invalid signature":        "ungültige Signatur",
+
+		// Jobs
+		"invalid job":            "ungültiger Job",
+		"job not found":          "Job nicht gefunden",
+		"job is already running": "Job läuft bereits",
+		"job is paused":          "Job ist pausiert",
+		"statement not found":    "Kontoauszug nicht gefunden",
+
+		// Configuration
+		"invalid configuration": "ungültige Konfiguration",
+
+		// Maintenance
+		"the wallet is not in maintenance":           "die Wallet ist nicht im Wartungsmodus",
+		"too many requests are held for maintenance": "zu viele Anfragen werden wegen Wartung zurückgehalten",
+		"held request not found":                     "zurückgehaltene Anfrage nicht gefunden",
+		"held request is no longer queued":           "zurückgehaltene Anfrage ist nicht mehr in der Warteschlange",
+		"invalid maintenance":                        "ungültige Wartung",
+		"Request body too large":                     "Anfragetext zu groß",
+
+		// Validator keys
+		"validator_index is required":  "validator_index ist erforderlich",
+		"validator key not found":      "Validator-Schlüssel nicht gefunden",
+		"validator key already exists": "Validator-Schlüssel existiert bereits",
+		"invalid validator request":    "ungültige Validator-Anfrage",
+	},
+}
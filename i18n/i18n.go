@@ -0,0 +1,145 @@
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+const DefaultLanguage = "en"
+
+var (
+	mu       sync.RWMutex
+	catalogs = map[string]map[string]string{DefaultLanguage: {}}
+	matcher  language.Matcher
+	tags     []string
+)
+
+func init() {
+	for lang, messages := range builtinCatalogs {
+		Register(lang, messages)
+	}
+}
+
+// Register merges messages into the catalog for lang. Keys are the English
+// source strings, so untranslated messages fall back to the original text.
+func Register(lang string, messages map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	catalog, ok := catalogs[lang]
+	if !ok {
+		catalog = map[string]string{}
+		catalogs[lang] = catalog
+	}
+	for key, value := range messages {
+		catalog[key] = value
+	}
+
+	rebuildMatcher()
+}
+
+// LoadDir registers every <lang>.json file in dir as a catalog.
+func LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		lang := strings.TrimSuffix(filepath.Base(file), ".json")
+		if _, err := language.Parse(lang); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		Register(lang, messages)
+	}
+
+	return nil
+}
+
+// Match returns the best supported language for an Accept-Language header.
+func Match(acceptLanguage string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	requested, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(requested) == 0 {
+		return DefaultLanguage
+	}
+
+	_, index, confidence := matcher.Match(requested...)
+	if confidence == language.No {
+		return DefaultLanguage
+	}
+
+	return tags[index]
+}
+
+func T(lang, message string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if translated, ok := catalogs[lang][message]; ok {
+		return translated
+	}
+
+	return message
+}
+
+func Sprintf(lang, format string, args ...interface{}) string {
+	return fmt.Sprintf(T(lang, format), args...)
+}
+
+func Messages(lang string) map[string]string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	messages := make(map[string]string, len(catalogs[lang]))
+	for key, value := range catalogs[lang] {
+		messages[key] = value
+	}
+
+	return messages
+}
+
+func Languages() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return append([]string(nil), tags...)
+}
+
+// rebuildMatcher must be called with mu held. The default language is always
+// first so it wins when nothing better matches.
+func rebuildMatcher() {
+	tags = []string{DefaultLanguage}
+	for lang := range catalogs {
+		if lang != DefaultLanguage {
+			tags = append(tags, lang)
+		}
+	}
+	sort.Strings(tags[1:])
+
+	supported := make([]language.Tag, len(tags))
+	for i, lang := range tags {
+		supported[i] = language.Make(lang)
+	}
+	matcher = language.NewMatcher(supported)
+}
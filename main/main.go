@@ -2,23 +2,311 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jabbala-dev/go-wallet/handlers"
+	"github.com/jabbala-dev/go-wallet/i18n"
+	"github.com/jabbala-dev/go-wallet/services"
 )
 
 func main() {
-	r := gin.Default()
+	if dir := os.Getenv("I18N_DIR"); dir != "" {
+		if err := i18n.LoadDir(dir); err != nil {
+			log.Fatal("Failed to load translations: ", err)
+		}
+	}
+
+	if err := services.InitDataEncryption(); err != nil {
+		log.Fatal("Failed to unlock data: ", err)
+	}
+
+	if err := services.OpenHistoryStore(); err != nil {
+		log.Fatal("Failed to open the transaction history: ", err)
+	}
+
+	if err := services.CheckKeyStoreConfig(); err != nil {
+		log.Fatal("Invalid key store configuration: ", err)
+	}
+
+	if err := services.CheckOIDCConfig(); err != nil {
+		log.Fatal("Invalid OIDC configuration: ", err)
+	}
+
+	if err := services.InitAccessControl(); err != nil {
+		log.Fatal("Failed to load access restrictions: ", err)
+	}
+
+	if err := services.ConfigureIntrusionDetection(); err != nil {
+		log.Fatal("Invalid intrusion detection settings: ", err)
+	}
+
+	if plaintext, err := services.PlaintextKeys(); err != nil {
+		log.Fatal("Failed to read accounts: ", err)
+	} else if len(plaintext) > 0 {
+		log.Printf("Warning: %d account keys are stored unencrypted; move them into the keystore with POST /accounts/encrypt: %v", len(plaintext), plaintext)
+	}
+
+	services.StartScheduler()
+	services.StartIPFSPinner()
+	services.StartFeeRefresher()
+	services.StartRPCHealthChecks()
+	services.StartBroadcaster()
+	services.StartOutbox()
+	services.StartReconciler()
+	services.StartPruner()
+	services.StartJobs()
+	services.StartConfigWatcher()
+	services.StartSIEMExporter()
+	services.StartENSResolver()
+	services.StartReceiptWatcher()
+	services.StartLedger()
+
+	r := gin.New()
+	r.Use(gin.Logger())
+
+	// Answer panics with a 500 and a request ID, and report them
+	r.Use(handlers.RecoverPanics())
+
+	// Optionally sign responses so downstream systems can verify provenance
+	if os.Getenv("SIGN_RESPONSES") == "true" {
+		r.Use(handlers.SignResponses())
+	}
+
+	// Refuse clients the access policy blocks, before they can try credentials
+	r.Use(handlers.RestrictAccess())
+
+	// Require a signed-in user or API key when AUTH_REQUIRED or OIDC is set
+	r.Use(handlers.Authenticate())
+
+	// Hold sends and signatures while the wallet is in maintenance
+	r.Use(handlers.HoldDuringMaintenance())
 
 	// Serve static files
 	r.Static("/public", "./public")
 
 	// Define routes
-	r.GET("/generate", handlers.GenerateKeyPair)
+	r.POST("/generate", handlers.GenerateKeyPair)
 	r.GET("/address", handlers.GetAddress)
 	r.POST("/sign", handlers.SignMessage)
+	r.POST("/sign/typed", handlers.SignTypedData)
+	r.POST("/sign/batch", handlers.SignBatchAttestation)
 	r.POST("/verify", handlers.VerifyMessage)
+	r.POST("/verify/batch", handlers.VerifyBatchAttestation)
+	r.POST("/verify/challenge", handlers.IssueChallenge)
+	r.POST("/verify/consume", handlers.ConsumeChallenge)
+	r.POST("/recover", handlers.RecoverSigner)
 	r.POST("/transaction", handlers.CreateAndSendTransaction)
+	r.POST("/contract/deploy", handlers.DeployContract)
+	r.POST("/contract/:name/call", handlers.CallContract)
+	r.POST("/contract/:name/send", handlers.SendContract)
+	r.GET("/contracts", handlers.ListContracts)
+	r.POST("/contracts", handlers.RegisterContract)
+	r.DELETE("/contracts/:name", handlers.DeleteContract)
+	r.POST("/transaction/build", handlers.BuildTransaction)
+	r.POST("/transaction/sign", handlers.SignTransaction)
+	r.POST("/transaction/broadcast", handlers.BroadcastTransaction)
+	r.POST("/transaction/preview", handlers.PreviewTransaction)
+	r.POST("/transaction/preview/:id/approve", handlers.ApproveTransaction)
+	r.POST("/transaction/preview/:id/reject", handlers.RejectTransaction)
+	r.POST("/transaction/scheduled", handlers.ScheduleTransaction)
+	r.GET("/transaction/scheduled", handlers.ListScheduledTransactions)
+	r.DELETE("/transaction/scheduled/:id", handlers.CancelScheduledTransaction)
+	r.GET("/transaction/:hash", handlers.GetTransactionStatus)
+	r.GET("/transaction/:hash/status", handlers.GetTransactionStatus)
+	r.POST("/transaction/:hash/speedup", handlers.SpeedUpTransaction)
+	r.POST("/transaction/:hash/cancel", handlers.CancelTransaction)
+	r.POST("/payouts", handlers.CreatePayoutBatch)
+	r.GET("/payouts/:id", handlers.GetPayoutBatch)
+	r.DELETE("/payouts/:id", handlers.CancelPayoutBatch)
+	r.GET("/transactions", handlers.ListTransactions)
+	r.GET("/stream", handlers.Stream)
+	r.GET("/queue", handlers.GetQueue)
+	r.GET("/journal", handlers.ListSigningJournal)
+	r.GET("/nonces", handlers.GetNonceStatus)
+	r.GET("/audit", handlers.ListAuditEvents)
+	r.GET("/audit/export", handlers.GetSIEMStatus)
+	r.GET("/retention", handlers.GetRetentionPolicy)
+	r.PUT("/retention", handlers.SetRetentionPolicy)
+	r.POST("/retention/prune", handlers.PruneNow)
+	r.GET("/config/reload", handlers.GetConfigReload)
+	r.POST("/config/reload", handlers.ReloadConfig)
+	r.GET("/maintenance", handlers.GetMaintenance)
+	r.POST("/maintenance/start", handlers.StartMaintenance)
+	r.POST("/maintenance/end", handlers.EndMaintenance)
+	r.GET("/maintenance/held", handlers.ListHeldRequests)
+	r.GET("/maintenance/held/:id", handlers.GetHeldRequest)
+	r.DELETE("/maintenance/held/:id", handlers.CancelHeldRequest)
+	r.GET("/jobs", handlers.ListJobs)
+	r.POST("/jobs", handlers.CreateJob)
+	r.GET("/jobs/:id", handlers.GetJob)
+	r.DELETE("/jobs/:id", handlers.DeleteJob)
+	r.POST("/jobs/:id/run", handlers.RunJob)
+	r.POST("/jobs/:id/pause", handlers.PauseJob)
+	r.POST("/jobs/:id/resume", handlers.ResumeJob)
+	r.GET("/statements", handlers.ListStatements)
+	r.GET("/statements/:id", handlers.GetStatement)
+	r.GET("/snapshot", handlers.GetSnapshot)
+	r.POST("/snapshot/diff", handlers.DiffSnapshots)
+	r.GET("/ledger", handlers.ListLedgerEntries)
+	r.GET("/ledger/balances", handlers.GetLedgerBalances)
+	r.GET("/ledger/prices", handlers.ListFiatPrices)
+	r.POST("/ledger/prices", handlers.SaveFiatPrices)
+	r.DELETE("/ledger/prices", handlers.DeleteFiatPrice)
+	r.GET("/ledger/lots", handlers.ListCostLots)
+	r.POST("/ledger/lots", handlers.AddCostLot)
+	r.DELETE("/ledger/lots/:id", handlers.DeleteCostLot)
+	r.GET("/ledger/gains", handlers.GetGainsReport)
+	r.GET("/access", handlers.GetAccessPolicy)
+	r.PUT("/access", handlers.SetAccessPolicy)
+	r.GET("/bans", handlers.ListBans)
+	r.DELETE("/bans/:client", handlers.LiftBan)
+	r.GET("/policy", handlers.GetPolicy)
+	r.PUT("/policy", handlers.SetPolicy)
+	r.GET("/exchanges", handlers.ListExchangeAddresses)
+	r.POST("/exchanges", handlers.SaveExchangeAddress)
+	r.DELETE("/exchanges/:address", handlers.DeleteExchangeAddress)
+	r.GET("/address-book", handlers.ListAddressBook)
+	r.GET("/address-book/:address", handlers.GetAddressBookEntry)
+	r.POST("/address-book", handlers.SaveAddressBookEntry)
+	r.DELETE("/address-book/:address", handlers.DeleteAddressBookEntry)
+	r.GET("/alerts", handlers.ListAlerts)
+	r.POST("/alerts/:id/ack", handlers.AcknowledgeAlert)
+	r.POST("/alerts/:id/approve", handlers.ApproveAlert)
+	r.POST("/webhooks", handlers.CreateWebhook)
+	r.GET("/webhooks", handlers.ListWebhooks)
+	r.GET("/webhooks/:id", handlers.GetWebhook)
+	r.PUT("/webhooks/:id", handlers.UpdateWebhook)
+	r.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+	r.POST("/webhooks/:id/rotate-secret", handlers.RotateWebhookSecret)
+	r.GET("/webhooks/:id/deliveries", handlers.ListWebhookDeliveries)
+	r.POST("/webhooks/:id/replay", handlers.ReplayWebhookDeliveries)
+	r.POST("/estimate", handlers.EstimateTransaction)
+	r.POST("/estimate/calldata", handlers.EstimateCalldata)
+	r.GET("/address/qr", handlers.GetAddressQR)
+	r.GET("/accounts", handlers.ListAccounts)
+	r.POST("/accounts", handlers.CreateAccount)
+	r.POST("/accounts/watch", handlers.AddWatchOnlyAccount)
+	r.POST("/accounts/select", handlers.SelectAccount)
+	r.POST("/accounts/unlock", handlers.UnlockAccount)
+	r.POST("/accounts/lock", handlers.LockAccount)
+	r.POST("/accounts/encrypt", handlers.EncryptAccountKey)
+	r.PUT("/accounts/:account", handlers.RenameAccount)
+	r.DELETE("/accounts/:account", handlers.DeleteAccount)
+	r.GET("/i18n", handlers.GetMessages)
+	r.GET("/rpc/status", handlers.GetRPCStatus)
+	r.GET("/readyz", handlers.GetReadiness)
+	r.GET("/openapi.json", handlers.OpenAPI(r))
+	r.GET("/chains", handlers.ListChains)
+	r.GET("/networks", handlers.ListNetworks)
+	r.POST("/networks/select", handlers.SelectNetwork)
+	r.GET("/addresses/:address/chains", handlers.GetAddressProfile)
+	r.GET("/balance", handlers.GetBalance)
+	r.GET("/identity", handlers.GetIdentity)
+	r.GET("/token/info", handlers.GetTokenInfo)
+	r.GET("/token/balance", handlers.GetTokenBalance)
+	r.GET("/token/allowance", handlers.GetTokenAllowance)
+	r.POST("/token/check", handlers.CheckTokenTransfer)
+	r.POST("/token/transfer", handlers.TransferERC20)
+	r.POST("/token/transfer-from", handlers.TransferFromERC20)
+	r.POST("/token/authorizations", handlers.SignTransferAuthorization)
+	r.POST("/token/authorizations/submit", handlers.SubmitTransferAuthorization)
+	r.GET("/token/authorizations/state", handlers.GetAuthorizationState)
+	r.POST("/airdrops/check", handlers.CheckAirdrop)
+	r.POST("/airdrops/claims", handlers.ClaimAirdrop)
+	r.GET("/safes", handlers.ListSafes)
+	r.GET("/safes/:address", handlers.GetSafe)
+	r.GET("/safes/:address/transactions", handlers.ListSafeTransactions)
+	r.POST("/safes/:address/sync", handlers.SyncSafeTransactions)
+	r.POST("/safes/:address/transactions", handlers.ProposeSafeTransaction)
+	r.POST("/safes/:address/transactions/:hash/confirmations", handlers.ConfirmSafeTransaction)
+	r.GET("/safes/:address/transactions/:hash/bundle", handlers.ExportSafeTransaction)
+	r.POST("/safes/:address/transactions/:hash/signatures", handlers.ImportSafeSignatures)
+	r.POST("/safes/:address/transactions/:hash/execute", handlers.ExecuteSafeTransaction)
+	r.GET("/nfts", handlers.ListNFTs)
+	r.POST("/nfts/mint", handlers.MintNFT)
+	r.POST("/nfts/scan", handlers.ScanNFTs)
+	r.GET("/nfts/metadata", handlers.GetNFTMetadata)
+	r.POST("/nfts/transfer", handlers.TransferNFT)
+	r.GET("/nfts/collections", handlers.ListNFTCollections)
+	r.POST("/nfts/collections", handlers.RegisterNFTCollection)
+	r.GET("/ens/:address", handlers.GetENSProfile)
+	r.POST("/ens/primary", handlers.SetPrimaryENSName)
+	r.GET("/ens/available/:name", handlers.CheckENSName)
+	r.GET("/ens/resolve/:name", handlers.ResolveENSName)
+	r.GET("/ens/reverse/:address", handlers.ReverseENSName)
+	r.GET("/ens/registrations", handlers.ListENSRegistrations)
+	r.POST("/ens/registrations", handlers.CommitENSRegistration)
+	r.POST("/ens/registrations/:id/register", handlers.CompleteENSRegistration)
+	r.POST("/ens/renew", handlers.RenewENSName)
+	r.PUT("/ens/records/:name", handlers.SetENSRecords)
+	r.POST("/ipfs/upload", handlers.UploadToIPFS)
+	r.GET("/ipfs/pins", handlers.ListIPFSPins)
+	r.GET("/ipfs/pins/:cid", handlers.GetIPFSPin)
+	r.POST("/breakglass", handlers.CreateBreakGlassEntry)
+	r.GET("/breakglass", handlers.ListBreakGlassEntries)
+	r.POST("/breakglass/:id/broadcast", handlers.BroadcastBreakGlassEntry)
+	r.POST("/ceremonies", handlers.CreateKeyCeremony)
+	r.GET("/ceremonies", handlers.ListKeyCeremonies)
+	r.POST("/ceremonies/:id/approve", handlers.ApproveKeyCeremony)
+	r.POST("/ceremonies/:id/complete", handlers.CompleteKeyCeremony)
+	r.GET("/ceremonies/:id/report", handlers.GetKeyCeremonyReport)
+	r.GET("/smart-accounts", handlers.ListSmartAccounts)
+	r.POST("/smart-accounts", handlers.CreateSmartAccount)
+	r.GET("/smart-accounts/:address", handlers.GetSmartAccount)
+	r.POST("/smart-accounts/:address/send", handlers.SendUserOperation)
+	r.GET("/smart-accounts/:address/operations/:hash", handlers.GetUserOperationReceipt)
+	r.GET("/smart-accounts/:address/guardians", handlers.GetGuardians)
+	r.POST("/smart-accounts/:address/guardians", handlers.AddGuardian)
+	r.DELETE("/smart-accounts/:address/guardians/:guardian", handlers.RemoveGuardian)
+	r.PUT("/smart-accounts/:address/guardians/threshold", handlers.SetGuardianThreshold)
+	r.POST("/smart-accounts/:address/recoveries", handlers.StartRecovery)
+	r.GET("/smart-accounts/:address/recoveries/:id", handlers.GetRecovery)
+	r.POST("/smart-accounts/:address/recoveries/:id/signatures", handlers.AddRecoverySignature)
+	r.POST("/smart-accounts/:address/recoveries/:id/execute", handlers.ExecuteRecovery)
+	r.GET("/delegations/:address", handlers.GetDelegation)
+	r.POST("/delegations", handlers.SetDelegation)
+	r.POST("/delegations/authorizations", handlers.SignDelegationAuthorization)
+	r.POST("/mnemonic/generate", handlers.GenerateMnemonic)
+	r.POST("/mnemonic/recover", handlers.RecoverMnemonic)
+	r.POST("/hd/accounts", handlers.CreateHDAccount)
+	r.POST("/hd/accounts/import-xpub", handlers.ImportXPub)
+	r.POST("/hd/accounts/restore", handlers.RestoreHDAccount)
+	r.GET("/hd/accounts", handlers.ListHDAccounts)
+	r.GET("/hd/accounts/:id/xpub", handlers.GetHDAccountXPub)
+	r.POST("/hd/accounts/:id/derive", handlers.DeriveHDAddress)
+	r.POST("/hd/accounts/:id/sign", handlers.SignWithHDAddress)
+	r.POST("/hd/accounts/:id/scan", handlers.ScanHDAccount)
+	r.GET("/hardware/devices", handlers.ListHardwareDevices)
+	r.POST("/hardware/addresses", handlers.DeriveHardwareAddresses)
+	r.GET("/hardware/accounts", handlers.ListHardwareAccounts)
+	r.POST("/hardware/accounts", handlers.AddHardwareAccount)
+	r.GET("/keystore", handlers.GetKeyStore)
+	r.POST("/keystore/keys", handlers.AddKMSKey)
+	r.GET("/validators/keys", handlers.ListValidatorKeys)
+	r.POST("/validators/keys", handlers.CreateValidatorKeys)
+	r.POST("/validators/keys/import", handlers.ImportValidatorKeystore)
+	r.GET("/validators/keys/:pubkey/keystore", handlers.GetValidatorKeystore)
+	r.POST("/validators/keys/:pubkey/deposit", handlers.SignDeposit)
+	r.POST("/validators/keys/:pubkey/exit", handlers.SignVoluntaryExit)
+	r.GET("/auth/login", handlers.OIDCLogin)
+	r.GET("/auth/callback", handlers.OIDCCallback)
+	r.POST("/auth/token", handlers.ExchangeIDToken)
+	r.GET("/auth/session", handlers.GetSession)
+	r.POST("/auth/logout", handlers.Logout)
+	r.POST("/auth/tokens", handlers.IssueAccessToken)
+	r.POST("/auth/revoke", handlers.RevokeAccessToken)
+	r.POST("/apikeys", handlers.CreateAPIKey)
+	r.GET("/apikeys", handlers.ListAPIKeys)
+	r.DELETE("/apikeys/:id", handlers.RevokeAPIKey)
+	r.PUT("/apikeys/:id/quota", handlers.SetAPIKeyQuota)
+	r.GET("/apikeys/:id/usage", handlers.GetAPIKeyUsage)
+
+	// Decoy routes that alert on and ban whoever calls them
+	handlers.RegisterHoneypots(r)
+
+	// Carry out requests held for maintenance once it ends
+	services.StartMaintenanceQueue(handlers.ReplayHeldRequest(r))
 
 	// Serve the main page
 	r.LoadHTMLFiles("public/index.html")
@@ -0,0 +1,17 @@
+package models
+
+// Account is a key the wallet holds, by name and address. A watch-only
+// account is an address the wallet follows without holding its key.
+type Account struct {
+	Name      string `protobuf:"bytes,1,opt,name=name,proto3" json:"name"`
+	Address   string `protobuf:"bytes,2,opt,name=address,proto3" json:"address"`
+	WatchOnly bool   `protobuf:"varint,3,opt,name=watch_only,json=watchOnly,proto3" json:"watch_only,omitempty"`
+}
+
+func (a Account) Validate() error {
+	if a.Name == "" {
+		return invalid("name", "must not be empty")
+	}
+
+	return checkAddress("address", a.Address)
+}
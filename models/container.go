@@ -0,0 +1,134 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Payload encodings of a signing container.
+const (
+	EncodingUTF8   = "utf8"
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+)
+
+// SigningContainerVersion is the version of the canonical form.
+const SigningContainerVersion = 1
+
+// MaxContainerPurpose bounds a container's purpose.
+const MaxContainerPurpose = 64
+
+// SigningContainer is a message that says what it is: why it is signed, how
+// its payload is encoded, the chain it is meant for, if any, and when it
+// stops being good. What is signed is its canonical form, so a signature
+// over a login challenge cannot be passed off as one over an order, and
+// verifiers can tell both apart without knowing the signer's conventions.
+type SigningContainer struct {
+	Purpose   string     `protobuf:"bytes,1,opt,name=purpose,proto3" json:"purpose"`
+	Payload   string     `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload"`
+	Encoding  string     `protobuf:"bytes,3,opt,name=encoding,proto3" json:"encoding"`
+	ChainID   uint64     `protobuf:"varint,4,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`
+	ExpiresAt *time.Time `protobuf:"bytes,5,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+}
+
+// canonicalContainer lists the fields in key order, which is the order
+// encoding/json writes them in.
+type canonicalContainer struct {
+	ChainID   uint64 `json:"chain_id,omitempty"`
+	Encoding  string `json:"encoding"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	Payload   string `json:"payload"`
+	Purpose   string `json:"purpose"`
+	Version   int    `json:"version"`
+}
+
+func (c SigningContainer) Validate() error {
+	purpose := strings.TrimSpace(c.Purpose)
+	if purpose == "" {
+		return invalid("container.purpose", "required")
+	}
+	if purpose != c.Purpose || !utf8.ValidString(c.Purpose) || len(c.Purpose) > MaxContainerPurpose {
+		return invalid("container.purpose", "must be UTF-8 of at most %d bytes without surrounding spaces", MaxContainerPurpose)
+	}
+	if _, err := c.payloadBytes(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Expired reports whether the container has an expiry before now.
+func (c SigningContainer) Expired(now time.Time) bool {
+	return c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)
+}
+
+// Canonical is the form of the container that is signed: JSON with its keys
+// sorted and no whitespace, the payload re-encoded as 0x-prefixed lowercase
+// hex or padded standard base64, and the expiry in RFC 3339 UTC to the
+// second. Two containers that mean the same thing have the same canonical
+// form.
+func (c SigningContainer) Canonical() (string, error) {
+	payload, err := c.payloadBytes()
+	if err != nil {
+		return "", err
+	}
+
+	canonical := canonicalContainer{
+		ChainID:  c.ChainID,
+		Encoding: c.Encoding,
+		Purpose:  c.Purpose,
+		Version:  SigningContainerVersion,
+	}
+	switch c.Encoding {
+	case EncodingUTF8:
+		canonical.Payload = string(payload)
+	case EncodingHex:
+		canonical.Payload = "0x" + hex.EncodeToString(payload)
+	case EncodingBase64:
+		canonical.Payload = base64.StdEncoding.EncodeToString(payload)
+	}
+	if c.ExpiresAt != nil {
+		canonical.ExpiresAt = c.ExpiresAt.UTC().Truncate(time.Second).Format(time.RFC3339)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(canonical); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func (c SigningContainer) payloadBytes() ([]byte, error) {
+	switch c.Encoding {
+	case EncodingUTF8:
+		if !utf8.ValidString(c.Payload) {
+			return nil, invalid("container.payload", "not UTF-8")
+		}
+		return []byte(c.Payload), nil
+	case EncodingHex:
+		payload, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(c.Payload, "0x"), "0X"))
+		if err != nil {
+			return nil, invalid("container.payload", "not hex")
+		}
+		return payload, nil
+	case EncodingBase64:
+		payload, err := base64.StdEncoding.DecodeString(c.Payload)
+		if err != nil {
+			payload, err = base64.RawStdEncoding.DecodeString(c.Payload)
+		}
+		if err != nil {
+			return nil, invalid("container.payload", "not base64")
+		}
+		return payload, nil
+	}
+
+	return nil, invalid("container.encoding", "%q is not one of %s, %s or %s", c.Encoding, EncodingUTF8, EncodingHex, EncodingBase64)
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// MaxMemoBytes bounds a memo; every byte is paid for in gas, and
+// counterparties only ever ask for a short reference.
+const MaxMemoBytes = 256
+
+// Destination is where a transfer goes: an address and, for a recipient
+// that shares one address among its customers as exchanges do, the memo or
+// numeric destination tag that tells them apart. Chains without a memo
+// field of their own carry it in the transaction's data.
+type Destination struct {
+	Address string  `protobuf:"bytes,1,opt,name=address,proto3" json:"address"`
+	Memo    string  `protobuf:"bytes,2,opt,name=memo,proto3" json:"memo,omitempty"`
+	Tag     *uint32 `protobuf:"varint,3,opt,name=destination_tag,json=destinationTag,proto3,oneof" json:"destination_tag,omitempty"`
+}
+
+func (d Destination) Validate() error {
+	if err := checkAddress("address", d.Address); err != nil {
+		return err
+	}
+	if d.Memo != "" && d.Tag != nil {
+		return invalid("destination_tag", "a memo and a destination tag cannot both be set")
+	}
+	if !utf8.ValidString(d.Memo) {
+		return invalid("memo", "not UTF-8")
+	}
+	if len(d.Memo) > MaxMemoBytes {
+		return invalid("memo", "longer than %d bytes", MaxMemoBytes)
+	}
+
+	return nil
+}
+
+// Reference is the memo, or the tag in decimal, or empty if there is
+// neither.
+func (d Destination) Reference() string {
+	if d.Tag != nil {
+		return strconv.FormatUint(uint64(*d.Tag), 10)
+	}
+
+	return d.Memo
+}
@@ -0,0 +1,64 @@
+package models
+
+// Balance is an amount in wei, and in gwei and ether for display.
+type Balance struct {
+	Wei   string `protobuf:"bytes,1,opt,name=wei,proto3" json:"wei"`
+	Gwei  string `protobuf:"bytes,2,opt,name=gwei,proto3" json:"gwei"`
+	Ether string `protobuf:"bytes,3,opt,name=ether,proto3" json:"ether"`
+}
+
+// FeeTier is what a transaction would pay at one speed. GasPrice is the
+// legacy gas price, or on EIP-1559 chains the latest base fee plus the tip;
+// Fee is that times the gas limit, and MaxFee the most it can cost under
+// MaxFeePerGas.
+type FeeTier struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name"`
+	GasPrice             string   `protobuf:"bytes,2,opt,name=gas_price,json=gasPrice,proto3" json:"gas_price"`
+	MaxFeePerGas         string   `protobuf:"bytes,3,opt,name=max_fee_per_gas,json=maxFeePerGas,proto3" json:"max_fee_per_gas,omitempty"`
+	MaxPriorityFeePerGas string   `protobuf:"bytes,4,opt,name=max_priority_fee_per_gas,json=maxPriorityFeePerGas,proto3" json:"max_priority_fee_per_gas,omitempty"`
+	Fee                  Balance  `protobuf:"bytes,5,opt,name=fee,proto3" json:"fee"`
+	MaxFee               *Balance `protobuf:"bytes,6,opt,name=max_fee,json=maxFee,proto3" json:"max_fee,omitempty"`
+}
+
+// FeeEstimate is the gas a transaction would take and what it would pay.
+// GasLimit is Estimated plus MarginPercent, which a transaction is sent
+// with. MemoGas is the part of Estimated a memo takes.
+type FeeEstimate struct {
+	ChainID       uint64    `protobuf:"varint,1,opt,name=chain_id,json=chainId,proto3" json:"chain_id"`
+	From          string    `protobuf:"bytes,2,opt,name=from,proto3" json:"from"`
+	To            string    `protobuf:"bytes,3,opt,name=to,proto3" json:"to"`
+	Estimated     uint64    `protobuf:"varint,4,opt,name=estimated_gas,json=estimatedGas,proto3" json:"estimated_gas"`
+	MarginPercent uint64    `protobuf:"varint,5,opt,name=margin_percent,json=marginPercent,proto3" json:"margin_percent"`
+	GasLimit      uint64    `protobuf:"varint,6,opt,name=gas_limit,json=gasLimit,proto3" json:"gas_limit"`
+	MemoGas       uint64    `protobuf:"varint,7,opt,name=memo_gas,json=memoGas,proto3" json:"memo_gas,omitempty"`
+	BaseFee       string    `protobuf:"bytes,8,opt,name=base_fee,json=baseFee,proto3" json:"base_fee,omitempty"`
+	Tiers         []FeeTier `protobuf:"bytes,9,rep,name=tiers,proto3" json:"tiers"`
+}
+
+func (e FeeEstimate) Validate() error {
+	if err := checkAddress("from", e.From); err != nil {
+		return err
+	}
+	if err := checkAddress("to", e.To); err != nil {
+		return err
+	}
+	if e.GasLimit < e.Estimated {
+		return invalid("gas_limit", "%d is below the estimate of %d", e.GasLimit, e.Estimated)
+	}
+	if err := checkAmount("base_fee", e.BaseFee, true); err != nil {
+		return err
+	}
+	if len(e.Tiers) == 0 {
+		return invalid("tiers", "must not be empty")
+	}
+	for _, tier := range e.Tiers {
+		if err := checkAmount("gas_price", tier.GasPrice, false); err != nil {
+			return err
+		}
+		if err := checkAmount("fee", tier.Fee.Wei, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
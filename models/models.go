@@ -0,0 +1,45 @@
+// Package models holds the types the wallet's API takes and returns. The
+// server, its command-line tools and Go clients all use them, so that they
+// cannot drift apart on the wire format. Their protobuf tags number the
+// fields for a proto3 encoding of the same messages. Validate methods check
+// what can be checked without a node or the wallet's state.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+var ErrInvalid = errors.New("invalid")
+
+var (
+	addressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	hashPattern    = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+)
+
+func invalid(field, format string, args ...interface{}) error {
+	return fmt.Errorf("%w %s: %s", ErrInvalid, field, fmt.Sprintf(format, args...))
+}
+
+func checkAddress(field, address string) error {
+	if !addressPattern.MatchString(address) {
+		return invalid(field, "%q is not a 0x-prefixed 20-byte hex address", address)
+	}
+
+	return nil
+}
+
+// checkAmount accepts a non-negative decimal integer, or nothing if
+// optional.
+func checkAmount(field, amount string, optional bool) error {
+	if amount == "" && optional {
+		return nil
+	}
+	if value, ok := new(big.Int).SetString(amount, 10); !ok || value.Sign() < 0 {
+		return invalid(field, "%q is not a non-negative decimal integer", amount)
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func roundTrip(t *testing.T, in, out interface{}) {
+	t.Helper()
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal %T: %v", in, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("unmarshal %T: %v", in, err)
+	}
+	if got := reflect.ValueOf(out).Elem().Interface(); !reflect.DeepEqual(got, in) {
+		t.Fatalf("%T changed in a round trip:\n got %+v\nwant %+v\njson %s", in, got, in, data)
+	}
+}
+
+func TestAccountRoundTrip(t *testing.T) {
+	for _, account := range []Account{
+		{Name: "savings", Address: "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"},
+		{Name: "cold", Address: "0x0000000000000000000000000000000000000001", WatchOnly: true},
+	} {
+		var got Account
+		roundTrip(t, account, &got)
+		if err := account.Validate(); err != nil {
+			t.Errorf("Validate(%s): %v", account.Name, err)
+		}
+	}
+}
+
+func TestAccountValidate(t *testing.T) {
+	for _, account := range []Account{
+		{Address: "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"},
+		{Name: "savings", Address: "9858EfFD232B4033E47d90003D41EC34EcaEda94"},
+		{Name: "savings", Address: "0x9858EfFD"},
+	} {
+		if err := account.Validate(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%+v: got %v, want ErrInvalid", account, err)
+		}
+	}
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	nonce := uint64(0)
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mined := created.Add(time.Minute)
+
+	for _, tx := range []Transaction{
+		{
+			Hash:      "0x" + strings.Repeat("ab", 32),
+			ChainID:   1,
+			From:      "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+			To:        "0x0000000000000000000000000000000000000001",
+			Value:     "1000",
+			Status:    StatusPending,
+			CreatedAt: created,
+		},
+		{
+			Hash:              "0x" + strings.Repeat("cd", 32),
+			ChainID:           11155111,
+			From:              "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+			Value:             "0",
+			Data:              "0x6080604052",
+			Nonce:             &nonce,
+			Gas:               53000,
+			GasPrice:          "2000000000",
+			GasUsed:           52000,
+			EffectiveGasPrice: "1500000000",
+			BlockNumber:       42,
+			Status:            StatusConfirmed,
+			ReplacedBy:        "0x" + strings.Repeat("ef", 32),
+			CreatedAt:         created,
+			UpdatedAt:         &mined,
+			MinedAt:           &mined,
+		},
+	} {
+		var got Transaction
+		roundTrip(t, tx, &got)
+		if err := tx.Validate(); err != nil {
+			t.Errorf("Validate(%s): %v", tx.Hash, err)
+		}
+	}
+}
+
+func TestTransactionValidate(t *testing.T) {
+	valid := Transaction{
+		Hash:      "0x" + strings.Repeat("ab", 32),
+		From:      "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+		To:        "0x0000000000000000000000000000000000000001",
+		Value:     "0",
+		Status:    StatusQueued,
+		CreatedAt: time.Now(),
+	}
+
+	noTo := valid
+	noTo.To = ""
+	if err := noTo.Validate(); !errors.Is(err, ErrInvalid) {
+		t.Errorf("a transfer without to: got %v, want ErrInvalid", err)
+	}
+
+	creation := noTo
+	creation.Data = "0x6080604052"
+	if err := creation.Validate(); err != nil {
+		t.Errorf("a contract creation without to: %v", err)
+	}
+
+	badStatus := valid
+	badStatus.Status = "sent"
+	if err := badStatus.Validate(); !errors.Is(err, ErrInvalid) {
+		t.Errorf("status %q: got %v, want ErrInvalid", badStatus.Status, err)
+	}
+}
+
+func TestFeeEstimateRoundTrip(t *testing.T) {
+	estimate := FeeEstimate{
+		ChainID:       1,
+		From:          "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+		To:            "0x0000000000000000000000000000000000000001",
+		Estimated:     21000,
+		MarginPercent: 20,
+		GasLimit:      25200,
+		BaseFee:       "1000000000",
+		Tiers: []FeeTier{
+			{
+				Name:     "standard",
+				GasPrice: "1500000000",
+				Fee:      Balance{Wei: "37800000000000", Gwei: "37800", Ether: "0.0000378"},
+			},
+			{
+				Name:                 "fast",
+				GasPrice:             "3000000000",
+				MaxFeePerGas:         "4000000000",
+				MaxPriorityFeePerGas: "2000000000",
+				Fee:                  Balance{Wei: "75600000000000", Gwei: "75600", Ether: "0.0000756"},
+				MaxFee:               &Balance{Wei: "100800000000000", Gwei: "100800", Ether: "0.0001008"},
+			},
+		},
+	}
+
+	var got FeeEstimate
+	roundTrip(t, estimate, &got)
+	if err := estimate.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	belowEstimate := estimate
+	belowEstimate.GasLimit = estimate.Estimated - 1
+	noTiers := estimate
+	noTiers.Tiers = nil
+	badBaseFee := estimate
+	badBaseFee.BaseFee = "-1"
+	badTier := estimate
+	badTier.Tiers = []FeeTier{{Name: "slow", GasPrice: "1.5", Fee: Balance{Wei: "0"}}}
+	for name, invalid := range map[string]FeeEstimate{
+		"gas limit below the estimate": belowEstimate,
+		"no tiers":                     noTiers,
+		"negative base fee":            badBaseFee,
+		"fractional gas price":         badTier,
+	} {
+		if err := invalid.Validate(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: got %v, want ErrInvalid", name, err)
+		}
+	}
+}
+
+func TestSignatureRequestRoundTrip(t *testing.T) {
+	expires := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, request := range []SignatureRequest{
+		{Account: "savings", Message: "hello", Scheme: SignSchemePersonal},
+		{
+			Container: &SigningContainer{
+				Purpose:   "login",
+				Payload:   "0x01020304",
+				Encoding:  EncodingHex,
+				ChainID:   1,
+				ExpiresAt: &expires,
+			},
+		},
+	} {
+		var got SignatureRequest
+		roundTrip(t, request, &got)
+		if err := request.Validate(); err != nil {
+			t.Errorf("Validate: %v", err)
+		}
+	}
+}
+
+func TestDestinationRoundTrip(t *testing.T) {
+	tag := uint32(12345)
+
+	for _, destination := range []Destination{
+		{Address: "0x0000000000000000000000000000000000000001", Memo: "invoice 7"},
+		{Address: "0x0000000000000000000000000000000000000001", Tag: &tag},
+	} {
+		var got Destination
+		roundTrip(t, destination, &got)
+	}
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Message signature schemes. SHA-256 signs the SHA-256 hash of the message,
+// as the wallet always has; it is the default so existing signatures still
+// verify. Personal signs as personal_sign does (EIP-191 version 0x45): the
+// Keccak-256 hash of "\x19Ethereum Signed Message:\n", the message length and
+// the message, with a 27/28 recovery ID, so MetaMask, ethers.js and
+// contracts using ecrecover can check it.
+const (
+	SignSchemeSHA256   = "sha256"
+	SignSchemePersonal = "personal_sign"
+)
+
+var ErrUnknownSignScheme = errors.New("unknown signature scheme")
+
+// SignatureRequest asks for a message to be signed by an account, the
+// selected one if Account is empty, under Scheme, SHA-256 if empty. The
+// message is either a raw string or a Container, whose canonical form is
+// what gets signed.
+type SignatureRequest struct {
+	Account   string            `protobuf:"bytes,1,opt,name=account,proto3" json:"account"`
+	Message   string            `protobuf:"bytes,2,opt,name=message,proto3" json:"message"`
+	Container *SigningContainer `protobuf:"bytes,3,opt,name=container,proto3" json:"container,omitempty"`
+	Scheme    string            `protobuf:"bytes,4,opt,name=scheme,proto3" json:"scheme"`
+}
+
+func (r SignatureRequest) Validate() error {
+	if r.Container != nil {
+		if r.Message != "" {
+			return invalid("container", "a message and a container cannot both be set")
+		}
+		if err := r.Container.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return CheckSignScheme(r.Scheme)
+}
+
+// CheckSignScheme accepts the schemes messages can be signed under.
+func CheckSignScheme(scheme string) error {
+	switch scheme {
+	case "", SignSchemeSHA256, SignSchemePersonal:
+		return nil
+	}
+
+	return fmt.Errorf("%w %q: use %s or %s", ErrUnknownSignScheme, scheme, SignSchemeSHA256, SignSchemePersonal)
+}
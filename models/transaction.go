@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// Transaction statuses. A queued transaction is signed but waiting to be
+// broadcast; a pending one is broadcast but not yet confirmed or failed. A
+// replaced one was sped up or cancelled and its replacement was mined.
+const (
+	StatusQueued    = "queued"
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusFailed    = "failed"
+	StatusReplaced  = "replaced"
+)
+
+// Transaction is a transaction sent through the wallet. Data (the calldata,
+// 0x-prefixed hex), Nonce, Gas (the gas limit) and GasPrice (the fee cap,
+// for EIP-1559 transactions) are as signed; GasUsed, EffectiveGasPrice,
+// BlockNumber and MinedAt are filled in from the receipt once it is mined.
+// Records made before these were kept lack them. ContractAddress is set on a
+// deployment, whose To is the contract it creates; a contract creation
+// broadcast raw has no To, only Data. Replaces and ReplacedBy link a
+// transaction sped up or cancelled with the one sent in its place.
+type Transaction struct {
+	Hash              string     `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash"`
+	ChainID           uint64     `protobuf:"varint,2,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`
+	From              string     `protobuf:"bytes,3,opt,name=from,proto3" json:"from"`
+	To                string     `protobuf:"bytes,4,opt,name=to,proto3" json:"to"`
+	Value             string     `protobuf:"bytes,5,opt,name=value,proto3" json:"value"`
+	Data              string     `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`
+	Nonce             *uint64    `protobuf:"varint,7,opt,name=nonce,proto3,oneof" json:"nonce,omitempty"`
+	Gas               uint64     `protobuf:"varint,8,opt,name=gas,proto3" json:"gas,omitempty"`
+	GasPrice          string     `protobuf:"bytes,9,opt,name=gas_price,json=gasPrice,proto3" json:"gas_price,omitempty"`
+	GasUsed           uint64     `protobuf:"varint,10,opt,name=gas_used,json=gasUsed,proto3" json:"gas_used,omitempty"`
+	EffectiveGasPrice string     `protobuf:"bytes,11,opt,name=effective_gas_price,json=effectiveGasPrice,proto3" json:"effective_gas_price,omitempty"`
+	BlockNumber       uint64     `protobuf:"varint,12,opt,name=block_number,json=blockNumber,proto3" json:"block_number,omitempty"`
+	ContractAddress   string     `protobuf:"bytes,13,opt,name=contract_address,json=contractAddress,proto3" json:"contract_address,omitempty"`
+	Status            string     `protobuf:"bytes,14,opt,name=status,proto3" json:"status"`
+	Replaces          string     `protobuf:"bytes,15,opt,name=replaces,proto3" json:"replaces,omitempty"`
+	ReplacedBy        string     `protobuf:"bytes,16,opt,name=replaced_by,json=replacedBy,proto3" json:"replaced_by,omitempty"`
+	CreatedAt         time.Time  `protobuf:"bytes,17,opt,name=created_at,json=createdAt,proto3" json:"created_at"`
+	UpdatedAt         *time.Time `protobuf:"bytes,18,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	MinedAt           *time.Time `protobuf:"bytes,19,opt,name=mined_at,json=minedAt,proto3" json:"mined_at,omitempty"`
+}
+
+func (t Transaction) Validate() error {
+	if !hashPattern.MatchString(t.Hash) {
+		return invalid("hash", "%q is not a 0x-prefixed 32-byte hex hash", t.Hash)
+	}
+	if err := checkAddress("from", t.From); err != nil {
+		return err
+	}
+	if t.To != "" || t.Data == "" {
+		if err := checkAddress("to", t.To); err != nil {
+			return err
+		}
+	}
+	if err := checkAmount("value", t.Value, false); err != nil {
+		return err
+	}
+	if err := checkAmount("gas_price", t.GasPrice, true); err != nil {
+		return err
+	}
+	if err := checkAmount("effective_gas_price", t.EffectiveGasPrice, true); err != nil {
+		return err
+	}
+
+	switch t.Status {
+	case StatusQueued, StatusPending, StatusConfirmed, StatusFailed, StatusReplaced:
+	default:
+		return invalid("status", "%q is not queued, pending, confirmed, failed or replaced", t.Status)
+	}
+	if t.CreatedAt.IsZero() {
+		return invalid("created_at", "must be set")
+	}
+
+	return nil
+}
+
+// TransactionStatus is a transaction with how deep its block is.
+// Confirmations stays 0 while it is not mined.
+type TransactionStatus struct {
+	Transaction
+	Confirmations         uint64 `json:"confirmations"`
+	RequiredConfirmations uint64 `json:"required_confirmations"`
+}
@@ -1,9 +1,30 @@
 document.addEventListener('DOMContentLoaded', () => {
+    const accountSelect = document.getElementById('account-select');
+    const accountName = document.getElementById('account-name');
+    const accountCreateBtn = document.getElementById('account-create-btn');
     const generateBtn = document.getElementById('generate-btn');
-    const generateResult = document.getElementById('generate-result');
+    const accountPassword = document.getElementById('account-password');
+    const unlockBtn = document.getElementById('unlock-btn');
+    const renameBtn = document.getElementById('rename-btn');
+    const deleteBtn = document.getElementById('delete-btn');
+    const accountResult = document.getElementById('account-result');
 
-    const addressBtn = document.getElementById('address-btn');
     const addressResult = document.getElementById('address-result');
+    const addressQR = document.getElementById('address-qr');
+    const addressAvatar = document.getElementById('address-avatar');
+
+    const txToAddress = document.getElementById('tx-to-address');
+    const txValue = document.getElementById('tx-value');
+    const previewBtn = document.getElementById('preview-btn');
+    const preview = document.getElementById('preview');
+    const approveBtn = document.getElementById('approve-btn');
+    const rejectBtn = document.getElementById('reject-btn');
+    const transactionResult = document.getElementById('transaction-result');
+
+    const historyStatus = document.getElementById('history-status');
+    const historyAddress = document.getElementById('history-address');
+    const historyBtn = document.getElementById('history-btn');
+    const historyBody = document.querySelector('#history tbody');
 
     const signBtn = document.getElementById('sign-btn');
     const signMessage = document.getElementById('sign-message');
@@ -14,61 +35,220 @@ document.addEventListener('DOMContentLoaded', () => {
     const verifySignature = document.getElementById('verify-signature');
     const verifyResult = document.getElementById('verify-result');
 
-    const transactionBtn = document.getElementById('transaction-btn');
-    const txToAddress = document.getElementById('tx-to-address');
-    const txValue = document.getElementById('tx-value');
-    const transactionResult = document.getElementById('transaction-result');
+    let previewID = null;
+    let messages = {};
+    // Primary ENS names of the wallet's accounts, by address.
+    let accountNames = {};
+
+    const t = key => messages[key] || key;
+
+    const loadMessages = async () => {
+        const response = await fetch('/i18n');
+        const data = await response.json();
+        messages = data.messages || {};
+        document.documentElement.lang = data.language;
+        document.querySelectorAll('[data-i18n]').forEach(el => {
+            el.textContent = t(el.dataset.i18n);
+        });
+        document.querySelectorAll('[data-i18n-placeholder]').forEach(el => {
+            el.placeholder = t(el.dataset.i18nPlaceholder);
+        });
+    };
+
+    // Sends the browser to the identity provider when the wallet requires a
+    // sign-in and there is no session yet.
+    const checkSession = async () => {
+        const response = await fetch('/auth/session');
+        if (response.status === 401) {
+            const data = await response.json();
+            if (data.login_url) {
+                window.location.href = data.login_url;
+                return false;
+            }
+        }
+        return true;
+    };
+
+    const postJSON = (url, body) => fetch(url, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify(body)
+    });
+
+    const loadAccounts = async () => {
+        const response = await fetch('/accounts?limit=500');
+        const data = await response.json();
+        accountSelect.innerHTML = '';
+        accountNames = {};
+        (data.accounts || []).forEach(account => {
+            const option = document.createElement('option');
+            option.value = account.address;
+            option.textContent = `${account.name} (${account.ens ? account.ens.name : account.address})${account.locked ? ` · ${t('Locked')}` : ''}`;
+            if (account.ens) accountNames[account.address] = account.ens;
+            option.selected = account.address === data.selected;
+            accountSelect.appendChild(option);
+        });
+        showAddress(data.selected);
+    };
+
+    const showAddress = address => {
+        addressAvatar.classList.add('hidden');
+        if (!address) {
+            addressResult.textContent = t('No account yet. Create or generate one above.');
+            addressQR.removeAttribute('src');
+            return;
+        }
+        const ens = accountNames[address];
+        addressResult.textContent = ens ? `${ens.name} · ${address}` : `${t('Address')}: ${address}`;
+        if (ens && ens.avatar_url) {
+            addressAvatar.src = ens.avatar_url;
+            addressAvatar.classList.remove('hidden');
+        }
+        addressQR.src = `/address/qr?address=${encodeURIComponent(address)}`;
+    };
+
+    const loadHistory = async () => {
+        const params = new URLSearchParams();
+        if (historyStatus.value) params.set('status', historyStatus.value);
+        if (historyAddress.value) params.set('address', historyAddress.value);
+        const response = await fetch(`/transactions?${params}`);
+        const data = await response.json();
+        historyBody.innerHTML = '';
+        const names = data.names || {};
+        (data.transactions || []).forEach(tx => {
+            const row = document.createElement('tr');
+            const to = names[tx.to] ? names[tx.to].name : tx.to;
+            [new Date(tx.created_at).toLocaleString(), tx.hash, to, tx.value, tx.status].forEach(value => {
+                const cell = document.createElement('td');
+                cell.textContent = value;
+                if (value === to) cell.title = tx.to;
+                row.appendChild(cell);
+            });
+            historyBody.appendChild(row);
+        });
+    };
+
+    const hidePreview = () => {
+        previewID = null;
+        preview.classList.add('hidden');
+    };
+
+    accountSelect.addEventListener('change', async () => {
+        const response = await postJSON('/accounts/select', { address: accountSelect.value });
+        const data = await response.json();
+        accountResult.textContent = data.error ? `${t('Error')}: ${data.error}` : '';
+        hidePreview();
+        await loadAccounts();
+    });
+
+    accountCreateBtn.addEventListener('click', async () => {
+        const response = await postJSON('/accounts', { name: accountName.value, password: accountPassword.value });
+        const data = await response.json();
+        accountResult.textContent = data.error ? `${t('Error')}: ${data.error}` : `${t('Created')} ${data.name}: ${data.address}`;
+        accountName.value = '';
+        await loadAccounts();
+    });
 
     generateBtn.addEventListener('click', async () => {
-        const response = await fetch('/generate');
+        const response = await postJSON('/generate', { password: accountPassword.value });
         const data = await response.json();
-        generateResult.textContent = `Private Key: ${data.private_key}, Address: ${data.address}`;
+        accountResult.textContent = data.error ? `${t('Error')}: ${data.error}` : `${t('Private Key')}: ${data.private_key}, ${t('Address')}: ${data.address}`;
+        await loadAccounts();
     });
 
-    addressBtn.addEventListener('click', async () => {
-        const response = await fetch('/address');
+    unlockBtn.addEventListener('click', async () => {
+        const response = await postJSON('/accounts/unlock', { address: accountSelect.value, password: accountPassword.value });
         const data = await response.json();
-        addressResult.textContent = `Address: ${data.address}`;
+        accountResult.textContent = data.error ? `${t('Error')}: ${data.error}` : `${t('Unlocked until')} ${new Date(data.unlocked_until).toLocaleString()}`;
+        accountPassword.value = '';
+        await loadAccounts();
     });
 
-    signBtn.addEventListener('click', async () => {
-        const message = signMessage.value;
-        const response = await fetch('/sign', {
-            method: 'POST',
-            headers: {
-                'Content-Type': 'application/json'
-            },
-            body: JSON.stringify({ message })
+    renameBtn.addEventListener('click', async () => {
+        const response = await fetch(`/accounts/${encodeURIComponent(accountSelect.value)}`, {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ name: accountName.value })
         });
         const data = await response.json();
-        signResult.textContent = `Signature: ${data.signature}`;
+        accountResult.textContent = data.error ? `${t('Error')}: ${data.error}` : `${t('Renamed')} ${data.address}: ${data.name}`;
+        accountName.value = '';
+        await loadAccounts();
     });
 
-    verifyBtn.addEventListener('click', async () => {
-        const message = verifyMessage.value;
-        const signature = verifySignature.value;
-        const response = await fetch('/verify', {
-            method: 'POST',
-            headers: {
-                'Content-Type': 'application/json'
-            },
-            body: JSON.stringify({ message, signature })
+    deleteBtn.addEventListener('click', async () => {
+        if (!confirm(t('Delete this account and its key? This cannot be undone.'))) return;
+        const response = await fetch(`/accounts/${encodeURIComponent(accountSelect.value)}`, { method: 'DELETE' });
+        const data = await response.json();
+        accountResult.textContent = data.error ? `${t('Error')}: ${data.error}` : `${t('Deleted')} ${data.deleted.name}`;
+        hidePreview();
+        await loadAccounts();
+    });
+
+    previewBtn.addEventListener('click', async () => {
+        const response = await postJSON('/transaction/preview', {
+            to_address: txToAddress.value,
+            value: parseInt(txValue.value)
         });
         const data = await response.json();
-        verifyResult.textContent = `Valid: ${data.valid}`;
+        if (data.error) {
+            hidePreview();
+            transactionResult.textContent = `${t('Error')}: ${data.error}`;
+            return;
+        }
+        previewID = data.id;
+        document.getElementById('preview-from').textContent = data.from;
+        document.getElementById('preview-to').textContent = data.to;
+        document.getElementById('preview-recipient').textContent = data.provenance || '';
+        document.getElementById('preview-recipient-row').classList.toggle('hidden', !data.provenance);
+        document.getElementById('preview-value').textContent = data.value;
+        document.getElementById('preview-gas-limit').textContent = data.gas_limit;
+        document.getElementById('preview-gas-price').textContent = data.gas_price;
+        document.getElementById('preview-fee').textContent = data.fee;
+        document.getElementById('preview-total').textContent = data.total;
+        preview.classList.remove('hidden');
+        transactionResult.textContent = `${data.summary}. ${t('Preview expires at')} ${new Date(data.expires_at).toLocaleTimeString()}`;
+    });
+
+    approveBtn.addEventListener('click', async () => {
+        if (!previewID) return;
+        const response = await postJSON(`/transaction/preview/${previewID}/approve`, {});
+        const data = await response.json();
+        hidePreview();
+        transactionResult.textContent = data.error ? `${t('Error')}: ${data.error}` : `${t('Transaction Hash')}: ${data.transaction_hash}`;
+        await loadHistory();
+    });
+
+    rejectBtn.addEventListener('click', async () => {
+        if (!previewID) return;
+        await postJSON(`/transaction/preview/${previewID}/reject`, {});
+        hidePreview();
+        transactionResult.textContent = t('Transaction rejected');
+    });
+
+    historyBtn.addEventListener('click', loadHistory);
+    historyStatus.addEventListener('change', loadHistory);
+
+    signBtn.addEventListener('click', async () => {
+        const response = await postJSON('/sign', { message: signMessage.value });
+        const data = await response.json();
+        signResult.textContent = data.error ? `${t('Error')}: ${data.error}` : `${t('Signature')}: ${data.signature}`;
     });
 
-    transactionBtn.addEventListener('click', async () => {
-        const toAddress = txToAddress.value;
-        const value = txValue.value;
-        const response = await fetch('/transaction', {
-            method: 'POST',
-            headers: {
-                'Content-Type': 'application/json'
-            },
-            body: JSON.stringify({ to_address: toAddress, value: parseInt(value) })
+    verifyBtn.addEventListener('click', async () => {
+        const response = await postJSON('/verify', {
+            message: verifyMessage.value,
+            signature: verifySignature.value
         });
         const data = await response.json();
-        transactionResult.textContent = `Transaction Hash: ${data.transaction_hash}`;
+        verifyResult.textContent = data.error ? `${t('Error')}: ${data.error}` : `${t('Valid')}: ${data.valid}`;
+    });
+
+    loadMessages().then(checkSession).then(signedIn => {
+        if (!signedIn) return;
+        loadAccounts();
+        loadHistory();
     });
 });
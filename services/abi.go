@@ -0,0 +1,205 @@
+package services
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// packJSONArgs converts JSON-decoded arguments into the Go values expected by
+// the abi package for the given method inputs.
+func packJSONArgs(inputs abi.Arguments, raw []json.RawMessage) ([]interface{}, error) {
+	if len(raw) != len(inputs) {
+		return nil, fmt.Errorf("expected %d arguments, got %d", len(inputs), len(raw))
+	}
+
+	args := make([]interface{}, len(inputs))
+	for i, input := range inputs {
+		value, err := abiValue(input.Type, raw[i])
+		if err != nil {
+			return nil, fmt.Errorf("argument %d (%s): %w", i, input.Name, err)
+		}
+		args[i] = value.Interface()
+	}
+
+	return args, nil
+}
+
+func abiValue(t abi.Type, raw json.RawMessage) (reflect.Value, error) {
+	switch t.T {
+	case abi.AddressTy:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil || !common.IsHexAddress(s) {
+			return reflect.Value{}, fmt.Errorf("invalid address")
+		}
+		return reflect.ValueOf(common.HexToAddress(s)), nil
+
+	case abi.IntTy, abi.UintTy:
+		n, err := jsonBigInt(raw)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if t.T == abi.UintTy && n.Sign() < 0 {
+			return reflect.Value{}, fmt.Errorf("negative value for %s", t)
+		}
+		if n.BitLen() > t.Size {
+			return reflect.Value{}, fmt.Errorf("value overflows %s", t)
+		}
+		goType := t.GetType()
+		if goType == reflect.TypeOf(&big.Int{}) {
+			return reflect.ValueOf(n), nil
+		}
+		if t.T == abi.UintTy {
+			return reflect.ValueOf(n.Uint64()).Convert(goType), nil
+		}
+		return reflect.ValueOf(n.Int64()).Convert(goType), nil
+
+	case abi.BoolTy:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid bool")
+		}
+		return reflect.ValueOf(b), nil
+
+	case abi.StringTy:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid string")
+		}
+		return reflect.ValueOf(s), nil
+
+	case abi.BytesTy, abi.FixedBytesTy:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid bytes")
+		}
+		b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid hex bytes")
+		}
+		if t.T == abi.BytesTy {
+			return reflect.ValueOf(b), nil
+		}
+		if len(b) != t.Size {
+			return reflect.Value{}, fmt.Errorf("expected %d bytes, got %d", t.Size, len(b))
+		}
+		array := reflect.New(t.GetType()).Elem()
+		reflect.Copy(array, reflect.ValueOf(b))
+		return array, nil
+
+	case abi.SliceTy, abi.ArrayTy:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid array")
+		}
+		var out reflect.Value
+		if t.T == abi.SliceTy {
+			out = reflect.MakeSlice(t.GetType(), len(items), len(items))
+		} else {
+			if len(items) != t.Size {
+				return reflect.Value{}, fmt.Errorf("expected %d elements, got %d", t.Size, len(items))
+			}
+			out = reflect.New(t.GetType()).Elem()
+		}
+		for i, item := range items {
+			value, err := abiValue(*t.Elem, item)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+			}
+			out.Index(i).Set(value)
+		}
+		return out, nil
+
+	case abi.TupleTy:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid tuple")
+		}
+		out := reflect.New(t.GetType()).Elem()
+		for i, elem := range t.TupleElems {
+			name := t.TupleRawNames[i]
+			field, ok := fields[name]
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("missing tuple field %q", name)
+			}
+			value, err := abiValue(*elem, field)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("field %s: %w", name, err)
+			}
+			out.Field(i).Set(value)
+		}
+		return out, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("unsupported ABI type %s", t)
+}
+
+// jsonBigInt accepts both JSON numbers and decimal/hex strings, since large
+// uint256 values cannot be represented as JSON numbers safely.
+func jsonBigInt(raw json.RawMessage) (*big.Int, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, fmt.Errorf("invalid integer")
+		}
+		s = n.String()
+	}
+
+	n, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer %q", s)
+	}
+
+	return n, nil
+}
+
+// jsonABIValue converts a value unpacked by the abi package into one that
+// encodes to JSON the way abiValue reads arguments: integers as decimal
+// strings, bytes as 0x-prefixed hex and tuples as objects.
+func jsonABIValue(t abi.Type, v reflect.Value) interface{} {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		if n, ok := v.Interface().(*big.Int); ok {
+			return n.String()
+		}
+		if t.T == abi.UintTy {
+			return strconv.FormatUint(v.Uint(), 10)
+		}
+		return strconv.FormatInt(v.Int(), 10)
+
+	case abi.AddressTy:
+		return v.Interface().(common.Address).Hex()
+
+	case abi.BytesTy, abi.FixedBytesTy, abi.FunctionTy:
+		b := make([]byte, v.Len())
+		for i := range b {
+			b[i] = byte(v.Index(i).Uint())
+		}
+		return hexutil.Encode(b)
+
+	case abi.SliceTy, abi.ArrayTy:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = jsonABIValue(*t.Elem, v.Index(i))
+		}
+		return items
+
+	case abi.TupleTy:
+		fields := make(map[string]interface{}, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			fields[t.TupleRawNames[i]] = jsonABIValue(*elem, v.Field(i))
+		}
+		return fields
+	}
+
+	return v.Interface()
+}
@@ -0,0 +1,480 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint groups access rules apply to. Read covers routes needing only
+// accounts:read, admin those needing admin:config, and signing the rest,
+// which change wallet state.
+const (
+	AccessRead    = "read"
+	AccessSigning = "signing"
+	AccessAdmin   = "admin"
+)
+
+// AccessPolicy restricts which client addresses may call each endpoint
+// group. It is checked before authentication, so a blocked address cannot
+// even try credentials.
+type AccessPolicy struct {
+	Read    AccessRule `json:"read"`
+	Signing AccessRule `json:"signing"`
+	Admin   AccessRule `json:"admin"`
+
+	// TrustedProxies are the load balancers whose X-Forwarded-For is
+	// believed. Without them the client is the connection's peer address.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+}
+
+// AccessRule admits a client only if it passes every check that is set:
+// its address is not in Deny, is in Allow, and comes from a country that is
+// not in DenyCountries and is in AllowCountries. Networks are CIDRs or single
+// addresses; countries are ISO 3166 codes looked up in the GEOIP_DB database.
+// An address the database does not know has no country, so AllowCountries
+// refuses it.
+type AccessRule struct {
+	Allow          []string `json:"allow,omitempty"`
+	Deny           []string `json:"deny,omitempty"`
+	AllowCountries []string `json:"allow_countries,omitempty"`
+	DenyCountries  []string `json:"deny_countries,omitempty"`
+}
+
+// AccessDecision is the outcome of checking a request.
+type AccessDecision struct {
+	Allowed bool
+	Client  string
+	Country string
+	Reason  string
+}
+
+type accessRule struct {
+	allow, deny                   []netip.Prefix
+	allowCountries, denyCountries map[string]bool
+}
+
+type compiledAccess struct {
+	groups  map[string]accessRule
+	proxies []netip.Prefix
+}
+
+var (
+	accessFile = "access.json"
+	accessMu   sync.Mutex
+	access     *compiledAccess
+
+	// accessDenials limits audit events for denied requests to one per
+	// client and group a minute, so a scan cannot flood the audit log.
+	accessDenials = map[string]time.Time{}
+)
+
+var ErrInvalidAccessPolicy = errors.New("invalid access policy")
+
+func GetAccessPolicy() (*AccessPolicy, error) {
+	accessMu.Lock()
+	defer accessMu.Unlock()
+
+	return readAccessPolicy()
+}
+
+// SetAccessPolicy replaces the access policy. caller is the address of the
+// client making the change; a policy that would shut it out of the admin
+// routes is refused, since it could not then be undone over the API.
+func SetAccessPolicy(policy AccessPolicy, caller string) (*AccessPolicy, error) {
+	compiled, err := compileAccess(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if addr, err := netip.ParseAddr(caller); err == nil {
+		if reason := compiled.groups[AccessAdmin].check(addr.Unmap(), geoCountry(addr.Unmap())); reason != "" {
+			return nil, fmt.Errorf("%w: it would block this client (%s): %s", ErrInvalidAccessPolicy, caller, reason)
+		}
+	}
+
+	accessMu.Lock()
+	defer accessMu.Unlock()
+
+	if err := writeJSONFile(accessFile, policy); err != nil {
+		return nil, err
+	}
+	access = compiled
+
+	recordAudit("access.policy_updated", "access restrictions updated", nil)
+	return &policy, nil
+}
+
+// CheckAccess decides whether a request to an endpoint group may proceed.
+// remoteAddr is the connection's peer and forwardedFor its X-Forwarded-For
+// header, if any. Denied requests are recorded in the audit log.
+func CheckAccess(group, remoteAddr, forwardedFor string) (*AccessDecision, error) {
+	accessMu.Lock()
+	if access == nil {
+		policy, err := readAccessPolicy()
+		if err != nil {
+			accessMu.Unlock()
+			return nil, err
+		}
+		if access, err = compileAccess(*policy); err != nil {
+			accessMu.Unlock()
+			return nil, err
+		}
+	}
+	compiled := access
+	accessMu.Unlock()
+
+	client, ok := compiled.clientAddr(remoteAddr, forwardedFor)
+	if !ok {
+		return &AccessDecision{Client: remoteAddr, Reason: "unparseable client address"}, nil
+	}
+
+	decision := &AccessDecision{Allowed: true, Client: client.String()}
+
+	ban, err := activeBan(decision.Client)
+	if err != nil {
+		return nil, err
+	}
+	if ban != nil {
+		decision.Allowed = false
+		decision.Reason = "banned until " + ban.ExpiresAt.Format(time.RFC3339) + ": " + ban.Reason
+		return decision, nil
+	}
+
+	rule := compiled.groups[group]
+	if len(rule.allowCountries) > 0 || len(rule.denyCountries) > 0 {
+		decision.Country = geoCountry(client)
+	}
+
+	if reason := rule.check(client, decision.Country); reason != "" {
+		decision.Allowed = false
+		decision.Reason = reason
+		recordAccessDenial(group, decision)
+	}
+
+	return decision, nil
+}
+
+// check returns why addr is refused, or "" if it is admitted.
+func (r accessRule) check(addr netip.Addr, country string) string {
+	for _, prefix := range r.deny {
+		if prefix.Contains(addr) {
+			return "address is denied"
+		}
+	}
+
+	if len(r.allow) > 0 {
+		allowed := false
+		for _, prefix := range r.allow {
+			if prefix.Contains(addr) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "address is not allowed"
+		}
+	}
+
+	if r.denyCountries[country] {
+		return fmt.Sprintf("country %s is denied", country)
+	}
+	if len(r.allowCountries) > 0 && !r.allowCountries[country] {
+		if country == "" {
+			return "country is unknown"
+		}
+		return fmt.Sprintf("country %s is not allowed", country)
+	}
+
+	return ""
+}
+
+// clientAddr takes the client to be the peer address, or, when the peer is a
+// trusted proxy, the nearest address in X-Forwarded-For that is not one.
+// Entries further left were written by the client and could be forged.
+func (a *compiledAccess) clientAddr(remoteAddr, forwardedFor string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	client := peer.Unmap()
+
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0 && a.trusted(client); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+	}
+
+	return client, true
+}
+
+// isTrustedProxy reports whether client is one of the policy's trusted
+// proxies.
+func isTrustedProxy(client string) bool {
+	addr, err := netip.ParseAddr(client)
+	if err != nil {
+		return false
+	}
+
+	accessMu.Lock()
+	compiled := access
+	accessMu.Unlock()
+
+	return compiled != nil && compiled.trusted(addr.Unmap())
+}
+
+func (a *compiledAccess) trusted(addr netip.Addr) bool {
+	for _, prefix := range a.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func recordAccessDenial(group string, decision *AccessDecision) {
+	key := group + " " + decision.Client
+
+	accessMu.Lock()
+	now := time.Now()
+	for k, at := range accessDenials {
+		if now.Sub(at) > time.Minute {
+			delete(accessDenials, k)
+		}
+	}
+	_, recent := accessDenials[key]
+	if !recent {
+		accessDenials[key] = now
+	}
+	accessMu.Unlock()
+
+	if recent {
+		log.Printf("access denied to %s for %s: %s", decision.Client, group, decision.Reason)
+		return
+	}
+
+	details := map[string]interface{}{"group": group, "client": decision.Client, "reason": decision.Reason}
+	if decision.Country != "" {
+		details["country"] = decision.Country
+	}
+	recordAudit("access.denied", fmt.Sprintf("%s refused access to %s routes: %s", decision.Client, group, decision.Reason), details)
+}
+
+func compileAccess(policy AccessPolicy) (*compiledAccess, error) {
+	compiled := &compiledAccess{groups: map[string]accessRule{}}
+
+	var err error
+	if compiled.proxies, err = parsePrefixes("trusted_proxies", policy.TrustedProxies); err != nil {
+		return nil, err
+	}
+
+	rules := map[string]AccessRule{
+		AccessRead:    policy.Read,
+		AccessSigning: policy.Signing,
+		AccessAdmin:   policy.Admin,
+	}
+	for group, rule := range rules {
+		var compiledRule accessRule
+		if compiledRule.allow, err = parsePrefixes(group+" allow", rule.Allow); err != nil {
+			return nil, err
+		}
+		if compiledRule.deny, err = parsePrefixes(group+" deny", rule.Deny); err != nil {
+			return nil, err
+		}
+		if compiledRule.allowCountries, err = parseCountries(group+" allow_countries", rule.AllowCountries); err != nil {
+			return nil, err
+		}
+		if compiledRule.denyCountries, err = parseCountries(group+" deny_countries", rule.DenyCountries); err != nil {
+			return nil, err
+		}
+		compiled.groups[group] = compiledRule
+	}
+
+	return compiled, nil
+}
+
+func parsePrefixes(field string, networks []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, network := range networks {
+		if addr, err := netip.ParseAddr(network); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %q is not an address or CIDR", ErrInvalidAccessPolicy, field, network)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func parseCountries(field string, codes []string) (map[string]bool, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	if geoIP == nil {
+		return nil, fmt.Errorf("%w: %s needs a GeoIP database; set GEOIP_DB", ErrInvalidAccessPolicy, field)
+	}
+
+	countries := map[string]bool{}
+	for _, code := range codes {
+		code = strings.ToUpper(code)
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			return nil, fmt.Errorf("%w: %s %q is not a two-letter country code", ErrInvalidAccessPolicy, field, code)
+		}
+		countries[code] = true
+	}
+
+	return countries, nil
+}
+
+func readAccessPolicy() (*AccessPolicy, error) {
+	var policy AccessPolicy
+	if err := readJSONFile(accessFile, &policy); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// geoRange maps an address range to a country.
+type geoRange struct {
+	start, end netip.Addr
+	country    string
+}
+
+// geoIP is sorted by start address; nil when no database is loaded.
+var geoIP []geoRange
+
+// InitAccessControl loads the GeoIP database and the stored access policy,
+// so that a policy which can no longer be applied, such as country rules
+// without GEOIP_DB, stops startup rather than every request.
+func InitAccessControl() error {
+	if err := loadGeoIP(); err != nil {
+		return err
+	}
+
+	accessMu.Lock()
+	defer accessMu.Unlock()
+
+	policy, err := readAccessPolicy()
+	if err != nil {
+		return err
+	}
+	access, err = compileAccess(*policy)
+	return err
+}
+
+// loadGeoIP loads the country database named by GEOIP_DB, a CSV file of
+// start address, end address and country code per line, as published by
+// DB-IP "IP to Country Lite" and similar. A CIDR in the first column with the
+// country in the second is accepted too. Without GEOIP_DB, country rules
+// cannot be set.
+func loadGeoIP() error {
+	path := os.Getenv("GEOIP_DB")
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	var ranges []geoRange
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		r, err := parseGeoRecord(record)
+		if err != nil {
+			return fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		ranges = append(ranges, r)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start.Less(ranges[j].start) })
+	geoIP = ranges
+	log.Printf("loaded %d GeoIP ranges from %s", len(ranges), path)
+	return nil
+}
+
+func parseGeoRecord(record []string) (geoRange, error) {
+	switch len(record) {
+	case 2:
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(record[0]))
+		if err != nil {
+			return geoRange{}, err
+		}
+		prefix = prefix.Masked()
+		return geoRange{start: prefix.Addr(), end: lastAddr(prefix), country: strings.ToUpper(strings.TrimSpace(record[1]))}, nil
+
+	case 3:
+		start, err := netip.ParseAddr(strings.TrimSpace(record[0]))
+		if err != nil {
+			return geoRange{}, err
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(record[1]))
+		if err != nil {
+			return geoRange{}, err
+		}
+		if start.Is4() != end.Is4() || end.Less(start) {
+			return geoRange{}, fmt.Errorf("invalid range %s-%s", start, end)
+		}
+		return geoRange{start: start, end: end, country: strings.ToUpper(strings.TrimSpace(record[2]))}, nil
+	}
+
+	return geoRange{}, fmt.Errorf("expected 2 or 3 fields, got %d", len(record))
+}
+
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
+
+// geoCountry returns the country of addr, or "" if it is not in the
+// database. Ranges are assumed not to overlap.
+func geoCountry(addr netip.Addr) string {
+	i := sort.Search(len(geoIP), func(i int) bool { return addr.Less(geoIP[i].start) })
+	if i == 0 {
+		return ""
+	}
+
+	r := geoIP[i-1]
+	if r.start.Is4() == addr.Is4() && !r.end.Less(addr) {
+		return r.country
+	}
+	return ""
+}
@@ -0,0 +1,462 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jabbala-dev/go-wallet/models"
+)
+
+type Account = models.Account
+
+type accountBook struct {
+	Selected string    `json:"selected"`
+	Accounts []Account `json:"accounts"`
+}
+
+var (
+	accountsFile = "accounts.json"
+	keysDir      = "keys"
+	accountsMu   sync.Mutex
+)
+
+var (
+	ErrAccountNotFound   = errors.New("account not found")
+	ErrAccountExists     = errors.New("account already exists")
+	ErrAccountNameTaken  = errors.New("account name is already in use")
+	ErrNoAccountSelected = errors.New("no account is selected")
+)
+
+func ListAccounts() ([]Account, string, error) {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	book, err := readAccountBook()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return book.Accounts, book.Selected, nil
+}
+
+// CreateAccount creates and selects an account with a new key, made in the
+// active key store.
+func CreateAccount(name, password string) (Account, error) {
+	store, err := ActiveKeyStore()
+	if err != nil {
+		return Account{}, err
+	}
+	address, storeKey, err := store.CreateKey(password)
+	if err != nil {
+		return Account{}, err
+	}
+
+	return addAccountEntry(name, address, true, storeKey)
+}
+
+// ImportAccount adds an existing key, encrypted under password, without
+// changing the selected account, unless no account is selected yet.
+func ImportAccount(name string, privateKey *ecdsa.PrivateKey, password string) (Account, error) {
+	return addAccount(name, privateKey, password, false)
+}
+
+// AddWatchOnlyAccount adds an address whose key the wallet does not hold,
+// without selecting it unless no account is selected yet. Its balance,
+// history and incoming transactions are followed like any account's, but it
+// cannot sign.
+func AddWatchOnlyAccount(name, address string) (Account, error) {
+	if !common.IsHexAddress(address) {
+		return Account{}, fmt.Errorf("invalid address %q", address)
+	}
+
+	account, err := addBookEntry(Account{Name: name, Address: common.HexToAddress(address).Hex(), WatchOnly: true}, false, nil)
+	if err != nil {
+		return Account{}, err
+	}
+
+	recordAudit("account.watch_only", "added watch-only account "+account.Name+" ("+account.Address+")",
+		map[string]interface{}{"address": account.Address, "name": account.Name})
+	return account, nil
+}
+
+func SelectAccount(address string) error {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	book, err := readAccountBook()
+	if err != nil {
+		return err
+	}
+
+	account, ok := book.find(address)
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	book.Selected = account.Address
+	return writeJSONFile(accountsFile, book)
+}
+
+// RenameAccount renames an account, given by address or name.
+func RenameAccount(account, name string) (Account, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Account{}, errors.New("account name is required")
+	}
+
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	book, err := readAccountBook()
+	if err != nil {
+		return Account{}, err
+	}
+	target, err := book.resolve(account)
+	if err != nil {
+		return Account{}, err
+	}
+	if other, ok := book.findName(name); ok && other.Address != target.Address {
+		return Account{}, fmt.Errorf("%w: %s", ErrAccountNameTaken, name)
+	}
+
+	for i := range book.Accounts {
+		if book.Accounts[i].Address == target.Address {
+			book.Accounts[i].Name = name
+			target = book.Accounts[i]
+		}
+	}
+	if err := writeJSONFile(accountsFile, book); err != nil {
+		return Account{}, err
+	}
+
+	return target, nil
+}
+
+// DeleteAccount removes an account and its key files for good. If it was
+// selected, the first account left is selected instead. An HD address only
+// leaves the book, its key being derived from the HD account's seed.
+func DeleteAccount(account string) (Account, error) {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	book, err := readAccountBook()
+	if err != nil {
+		return Account{}, err
+	}
+	target, err := book.resolve(account)
+	if err != nil {
+		return Account{}, err
+	}
+	address := common.HexToAddress(target.Address)
+
+	for _, path := range []string{keystorePath(address), accountKeyPath(target.Address)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return Account{}, err
+		}
+	}
+	if err := removeKeyRef(address); err != nil {
+		return Account{}, err
+	}
+	unlockedMu.Lock()
+	delete(unlockedKeys, address)
+	unlockedMu.Unlock()
+
+	kept := book.Accounts[:0]
+	for _, candidate := range book.Accounts {
+		if candidate.Address != target.Address {
+			kept = append(kept, candidate)
+		}
+	}
+	book.Accounts = kept
+	if book.Selected == target.Address {
+		book.Selected = ""
+		if len(book.Accounts) > 0 {
+			book.Selected = book.Accounts[0].Address
+		}
+	}
+	if err := writeJSONFile(accountsFile, book); err != nil {
+		return Account{}, err
+	}
+
+	recordAudit("account.deleted", "deleted account "+target.Name+" ("+target.Address+")",
+		map[string]interface{}{"address": target.Address, "name": target.Name})
+	return target, nil
+}
+
+// AccountAddress resolves an account given by address or name, the selected
+// account if empty.
+func AccountAddress(account string) (string, error) {
+	if account == "" {
+		return SelectedAddress()
+	}
+
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	book, err := readAccountBook()
+	if err != nil {
+		return "", err
+	}
+	target, err := book.resolve(account)
+	if err != nil {
+		return "", err
+	}
+
+	return target.Address, nil
+}
+
+func SelectedAddress() (string, error) {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	book, err := readAccountBook()
+	if err != nil {
+		return "", err
+	}
+
+	if book.Selected == "" {
+		return "", ErrNoAccountSelected
+	}
+
+	return book.Selected, nil
+}
+
+func addAccount(name string, privateKey *ecdsa.PrivateKey, password string, selectAccount bool) (Account, error) {
+	store, err := ActiveKeyStore()
+	if err != nil {
+		return Account{}, err
+	}
+	storeKey, err := store.ImportKey(privateKey, password)
+	if err != nil {
+		return Account{}, err
+	}
+
+	return addAccountEntry(name, addressOf(privateKey), selectAccount, storeKey)
+}
+
+// addAccountEntry adds an account to the book, first storing its key with
+// storeKey unless the key is kept elsewhere, as HD addresses' are.
+func addAccountEntry(name string, addr common.Address, selectAccount bool, storeKey func() error) (Account, error) {
+	return addBookEntry(Account{Name: name, Address: addr.Hex()}, selectAccount, storeKey)
+}
+
+func addBookEntry(account Account, selectAccount bool, storeKey func() error) (Account, error) {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	book, err := readAccountBook()
+	if err != nil {
+		return Account{}, err
+	}
+
+	address := account.Address
+	if _, ok := book.find(address); ok {
+		return Account{}, fmt.Errorf("%w: %s", ErrAccountExists, address)
+	}
+
+	account.Name = book.uniqueName(account.Name)
+
+	if storeKey != nil {
+		if err := storeKey(); err != nil {
+			return Account{}, err
+		}
+	}
+
+	book.Accounts = append(book.Accounts, account)
+	if selectAccount || book.Selected == "" {
+		book.Selected = address
+	}
+
+	if err := writeJSONFile(accountsFile, book); err != nil {
+		return Account{}, err
+	}
+
+	return account, nil
+}
+
+// loadAccountKey returns the key an account signs with: unlocked from the
+// keystore, derived from its HD account's seed, or read from a key file
+// predating the keystore.
+func loadAccountKey(address string) (*ecdsa.PrivateKey, error) {
+	account := common.HexToAddress(address)
+	if privateKey, ok := unlockedAccountKey(account); ok {
+		return privateKey, nil
+	}
+	if _, err := os.Stat(keystorePath(account)); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAccountLocked, account.Hex())
+	}
+
+	if _, err := os.Stat(accountKeyPath(address)); err == nil {
+		return readPlaintextKey(account)
+	}
+
+	if privateKey, err := hdAddressKey(account); privateKey != nil || err != nil {
+		return privateKey, err
+	}
+
+	if hardware, err := findHardwareAccount(account); hardware != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrHardwareAccount, account.Hex())
+	}
+
+	if ref, err := findKeyRef(account); ref != nil || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s is in the %s key store", ErrRemoteKey, account.Hex(), ref.Store)
+	}
+
+	if watchOnly, err := isWatchOnly(account); watchOnly || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrWatchOnly, account.Hex())
+	}
+
+	return nil, fmt.Errorf("%w: no key is held for %s", ErrAccountNotFound, account.Hex())
+}
+
+// isWatchOnly reports whether address is a watch-only account.
+func isWatchOnly(address common.Address) (bool, error) {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+
+	book, err := readAccountBook()
+	if err != nil {
+		return false, err
+	}
+	account, ok := book.find(address.Hex())
+
+	return ok && account.WatchOnly, nil
+}
+
+func writeAccountKey(address string, privateKey *ecdsa.PrivateKey) error {
+	privateKeyHex := hex.EncodeToString(crypto.FromECDSA(privateKey))
+	return writeKeyFile(accountKeyPath(address), []byte(privateKeyHex))
+}
+
+func accountKeyPath(address string) string {
+	return filepath.Join(keysDir, strings.ToLower(common.HexToAddress(address).Hex())+".txt")
+}
+
+// readAccountBook must be called with accountsMu held. A legacy
+// private_key.txt is moved into the book the first time it is read. Its key
+// stays in plain text, there being no password for it yet, until it is
+// moved into the keystore with EncryptAccountKey.
+func readAccountBook() (*accountBook, error) {
+	book := &accountBook{}
+	err := readJSONFile(accountsFile, book)
+	if err == nil {
+		return book, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	privateKeyHex, err := os.ReadFile(privateKeyFile)
+	if os.IsNotExist(err) {
+		return book, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyBytes, err := hex.DecodeString(strings.TrimSpace(string(privateKeyHex)))
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := crypto.ToECDSA(privateKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	address := crypto.PubkeyToAddress(privateKey.PublicKey).Hex()
+	if err := writeAccountKey(address, privateKey); err != nil {
+		return nil, err
+	}
+
+	book.Accounts = []Account{{Name: "Account 1", Address: address}}
+	book.Selected = address
+
+	if err := writeJSONFile(accountsFile, book); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(privateKeyFile); err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+func (b *accountBook) find(address string) (Account, bool) {
+	if !common.IsHexAddress(address) {
+		return Account{}, false
+	}
+
+	target := common.HexToAddress(address)
+	for _, account := range b.Accounts {
+		if common.HexToAddress(account.Address) == target {
+			return account, true
+		}
+	}
+
+	return Account{}, false
+}
+
+func (b *accountBook) findName(name string) (Account, bool) {
+	for _, account := range b.Accounts {
+		if strings.EqualFold(account.Name, name) {
+			return account, true
+		}
+	}
+
+	return Account{}, false
+}
+
+// uniqueName returns name, numbered if another account has it already, as
+// HD addresses and imports from labels can. An empty name becomes the next
+// free "Account N".
+func (b *accountBook) uniqueName(name string) string {
+	if name == "" {
+		for n := len(b.Accounts) + 1; ; n++ {
+			if _, taken := b.findName(fmt.Sprintf("Account %d", n)); !taken {
+				return fmt.Sprintf("Account %d", n)
+			}
+		}
+	}
+
+	unique := name
+	for n := 2; ; n++ {
+		if _, taken := b.findName(unique); !taken {
+			return unique
+		}
+		unique = fmt.Sprintf("%s (%d)", name, n)
+	}
+}
+
+// resolve finds an account by address or name, the selected account if
+// selector is empty.
+func (b *accountBook) resolve(selector string) (Account, error) {
+	if selector == "" {
+		selector = b.Selected
+	}
+	if account, ok := b.find(selector); ok {
+		return account, nil
+	}
+	if account, ok := b.findName(selector); ok {
+		return account, nil
+	}
+
+	return Account{}, ErrAccountNotFound
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AddressBookEntry names an address the wallet sends to. Labels group
+// entries, such as "payroll" or "vendor", for listing. An entry without a
+// chain ID applies on every chain.
+type AddressBookEntry struct {
+	Address   string    `json:"address"`
+	Name      string    `json:"name"`
+	ChainID   uint64    `json:"chain_id,omitempty"`
+	Labels    []string  `json:"labels,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var (
+	addressBookFile = "address_book.json"
+	addressBookMu   sync.Mutex
+)
+
+var (
+	ErrAddressBookEntryNotFound = errors.New("address book entry not found")
+	ErrInvalidAddressBookEntry  = errors.New("invalid address book entry")
+	ErrNotInAddressBook         = fmt.Errorf("%w: only addresses in the address book can be sent to", ErrPolicyViolation)
+)
+
+// ListAddressBook returns the entries by name, those with label only if it
+// is given.
+func ListAddressBook(label string) ([]*AddressBookEntry, error) {
+	addressBookMu.Lock()
+	defer addressBookMu.Unlock()
+
+	entries, err := readAddressBook()
+	if err != nil {
+		return nil, err
+	}
+	if label == "" {
+		return entries, nil
+	}
+
+	var labelled []*AddressBookEntry
+	for _, entry := range entries {
+		if hasLabel(entry.Labels, label) {
+			labelled = append(labelled, entry)
+		}
+	}
+
+	return labelled, nil
+}
+
+// GetAddressBookEntries returns an address's entries, one per chain it was
+// saved for.
+func GetAddressBookEntries(address string) ([]*AddressBookEntry, error) {
+	addressBookMu.Lock()
+	defer addressBookMu.Unlock()
+
+	entries, err := readAddressBook()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*AddressBookEntry
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Address, address) {
+			found = append(found, entry)
+		}
+	}
+	if len(found) == 0 {
+		return nil, ErrAddressBookEntryNotFound
+	}
+
+	return found, nil
+}
+
+// SaveAddressBookEntry adds an entry, or replaces the one for the same
+// address and chain, keeping when it was first created.
+func SaveAddressBookEntry(entry AddressBookEntry) (*AddressBookEntry, error) {
+	if !common.IsHexAddress(entry.Address) {
+		return nil, fmt.Errorf("%w: %q is not an address", ErrInvalidAddressBookEntry, entry.Address)
+	}
+	entry.Name = strings.TrimSpace(entry.Name)
+	if entry.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidAddressBookEntry)
+	}
+	labels := entry.Labels[:0]
+	for _, label := range entry.Labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label == "" {
+			return nil, fmt.Errorf("%w: labels cannot be empty", ErrInvalidAddressBookEntry)
+		}
+		if !hasLabel(labels, label) {
+			labels = append(labels, label)
+		}
+	}
+	entry.Labels = labels
+	entry.Address = common.HexToAddress(entry.Address).Hex()
+	entry.CreatedAt = time.Now().UTC()
+	entry.UpdatedAt = entry.CreatedAt
+
+	addressBookMu.Lock()
+	defer addressBookMu.Unlock()
+
+	entries, err := readAddressBook()
+	if err != nil {
+		return nil, err
+	}
+
+	kept := entries[:0]
+	for _, existing := range entries {
+		if existing.Address == entry.Address && existing.ChainID == entry.ChainID {
+			entry.CreatedAt = existing.CreatedAt
+			continue
+		}
+		kept = append(kept, existing)
+	}
+	kept = append(kept, &entry)
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Name < kept[j].Name })
+
+	if err := writeJSONFile(addressBookFile, kept); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// DeleteAddressBookEntry removes an address's entry for chainID, or its
+// entries on every chain if chainID is nil.
+func DeleteAddressBookEntry(address string, chainID *uint64) error {
+	addressBookMu.Lock()
+	defer addressBookMu.Unlock()
+
+	entries, err := readAddressBook()
+	if err != nil {
+		return err
+	}
+
+	kept := entries[:0]
+	for _, existing := range entries {
+		if !strings.EqualFold(existing.Address, address) || (chainID != nil && existing.ChainID != *chainID) {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) == len(entries) {
+		return ErrAddressBookEntryNotFound
+	}
+
+	return writeJSONFile(addressBookFile, kept)
+}
+
+// checkAddressBook refuses a send to an address with no entry for the
+// chain when the policy allows sends to the address book only.
+func checkAddressBook(chain *Chain, to common.Address) error {
+	policy, err := GetPolicy()
+	if err != nil || !policy.AddressBookOnly {
+		return err
+	}
+
+	addressBookMu.Lock()
+	entries, err := readAddressBook()
+	addressBookMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Address == to.Hex() && (entry.ChainID == 0 || entry.ChainID == chain.ID.Uint64()) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w (%s)", ErrNotInAddressBook, to.Hex())
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, existing := range labels {
+		if strings.EqualFold(existing, label) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readAddressBook() ([]*AddressBookEntry, error) {
+	var entries []*AddressBookEntry
+	if err := readJSONFile(addressBookFile, &entries); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return entries, nil
+}
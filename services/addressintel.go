@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The same address can be a contract on one chain and a plain account on
+// another: a Safe or smart account deployed from a factory exists only where
+// it was deployed, and a contract's address on another chain may belong to
+// someone else, or to no one. Funds sent to it there are usually lost, so a
+// preview warns when the recipient is not the same kind of account on every
+// configured chain.
+//
+// What each chain's node says about an address is kept in an observation
+// cache fed by every code lookup the wallet makes (policy checks, token
+// checks, previews and delegation checks all go through isContract), and
+// previews probe the chains not yet observed.
+
+const (
+	// Code can appear at an address at any time, with a counterfactual
+	// deployment, but rarely goes away.
+	accountObservationTTL  = 10 * time.Minute
+	contractObservationTTL = 24 * time.Hour
+
+	maxAddressObservations = 10000
+	crossChainProbeTimeout = 3 * time.Second
+)
+
+const (
+	WarningContractOnOtherChain = "contract_on_other_chain"
+	WarningAccountOnOtherChain  = "account_on_other_chain"
+)
+
+// AddressObservation is what one chain's node reported about an address.
+// Error is set instead when the chain could not be asked.
+type AddressObservation struct {
+	ChainID    uint64     `json:"chain_id"`
+	Chain      string     `json:"chain"`
+	Contract   bool       `json:"contract"`
+	ObservedAt *time.Time `json:"observed_at,omitempty"`
+	Error      string     `json:"lookup_error,omitempty"`
+}
+
+// AddressWarning flags a recipient that is a different kind of account on
+// other configured chains than on the chain a transaction is for.
+type AddressWarning struct {
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	ChainIDs []uint64 `json:"chain_ids"`
+}
+
+var (
+	addressObservationsMu sync.Mutex
+	addressObservations   = map[contractKey]AddressObservation{}
+)
+
+// ProfileAddress reports, for every configured chain, whether address is a
+// contract there.
+func ProfileAddress(address string) ([]AddressObservation, error) {
+	if !common.IsHexAddress(address) {
+		return nil, errors.New("invalid address")
+	}
+
+	chains, err := chainRegistry(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return observeAcrossChains(chains, common.HexToAddress(address)), nil
+}
+
+// crossChainWarnings compares what address is on chain, contract or not,
+// with what it is on the other configured chains. Chains that cannot be
+// asked are left out rather than failing the preview.
+func crossChainWarnings(chain *Chain, address common.Address, contract bool) []AddressWarning {
+	chains, err := chainRegistry(context.Background())
+	if err != nil {
+		return nil
+	}
+
+	var others []*Chain
+	for _, other := range chains {
+		if other.ID.Cmp(chain.ID) != 0 {
+			others = append(others, other)
+		}
+	}
+
+	var differ []uint64
+	var names []string
+	for _, observation := range observeAcrossChains(others, address) {
+		if observation.Error == "" && observation.Contract != contract {
+			differ = append(differ, observation.ChainID)
+			names = append(names, fmt.Sprintf("%s (%d)", observation.Chain, observation.ChainID))
+		}
+	}
+	if len(differ) == 0 {
+		return nil
+	}
+
+	if contract {
+		return []AddressWarning{{
+			Code:     WarningAccountOnOtherChain,
+			Message:  "the recipient is a contract on this chain but has no code on " + strings.Join(names, ", ") + "; check that the address was meant for this chain",
+			ChainIDs: differ,
+		}}
+	}
+	return []AddressWarning{{
+		Code:     WarningContractOnOtherChain,
+		Message:  "the recipient has no code on this chain but is a contract on " + strings.Join(names, ", ") + "; a contract wallet such as a Safe may not exist here, and funds sent to its address may not be recoverable",
+		ChainIDs: differ,
+	}}
+}
+
+// observeAcrossChains uses cached observations where they are fresh and asks
+// the other chains' nodes in parallel.
+func observeAcrossChains(chains []*Chain, address common.Address) []AddressObservation {
+	observations := make([]AddressObservation, len(chains))
+
+	var wg sync.WaitGroup
+	for i, chain := range chains {
+		if observation, ok := cachedObservation(chain, address); ok {
+			observations[i] = observation
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), crossChainProbeTimeout)
+			defer cancel()
+
+			contract, err := isContract(ctx, chain, address)
+			if err != nil {
+				observations[i] = AddressObservation{ChainID: chain.ID.Uint64(), Chain: chain.Name, Error: err.Error()}
+				return
+			}
+			observations[i] = newObservation(chain, contract)
+		}()
+	}
+	wg.Wait()
+
+	return observations
+}
+
+// observeAddress records what chain's node reported about address.
+func observeAddress(chain *Chain, address common.Address, contract bool) {
+	addressObservationsMu.Lock()
+	defer addressObservationsMu.Unlock()
+
+	if len(addressObservations) >= maxAddressObservations {
+		pruneAddressObservations()
+	}
+	addressObservations[contractKey{chain.ID.String(), address}] = newObservation(chain, contract)
+}
+
+func newObservation(chain *Chain, contract bool) AddressObservation {
+	now := time.Now().UTC()
+	return AddressObservation{ChainID: chain.ID.Uint64(), Chain: chain.Name, Contract: contract, ObservedAt: &now}
+}
+
+func cachedObservation(chain *Chain, address common.Address) (AddressObservation, bool) {
+	addressObservationsMu.Lock()
+	defer addressObservationsMu.Unlock()
+
+	observation, ok := addressObservations[contractKey{chain.ID.String(), address}]
+	if !ok || observation.expired() {
+		return AddressObservation{}, false
+	}
+
+	return observation, true
+}
+
+func (o AddressObservation) expired() bool {
+	ttl := accountObservationTTL
+	if o.Contract {
+		ttl = contractObservationTTL
+	}
+
+	return time.Since(*o.ObservedAt) > ttl
+}
+
+// pruneAddressObservations must be called with addressObservationsMu held.
+// If nothing has expired, arbitrary entries are dropped to make room.
+func pruneAddressObservations() {
+	for key, observation := range addressObservations {
+		if observation.expired() {
+			delete(addressObservations, key)
+		}
+	}
+	for key := range addressObservations {
+		if len(addressObservations) < maxAddressObservations {
+			break
+		}
+		delete(addressObservations, key)
+	}
+}
@@ -0,0 +1,379 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Airdrops are claimed from a Merkle distributor in the style of Uniswap's
+// MerkleDistributor: each entitled address has an index and an amount,
+// proven against the contract's merkleRoot by a proof from the airdrop's
+// proof file. Anyone may submit a claim and the tokens always go to the
+// entitled address, so the selected account pays the gas for claims of any
+// of the wallet's addresses, several at once through Multicall3.
+
+const merkleDistributorABIJSON = `[
+	{"type":"function","name":"token","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"merkleRoot","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+	{"type":"function","name":"isClaimed","stateMutability":"view","inputs":[{"name":"index","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"claim","stateMutability":"nonpayable","inputs":[{"name":"index","type":"uint256"},{"name":"account","type":"address"},{"name":"amount","type":"uint256"},{"name":"merkleProof","type":"bytes32[]"}],"outputs":[]}
+]`
+
+const multicall3ABIJSON = `[
+	{"type":"function","name":"aggregate3","stateMutability":"payable","inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],"outputs":[{"name":"returnData","type":"tuple[]","components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}]}
+]`
+
+// multicall3Address is where Multicall3 is deployed on most chains.
+const multicall3Address = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+// maxBatchClaims bounds the claims packed into one transaction, to keep it
+// well within a block's gas limit.
+const maxBatchClaims = 50
+
+var (
+	merkleDistributorABI = mustParseABI(merkleDistributorABIJSON)
+	multicall3ABI        = mustParseABI(multicall3ABIJSON)
+)
+
+var (
+	ErrInvalidAirdropProofs = errors.New("invalid airdrop proof file")
+	ErrAirdropRootMismatch  = errors.New("proof file is for a different merkle root than the distributor's")
+	ErrNothingToClaim       = errors.New("no address has an unclaimed airdrop")
+)
+
+// AirdropProofs is an airdrop's proof file, in the format written by
+// Uniswap's merkle-distributor generator. Claims are keyed by address.
+type AirdropProofs struct {
+	MerkleRoot string                       `json:"merkleRoot"`
+	Claims     map[string]AirdropClaimProof `json:"claims"`
+}
+
+// AirdropClaimProof is one address's entry in a proof file. Amount is hex
+// with a 0x prefix, as the generator writes it, or decimal.
+type AirdropClaimProof struct {
+	Index  uint64   `json:"index"`
+	Amount string   `json:"amount"`
+	Proof  []string `json:"proof"`
+}
+
+// AirdropCheck is the eligibility of a set of addresses for an airdrop.
+type AirdropCheck struct {
+	Distributor string               `json:"distributor"`
+	ChainID     uint64               `json:"chain_id"`
+	Token       string               `json:"token"`
+	Symbol      string               `json:"symbol,omitempty"`
+	Decimals    uint8                `json:"decimals,omitempty"`
+	MerkleRoot  string               `json:"merkle_root"`
+	Accounts    []AirdropEligibility `json:"accounts"`
+}
+
+type AirdropEligibility struct {
+	Address       string  `json:"address"`
+	Eligible      bool    `json:"eligible"`
+	Claimed       bool    `json:"claimed"`
+	Index         *uint64 `json:"index,omitempty"`
+	Amount        string  `json:"amount,omitempty"`
+	DisplayAmount string  `json:"display_amount,omitempty"`
+	Reason        string  `json:"reason,omitempty"`
+
+	proof [][32]byte
+}
+
+// AirdropClaim is the outcome of claiming an airdrop: the transactions
+// sent, each claiming for one or, batched, several addresses.
+type AirdropClaim struct {
+	*AirdropCheck
+	Transactions []AirdropClaimTransaction `json:"transactions"`
+}
+
+type AirdropClaimTransaction struct {
+	TxHash    string   `json:"transaction_hash"`
+	Addresses []string `json:"addresses"`
+	Batched   bool     `json:"batched"`
+}
+
+// CheckAirdrop reports whether each address, every wallet account if none
+// are given, can claim from distributor: whether it is in the proof file,
+// whether its proof holds against the distributor's root, and whether it has
+// been claimed already.
+func CheckAirdrop(chain *Chain, distributor string, proofs AirdropProofs, addresses []string) (*AirdropCheck, error) {
+	if !common.IsHexAddress(distributor) {
+		return nil, errors.New("invalid distributor address")
+	}
+	contract := common.HexToAddress(distributor)
+
+	entries, err := proofs.byAddress()
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		accounts, _, err := ListAccounts()
+		if err != nil {
+			return nil, err
+		}
+		for _, account := range accounts {
+			addresses = append(addresses, account.Address)
+		}
+	}
+
+	out, err := callContract(chain, contract, merkleDistributorABI, "merkleRoot")
+	if err != nil {
+		return nil, fmt.Errorf("merkleRoot() failed: %w", err)
+	}
+	root, ok := out[0].([32]byte)
+	if !ok {
+		return nil, errors.New("unexpected merkleRoot() result")
+	}
+	if proofs.MerkleRoot != "" && common.HexToHash(proofs.MerkleRoot) != common.Hash(root) {
+		return nil, fmt.Errorf("%w: %s", ErrAirdropRootMismatch, common.Hash(root).Hex())
+	}
+
+	out, err = callContract(chain, contract, merkleDistributorABI, "token")
+	if err != nil {
+		return nil, fmt.Errorf("token() failed: %w", err)
+	}
+	token, ok := out[0].(common.Address)
+	if !ok {
+		return nil, errors.New("unexpected token() result")
+	}
+
+	check := &AirdropCheck{
+		Distributor: contract.Hex(),
+		ChainID:     chain.ID.Uint64(),
+		Token:       token.Hex(),
+		MerkleRoot:  common.Hash(root).Hex(),
+	}
+	// Display amounts are a convenience; a token without the metadata views
+	// can still be claimed.
+	metadata, metadataErr := tokenMetadata(chain, token)
+	if metadataErr == nil {
+		check.Symbol, check.Decimals = metadata.Symbol, metadata.Decimals
+	}
+
+	for _, address := range addresses {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("invalid address %q", address)
+		}
+		account := common.HexToAddress(address)
+		eligibility := AirdropEligibility{Address: account.Hex()}
+
+		entry, ok := entries[account]
+		if !ok {
+			eligibility.Reason = "not in the proof file"
+			check.Accounts = append(check.Accounts, eligibility)
+			continue
+		}
+		index := entry.index
+		eligibility.Index = &index
+		eligibility.Amount = entry.amount.String()
+		if metadataErr == nil {
+			eligibility.DisplayAmount = FormatTokenAmount(entry.amount, metadata.Decimals)
+		}
+
+		if merkleLeafRoot(entry.index, account, entry.amount, entry.proof) != root {
+			eligibility.Reason = "proof does not match the distributor's merkle root"
+			check.Accounts = append(check.Accounts, eligibility)
+			continue
+		}
+
+		out, err := callContract(chain, contract, merkleDistributorABI, "isClaimed", new(big.Int).SetUint64(entry.index))
+		if err != nil {
+			return nil, fmt.Errorf("isClaimed() failed: %w", err)
+		}
+		claimed, ok := out[0].(bool)
+		if !ok {
+			return nil, errors.New("unexpected isClaimed() result")
+		}
+
+		eligibility.Eligible = true
+		eligibility.Claimed = claimed
+		eligibility.proof = entry.proof
+		check.Accounts = append(check.Accounts, eligibility)
+	}
+
+	return check, nil
+}
+
+// ClaimAirdrop claims the unclaimed airdrops of addresses, as CheckAirdrop
+// finds them, from the selected account. Where Multicall3 is deployed the
+// claims are batched into as few transactions as possible; otherwise each is
+// its own transaction. Claims already sent when one fails are kept.
+func ClaimAirdrop(chain *Chain, distributor string, proofs AirdropProofs, addresses []string) (*AirdropClaim, error) {
+	signer, err := loadSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	check, err := CheckAirdrop(chain, distributor, proofs, addresses)
+	if err != nil {
+		return nil, err
+	}
+	contract := common.HexToAddress(check.Distributor)
+
+	var claimable []AirdropEligibility
+	for _, eligibility := range check.Accounts {
+		if eligibility.Eligible && !eligibility.Claimed {
+			claimable = append(claimable, eligibility)
+		}
+	}
+	if len(claimable) == 0 {
+		return nil, ErrNothingToClaim
+	}
+
+	calls := make([][]byte, len(claimable))
+	for i, eligibility := range claimable {
+		amount, _ := new(big.Int).SetString(eligibility.Amount, 10)
+		calls[i], err = merkleDistributorABI.Pack("claim", new(big.Int).SetUint64(*eligibility.Index),
+			common.HexToAddress(eligibility.Address), amount, eligibility.proof)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	batch := 1
+	if len(claimable) > 1 {
+		deployed, err := isContract(context.Background(), chain, multicall3())
+		if err != nil {
+			return nil, err
+		}
+		if deployed {
+			batch = maxBatchClaims
+		}
+	}
+
+	claim := &AirdropClaim{AirdropCheck: check}
+	for start := 0; start < len(claimable); start += batch {
+		end := min(start+batch, len(claimable))
+
+		to, data := contract, calls[start]
+		if end-start > 1 {
+			to = multicall3()
+			if data, err = multicallData(contract, calls[start:end]); err != nil {
+				return claim, err
+			}
+		}
+
+		txHash, err := sendContractTransaction(chain, signer, to, big.NewInt(0), data)
+		if err != nil {
+			return claim, fmt.Errorf("claiming for %s: %w", claimable[start].Address, err)
+		}
+
+		sent := AirdropClaimTransaction{TxHash: txHash, Batched: end-start > 1}
+		for _, eligibility := range claimable[start:end] {
+			sent.Addresses = append(sent.Addresses, eligibility.Address)
+		}
+		claim.Transactions = append(claim.Transactions, sent)
+
+		recordAudit("airdrop.claimed", fmt.Sprintf("claimed airdrop from %s for %d addresses", check.Distributor, len(sent.Addresses)),
+			map[string]interface{}{"distributor": check.Distributor, "addresses": sent.Addresses, "tx_hash": txHash, "chain_id": check.ChainID})
+	}
+
+	return claim, nil
+}
+
+type airdropEntry struct {
+	index  uint64
+	amount *big.Int
+	proof  [][32]byte
+}
+
+// byAddress parses the claims of a proof file, keyed by address.
+func (p AirdropProofs) byAddress() (map[common.Address]airdropEntry, error) {
+	if len(p.Claims) == 0 {
+		return nil, fmt.Errorf("%w: no claims", ErrInvalidAirdropProofs)
+	}
+
+	entries := make(map[common.Address]airdropEntry, len(p.Claims))
+	for address, claim := range p.Claims {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("%w: invalid address %q", ErrInvalidAirdropProofs, address)
+		}
+
+		amount, ok := parseAirdropAmount(claim.Amount)
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid amount for %s", ErrInvalidAirdropProofs, address)
+		}
+
+		proof := make([][32]byte, len(claim.Proof))
+		for i, node := range claim.Proof {
+			raw := common.FromHex(node)
+			if len(raw) != 32 {
+				return nil, fmt.Errorf("%w: invalid proof for %s", ErrInvalidAirdropProofs, address)
+			}
+			copy(proof[i][:], raw)
+		}
+
+		entries[common.HexToAddress(address)] = airdropEntry{index: claim.Index, amount: amount, proof: proof}
+	}
+
+	return entries, nil
+}
+
+func parseAirdropAmount(value string) (*big.Int, bool) {
+	value = strings.TrimSpace(value)
+	base := 10
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		value, base = value[2:], 16
+	}
+
+	amount, ok := new(big.Int).SetString(value, base)
+	if !ok || amount.Sign() <= 0 {
+		return nil, false
+	}
+
+	return amount, true
+}
+
+// merkleLeafRoot computes the root a claim's proof leads to, as the
+// distributor does: the leaf is keccak256(abi.encodePacked(index, account,
+// amount)), and each pair of nodes is hashed in sorted order.
+func merkleLeafRoot(index uint64, account common.Address, amount *big.Int, proof [][32]byte) [32]byte {
+	packed := make([]byte, 0, 32+20+32)
+	packed = append(packed, common.LeftPadBytes(new(big.Int).SetUint64(index).Bytes(), 32)...)
+	packed = append(packed, account.Bytes()...)
+	packed = append(packed, common.LeftPadBytes(amount.Bytes(), 32)...)
+
+	node := crypto.Keccak256Hash(packed)
+	for _, sibling := range proof {
+		if bytes.Compare(node[:], sibling[:]) <= 0 {
+			node = crypto.Keccak256Hash(node[:], sibling[:])
+		} else {
+			node = crypto.Keccak256Hash(sibling[:], node[:])
+		}
+	}
+
+	return node
+}
+
+// multicallData batches calls to one contract with aggregate3, none allowed
+// to fail, so a batch succeeds or reverts as a whole.
+func multicallData(target common.Address, calls [][]byte) ([]byte, error) {
+	type call3 struct {
+		Target       common.Address
+		AllowFailure bool
+		CallData     []byte
+	}
+
+	batch := make([]call3, len(calls))
+	for i, data := range calls {
+		batch[i] = call3{Target: target, CallData: data}
+	}
+
+	return multicall3ABI.Pack("aggregate3", batch)
+}
+
+func multicall3() common.Address {
+	if raw := os.Getenv("MULTICALL3_ADDRESS"); common.IsHexAddress(raw) {
+		return common.HexToAddress(raw)
+	}
+
+	return common.HexToAddress(multicall3Address)
+}
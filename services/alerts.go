@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	AlertDormantAccount  = "dormant_account_active"
+	AlertSpendingAnomaly = "spending_anomaly"
+)
+
+// Alert is raised for activity an operator should review. Alerts do not
+// block anything on their own, but a send held by policy references one and
+// goes through once that alert is approved.
+type Alert struct {
+	ID           string            `json:"id"`
+	Kind         string            `json:"kind"`
+	Account      string            `json:"account,omitempty"`
+	Message      string            `json:"message"`
+	Transaction  *AlertTransaction `json:"transaction,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Acknowledged bool              `json:"acknowledged"`
+	Approved     bool              `json:"approved,omitempty"`
+	Consumed     bool              `json:"consumed,omitempty"`
+}
+
+type AlertTransaction struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+}
+
+var (
+	alertsFile = "alerts.json"
+	alertsMu   sync.Mutex
+)
+
+var (
+	ErrAlertNotFound      = errors.New("alert not found")
+	ErrAlertNotApprovable = errors.New("alert does not hold a transaction")
+)
+
+func ListAlerts(includeAcknowledged bool) ([]*Alert, error) {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	alerts, err := readAlerts()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*Alert
+	for _, alert := range alerts {
+		if includeAcknowledged || !alert.Acknowledged {
+			matched = append(matched, alert)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	return matched, nil
+}
+
+func AcknowledgeAlert(id string) error {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	alerts, err := readAlerts()
+	if err != nil {
+		return err
+	}
+
+	for _, alert := range alerts {
+		if alert.ID == id {
+			alert.Acknowledged = true
+			return writeJSONFile(alertsFile, alerts)
+		}
+	}
+
+	return ErrAlertNotFound
+}
+
+// ApproveAlert releases the transaction held by an alert for one attempt.
+func ApproveAlert(id string) error {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	alerts, err := readAlerts()
+	if err != nil {
+		return err
+	}
+
+	for _, alert := range alerts {
+		if alert.ID != id {
+			continue
+		}
+		if alert.Transaction == nil || alert.Consumed {
+			return ErrAlertNotApprovable
+		}
+
+		alert.Approved = true
+		alert.Acknowledged = true
+		return writeJSONFile(alertsFile, alerts)
+	}
+
+	return ErrAlertNotFound
+}
+
+// raiseAlert records an alert. Failures are logged rather than returned so
+// alerting never breaks the operation that triggered it.
+func raiseAlert(kind, account, message string) {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	appendAlert(&Alert{Kind: kind, Account: account, Message: message})
+}
+
+// raiseTransactionAlert records an alert about a specific send and returns its
+// ID. An open alert for the same send is reused so retries do not pile up.
+func raiseTransactionAlert(kind string, transaction *AlertTransaction, message string) string {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	alerts, err := readAlerts()
+	if err == nil {
+		for _, alert := range alerts {
+			if alert.Kind == kind && !alert.Acknowledged && alert.Transaction != nil && *alert.Transaction == *transaction {
+				return alert.ID
+			}
+		}
+	}
+
+	alert := &Alert{Kind: kind, Account: transaction.From, Message: message, Transaction: transaction}
+	appendAlert(alert)
+	return alert.ID
+}
+
+// consumeApproval reports whether an approved alert covers this send, and
+// marks it used so the approval applies only once.
+func consumeApproval(kind string, transaction *AlertTransaction) bool {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	alerts, err := readAlerts()
+	if err != nil {
+		log.Printf("failed to read alerts: %v", err)
+		return false
+	}
+
+	for _, alert := range alerts {
+		if alert.Kind != kind || !alert.Approved || alert.Consumed || alert.Transaction == nil || *alert.Transaction != *transaction {
+			continue
+		}
+
+		alert.Consumed = true
+		if err := writeJSONFile(alertsFile, alerts); err != nil {
+			log.Printf("failed to record alert approval use: %v", err)
+			return false
+		}
+		return true
+	}
+
+	return false
+}
+
+// appendAlert must be called with alertsMu held.
+func appendAlert(alert *Alert) {
+	alert.ID = newID()
+	alert.CreatedAt = time.Now().UTC()
+	log.Printf("alert %s: %s", alert.Kind, alert.Message)
+
+	alerts, err := readAlerts()
+	if err != nil {
+		log.Printf("failed to record alert: %v", err)
+		return
+	}
+
+	var accounts []string
+	if alert.Account != "" {
+		accounts = []string{alert.Account}
+	}
+	enqueueEvent(EventAlertRaised, 0, accounts, alert, outboxRef{Store: refAlert, Key: alert.ID})
+
+	alerts = append(alerts, alert)
+	if err := writeJSONFile(alertsFile, alerts); err != nil {
+		log.Printf("failed to record alert: %v", err)
+	}
+}
+
+func readAlerts() ([]*Alert, error) {
+	var alerts []*Alert
+	if err := readJSONFile(alertsFile, &alerts); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return alerts, nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	AnomalyActionAlert           = "alert"
+	AnomalyActionRequireApproval = "require_approval"
+
+	defaultAnomalyValueFactor = 10
+
+	// anomalyMinSamples is how many sends an account needs before its
+	// profile is trusted; until then nothing is flagged.
+	anomalyMinSamples = 5
+
+	// An hour of day accounting for less than this share of past sends is
+	// considered unusual.
+	unusualHourShare = 0.05
+)
+
+// spendingProfile is what has been learned about an account's sends. Sizes
+// are tracked as a running mean of log(value), i.e. a geometric mean, so a
+// few large transfers do not swamp the baseline.
+type spendingProfile struct {
+	Sends       int            `json:"sends"`
+	SizeSamples int            `json:"size_samples"`
+	LogMean     float64        `json:"log_mean"`
+	Recipients  map[string]int `json:"recipients"`
+	Hours       [24]int        `json:"hours"`
+}
+
+var (
+	profilesFile = "spending_profiles.json"
+	profilesMu   sync.Mutex
+)
+
+// AnomalyError is returned when policy requires approval for an outlier
+// send. Approving AlertID lets the same send through once.
+type AnomalyError struct {
+	AlertID string
+	Reasons []string
+}
+
+func (e *AnomalyError) Error() string {
+	return fmt.Sprintf("%s: spending anomaly (%s) requires approval of alert %s",
+		ErrPolicyViolation, strings.Join(e.Reasons, "; "), e.AlertID)
+}
+
+func (e *AnomalyError) Unwrap() error {
+	return ErrPolicyViolation
+}
+
+// checkSpending scores a send against the account's profile and applies the
+// policy's anomaly action.
+func checkSpending(policy *Policy, from, to common.Address, value *big.Int) error {
+	if policy.AnomalyAction == "" {
+		return nil
+	}
+
+	factor := policy.AnomalyValueFactor
+	if factor <= 0 {
+		factor = defaultAnomalyValueFactor
+	}
+
+	profilesMu.Lock()
+	profiles, err := readProfiles()
+	profilesMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	profile, ok := profiles[from.Hex()]
+	if !ok {
+		return nil
+	}
+
+	reasons := profile.anomalies(to, value, factor, time.Now())
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	transaction := &AlertTransaction{From: from.Hex(), To: to.Hex(), Value: value.String()}
+	if policy.AnomalyAction != AnomalyActionRequireApproval {
+		raiseTransactionAlert(AlertSpendingAnomaly, transaction, "unusual send: "+strings.Join(reasons, "; "))
+		return nil
+	}
+
+	if consumeApproval(AlertSpendingAnomaly, transaction) {
+		return nil
+	}
+
+	alertID := raiseTransactionAlert(AlertSpendingAnomaly, transaction, "unusual send held for approval: "+strings.Join(reasons, "; "))
+	return &AnomalyError{AlertID: alertID, Reasons: reasons}
+}
+
+// anomalies flags a send that is much larger than usual, or that goes to a
+// new recipient at an hour the account is rarely active.
+func (p *spendingProfile) anomalies(to common.Address, value *big.Int, factor float64, now time.Time) []string {
+	if p.Sends < anomalyMinSamples {
+		return nil
+	}
+
+	var reasons []string
+	if p.SizeSamples >= anomalyMinSamples && value.Sign() > 0 {
+		typical := math.Exp(p.LogMean)
+		if logValue(value) > p.LogMean+math.Log(factor) {
+			reasons = append(reasons, fmt.Sprintf("value %s wei is over %gx the typical %.0f wei", value, factor, typical))
+		}
+	}
+
+	newRecipient := p.Recipients[to.Hex()] == 0
+	unusualHour := float64(p.Hours[now.Hour()]) < unusualHourShare*float64(p.Sends)
+	if newRecipient && unusualHour {
+		reasons = append(reasons, fmt.Sprintf("new recipient %s at an unusual hour (%02d:00)", to.Hex(), now.Hour()))
+	}
+
+	return reasons
+}
+
+// learnSpending folds a completed send into the sender's profile.
+func learnSpending(from, to common.Address, value *big.Int) {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+
+	profiles, err := readProfiles()
+	if err != nil {
+		log.Printf("failed to update spending profile: %v", err)
+		return
+	}
+
+	profile, ok := profiles[from.Hex()]
+	if !ok {
+		profile = &spendingProfile{Recipients: map[string]int{}}
+		profiles[from.Hex()] = profile
+	}
+
+	profile.Sends++
+	profile.Recipients[to.Hex()]++
+	profile.Hours[time.Now().Hour()]++
+	if value.Sign() > 0 {
+		profile.SizeSamples++
+		profile.LogMean += (logValue(value) - profile.LogMean) / float64(profile.SizeSamples)
+	}
+
+	if err := writeJSONFile(profilesFile, profiles); err != nil {
+		log.Printf("failed to update spending profile: %v", err)
+	}
+}
+
+func logValue(value *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(value).Float64()
+	return math.Log(f)
+}
+
+func readProfiles() (map[string]*spendingProfile, error) {
+	profiles := map[string]*spendingProfile{}
+	if err := readJSONFile(profilesFile, &profiles); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return profiles, nil
+}
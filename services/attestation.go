@@ -0,0 +1,186 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxBatchMessages bounds the messages one batch attestation covers.
+const maxBatchMessages = 50000
+
+var ErrInvalidBatch = errors.New("invalid attestation batch")
+
+// BatchAttestation is one signature over the Merkle root of a batch of
+// messages, with a proof for each message that it is in the batch. A
+// verifier of one message needs only the message, its proof, the root and
+// the signature.
+//
+// The tree is OpenZeppelin's: a leaf is keccak256(keccak256(message)), and
+// a node is the keccak256 of its two children sorted, so MerkleProof.verify
+// checks the proofs on chain. The root is signed as the 32-byte message it
+// is, under the scheme /sign uses.
+type BatchAttestation struct {
+	Root      string             `json:"root"`
+	Signature string             `json:"signature"`
+	Signer    string             `json:"signer"`
+	Scheme    string             `json:"scheme"`
+	Count     int                `json:"count"`
+	Proofs    []AttestationProof `json:"proofs"`
+}
+
+// AttestationProof proves the message at Index of a batch is in its tree.
+type AttestationProof struct {
+	Index int      `json:"index"`
+	Leaf  string   `json:"leaf"`
+	Proof []string `json:"proof"`
+}
+
+// SignBatchAttestation signs the Merkle root of messages with an account,
+// the selected one if empty, under scheme, SHA-256 if empty.
+func SignBatchAttestation(account string, messages []string, scheme string) (*BatchAttestation, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("%w: no messages", ErrInvalidBatch)
+	}
+	if len(messages) > maxBatchMessages {
+		return nil, fmt.Errorf("%w: at most %d messages can be signed at once", ErrInvalidBatch, maxBatchMessages)
+	}
+
+	leaves := make([]common.Hash, len(messages))
+	for i, message := range messages {
+		leaves[i] = attestationLeaf(message)
+	}
+	root, proofs := merkleTree(leaves)
+
+	hash, err := messageHash(string(root.Bytes()), scheme)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := loadSignerFor(account)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signMessage(signer, hash, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	attestation := &BatchAttestation{
+		Root:      root.Hex(),
+		Signature: signature,
+		Signer:    signer.Address().Hex(),
+		Scheme:    scheme,
+		Count:     len(messages),
+		Proofs:    make([]AttestationProof, len(messages)),
+	}
+	if attestation.Scheme == "" {
+		attestation.Scheme = SignSchemeSHA256
+	}
+	for i, leaf := range leaves {
+		proof := make([]string, len(proofs[i]))
+		for j, sibling := range proofs[i] {
+			proof[j] = sibling.Hex()
+		}
+		attestation.Proofs[i] = AttestationProof{Index: i, Leaf: leaf.Hex(), Proof: proof}
+	}
+
+	recordAudit("message.batch_signed", fmt.Sprintf("%s signed a batch of %d messages with root %s", attestation.Signer, len(messages), attestation.Root),
+		map[string]interface{}{"signer": attestation.Signer, "root": attestation.Root, "count": len(messages), "scheme": attestation.Scheme})
+	return attestation, nil
+}
+
+// VerifyBatchAttestation checks that message is in the batch whose root is
+// given, by its proof, and returns the address that signed the root under
+// scheme, SHA-256 if empty. As with RecoverSigner, no key is involved, so
+// it checks anyone's attestations; whether the signer is trusted is up to
+// the caller.
+func VerifyBatchAttestation(message string, proof []string, rootHex, signatureHex, scheme string) (included bool, signer string, err error) {
+	root, err := hexutil.Decode(rootHex)
+	if err != nil || len(root) != common.HashLength {
+		return false, "", fmt.Errorf("%w: the root must be 32 bytes of hex", ErrInvalidBatch)
+	}
+	siblings := make([]common.Hash, len(proof))
+	for i, raw := range proof {
+		sibling, err := hexutil.Decode(raw)
+		if err != nil || len(sibling) != common.HashLength {
+			return false, "", fmt.Errorf("%w: proof element %d must be 32 bytes of hex", ErrInvalidBatch, i)
+		}
+		siblings[i] = common.BytesToHash(sibling)
+	}
+
+	hash, err := messageHash(string(root), scheme)
+	if err != nil {
+		return false, "", err
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(signatureHex, "0x"))
+	if err != nil {
+		return false, "", ErrInvalidSignature
+	}
+	address, ok := recoverAddress(hash, signature)
+	if !ok {
+		return false, "", ErrInvalidSignature
+	}
+
+	computed := attestationLeaf(message)
+	for _, sibling := range siblings {
+		computed = hashPair(computed, sibling)
+	}
+
+	return computed == common.BytesToHash(root), address.Hex(), nil
+}
+
+// merkleTree returns the root of a tree over leaves, in their order, and
+// each leaf's proof. A node left without a sibling on a level moves up
+// unchanged, rather than being paired with itself.
+func merkleTree(leaves []common.Hash) (common.Hash, [][]common.Hash) {
+	proofs := make([][]common.Hash, len(leaves))
+	// members[i] lists the leaves under the node at i of the current level.
+	members := make([][]int, len(leaves))
+	for i := range leaves {
+		members[i] = []int{i}
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		next := make([]common.Hash, 0, (len(level)+1)/2)
+		nextMembers := make([][]int, 0, cap(next))
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				nextMembers = append(nextMembers, members[i])
+				continue
+			}
+			for _, leaf := range members[i] {
+				proofs[leaf] = append(proofs[leaf], level[i+1])
+			}
+			for _, leaf := range members[i+1] {
+				proofs[leaf] = append(proofs[leaf], level[i])
+			}
+			next = append(next, hashPair(level[i], level[i+1]))
+			nextMembers = append(nextMembers, append(members[i], members[i+1]...))
+		}
+		level, members = next, nextMembers
+	}
+
+	return level[0], proofs
+}
+
+// attestationLeaf hashes a message twice, so that no leaf can be passed off
+// as an inner node.
+func attestationLeaf(message string) common.Hash {
+	return crypto.Keccak256Hash(crypto.Keccak256([]byte(message)))
+}
+
+func hashPair(a, b common.Hash) common.Hash {
+	if bytes.Compare(a.Bytes(), b.Bytes()) > 0 {
+		a, b = b, a
+	}
+
+	return crypto.Keccak256Hash(a.Bytes(), b.Bytes())
+}
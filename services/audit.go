@@ -0,0 +1,101 @@
+package services
+
+import (
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxAuditEvents bounds the audit log; the oldest events are dropped first.
+const maxAuditEvents = 10000
+
+// AuditEvent is a record of something the wallet did on its own or found
+// while checking its state, kept for operators to review.
+type AuditEvent struct {
+	ID        string                 `json:"id"`
+	Kind      string                 `json:"kind"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type AuditFilter struct {
+	Kind  string
+	Since time.Time
+}
+
+var (
+	auditFile = "audit.json"
+	auditMu   sync.Mutex
+)
+
+// ListAuditEvents returns matching audit events, newest first.
+func ListAuditEvents(filter AuditFilter) ([]AuditEvent, error) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	events, err := readAudit()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []AuditEvent
+	for _, event := range events {
+		if filter.Kind != "" && event.Kind != filter.Kind {
+			continue
+		}
+		if !filter.Since.IsZero() && event.CreatedAt.Before(filter.Since) {
+			continue
+		}
+		matched = append(matched, event)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	return matched, nil
+}
+
+// recordAudit appends to the audit log. Failures are logged rather than
+// returned so auditing never breaks the operation being audited.
+func recordAudit(kind, message string, details map[string]interface{}) {
+	event := AuditEvent{
+		ID:        newID(),
+		Kind:      kind,
+		Message:   message,
+		Details:   details,
+		CreatedAt: time.Now().UTC(),
+	}
+	log.Printf("audit %s: %s", kind, message)
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	events, err := readAudit()
+	if err != nil {
+		log.Printf("failed to record audit event: %v", err)
+		return
+	}
+
+	events = append(events, event)
+	if len(events) > maxAuditEvents {
+		events = events[len(events)-maxAuditEvents:]
+	}
+	if err := writeJSONFile(auditFile, events); err != nil {
+		log.Printf("failed to record audit event: %v", err)
+		return
+	}
+	wakeSIEMExporter()
+}
+
+func readAudit() ([]AuditEvent, error) {
+	var events []AuditEvent
+	if err := readJSONFile(auditFile, &events); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles, from least to most privileged. Each role can do everything the ones
+// before it can.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roles = []string{RoleViewer, RoleOperator, RoleAdmin}
+
+// Scopes name what a caller may do. Every route requires exactly one; a
+// role grants a fixed set, and an API key can be narrowed to fewer.
+const (
+	ScopeAccountsRead   = "accounts:read"
+	ScopeAccountsWrite  = "accounts:write"
+	ScopeTxSend         = "tx:send"
+	ScopeTokensTransfer = "tokens:transfer"
+	ScopeAdminConfig    = "admin:config"
+)
+
+// ScopeDescriptions documents each scope, for the OpenAPI description.
+var ScopeDescriptions = map[string]string{
+	ScopeAccountsRead:   "Read accounts, balances, history and status",
+	ScopeAccountsWrite:  "Create and select accounts and manage their records",
+	ScopeTxSend:         "Sign messages and sign and send transactions",
+	ScopeTokensTransfer: "Transfer tokens and sign or relay token authorizations",
+	ScopeAdminConfig:    "Change policy and configuration and read the audit log",
+}
+
+var roleScopes = map[string][]string{
+	RoleViewer:   {ScopeAccountsRead},
+	RoleOperator: {ScopeAccountsRead, ScopeAccountsWrite, ScopeTxSend, ScopeTokensTransfer},
+	RoleAdmin:    {ScopeAccountsRead, ScopeAccountsWrite, ScopeTxSend, ScopeTokensTransfer, ScopeAdminConfig},
+}
+
+// Kinds of principal.
+const (
+	PrincipalAPIKey = "api_key"
+	PrincipalOIDC   = "oidc"
+)
+
+const apiKeyPrefix = "gwk_"
+
+// Principal is the caller a request was authenticated as.
+type Principal struct {
+	Kind      string     `json:"kind"`
+	Subject   string     `json:"subject"`
+	Role      string     `json:"role"`
+	Scopes    []string   `json:"scopes"`
+	KeyID     string     `json:"key_id,omitempty"`
+	TokenID   string     `json:"token_id,omitempty"`
+	Groups    []string   `json:"groups,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKey is a long-lived credential for automation. Only a hash of the key is
+// stored; the key itself is returned once, when it is created.
+type APIKey struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Role       string       `json:"role"`
+	Scopes     []string     `json:"scopes,omitempty"`
+	Prefix     string       `json:"prefix"`
+	Hash       string       `json:"hash,omitempty"`
+	Quota      *APIKeyQuota `json:"quota,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty"`
+}
+
+var (
+	apiKeysFile = "api_keys.json"
+	apiKeysMu   sync.Mutex
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrInvalidToken    = errors.New("invalid or expired credentials")
+	ErrForbidden       = errors.New("insufficient role")
+	ErrInvalidRole     = errors.New("invalid role")
+	ErrInvalidScope    = errors.New("invalid scope")
+	ErrAPIKeyNotFound  = errors.New("API key not found")
+)
+
+// AuthRequired reports whether requests must be authenticated. It is off
+// unless AUTH_REQUIRED is true or OIDC is configured, so existing
+// deployments keep working until they opt in.
+func AuthRequired() bool {
+	return os.Getenv("AUTH_REQUIRED") == "true" || OIDCEnabled()
+}
+
+// HasScope reports whether the principal may call routes requiring scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleScopes returns the scopes a role grants.
+func RoleScopes(role string) []string {
+	return append([]string(nil), roleScopes[role]...)
+}
+
+// checkScopes makes sure every scope is one the role grants.
+func checkScopes(role string, scopes []string) error {
+	for _, scope := range scopes {
+		granted := false
+		for _, s := range roleScopes[role] {
+			if s == scope {
+				granted = true
+			}
+		}
+		if !granted {
+			if _, known := ScopeDescriptions[scope]; !known {
+				return fmt.Errorf("%w: unknown scope %q", ErrInvalidScope, scope)
+			}
+			return fmt.Errorf("%w: role %s does not grant %q", ErrInvalidScope, role, scope)
+		}
+	}
+	return nil
+}
+
+func roleRank(role string) int {
+	for i, r := range roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Authenticate resolves a bearer credential: an API key, the ADMIN_API_KEY
+// bootstrap key, or an access token issued after an OIDC login.
+func Authenticate(token string) (*Principal, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	if admin := os.Getenv("ADMIN_API_KEY"); admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1 {
+		return &Principal{Kind: PrincipalAPIKey, Subject: "bootstrap", Role: RoleAdmin, Scopes: RoleScopes(RoleAdmin)}, nil
+	}
+
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		return authenticateAPIKey(token)
+	}
+
+	return verifyAccessToken(token)
+}
+
+// RecheckPrincipal confirms that a principal authenticated earlier, whose
+// credentials are no longer at hand, would still be let in: its token has
+// not expired or been revoked and its API key has not been revoked.
+func RecheckPrincipal(p *Principal) error {
+	if p.ExpiresAt != nil && time.Now().After(*p.ExpiresAt) {
+		return ErrInvalidToken
+	}
+	if p.TokenID != "" {
+		revoked, err := tokenRevoked(p.TokenID)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrInvalidToken
+		}
+	}
+	if p.KeyID == "" {
+		return nil
+	}
+
+	apiKeysMu.Lock()
+	defer apiKeysMu.Unlock()
+
+	keys, err := readAPIKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.ID == p.KeyID {
+			return nil
+		}
+	}
+
+	return ErrInvalidToken
+}
+
+// CreateAPIKey returns the new key's record and the key itself, which is not
+// stored and cannot be shown again. Scopes narrow the key to part of what its
+// role grants; without them it has all of the role's scopes.
+func CreateAPIKey(name, role string, scopes []string, quota *APIKeyQuota) (*APIKey, string, error) {
+	if roleRank(role) < 0 {
+		return nil, "", fmt.Errorf("%w: %q (expected one of %s)", ErrInvalidRole, role, strings.Join(roles, ", "))
+	}
+	if err := checkScopes(role, scopes); err != nil {
+		return nil, "", err
+	}
+	if err := validateQuota(quota); err != nil {
+		return nil, "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	token := apiKeyPrefix + hex.EncodeToString(secret)
+
+	key := &APIKey{
+		ID:        newID(),
+		Name:      name,
+		Role:      role,
+		Scopes:    scopes,
+		Prefix:    token[:len(apiKeyPrefix)+8],
+		Hash:      hashAPIKey(token),
+		Quota:     quota,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	apiKeysMu.Lock()
+	defer apiKeysMu.Unlock()
+
+	keys, err := readAPIKeys()
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys = append(keys, key)
+	if err := writeJSONFile(apiKeysFile, keys); err != nil {
+		return nil, "", err
+	}
+
+	recordAudit("apikey.created", fmt.Sprintf("API key %q created with role %s", name, role),
+		map[string]interface{}{"key_id": key.ID, "role": role})
+
+	created := *key
+	created.Hash = ""
+	return &created, token, nil
+}
+
+// ListAPIKeys returns every API key without its hash.
+func ListAPIKeys() ([]*APIKey, error) {
+	apiKeysMu.Lock()
+	defer apiKeysMu.Unlock()
+
+	keys, err := readAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		key.Hash = ""
+	}
+
+	return keys, nil
+}
+
+func RevokeAPIKey(id string) error {
+	apiKeysMu.Lock()
+	defer apiKeysMu.Unlock()
+
+	keys, err := readAPIKeys()
+	if err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		if key.ID == id {
+			keys = append(keys[:i], keys[i+1:]...)
+			if err := writeJSONFile(apiKeysFile, keys); err != nil {
+				return err
+			}
+			forgetQuotaUsage(id)
+			recordAudit("apikey.revoked", fmt.Sprintf("API key %q revoked", key.Name),
+				map[string]interface{}{"key_id": id})
+			return nil
+		}
+	}
+
+	return ErrAPIKeyNotFound
+}
+
+func authenticateAPIKey(token string) (*Principal, error) {
+	hash := hashAPIKey(token)
+
+	apiKeysMu.Lock()
+	defer apiKeysMu.Unlock()
+
+	keys, err := readAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) != 1 {
+			continue
+		}
+
+		// Last use is only tracked to the minute, so busy keys do not
+		// rewrite the file on every request.
+		now := time.Now().UTC()
+		if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+			key.LastUsedAt = &now
+			writeJSONFile(apiKeysFile, keys)
+		}
+
+		scopes := key.Scopes
+		if len(scopes) == 0 {
+			scopes = RoleScopes(key.Role)
+		}
+		return &Principal{Kind: PrincipalAPIKey, Subject: key.Name, Role: key.Role, Scopes: scopes, KeyID: key.ID}, nil
+	}
+
+	return nil, ErrInvalidToken
+}
+
+func hashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func readAPIKeys() ([]*APIKey, error) {
+	var keys []*APIKey
+	if err := readJSONFile(apiKeysFile, &keys); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return keys, nil
+}
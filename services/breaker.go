@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+var ErrCircuitOpen = errors.New("RPC endpoint unavailable: circuit breaker open")
+
+// circuitBreaker opens after a run of consecutive failures and rejects calls
+// until the cooldown elapses, then lets a single probe through (half-open).
+// The probe's outcome decides whether the circuit closes or reopens.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+type BreakerStatus struct {
+	Endpoint string     `json:"endpoint"`
+	State    string     `json:"state"`
+	Failures int        `json:"consecutive_failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+// breakerSettings are RPC_BREAKER_THRESHOLD and RPC_BREAKER_COOLDOWN.
+type breakerSettings struct {
+	threshold int
+	cooldown  time.Duration
+}
+
+var (
+	breakers   = map[string]*circuitBreaker{}
+	breakersMu sync.Mutex
+
+	// breakerConfig is guarded by breakersMu.
+	breakerConfig = breakerSettings{threshold: defaultBreakerThreshold, cooldown: defaultBreakerCooldown}
+)
+
+func newCircuitBreaker(name string) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	breaker := &circuitBreaker{
+		name:      name,
+		threshold: breakerConfig.threshold,
+		cooldown:  breakerConfig.cooldown,
+		state:     BreakerClosed,
+	}
+	breakers[name] = breaker
+
+	return breaker
+}
+
+// readBreakerSettings ignores values that are not positive, as it always
+// has, leaving the defaults.
+func readBreakerSettings(s settings) breakerSettings {
+	config := breakerSettings{threshold: defaultBreakerThreshold, cooldown: defaultBreakerCooldown}
+	if raw := s.get("RPC_BREAKER_THRESHOLD"); raw != "" {
+		if threshold, err := strconv.Atoi(raw); err == nil && threshold > 0 {
+			config.threshold = threshold
+		}
+	}
+	if raw := s.get("RPC_BREAKER_COOLDOWN"); raw != "" {
+		if cooldown, err := time.ParseDuration(raw); err == nil && cooldown > 0 {
+			config.cooldown = cooldown
+		}
+	}
+
+	return config
+}
+
+// applyBreakerSettings applies config to every breaker, keeping their state,
+// and reports whether it changed.
+func applyBreakerSettings(config breakerSettings) bool {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	if config == breakerConfig {
+		return false
+	}
+
+	breakerConfig = config
+	for _, breaker := range breakers {
+		breaker.mu.Lock()
+		breaker.threshold, breaker.cooldown = config.threshold, config.cooldown
+		breaker.mu.Unlock()
+	}
+
+	return true
+}
+
+func RPCStatus() []BreakerStatus {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	statuses := make([]BreakerStatus, 0, len(breakers))
+	for _, breaker := range breakers {
+		statuses = append(statuses, breaker.status())
+	}
+
+	return statuses
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	}
+
+	return nil
+}
+
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{Endpoint: b.name, State: b.state, Failures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt.UTC()
+		status.OpenedAt = &openedAt
+	}
+
+	return status
+}
+
+// breakerTransport applies a circuit breaker to every HTTP request made to an
+// RPC endpoint. Transport errors, 429s and 5xx responses count as failures;
+// JSON-RPC level errors arrive with 200 and do not.
+type breakerTransport struct {
+	next    http.RoundTripper
+	breaker *circuitBreaker
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.breaker.record(false)
+		return nil, err
+	}
+
+	t.breaker.record(resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500)
+	return resp, nil
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jabbala-dev/go-wallet/utils"
+)
+
+// BreakGlassEntry is a pre-signed emergency transaction. Only the metadata is
+// stored in the clear; the signed payload is sealed with the vault passphrase
+// so it can be broadcast without access to the signing keys.
+type BreakGlassEntry struct {
+	ID          string     `json:"id"`
+	Label       string     `json:"label"`
+	ChainID     uint64     `json:"chain_id,omitempty"`
+	From        string     `json:"from"`
+	To          string     `json:"to"`
+	Value       string     `json:"value"`
+	Nonce       uint64     `json:"nonce"`
+	TxHash      string     `json:"transaction_hash"`
+	CreatedAt   time.Time  `json:"created_at"`
+	BroadcastAt *time.Time `json:"broadcast_at,omitempty"`
+
+	Sealed string `json:"sealed,omitempty"`
+}
+
+type BreakGlassRequest struct {
+	Chain      *Chain
+	Label      string
+	ToAddress  string
+	Value      int64
+	Nonce      *uint64
+	GasPrice   *big.Int
+	RawTx      string
+	Passphrase string
+}
+
+var (
+	breakGlassFile = "breakglass.json"
+	breakGlassMu   sync.Mutex
+)
+
+var (
+	ErrBreakGlassNotFound   = errors.New("break-glass entry not found")
+	ErrBreakGlassPassphrase = errors.New("invalid break-glass passphrase")
+	ErrBreakGlassBroadcast  = errors.New("break-glass entry has already been broadcast")
+)
+
+func CreateBreakGlassEntry(request BreakGlassRequest) (*BreakGlassEntry, error) {
+	if len(request.Passphrase) < 12 {
+		return nil, errors.New("break-glass passphrase must be at least 12 characters")
+	}
+
+	var signedTx *types.Transaction
+	var err error
+	if request.RawTx != "" {
+		signedTx, err = decodeRawTransaction(request.RawTx)
+	} else {
+		signedTx, err = presignBreakGlass(request)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A raw transaction is bound to whatever chain it was signed for.
+	if signedTx.Protected() && signedTx.ChainId().Cmp(request.Chain.ID) != 0 {
+		return nil, fmt.Errorf("transaction is signed for chain %s, not %s", signedTx.ChainId(), request.Chain.ID)
+	}
+
+	from, err := types.Sender(signerForChain(signedTx.ChainId()), signedTx)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := signedTx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := utils.EncryptWithPassphrase(raw, request.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &BreakGlassEntry{
+		ID:        newID(),
+		Label:     request.Label,
+		ChainID:   request.Chain.ID.Uint64(),
+		From:      from.Hex(),
+		Value:     signedTx.Value().String(),
+		Nonce:     signedTx.Nonce(),
+		TxHash:    signedTx.Hash().Hex(),
+		CreatedAt: time.Now().UTC(),
+		Sealed:    hex.EncodeToString(sealed),
+	}
+	if signedTx.To() != nil {
+		entry.To = signedTx.To().Hex()
+	}
+
+	breakGlassMu.Lock()
+	defer breakGlassMu.Unlock()
+
+	entries, err := readBreakGlass()
+	if err != nil {
+		return nil, err
+	}
+
+	entries = append(entries, entry)
+	if err := writeJSONFile(breakGlassFile, entries); err != nil {
+		return nil, err
+	}
+
+	return entry.public(), nil
+}
+
+func ListBreakGlassEntries() ([]*BreakGlassEntry, error) {
+	breakGlassMu.Lock()
+	defer breakGlassMu.Unlock()
+
+	entries, err := readBreakGlass()
+	if err != nil {
+		return nil, err
+	}
+
+	public := make([]*BreakGlassEntry, len(entries))
+	for i, entry := range entries {
+		public[i] = entry.public()
+	}
+
+	return public, nil
+}
+
+func BroadcastBreakGlassEntry(id, passphrase string) (string, error) {
+	breakGlassMu.Lock()
+	defer breakGlassMu.Unlock()
+
+	entries, err := readBreakGlass()
+	if err != nil {
+		return "", err
+	}
+
+	var entry *BreakGlassEntry
+	for _, candidate := range entries {
+		if candidate.ID == id {
+			entry = candidate
+			break
+		}
+	}
+	if entry == nil {
+		return "", ErrBreakGlassNotFound
+	}
+	if entry.BroadcastAt != nil {
+		return "", ErrBreakGlassBroadcast
+	}
+
+	sealed, err := hex.DecodeString(entry.Sealed)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := utils.DecryptWithPassphrase(sealed, passphrase)
+	if err != nil {
+		return "", ErrBreakGlassPassphrase
+	}
+
+	signedTx := new(types.Transaction)
+	if err := signedTx.UnmarshalBinary(raw); err != nil {
+		return "", err
+	}
+
+	chain, err := chainByID(context.Background(), entry.ChainID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := chain.client.SendTransaction(context.Background(), signedTx); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	entry.BroadcastAt = &now
+	if err := writeJSONFile(breakGlassFile, entries); err != nil {
+		log.Printf("failed to mark break-glass entry %s as broadcast: %v", entry.ID, err)
+	}
+
+	err = recordTransaction(signedBy(TransactionRecord{
+		Hash:      entry.TxHash,
+		ChainID:   entry.ChainID,
+		From:      entry.From,
+		To:        entry.To,
+		Value:     entry.Value,
+		Status:    StatusPending,
+		CreatedAt: now,
+	}, signedTx))
+	if err != nil {
+		log.Printf("failed to record transaction %s: %v", entry.TxHash, err)
+	}
+
+	return entry.TxHash, nil
+}
+
+func presignBreakGlass(request BreakGlassRequest) (*types.Transaction, error) {
+	if !common.IsHexAddress(request.ToAddress) {
+		return nil, errors.New("invalid recipient address")
+	}
+	if request.Nonce == nil {
+		return nil, errors.New("nonce is required for pre-signed transactions")
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	gasPrice := request.GasPrice
+	if gasPrice == nil {
+		gasPrice, err = request.Chain.currentGasPrice(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx := types.NewTransaction(*request.Nonce, common.HexToAddress(request.ToAddress), big.NewInt(request.Value), 21000, gasPrice, nil)
+	signedTx, err := signer.SignTx(request.Chain.ID, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	recordSignature(signer.Address())
+	return signedTx, nil
+}
+
+func decodeRawTransaction(rawHex string) (*types.Transaction, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(rawHex, "0x"))
+	if err != nil {
+		return nil, err
+	}
+
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func readBreakGlass() ([]*BreakGlassEntry, error) {
+	var entries []*BreakGlassEntry
+	if err := readJSONFile(breakGlassFile, &entries); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (e *BreakGlassEntry) public() *BreakGlassEntry {
+	public := *e
+	public.Sealed = ""
+	return &public
+}
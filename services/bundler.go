@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var ErrBundlerUnavailable = errors.New("no ERC-4337 bundler is configured")
+
+// userOperation is an EntryPoint v0.7 UserOperation in the unpacked form
+// bundlers take over JSON-RPC. Factory and FactoryData make up the initCode
+// and are only set while the account is not yet deployed.
+type userOperation struct {
+	Sender               common.Address  `json:"sender"`
+	Nonce                *hexutil.Big    `json:"nonce"`
+	Factory              *common.Address `json:"factory,omitempty"`
+	FactoryData          hexutil.Bytes   `json:"factoryData,omitempty"`
+	CallData             hexutil.Bytes   `json:"callData"`
+	CallGasLimit         *hexutil.Big    `json:"callGasLimit"`
+	VerificationGasLimit *hexutil.Big    `json:"verificationGasLimit"`
+	PreVerificationGas   *hexutil.Big    `json:"preVerificationGas"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	Signature            hexutil.Bytes   `json:"signature"`
+}
+
+type userOperationGas struct {
+	PreVerificationGas   *hexutil.Big `json:"preVerificationGas"`
+	VerificationGasLimit *hexutil.Big `json:"verificationGasLimit"`
+	CallGasLimit         *hexutil.Big `json:"callGasLimit"`
+}
+
+// UserOperationReceipt is the outcome of a UserOperation once a bundler has
+// included it. Success is false when the account's call reverted; the op
+// is still included and its gas paid.
+type UserOperationReceipt struct {
+	Hash            string `json:"user_op_hash"`
+	Sender          string `json:"sender"`
+	Success         bool   `json:"success"`
+	Reason          string `json:"reason,omitempty"`
+	ActualGasCost   string `json:"actual_gas_cost"`
+	TransactionHash string `json:"transaction_hash"`
+	BlockNumber     uint64 `json:"block_number"`
+}
+
+// bundler is the BUNDLER_URL endpoint for a chain. A bundler serves a single
+// chain, so one reporting a different chain ID is refused rather than given
+// operations signed for another chain.
+func bundler(ctx context.Context, chain *Chain) (*rpc.Client, error) {
+	url := os.Getenv("BUNDLER_URL")
+	if url == "" {
+		return nil, ErrBundlerUnavailable
+	}
+
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var id hexutil.Big
+	if err := client.CallContext(ctx, &id, "eth_chainId"); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("bundler: %w", err)
+	}
+	if id.ToInt().Cmp(chain.ID) != 0 {
+		client.Close()
+		return nil, fmt.Errorf("%w for chain %s: the bundler serves chain %s", ErrBundlerUnavailable, chain.ID, id.ToInt())
+	}
+
+	return client, nil
+}
+
+func estimateUserOperationGas(ctx context.Context, client *rpc.Client, op *userOperation) (*userOperationGas, error) {
+	var gas userOperationGas
+	if err := client.CallContext(ctx, &gas, "eth_estimateUserOperationGas", op, entryPoint()); err != nil {
+		return nil, fmt.Errorf("bundler: %w", err)
+	}
+	if gas.PreVerificationGas == nil || gas.VerificationGasLimit == nil || gas.CallGasLimit == nil {
+		return nil, errors.New("bundler: incomplete gas estimate")
+	}
+
+	return &gas, nil
+}
+
+func sendUserOperation(ctx context.Context, client *rpc.Client, op *userOperation) (common.Hash, error) {
+	var hash common.Hash
+	if err := client.CallContext(ctx, &hash, "eth_sendUserOperation", op, entryPoint()); err != nil {
+		return common.Hash{}, fmt.Errorf("bundler: %w", err)
+	}
+
+	return hash, nil
+}
+
+// userOperationReceipt returns nil while the operation is still pending.
+func userOperationReceipt(ctx context.Context, client *rpc.Client, hash common.Hash) (*UserOperationReceipt, error) {
+	var raw *struct {
+		UserOpHash    common.Hash    `json:"userOpHash"`
+		Sender        common.Address `json:"sender"`
+		Success       bool           `json:"success"`
+		Reason        string         `json:"reason"`
+		ActualGasCost *hexutil.Big   `json:"actualGasCost"`
+		Receipt       struct {
+			TransactionHash common.Hash    `json:"transactionHash"`
+			BlockNumber     hexutil.Uint64 `json:"blockNumber"`
+		} `json:"receipt"`
+	}
+	if err := client.CallContext(ctx, &raw, "eth_getUserOperationReceipt", hash); err != nil {
+		return nil, fmt.Errorf("bundler: %w", err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	cost := new(big.Int)
+	if raw.ActualGasCost != nil {
+		cost = raw.ActualGasCost.ToInt()
+	}
+
+	return &UserOperationReceipt{
+		Hash:            raw.UserOpHash.Hex(),
+		Sender:          raw.Sender.Hex(),
+		Success:         raw.Success,
+		Reason:          raw.Reason,
+		ActualGasCost:   cost.String(),
+		TransactionHash: raw.Receipt.TransactionHash.Hex(),
+		BlockNumber:     uint64(raw.Receipt.BlockNumber),
+	}, nil
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Selectors of allowance-setting calls worth checking for max padding.
+var allowanceSelectors = map[[4]byte]string{
+	{0x09, 0x5e, 0xa7, 0xb3}: "approve",
+	{0x39, 0x50, 0x93, 0x51}: "increaseAllowance",
+}
+
+// realisticAllowanceBytes is the width of an exact allowance (a uint128 covers
+// any realistic token amount) used as the baseline for the max-padding warning.
+const realisticAllowanceBytes = 16
+
+type CalldataCost struct {
+	Bytes          int      `json:"bytes"`
+	ZeroBytes      int      `json:"zero_bytes"`
+	NonZeroBytes   int      `json:"non_zero_bytes"`
+	CalldataGas    uint64   `json:"calldata_gas"`
+	CompressedSize int      `json:"compressed_size_estimate"`
+	L1DataGas      uint64   `json:"l1_data_gas_estimate"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// AnalyzeCalldata breaks down the EIP-2028 calldata cost and estimates the
+// L1 data footprint on OP-stack chains. The compressed size mirrors the Fjord
+// estimator (linear fit over a fast compressor, floored at 100 bytes) using
+// DEFLATE as the compressor, so it is an approximation.
+func AnalyzeCalldata(data []byte) CalldataCost {
+	cost := CalldataCost{Bytes: len(data)}
+	for _, b := range data {
+		if b == 0 {
+			cost.ZeroBytes++
+		} else {
+			cost.NonZeroBytes++
+		}
+	}
+
+	cost.CalldataGas = calldataGas(cost.ZeroBytes, cost.NonZeroBytes)
+	cost.CompressedSize = estimateCompressedSize(data)
+	cost.L1DataGas = uint64(cost.CompressedSize) * params.TxDataNonZeroGasEIP2028
+
+	if warning := maxAllowanceWarning(data, cost.CalldataGas); warning != "" {
+		cost.Warnings = append(cost.Warnings, warning)
+	}
+
+	return cost
+}
+
+func calldataGas(zero, nonZero int) uint64 {
+	return uint64(zero)*params.TxDataZeroGas + uint64(nonZero)*params.TxDataNonZeroGasEIP2028
+}
+
+func estimateCompressedSize(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write(data)
+	w.Close()
+
+	estimate := -42.5856 + 0.8365*float64(buf.Len())
+	return int(math.Max(100, math.Ceil(estimate)))
+}
+
+func maxAllowanceWarning(data []byte, total uint64) string {
+	if len(data) != 4+64 {
+		return ""
+	}
+
+	var selector [4]byte
+	copy(selector[:], data[:4])
+	method, ok := allowanceSelectors[selector]
+	if !ok {
+		return ""
+	}
+
+	for _, b := range data[36:68] {
+		if b != 0xff {
+			return ""
+		}
+	}
+
+	exact := calldataGas(32-realisticAllowanceBytes, realisticAllowanceBytes)
+	padded := calldataGas(0, 32)
+	extra := padded - exact
+	if extra*10 < total {
+		return ""
+	}
+
+	return fmt.Sprintf("%s uses the maximum uint256 allowance, costing about %d more calldata gas than an exact amount (%d%% of this call's calldata cost)",
+		method, extra, extra*100/total)
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	CeremonyStatusOpen      = "awaiting_approvals"
+	CeremonyStatusApproved  = "approved"
+	CeremonyStatusCompleted = "completed"
+
+	ceremonyEntropySource = "crypto/rand (operating system CSPRNG)"
+)
+
+// KeyCeremony records the approvals required before a key is generated, how
+// its entropy was gathered, and the resulting address. Operator entropy is
+// never stored; only its SHA-256 commitment is kept and mixed into the key.
+type KeyCeremony struct {
+	ID                string             `json:"id"`
+	Label             string             `json:"label"`
+	RequiredApprovals int                `json:"required_approvals"`
+	Operators         []string           `json:"operators,omitempty"`
+	Status            string             `json:"status"`
+	Approvals         []CeremonyApproval `json:"approvals"`
+	Entropy           *CeremonyEntropy   `json:"entropy,omitempty"`
+	Address           string             `json:"address,omitempty"`
+	CreatedAt         time.Time          `json:"created_at"`
+	CompletedAt       *time.Time         `json:"completed_at,omitempty"`
+}
+
+type CeremonyApproval struct {
+	Operator          string    `json:"operator"`
+	Statement         string    `json:"statement,omitempty"`
+	EntropyCommitment string    `json:"entropy_commitment,omitempty"`
+	ApprovedAt        time.Time `json:"approved_at"`
+}
+
+type CeremonyEntropy struct {
+	Source                string `json:"source"`
+	SystemBytes           int    `json:"system_bytes"`
+	OperatorContributions int    `json:"operator_contributions"`
+	Mixing                string `json:"mixing"`
+}
+
+// CeremonyReport is a ceremony signed with the server identity key. Report
+// holds the exact bytes that were signed.
+type CeremonyReport struct {
+	Report    json.RawMessage `json:"report"`
+	Algorithm string          `json:"algorithm"`
+	PublicKey string          `json:"public_key"`
+	Signature string          `json:"signature"`
+}
+
+var (
+	ceremoniesFile = "ceremonies.json"
+	ceremoniesMu   sync.Mutex
+)
+
+var (
+	ErrCeremonyNotFound    = errors.New("key ceremony not found")
+	ErrCeremonyCompleted   = errors.New("key ceremony has already completed")
+	ErrCeremonyNotApproved = errors.New("key ceremony does not have the required approvals")
+	ErrOperatorNotListed   = errors.New("operator is not part of this ceremony")
+	ErrOperatorApproved    = errors.New("operator has already approved this ceremony")
+)
+
+func CreateKeyCeremony(label string, requiredApprovals int, operators []string) (*KeyCeremony, error) {
+	if requiredApprovals < 1 {
+		return nil, errors.New("at least one approval is required")
+	}
+	if len(operators) > 0 && requiredApprovals > len(operators) {
+		return nil, errors.New("required approvals exceed the number of operators")
+	}
+
+	ceremony := &KeyCeremony{
+		ID:                newID(),
+		Label:             label,
+		RequiredApprovals: requiredApprovals,
+		Operators:         operators,
+		Status:            CeremonyStatusOpen,
+		Approvals:         []CeremonyApproval{},
+		CreatedAt:         time.Now().UTC(),
+	}
+
+	ceremoniesMu.Lock()
+	defer ceremoniesMu.Unlock()
+
+	ceremonies, err := readCeremonies()
+	if err != nil {
+		return nil, err
+	}
+
+	ceremonies = append(ceremonies, ceremony)
+	if err := writeJSONFile(ceremoniesFile, ceremonies); err != nil {
+		return nil, err
+	}
+
+	return ceremony, nil
+}
+
+func ListKeyCeremonies() ([]*KeyCeremony, error) {
+	ceremoniesMu.Lock()
+	defer ceremoniesMu.Unlock()
+
+	ceremonies, err := readCeremonies()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ceremonies, func(i, j int) bool {
+		return ceremonies[i].CreatedAt.Before(ceremonies[j].CreatedAt)
+	})
+
+	return ceremonies, nil
+}
+
+// ApproveKeyCeremony records an operator's attestation. Optional entropy is
+// hashed immediately and only the hash is persisted.
+func ApproveKeyCeremony(id, operator, statement string, entropy []byte) (*KeyCeremony, error) {
+	if operator == "" {
+		return nil, errors.New("operator is required")
+	}
+
+	ceremoniesMu.Lock()
+	defer ceremoniesMu.Unlock()
+
+	ceremonies, err := readCeremonies()
+	if err != nil {
+		return nil, err
+	}
+
+	ceremony, err := findCeremony(ceremonies, id)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.Status == CeremonyStatusCompleted {
+		return nil, ErrCeremonyCompleted
+	}
+	if len(ceremony.Operators) > 0 && !slices.Contains(ceremony.Operators, operator) {
+		return nil, ErrOperatorNotListed
+	}
+	for _, approval := range ceremony.Approvals {
+		if approval.Operator == operator {
+			return nil, ErrOperatorApproved
+		}
+	}
+
+	approval := CeremonyApproval{Operator: operator, Statement: statement, ApprovedAt: time.Now().UTC()}
+	if len(entropy) > 0 {
+		commitment := sha256.Sum256(entropy)
+		approval.EntropyCommitment = hex.EncodeToString(commitment[:])
+	}
+	ceremony.Approvals = append(ceremony.Approvals, approval)
+
+	if len(ceremony.Approvals) >= ceremony.RequiredApprovals {
+		ceremony.Status = CeremonyStatusApproved
+	}
+
+	if err := writeJSONFile(ceremoniesFile, ceremonies); err != nil {
+		return nil, err
+	}
+
+	return ceremony, nil
+}
+
+// CompleteKeyCeremony generates the key once enough operators have approved.
+// The key is SHA-256(32 system random bytes || operator commitments...), so
+// it is unpredictable as long as the system RNG is sound, and no single party
+// chooses it. The key is stored in the keystore under password.
+func CompleteKeyCeremony(id, password string) (*KeyCeremony, error) {
+	if password == "" {
+		return nil, ErrPasswordRequired
+	}
+
+	ceremoniesMu.Lock()
+	defer ceremoniesMu.Unlock()
+
+	ceremonies, err := readCeremonies()
+	if err != nil {
+		return nil, err
+	}
+
+	ceremony, err := findCeremony(ceremonies, id)
+	if err != nil {
+		return nil, err
+	}
+	switch ceremony.Status {
+	case CeremonyStatusCompleted:
+		return nil, ErrCeremonyCompleted
+	case CeremonyStatusOpen:
+		return nil, ErrCeremonyNotApproved
+	}
+
+	entropy := &CeremonyEntropy{Source: ceremonyEntropySource, SystemBytes: 32, Mixing: "sha256(system || commitments)"}
+
+	var commitments [][]byte
+	for _, approval := range ceremony.Approvals {
+		if approval.EntropyCommitment == "" {
+			continue
+		}
+		commitment, err := hex.DecodeString(approval.EntropyCommitment)
+		if err != nil {
+			return nil, err
+		}
+		commitments = append(commitments, commitment)
+		entropy.OperatorContributions++
+	}
+
+	var account Account
+	for {
+		system := make([]byte, entropy.SystemBytes)
+		if _, err := rand.Read(system); err != nil {
+			return nil, err
+		}
+
+		hash := sha256.New()
+		hash.Write(system)
+		for _, commitment := range commitments {
+			hash.Write(commitment)
+		}
+
+		// A digest outside the curve order is astronomically unlikely;
+		// redraw if it happens.
+		privateKey, err := crypto.ToECDSA(hash.Sum(nil))
+		if err != nil {
+			continue
+		}
+
+		account, err = ImportAccount(ceremony.Label, privateKey, password)
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	now := time.Now().UTC()
+	ceremony.Status = CeremonyStatusCompleted
+	ceremony.Entropy = entropy
+	ceremony.Address = account.Address
+	ceremony.CompletedAt = &now
+
+	if err := writeJSONFile(ceremoniesFile, ceremonies); err != nil {
+		return nil, err
+	}
+
+	return ceremony, nil
+}
+
+func KeyCeremonyReport(id string) (*CeremonyReport, error) {
+	ceremoniesMu.Lock()
+	ceremonies, err := readCeremonies()
+	ceremoniesMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	ceremony, err := findCeremony(ceremonies, id)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := json.Marshal(ceremony)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := SignWithIdentity(report)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := IdentityPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &CeremonyReport{
+		Report:    report,
+		Algorithm: "ed25519",
+		PublicKey: hex.EncodeToString(publicKey),
+		Signature: base64.StdEncoding.EncodeToString(signature),
+	}, nil
+}
+
+func findCeremony(ceremonies []*KeyCeremony, id string) (*KeyCeremony, error) {
+	for _, ceremony := range ceremonies {
+		if ceremony.ID == id {
+			return ceremony, nil
+		}
+	}
+
+	return nil, ErrCeremonyNotFound
+}
+
+func readCeremonies() ([]*KeyCeremony, error) {
+	var ceremonies []*KeyCeremony
+	if err := readJSONFile(ceremoniesFile, &ceremonies); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return ceremonies, nil
+}
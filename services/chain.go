@@ -0,0 +1,584 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	defaultFeeRefreshInterval = 12 * time.Second
+
+	// An endpoint that could not be dialled, or whose chain could not be
+	// determined, is not retried for this long, so one dead secondary does
+	// not slow every lookup. Requests to the default endpoint fail fast in
+	// the meantime, and retry sooner.
+	chainRetryInterval   = time.Minute
+	defaultRetryInterval = 5 * time.Second
+
+	defaultHealthCheckInterval = 30 * time.Second
+
+	// The client of an endpoint removed or changed by a reload is closed
+	// once requests already using it have had time to finish.
+	rpcDrainTimeout = time.Minute
+)
+
+// Chain is one network in the chain registry. The registry is built from the
+// configured RPC endpoints: each distinct chain ID is served by the first
+// endpoint that reports it, and the first endpoint's chain is the default for
+// requests that do not pick one unless another network is selected.
+//
+// The chain ID never changes for an endpoint, so it is fetched once and the
+// signer built from it is shared by every send. Fee data does change; the
+// default chain's is refreshed by StartFeeRefresher, either on every new head
+// (websocket endpoints) or on FEE_REFRESH_INTERVAL, and other chains fetch it
+// on demand.
+type Chain struct {
+	ID        *big.Int
+	Name      string
+	ShortName string
+
+	client *rpcClient
+	// retired is set when a reload removes or changes the chain's endpoint.
+	retired atomic.Bool
+
+	feeMu      sync.Mutex
+	gasPrice   *big.Int
+	feeFetched time.Time
+}
+
+// EndpointHealth is the outcome of the last health check of an RPC endpoint.
+type EndpointHealth struct {
+	Endpoint  string    `json:"endpoint"`
+	Healthy   bool      `json:"healthy"`
+	Block     uint64    `json:"block,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ChainInfo describes a registry entry for API responses.
+type ChainInfo struct {
+	ChainID   uint64 `json:"chain_id"`
+	Name      string `json:"name"`
+	ShortName string `json:"short_name,omitempty"`
+	Default   bool   `json:"default"`
+}
+
+var (
+	rpcEndpoints []RPCEndpoint
+	rpcClients   []*rpcClient
+
+	registryMu     sync.Mutex
+	registry       = map[int]*Chain{}
+	registryFailed = map[int]endpointFailure{}
+
+	healthMu sync.Mutex
+	health   []EndpointHealth
+
+	signersMu sync.Mutex
+	signers   = map[uint64]types.Signer{}
+
+	feeRefreshInterval = defaultFeeRefreshInterval
+)
+
+type endpointFailure struct {
+	at  time.Time
+	err error
+}
+
+var (
+	ErrUnknownChain   = errors.New("unknown chain")
+	ErrRPCUnavailable = errors.New("RPC endpoint unavailable")
+)
+
+// init only reads the RPC configuration. Endpoints are dialled the first time
+// a request needs them, so the wallet starts, and generates keys and signs
+// messages, without a connection to any node.
+func init() {
+	loaded, err := loadSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+	currentSettings = loaded
+	applyBreakerSettings(readBreakerSettings(loaded))
+
+	endpoints, err := loadRPCEndpoints(loaded)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rpcEndpoints = endpoints
+	rpcClients = make([]*rpcClient, len(endpoints))
+
+	if raw := os.Getenv("FEE_REFRESH_INTERVAL"); raw != "" {
+		if interval, err := time.ParseDuration(raw); err == nil && interval > 0 {
+			feeRefreshInterval = interval
+		}
+	}
+}
+
+// ResolveChain looks up a chain by ID (decimal or 0x-prefixed hex), by the
+// name of its endpoint or by the name of a well-known network. An empty
+// selector is the selected network, or the default chain if none is.
+func ResolveChain(selector string) (*Chain, error) {
+	ctx := context.Background()
+
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return selectedChain(ctx)
+	}
+
+	chains, err := chainRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if id, ok := parseChainID(selector); ok {
+		for _, chain := range chains {
+			if chain.ID.Cmp(id) == 0 {
+				return chain, nil
+			}
+		}
+	}
+	for _, chain := range chains {
+		if strings.EqualFold(chain.Name, selector) {
+			return chain, nil
+		}
+	}
+	if network, ok := knownNetwork(selector); ok {
+		for _, chain := range chains {
+			if chain.ID.IsUint64() && chain.ID.Uint64() == network.ChainID {
+				return chain, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s is not a configured chain", ErrUnknownChain, selector)
+}
+
+// ListChains describes every chain in the registry, the first endpoint's
+// first. Default marks the chain requests without a chain_id go to.
+func ListChains() ([]ChainInfo, error) {
+	ctx := context.Background()
+
+	chains, err := chainRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedChain(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ChainInfo, len(chains))
+	for i, chain := range chains {
+		infos[i] = ChainInfo{ChainID: chain.ID.Uint64(), Name: chain.Name, ShortName: chain.ShortName, Default: chain == selected}
+	}
+
+	return infos, nil
+}
+
+// chainByID finds the chain a stored record belongs to. Records written before
+// chains were tracked have no ID and belong to the default chain, the first
+// endpoint's, whichever network is selected.
+func chainByID(ctx context.Context, id uint64) (*Chain, error) {
+	if id == 0 {
+		return defaultChain(ctx)
+	}
+
+	chains, err := chainRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chain := range chains {
+		if chain.ID.IsUint64() && chain.ID.Uint64() == id {
+			return chain, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %d is not a configured chain", ErrUnknownChain, id)
+}
+
+func defaultChain(ctx context.Context) (*Chain, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	return resolveEndpoint(ctx, 0)
+}
+
+// chainRegistry returns one chain per distinct chain ID among the configured
+// endpoints, default chain first. Secondary endpoints that cannot be reached
+// are left out until they can.
+func chainRegistry(ctx context.Context) ([]*Chain, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	var chains []*Chain
+	seen := map[string]bool{}
+	for i := range rpcEndpoints {
+		chain, err := resolveEndpoint(ctx, i)
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			continue
+		}
+
+		if seen[chain.ID.String()] {
+			continue
+		}
+		seen[chain.ID.String()] = true
+		chains = append(chains, chain)
+	}
+
+	return chains, nil
+}
+
+// resolveEndpoint must be called with registryMu held. Until an endpoint
+// that failed may be retried, its last error is returned straight away.
+func resolveEndpoint(ctx context.Context, index int) (*Chain, error) {
+	if chain, ok := registry[index]; ok {
+		return chain, nil
+	}
+
+	retry := chainRetryInterval
+	if index == 0 {
+		retry = defaultRetryInterval
+	}
+	if failure, ok := registryFailed[index]; ok && time.Since(failure.at) < retry {
+		return nil, failure.err
+	}
+
+	chain, err := connectEndpoint(ctx, index)
+	if err != nil {
+		err = fmt.Errorf("%w: %s: %v", ErrRPCUnavailable, endpointName(rpcEndpoints[index]), err)
+		log.Printf("chain registry: %v", err)
+		registryFailed[index] = endpointFailure{at: time.Now(), err: err}
+		return nil, err
+	}
+	delete(registryFailed, index)
+	registry[index] = chain
+
+	return chain, nil
+}
+
+// connectEndpoint dials an endpoint if it has not been yet and determines its
+// chain. A client that dialled is kept, so a retry only repeats what failed.
+func connectEndpoint(ctx context.Context, index int) (*Chain, error) {
+	ctx, cancel := context.WithTimeout(ctx, rpcReadTimeout)
+	defer cancel()
+
+	endpoint := rpcEndpoints[index]
+	if rpcClients[index] == nil {
+		client, err := dialRPC(ctx, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		rpcClients[index] = newRPCClient(client)
+	}
+	client := rpcClients[index]
+
+	var id *big.Int
+	if endpoint.ChainID != 0 {
+		id = new(big.Int).SetUint64(endpoint.ChainID)
+	} else {
+		var err error
+		if id, err = client.ChainID(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	name := endpointName(endpoint)
+
+	shortName := endpoint.ShortName
+	if network, ok := knownNetworkByID(id); ok && shortName == "" {
+		shortName = network.ShortName
+	}
+
+	return &Chain{ID: id, Name: name, ShortName: shortName, client: client}, nil
+}
+
+// swapRPCEndpoints replaces the configured endpoints and reports whether
+// they changed. Endpoints that are the same as before keep their connection
+// and chain; requests already holding a chain whose endpoint went away
+// finish on its old connection.
+func swapRPCEndpoints(endpoints []RPCEndpoint) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if reflect.DeepEqual(endpoints, rpcEndpoints) {
+		return false
+	}
+
+	clients := make([]*rpcClient, len(endpoints))
+	chains := map[int]*Chain{}
+	kept := map[int]bool{}
+	for i, endpoint := range endpoints {
+		for j, old := range rpcEndpoints {
+			if kept[j] || !reflect.DeepEqual(endpoint, old) {
+				continue
+			}
+			kept[j] = true
+			clients[i] = rpcClients[j]
+			if chain, ok := registry[j]; ok {
+				chains[i] = chain
+			}
+			break
+		}
+	}
+
+	for j, client := range rpcClients {
+		if kept[j] {
+			continue
+		}
+		if chain, ok := registry[j]; ok {
+			chain.retired.Store(true)
+		}
+		if client != nil {
+			time.AfterFunc(rpcDrainTimeout, client.Close)
+		}
+	}
+
+	rpcEndpoints, rpcClients = endpoints, clients
+	registry, registryFailed = chains, map[int]endpointFailure{}
+	return true
+}
+
+func endpointName(endpoint RPCEndpoint) string {
+	if endpoint.Name != "" {
+		return endpoint.Name
+	}
+
+	return endpointHost(endpoint.URL)
+}
+
+// StartRPCHealthChecks checks every RPC_HEALTH_INTERVAL that each endpoint
+// answers, dialling those that could not be reached before. Failed checks
+// count towards the endpoint's circuit breaker like any other call.
+func StartRPCHealthChecks() {
+	interval := defaultHealthCheckInterval
+	if raw := os.Getenv("RPC_HEALTH_INTERVAL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			interval = parsed
+		}
+	}
+
+	go func() {
+		for {
+			checkRPCHealth()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// RPCHealth returns the outcome of the last health check of each endpoint.
+func RPCHealth() []EndpointHealth {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	return append([]EndpointHealth{}, health...)
+}
+
+func checkRPCHealth() {
+	registryMu.Lock()
+	endpoints := rpcEndpoints
+	clients := make([]*rpcClient, len(endpoints))
+	errs := make([]error, len(endpoints))
+	for i := range endpoints {
+		if _, err := resolveEndpoint(context.Background(), i); err != nil {
+			errs[i] = err
+			continue
+		}
+		clients[i] = rpcClients[i]
+	}
+	registryMu.Unlock()
+
+	results := make([]EndpointHealth, len(endpoints))
+	for i, endpoint := range endpoints {
+		result := EndpointHealth{Endpoint: endpointName(endpoint), CheckedAt: time.Now().UTC()}
+		if errs[i] == nil {
+			// The embedded client is asked directly, as the wrapper could
+			// answer from its cache.
+			ctx, cancel := context.WithTimeout(context.Background(), rpcReadTimeout)
+			result.Block, errs[i] = clients[i].Client.BlockNumber(ctx)
+			cancel()
+		}
+		if errs[i] != nil {
+			result.Error = errs[i].Error()
+		}
+		result.Healthy = errs[i] == nil
+		results[i] = result
+	}
+
+	healthMu.Lock()
+	health = results
+	healthMu.Unlock()
+}
+
+func parseChainID(value string) (*big.Int, bool) {
+	if hex, ok := strings.CutPrefix(strings.ToLower(value), "0x"); ok {
+		id, err := strconv.ParseUint(hex, 16, 64)
+		return new(big.Int).SetUint64(id), err == nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	return new(big.Int).SetUint64(id), err == nil
+}
+
+func (c *Chain) signer() types.Signer {
+	return signerForChain(c.ID)
+}
+
+func signerForChain(id *big.Int) types.Signer {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+
+	signer, ok := signers[id.Uint64()]
+	if !ok {
+		signer = types.LatestSignerForChainID(id)
+		signers[id.Uint64()] = signer
+	}
+
+	return signer
+}
+
+// currentGasPrice returns the last refreshed gas price, fetching a new one if
+// it is older than the refresh interval.
+func (c *Chain) currentGasPrice(ctx context.Context) (*big.Int, error) {
+	c.feeMu.Lock()
+	if c.gasPrice != nil && time.Since(c.feeFetched) < feeRefreshInterval {
+		gasPrice := new(big.Int).Set(c.gasPrice)
+		c.feeMu.Unlock()
+		return gasPrice, nil
+	}
+	c.feeMu.Unlock()
+
+	return c.refreshGasPrice(ctx)
+}
+
+func (c *Chain) refreshGasPrice(ctx context.Context) (*big.Int, error) {
+	gasPrice, err := c.client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.feeMu.Lock()
+	c.gasPrice = new(big.Int).Set(gasPrice)
+	c.feeFetched = time.Now()
+	c.feeMu.Unlock()
+
+	return gasPrice, nil
+}
+
+func StartFeeRefresher() {
+	go func() {
+		for {
+			chain, err := defaultChain(context.Background())
+			if err != nil {
+				log.Printf("fee refresher: %v", err)
+				time.Sleep(feeRefreshInterval)
+				continue
+			}
+
+			// Both return once a reload retires the chain, and the
+			// default chain is looked up again.
+			err = chain.refreshOnNewHeads()
+			if errors.Is(err, rpc.ErrNotificationsUnsupported) {
+				chain.refreshOnInterval()
+				continue
+			}
+			if !chain.retired.Load() {
+				log.Printf("fee refresher: %v", err)
+				time.Sleep(feeRefreshInterval)
+			}
+		}
+	}()
+}
+
+// refreshOnNewHeads returns when the subscription fails, or with nil once
+// the chain is retired. It returns rpc.ErrNotificationsUnsupported straight
+// away on HTTP endpoints.
+func (c *Chain) refreshOnNewHeads() error {
+	heads := make(chan *types.Header)
+	sub, err := c.client.SubscribeNewHead(context.Background(), heads)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	retired := time.NewTicker(feeRefreshInterval)
+	defer retired.Stop()
+
+	for {
+		select {
+		case err := <-sub.Err():
+			return err
+		case <-retired.C:
+			if c.retired.Load() {
+				return nil
+			}
+		case <-heads:
+			if _, err := c.refreshGasPrice(context.Background()); err != nil {
+				log.Printf("fee refresher: %v", err)
+			}
+		}
+	}
+}
+
+func (c *Chain) refreshOnInterval() {
+	ticker := time.NewTicker(feeRefreshInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if c.retired.Load() {
+			return
+		}
+		if _, err := c.refreshGasPrice(context.Background()); err != nil {
+			log.Printf("fee refresher: %v", err)
+		}
+	}
+}
+
+// dynamicFees fills in the fee cap and tip of an EIP-1559 transaction that
+// fees leaves unset, from the latest block's base fee.
+func (c *Chain) dynamicFees(ctx context.Context, fees FeeOptions) (feeCap, tip *big.Int, err error) {
+	header, err := c.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.BaseFee == nil {
+		return nil, nil, fmt.Errorf("%w: chain %s", ErrDynamicFeesUnsupported, c.ID)
+	}
+
+	tip = fees.MaxPriorityFeePerGas
+	if tip == nil {
+		if tip, err = c.client.SuggestGasTipCap(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	feeCap = fees.MaxFeePerGas
+	if feeCap == nil {
+		feeCap = new(big.Int).Add(new(big.Int).Mul(header.BaseFee, big.NewInt(2)), tip)
+	}
+	if tip.Cmp(feeCap) > 0 {
+		if fees.MaxPriorityFeePerGas != nil {
+			return nil, nil, fmt.Errorf("%w: max_priority_fee_per_gas is above max_fee_per_gas", ErrInvalidFees)
+		}
+		// The suggested tip alone is above the cap given.
+		tip = feeCap
+	}
+
+	return feeCap, tip, nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jabbala-dev/go-wallet/models"
+)
+
+const (
+	defaultChallengeTTL = 5 * time.Minute
+	maxChallengeTTL     = time.Hour
+	// challengeRetention is how long a challenge is kept after it expires,
+	// so a late attempt to use it is told it expired rather than unknown.
+	challengeRetention = 24 * time.Hour
+
+	challengePurpose = "login"
+)
+
+// Challenge is a message issued for someone to sign, to prove they hold an
+// address, that can be verified once. Message is exactly what gets signed:
+// plain text for personal_sign, or the canonical form of Container when the
+// challenge was issued as a signing container. Address, if set, is the only
+// signer it accepts.
+type Challenge struct {
+	Nonce      string            `json:"nonce"`
+	Address    string            `json:"address,omitempty"`
+	Message    string            `json:"message"`
+	Container  *SigningContainer `json:"container,omitempty"`
+	IssuedAt   time.Time         `json:"issued_at"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+	ConsumedAt *time.Time        `json:"consumed_at,omitempty"`
+	Signer     string            `json:"signer,omitempty"`
+}
+
+var (
+	challengesFile = "challenges.json"
+	challengesMu   sync.Mutex
+)
+
+var (
+	ErrChallengeNotFound = errors.New("challenge not found")
+	ErrChallengeExpired  = errors.New("challenge has expired")
+	ErrChallengeConsumed = errors.New("challenge has already been used")
+	ErrInvalidChallenge  = errors.New("invalid challenge")
+)
+
+// IssueChallenge creates a challenge valid for ttl, five minutes if zero.
+// statement, if given, opens the message, such as "Sign in to Example". As a
+// container the challenge is signed as /sign signs containers, with the
+// nonce as its payload.
+func IssueChallenge(address, statement string, ttl time.Duration, asContainer bool) (*Challenge, error) {
+	if address != "" {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("%w: %q is not an address", ErrInvalidChallenge, address)
+		}
+		address = common.HexToAddress(address).Hex()
+	}
+	if ttl == 0 {
+		ttl = defaultChallengeTTL
+	}
+	if ttl < 0 || ttl > maxChallengeTTL {
+		return nil, fmt.Errorf("%w: the lifetime must be at most %s", ErrInvalidChallenge, maxChallengeTTL)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	challenge := &Challenge{
+		Nonce:     newID(),
+		Address:   address,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if asContainer {
+		challenge.Container = &SigningContainer{
+			Purpose:   challengePurpose,
+			Payload:   challenge.Nonce,
+			Encoding:  models.EncodingUTF8,
+			ExpiresAt: &challenge.ExpiresAt,
+		}
+		canonical, err := challenge.Container.Canonical()
+		if err != nil {
+			return nil, err
+		}
+		challenge.Message = canonical
+	} else {
+		var message strings.Builder
+		if statement = strings.TrimSpace(statement); statement != "" {
+			message.WriteString(statement + "\n\n")
+		}
+		if address != "" {
+			message.WriteString("Address: " + address + "\n")
+		}
+		fmt.Fprintf(&message, "Nonce: %s\nIssued At: %s\nExpires At: %s", challenge.Nonce,
+			challenge.IssuedAt.Format(time.RFC3339), challenge.ExpiresAt.Format(time.RFC3339))
+		challenge.Message = message.String()
+	}
+
+	challengesMu.Lock()
+	defer challengesMu.Unlock()
+
+	challenges, err := readChallenges()
+	if err != nil {
+		return nil, err
+	}
+	challenges[challenge.Nonce] = challenge
+	if err := writeJSONFile(challengesFile, challenges); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// ConsumeChallenge checks a signature over a challenge's message and, if it
+// is good, marks the challenge used so the same signature cannot be
+// replayed. A bad signature leaves the challenge open and reports false. The
+// signer is anyone unless the challenge was issued for an address.
+func ConsumeChallenge(nonce, signatureHex, scheme string) (bool, *Challenge, error) {
+	challengesMu.Lock()
+	defer challengesMu.Unlock()
+
+	challenges, err := readChallenges()
+	if err != nil {
+		return false, nil, err
+	}
+	challenge, ok := challenges[nonce]
+	if !ok {
+		return false, nil, ErrChallengeNotFound
+	}
+	if challenge.ConsumedAt != nil {
+		return false, nil, fmt.Errorf("%w at %s", ErrChallengeConsumed, challenge.ConsumedAt.Format(time.RFC3339))
+	}
+	now := time.Now().UTC()
+	if !now.Before(challenge.ExpiresAt) {
+		return false, nil, fmt.Errorf("%w at %s", ErrChallengeExpired, challenge.ExpiresAt.Format(time.RFC3339))
+	}
+
+	signer, err := RecoverSigner(challenge.Message, signatureHex, scheme)
+	if err != nil {
+		return false, nil, err
+	}
+	if challenge.Address != "" && signer != challenge.Address {
+		return false, challenge, nil
+	}
+
+	challenge.ConsumedAt = &now
+	challenge.Signer = signer
+	if err := writeJSONFile(challengesFile, challenges); err != nil {
+		return false, nil, err
+	}
+
+	recordAudit("challenge.consumed", fmt.Sprintf("%s signed challenge %s", signer, nonce),
+		map[string]interface{}{"nonce": nonce, "signer": signer, "scheme": scheme})
+
+	return true, challenge, nil
+}
+
+// readChallenges loads the store, leaving out challenges long expired.
+func readChallenges() (map[string]*Challenge, error) {
+	challenges := map[string]*Challenge{}
+	if err := readJSONFile(challengesFile, &challenges); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-challengeRetention)
+	for nonce, challenge := range challenges {
+		if challenge.ExpiresAt.Before(cutoff) {
+			delete(challenges, nonce)
+		}
+	}
+
+	return challenges, nil
+}
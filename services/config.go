@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Settings that can change without a restart are read from CONFIG_FILE, a
+// JSON object of environment variable names to values, falling back to the
+// environment itself. They are the RPC endpoints (RPC_URL, NETWORKS, the
+// other RPC_* variables and the file named by RPC_CONFIG), the circuit
+// breaker thresholds and the intrusion detection limits. Policies, webhooks,
+// API keys and their quotas, and the access policy are kept in the data
+// directory and read on every use, so they change as soon as they are
+// written.
+//
+// A reload, on SIGHUP, when CONFIG_FILE or the RPC_CONFIG file changes, or
+// through the API, reads and checks everything before any of it is applied,
+// so a mistake leaves the running configuration as it was. Requests already
+// under way finish with the settings they started with.
+
+const defaultConfigWatchInterval = 5 * time.Second
+
+// settings holds the values CONFIG_FILE sets.
+type settings map[string]string
+
+// ConfigReload is the outcome of reloading the configuration. Changed names
+// the parts that differ from before.
+type ConfigReload struct {
+	Trigger    string    `json:"trigger"`
+	ReloadedAt time.Time `json:"reloaded_at"`
+	Changed    []string  `json:"changed"`
+	Error      string    `json:"error,omitempty"`
+}
+
+var (
+	// currentSettings is guarded by configMu, reloadMu serializes reloads.
+	configMu        sync.Mutex
+	currentSettings = settings{}
+	lastReload      *ConfigReload
+
+	reloadMu sync.Mutex
+)
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+func (s settings) get(name string) string {
+	if value, ok := s[name]; ok {
+		return value
+	}
+
+	return os.Getenv(name)
+}
+
+// setting reads a reloadable setting.
+func setting(name string) string {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	return currentSettings.get(name)
+}
+
+func loadSettings() (settings, error) {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return settings{}, nil
+	}
+
+	loaded := settings{}
+	if err := readJSONFile(path, &loaded); err != nil {
+		return nil, fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+	}
+
+	return loaded, nil
+}
+
+// ReloadConfig reads the configuration again and applies what changed.
+// trigger says what asked for it, for the report and the audit log.
+func ReloadConfig(trigger string) (*ConfigReload, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	report := &ConfigReload{Trigger: trigger, ReloadedAt: time.Now().UTC(), Changed: []string{}}
+
+	next, err := loadSettings()
+	var endpoints []RPCEndpoint
+	if err == nil {
+		endpoints, err = loadRPCEndpoints(next)
+	}
+	var intrusion intrusionSettings
+	if err == nil {
+		intrusion, err = readIntrusionSettings(next)
+	}
+	if err != nil {
+		report.Error = err.Error()
+		setLastReload(report)
+		recordAudit("config.reload_failed", fmt.Sprintf("configuration reload (%s) failed: %v", trigger, err),
+			map[string]interface{}{"trigger": trigger})
+		return report, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	configMu.Lock()
+	currentSettings = next
+	configMu.Unlock()
+
+	if swapRPCEndpoints(endpoints) {
+		report.Changed = append(report.Changed, "rpc_endpoints")
+	}
+	if applyBreakerSettings(readBreakerSettings(next)) {
+		report.Changed = append(report.Changed, "circuit_breakers")
+	}
+	if applyIntrusionSettings(intrusion) {
+		report.Changed = append(report.Changed, "intrusion_detection")
+	}
+
+	setLastReload(report)
+	recordAudit("config.reloaded", fmt.Sprintf("configuration reloaded (%s): %d changes", trigger, len(report.Changed)),
+		map[string]interface{}{"trigger": trigger, "changed": report.Changed})
+	return report, nil
+}
+
+// LastConfigReload returns the most recent reload, or nil before the first.
+func LastConfigReload() *ConfigReload {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	return lastReload
+}
+
+func setLastReload(report *ConfigReload) {
+	configMu.Lock()
+	lastReload = report
+	configMu.Unlock()
+}
+
+// StartConfigWatcher reloads the configuration on SIGHUP, and when
+// CONFIG_FILE or the RPC_CONFIG file is modified, checked every
+// CONFIG_WATCH_INTERVAL (default five seconds).
+func StartConfigWatcher() {
+	interval := defaultConfigWatchInterval
+	if raw := os.Getenv("CONFIG_WATCH_INTERVAL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			interval = parsed
+		}
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		modified := configModTimes()
+		for {
+			trigger := "file"
+			select {
+			case <-hangups:
+				trigger = "SIGHUP"
+			case <-ticker.C:
+				current := configModTimes()
+				if current == modified {
+					continue
+				}
+				modified = current
+			}
+
+			if _, err := ReloadConfig(trigger); err != nil {
+				log.Printf("config: %v", err)
+			}
+		}
+	}()
+}
+
+// configModTimes names the watched files' modification times, so that a
+// file that is replaced, created or removed counts as a change.
+func configModTimes() string {
+	var times string
+	for _, path := range []string{os.Getenv("CONFIG_FILE"), os.Getenv("RPC_CONFIG")} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			times += info.ModTime().String() + fmt.Sprint(info.Size())
+		}
+		times += ";"
+	}
+
+	return times
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jabbala-dev/go-wallet/models"
+)
+
+type SigningContainer = models.SigningContainer
+
+var ErrContainerExpired = errors.New("signing container has expired")
+
+// SignedContainer is a container's signature together with the canonical
+// form that was signed and its SHA-256 digest, which is how the audit log
+// refers to it.
+type SignedContainer struct {
+	Signature     string `json:"signature"`
+	Signer        string `json:"signer"`
+	SignedMessage string `json:"signed_message"`
+	Digest        string `json:"digest"`
+}
+
+// SignContainer signs the canonical form of a container under scheme, as
+// SignMessage signs a string, and records the signature in the audit log.
+// An expired container is refused.
+func SignContainer(account string, container SigningContainer, scheme string) (*SignedContainer, error) {
+	if container.Expired(time.Now()) {
+		return nil, fmt.Errorf("%w at %s", ErrContainerExpired, container.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	canonical, err := container.Canonical()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := messageHash(canonical, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	accountSigner, err := loadSignerFor(account)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signMessage(accountSigner, hash, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := accountSigner.Address().Hex()
+	digest := containerDigest(canonical)
+	details := map[string]interface{}{
+		"signer":   signer,
+		"purpose":  container.Purpose,
+		"encoding": container.Encoding,
+		"digest":   digest,
+		"scheme":   scheme,
+	}
+	if container.ChainID != 0 {
+		details["chain_id"] = container.ChainID
+	}
+	if container.ExpiresAt != nil {
+		details["expires_at"] = container.ExpiresAt.UTC()
+	}
+	recordAudit("message.signed", fmt.Sprintf("%s signed a %q container %s", signer, container.Purpose, digest), details)
+
+	return &SignedContainer{Signature: signature, Signer: signer, SignedMessage: canonical, Digest: digest}, nil
+}
+
+// VerifyContainer checks a signature from SignContainer against an account,
+// the selected one if empty. A container that has since expired still
+// verifies; whether to accept it is up to the caller.
+func VerifyContainer(account string, container SigningContainer, signatureHex, scheme string) (bool, error) {
+	canonical, err := container.Canonical()
+	if err != nil {
+		return false, err
+	}
+
+	return VerifyMessage(account, canonical, signatureHex, scheme)
+}
+
+func containerDigest(canonical string) string {
+	digest := sha256.Sum256([]byte(canonical))
+	return hexutil.Encode(digest[:])
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Contract is a contract registered by name with its ABI, so its methods
+// can be called with JSON arguments. Like NFT collections, it lives on one
+// chain and every call goes there.
+type Contract struct {
+	Name      string          `json:"name"`
+	ChainID   uint64          `json:"chain_id,omitempty"`
+	Address   string          `json:"address"`
+	ABI       json.RawMessage `json:"abi"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ContractValue is one output of a call, encoded as its inputs are:
+// integers as decimal strings, bytes as 0x-prefixed hex and tuples as
+// objects.
+type ContractValue struct {
+	Name  string      `json:"name,omitempty"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type ContractCallResult struct {
+	Contract string          `json:"contract"`
+	Address  string          `json:"address"`
+	Method   string          `json:"method"`
+	Outputs  []ContractValue `json:"outputs"`
+}
+
+type ContractSendResult struct {
+	Contract string `json:"contract"`
+	Address  string `json:"address"`
+	Method   string `json:"method"`
+	TxHash   string `json:"transaction_hash"`
+	Value    string `json:"value"`
+}
+
+var (
+	contractsFile = "contracts.json"
+	contractsMu   sync.Mutex
+)
+
+var (
+	ErrContractNotFound    = errors.New("contract not found")
+	ErrInvalidContract     = errors.New("invalid contract")
+	ErrInvalidContractCall = errors.New("invalid contract call")
+	ErrContractReverted    = errors.New("contract call reverted")
+)
+
+// RegisterContract adds a contract, or replaces the one of the same name.
+func RegisterContract(contract Contract) (*Contract, error) {
+	if contract.Name == "" || strings.ContainsAny(contract.Name, "/ ") {
+		return nil, fmt.Errorf("%w: name is required and cannot contain spaces or slashes", ErrInvalidContract)
+	}
+	if !common.IsHexAddress(contract.Address) {
+		return nil, fmt.Errorf("%w: %q is not an address", ErrInvalidContract, contract.Address)
+	}
+	parsed, err := abi.JSON(strings.NewReader(string(contract.ABI)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: abi: %v", ErrInvalidContract, err)
+	}
+	if len(parsed.Methods) == 0 {
+		return nil, fmt.Errorf("%w: the abi has no methods", ErrInvalidContract)
+	}
+	contract.Address = common.HexToAddress(contract.Address).Hex()
+	contract.CreatedAt = time.Now().UTC()
+
+	contractsMu.Lock()
+	defer contractsMu.Unlock()
+
+	contracts, err := readContracts()
+	if err != nil {
+		return nil, err
+	}
+
+	contracts[contract.Name] = &contract
+	if err := writeJSONFile(contractsFile, contracts); err != nil {
+		return nil, err
+	}
+
+	return &contract, nil
+}
+
+func ListContracts() ([]*Contract, error) {
+	contractsMu.Lock()
+	defer contractsMu.Unlock()
+
+	contracts, err := readContracts()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Contract, 0, len(contracts))
+	for _, contract := range contracts {
+		list = append(list, contract)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list, nil
+}
+
+func DeleteContract(name string) error {
+	contractsMu.Lock()
+	defer contractsMu.Unlock()
+
+	contracts, err := readContracts()
+	if err != nil {
+		return err
+	}
+	if _, ok := contracts[name]; !ok {
+		return ErrContractNotFound
+	}
+
+	delete(contracts, name)
+	return writeJSONFile(contractsFile, contracts)
+}
+
+// CallContractMethod reads a method of a registered contract with eth_call
+// and decodes what it returns. from, if set, is the caller the method sees,
+// for methods that depend on msg.sender. State-changing methods can be
+// called too, to see what they would return; nothing is sent.
+func CallContractMethod(name, method string, rawArgs []json.RawMessage, from string) (*ContractCallResult, error) {
+	contract, parsed, chain, err := loadContract(name)
+	if err != nil {
+		return nil, err
+	}
+	abiMethod, data, err := packContractCall(parsed, method, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := ethereum.CallMsg{To: &contract, Data: data}
+	if from != "" {
+		if !common.IsHexAddress(from) {
+			return nil, fmt.Errorf("%w: %q is not an address", ErrInvalidContractCall, from)
+		}
+		msg.From = common.HexToAddress(from)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcReadTimeout)
+	defer cancel()
+	output, err := chain.client.CallContract(ctx, msg, nil)
+	if err != nil {
+		if isRevert(err) {
+			return nil, fmt.Errorf("%w: %v", ErrContractReverted, err)
+		}
+		return nil, err
+	}
+
+	values, err := abiMethod.Outputs.Unpack(output)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot decode the output of %s: %v", ErrContractReverted, method, err)
+	}
+	result := &ContractCallResult{Contract: name, Address: contract.Hex(), Method: abiMethod.Name, Outputs: []ContractValue{}}
+	for i, output := range abiMethod.Outputs {
+		result.Outputs = append(result.Outputs, ContractValue{
+			Name:  output.Name,
+			Type:  output.Type.String(),
+			Value: jsonABIValue(output.Type, reflect.ValueOf(values[i])),
+		})
+	}
+
+	return result, nil
+}
+
+// SendContractMethod sends a transaction calling a state-changing method of
+// a registered contract from an account, the selected one if empty. value
+// is only accepted by a payable method.
+func SendContractMethod(name, method string, rawArgs []json.RawMessage, account string, value *big.Int) (*ContractSendResult, error) {
+	contract, parsed, chain, err := loadContract(name)
+	if err != nil {
+		return nil, err
+	}
+	abiMethod, data, err := packContractCall(parsed, method, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	if abiMethod.IsConstant() {
+		return nil, fmt.Errorf("%w: %s does not change state; call it instead", ErrInvalidContractCall, abiMethod.Name)
+	}
+	if value.Sign() > 0 && !abiMethod.IsPayable() {
+		return nil, fmt.Errorf("%w: %s is not payable", ErrInvalidContractCall, abiMethod.Name)
+	}
+
+	signer, err := loadSignerFor(account)
+	if err != nil {
+		return nil, err
+	}
+	txHash, err := sendContractTransaction(chain, signer, contract, value, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContractSendResult{
+		Contract: name,
+		Address:  contract.Hex(),
+		Method:   abiMethod.Name,
+		TxHash:   txHash,
+		Value:    value.String(),
+	}, nil
+}
+
+func loadContract(name string) (common.Address, abi.ABI, *Chain, error) {
+	contractsMu.Lock()
+	contracts, err := readContracts()
+	contractsMu.Unlock()
+	if err != nil {
+		return common.Address{}, abi.ABI{}, nil, err
+	}
+
+	contract, ok := contracts[name]
+	if !ok {
+		return common.Address{}, abi.ABI{}, nil, ErrContractNotFound
+	}
+	parsed, err := abi.JSON(strings.NewReader(string(contract.ABI)))
+	if err != nil {
+		return common.Address{}, abi.ABI{}, nil, err
+	}
+	chain, err := chainByID(context.Background(), contract.ChainID)
+	if err != nil {
+		return common.Address{}, abi.ABI{}, nil, err
+	}
+
+	return common.HexToAddress(contract.Address), parsed, chain, nil
+}
+
+// packContractCall encodes a call to a method by name. Overloaded methods
+// go by the names the abi package gives them: transfer, transfer0 and so on.
+func packContractCall(parsed abi.ABI, method string, rawArgs []json.RawMessage) (abi.Method, []byte, error) {
+	abiMethod, ok := parsed.Methods[method]
+	if !ok {
+		return abi.Method{}, nil, fmt.Errorf("%w: the abi has no method %q", ErrInvalidContractCall, method)
+	}
+	args, err := packJSONArgs(abiMethod.Inputs, rawArgs)
+	if err != nil {
+		return abi.Method{}, nil, fmt.Errorf("%w: %v", ErrInvalidContractCall, err)
+	}
+	data, err := parsed.Pack(method, args...)
+	if err != nil {
+		return abi.Method{}, nil, fmt.Errorf("%w: %v", ErrInvalidContractCall, err)
+	}
+
+	return abiMethod, data, nil
+}
+
+func readContracts() (map[string]*Contract, error) {
+	contracts := map[string]*Contract{}
+	if err := readJSONFile(contractsFile, &contracts); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return contracts, nil
+}
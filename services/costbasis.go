@@ -0,0 +1,575 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cost basis methods: which lots a disposal uses up first.
+const (
+	CostBasisFIFO = "fifo"
+	CostBasisLIFO = "lifo"
+)
+
+// Kinds of disposal in a gains report.
+const (
+	DisposalTransfer = "transfer"
+	DisposalFee      = "fee"
+)
+
+// longTermHolding is how long a lot is held before its gain is long-term.
+const longTermHolding = 365 * 24 * time.Hour
+
+// FiatPrice is the fiat price of one whole coin of a chain's native
+// currency from At until the next price for the chain.
+type FiatPrice struct {
+	ChainID uint64    `json:"chain_id"`
+	At      time.Time `json:"at"`
+	Price   string    `json:"price"`
+}
+
+// CostLot is an acquisition the ledger does not show, such as coins held
+// before the ledger was enabled or bought on an exchange and withdrawn by a
+// transfer the wallet did not send. Amount is in wei; Cost is what was paid
+// in fiat, and if empty the amount is priced at AcquiredAt.
+type CostLot struct {
+	ID         string    `json:"id"`
+	ChainID    uint64    `json:"chain_id"`
+	Amount     string    `json:"amount"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	Cost       string    `json:"cost,omitempty"`
+	Note       string    `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// GainsReport matches the disposals of a chain's native currency between
+// Since and Until with the lots they used up, and totals the realized
+// gains. Fiat amounts are rounded to cents. OpenLots are what is left of
+// the lots at Until.
+type GainsReport struct {
+	ChainID       uint64      `json:"chain_id"`
+	Method        string      `json:"method"`
+	Currency      string      `json:"currency"`
+	Since         *time.Time  `json:"since,omitempty"`
+	Until         time.Time   `json:"until"`
+	Proceeds      string      `json:"proceeds"`
+	CostBasis     string      `json:"cost_basis"`
+	Gain          string      `json:"gain"`
+	ShortTermGain string      `json:"short_term_gain"`
+	LongTermGain  string      `json:"long_term_gain"`
+	Disposals     []*Disposal `json:"disposals"`
+	OpenLots      []*OpenLot  `json:"open_lots"`
+}
+
+// Disposal is coins leaving the wallet: a transfer's value or a fee. It is
+// valued at the price when it was mined. Unmatched is the part no lot was
+// left to cover, taken to have cost nothing.
+type Disposal struct {
+	EntryID    string      `json:"entry_id"`
+	Kind       string      `json:"kind"`
+	DisposedAt time.Time   `json:"disposed_at"`
+	Amount     string      `json:"amount"`
+	Proceeds   string      `json:"proceeds"`
+	CostBasis  string      `json:"cost_basis"`
+	Gain       string      `json:"gain"`
+	Lots       []*LotMatch `json:"lots"`
+	Unmatched  string      `json:"unmatched,omitempty"`
+}
+
+// LotMatch is the part of a lot a disposal used up.
+type LotMatch struct {
+	LotID      string    `json:"lot_id"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	Amount     string    `json:"amount"`
+	CostBasis  string    `json:"cost_basis"`
+	Proceeds   string    `json:"proceeds"`
+	Gain       string    `json:"gain"`
+	LongTerm   bool      `json:"long_term"`
+}
+
+// OpenLot is what remains of a lot.
+type OpenLot struct {
+	LotID      string    `json:"lot_id"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	Amount     string    `json:"amount"`
+	CostBasis  string    `json:"cost_basis"`
+}
+
+var (
+	pricesFile = "fiat_prices.json"
+	pricesMu   sync.Mutex
+
+	costLotsFile = "cost_lots.json"
+	costLotsMu   sync.Mutex
+)
+
+var (
+	ErrInvalidPrice     = errors.New("invalid price")
+	ErrPriceNotFound    = errors.New("price not found")
+	ErrNoFiatPrice      = errors.New("no fiat price recorded")
+	ErrInvalidLot       = errors.New("invalid lot")
+	ErrLotNotFound      = errors.New("lot not found")
+	ErrInvalidCostBasis = errors.New("invalid cost basis method")
+)
+
+// FiatCurrency is the currency prices are recorded in, FIAT_CURRENCY or
+// USD. It only labels reports; amounts are never converted.
+func FiatCurrency() string {
+	if currency := os.Getenv("FIAT_CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return "USD"
+}
+
+// DefaultCostBasisMethod is COST_BASIS_METHOD, fifo unless set to lifo.
+func DefaultCostBasisMethod() string {
+	if strings.EqualFold(os.Getenv("COST_BASIS_METHOD"), CostBasisLIFO) {
+		return CostBasisLIFO
+	}
+	return CostBasisFIFO
+}
+
+// ListFiatPrices returns the prices for chainID, every chain if zero, in
+// time order.
+func ListFiatPrices(chainID uint64) ([]*FiatPrice, error) {
+	pricesMu.Lock()
+	defer pricesMu.Unlock()
+
+	prices, err := readFiatPrices()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []*FiatPrice{}
+	for _, price := range prices {
+		if chainID == 0 || price.ChainID == chainID {
+			matched = append(matched, price)
+		}
+	}
+
+	return matched, nil
+}
+
+// SaveFiatPrices records prices, replacing any for the same chain and time,
+// so a history can be imported in one call.
+func SaveFiatPrices(prices []FiatPrice) ([]*FiatPrice, error) {
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("%w: no prices given", ErrInvalidPrice)
+	}
+	for i := range prices {
+		price := &prices[i]
+		if price.ChainID == 0 {
+			return nil, fmt.Errorf("%w: chain_id is required", ErrInvalidPrice)
+		}
+		if price.At.IsZero() {
+			return nil, fmt.Errorf("%w: at is required", ErrInvalidPrice)
+		}
+		if value, ok := new(big.Rat).SetString(price.Price); !ok || value.Sign() < 0 {
+			return nil, fmt.Errorf("%w: %q is not a price", ErrInvalidPrice, price.Price)
+		}
+		price.At = price.At.UTC()
+	}
+
+	pricesMu.Lock()
+	defer pricesMu.Unlock()
+
+	existing, err := readFiatPrices()
+	if err != nil {
+		return nil, err
+	}
+	byKey := map[string]*FiatPrice{}
+	for _, price := range existing {
+		byKey[priceKey(price.ChainID, price.At)] = price
+	}
+	saved := make([]*FiatPrice, 0, len(prices))
+	for i := range prices {
+		byKey[priceKey(prices[i].ChainID, prices[i].At)] = &prices[i]
+		saved = append(saved, &prices[i])
+	}
+
+	all := make([]*FiatPrice, 0, len(byKey))
+	for _, price := range byKey {
+		all = append(all, price)
+	}
+	sortFiatPrices(all)
+	if err := writeJSONFile(pricesFile, all); err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// DeleteFiatPrice removes the price for a chain at a time.
+func DeleteFiatPrice(chainID uint64, at time.Time) error {
+	pricesMu.Lock()
+	defer pricesMu.Unlock()
+
+	prices, err := readFiatPrices()
+	if err != nil {
+		return err
+	}
+
+	kept := prices[:0]
+	for _, price := range prices {
+		if price.ChainID != chainID || !price.At.Equal(at) {
+			kept = append(kept, price)
+		}
+	}
+	if len(kept) == len(prices) {
+		return ErrPriceNotFound
+	}
+
+	return writeJSONFile(pricesFile, kept)
+}
+
+// ListCostLots returns the lots recorded for chainID, every chain if zero.
+func ListCostLots(chainID uint64) ([]*CostLot, error) {
+	costLotsMu.Lock()
+	defer costLotsMu.Unlock()
+
+	lots, err := readCostLots()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []*CostLot{}
+	for _, lot := range lots {
+		if chainID == 0 || lot.ChainID == chainID {
+			matched = append(matched, lot)
+		}
+	}
+
+	return matched, nil
+}
+
+func AddCostLot(lot CostLot) (*CostLot, error) {
+	if lot.ChainID == 0 {
+		return nil, fmt.Errorf("%w: chain_id is required", ErrInvalidLot)
+	}
+	if amount, ok := new(big.Int).SetString(lot.Amount, 10); !ok || amount.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: %q is not a positive wei amount", ErrInvalidLot, lot.Amount)
+	}
+	if lot.AcquiredAt.IsZero() {
+		return nil, fmt.Errorf("%w: acquired_at is required", ErrInvalidLot)
+	}
+	if lot.Cost != "" {
+		if cost, ok := new(big.Rat).SetString(lot.Cost); !ok || cost.Sign() < 0 {
+			return nil, fmt.Errorf("%w: %q is not a cost", ErrInvalidLot, lot.Cost)
+		}
+	}
+	lot.ID = newID()
+	lot.AcquiredAt = lot.AcquiredAt.UTC()
+	lot.CreatedAt = time.Now().UTC()
+
+	costLotsMu.Lock()
+	defer costLotsMu.Unlock()
+
+	lots, err := readCostLots()
+	if err != nil {
+		return nil, err
+	}
+	lots = append(lots, &lot)
+	if err := writeJSONFile(costLotsFile, lots); err != nil {
+		return nil, err
+	}
+
+	return &lot, nil
+}
+
+func DeleteCostLot(id string) error {
+	costLotsMu.Lock()
+	defer costLotsMu.Unlock()
+
+	lots, err := readCostLots()
+	if err != nil {
+		return err
+	}
+
+	kept := lots[:0]
+	for _, lot := range lots {
+		if lot.ID != id {
+			kept = append(kept, lot)
+		}
+	}
+	if len(kept) == len(lots) {
+		return ErrLotNotFound
+	}
+
+	return writeJSONFile(costLotsFile, kept)
+}
+
+// costEvent is an acquisition or a disposal, in the order they are
+// matched.
+type costEvent struct {
+	at       time.Time
+	lot      *openLot
+	disposal *Disposal
+	amount   *big.Int
+}
+
+type openLot struct {
+	id         string
+	acquiredAt time.Time
+	remaining  *big.Int
+	// costPerWei is the lot's cost spread evenly over its amount, so a
+	// part of it carries its share of the cost.
+	costPerWei *big.Rat
+}
+
+// GainsReportFor works out the realized gains on chainID's native currency
+// from the ledger and the recorded lots. Coins received from outside the
+// wallet are lots, costed at the price when they were mined; transfers out
+// of the wallet and the fees it paid are disposals. Transfers between the
+// wallet's own addresses move no lots, as the lots are pooled across them.
+// Every disposal since the first lot is matched, so that the lots left for
+// the period are right, but only those from since (if not zero) to until
+// are reported.
+func GainsReportFor(chainID uint64, method string, since, until time.Time) (*GainsReport, error) {
+	if method == "" {
+		method = DefaultCostBasisMethod()
+	}
+	if method != CostBasisFIFO && method != CostBasisLIFO {
+		return nil, fmt.Errorf("%w: %q (expected fifo or lifo)", ErrInvalidCostBasis, method)
+	}
+	if until.IsZero() {
+		until = time.Now().UTC()
+	}
+
+	entries, err := ListLedgerEntries(chainID, "")
+	if err != nil {
+		return nil, err
+	}
+	lots, err := ListCostLots(chainID)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := ListFiatPrices(chainID)
+	if err != nil {
+		return nil, err
+	}
+	priceAt := func(at time.Time) (*big.Rat, error) {
+		i := sort.Search(len(prices), func(i int) bool { return prices[i].At.After(at) })
+		if i == 0 {
+			return nil, fmt.Errorf("%w for chain %d at or before %s", ErrNoFiatPrice, chainID, at.Format(time.RFC3339))
+		}
+		price, _ := new(big.Rat).SetString(prices[i-1].Price)
+		return price, nil
+	}
+	weiPerCoin := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+	valueOf := func(amount *big.Int, at time.Time) (*big.Rat, error) {
+		price, err := priceAt(at)
+		if err != nil {
+			return nil, err
+		}
+		value := new(big.Rat).Mul(new(big.Rat).SetInt(amount), price)
+		return value.Quo(value, weiPerCoin), nil
+	}
+
+	var events []costEvent
+	for _, lot := range lots {
+		if lot.AcquiredAt.After(until) {
+			continue
+		}
+		amount, _ := new(big.Int).SetString(lot.Amount, 10)
+		cost, ok := new(big.Rat).SetString(lot.Cost)
+		if !ok {
+			if cost, err = valueOf(amount, lot.AcquiredAt); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, costEvent{at: lot.AcquiredAt, amount: amount, lot: &openLot{
+			id:         lot.ID,
+			acquiredAt: lot.AcquiredAt,
+			remaining:  amount,
+			costPerWei: new(big.Rat).Quo(cost, new(big.Rat).SetInt(amount)),
+		}})
+	}
+	for _, entry := range entries {
+		at := entry.BookedAt
+		if entry.MinedAt != nil {
+			at = *entry.MinedAt
+		}
+		if at.After(until) {
+			continue
+		}
+		value, _ := new(big.Int).SetString(entry.Value, 10)
+		fee, _ := new(big.Int).SetString(entry.Fee, 10)
+
+		switch entry.Direction {
+		case DirectionIncoming:
+			if value == nil || value.Sign() == 0 {
+				continue
+			}
+			cost, err := valueOf(value, at)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, costEvent{at: at, amount: value, lot: &openLot{
+				id:         entry.ID,
+				acquiredAt: at,
+				remaining:  value,
+				costPerWei: new(big.Rat).Quo(cost, new(big.Rat).SetInt(value)),
+			}})
+		case DirectionOutgoing, DirectionInternal:
+			if entry.Direction == DirectionOutgoing && value != nil && value.Sign() > 0 {
+				events = append(events, costEvent{at: at, amount: value, disposal: &Disposal{EntryID: entry.ID, Kind: DisposalTransfer, DisposedAt: at}})
+			}
+			if fee != nil && fee.Sign() > 0 {
+				events = append(events, costEvent{at: at, amount: fee, disposal: &Disposal{EntryID: entry.ID, Kind: DisposalFee, DisposedAt: at}})
+			}
+		}
+	}
+	// Acquisitions go before disposals made at the same moment.
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].at.Equal(events[j].at) {
+			return events[i].at.Before(events[j].at)
+		}
+		return events[i].lot != nil && events[j].lot == nil
+	})
+
+	report := &GainsReport{
+		ChainID:   chainID,
+		Method:    method,
+		Currency:  FiatCurrency(),
+		Until:     until,
+		Disposals: []*Disposal{},
+		OpenLots:  []*OpenLot{},
+	}
+	if !since.IsZero() {
+		report.Since = &since
+	}
+	totalProceeds, totalCost := new(big.Rat), new(big.Rat)
+	shortTerm, longTerm := new(big.Rat), new(big.Rat)
+
+	var open []*openLot
+	for _, event := range events {
+		if event.lot != nil {
+			open = append(open, event.lot)
+			continue
+		}
+
+		disposal := event.disposal
+		proceeds, err := valueOf(event.amount, event.at)
+		if err != nil {
+			return nil, err
+		}
+		proceedsPerWei := new(big.Rat).Quo(proceeds, new(big.Rat).SetInt(event.amount))
+		cost := new(big.Rat)
+		disposal.Lots = []*LotMatch{}
+
+		needed := new(big.Int).Set(event.amount)
+		for needed.Sign() > 0 && len(open) > 0 {
+			i := 0
+			if method == CostBasisLIFO {
+				i = len(open) - 1
+			}
+			lot := open[i]
+			used := new(big.Int).Set(needed)
+			if lot.remaining.Cmp(used) < 0 {
+				used.Set(lot.remaining)
+			}
+			lot.remaining = new(big.Int).Sub(lot.remaining, used)
+			needed.Sub(needed, used)
+			if lot.remaining.Sign() == 0 {
+				open = append(open[:i], open[i+1:]...)
+			}
+
+			usedRat := new(big.Rat).SetInt(used)
+			matchCost := new(big.Rat).Mul(usedRat, lot.costPerWei)
+			matchProceeds := new(big.Rat).Mul(usedRat, proceedsPerWei)
+			matchGain := new(big.Rat).Sub(matchProceeds, matchCost)
+			isLongTerm := event.at.Sub(lot.acquiredAt) > longTermHolding
+			cost.Add(cost, matchCost)
+			disposal.Lots = append(disposal.Lots, &LotMatch{
+				LotID:      lot.id,
+				AcquiredAt: lot.acquiredAt,
+				Amount:     used.String(),
+				CostBasis:  matchCost.FloatString(2),
+				Proceeds:   matchProceeds.FloatString(2),
+				Gain:       matchGain.FloatString(2),
+				LongTerm:   isLongTerm,
+			})
+			if !since.IsZero() && event.at.Before(since) {
+				continue
+			}
+			if isLongTerm {
+				longTerm.Add(longTerm, matchGain)
+			} else {
+				shortTerm.Add(shortTerm, matchGain)
+			}
+		}
+
+		// Coins no lot covers have no known cost, so all they fetched is
+		// gain, and short-term as nothing shows how long they were held.
+		if needed.Sign() > 0 {
+			disposal.Unmatched = needed.String()
+			if since.IsZero() || !event.at.Before(since) {
+				shortTerm.Add(shortTerm, new(big.Rat).Mul(new(big.Rat).SetInt(needed), proceedsPerWei))
+			}
+		}
+
+		if !since.IsZero() && event.at.Before(since) {
+			continue
+		}
+		disposal.Amount = event.amount.String()
+		disposal.Proceeds = proceeds.FloatString(2)
+		disposal.CostBasis = cost.FloatString(2)
+		disposal.Gain = new(big.Rat).Sub(proceeds, cost).FloatString(2)
+		totalProceeds.Add(totalProceeds, proceeds)
+		totalCost.Add(totalCost, cost)
+		report.Disposals = append(report.Disposals, disposal)
+	}
+
+	report.Proceeds = totalProceeds.FloatString(2)
+	report.CostBasis = totalCost.FloatString(2)
+	report.Gain = new(big.Rat).Sub(totalProceeds, totalCost).FloatString(2)
+	report.ShortTermGain = shortTerm.FloatString(2)
+	report.LongTermGain = longTerm.FloatString(2)
+	for _, lot := range open {
+		report.OpenLots = append(report.OpenLots, &OpenLot{
+			LotID:      lot.id,
+			AcquiredAt: lot.acquiredAt,
+			Amount:     lot.remaining.String(),
+			CostBasis:  new(big.Rat).Mul(new(big.Rat).SetInt(lot.remaining), lot.costPerWei).FloatString(2),
+		})
+	}
+
+	return report, nil
+}
+
+func priceKey(chainID uint64, at time.Time) string {
+	return fmt.Sprintf("%d/%d", chainID, at.UnixNano())
+}
+
+func sortFiatPrices(prices []*FiatPrice) {
+	sort.Slice(prices, func(i, j int) bool {
+		if prices[i].ChainID != prices[j].ChainID {
+			return prices[i].ChainID < prices[j].ChainID
+		}
+		return prices[i].At.Before(prices[j].At)
+	})
+}
+
+func readFiatPrices() ([]*FiatPrice, error) {
+	var prices []*FiatPrice
+	if err := readJSONFile(pricesFile, &prices); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+func readCostLots() ([]*CostLot, error) {
+	var lots []*CostLot
+	if err := readJSONFile(costLotsFile, &lots); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return lots, nil
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/holiman/uint256"
+)
+
+// EIP-7702 lets an account set its code to a delegation to a contract, so
+// that calls to it run the contract's code against the account's own
+// storage and balance, until it delegates elsewhere or to the zero address.
+// The contract can then do anything the account's key could, which is why
+// only contracts listed in the policy's allowed_delegates are accepted.
+
+// Delegation is an account's current EIP-7702 delegation on a chain.
+type Delegation struct {
+	Address   string `json:"address"`
+	ChainID   uint64 `json:"chain_id"`
+	Delegated bool   `json:"delegated"`
+	Delegate  string `json:"delegate,omitempty"`
+}
+
+// DelegationRequest sets the selected account's code to delegate to
+// Delegate, the zero address to clear it. Data, if any, is then called on
+// the account itself, running the delegate's code in the same transaction.
+type DelegationRequest struct {
+	Delegate string
+	Value    *big.Int
+	Data     []byte
+}
+
+// GetDelegation reports whether an account delegates its code, and to what.
+func GetDelegation(chain *Chain, address string) (*Delegation, error) {
+	if !common.IsHexAddress(address) {
+		return nil, errors.New("invalid address")
+	}
+	account := common.HexToAddress(address)
+
+	// Read past the cache, which would report a delegation set moments ago
+	// as missing.
+	code, err := chain.client.Client.CodeAt(context.Background(), account, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	delegation := &Delegation{Address: account.Hex(), ChainID: chain.ID.Uint64()}
+	if delegate, ok := types.ParseDelegation(code); ok {
+		delegation.Delegated = true
+		delegation.Delegate = delegate.Hex()
+	}
+
+	return delegation, nil
+}
+
+// SignDelegationAuthorization signs an authorization for the selected
+// account to delegate to delegate on chain, for another account to include
+// in its set-code transaction and pay for. nonce is the account's nonce
+// when that transaction runs, its next nonce if nil.
+func SignDelegationAuthorization(chain *Chain, delegate string, nonce *uint64) (*types.SetCodeAuthorization, error) {
+	signer, err := loadSigner()
+	if err != nil {
+		return nil, err
+	}
+	authority := signer.Address()
+
+	target, err := allowedDelegate(chain, delegate)
+	if err != nil {
+		return nil, err
+	}
+
+	if nonce == nil {
+		next, err := chain.client.PendingNonceAt(context.Background(), authority)
+		if err != nil {
+			return nil, err
+		}
+		nonce = &next
+	}
+
+	auth, err := delegationAuthorization(chain, signer, target, *nonce)
+	if err != nil {
+		return nil, err
+	}
+	recordSignature(authority)
+
+	recordAudit("delegation.authorized", fmt.Sprintf("%s authorized delegation to %s", authority.Hex(), target.Hex()),
+		map[string]interface{}{"address": authority.Hex(), "delegate": target.Hex(), "nonce": *nonce, "chain_id": chain.ID.Uint64()})
+	return &auth, nil
+}
+
+// SetDelegation sends a set-code transaction from the selected account that
+// delegates its own code, paying for it itself.
+func SetDelegation(chain *Chain, request DelegationRequest) (string, error) {
+	signer, err := loadSigner()
+	if err != nil {
+		return "", err
+	}
+	from := signer.Address()
+
+	target, err := allowedDelegate(chain, request.Delegate)
+	if err != nil {
+		return "", err
+	}
+	value := request.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+
+	// The authorization is checked after the sender's nonce is incremented
+	// for the transaction itself, so it must carry the nonce after it. It is
+	// included in the estimate too, for Data to run against the delegate.
+	next, err := chain.client.PendingNonceAt(context.Background(), from)
+	if err != nil {
+		return "", err
+	}
+	estimateAuth, err := delegationAuthorization(chain, signer, target, next+1)
+	if err != nil {
+		return "", err
+	}
+	gasLimit, err := chain.client.EstimateGas(context.Background(), ethereum.CallMsg{
+		From:              from,
+		To:                &from,
+		Value:             value,
+		Data:              request.Data,
+		AuthorizationList: []types.SetCodeAuthorization{estimateAuth},
+	})
+	if err != nil {
+		return "", err
+	}
+	gasPrice, err := chain.currentGasPrice(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	txHash, err := sendBuiltTransaction(chain, signer, from, value, gasLimit, gasPrice, nil, func(nonce uint64) (types.TxData, error) {
+		auth, err := delegationAuthorization(chain, signer, target, nonce+1)
+		if err != nil {
+			return nil, err
+		}
+
+		return &types.SetCodeTx{
+			ChainID:   uint256.MustFromBig(chain.ID),
+			Nonce:     nonce,
+			GasTipCap: uint256.MustFromBig(gasPrice),
+			GasFeeCap: uint256.MustFromBig(gasPrice),
+			Gas:       gasLimit,
+			To:        from,
+			Value:     uint256.MustFromBig(value),
+			Data:      request.Data,
+			AuthList:  []types.SetCodeAuthorization{auth},
+		}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	message := fmt.Sprintf("%s delegated its code to %s", from.Hex(), target.Hex())
+	if target == (common.Address{}) {
+		message = fmt.Sprintf("%s cleared its code delegation", from.Hex())
+	}
+	recordAudit("delegation.set", message,
+		map[string]interface{}{"address": from.Hex(), "delegate": target.Hex(), "tx_hash": txHash, "chain_id": chain.ID.Uint64()})
+	return txHash, nil
+}
+
+func delegationAuthorization(chain *Chain, signer Signer, target common.Address, nonce uint64) (types.SetCodeAuthorization, error) {
+	auth := types.SetCodeAuthorization{
+		ChainID: *uint256.MustFromBig(chain.ID),
+		Address: target,
+		Nonce:   nonce,
+	}
+	// The hash signed is that of types.SignSetCode, which only takes a key.
+	encoded, err := rlp.EncodeToBytes([]interface{}{&auth.ChainID, auth.Address, auth.Nonce})
+	if err != nil {
+		return types.SetCodeAuthorization{}, err
+	}
+	signature, err := signer.SignHash(crypto.Keccak256(append([]byte{0x05}, encoded...)))
+	if err != nil {
+		return types.SetCodeAuthorization{}, err
+	}
+	auth.R.SetBytes(signature[:32])
+	auth.S.SetBytes(signature[32:64])
+	auth.V = signature[64]
+
+	return auth, nil
+}
+
+// allowedDelegate checks a delegate against the policy. Clearing a
+// delegation, with the zero address, is always allowed.
+func allowedDelegate(chain *Chain, delegate string) (common.Address, error) {
+	if !common.IsHexAddress(delegate) {
+		return common.Address{}, errors.New("invalid delegate address")
+	}
+	target := common.HexToAddress(delegate)
+	if target == (common.Address{}) {
+		return target, nil
+	}
+
+	policy, err := GetPolicy()
+	if err != nil {
+		return common.Address{}, err
+	}
+	allowed := false
+	for _, candidate := range policy.AllowedDelegates {
+		if strings.EqualFold(candidate, target.Hex()) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return common.Address{}, fmt.Errorf("%w: delegate %s is not in allowed_delegates", ErrPolicyViolation, target.Hex())
+	}
+
+	contract, err := isContract(context.Background(), chain, target)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if !contract {
+		return common.Address{}, fmt.Errorf("no contract at delegate %s on chain %s", target.Hex(), chain.ID)
+	}
+
+	return target, nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var ErrInvalidDeployment = errors.New("invalid deployment")
+
+// Deployment is a contract-creation transaction sent by the wallet.
+// ContractAddress is where the contract lands once it is mined, which
+// follows from the sender and nonce alone.
+type Deployment struct {
+	TransactionHash string `json:"transaction_hash"`
+	ContractAddress string `json:"contract_address"`
+	ChainID         uint64 `json:"chain_id"`
+	From            string `json:"from"`
+	Nonce           uint64 `json:"nonce"`
+	EstimatedGas    uint64 `json:"estimated_gas"`
+	GasLimit        uint64 `json:"gas_limit"`
+	GasPrice        string `json:"gas_price"`
+}
+
+// DeployContract deploys bytecode from an account, the selected one if
+// empty. args are the constructor's arguments as JSON, encoded against the
+// constructor in contractABI; without an ABI there can be none.
+func DeployContract(chain *Chain, account string, bytecode []byte, contractABI json.RawMessage, args []json.RawMessage, value *big.Int) (*Deployment, error) {
+	ctx := context.Background()
+
+	if len(bytecode) == 0 {
+		return nil, fmt.Errorf("%w: bytecode is required", ErrInvalidDeployment)
+	}
+	data := append([]byte{}, bytecode...)
+	payable := true
+	if len(contractABI) > 0 {
+		parsed, err := abi.JSON(strings.NewReader(string(contractABI)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: abi: %v", ErrInvalidDeployment, err)
+		}
+		values, err := packJSONArgs(parsed.Constructor.Inputs, args)
+		if err != nil {
+			return nil, fmt.Errorf("%w: constructor %v", ErrInvalidDeployment, err)
+		}
+		encoded, err := parsed.Pack("", values...)
+		if err != nil {
+			return nil, fmt.Errorf("%w: constructor: %v", ErrInvalidDeployment, err)
+		}
+		data = append(data, encoded...)
+		payable = parsed.Constructor.IsPayable()
+	} else if len(args) > 0 {
+		return nil, fmt.Errorf("%w: constructor arguments need the contract's abi", ErrInvalidDeployment)
+	}
+	if value.Sign() > 0 && !payable {
+		return nil, fmt.Errorf("%w: the constructor is not payable", ErrInvalidDeployment)
+	}
+
+	signer, err := loadSignerFor(account)
+	if err != nil {
+		return nil, err
+	}
+	from := signer.Address()
+
+	if err := checkFunds(ctx, chain, from, value, 0, nil); err != nil {
+		return nil, err
+	}
+	estimated, err := chain.client.EstimateGas(ctx, ethereum.CallMsg{From: from, Value: value, Data: data})
+	if err != nil {
+		if isConnectivityError(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrGasEstimation, err)
+	}
+	gasLimit := estimated + estimated*gasLimitMargin()/100
+	gasPrice, err := chain.currentGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A creation has no recipient; policy and the journal see the zero
+	// address.
+	if err := enforcePolicy(ctx, chain, from, common.Address{}, value); err != nil {
+		return nil, err
+	}
+	if err := checkFunds(ctx, chain, from, value, gasLimit, gasPrice); err != nil {
+		return nil, err
+	}
+
+	entry, err := reserveNonce(ctx, chain, from, common.Address{}, value, nil)
+	if err != nil {
+		return nil, err
+	}
+	signedTx, status, err := signAndBroadcast(chain, signer, entry, func(nonce uint64) (types.TxData, error) {
+		return &types.LegacyTx{Nonce: nonce, Value: value, Gas: gasLimit, GasPrice: gasPrice, Data: data}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	recordSend(from, value)
+
+	contract := crypto.CreateAddress(from, signedTx.Nonce()).Hex()
+	txHash := signedTx.Hash().Hex()
+	err = recordTransaction(signedBy(TransactionRecord{
+		Hash:            txHash,
+		ChainID:         chain.ID.Uint64(),
+		From:            from.Hex(),
+		To:              contract,
+		Value:           value.String(),
+		ContractAddress: contract,
+		Status:          status,
+		CreatedAt:       time.Now().UTC(),
+	}, signedTx))
+	if err != nil {
+		log.Printf("failed to record transaction %s: %v", txHash, err)
+	}
+
+	return &Deployment{
+		TransactionHash: txHash,
+		ContractAddress: contract,
+		ChainID:         chain.ID.Uint64(),
+		From:            from.Hex(),
+		Nonce:           signedTx.Nonce(),
+		EstimatedGas:    estimated,
+		GasLimit:        gasLimit,
+		GasPrice:        gasPrice.String(),
+	}, nil
+}
@@ -0,0 +1,430 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+const (
+	AuthorizationTransfer = "transfer"
+	AuthorizationReceive  = "receive"
+
+	defaultAuthorizationValidity = time.Hour
+	maxAuthorizationValidity     = 30 * 24 * time.Hour
+
+	// An authorization this close to expiry is not relayed, since the
+	// transaction would likely be mined after validBefore and revert.
+	authorizationExpiryMargin = 30 * time.Second
+)
+
+const eip3009ABIJSON = `[
+	{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"version","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"DOMAIN_SEPARATOR","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+	{"type":"function","name":"authorizationState","stateMutability":"view","inputs":[{"name":"authorizer","type":"address"},{"name":"nonce","type":"bytes32"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"transferWithAuthorization","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"validAfter","type":"uint256"},{"name":"validBefore","type":"uint256"},{"name":"nonce","type":"bytes32"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}],"outputs":[]},
+	{"type":"function","name":"receiveWithAuthorization","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"validAfter","type":"uint256"},{"name":"validBefore","type":"uint256"},{"name":"nonce","type":"bytes32"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}],"outputs":[]}
+]`
+
+var eip3009ABI = mustParseABI(eip3009ABIJSON)
+
+var (
+	ErrAuthorizationUsed        = errors.New("authorization nonce has already been used")
+	ErrAuthorizationExpired     = errors.New("authorization has expired")
+	ErrAuthorizationNotYetValid = errors.New("authorization is not valid yet")
+	ErrAuthorizationSignature   = errors.New("authorization signature does not match its signer")
+)
+
+// TransferAuthorization is a signed EIP-3009 authorization (as implemented
+// by USDC). Anyone holding it can submit it; a receive authorization can
+// only be submitted by its recipient, which protects against front-running.
+type TransferAuthorization struct {
+	Kind        string `json:"kind"`
+	ChainID     uint64 `json:"chain_id"`
+	Token       string `json:"token"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Value       string `json:"value"`
+	ValidAfter  int64  `json:"valid_after"`
+	ValidBefore int64  `json:"valid_before"`
+	Nonce       string `json:"nonce"`
+
+	// Version is the token's EIP-712 domain version.
+	Version   string `json:"version"`
+	V         uint8  `json:"v"`
+	R         string `json:"r"`
+	S         string `json:"s"`
+	Signature string `json:"signature"`
+
+	TypedData *apitypes.TypedData `json:"typed_data,omitempty"`
+}
+
+// AuthorizationRequest describes an authorization to sign for the selected
+// account. ValidBefore defaults to an hour from now; Version defaults to the
+// token's version().
+type AuthorizationRequest struct {
+	Kind        string
+	Token       string
+	To          string
+	Value       *big.Int
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	Version     string
+}
+
+// SignTransferAuthorization signs an EIP-3009 authorization with a random
+// nonce. The token's EIP-712 domain is read from the contract and, when it
+// exposes DOMAIN_SEPARATOR, checked against it so a wrong name or version is
+// caught here rather than by a failed relay.
+func SignTransferAuthorization(chain *Chain, request AuthorizationRequest) (*TransferAuthorization, error) {
+	if request.Kind == "" {
+		request.Kind = AuthorizationTransfer
+	}
+	if request.Kind != AuthorizationTransfer && request.Kind != AuthorizationReceive {
+		return nil, fmt.Errorf("unknown authorization kind %q", request.Kind)
+	}
+	if !common.IsHexAddress(request.Token) {
+		return nil, ErrInvalidTokenAddress
+	}
+	if !common.IsHexAddress(request.To) {
+		return nil, errors.New("invalid recipient address")
+	}
+	if request.Value == nil || request.Value.Sign() <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+
+	now := time.Now()
+	if request.ValidBefore.IsZero() {
+		request.ValidBefore = now.Add(defaultAuthorizationValidity)
+	}
+	if !request.ValidBefore.After(now.Add(authorizationExpiryMargin)) {
+		return nil, errors.New("valid_before must be in the future")
+	}
+	if request.ValidBefore.Sub(now) > maxAuthorizationValidity {
+		return nil, fmt.Errorf("authorizations may be valid for at most %s", maxAuthorizationValidity)
+	}
+	if !request.ValidAfter.IsZero() && !request.ValidAfter.Before(request.ValidBefore) {
+		return nil, errors.New("valid_after must be before valid_before")
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	token := common.HexToAddress(request.Token)
+	from := signer.Address()
+
+	version, err := authorizationDomainVersion(chain, token, request.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomAuthorizationNonce(chain, token, from)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &TransferAuthorization{
+		Kind:        request.Kind,
+		ChainID:     chain.ID.Uint64(),
+		Token:       token.Hex(),
+		From:        from.Hex(),
+		To:          common.HexToAddress(request.To).Hex(),
+		Value:       request.Value.String(),
+		ValidBefore: request.ValidBefore.Unix(),
+		Nonce:       hexutil.Encode(nonce[:]),
+		Version:     version,
+	}
+	if !request.ValidAfter.IsZero() {
+		auth.ValidAfter = request.ValidAfter.Unix()
+	}
+
+	typedData, err := auth.typedData(chain)
+	if err != nil {
+		return nil, err
+	}
+	hash, _, err := apitypes.TypedDataAndHash(*typedData)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := signer.SignHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	recordSignature(from)
+
+	auth.R = hexutil.Encode(signature[:32])
+	auth.S = hexutil.Encode(signature[32:64])
+	auth.V = signature[64] + 27
+	signature[64] += 27
+	auth.Signature = hexutil.Encode(signature)
+	auth.TypedData = typedData
+
+	return auth, nil
+}
+
+// SubmitTransferAuthorization relays an authorization from the selected
+// account, which pays the gas. Expiry, nonce state and the signature are
+// checked first so a doomed relay is never broadcast.
+func SubmitTransferAuthorization(chain *Chain, auth TransferAuthorization) (string, error) {
+	if auth.ChainID != 0 && auth.ChainID != chain.ID.Uint64() {
+		return "", fmt.Errorf("authorization is for chain %d, not %s", auth.ChainID, chain.ID)
+	}
+	if !common.IsHexAddress(auth.Token) || !common.IsHexAddress(auth.From) || !common.IsHexAddress(auth.To) {
+		return "", errors.New("invalid token, from or to address")
+	}
+
+	method := "transferWithAuthorization"
+	switch auth.Kind {
+	case "", AuthorizationTransfer:
+	case AuthorizationReceive:
+		method = "receiveWithAuthorization"
+	default:
+		return "", fmt.Errorf("unknown authorization kind %q", auth.Kind)
+	}
+
+	now := time.Now()
+	if now.Unix() <= auth.ValidAfter {
+		return "", ErrAuthorizationNotYetValid
+	}
+	if !time.Unix(auth.ValidBefore, 0).After(now.Add(authorizationExpiryMargin)) {
+		return "", ErrAuthorizationExpired
+	}
+
+	value, ok := new(big.Int).SetString(auth.Value, 10)
+	if !ok || value.Sign() <= 0 {
+		return "", errors.New("invalid authorization value")
+	}
+	nonce, err := hexutil.Decode(auth.Nonce)
+	if err != nil || len(nonce) != 32 {
+		return "", errors.New("authorization nonce must be 32 bytes")
+	}
+	r, errR := hexutil.Decode(auth.R)
+	s, errS := hexutil.Decode(auth.S)
+	if errR != nil || errS != nil || len(r) != 32 || len(s) != 32 || (auth.V != 27 && auth.V != 28) {
+		return "", errors.New("invalid authorization signature")
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		return "", err
+	}
+	relayer := signer.Address()
+
+	token := common.HexToAddress(auth.Token)
+	from := common.HexToAddress(auth.From)
+	to := common.HexToAddress(auth.To)
+	if auth.Kind == AuthorizationReceive && relayer != to {
+		return "", errors.New("a receive authorization can only be submitted by its recipient")
+	}
+
+	if auth.Version == "" {
+		if auth.Version, err = authorizationDomainVersion(chain, token, ""); err != nil {
+			return "", err
+		}
+	}
+	typedData, err := auth.typedData(chain)
+	if err != nil {
+		return "", err
+	}
+	hash, _, err := apitypes.TypedDataAndHash(*typedData)
+	if err != nil {
+		return "", err
+	}
+	signature := append(append(append([]byte{}, r...), s...), auth.V-27)
+	publicKey, err := crypto.SigToPub(hash, signature)
+	if err != nil || crypto.PubkeyToAddress(*publicKey) != from {
+		return "", ErrAuthorizationSignature
+	}
+
+	used, err := authorizationUsed(chain, token, from, [32]byte(nonce))
+	if err != nil {
+		return "", err
+	}
+	if used {
+		return "", ErrAuthorizationUsed
+	}
+
+	data, err := eip3009ABI.Pack(method, from, to, value,
+		big.NewInt(auth.ValidAfter), big.NewInt(auth.ValidBefore),
+		[32]byte(nonce), auth.V, [32]byte(r), [32]byte(s))
+	if err != nil {
+		return "", err
+	}
+
+	return sendContractTransaction(chain, signer, token, big.NewInt(0), data)
+}
+
+// AuthorizationState reports whether authorizer has used (or cancelled) a
+// nonce on token.
+func AuthorizationState(chain *Chain, token, authorizer, nonce string) (bool, error) {
+	if !common.IsHexAddress(token) {
+		return false, ErrInvalidTokenAddress
+	}
+	if !common.IsHexAddress(authorizer) {
+		return false, errors.New("invalid authorizer address")
+	}
+	raw, err := hexutil.Decode(nonce)
+	if err != nil || len(raw) != 32 {
+		return false, errors.New("authorization nonce must be 32 bytes")
+	}
+
+	return authorizationUsed(chain, common.HexToAddress(token), common.HexToAddress(authorizer), [32]byte(raw))
+}
+
+func (a *TransferAuthorization) typedData(chain *Chain) (*apitypes.TypedData, error) {
+	primaryType := "TransferWithAuthorization"
+	if a.Kind == AuthorizationReceive {
+		primaryType = "ReceiveWithAuthorization"
+	}
+
+	name, err := tokenString(chain, common.HexToAddress(a.Token), "name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token name: %w", err)
+	}
+
+	return &apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			primaryType: {
+				{Name: "from", Type: "address"},
+				{Name: "to", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "validAfter", Type: "uint256"},
+				{Name: "validBefore", Type: "uint256"},
+				{Name: "nonce", Type: "bytes32"},
+			},
+		},
+		PrimaryType: primaryType,
+		Domain: apitypes.TypedDataDomain{
+			Name:              name,
+			Version:           a.Version,
+			ChainId:           (*math.HexOrDecimal256)(new(big.Int).Set(chain.ID)),
+			VerifyingContract: a.Token,
+		},
+		Message: apitypes.TypedDataMessage{
+			"from":        a.From,
+			"to":          a.To,
+			"value":       a.Value,
+			"validAfter":  fmt.Sprint(a.ValidAfter),
+			"validBefore": fmt.Sprint(a.ValidBefore),
+			"nonce":       a.Nonce,
+		},
+	}, nil
+}
+
+// authorizationDomainVersion returns the EIP-712 version to sign with and
+// verifies it against the token's DOMAIN_SEPARATOR when one is exposed.
+func authorizationDomainVersion(chain *Chain, token common.Address, version string) (string, error) {
+	if version == "" {
+		var err error
+		if version, err = tokenString(chain, token, "version"); err != nil {
+			return "", errors.New("token has no version(); pass its EIP-712 version explicitly")
+		}
+	}
+
+	out, err := callContract(chain, token, eip3009ABI, "DOMAIN_SEPARATOR")
+	if err != nil {
+		return version, nil
+	}
+	expected, ok := out[0].([32]byte)
+	if !ok {
+		return version, nil
+	}
+
+	name, err := tokenString(chain, token, "name")
+	if err != nil {
+		return "", fmt.Errorf("failed to read token name: %w", err)
+	}
+	probe := apitypes.TypedData{
+		Types: apitypes.Types{"EIP712Domain": {
+			{Name: "name", Type: "string"},
+			{Name: "version", Type: "string"},
+			{Name: "chainId", Type: "uint256"},
+			{Name: "verifyingContract", Type: "address"},
+		}},
+		Domain: apitypes.TypedDataDomain{
+			Name:              name,
+			Version:           version,
+			ChainId:           (*math.HexOrDecimal256)(new(big.Int).Set(chain.ID)),
+			VerifyingContract: token.Hex(),
+		},
+	}
+	separator, err := probe.HashStruct("EIP712Domain", probe.Domain.Map())
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(separator, expected[:]) {
+		return "", fmt.Errorf("EIP-712 domain (name %q, version %q) does not match the token's DOMAIN_SEPARATOR", name, version)
+	}
+
+	return version, nil
+}
+
+// randomAuthorizationNonce draws a random 32-byte nonce, redrawing in the
+// (practically impossible) case that it has already been used.
+func randomAuthorizationNonce(chain *Chain, token, authorizer common.Address) ([32]byte, error) {
+	for {
+		var nonce [32]byte
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return nonce, err
+		}
+
+		used, err := authorizationUsed(chain, token, authorizer, nonce)
+		if err != nil {
+			return nonce, err
+		}
+		if !used {
+			return nonce, nil
+		}
+	}
+}
+
+func authorizationUsed(chain *Chain, token, authorizer common.Address, nonce [32]byte) (bool, error) {
+	out, err := callContract(chain, token, eip3009ABI, "authorizationState", authorizer, nonce)
+	if err != nil {
+		if strings.Contains(err.Error(), "execution reverted") {
+			return false, errors.New("token does not support EIP-3009 authorizations")
+		}
+		return false, err
+	}
+
+	used, ok := out[0].(bool)
+	if !ok {
+		return false, errors.New("unexpected authorizationState result")
+	}
+
+	return used, nil
+}
+
+func tokenString(chain *Chain, token common.Address, method string) (string, error) {
+	out, err := callContract(chain, token, eip3009ABI, method)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := out[0].(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected %s result", method)
+	}
+
+	return value, nil
+}
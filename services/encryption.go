@@ -0,0 +1,350 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jabbala-dev/go-wallet/utils"
+)
+
+// Key sources for at-rest encryption.
+const (
+	KeySourcePassphrase = "passphrase"
+	KeySourceKMS        = "kms"
+)
+
+// dataKeyFile holds the data encryption key, wrapped by the key-encryption
+// key, so the passphrase or KMS key can change without rewriting every file.
+// It is kept in plain JSON: without the key-encryption key it is useless.
+const dataKeyFile = "datakey.json"
+
+// encryptedMagic starts every encrypted data file. Files without it are read
+// as plain JSON, which is how existing data and operator-written config such
+// as RPC_CONFIG keep working.
+var encryptedMagic = []byte("GWENC1\n")
+
+type wrappedDataKey struct {
+	Source    string    `json:"source"`
+	KMSKey    string    `json:"kms_key,omitempty"`
+	Key       string    `json:"wrapped_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// dataCipher seals data files once InitDataEncryption has unlocked the data
+// key; nil means data is stored in the clear.
+var dataCipher cipher.AEAD
+
+var (
+	ErrDataLocked    = errors.New("data is encrypted at rest; set DATA_PASSPHRASE or DATA_KMS_URL to unlock it")
+	ErrDataKeyUnwrap = errors.New("failed to unlock the data key")
+)
+
+// InitDataEncryption turns on at-rest encryption of the wallet's data files
+// when DATA_PASSPHRASE or DATA_KMS_URL is set. The first time, a random data
+// key is created and wrapped; afterwards the existing key is unwrapped, which
+// fails on a wrong passphrase or KMS key. Data files still in plain JSON are
+// then rewritten encrypted, as are the identity and session keys and the
+// account keys and HD seeds still kept outside the keystore. It must run before any store is used.
+//
+// DATA_KMS_URL is the base of a Vault-compatible transit engine (for example
+// https://vault:8200/v1/transit), used with the key named by DATA_KMS_KEY and
+// the token in DATA_KMS_TOKEN.
+func InitDataEncryption() error {
+	passphrase := os.Getenv("DATA_PASSPHRASE")
+	kms := newKMSFromEnv()
+
+	var wrapped wrappedDataKey
+	err := readJSONFile(dataKeyFile, &wrapped)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	exists := err == nil
+
+	if passphrase == "" && kms == nil {
+		if exists {
+			return ErrDataLocked
+		}
+		return nil
+	}
+
+	var key []byte
+	if exists {
+		if key, err = unwrapDataKey(wrapped, passphrase, kms); err != nil {
+			return err
+		}
+	} else {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		if wrapped, err = wrapDataKey(key, passphrase, kms); err != nil {
+			return err
+		}
+		if err := writeJSONFile(dataKeyFile, wrapped); err != nil {
+			return err
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	if dataCipher, err = cipher.NewGCM(block); err != nil {
+		return err
+	}
+
+	return encryptDataFiles()
+}
+
+func wrapDataKey(key []byte, passphrase string, kms *transitKMS) (wrappedDataKey, error) {
+	wrapped := wrappedDataKey{CreatedAt: time.Now().UTC()}
+
+	// The KMS takes precedence so that a passphrase left in the environment
+	// does not silently win over it.
+	if kms != nil {
+		ciphertext, err := kms.encrypt(key)
+		if err != nil {
+			return wrapped, fmt.Errorf("failed to wrap the data key: %w", err)
+		}
+		wrapped.Source = KeySourceKMS
+		wrapped.KMSKey = kms.key
+		wrapped.Key = ciphertext
+		return wrapped, nil
+	}
+
+	sealed, err := utils.EncryptWithPassphrase(key, passphrase)
+	if err != nil {
+		return wrapped, err
+	}
+	wrapped.Source = KeySourcePassphrase
+	wrapped.Key = base64.StdEncoding.EncodeToString(sealed)
+	return wrapped, nil
+}
+
+func unwrapDataKey(wrapped wrappedDataKey, passphrase string, kms *transitKMS) ([]byte, error) {
+	switch wrapped.Source {
+	case KeySourceKMS:
+		if kms == nil {
+			return nil, fmt.Errorf("%w: the data key is wrapped by a KMS; set DATA_KMS_URL", ErrDataKeyUnwrap)
+		}
+		if wrapped.KMSKey != "" {
+			kms.key = wrapped.KMSKey
+		}
+		key, err := kms.decrypt(wrapped.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDataKeyUnwrap, err)
+		}
+		return key, nil
+
+	case KeySourcePassphrase:
+		if passphrase == "" {
+			return nil, fmt.Errorf("%w: the data key is wrapped by a passphrase; set DATA_PASSPHRASE", ErrDataKeyUnwrap)
+		}
+		sealed, err := base64.StdEncoding.DecodeString(wrapped.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDataKeyUnwrap, err)
+		}
+		key, err := utils.DecryptWithPassphrase(sealed, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("%w: wrong passphrase", ErrDataKeyUnwrap)
+		}
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown key source %q", ErrDataKeyUnwrap, wrapped.Source)
+}
+
+// sealData encrypts a data file's contents. The file's name is bound in as
+// additional data, so one encrypted file cannot be swapped for another.
+func sealData(path string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, dataCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(append([]byte{}, encryptedMagic...), nonce...)
+	return dataCipher.Seal(sealed, nonce, plaintext, []byte(filepath.Base(path))), nil
+}
+
+func openData(path string, data []byte) ([]byte, error) {
+	if dataCipher == nil {
+		return nil, ErrDataLocked
+	}
+
+	data = data[len(encryptedMagic):]
+	if len(data) < dataCipher.NonceSize() {
+		return nil, fmt.Errorf("%s: encrypted data is truncated", path)
+	}
+
+	plaintext, err := dataCipher.Open(nil, data[:dataCipher.NonceSize()], data[dataCipher.NonceSize():], []byte(filepath.Base(path)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to decrypt: %w", path, err)
+	}
+
+	return plaintext, nil
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// dataFiles are the files the wallet keeps its state in. A store's file
+// must be listed here to be sealed when encryption is turned on.
+func dataFiles() []string {
+	return []string{
+		accessFile, accountsFile, addressBookFile, alertsFile, apiKeysFile, auditFile,
+		bansFile, breakGlassFile, broadcastFile, ceremoniesFile, challengesFile,
+		contractsFile, costLotsFile, deliveriesFile, ensFile, ensRegistrationsFile,
+		exchangesFile, hardwareAccountsFile, hdAccountsFile, historyFile, ipfsPinsFile,
+		jobsFile, journalFile, keyRefsFile, ledgerFile, maintenanceFile, networkFile,
+		nftCollectionsFile, nftInventoryFile, outboxFile, payoutsFile, policyFile,
+		pricesFile, profilesFile, quotaUsageFile, recoveriesFile, retentionFile,
+		revokedTokensFile, safeTransactionsFile, scheduleFile, siemFile,
+		smartAccountsFile, statementsFile, usageFile, webhooksFile,
+	}
+}
+
+// encryptDataFiles rewrites data files still stored in plain JSON. Each file
+// is replaced atomically, so an interrupted run leaves every file readable.
+func encryptDataFiles() error {
+	for _, path := range dataFiles() {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if isEncrypted(data) {
+			continue
+		}
+
+		var v json.RawMessage
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := writeJSONFile(path, v); err != nil {
+			return err
+		}
+		log.Printf("encrypted %s at rest", path)
+	}
+
+	// Keystore files are encrypted under their passwords already; the
+	// plain-text keys and seeds sit next to them as .txt files.
+	keyFiles, err := filepath.Glob(filepath.Join(keysDir, "*.txt"))
+	if err != nil {
+		return err
+	}
+	keyFiles = append(keyFiles, identityKeyFile, sessionKeyFile)
+	for _, path := range keyFiles {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if isEncrypted(data) {
+			continue
+		}
+		if err := writeKeyFile(path, data); err != nil {
+			return err
+		}
+		log.Printf("encrypted %s at rest", path)
+	}
+
+	return nil
+}
+
+// transitKMS wraps keys with a Vault-compatible transit engine.
+type transitKMS struct {
+	url   string
+	key   string
+	token string
+}
+
+var kmsClient = &http.Client{Timeout: 10 * time.Second}
+
+func newKMSFromEnv() *transitKMS {
+	url := os.Getenv("DATA_KMS_URL")
+	if url == "" {
+		return nil
+	}
+
+	key := os.Getenv("DATA_KMS_KEY")
+	if key == "" {
+		key = "go-wallet"
+	}
+
+	return &transitKMS{url: strings.TrimSuffix(url, "/"), key: key, token: os.Getenv("DATA_KMS_TOKEN")}
+}
+
+func (k *transitKMS) encrypt(plaintext []byte) (string, error) {
+	var response struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	request := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}
+	if err := k.call("encrypt", request, &response); err != nil {
+		return "", err
+	}
+	if response.Data.Ciphertext == "" {
+		return "", errors.New("KMS returned no ciphertext")
+	}
+
+	return response.Data.Ciphertext, nil
+}
+
+func (k *transitKMS) decrypt(ciphertext string) ([]byte, error) {
+	var response struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := k.call("decrypt", map[string]string{"ciphertext": ciphertext}, &response); err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(response.Data.Plaintext)
+}
+
+func (k *transitKMS) call(operation string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, k.url+"/"+operation+"/"+k.key, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if k.token != "" {
+		req.Header.Set("X-Vault-Token", k.token)
+	}
+
+	resp, err := kmsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("KMS %s responded %s", operation, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// notDataFiles are the *File names that are not stores: the wrapped data
+// key, the key files sealed on their own, and a key store name.
+var notDataFiles = map[string]bool{
+	"dataKeyFile":     true,
+	"identityKeyFile": true,
+	"privateKeyFile":  true,
+	"sessionKeyFile":  true,
+	"KeyStoreFile":    true,
+}
+
+func TestDataFilesListsEveryStore(t *testing.T) {
+	packages, err := parser.ParseDir(token.NewFileSet(), ".", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed := map[string]bool{}
+	for _, path := range dataFiles() {
+		listed[path] = true
+	}
+
+	for _, file := range packages["services"].Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || (gen.Tok != token.CONST && gen.Tok != token.VAR) {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				value := spec.(*ast.ValueSpec)
+				for i, name := range value.Names {
+					if !strings.HasSuffix(name.Name, "File") || notDataFiles[name.Name] || i >= len(value.Values) {
+						continue
+					}
+					literal, ok := value.Values[i].(*ast.BasicLit)
+					if !ok || literal.Kind != token.STRING {
+						continue
+					}
+					path, _ := strconv.Unquote(literal.Value)
+					if !listed[path] {
+						t.Errorf("%s (%s) is not in dataFiles()", name.Name, path)
+					}
+				}
+			}
+		}
+	}
+}
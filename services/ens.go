@@ -0,0 +1,530 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ensRegistryAddress is the ENS registry on mainnet and the main testnets.
+const ensRegistryAddress = "0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e"
+
+const ensABIJSON = `[
+	{"type":"function","name":"resolver","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"owner","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"name","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"addr","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"text","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"},{"name":"key","type":"string"}],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"setName","stateMutability":"nonpayable","inputs":[{"name":"name","type":"string"}],"outputs":[{"name":"","type":"bytes32"}]}
+]`
+
+const avatarNFTABIJSON = `[
+	{"type":"function","name":"ownerOf","stateMutability":"view","inputs":[{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"tokenURI","stateMutability":"view","inputs":[{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"uri","stateMutability":"view","inputs":[{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"string"}]}
+]`
+
+var (
+	ensABI       = mustParseABI(ensABIJSON)
+	avatarNFTABI = mustParseABI(avatarNFTABIJSON)
+)
+
+// ENSProfile is an address's primary ENS name and avatar. Name is only set
+// when the reverse record is confirmed by the name resolving back to the
+// address. Avatar is the raw avatar text record and AvatarURL where it can
+// be fetched from, empty if it could not be resolved or, for an NFT avatar,
+// the address does not own the NFT.
+type ENSProfile struct {
+	Address    string    `json:"address"`
+	Name       string    `json:"name,omitempty"`
+	Avatar     string    `json:"avatar,omitempty"`
+	AvatarURL  string    `json:"avatar_url,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+var (
+	ensFile = "ens.json"
+	ensMu   sync.Mutex
+
+	ensCacheTTL = 24 * time.Hour
+
+	// ensPending holds addresses waiting for the background resolver.
+	ensPending = map[string]bool{}
+	ensWake    = make(chan struct{}, 1)
+
+	ensHTTPClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+var (
+	ErrENSUnavailable  = errors.New("ENS is not available")
+	ErrInvalidENSName  = errors.New("invalid ENS name")
+	ErrENSNameMismatch = errors.New("ENS name does not resolve to this account")
+)
+
+// StartENSResolver resolves names for addresses ENSNames did not have, in
+// the background, so listings never wait on the chain. Entries are reused for
+// ENS_CACHE_TTL (default 24h).
+//
+// ENS is read from the chain ENS_CHAIN_ID (default 1, mainnet), which must
+// be configured, through the registry at ENS_REGISTRY (default the standard
+// registry). Without either, nothing is resolved and listings carry no names.
+func StartENSResolver() {
+	if raw := os.Getenv("ENS_CACHE_TTL"); raw != "" {
+		if ttl, err := time.ParseDuration(raw); err == nil && ttl > 0 {
+			ensCacheTTL = ttl
+		}
+	}
+
+	go func() {
+		for range ensWake {
+			ensMu.Lock()
+			var addresses []string
+			for address := range ensPending {
+				addresses = append(addresses, address)
+			}
+			ensMu.Unlock()
+
+			for _, address := range addresses {
+				if _, err := ResolveENS(address, true); err != nil && !errors.Is(err, ErrENSUnavailable) {
+					log.Printf("ens: %s: %v", address, err)
+				}
+				ensMu.Lock()
+				delete(ensPending, address)
+				ensMu.Unlock()
+			}
+		}
+	}()
+}
+
+// ENSNames returns the cached profiles of the addresses that have a primary
+// name, keyed by checksummed address. Addresses not cached, or cached longer
+// than the TTL, are queued for the background resolver and show up on a
+// later call.
+func ENSNames(addresses []string) map[string]*ENSProfile {
+	ensMu.Lock()
+	defer ensMu.Unlock()
+
+	cache, err := readENSCache()
+	if err != nil {
+		log.Printf("ens: %v", err)
+		return map[string]*ENSProfile{}
+	}
+
+	names := map[string]*ENSProfile{}
+	queued := false
+	for _, address := range addresses {
+		if !common.IsHexAddress(address) {
+			continue
+		}
+		key := common.HexToAddress(address).Hex()
+
+		profile, ok := cache[key]
+		if !ok || time.Since(profile.ResolvedAt) > ensCacheTTL {
+			if !ensPending[key] {
+				ensPending[key] = true
+				queued = true
+			}
+		}
+		if ok && profile.Name != "" {
+			names[key] = profile
+		}
+	}
+
+	if queued {
+		select {
+		case ensWake <- struct{}{}:
+		default:
+		}
+	}
+
+	return names
+}
+
+// ResolveENS returns an address's profile, from the cache unless it is
+// stale or refresh is set. An address without a primary name gets a profile
+// with no Name, which is cached too.
+func ResolveENS(address string, refresh bool) (*ENSProfile, error) {
+	if !common.IsHexAddress(address) {
+		return nil, errors.New("invalid address")
+	}
+	addr := common.HexToAddress(address)
+
+	if !refresh {
+		ensMu.Lock()
+		cache, err := readENSCache()
+		ensMu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if profile, ok := cache[addr.Hex()]; ok && time.Since(profile.ResolvedAt) <= ensCacheTTL {
+			return profile, nil
+		}
+	}
+
+	chain, err := ensChain()
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &ENSProfile{Address: addr.Hex(), ResolvedAt: time.Now().UTC()}
+	name, err := reverseName(chain, addr)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		profile.Name = name
+		if profile.Avatar, err = ensText(chain, name, "avatar"); err != nil {
+			return nil, err
+		}
+		if profile.Avatar != "" {
+			avatarURL, err := resolveAvatar(chain, addr, profile.Avatar)
+			if err != nil {
+				log.Printf("ens: avatar of %s: %v", name, err)
+			}
+			profile.AvatarURL = avatarURL
+		}
+	}
+
+	ensMu.Lock()
+	defer ensMu.Unlock()
+
+	cache, err := readENSCache()
+	if err != nil {
+		return nil, err
+	}
+	cache[profile.Address] = profile
+	if err := writeJSONFile(ensFile, cache); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// SetPrimaryENSName sets name as the primary name of the selected account
+// by calling setName on the reverse registrar. The name must already
+// resolve to the account, or the primary name would not be shown anywhere.
+func SetPrimaryENSName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if err := validateENSName(name); err != nil {
+		return "", err
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		return "", err
+	}
+	from := signer.Address()
+
+	chain, err := ensChain()
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := ensAddr(chain, name)
+	if err != nil {
+		return "", err
+	}
+	if resolved != from {
+		return "", fmt.Errorf("%w: %s resolves to %s", ErrENSNameMismatch, name, resolved.Hex())
+	}
+
+	out, err := callContract(chain, ensRegistry(), ensABI, "owner", namehash("addr.reverse"))
+	if err != nil {
+		return "", err
+	}
+	registrar := out[0].(common.Address)
+	if registrar == (common.Address{}) {
+		return "", errors.New("no reverse registrar is set for addr.reverse")
+	}
+
+	data, err := ensABI.Pack("setName", name)
+	if err != nil {
+		return "", err
+	}
+	txHash, err := sendContractTransaction(chain, signer, registrar, big.NewInt(0), data)
+	if err != nil {
+		return "", err
+	}
+
+	forgetENSProfile(from)
+
+	recordAudit("ens.primary_name_set", fmt.Sprintf("primary ENS name of %s set to %s", from.Hex(), name),
+		map[string]interface{}{"account": from.Hex(), "name": name, "tx_hash": txHash})
+	return txHash, nil
+}
+
+func ensChain() (*Chain, error) {
+	id := uint64(1)
+	if raw := os.Getenv("ENS_CHAIN_ID"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ENS_CHAIN_ID %q is not a chain ID", raw)
+		}
+		id = parsed
+	}
+
+	chain, err := chainByID(context.Background(), id)
+	if errors.Is(err, ErrUnknownChain) {
+		return nil, fmt.Errorf("%w: chain %d is not configured", ErrENSUnavailable, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := chain.client.CodeAt(context.Background(), ensRegistry(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("%w: no registry at %s on chain %d", ErrENSUnavailable, ensRegistry().Hex(), id)
+	}
+
+	return chain, nil
+}
+
+func ensRegistry() common.Address {
+	if raw := os.Getenv("ENS_REGISTRY"); common.IsHexAddress(raw) {
+		return common.HexToAddress(raw)
+	}
+	return common.HexToAddress(ensRegistryAddress)
+}
+
+// namehash is the ENS node of a name (EIP-137). Names are expected to be
+// normalised already.
+func namehash(name string) [32]byte {
+	var node [32]byte
+	if name == "" {
+		return node
+	}
+
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		label := crypto.Keccak256([]byte(labels[i]))
+		copy(node[:], crypto.Keccak256(node[:], label))
+	}
+	return node
+}
+
+// ensResolver returns the resolver of a node, or the zero address if none.
+func ensResolver(chain *Chain, node [32]byte) (common.Address, error) {
+	out, err := callContract(chain, ensRegistry(), ensABI, "resolver", node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return out[0].(common.Address), nil
+}
+
+// reverseName returns the primary name of addr, confirmed by a forward
+// lookup, or "" if it has none.
+func reverseName(chain *Chain, addr common.Address) (string, error) {
+	node := namehash(strings.ToLower(addr.Hex()[2:]) + ".addr.reverse")
+	resolver, err := ensResolver(chain, node)
+	if err != nil || resolver == (common.Address{}) {
+		return "", err
+	}
+
+	out, err := callContract(chain, resolver, ensABI, "name", node)
+	if err != nil {
+		return "", err
+	}
+	name := out[0].(string)
+	if name == "" {
+		return "", nil
+	}
+
+	// Anyone can claim any name in their reverse record; it only counts
+	// if the name points back.
+	resolved, err := ensAddr(chain, name)
+	if err != nil {
+		return "", err
+	}
+	if resolved != addr {
+		return "", nil
+	}
+
+	return name, nil
+}
+
+func ensAddr(chain *Chain, name string) (common.Address, error) {
+	node := namehash(name)
+	resolver, err := ensResolver(chain, node)
+	if err != nil || resolver == (common.Address{}) {
+		return common.Address{}, err
+	}
+
+	out, err := callContract(chain, resolver, ensABI, "addr", node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return out[0].(common.Address), nil
+}
+
+func ensText(chain *Chain, name, key string) (string, error) {
+	node := namehash(name)
+	resolver, err := ensResolver(chain, node)
+	if err != nil || resolver == (common.Address{}) {
+		return "", err
+	}
+
+	out, err := callContract(chain, resolver, ensABI, "text", node, key)
+	if err != nil {
+		return "", err
+	}
+	return out[0].(string), nil
+}
+
+// resolveAvatar turns an avatar record (ENSIP-12) into a URL: http(s) and
+// data URIs as they are, IPFS and Arweave URIs through a gateway, and
+// eip155 NFT references through the NFT's metadata, once the address is
+// confirmed to own it.
+func resolveAvatar(chain *Chain, owner common.Address, record string) (string, error) {
+	if !strings.HasPrefix(record, "eip155:") {
+		return gatewayURL(record)
+	}
+
+	// eip155:<chain>/<erc721|erc1155>:<contract>/<token id>
+	parts := strings.Split(strings.TrimPrefix(record, "eip155:"), "/")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed NFT avatar %q", record)
+	}
+	standard, contract, ok := strings.Cut(parts[1], ":")
+	if !ok || !common.IsHexAddress(contract) {
+		return "", fmt.Errorf("malformed NFT avatar %q", record)
+	}
+	tokenID, ok := new(big.Int).SetString(parts[2], 10)
+	if !ok {
+		return "", fmt.Errorf("malformed NFT avatar %q", record)
+	}
+
+	nftChain := chain
+	if chainID, err := strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return "", fmt.Errorf("malformed NFT avatar %q", record)
+	} else if !chain.ID.IsUint64() || chain.ID.Uint64() != chainID {
+		if nftChain, err = chainByID(context.Background(), chainID); err != nil {
+			return "", err
+		}
+	}
+	nft := common.HexToAddress(contract)
+
+	var uri string
+	switch strings.ToLower(standard) {
+	case "erc721":
+		out, err := callContract(nftChain, nft, avatarNFTABI, "ownerOf", tokenID)
+		if err != nil {
+			return "", err
+		}
+		if out[0].(common.Address) != owner {
+			return "", nil
+		}
+		if out, err = callContract(nftChain, nft, avatarNFTABI, "tokenURI", tokenID); err != nil {
+			return "", err
+		}
+		uri = out[0].(string)
+
+	case "erc1155":
+		out, err := callContract(nftChain, nft, avatarNFTABI, "balanceOf", owner, tokenID)
+		if err != nil {
+			return "", err
+		}
+		if out[0].(*big.Int).Sign() == 0 {
+			return "", nil
+		}
+		if out, err = callContract(nftChain, nft, avatarNFTABI, "uri", tokenID); err != nil {
+			return "", err
+		}
+		uri = strings.ReplaceAll(out[0].(string), "{id}", fmt.Sprintf("%064x", tokenID))
+
+	default:
+		return "", fmt.Errorf("unsupported NFT standard %q", standard)
+	}
+
+	metadataURL, err := gatewayURL(uri)
+	if err != nil {
+		return "", err
+	}
+	resp, err := ensHTTPClient.Get(metadataURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("NFT metadata responded %s", resp.Status)
+	}
+
+	var metadata struct {
+		Image    string `json:"image"`
+		ImageURL string `json:"image_url"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&metadata); err != nil {
+		return "", fmt.Errorf("invalid NFT metadata: %w", err)
+	}
+	image := metadata.Image
+	if image == "" {
+		image = metadata.ImageURL
+	}
+	if image == "" {
+		return "", errors.New("NFT metadata has no image")
+	}
+
+	return gatewayURL(image)
+}
+
+// gatewayURL maps ipfs://, ipns:// and ar:// URIs to an HTTP gateway:
+// IPFS_GATEWAY_URL (default https://ipfs.io) and arweave.net.
+func gatewayURL(uri string) (string, error) {
+	gateway := strings.TrimSuffix(os.Getenv("IPFS_GATEWAY_URL"), "/")
+	if gateway == "" {
+		gateway = "https://ipfs.io"
+	}
+
+	switch {
+	case strings.HasPrefix(uri, "https://"), strings.HasPrefix(uri, "http://"), strings.HasPrefix(uri, "data:"):
+		return uri, nil
+	case strings.HasPrefix(uri, "ipfs://"):
+		return gateway + "/ipfs/" + strings.TrimPrefix(strings.TrimPrefix(uri, "ipfs://"), "ipfs/"), nil
+	case strings.HasPrefix(uri, "ipns://"):
+		return gateway + "/ipns/" + strings.TrimPrefix(uri, "ipns://"), nil
+	case strings.HasPrefix(uri, "ar://"):
+		return "https://arweave.net/" + strings.TrimPrefix(uri, "ar://"), nil
+	}
+
+	return "", fmt.Errorf("unsupported URI %q", uri)
+}
+
+// forgetENSProfile drops an address's cached profile after its primary name
+// changes; otherwise the old name would show until the TTL ran out.
+func forgetENSProfile(address common.Address) {
+	ensMu.Lock()
+	defer ensMu.Unlock()
+
+	cache, err := readENSCache()
+	if err != nil || cache[address.Hex()] == nil {
+		return
+	}
+
+	delete(cache, address.Hex())
+	writeJSONFile(ensFile, cache)
+}
+
+func readENSCache() (map[string]*ENSProfile, error) {
+	cache := map[string]*ENSProfile{}
+	if err := readJSONFile(ensFile, &cache); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return cache, nil
+}
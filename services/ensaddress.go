@@ -0,0 +1,438 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const ensExtendedResolverABIJSON = `[
+	{"type":"function","name":"supportsInterface","stateMutability":"view","inputs":[{"name":"id","type":"bytes4"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"resolve","stateMutability":"view","inputs":[{"name":"name","type":"bytes"},{"name":"data","type":"bytes"}],"outputs":[{"name":"","type":"bytes"}]},
+	{"type":"function","name":"addr","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"},{"name":"coinType","type":"uint256"}],"outputs":[{"name":"","type":"bytes"}]},
+	{"type":"error","name":"OffchainLookup","inputs":[{"name":"sender","type":"address"},{"name":"urls","type":"string[]"},{"name":"callData","type":"bytes"},{"name":"callbackFunction","type":"bytes4"},{"name":"extraData","type":"bytes"}]}
+]`
+
+var (
+	ensExtendedResolverABI = mustParseABI(ensExtendedResolverABIJSON)
+	bytesType, _           = abi.NewType("bytes", "", nil)
+)
+
+// extendedResolverInterface is the ENSIP-10 interface ID of resolve(bytes,bytes).
+var extendedResolverInterface = [4]byte{0x90, 0x61, 0xb9, 0x23}
+
+// maxOffchainLookups bounds how many gateway round trips one resolution may
+// take, since a callback can itself ask for another lookup.
+const maxOffchainLookups = 4
+
+// NameResolution records how a recipient name was turned into an address,
+// so a preview can show where the address came from. Source is the record
+// it was read from: "addr" for the address record of the chain's coin type
+// (CoinType), or "text:<key>" for a text record. Gateway is set when the
+// record was served offchain (EIP-3668) and checked by the resolver's
+// callback, as for DNS names imported without an onchain claim. DNS is set
+// for names outside .eth, which are only in ENS by proving their DNSSEC
+// records.
+type NameResolution struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Source   string `json:"source"`
+	CoinType uint64 `json:"coin_type,omitempty"`
+	Resolver string `json:"resolver"`
+	Wildcard bool   `json:"wildcard,omitempty"`
+	Gateway  string `json:"gateway,omitempty"`
+	DNS      bool   `json:"dns,omitempty"`
+}
+
+var ErrNameNotResolved = errors.New("name does not resolve to an address")
+
+// IsENSName reports whether a recipient looks like a name rather than an
+// address.
+func IsENSName(recipient string) bool {
+	return !common.IsHexAddress(recipient) && strings.Contains(recipient, ".")
+}
+
+// ResolveRecipient resolves an ENS name, or a DNS name imported into ENS
+// with DNSSEC, to the address to pay on chain. The address record for the
+// chain's ENSIP-11 coin type is used, then the default EVM coin type, and
+// for chains other than mainnet never the mainnet record, which may belong
+// to a contract wallet that does not exist elsewhere. Failing those, the
+// text record ENS_ADDRESS_TEXT_KEY (default "address") is used if it holds
+// an address.
+func ResolveRecipient(chain *Chain, name string) (*NameResolution, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if err := validateENSName(name); err != nil {
+		return nil, err
+	}
+
+	ens, err := ensChain()
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, wildcard, err := findResolver(ens, name)
+	if err != nil {
+		return nil, err
+	}
+	if resolver == (common.Address{}) {
+		return nil, fmt.Errorf("%w: %s is not in ENS", ErrNameNotResolved, name)
+	}
+
+	resolution := &NameResolution{
+		Name:     name,
+		Resolver: resolver.Hex(),
+		Wildcard: wildcard,
+		DNS:      !strings.HasSuffix(name, ".eth"),
+	}
+	node := namehash(name)
+
+	for _, coinType := range coinTypes(chain) {
+		var call []byte
+		if coinType == 60 {
+			call, err = ensABI.Pack("addr", node)
+		} else {
+			call, err = ensExtendedResolverABI.Pack("addr", node, new(big.Int).SetUint64(coinType))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result, gateway, err := resolveRecord(ens, resolver, wildcard, name, call)
+		if err != nil {
+			return nil, err
+		}
+		address, err := decodeAddrRecord(coinType, result)
+		if err != nil {
+			return nil, err
+		}
+		if address != (common.Address{}) {
+			resolution.Address = address.Hex()
+			resolution.Source = "addr"
+			resolution.CoinType = coinType
+			resolution.Gateway = gateway
+			return resolution, nil
+		}
+	}
+
+	key := os.Getenv("ENS_ADDRESS_TEXT_KEY")
+	if key == "" {
+		key = "address"
+	}
+	call, err := ensABI.Pack("text", node, key)
+	if err != nil {
+		return nil, err
+	}
+	result, gateway, err := resolveRecord(ens, resolver, wildcard, name, call)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) > 0 {
+		out, err := ensABI.Unpack("text", result)
+		if err != nil {
+			return nil, err
+		}
+		if text := strings.TrimSpace(out[0].(string)); common.IsHexAddress(text) {
+			resolution.Address = common.HexToAddress(text).Hex()
+			resolution.Source = "text:" + key
+			resolution.Gateway = gateway
+			return resolution, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s has no address for chain %d", ErrNameNotResolved, name, chain.ID.Uint64())
+}
+
+// coinTypes are the ENSIP-11 coin types to look up, in order, for payments
+// on chain.
+func coinTypes(chain *Chain) []uint64 {
+	if chain.ID.IsUint64() && chain.ID.Uint64() == 1 {
+		return []uint64{60}
+	}
+
+	return []uint64{0x80000000 | chain.ID.Uint64(), 0x80000000}
+}
+
+func decodeAddrRecord(coinType uint64, result []byte) (common.Address, error) {
+	if len(result) == 0 {
+		return common.Address{}, nil
+	}
+
+	if coinType == 60 {
+		out, err := ensABI.Unpack("addr", result)
+		if err != nil {
+			return common.Address{}, err
+		}
+		return out[0].(common.Address), nil
+	}
+
+	out, err := ensExtendedResolverABI.Unpack("addr", result)
+	if err != nil {
+		return common.Address{}, err
+	}
+	raw := out[0].([]byte)
+	if len(raw) == 0 {
+		return common.Address{}, nil
+	}
+	if len(raw) != common.AddressLength {
+		return common.Address{}, fmt.Errorf("address record of coin type %d is not an EVM address", coinType)
+	}
+	return common.BytesToAddress(raw), nil
+}
+
+// findResolver finds the resolver for name (ENSIP-10): the name's own, or
+// failing that the nearest parent's, which must then support wildcard
+// resolution.
+func findResolver(chain *Chain, name string) (common.Address, bool, error) {
+	for parent := name; parent != ""; {
+		resolver, err := ensResolver(chain, namehash(parent))
+		if err != nil {
+			return common.Address{}, false, err
+		}
+		if resolver != (common.Address{}) {
+			if parent == name {
+				return resolver, false, nil
+			}
+			extended, err := supportsExtendedResolver(chain, resolver)
+			if err != nil || !extended {
+				return common.Address{}, false, err
+			}
+			return resolver, true, nil
+		}
+
+		_, rest, ok := strings.Cut(parent, ".")
+		if !ok {
+			break
+		}
+		parent = rest
+	}
+
+	return common.Address{}, false, nil
+}
+
+func supportsExtendedResolver(chain *Chain, resolver common.Address) (bool, error) {
+	data, err := ensExtendedResolverABI.Pack("supportsInterface", extendedResolverInterface)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := chain.client.CallContract(context.Background(), ethereum.CallMsg{To: &resolver, Data: data}, nil)
+	if err != nil {
+		// Resolvers without ERC-165 revert rather than answer false.
+		if isRevert(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	out, err := ensExtendedResolverABI.Unpack("supportsInterface", result)
+	if err != nil {
+		return false, nil
+	}
+	return out[0].(bool), nil
+}
+
+// resolveRecord reads a resolver record, given as the calldata of the
+// record's getter, and returns the getter's ABI-encoded result, empty if
+// the resolver has no such record. Extended resolvers are called through
+// resolve(bytes,bytes), following offchain lookups; gateway is the last
+// gateway that answered.
+func resolveRecord(chain *Chain, resolver common.Address, wildcard bool, name string, call []byte) ([]byte, string, error) {
+	extended := wildcard
+	if !extended {
+		var err error
+		if extended, err = supportsExtendedResolver(chain, resolver); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if !extended {
+		result, err := chain.client.CallContract(context.Background(), ethereum.CallMsg{To: &resolver, Data: call}, nil)
+		if err != nil {
+			// A resolver without the getter reverts.
+			if isRevert(err) {
+				return nil, "", nil
+			}
+			return nil, "", err
+		}
+		return result, "", nil
+	}
+
+	data, err := ensExtendedResolverABI.Pack("resolve", dnsEncode(name), call)
+	if err != nil {
+		return nil, "", err
+	}
+	result, gateway, err := callWithOffchainLookup(chain, resolver, data)
+	if err != nil {
+		if isRevert(err) {
+			return nil, gateway, nil
+		}
+		return nil, gateway, err
+	}
+
+	out, err := ensExtendedResolverABI.Unpack("resolve", result)
+	if err != nil {
+		return nil, gateway, err
+	}
+	return out[0].([]byte), gateway, nil
+}
+
+// callWithOffchainLookup makes a call that may be answered offchain
+// (EIP-3668): when the contract reverts with OffchainLookup, the gateway's
+// response is passed back to the contract's callback, which verifies it.
+// The gateway's answer is never used without that check.
+func callWithOffchainLookup(chain *Chain, contract common.Address, data []byte) ([]byte, string, error) {
+	gateway := ""
+	for i := 0; i <= maxOffchainLookups; i++ {
+		result, err := chain.client.CallContract(context.Background(), ethereum.CallMsg{To: &contract, Data: data}, nil)
+		if err == nil {
+			return result, gateway, nil
+		}
+
+		lookup, ok := offchainLookup(err)
+		if !ok {
+			return nil, gateway, err
+		}
+		if lookup.Sender != contract {
+			return nil, gateway, errors.New("offchain lookup sender does not match the resolver")
+		}
+		if i == maxOffchainLookups {
+			break
+		}
+
+		response, gatewayURL, err := queryGateways(lookup.Sender, lookup.URLs, lookup.CallData)
+		if err != nil {
+			return nil, gateway, err
+		}
+		// The URL carries the request; its origin is what identifies the
+		// gateway.
+		if parsed, err := url.Parse(gatewayURL); err == nil {
+			gateway = parsed.Scheme + "://" + parsed.Host
+		}
+
+		callback, err := (abi.Arguments{{Type: bytesType}, {Type: bytesType}}).Pack(response, lookup.ExtraData)
+		if err != nil {
+			return nil, gateway, err
+		}
+		data = append(lookup.CallbackFunction[:], callback...)
+	}
+
+	return nil, gateway, errors.New("too many offchain lookups")
+}
+
+type offchainLookupError struct {
+	Sender           common.Address
+	URLs             []string
+	CallData         []byte
+	CallbackFunction [4]byte
+	ExtraData        []byte
+}
+
+func offchainLookup(err error) (*offchainLookupError, bool) {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return nil, false
+	}
+	encoded, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return nil, false
+	}
+	revert, err := hexutil.Decode(encoded)
+	lookupError := ensExtendedResolverABI.Errors["OffchainLookup"]
+	if err != nil || len(revert) < 4 || !bytes.Equal(revert[:4], lookupError.ID[:4]) {
+		return nil, false
+	}
+
+	values, err := lookupError.Inputs.Unpack(revert[4:])
+	if err != nil || len(values) != 5 {
+		return nil, false
+	}
+
+	return &offchainLookupError{
+		Sender:           values[0].(common.Address),
+		URLs:             values[1].([]string),
+		CallData:         values[2].([]byte),
+		CallbackFunction: values[3].([4]byte),
+		ExtraData:        values[4].([]byte),
+	}, true
+}
+
+// queryGateways asks each gateway URL in turn, as EIP-3668 describes: a GET
+// when the URL takes {data}, a POST otherwise. A 4xx answer ends the lookup;
+// other failures move on to the next URL.
+func queryGateways(sender common.Address, urls []string, callData []byte) ([]byte, string, error) {
+	senderHex := strings.ToLower(sender.Hex())
+	dataHex := hexutil.Encode(callData)
+
+	var lastErr error = errors.New("offchain lookup has no gateway URLs")
+	for _, template := range urls {
+		if !strings.HasPrefix(template, "https://") && !strings.HasPrefix(template, "http://") {
+			continue
+		}
+		target := strings.ReplaceAll(strings.ReplaceAll(template, "{sender}", senderHex), "{data}", dataHex)
+
+		var resp *http.Response
+		var err error
+		if strings.Contains(template, "{data}") {
+			resp, err = ensHTTPClient.Get(target)
+		} else {
+			body, _ := json.Marshal(map[string]string{"data": dataHex, "sender": senderHex})
+			resp, err = ensHTTPClient.Post(target, "application/json", bytes.NewReader(body))
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		var answer struct {
+			Data string `json:"data"`
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&answer)
+		resp.Body.Close()
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return nil, target, fmt.Errorf("offchain gateway %s responded %s", target, resp.Status)
+		}
+		if resp.StatusCode != http.StatusOK || err != nil {
+			lastErr = fmt.Errorf("offchain gateway %s responded %s", target, resp.Status)
+			continue
+		}
+
+		response, err := hexutil.Decode(answer.Data)
+		if err != nil {
+			lastErr = fmt.Errorf("offchain gateway %s returned invalid data", target)
+			continue
+		}
+		return response, target, nil
+	}
+
+	return nil, "", lastErr
+}
+
+// dnsEncode encodes a name in DNS wire format, as resolve(bytes,bytes)
+// takes it.
+func dnsEncode(name string) []byte {
+	var encoded []byte
+	for _, label := range strings.Split(name, ".") {
+		encoded = append(encoded, byte(len(label)))
+		encoded = append(encoded, label...)
+	}
+
+	return append(encoded, 0)
+}
+
+func isRevert(err error) bool {
+	var dataErr rpc.DataError
+	return errors.As(err, &dataErr) || strings.Contains(err.Error(), "execution reverted")
+}
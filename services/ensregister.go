@@ -0,0 +1,646 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Mainnet deployments of the .eth registrar controller and public resolver.
+const (
+	ensControllerAddress     = "0x253553366Da8546fC250F225fe3d25d0C782303b"
+	ensPublicResolverAddress = "0x231b0Ee14048e9dCcD1d247744d114a4EB5E8E63"
+)
+
+const ensControllerABIJSON = `[
+	{"type":"function","name":"available","stateMutability":"view","inputs":[{"name":"name","type":"string"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"rentPrice","stateMutability":"view","inputs":[{"name":"name","type":"string"},{"name":"duration","type":"uint256"}],"outputs":[{"name":"price","type":"tuple","components":[{"name":"base","type":"uint256"},{"name":"premium","type":"uint256"}]}]},
+	{"type":"function","name":"minCommitmentAge","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"maxCommitmentAge","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"commitments","stateMutability":"view","inputs":[{"name":"","type":"bytes32"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"makeCommitment","stateMutability":"pure","inputs":[{"name":"name","type":"string"},{"name":"owner","type":"address"},{"name":"duration","type":"uint256"},{"name":"secret","type":"bytes32"},{"name":"resolver","type":"address"},{"name":"data","type":"bytes[]"},{"name":"reverseRecord","type":"bool"},{"name":"ownerControlledFuses","type":"uint16"}],"outputs":[{"name":"","type":"bytes32"}]},
+	{"type":"function","name":"commit","stateMutability":"nonpayable","inputs":[{"name":"commitment","type":"bytes32"}],"outputs":[]},
+	{"type":"function","name":"register","stateMutability":"payable","inputs":[{"name":"name","type":"string"},{"name":"owner","type":"address"},{"name":"duration","type":"uint256"},{"name":"secret","type":"bytes32"},{"name":"resolver","type":"address"},{"name":"data","type":"bytes[]"},{"name":"reverseRecord","type":"bool"},{"name":"ownerControlledFuses","type":"uint16"}],"outputs":[]},
+	{"type":"function","name":"renew","stateMutability":"payable","inputs":[{"name":"name","type":"string"},{"name":"duration","type":"uint256"}],"outputs":[]}
+]`
+
+const ensResolverWriteABIJSON = `[
+	{"type":"function","name":"setAddr","stateMutability":"nonpayable","inputs":[{"name":"node","type":"bytes32"},{"name":"addr","type":"address"}],"outputs":[]},
+	{"type":"function","name":"setText","stateMutability":"nonpayable","inputs":[{"name":"node","type":"bytes32"},{"name":"key","type":"string"},{"name":"value","type":"string"}],"outputs":[]},
+	{"type":"function","name":"setContenthash","stateMutability":"nonpayable","inputs":[{"name":"node","type":"bytes32"},{"name":"hash","type":"bytes"}],"outputs":[]},
+	{"type":"function","name":"multicall","stateMutability":"nonpayable","inputs":[{"name":"data","type":"bytes[]"}],"outputs":[{"name":"results","type":"bytes[]"}]}
+]`
+
+var (
+	ensControllerABI    = mustParseABI(ensControllerABIJSON)
+	ensResolverWriteABI = mustParseABI(ensResolverWriteABIJSON)
+)
+
+const (
+	RegistrationCommitted  = "committed"
+	RegistrationRegistered = "registered"
+)
+
+// defaultENSDuration is how long names are registered or renewed for when
+// no duration is given: a year, in seconds as the controller counts it.
+const defaultENSDuration = 365 * 24 * 60 * 60
+
+// ENSAvailability is whether a .eth name can be registered and what a
+// registration would cost, in wei.
+type ENSAvailability struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Duration  uint64 `json:"duration"`
+	Base      string `json:"base"`
+	Premium   string `json:"premium"`
+}
+
+// ENSRegistration is a .eth name registration in progress. The controller
+// only accepts a registration that was committed to at least
+// minCommitmentAge earlier, so that nobody watching the mempool can
+// register the name first.
+type ENSRegistration struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Owner        string     `json:"owner"`
+	Duration     uint64     `json:"duration"`
+	Primary      bool       `json:"primary"`
+	Commitment   string     `json:"commitment"`
+	CommitTx     string     `json:"commit_tx"`
+	RegisterTx   string     `json:"register_tx,omitempty"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RegisteredAt *time.Time `json:"registered_at,omitempty"`
+}
+
+// storedRegistration adds the commitment's secret, which is kept until the
+// registration reveals it and never returned by the API.
+type storedRegistration struct {
+	ENSRegistration
+	Secret string `json:"secret,omitempty"`
+}
+
+// ENSRecords are resolver records to set on a name. Nil fields are left as
+// they are; Texts entries with an empty value clear the record.
+type ENSRecords struct {
+	Address     *string           `json:"address"`
+	Texts       map[string]string `json:"texts"`
+	Contenthash *string           `json:"contenthash"`
+}
+
+var (
+	ensRegistrationsFile = "ens_registrations.json"
+	ensRegistrationsMu   sync.Mutex
+)
+
+var (
+	ErrENSNameUnavailable   = errors.New("ENS name is not available")
+	ErrRegistrationNotFound = errors.New("ENS registration not found")
+	ErrRegistrationNotReady = errors.New("ENS registration is not ready")
+	ErrRegistrationExpired  = errors.New("ENS commitment has expired")
+	ErrRegistrationComplete = errors.New("ENS registration is already complete")
+	ErrInvalidENSDuration   = errors.New("invalid registration duration")
+	ErrInvalidENSRecords    = errors.New("invalid ENS records")
+	ErrENSResolverNotSet    = errors.New("ENS name has no resolver")
+)
+
+// CheckENSAvailability reports whether label.eth can be registered and its
+// price for duration seconds, a year if zero.
+func CheckENSAvailability(name string, duration uint64) (*ENSAvailability, error) {
+	label, err := ethLabel(name)
+	if err != nil {
+		return nil, err
+	}
+	if duration, err = ensDuration(duration); err != nil {
+		return nil, err
+	}
+
+	chain, err := ensChain()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := callContract(chain, ensController(), ensControllerABI, "available", label)
+	if err != nil {
+		return nil, err
+	}
+	availability := &ENSAvailability{Name: label + ".eth", Available: out[0].(bool), Duration: duration}
+
+	base, premium, err := ensRentPrice(chain, label, duration)
+	if err != nil {
+		return nil, err
+	}
+	availability.Base = base.String()
+	availability.Premium = premium.String()
+
+	return availability, nil
+}
+
+// CommitENSRegistration starts registering label.eth to the selected
+// account for duration seconds, a year if zero, by sending the commitment.
+// The name is set to resolve to the account, and if primary is set it also
+// becomes the account's primary name. Registration is completed with
+// RegisterENSName once the commitment is old enough.
+func CommitENSRegistration(name string, duration uint64, primary bool) (*ENSRegistration, error) {
+	label, err := ethLabel(name)
+	if err != nil {
+		return nil, err
+	}
+	if duration, err = ensDuration(duration); err != nil {
+		return nil, err
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		return nil, err
+	}
+	owner := signer.Address()
+
+	chain, err := ensChain()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := callContract(chain, ensController(), ensControllerABI, "available", label)
+	if err != nil {
+		return nil, err
+	}
+	if !out[0].(bool) {
+		return nil, fmt.Errorf("%w: %s.eth", ErrENSNameUnavailable, label)
+	}
+
+	var secret [32]byte
+	if _, err := rand.Read(secret[:]); err != nil {
+		return nil, err
+	}
+
+	registration := storedRegistration{
+		ENSRegistration: ENSRegistration{
+			ID:        newID(),
+			Name:      label + ".eth",
+			Owner:     owner.Hex(),
+			Duration:  duration,
+			Primary:   primary,
+			Status:    RegistrationCommitted,
+			CreatedAt: time.Now().UTC(),
+		},
+		Secret: hexutil.Encode(secret[:]),
+	}
+
+	commitment, err := registration.commitment(chain)
+	if err != nil {
+		return nil, err
+	}
+	registration.Commitment = hexutil.Encode(commitment[:])
+
+	data, err := ensControllerABI.Pack("commit", commitment)
+	if err != nil {
+		return nil, err
+	}
+	if registration.CommitTx, err = sendContractTransaction(chain, signer, ensController(), big.NewInt(0), data); err != nil {
+		return nil, err
+	}
+
+	ensRegistrationsMu.Lock()
+	defer ensRegistrationsMu.Unlock()
+
+	registrations, err := readENSRegistrations()
+	if err != nil {
+		return nil, err
+	}
+	registrations = append(registrations, &registration)
+	if err := writeJSONFile(ensRegistrationsFile, registrations); err != nil {
+		return nil, err
+	}
+
+	recordAudit("ens.commit", fmt.Sprintf("committed to registering %s for %s", registration.Name, registration.Owner),
+		map[string]interface{}{"registration_id": registration.ID, "name": registration.Name, "tx_hash": registration.CommitTx})
+	return &registration.ENSRegistration, nil
+}
+
+// ENSRegistrationPrice is what completing a registration will send: the
+// rent price with 5% on top, since the price is in USD and moves with the
+// exchange rate until the transaction is mined. The controller refunds
+// whatever is not needed.
+func ENSRegistrationPrice(id string) (*big.Int, error) {
+	registration, err := findENSRegistration(id)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := ensChain()
+	if err != nil {
+		return nil, err
+	}
+
+	label := strings.TrimSuffix(registration.Name, ".eth")
+	return ensPriceWithMargin(chain, label, registration.Duration)
+}
+
+// RegisterENSName completes a committed registration by revealing it and
+// paying for it.
+func RegisterENSName(id string) (*ENSRegistration, error) {
+	registration, err := findENSRegistration(id)
+	if err != nil {
+		return nil, err
+	}
+	if registration.Status != RegistrationCommitted {
+		return nil, ErrRegistrationComplete
+	}
+
+	signer, err := accountSigner(registration.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := ensChain()
+	if err != nil {
+		return nil, err
+	}
+
+	commitment, err := registration.commitment(chain)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCommitmentAge(chain, commitment); err != nil {
+		return nil, err
+	}
+
+	label := strings.TrimSuffix(registration.Name, ".eth")
+	value, err := ensPriceWithMargin(chain, label, registration.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := registration.args()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ensControllerABI.Pack("register", args...)
+	if err != nil {
+		return nil, err
+	}
+	txHash, err := sendContractTransaction(chain, signer, ensController(), value, data)
+	if err != nil {
+		return nil, err
+	}
+
+	ensRegistrationsMu.Lock()
+	defer ensRegistrationsMu.Unlock()
+
+	registrations, err := readENSRegistrations()
+	if err != nil {
+		return nil, err
+	}
+	for _, stored := range registrations {
+		if stored.ID == id {
+			stored.Status = RegistrationRegistered
+			stored.RegisterTx = txHash
+			now := time.Now().UTC()
+			stored.RegisteredAt = &now
+			// The secret has been revealed and is of no further use.
+			stored.Secret = ""
+			registration = stored
+		}
+	}
+	if err := writeJSONFile(ensRegistrationsFile, registrations); err != nil {
+		return nil, err
+	}
+
+	if registration.Primary {
+		forgetENSProfile(common.HexToAddress(registration.Owner))
+	}
+
+	recordAudit("ens.registered", fmt.Sprintf("registered %s for %s", registration.Name, registration.Owner),
+		map[string]interface{}{"registration_id": id, "name": registration.Name, "value": value.String(), "tx_hash": txHash})
+	return &registration.ENSRegistration, nil
+}
+
+func ListENSRegistrations() ([]ENSRegistration, error) {
+	ensRegistrationsMu.Lock()
+	defer ensRegistrationsMu.Unlock()
+
+	registrations, err := readENSRegistrations()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]ENSRegistration, len(registrations))
+	for i, registration := range registrations {
+		list[i] = registration.ENSRegistration
+	}
+
+	return list, nil
+}
+
+// ENSRenewalPrice is what renewing label.eth for duration seconds, a year
+// if zero, will send, with the same margin as a registration.
+func ENSRenewalPrice(name string, duration uint64) (*big.Int, error) {
+	label, err := ethLabel(name)
+	if err != nil {
+		return nil, err
+	}
+	if duration, err = ensDuration(duration); err != nil {
+		return nil, err
+	}
+
+	chain, err := ensChain()
+	if err != nil {
+		return nil, err
+	}
+
+	return ensPriceWithMargin(chain, label, duration)
+}
+
+// RenewENSName extends label.eth by duration seconds, a year if zero, paid
+// from the selected account. Anyone may renew any name.
+func RenewENSName(name string, duration uint64) (string, error) {
+	label, err := ethLabel(name)
+	if err != nil {
+		return "", err
+	}
+	if duration, err = ensDuration(duration); err != nil {
+		return "", err
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		return "", err
+	}
+
+	chain, err := ensChain()
+	if err != nil {
+		return "", err
+	}
+
+	value, err := ensPriceWithMargin(chain, label, duration)
+	if err != nil {
+		return "", err
+	}
+	data, err := ensControllerABI.Pack("renew", label, new(big.Int).SetUint64(duration))
+	if err != nil {
+		return "", err
+	}
+	txHash, err := sendContractTransaction(chain, signer, ensController(), value, data)
+	if err != nil {
+		return "", err
+	}
+
+	recordAudit("ens.renewed", fmt.Sprintf("renewed %s.eth for %d seconds", label, duration),
+		map[string]interface{}{"name": label + ".eth", "duration": duration, "value": value.String(), "tx_hash": txHash})
+	return txHash, nil
+}
+
+// SetENSRecords sets records on the resolver of a name the selected account
+// controls, in one transaction.
+func SetENSRecords(name string, records ENSRecords) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if err := validateENSName(name); err != nil {
+		return "", err
+	}
+	node := namehash(name)
+
+	var calls [][]byte
+	if records.Address != nil {
+		if !common.IsHexAddress(*records.Address) {
+			return "", fmt.Errorf("%w: address %q", ErrInvalidENSRecords, *records.Address)
+		}
+		call, err := ensResolverWriteABI.Pack("setAddr", node, common.HexToAddress(*records.Address))
+		if err != nil {
+			return "", err
+		}
+		calls = append(calls, call)
+	}
+	for key, value := range records.Texts {
+		if key == "" {
+			return "", fmt.Errorf("%w: empty text record key", ErrInvalidENSRecords)
+		}
+		call, err := ensResolverWriteABI.Pack("setText", node, key, value)
+		if err != nil {
+			return "", err
+		}
+		calls = append(calls, call)
+	}
+	if records.Contenthash != nil {
+		hash, err := hexutil.Decode(*records.Contenthash)
+		if *records.Contenthash == "" {
+			hash, err = []byte{}, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: contenthash must be hex encoded", ErrInvalidENSRecords)
+		}
+		call, err := ensResolverWriteABI.Pack("setContenthash", node, hash)
+		if err != nil {
+			return "", err
+		}
+		calls = append(calls, call)
+	}
+	if len(calls) == 0 {
+		return "", fmt.Errorf("%w: no records given", ErrInvalidENSRecords)
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		return "", err
+	}
+
+	chain, err := ensChain()
+	if err != nil {
+		return "", err
+	}
+
+	resolver, err := ensResolver(chain, node)
+	if err != nil {
+		return "", err
+	}
+	if resolver == (common.Address{}) {
+		return "", fmt.Errorf("%w: %s", ErrENSResolverNotSet, name)
+	}
+
+	data := calls[0]
+	if len(calls) > 1 {
+		if data, err = ensResolverWriteABI.Pack("multicall", calls); err != nil {
+			return "", err
+		}
+	}
+	txHash, err := sendContractTransaction(chain, signer, resolver, big.NewInt(0), data)
+	if err != nil {
+		return "", err
+	}
+
+	recordAudit("ens.records_set", fmt.Sprintf("%d records of %s set", len(calls), name),
+		map[string]interface{}{"name": name, "resolver": resolver.Hex(), "tx_hash": txHash})
+	return txHash, nil
+}
+
+// args are a registration's arguments to makeCommitment and register,
+// which must match exactly. The name is registered with the public
+// resolver and set to resolve to its owner.
+func (r *storedRegistration) args() ([]interface{}, error) {
+	secret, err := hexutil.Decode(r.Secret)
+	if err != nil || len(secret) != 32 {
+		return nil, errors.New("registration secret is missing")
+	}
+	var secret32 [32]byte
+	copy(secret32[:], secret)
+
+	owner := common.HexToAddress(r.Owner)
+	setAddr, err := ensResolverWriteABI.Pack("setAddr", namehash(r.Name), owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{
+		strings.TrimSuffix(r.Name, ".eth"), owner, new(big.Int).SetUint64(r.Duration), secret32,
+		ensPublicResolver(), [][]byte{setAddr}, r.Primary, uint16(0),
+	}, nil
+}
+
+func (r *storedRegistration) commitment(chain *Chain) ([32]byte, error) {
+	args, err := r.args()
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	out, err := callContract(chain, ensController(), ensControllerABI, "makeCommitment", args...)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return out[0].([32]byte), nil
+}
+
+// checkCommitmentAge fails unless the commitment was mined at least
+// minCommitmentAge and at most maxCommitmentAge ago.
+func checkCommitmentAge(chain *Chain, commitment [32]byte) error {
+	out, err := callContract(chain, ensController(), ensControllerABI, "commitments", commitment)
+	if err != nil {
+		return err
+	}
+	committedAt := out[0].(*big.Int)
+	if committedAt.Sign() == 0 {
+		return fmt.Errorf("%w: the commit transaction has not been mined", ErrRegistrationNotReady)
+	}
+
+	if out, err = callContract(chain, ensController(), ensControllerABI, "minCommitmentAge"); err != nil {
+		return err
+	}
+	minAge := out[0].(*big.Int)
+	if out, err = callContract(chain, ensController(), ensControllerABI, "maxCommitmentAge"); err != nil {
+		return err
+	}
+	maxAge := out[0].(*big.Int)
+
+	committed := time.Unix(committedAt.Int64(), 0)
+	if ready := committed.Add(time.Duration(minAge.Int64()) * time.Second); time.Now().Before(ready) {
+		return fmt.Errorf("%w: it can be completed after %s", ErrRegistrationNotReady, ready.UTC().Format(time.RFC3339))
+	}
+	if time.Now().After(committed.Add(time.Duration(maxAge.Int64()) * time.Second)) {
+		return ErrRegistrationExpired
+	}
+
+	return nil
+}
+
+func ensRentPrice(chain *Chain, label string, duration uint64) (*big.Int, *big.Int, error) {
+	out, err := callContract(chain, ensController(), ensControllerABI, "rentPrice", label, new(big.Int).SetUint64(duration))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	price := *abi.ConvertType(out[0], new(struct{ Base, Premium *big.Int })).(*struct{ Base, Premium *big.Int })
+	return price.Base, price.Premium, nil
+}
+
+func ensPriceWithMargin(chain *Chain, label string, duration uint64) (*big.Int, error) {
+	base, premium, err := ensRentPrice(chain, label, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	price := new(big.Int).Add(base, premium)
+	return price.Add(price, new(big.Int).Div(price, big.NewInt(20))), nil
+}
+
+// ethLabel returns the label of a .eth second-level name, given with or
+// without the .eth. The controller only registers labels of at least three
+// characters.
+func ethLabel(name string) (string, error) {
+	label := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".eth")
+	if len([]rune(label)) < 3 || strings.ContainsAny(label, ". /") {
+		return "", fmt.Errorf("%w: %q is not a .eth name of at least three characters", ErrInvalidENSName, name)
+	}
+
+	return label, nil
+}
+
+func validateENSName(name string) error {
+	if !strings.Contains(name, ".") || strings.ContainsAny(name, " /") || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") {
+		return fmt.Errorf("%w: %q", ErrInvalidENSName, name)
+	}
+
+	return nil
+}
+
+// ensDuration defaults a registration duration to a year. The controller
+// refuses anything under 28 days.
+func ensDuration(duration uint64) (uint64, error) {
+	if duration == 0 {
+		return defaultENSDuration, nil
+	}
+	if duration < 28*24*60*60 {
+		return 0, fmt.Errorf("%w: at least 28 days (2419200 seconds)", ErrInvalidENSDuration)
+	}
+
+	return duration, nil
+}
+
+// ensController and ensPublicResolver are ENS_CONTROLLER and
+// ENS_PUBLIC_RESOLVER, defaulting to the mainnet deployments.
+func ensController() common.Address {
+	if raw := os.Getenv("ENS_CONTROLLER"); common.IsHexAddress(raw) {
+		return common.HexToAddress(raw)
+	}
+	return common.HexToAddress(ensControllerAddress)
+}
+
+func ensPublicResolver() common.Address {
+	if raw := os.Getenv("ENS_PUBLIC_RESOLVER"); common.IsHexAddress(raw) {
+		return common.HexToAddress(raw)
+	}
+	return common.HexToAddress(ensPublicResolverAddress)
+}
+
+func findENSRegistration(id string) (*storedRegistration, error) {
+	ensRegistrationsMu.Lock()
+	defer ensRegistrationsMu.Unlock()
+
+	registrations, err := readENSRegistrations()
+	if err != nil {
+		return nil, err
+	}
+	for _, registration := range registrations {
+		if registration.ID == id {
+			return registration, nil
+		}
+	}
+
+	return nil, ErrRegistrationNotFound
+}
+
+func readENSRegistrations() ([]*storedRegistration, error) {
+	var registrations []*storedRegistration
+	if err := readJSONFile(ensRegistrationsFile, &registrations); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return registrations, nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jabbala-dev/go-wallet/models"
+)
+
+const (
+	// transferGas is what a plain transfer to an account without code
+	// always costs, so an estimate of it needs no margin.
+	transferGas = 21000
+
+	defaultGasLimitMargin = 20
+
+	// feeHistoryBlocks is how many recent blocks the fee tiers are drawn
+	// from.
+	feeHistoryBlocks = 20
+)
+
+var ErrGasEstimation = errors.New("gas estimation failed")
+
+// feeTierPercentiles are the priority fee percentiles of the slow,
+// standard and fast tiers on EIP-1559 chains; feeTierScales scale the
+// suggested gas price, in percent, on chains without them.
+var (
+	feeTierNames       = []string{"slow", "standard", "fast"}
+	feeTierPercentiles = []float64{10, 50, 90}
+	feeTierScales      = []int64{90, 100, 125}
+)
+
+type (
+	FeeTier     = models.FeeTier
+	FeeEstimate = models.FeeEstimate
+)
+
+// gasLimitMargin is the percentage added to an estimate, GAS_LIMIT_MARGIN
+// or 20.
+func gasLimitMargin() uint64 {
+	if raw := os.Getenv("GAS_LIMIT_MARGIN"); raw != "" {
+		if margin, err := strconv.ParseUint(raw, 10, 64); err == nil && margin <= 200 {
+			return margin
+		}
+	}
+
+	return defaultGasLimitMargin
+}
+
+// estimateGasLimit asks the node what a transaction would take and adds
+// the margin, returning the estimate and the limit to send with.
+func estimateGasLimit(ctx context.Context, chain *Chain, from, to common.Address, value *big.Int, data []byte) (estimated, limit uint64, err error) {
+	estimated, err = chain.client.EstimateGas(ctx, ethereum.CallMsg{
+		From:  from,
+		To:    &to,
+		Value: value,
+		Data:  data,
+	})
+	if err != nil {
+		if isConnectivityError(err) {
+			return 0, 0, err
+		}
+		return 0, 0, fmt.Errorf("%w: %v", ErrGasEstimation, err)
+	}
+
+	if estimated == transferGas && len(data) == 0 {
+		return estimated, estimated, nil
+	}
+
+	return estimated, estimated + estimated*gasLimitMargin()/100, nil
+}
+
+// EstimateTransaction estimates a transaction from an account, the
+// selected one if empty, with fee tiers drawn from recent blocks.
+func EstimateTransaction(chain *Chain, account, toAddress string, value *big.Int, data []byte) (*FeeEstimate, error) {
+	ctx := context.Background()
+
+	if !common.IsHexAddress(toAddress) {
+		return nil, errors.New("invalid recipient address")
+	}
+	fromAddress, err := AccountAddress(account)
+	if err != nil {
+		return nil, err
+	}
+	from, to := common.HexToAddress(fromAddress), common.HexToAddress(toAddress)
+
+	estimated, gasLimit, err := estimateGasLimit(ctx, chain, from, to, value, data)
+	if err != nil {
+		return nil, err
+	}
+
+	estimate := &FeeEstimate{
+		ChainID:   chain.ID.Uint64(),
+		From:      from.Hex(),
+		To:        to.Hex(),
+		Estimated: estimated,
+		GasLimit:  gasLimit,
+	}
+	if gasLimit != estimated {
+		estimate.MarginPercent = gasLimitMargin()
+	}
+
+	header, err := chain.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if header.BaseFee == nil {
+		estimate.Tiers, err = legacyFeeTiers(ctx, chain, gasLimit)
+	} else {
+		estimate.BaseFee = header.BaseFee.String()
+		estimate.Tiers, err = dynamicFeeTiers(ctx, chain, gasLimit, header.BaseFee)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return estimate, nil
+}
+
+func legacyFeeTiers(ctx context.Context, chain *Chain, gasLimit uint64) ([]FeeTier, error) {
+	suggested, err := chain.currentGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tiers := make([]FeeTier, len(feeTierNames))
+	for i, name := range feeTierNames {
+		gasPrice := new(big.Int).Mul(suggested, big.NewInt(feeTierScales[i]))
+		gasPrice.Div(gasPrice, big.NewInt(100))
+		tiers[i] = FeeTier{
+			Name:     name,
+			GasPrice: gasPrice.String(),
+			Fee:      newBalance(gasCost(gasPrice, gasLimit)),
+		}
+	}
+
+	return tiers, nil
+}
+
+// dynamicFeeTiers takes each tier's tip from the percentiles of recent
+// blocks' tips, the node's suggestion where it keeps no fee history, and
+// caps its fee as dynamicFees does.
+func dynamicFeeTiers(ctx context.Context, chain *Chain, gasLimit uint64, baseFee *big.Int) ([]FeeTier, error) {
+	tips := make([]*big.Int, len(feeTierNames))
+	if history, err := chain.client.FeeHistory(ctx, feeHistoryBlocks, nil, feeTierPercentiles); err == nil && len(history.Reward) > 0 {
+		for i := range tips {
+			sum := new(big.Int)
+			for _, rewards := range history.Reward {
+				if i < len(rewards) {
+					sum.Add(sum, rewards[i])
+				}
+			}
+			tips[i] = sum.Div(sum, big.NewInt(int64(len(history.Reward))))
+		}
+	} else {
+		suggested, err := chain.client.SuggestGasTipCap(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i := range tips {
+			tips[i] = new(big.Int).Mul(suggested, big.NewInt(feeTierScales[i]))
+			tips[i].Div(tips[i], big.NewInt(100))
+		}
+	}
+
+	tiers := make([]FeeTier, len(feeTierNames))
+	for i, name := range feeTierNames {
+		gasPrice := new(big.Int).Add(baseFee, tips[i])
+		feeCap := new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tips[i])
+		maxFee := newBalance(gasCost(feeCap, gasLimit))
+		tiers[i] = FeeTier{
+			Name:                 name,
+			GasPrice:             gasPrice.String(),
+			MaxFeePerGas:         feeCap.String(),
+			MaxPriorityFeePerGas: tips[i].String(),
+			Fee:                  newBalance(gasCost(gasPrice, gasLimit)),
+			MaxFee:               &maxFee,
+		}
+	}
+
+	return tiers, nil
+}
+
+func gasCost(gasPrice *big.Int, gasLimit uint64) *big.Int {
+	return new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))
+}
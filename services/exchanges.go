@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// WarningExchangeMemoMissing flags a send to a known exchange deposit
+// address that needs a memo, without one.
+const WarningExchangeMemoMissing = "exchange_memo_missing"
+
+// ExchangeAddress is a deposit address an exchange shares among its
+// customers, which credits a deposit by its memo or destination tag. A
+// deposit without one is not credited to anyone and is usually recovered,
+// if at all, only by a support request. MemoPattern, if set, is a regular
+// expression the memo must match, such as ^[0-9]{1,10}$ for numeric tags.
+type ExchangeAddress struct {
+	Address      string    `json:"address"`
+	Name         string    `json:"name"`
+	ChainID      uint64    `json:"chain_id,omitempty"`
+	RequiresMemo bool      `json:"requires_memo"`
+	MemoPattern  string    `json:"memo_pattern,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// DestinationWarning flags a destination that a send can still go to, but
+// that the caller should look at.
+type DestinationWarning struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Exchange string `json:"exchange,omitempty"`
+}
+
+var (
+	exchangesFile = "exchange_addresses.json"
+	exchangesMu   sync.Mutex
+)
+
+var (
+	ErrExchangeNotFound   = errors.New("exchange address not found")
+	ErrInvalidExchange    = errors.New("invalid exchange address")
+	ErrExchangeMemoNeeded = fmt.Errorf("%w: a memo or destination tag is required for this exchange deposit address", ErrPolicyViolation)
+)
+
+func ListExchangeAddresses() ([]*ExchangeAddress, error) {
+	exchangesMu.Lock()
+	defer exchangesMu.Unlock()
+
+	return readExchanges()
+}
+
+// SaveExchangeAddress adds an exchange address, or replaces the entry for
+// the same address and chain.
+func SaveExchangeAddress(exchange ExchangeAddress) (*ExchangeAddress, error) {
+	if !common.IsHexAddress(exchange.Address) {
+		return nil, fmt.Errorf("%w: %q is not an address", ErrInvalidExchange, exchange.Address)
+	}
+	if strings.TrimSpace(exchange.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidExchange)
+	}
+	if exchange.MemoPattern != "" {
+		if _, err := regexp.Compile(exchange.MemoPattern); err != nil {
+			return nil, fmt.Errorf("%w: memo_pattern: %v", ErrInvalidExchange, err)
+		}
+	}
+	exchange.Address = common.HexToAddress(exchange.Address).Hex()
+	exchange.CreatedAt = time.Now().UTC()
+
+	exchangesMu.Lock()
+	defer exchangesMu.Unlock()
+
+	exchanges, err := readExchanges()
+	if err != nil {
+		return nil, err
+	}
+
+	kept := exchanges[:0]
+	for _, existing := range exchanges {
+		if existing.Address != exchange.Address || existing.ChainID != exchange.ChainID {
+			kept = append(kept, existing)
+		}
+	}
+	kept = append(kept, &exchange)
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Name < kept[j].Name })
+
+	if err := writeJSONFile(exchangesFile, kept); err != nil {
+		return nil, err
+	}
+
+	return &exchange, nil
+}
+
+// DeleteExchangeAddress removes an address's entries on every chain.
+func DeleteExchangeAddress(address string) error {
+	exchangesMu.Lock()
+	defer exchangesMu.Unlock()
+
+	exchanges, err := readExchanges()
+	if err != nil {
+		return err
+	}
+
+	kept := exchanges[:0]
+	for _, existing := range exchanges {
+		if !strings.EqualFold(existing.Address, address) {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) == len(exchanges) {
+		return ErrExchangeNotFound
+	}
+
+	return writeJSONFile(exchangesFile, kept)
+}
+
+// CheckDestination looks the recipient up among the known exchange
+// addresses. A memo that does not match the exchange's pattern is refused;
+// a missing one is refused when the policy sets require_exchange_memo, and
+// otherwise comes back as a warning.
+func CheckDestination(chain *Chain, to, memo string) ([]DestinationWarning, error) {
+	exchangesMu.Lock()
+	exchanges, err := readExchanges()
+	exchangesMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var exchange *ExchangeAddress
+	for _, candidate := range exchanges {
+		if strings.EqualFold(candidate.Address, to) && (candidate.ChainID == 0 || candidate.ChainID == chain.ID.Uint64()) {
+			exchange = candidate
+			break
+		}
+	}
+	if exchange == nil {
+		return nil, nil
+	}
+
+	if memo != "" {
+		if exchange.MemoPattern != "" && !regexp.MustCompile(exchange.MemoPattern).MatchString(memo) {
+			return nil, fmt.Errorf("%w: %s expects a memo matching %s", ErrInvalidMemo, exchange.Name, exchange.MemoPattern)
+		}
+		return nil, nil
+	}
+	if !exchange.RequiresMemo {
+		return nil, nil
+	}
+
+	policy, err := GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if policy.RequireExchangeMemo {
+		return nil, fmt.Errorf("%w (%s)", ErrExchangeMemoNeeded, exchange.Name)
+	}
+
+	return []DestinationWarning{{
+		Code:     WarningExchangeMemoMissing,
+		Message:  fmt.Sprintf("%s credits deposits to this address by memo or destination tag, and none was given", exchange.Name),
+		Exchange: exchange.Name,
+	}}, nil
+}
+
+func readExchanges() ([]*ExchangeAddress, error) {
+	var exchanges []*ExchangeAddress
+	if err := readJSONFile(exchangesFile, &exchanges); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return exchanges, nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	defaultExplorerAPIURL = "https://api.etherscan.io/v2/api"
+	contractInfoTTL       = 10 * time.Minute
+)
+
+// ContractInfo is what the block explorer knows about a contract. Verified
+// means its source has been published and matched against the bytecode.
+type ContractInfo struct {
+	Address  string `json:"address"`
+	Verified bool   `json:"verified"`
+	Name     string `json:"name,omitempty"`
+	Error    string `json:"lookup_error,omitempty"`
+}
+
+var (
+	explorerClient = &http.Client{Timeout: 15 * time.Second}
+
+	contractInfoMu    sync.Mutex
+	contractInfoCache = map[contractKey]cachedContractInfo{}
+)
+
+type contractKey struct {
+	chainID string
+	address common.Address
+}
+
+type cachedContractInfo struct {
+	info    ContractInfo
+	fetched time.Time
+}
+
+// isContract reports whether address has code deployed, and records the
+// answer for cross-chain checks.
+func isContract(ctx context.Context, chain *Chain, address common.Address) (bool, error) {
+	code, err := chain.client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return false, err
+	}
+
+	observeAddress(chain, address, len(code) > 0)
+	return len(code) > 0, nil
+}
+
+// LookupContract queries the Etherscan-compatible explorer configured by
+// EXPLORER_API_URL and EXPLORER_API_KEY. Verified results are cached for the
+// life of the process since verification cannot be undone.
+func LookupContract(ctx context.Context, chain *Chain, address common.Address) (*ContractInfo, error) {
+	key := contractKey{chainID: chain.ID.String(), address: address}
+
+	contractInfoMu.Lock()
+	cached, ok := contractInfoCache[key]
+	contractInfoMu.Unlock()
+	if ok && (cached.info.Verified || time.Since(cached.fetched) < contractInfoTTL) {
+		info := cached.info
+		return &info, nil
+	}
+
+	apiURL := os.Getenv("EXPLORER_API_URL")
+	if apiURL == "" {
+		apiURL = defaultExplorerAPIURL
+	}
+
+	query := url.Values{}
+	query.Set("chainid", chain.ID.String())
+	query.Set("module", "contract")
+	query.Set("action", "getsourcecode")
+	query.Set("address", address.Hex())
+	if key := os.Getenv("EXPLORER_API_KEY"); key != "" {
+		query.Set("apikey", key)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := explorerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("explorer lookup failed: %s", resp.Status)
+	}
+
+	var body struct {
+		Status string          `json:"status"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	// On errors the explorer returns status "0" and a string result.
+	var sources []struct {
+		SourceCode   string `json:"SourceCode"`
+		ContractName string `json:"ContractName"`
+	}
+	if body.Status != "1" || json.Unmarshal(body.Result, &sources) != nil || len(sources) == 0 {
+		var message string
+		json.Unmarshal(body.Result, &message)
+		return nil, fmt.Errorf("explorer lookup failed: %s", message)
+	}
+
+	info := ContractInfo{
+		Address:  address.Hex(),
+		Verified: sources[0].SourceCode != "",
+		Name:     sources[0].ContractName,
+	}
+
+	contractInfoMu.Lock()
+	contractInfoCache[key] = cachedContractInfo{info: info, fetched: time.Now()}
+	contractInfoMu.Unlock()
+
+	return &info, nil
+}
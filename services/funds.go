@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jabbala-dev/go-wallet/models"
+)
+
+// InsufficientFundsError is returned before signing when the account cannot
+// cover the value plus the maximum network fee.
+type InsufficientFundsError struct {
+	Balance  *big.Int
+	Required *big.Int
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("insufficient funds for value and network fee: balance %s, required %s, shortfall %s",
+		e.Balance, e.Required, e.Shortfall())
+}
+
+func (e *InsufficientFundsError) Shortfall() *big.Int {
+	return new(big.Int).Sub(e.Required, e.Balance)
+}
+
+// Balance is an amount of ether in wei, gwei and ether.
+type Balance = models.Balance
+
+// AccountBalance is an address's balance as of the latest block, and with
+// its transactions still in the node's mempool applied.
+type AccountBalance struct {
+	Address   string  `json:"address"`
+	ChainID   uint64  `json:"chain_id"`
+	Confirmed Balance `json:"confirmed"`
+	Pending   Balance `json:"pending"`
+}
+
+// GetBalance returns an address's confirmed and pending balance on chain.
+func GetBalance(chain *Chain, address string) (*AccountBalance, error) {
+	if !common.IsHexAddress(address) {
+		return nil, errors.New("invalid address")
+	}
+	account := common.HexToAddress(address)
+
+	confirmed, err := chain.client.BalanceAt(context.Background(), account, nil)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := chain.client.PendingBalanceAt(context.Background(), account)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccountBalance{
+		Address:   account.Hex(),
+		ChainID:   chain.ID.Uint64(),
+		Confirmed: newBalance(confirmed),
+		Pending:   newBalance(pending),
+	}, nil
+}
+
+func newBalance(wei *big.Int) Balance {
+	return Balance{
+		Wei:   wei.String(),
+		Gwei:  FormatTokenAmount(wei, 9),
+		Ether: FormatTokenAmount(wei, 18),
+	}
+}
+
+// checkFunds verifies from holds at least value + gasLimit*gasPrice.
+func checkFunds(ctx context.Context, chain *Chain, from common.Address, value *big.Int, gasLimit uint64, gasPrice *big.Int) error {
+	required := new(big.Int)
+	if value != nil {
+		required.Set(value)
+	}
+	if gasPrice != nil {
+		required.Add(required, new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit)))
+	}
+	if required.Sign() == 0 {
+		return nil
+	}
+
+	balance, err := chain.client.BalanceAt(ctx, from, nil)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(required) < 0 {
+		return &InsufficientFundsError{Balance: balance, Required: required}
+	}
+
+	return nil
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// maxHardwareAddresses bounds how many addresses one derivation lists, each
+// being a round trip to the device.
+const maxHardwareAddresses = 20
+
+// HardwareDevice is a hardware wallet plugged in over USB. URL identifies
+// it while it stays on the same port. Status is the driver's, such as the
+// Ethereum app's version once opened, or "Closed".
+type HardwareDevice struct {
+	URL    string `json:"url"`
+	Vendor string `json:"vendor"`
+	Status string `json:"status"`
+}
+
+// HardwareAddress is an address of a hardware wallet at a BIP-32 path.
+type HardwareAddress struct {
+	Path    string `json:"path"`
+	Address string `json:"address"`
+}
+
+// HardwareAccount is a hardware wallet address registered as an account.
+// Only the vendor and path are kept, not the device: any connected device
+// of the vendor that derives the address at the path signs for it, so the
+// device can be plugged into another port, or replaced by one restored from
+// the same seed.
+type HardwareAccount struct {
+	Address   string    `json:"address"`
+	Vendor    string    `json:"vendor"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var (
+	hardwareAccountsFile = "hardware_accounts.json"
+	hardwareMu           sync.Mutex
+
+	usbHubsOnce sync.Once
+	usbHubs     []*usbwallet.Hub
+)
+
+var (
+	ErrHardwareUnsupported    = errors.New("USB hardware wallets are not supported by this build")
+	ErrDeviceNotConnected     = errors.New("hardware wallet not connected")
+	ErrHardwareAccount        = errors.New("the account's key is on a hardware wallet")
+	ErrInvalidHardwareRequest = errors.New("invalid hardware wallet request")
+	ErrHardwareNeedsUnlock    = errors.New("the hardware wallet needs its PIN or passphrase")
+	ErrHardwareNotSupported   = errors.New("hardware wallets only sign transactions")
+)
+
+// ListHardwareDevices lists the Ledger and Trezor devices plugged in.
+func ListHardwareDevices() ([]HardwareDevice, error) {
+	wallets, err := hardwareWallets()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []HardwareDevice{}
+	for _, wallet := range wallets {
+		status, err := wallet.Status()
+		if err != nil {
+			status = err.Error()
+		}
+		devices = append(devices, HardwareDevice{
+			URL:    wallet.URL().String(),
+			Vendor: wallet.URL().Scheme,
+			Status: status,
+		})
+	}
+
+	return devices, nil
+}
+
+// DeriveHardwareAddresses lists count addresses of a device, the only one
+// connected if device is empty, from base, m/44'/60'/0'/0/0 if empty, on
+// through the following indexes. pin opens a Trezor that asks for one; it
+// is the digits of the positions pressed on the device's scrambled keypad.
+func DeriveHardwareAddresses(device, base, pin string, count int) ([]HardwareAddress, error) {
+	if count <= 0 {
+		count = 1
+	}
+	if count > maxHardwareAddresses {
+		return nil, fmt.Errorf("%w: at most %d addresses can be derived at once", ErrInvalidHardwareRequest, maxHardwareAddresses)
+	}
+	path, err := hardwarePath(base)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := openHardwareWallet(device, pin)
+	if err != nil {
+		return nil, err
+	}
+
+	next := accounts.DefaultIterator(path)
+	addresses := make([]HardwareAddress, 0, count)
+	for i := 0; i < count; i++ {
+		path := next()
+		account, err := wallet.Derive(path, false)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, HardwareAddress{Path: path.String(), Address: account.Address.Hex()})
+	}
+
+	return addresses, nil
+}
+
+// AddHardwareAccount registers the address at path of a device, the only
+// one connected if device is empty, as an account, without selecting it.
+// Sends from it are then signed on the device.
+func AddHardwareAccount(device, path, pin, name string) (Account, *HardwareAccount, error) {
+	derivationPath, err := hardwarePath(path)
+	if err != nil {
+		return Account{}, nil, err
+	}
+	wallet, err := openHardwareWallet(device, pin)
+	if err != nil {
+		return Account{}, nil, err
+	}
+	derived, err := wallet.Derive(derivationPath, false)
+	if err != nil {
+		return Account{}, nil, err
+	}
+
+	hardware := &HardwareAccount{
+		Address:   derived.Address.Hex(),
+		Vendor:    wallet.URL().Scheme,
+		Path:      derivationPath.String(),
+		CreatedAt: time.Now().UTC(),
+	}
+	if name == "" {
+		name = fmt.Sprintf("%s %s", hardware.Vendor, hardware.Path)
+	}
+
+	account, err := addAccountEntry(name, derived.Address, false, func() error {
+		hardwareMu.Lock()
+		defer hardwareMu.Unlock()
+
+		registered, err := readHardwareAccounts()
+		if err != nil {
+			return err
+		}
+		return writeJSONFile(hardwareAccountsFile, append(registered, hardware))
+	})
+	if err != nil {
+		return Account{}, nil, err
+	}
+
+	recordAudit("account.hardware", fmt.Sprintf("Added %s at %s on a %s", hardware.Address, hardware.Path, hardware.Vendor),
+		map[string]interface{}{"address": hardware.Address, "vendor": hardware.Vendor, "path": hardware.Path})
+	return account, hardware, nil
+}
+
+func ListHardwareAccounts() ([]*HardwareAccount, error) {
+	hardwareMu.Lock()
+	defer hardwareMu.Unlock()
+
+	registered, err := readHardwareAccounts()
+	if err != nil {
+		return nil, err
+	}
+	if registered == nil {
+		registered = []*HardwareAccount{}
+	}
+
+	return registered, nil
+}
+
+// hardwareSigner returns the signer of a hardware account, or nil if
+// address is not one. The device must be connected and open.
+func hardwareSigner(address common.Address) (Signer, error) {
+	hardware, err := findHardwareAccount(address)
+	if hardware == nil || err != nil {
+		return nil, err
+	}
+	path, err := accounts.ParseDerivationPath(hardware.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets, err := hardwareWallets()
+	if err != nil {
+		return nil, err
+	}
+	var openErr error
+	for _, wallet := range wallets {
+		if wallet.URL().Scheme != hardware.Vendor {
+			continue
+		}
+		if err := openWallet(wallet, ""); err != nil {
+			openErr = err
+			continue
+		}
+		// Pinning the path lets the wallet sign for the address.
+		account, err := wallet.Derive(path, true)
+		if err != nil || account.Address != address {
+			continue
+		}
+		return deviceSigner{wallet: wallet, account: account}, nil
+	}
+	// A Trezor still locked may well be the one, so say it needs unlocking.
+	if errors.Is(openErr, ErrHardwareNeedsUnlock) {
+		return nil, openErr
+	}
+
+	return nil, fmt.Errorf("%w: no connected %s derives %s at %s", ErrDeviceNotConnected, hardware.Vendor, address.Hex(), hardware.Path)
+}
+
+type deviceSigner struct {
+	wallet  accounts.Wallet
+	account accounts.Account
+}
+
+func (s deviceSigner) Address() common.Address {
+	return s.account.Address
+}
+
+// SignTx blocks until the transaction is confirmed or rejected on the
+// device.
+func (s deviceSigner) SignTx(chainID *big.Int, tx *types.Transaction) (*types.Transaction, error) {
+	return s.wallet.SignTx(s.account, tx, chainID)
+}
+
+// SignHash fails: the devices' Ethereum apps sign transactions and typed
+// data they can show, never a bare hash.
+func (s deviceSigner) SignHash(hash []byte) ([]byte, error) {
+	return nil, ErrHardwareNotSupported
+}
+
+// hardwareWallets lists the connected devices of every vendor. The USB
+// hubs are started on first use and then track devices being plugged in
+// and out.
+func hardwareWallets() ([]accounts.Wallet, error) {
+	usbHubsOnce.Do(func() {
+		for _, newHub := range []func() (*usbwallet.Hub, error){
+			usbwallet.NewLedgerHub, usbwallet.NewTrezorHubWithHID, usbwallet.NewTrezorHubWithWebUSB,
+		} {
+			if hub, err := newHub(); err == nil {
+				usbHubs = append(usbHubs, hub)
+			}
+		}
+	})
+	if len(usbHubs) == 0 {
+		return nil, ErrHardwareUnsupported
+	}
+
+	var wallets []accounts.Wallet
+	for _, hub := range usbHubs {
+		wallets = append(wallets, hub.Wallets()...)
+	}
+
+	return wallets, nil
+}
+
+// openHardwareWallet opens the device at url, or the only one connected if
+// url is empty.
+func openHardwareWallet(url, pin string) (accounts.Wallet, error) {
+	wallets, err := hardwareWallets()
+	if err != nil {
+		return nil, err
+	}
+
+	var wallet accounts.Wallet
+	switch {
+	case url != "":
+		for _, candidate := range wallets {
+			if candidate.URL().String() == url {
+				wallet = candidate
+			}
+		}
+		if wallet == nil {
+			return nil, fmt.Errorf("%w: %s", ErrDeviceNotConnected, url)
+		}
+	case len(wallets) == 0:
+		return nil, ErrDeviceNotConnected
+	case len(wallets) > 1:
+		return nil, fmt.Errorf("%w: %d devices are connected, so one must be chosen", ErrInvalidHardwareRequest, len(wallets))
+	default:
+		wallet = wallets[0]
+	}
+
+	if err := openWallet(wallet, pin); err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+// openWallet opens a device, which stays open until it is unplugged.
+func openWallet(wallet accounts.Wallet, pin string) error {
+	err := wallet.Open(pin)
+	switch {
+	case err == nil, errors.Is(err, accounts.ErrWalletAlreadyOpen):
+		return nil
+	case errors.Is(err, usbwallet.ErrTrezorPINNeeded), errors.Is(err, usbwallet.ErrTrezorPassphraseNeeded):
+		return fmt.Errorf("%w: %v", ErrHardwareNeedsUnlock, err)
+	}
+
+	return err
+}
+
+// hardwarePath parses a derivation path, m/44'/60'/0'/0/0 if empty.
+func hardwarePath(path string) (accounts.DerivationPath, error) {
+	if path == "" {
+		return accounts.DefaultBaseDerivationPath, nil
+	}
+	parsed, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: derivation path %q: %v", ErrInvalidHardwareRequest, path, err)
+	}
+
+	return parsed, nil
+}
+
+func findHardwareAccount(address common.Address) (*HardwareAccount, error) {
+	hardwareMu.Lock()
+	defer hardwareMu.Unlock()
+
+	registered, err := readHardwareAccounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, hardware := range registered {
+		if common.HexToAddress(hardware.Address) == address {
+			return hardware, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func readHardwareAccounts() ([]*HardwareAccount, error) {
+	var registered []*HardwareAccount
+	if err := readJSONFile(hardwareAccountsFile, &registered); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return registered, nil
+}
@@ -0,0 +1,546 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jabbala-dev/go-wallet/hdwallet"
+)
+
+// HDAccount is a BIP-44 account. A seed-backed one keeps its seed under
+// keys/, encrypted with its password, and each address derived from it is a
+// signing account; a watch-only one holds only the xpub, and its addresses
+// are watch-only accounts.
+type HDAccount struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	XPub      string      `json:"xpub"`
+	Path      string      `json:"path,omitempty"`
+	WatchOnly bool        `json:"watch_only"`
+	Addresses []HDAddress `json:"addresses"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type HDAddress struct {
+	Index   uint32 `json:"index"`
+	Address string `json:"address"`
+
+	// ActiveOn lists the chain IDs on which a scan found activity.
+	ActiveOn []uint64 `json:"active_on,omitempty"`
+}
+
+var (
+	hdAccountsFile = "hd_accounts.json"
+	hdMu           sync.Mutex
+)
+
+var (
+	ErrHDAccountNotFound = errors.New("HD account not found")
+	ErrInvalidXPub       = errors.New("invalid xpub")
+	ErrWatchOnly         = errors.New("watch-only accounts cannot sign")
+	ErrHDIndexNotDerived = errors.New("address index has not been derived")
+)
+
+// hdSeedFile is a seed encrypted as a V3 keystore encrypts a key: with
+// scrypt under a password, and AES-128-CTR.
+type hdSeedFile struct {
+	Crypto  keystore.CryptoJSON `json:"crypto"`
+	Version int                 `json:"version"`
+}
+
+// CreateHDAccount creates an HD account with a new seed, encrypted under
+// password.
+func CreateHDAccount(name, password string) (*HDAccount, error) {
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+
+	return newSeededHDAccount(name, seed, password)
+}
+
+func newSeededHDAccount(name string, seed []byte, password string) (*HDAccount, error) {
+	sealed, err := encryptSeed(seed, password)
+	if err != nil {
+		return nil, err
+	}
+	master, err := hdwallet.NewMaster(seed)
+	if err != nil {
+		return nil, err
+	}
+	account, err := master.Derive(hdwallet.DefaultAccountPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hd := &HDAccount{
+		ID:        newID(),
+		Name:      name,
+		XPub:      account.Neuter().String(),
+		Path:      hdwallet.DefaultAccountPath,
+		Addresses: []HDAddress{},
+		CreatedAt: time.Now().UTC(),
+	}
+	if hd.Name == "" {
+		hd.Name = "HD " + hd.ID[:8]
+	}
+
+	if err := os.MkdirAll(keysDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(hdSeedPath(hd.ID), sealed, 0600); err != nil {
+		return nil, err
+	}
+
+	if err := appendHDAccount(hd); err != nil {
+		return nil, err
+	}
+
+	return hd, nil
+}
+
+// ImportXPub adds a watch-only HD account. Only public keys are accepted so
+// no private material ever reaches the server this way.
+func ImportXPub(name, xpub string) (*HDAccount, error) {
+	key, err := hdwallet.ParseExtendedKey(xpub)
+	if err != nil {
+		return nil, ErrInvalidXPub
+	}
+	if key.IsPrivate() {
+		return nil, fmt.Errorf("%w: expected an extended public key, not a private one", ErrInvalidXPub)
+	}
+
+	hd := &HDAccount{
+		ID:        newID(),
+		Name:      name,
+		XPub:      key.String(),
+		WatchOnly: true,
+		Addresses: []HDAddress{},
+		CreatedAt: time.Now().UTC(),
+	}
+	if hd.Name == "" {
+		hd.Name = "Watch-only " + hd.ID[:8]
+	}
+
+	if err := appendHDAccount(hd); err != nil {
+		return nil, err
+	}
+
+	return hd, nil
+}
+
+// WatchXPub imports xpub as a watch-only HD account and registers its first
+// receive address, so that the account is followed from the start. Later
+// addresses are registered as they are derived or found by a scan.
+func WatchXPub(name, xpub string) (*HDAccount, error) {
+	hd, err := ImportXPub(name, xpub)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := DeriveHDAddress(hd.ID); err != nil {
+		return nil, err
+	}
+
+	return GetHDAccount(hd.ID)
+}
+
+func ListHDAccounts() ([]*HDAccount, error) {
+	hdMu.Lock()
+	defer hdMu.Unlock()
+
+	return readHDAccounts()
+}
+
+func GetHDAccount(id string) (*HDAccount, error) {
+	hdMu.Lock()
+	defer hdMu.Unlock()
+
+	accounts, err := readHDAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	return findHDAccount(accounts, id)
+}
+
+// DeriveHDAddress derives the next receive address and registers it as an
+// account, a signing one for seed-backed accounts and a watch-only one
+// otherwise.
+func DeriveHDAddress(id string) (*HDAddress, error) {
+	hdMu.Lock()
+	defer hdMu.Unlock()
+
+	accounts, err := readHDAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	hd, err := findHDAccount(accounts, id)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := receiveChainKey(hd)
+	if err != nil {
+		return nil, err
+	}
+
+	index := uint32(len(hd.Addresses))
+	child, err := chain.Child(index)
+	if err != nil {
+		return nil, err
+	}
+	address := HDAddress{Index: index, Address: child.Address().Hex()}
+
+	if err := registerHDAddress(hd, child, index); err != nil {
+		return nil, err
+	}
+
+	hd.Addresses = append(hd.Addresses, address)
+	if err := writeJSONFile(hdAccountsFile, accounts); err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+// SignWithHDAddress signs a message, as SignMessage does, with the receive
+// address at index of a seed-backed account, whichever account is selected.
+// The address must have been derived already, so that it is one the wallet
+// knows about, and unlocked.
+func SignWithHDAddress(id string, index uint32, message, scheme string) (*HDAddress, string, error) {
+	hash, err := messageHash(message, scheme)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hd, err := GetHDAccount(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if hd.WatchOnly {
+		return nil, "", ErrWatchOnly
+	}
+
+	var address *HDAddress
+	for i := range hd.Addresses {
+		if hd.Addresses[i].Index == index {
+			address = &hd.Addresses[i]
+		}
+	}
+	if address == nil {
+		return nil, "", fmt.Errorf("%w: %d", ErrHDIndexNotDerived, index)
+	}
+
+	privateKey, err := loadAccountKey(address.Address)
+	if err != nil {
+		return nil, "", err
+	}
+
+	signature, err := signMessage(newKeySigner(privateKey), hash, scheme)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return address, signature, nil
+}
+
+// receiveChainKey returns the public external chain key of an HD account,
+// from its xpub, which derives addresses without the seed.
+func receiveChainKey(hd *HDAccount) (*hdwallet.ExtendedKey, error) {
+	xpub, err := hdwallet.ParseExtendedKey(hd.XPub)
+	if err != nil {
+		return nil, err
+	}
+
+	return receiveChain(xpub)
+}
+
+// hdChildKey derives the key of the receive address at index of a
+// seed-backed account from its seed.
+func hdChildKey(hd *HDAccount, seed []byte, index uint32) (*ecdsa.PrivateKey, error) {
+	master, err := hdwallet.NewMaster(seed)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := master.Derive(hd.Path + "/0")
+	if err != nil {
+		return nil, err
+	}
+	child, err := chain.Child(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return child.PrivateKey()
+}
+
+// receiveChain returns the external chain of an account-level xpub. An xpub
+// exported one level deeper (already the external chain) is used as is.
+func receiveChain(key *hdwallet.ExtendedKey) (*hdwallet.ExtendedKey, error) {
+	if key.Depth() >= 4 {
+		return key, nil
+	}
+
+	return key.Child(0)
+}
+
+// registerHDAddress adds a derived address to the accounts. No key file is
+// written: a seed-backed account's key is derived from the seed when the
+// address is unlocked.
+func registerHDAddress(hd *HDAccount, child *hdwallet.ExtendedKey, index uint32) error {
+	entry := Account{Name: fmt.Sprintf("%s #%d", hd.Name, index), Address: child.Address().Hex(), WatchOnly: hd.WatchOnly}
+	_, err := addBookEntry(entry, false, nil)
+	if err != nil && !errors.Is(err, ErrAccountExists) {
+		return err
+	}
+
+	return nil
+}
+
+// hdAddressKey returns the key of a registered address of a seed-backed
+// account whose seed predates encryption, ErrAccountLocked if the seed is
+// encrypted, as the key is then only held once unlocked, or nil if address
+// is not one.
+func hdAddressKey(address common.Address) (*ecdsa.PrivateKey, error) {
+	hd, index, err := hdAddressAccount(address)
+	if hd == nil || err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(hdSeedPath(hd.ID)); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAccountLocked, address.Hex())
+	}
+
+	seed, err := readPlaintextSeed(hd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return hdChildKey(hd, seed, index)
+}
+
+// hdAddressStorage reports how the seed of an address of a seed-backed
+// account is stored, or "" if address is not one.
+func hdAddressStorage(address common.Address) string {
+	hd, _, err := hdAddressAccount(address)
+	if hd == nil || err != nil {
+		return ""
+	}
+	if _, err := os.Stat(hdSeedPath(hd.ID)); err == nil {
+		return KeyStorageHD
+	}
+	if _, err := os.Stat(plaintextSeedPath(hd.ID)); err == nil {
+		return KeyStoragePlaintext
+	}
+
+	return ""
+}
+
+// unlockHDAddressKey decrypts the seed of an address of a seed-backed
+// account and derives the address's key. It fails with ErrNotInKeystore if
+// address is not one, or its seed is not encrypted.
+func unlockHDAddressKey(address common.Address, password string) (*ecdsa.PrivateKey, error) {
+	hd, index, err := hdAddressAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	if hd == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotInKeystore, address.Hex())
+	}
+	data, err := os.ReadFile(hdSeedPath(hd.ID))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotInKeystore, address.Hex())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := decryptSeed(data, password)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := hdChildKey(hd, seed, index)
+	if err != nil {
+		return nil, err
+	}
+	if addressOf(privateKey) != address {
+		return nil, fmt.Errorf("seed of HD account %s does not derive %s", hd.ID, address.Hex())
+	}
+
+	return privateKey, nil
+}
+
+// encryptHDAddressSeed moves the plain-text seed of an address's HD account
+// into an encrypted seed file under password. Every address of the account
+// is then locked until unlocked with it.
+func encryptHDAddressSeed(address common.Address, password string) error {
+	hd, _, err := hdAddressAccount(address)
+	if err != nil {
+		return err
+	}
+	if hd == nil {
+		return fmt.Errorf("%w: no key is held for %s", ErrAccountNotFound, address.Hex())
+	}
+	if _, err := os.Stat(hdSeedPath(hd.ID)); err == nil {
+		return ErrAlreadyEncrypted
+	}
+
+	seed, err := readPlaintextSeed(hd.ID)
+	if err != nil {
+		return err
+	}
+	sealed, err := encryptSeed(seed, password)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(hdSeedPath(hd.ID), sealed, 0600); err != nil {
+		return err
+	}
+
+	return os.Remove(plaintextSeedPath(hd.ID))
+}
+
+// hdAddressAccount finds the seed-backed account address was derived from,
+// and its index, or returns nil if address is not one.
+func hdAddressAccount(address common.Address) (*HDAccount, uint32, error) {
+	hdMu.Lock()
+	defer hdMu.Unlock()
+
+	accounts, err := readHDAccounts()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, hd := range accounts {
+		if hd.WatchOnly {
+			continue
+		}
+		for _, derived := range hd.Addresses {
+			if common.HexToAddress(derived.Address) == address {
+				return hd, derived.Index, nil
+			}
+		}
+	}
+
+	return nil, 0, nil
+}
+
+// encryptSeed seals a seed as hdSeedFile JSON. Like encryptKey, it is slow
+// by design.
+func encryptSeed(seed []byte, password string) ([]byte, error) {
+	if password == "" {
+		return nil, ErrPasswordRequired
+	}
+
+	scryptN, scryptP := keystoreScrypt()
+	sealed, err := keystore.EncryptDataV3(seed, []byte(password), scryptN, scryptP)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(hdSeedFile{Crypto: sealed, Version: 3})
+}
+
+func decryptSeed(data []byte, password string) ([]byte, error) {
+	var file hdSeedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	seed, err := keystore.DecryptDataV3(file.Crypto, password)
+	if errors.Is(err, keystore.ErrDecrypt) {
+		return nil, ErrWrongPassword
+	}
+
+	return seed, err
+}
+
+// readPlaintextSeed reads a seed stored in plain text before seeds were
+// encrypted.
+func readPlaintextSeed(id string) ([]byte, error) {
+	raw, err := readKeyFile(plaintextSeedPath(id))
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.DecodeString(strings.TrimSpace(string(raw)))
+}
+
+// findSeededHDAccount returns the seed-backed account with seed, or nil if
+// there is none.
+func findSeededHDAccount(seed []byte) (*HDAccount, error) {
+	master, err := hdwallet.NewMaster(seed)
+	if err != nil {
+		return nil, err
+	}
+	account, err := master.Derive(hdwallet.DefaultAccountPath)
+	if err != nil {
+		return nil, err
+	}
+	xpub := account.Neuter().String()
+
+	hdMu.Lock()
+	defer hdMu.Unlock()
+
+	accounts, err := readHDAccounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, hd := range accounts {
+		if !hd.WatchOnly && hd.XPub == xpub && hd.Path == hdwallet.DefaultAccountPath {
+			return hd, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func appendHDAccount(hd *HDAccount) error {
+	hdMu.Lock()
+	defer hdMu.Unlock()
+
+	accounts, err := readHDAccounts()
+	if err != nil {
+		return err
+	}
+
+	accounts = append(accounts, hd)
+	return writeJSONFile(hdAccountsFile, accounts)
+}
+
+func findHDAccount(accounts []*HDAccount, id string) (*HDAccount, error) {
+	for _, hd := range accounts {
+		if hd.ID == id {
+			return hd, nil
+		}
+	}
+
+	return nil, ErrHDAccountNotFound
+}
+
+func hdSeedPath(id string) string {
+	return filepath.Join(keysDir, "hd-"+id+".json")
+}
+
+func plaintextSeedPath(id string) string {
+	return filepath.Join(keysDir, "hd-"+id+".txt")
+}
+
+func readHDAccounts() ([]*HDAccount, error) {
+	var accounts []*HDAccount
+	if err := readJSONFile(hdAccountsFile, &accounts); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return accounts, nil
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jabbala-dev/go-wallet/hdwallet"
+)
+
+const (
+	// defaultGapLimit is the BIP-44 address gap limit: scanning stops after
+	// this many consecutive unused addresses.
+	defaultGapLimit = 20
+	maxGapLimit     = 1000
+
+	// maxScanAddresses stops a scan against a node that reports activity
+	// for every address.
+	maxScanAddresses = 10000
+)
+
+var gapLimit = defaultGapLimit
+
+func init() {
+	if raw := os.Getenv("HD_GAP_LIMIT"); raw != "" {
+		if limit, err := strconv.Atoi(raw); err == nil && limit > 0 && limit <= maxGapLimit {
+			gapLimit = limit
+		}
+	}
+}
+
+// HDScanResult reports what a restore scan found. Registered lists the funded
+// addresses that were added as signing accounts.
+type HDScanResult struct {
+	Account    *HDAccount  `json:"account"`
+	GapLimit   int         `json:"gap_limit"`
+	Scanned    int         `json:"scanned"`
+	Chains     []uint64    `json:"chains"`
+	Active     []HDAddress `json:"active"`
+	Registered []string    `json:"registered"`
+}
+
+// RestoreHDAccount restores an HD account from a mnemonic, its seed
+// encrypted under password, or a watch-only one from an xpub, and scans it
+// for used addresses.
+func RestoreHDAccount(name, mnemonic, passphrase, xpub, password string, limit int) (*HDScanResult, error) {
+	var (
+		hd  *HDAccount
+		err error
+	)
+	switch {
+	case mnemonic != "" && xpub != "":
+		return nil, errors.New("provide either a mnemonic or an xpub, not both")
+	case mnemonic != "":
+		hd, err = newSeededHDAccount(name, hdwallet.MnemonicToSeed(mnemonic, passphrase), password)
+	case xpub != "":
+		hd, err = ImportXPub(name, xpub)
+	default:
+		return nil, errors.New("a mnemonic or an xpub is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ScanHDAccount(hd.ID, limit)
+}
+
+// ScanHDAccount walks the receive chain of an HD account and checks every
+// address on each configured chain until limit consecutive addresses show no
+// activity. The account's address list is extended up to the last used
+// address, and funded addresses become accounts, watch-only ones for a
+// watch-only HD account. A limit of 0 uses HD_GAP_LIMIT.
+func ScanHDAccount(id string, limit int) (*HDScanResult, error) {
+	if limit <= 0 {
+		limit = gapLimit
+	}
+	if limit > maxGapLimit {
+		limit = maxGapLimit
+	}
+
+	hd, err := GetHDAccount(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	chains, err := chainRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := receiveChainKey(hd)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &HDScanResult{GapLimit: limit, Active: []HDAddress{}, Registered: []string{}}
+	for _, c := range chains {
+		result.Chains = append(result.Chains, c.ID.Uint64())
+	}
+
+	var derived []HDAddress
+	lastUsed := -1
+	for index, gap := uint32(0), 0; gap < limit && index < maxScanAddresses; index++ {
+		child, err := chain.Child(index)
+		if err != nil {
+			return nil, err
+		}
+
+		address := HDAddress{Index: index, Address: child.Address().Hex()}
+		funded := false
+		for _, c := range chains {
+			used, hasBalance, err := addressActivity(ctx, c.client, child.Address())
+			if err != nil {
+				return nil, err
+			}
+			if used {
+				address.ActiveOn = append(address.ActiveOn, c.ID.Uint64())
+			}
+			funded = funded || hasBalance
+		}
+		derived = append(derived, address)
+
+		if len(address.ActiveOn) == 0 {
+			gap++
+			continue
+		}
+
+		gap = 0
+		lastUsed = int(index)
+		result.Active = append(result.Active, address)
+
+		if funded {
+			if err := registerHDAddress(hd, child, index); err != nil {
+				return nil, err
+			}
+			result.Registered = append(result.Registered, address.Address)
+		}
+	}
+	result.Scanned = len(derived)
+
+	account, err := mergeScannedAddresses(id, derived, lastUsed+1)
+	if err != nil {
+		return nil, err
+	}
+	result.Account = account
+
+	return result, nil
+}
+
+// addressActivity reports whether an address has sent a transaction or holds
+// a balance on a chain.
+func addressActivity(ctx context.Context, client *rpcClient, address common.Address) (used, funded bool, err error) {
+	balance, err := client.BalanceAt(ctx, address, nil)
+	if err != nil {
+		return false, false, err
+	}
+
+	nonce, err := client.NonceAt(ctx, address, nil)
+	if err != nil {
+		return false, false, err
+	}
+
+	funded = balance.Sign() > 0
+	return funded || nonce > 0, funded, nil
+}
+
+// mergeScannedAddresses stores scan results for the first keep addresses,
+// leaving any addresses derived beyond them untouched.
+func mergeScannedAddresses(id string, derived []HDAddress, keep int) (*HDAccount, error) {
+	hdMu.Lock()
+	defer hdMu.Unlock()
+
+	accounts, err := readHDAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	hd, err := findHDAccount(accounts, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hd.Addresses) > keep {
+		keep = len(hd.Addresses)
+	}
+
+	addresses := make([]HDAddress, 0, keep)
+	for i := 0; i < keep; i++ {
+		if i < len(derived) {
+			addresses = append(addresses, derived[i])
+		} else {
+			addresses = append(addresses, hd.Addresses[i])
+		}
+	}
+	hd.Addresses = addresses
+
+	if err := writeJSONFile(hdAccountsFile, accounts); err != nil {
+		return nil, err
+	}
+
+	return hd, nil
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jabbala-dev/go-wallet/models"
+)
+
+const (
+	StatusQueued    = models.StatusQueued
+	StatusPending   = models.StatusPending
+	StatusConfirmed = models.StatusConfirmed
+	StatusFailed    = models.StatusFailed
+	StatusReplaced  = models.StatusReplaced
+)
+
+// TransactionRecord is a transaction in the history.
+type TransactionRecord = models.Transaction
+
+type TransactionFilter struct {
+	ChainID uint64
+	Address string
+	Status  string
+	Since   time.Time
+	Until   time.Time
+}
+
+var (
+	historyFile = "history.json"
+
+	// historyMu serializes changes to the history, whichever store holds
+	// it, so that events are queued in the order the changes are made.
+	historyMu sync.Mutex
+)
+
+// ListTransactions lists transactions newest first. Pending ones are
+// checked for a receipt on the way.
+func ListTransactions(filter TransactionFilter) ([]TransactionRecord, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	records, err := history.list(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []TransactionRecord
+	for _, record := range records {
+		if refreshPendingStatus(&record) {
+			if err := history.update(record); err != nil {
+				return nil, err
+			}
+		}
+		if filter.matches(record) {
+			matched = append(matched, record)
+		}
+	}
+
+	return matched, nil
+}
+
+// signedBy fills in what the record keeps of the signed transaction.
+func signedBy(r TransactionRecord, tx *types.Transaction) TransactionRecord {
+	nonce := tx.Nonce()
+	r.Nonce = &nonce
+	r.Gas = tx.Gas()
+	r.GasPrice = tx.GasPrice().String()
+	if len(tx.Data()) > 0 {
+		r.Data = hexutil.Encode(tx.Data())
+	}
+	return r
+}
+
+func recordTransaction(record TransactionRecord) error {
+	if err := record.Validate(); err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	enqueueEvent(EventTransactionSent, record.ChainID, []string{record.From, record.To}, record, outboxRef{Store: refHistory, Key: record.Hash})
+
+	return history.add(record)
+}
+
+// recordTransactionOnce records a transaction unless its hash is already in
+// the history.
+func recordTransactionOnce(record TransactionRecord) error {
+	if err := record.Validate(); err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	existing, err := history.get(record.Hash)
+	if err != nil || existing != nil {
+		return err
+	}
+
+	enqueueEvent(EventTransactionSent, record.ChainID, []string{record.From, record.To}, record, outboxRef{Store: refHistory, Key: record.Hash})
+
+	return history.add(record)
+}
+
+func setTransactionStatus(hash, status string) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	record, err := history.get(hash)
+	if err != nil || record == nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	record.Status = status
+	record.UpdatedAt = &now
+	if (status == StatusConfirmed || status == StatusFailed) && record.MinedAt == nil {
+		record.MinedAt = &now
+	}
+	enqueueStatusChange(*record)
+	return history.update(*record)
+}
+
+// readHistory returns every record. It must be called with historyMu held.
+func readHistory() ([]TransactionRecord, error) {
+	return history.list(TransactionFilter{})
+}
+
+// refreshPendingStatus fills in a pending record's receipt once it is mined
+// and moves it on to its final status once the block is confirmationDepth
+// deep, reporting whether it changed the record. A receipt that has gone,
+// as its block was reorganized away, is taken off again.
+func refreshPendingStatus(record *TransactionRecord) bool {
+	if record.Status != StatusPending {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	chain, err := chainByID(ctx, record.ChainID)
+	if err != nil {
+		return false
+	}
+
+	now := time.Now().UTC()
+	receipt, err := chain.client.TransactionReceipt(ctx, common.HexToHash(record.Hash))
+	if errors.Is(err, ethereum.NotFound) && record.BlockNumber != 0 {
+		record.GasUsed, record.EffectiveGasPrice, record.BlockNumber, record.MinedAt = 0, "", 0, nil
+		record.UpdatedAt = &now
+		return true
+	}
+	if errors.Is(err, ethereum.NotFound) && record.ReplacedBy != "" && record.Nonce != nil {
+		// A nonce mined without this transaction went to its
+		// replacement.
+		mined, err := chain.client.NonceAt(ctx, common.HexToAddress(record.From), nil)
+		if err != nil || mined <= *record.Nonce {
+			return false
+		}
+		record.Status = StatusReplaced
+		record.UpdatedAt = &now
+		return true
+	}
+	if err != nil || receipt.BlockNumber == nil {
+		return false
+	}
+	head, err := chain.client.BlockNumber(ctx)
+	if err != nil {
+		return false
+	}
+
+	changed := record.BlockNumber != receipt.BlockNumber.Uint64()
+	if changed {
+		record.GasUsed = receipt.GasUsed
+		if receipt.EffectiveGasPrice != nil {
+			record.EffectiveGasPrice = receipt.EffectiveGasPrice.String()
+		}
+		record.BlockNumber = receipt.BlockNumber.Uint64()
+		record.MinedAt = &now
+		if header, err := chain.client.HeaderByNumber(ctx, receipt.BlockNumber); err == nil {
+			mined := time.Unix(int64(header.Time), 0).UTC()
+			record.MinedAt = &mined
+		}
+		record.UpdatedAt = &now
+	}
+
+	if confirmations(head, record.BlockNumber) < ConfirmationDepth() {
+		return changed
+	}
+
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		record.Status = StatusConfirmed
+	} else {
+		record.Status = StatusFailed
+	}
+	record.UpdatedAt = &now
+	enqueueStatusChange(*record)
+
+	return true
+}
+
+// enqueueStatusChange queues the event for a transaction reaching a final
+// status. It must be called with historyMu held, before the change is
+// written.
+func enqueueStatusChange(record TransactionRecord) {
+	var eventType string
+	switch record.Status {
+	case StatusConfirmed:
+		eventType = EventTransactionConfirmed
+	case StatusFailed:
+		eventType = EventTransactionFailed
+	default:
+		return
+	}
+
+	ref := outboxRef{Store: refHistory, Key: record.Hash, Status: record.Status}
+	enqueueEvent(eventType, record.ChainID, []string{record.From, record.To}, record, ref)
+}
+
+func (f TransactionFilter) matches(record TransactionRecord) bool {
+	if f.ChainID != 0 && record.ChainID != f.ChainID {
+		return false
+	}
+	if f.Address != "" && !strings.EqualFold(record.From, f.Address) && !strings.EqualFold(record.To, f.Address) {
+		return false
+	}
+	if f.Status != "" && record.Status != f.Status {
+		return false
+	}
+	if !f.Since.IsZero() && record.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && record.CreatedAt.After(f.Until) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,492 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// The transaction history is kept in history.json unless
+// HISTORY_DATABASE_URL names a database: sqlite:path/to/history.db, or a
+// postgres:// URL. A database that is still empty when first opened takes
+// over the records in history.json, which is then renamed aside. Records are
+// kept whole as JSON, next to the columns they are looked up by. With data
+// encryption on, the JSON is sealed as data files are, and stored base64
+// encoded; the lookup columns stay in the clear.
+
+// historyStore holds the transaction history. Its methods are called with
+// historyMu held. list returns records newest first; get returns nil if no
+// record has the hash.
+type historyStore interface {
+	list(filter TransactionFilter) ([]TransactionRecord, error)
+	get(hash string) (*TransactionRecord, error)
+	add(record TransactionRecord) error
+	update(record TransactionRecord) error
+	remove(hashes []string) (int, error)
+}
+
+var history historyStore = versionedHistory{fileHistoryStore{}}
+
+// historyVersion counts the changes made to the history since start.
+var historyVersion uint64
+
+// HistoryVersion returns a number that changes whenever the history does,
+// so that a reader can tell nothing has changed since it last looked.
+func HistoryVersion() uint64 {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	return historyVersion
+}
+
+// versionedHistory counts the changes made through it in historyVersion.
+type versionedHistory struct {
+	historyStore
+}
+
+func (h versionedHistory) add(record TransactionRecord) error {
+	historyVersion++
+	return h.historyStore.add(record)
+}
+
+func (h versionedHistory) update(record TransactionRecord) error {
+	historyVersion++
+	return h.historyStore.update(record)
+}
+
+func (h versionedHistory) remove(hashes []string) (int, error) {
+	historyVersion++
+	return h.historyStore.remove(hashes)
+}
+
+// OpenHistoryStore opens the database HISTORY_DATABASE_URL names, if any.
+func OpenHistoryStore() error {
+	url := os.Getenv("HISTORY_DATABASE_URL")
+	if url == "" {
+		return nil
+	}
+
+	store, err := openSQLHistoryStore(url)
+	if err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if err := store.importFile(); err != nil {
+		return err
+	}
+	if err := store.encryptRecords(); err != nil {
+		return err
+	}
+	history = versionedHistory{store}
+	return nil
+}
+
+// fileHistoryStore is the history in one JSON file.
+type fileHistoryStore struct{}
+
+func (fileHistoryStore) list(filter TransactionFilter) ([]TransactionRecord, error) {
+	records, err := readHistoryFile()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []TransactionRecord
+	for _, record := range records {
+		if filter.matches(record) {
+			matched = append(matched, record)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	return matched, nil
+}
+
+func (fileHistoryStore) get(hash string) (*TransactionRecord, error) {
+	records, err := readHistoryFile()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		if strings.EqualFold(record.Hash, hash) {
+			return &record, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (fileHistoryStore) add(record TransactionRecord) error {
+	records, err := readHistoryFile()
+	if err != nil {
+		return err
+	}
+
+	return writeJSONFile(historyFile, append(records, record))
+}
+
+func (fileHistoryStore) update(record TransactionRecord) error {
+	records, err := readHistoryFile()
+	if err != nil {
+		return err
+	}
+
+	for i := range records {
+		if strings.EqualFold(records[i].Hash, record.Hash) {
+			records[i] = record
+			return writeJSONFile(historyFile, records)
+		}
+	}
+
+	return nil
+}
+
+func (fileHistoryStore) remove(hashes []string) (int, error) {
+	records, err := readHistoryFile()
+	if err != nil {
+		return 0, err
+	}
+
+	drop := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		drop[strings.ToLower(hash)] = true
+	}
+
+	kept := make([]TransactionRecord, 0, len(records))
+	for _, record := range records {
+		if !drop[strings.ToLower(record.Hash)] {
+			kept = append(kept, record)
+		}
+	}
+
+	return len(records) - len(kept), writeJSONFile(historyFile, kept)
+}
+
+func readHistoryFile() ([]TransactionRecord, error) {
+	var records []TransactionRecord
+	if err := readJSONFile(historyFile, &records); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// sqlHistoryStore is the history in a SQLite or PostgreSQL table. Hashes
+// and addresses are stored lowercased, and created_at in Unix nanoseconds,
+// so that both compare the same in either database.
+type sqlHistoryStore struct {
+	db *sql.DB
+}
+
+var historySchema = []string{
+	`CREATE TABLE IF NOT EXISTS transaction_history (
+		hash TEXT PRIMARY KEY,
+		chain_id BIGINT NOT NULL,
+		from_address TEXT NOT NULL,
+		to_address TEXT NOT NULL,
+		status TEXT NOT NULL,
+		created_at BIGINT NOT NULL,
+		record TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS transaction_history_created_at ON transaction_history (created_at)`,
+	`CREATE INDEX IF NOT EXISTS transaction_history_from ON transaction_history (from_address)`,
+	`CREATE INDEX IF NOT EXISTS transaction_history_to ON transaction_history (to_address)`,
+	`CREATE INDEX IF NOT EXISTS transaction_history_status ON transaction_history (status)`,
+}
+
+func openSQLHistoryStore(url string) (*sqlHistoryStore, error) {
+	driver, source := "", url
+	switch {
+	case strings.HasPrefix(url, "sqlite:"):
+		driver = "sqlite"
+		source = strings.TrimPrefix(strings.TrimPrefix(url, "sqlite:"), "//")
+		source += "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		driver = "postgres"
+	default:
+		return nil, fmt.Errorf("HISTORY_DATABASE_URL must start with sqlite: or postgres://")
+	}
+
+	db, err := sql.Open(driver, source)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite takes one writer at a time; with a single connection ours
+	// never wait on each other.
+	if driver == "sqlite" {
+		db.SetMaxOpenConns(1)
+	}
+
+	for _, statement := range historySchema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to prepare the history database: %w", err)
+		}
+	}
+
+	return &sqlHistoryStore{db: db}, nil
+}
+
+// importFile moves the records in history.json into an empty table.
+func (s *sqlHistoryStore) importFile() error {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM transaction_history`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	records, err := readHistoryFile()
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, record := range records {
+		if err := insertHistoryRecord(tx, record); err != nil {
+			return fmt.Errorf("failed to import %s: %w", record.Hash, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(historyFile, historyFile+".imported"); err != nil {
+		return err
+	}
+	log.Printf("imported %d transactions from %s into the history database", len(records), historyFile)
+	return nil
+}
+
+// encryptRecords seals the records still stored as plain JSON, once data
+// encryption is on.
+func (s *sqlHistoryStore) encryptRecords() error {
+	if dataCipher == nil {
+		return nil
+	}
+
+	rows, err := s.db.Query(`SELECT record FROM transaction_history WHERE record LIKE '{%'`)
+	if err != nil {
+		return err
+	}
+	var records []TransactionRecord
+	for rows.Next() {
+		record, err := scanHistoryRecord(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		records = append(records, *record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(records) == 0 {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, record := range records {
+		encoded, err := encodeHistoryRecord(record)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE transaction_history SET record = $1 WHERE hash = $2`, encoded, strings.ToLower(record.Hash)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("encrypted %d transactions in the history database at rest", len(records))
+	return nil
+}
+
+func (s *sqlHistoryStore) list(filter TransactionFilter) ([]TransactionRecord, error) {
+	var conditions []string
+	var args []interface{}
+	// where adds a condition, numbering its ? placeholders as $n, which
+	// both databases take.
+	where := func(condition string, values ...interface{}) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if filter.ChainID != 0 {
+		where("chain_id = ?", int64(filter.ChainID))
+	}
+	if filter.Address != "" {
+		address := strings.ToLower(filter.Address)
+		where("(from_address = ? OR to_address = ?)", address, address)
+	}
+	if filter.Status != "" {
+		where("status = ?", filter.Status)
+	}
+	if !filter.Since.IsZero() {
+		where("created_at >= ?", filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		where("created_at <= ?", filter.Until.UnixNano())
+	}
+
+	query := `SELECT record FROM transaction_history`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []TransactionRecord
+	for rows.Next() {
+		record, err := scanHistoryRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+
+	return records, rows.Err()
+}
+
+func (s *sqlHistoryStore) get(hash string) (*TransactionRecord, error) {
+	record, err := scanHistoryRecord(s.db.QueryRow(`SELECT record FROM transaction_history WHERE hash = $1`, strings.ToLower(hash)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return record, err
+}
+
+func (s *sqlHistoryStore) add(record TransactionRecord) error {
+	return insertHistoryRecord(s.db, record)
+}
+
+func (s *sqlHistoryStore) update(record TransactionRecord) error {
+	encoded, err := encodeHistoryRecord(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`UPDATE transaction_history SET status = $1, record = $2 WHERE hash = $3`,
+		record.Status, encoded, strings.ToLower(record.Hash))
+	return err
+}
+
+func (s *sqlHistoryStore) remove(hashes []string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	removed := 0
+	for _, hash := range hashes {
+		result, err := tx.Exec(`DELETE FROM transaction_history WHERE hash = $1`, strings.ToLower(hash))
+		if err != nil {
+			return 0, err
+		}
+		n, _ := result.RowsAffected()
+		removed += int(n)
+	}
+
+	return removed, tx.Commit()
+}
+
+// execer is a database or a transaction on one.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertHistoryRecord(db execer, record TransactionRecord) error {
+	encoded, err := encodeHistoryRecord(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT INTO transaction_history (hash, chain_id, from_address, to_address, status, created_at, record)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		strings.ToLower(record.Hash), int64(record.ChainID), strings.ToLower(record.From), strings.ToLower(record.To),
+		record.Status, record.CreatedAt.UnixNano(), encoded)
+	return err
+}
+
+// historyRecordData is bound into sealed records, as a data file's name is.
+const historyRecordData = "transaction_history"
+
+// encodeHistoryRecord returns a record's JSON, sealed and base64 encoded if
+// data encryption is on.
+func encodeHistoryRecord(record TransactionRecord) (string, error) {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	if dataCipher == nil {
+		return string(encoded), nil
+	}
+
+	sealed, err := sealData(historyRecordData, encoded)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func scanHistoryRecord(row interface{ Scan(...interface{}) error }) (*TransactionRecord, error) {
+	var encoded string
+	if err := row.Scan(&encoded); err != nil {
+		return nil, err
+	}
+
+	data := []byte(encoded)
+	if !strings.HasPrefix(encoded, "{") {
+		sealed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || !isEncrypted(sealed) {
+			return nil, errors.New("history record is neither JSON nor sealed")
+		}
+		if data, err = openData(historyRecordData, sealed); err != nil {
+			return nil, err
+		}
+	}
+
+	var record TransactionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
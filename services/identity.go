@@ -0,0 +1,71 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The identity key is an Ed25519 key used only to sign API responses. It is
+// separate from the wallet's account keys so provenance signatures can never
+// be mistaken for, or replayed as, transaction or message signatures.
+var (
+	identityKeyFile = "identity_key.txt"
+	identityMu      sync.Mutex
+	identityKey     ed25519.PrivateKey
+)
+
+func IdentityPublicKey() (ed25519.PublicKey, error) {
+	key, err := loadIdentityKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+func SignWithIdentity(payload []byte) ([]byte, error) {
+	key, err := loadIdentityKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519.Sign(key, payload), nil
+}
+
+func loadIdentityKey() (ed25519.PrivateKey, error) {
+	identityMu.Lock()
+	defer identityMu.Unlock()
+
+	if identityKey != nil {
+		return identityKey, nil
+	}
+
+	raw, err := readKeyFile(identityKeyFile)
+	if os.IsNotExist(err) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeKeyFile(identityKeyFile, []byte(hex.EncodeToString(key.Seed()))); err != nil {
+			return nil, err
+		}
+		identityKey = key
+		return identityKey, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("invalid identity key file")
+	}
+
+	identityKey = ed25519.NewKeyFromSeed(seed)
+	return identityKey, nil
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AlertHoneypotTripped = "honeypot_tripped"
+	AlertAuthFailures    = "repeated_auth_failures"
+)
+
+// defaultHoneypots are paths a scanner looking for a wallet's keys might
+// try. Nothing real is ever served on them.
+var defaultHoneypots = []string{
+	"/admin/export-keys",
+	"/admin/keys",
+	"/api/keys/export",
+	"/debug/keystore",
+	"/backup/wallet.json",
+	"/.env",
+}
+
+// Ban shuts a client out of every route until it expires.
+type Ban struct {
+	Client    string    `json:"client"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var (
+	bansFile = "bans.json"
+	bansMu   sync.Mutex
+	bans     map[string]*Ban
+
+	// banDuration, authFailureLimit and authFailureWindow are guarded by
+	// bansMu.
+	banDuration = defaultIntrusionSettings.banDuration
+
+	// authFailures holds recent failed authentications per client.
+	authFailures      = map[string][]time.Time{}
+	authFailureLimit  = defaultIntrusionSettings.failureLimit
+	authFailureWindow = defaultIntrusionSettings.failureWindow
+)
+
+var defaultIntrusionSettings = intrusionSettings{banDuration: 24 * time.Hour, failureLimit: 10, failureWindow: 5 * time.Minute}
+
+var ErrBanNotFound = errors.New("ban not found")
+
+// HoneypotPaths returns the decoy routes to register: HONEYPOT_PATHS, a
+// comma-separated list, or a default set when HONEYPOTS is true. It is empty
+// unless one of them is set.
+func HoneypotPaths() []string {
+	if raw := os.Getenv("HONEYPOT_PATHS"); raw != "" {
+		var paths []string
+		for _, path := range strings.Split(raw, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, "/"+strings.TrimPrefix(path, "/"))
+			}
+		}
+		return paths
+	}
+	if os.Getenv("HONEYPOTS") == "true" {
+		return defaultHoneypots
+	}
+
+	return nil
+}
+
+// intrusionSettings are BAN_DURATION, AUTH_FAILURE_LIMIT and
+// AUTH_FAILURE_WINDOW.
+type intrusionSettings struct {
+	banDuration   time.Duration
+	failureLimit  int
+	failureWindow time.Duration
+}
+
+// ConfigureIntrusionDetection reads BAN_DURATION, AUTH_FAILURE_LIMIT and
+// AUTH_FAILURE_WINDOW.
+func ConfigureIntrusionDetection() error {
+	configMu.Lock()
+	loaded := currentSettings
+	configMu.Unlock()
+
+	config, err := readIntrusionSettings(loaded)
+	if err != nil {
+		return err
+	}
+
+	applyIntrusionSettings(config)
+	return nil
+}
+
+func readIntrusionSettings(s settings) (intrusionSettings, error) {
+	config := defaultIntrusionSettings
+	if raw := s.get("BAN_DURATION"); raw != "" {
+		duration, err := time.ParseDuration(raw)
+		if err != nil || duration <= 0 {
+			return config, fmt.Errorf("BAN_DURATION %q is not a positive duration", raw)
+		}
+		config.banDuration = duration
+	}
+	if raw := s.get("AUTH_FAILURE_LIMIT"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return config, fmt.Errorf("AUTH_FAILURE_LIMIT %q is not a positive number", raw)
+		}
+		config.failureLimit = limit
+	}
+	if raw := s.get("AUTH_FAILURE_WINDOW"); raw != "" {
+		window, err := time.ParseDuration(raw)
+		if err != nil || window <= 0 {
+			return config, fmt.Errorf("AUTH_FAILURE_WINDOW %q is not a positive duration", raw)
+		}
+		config.failureWindow = window
+	}
+
+	return config, nil
+}
+
+// applyIntrusionSettings reports whether config changed anything. Bans
+// already in force keep their expiry.
+func applyIntrusionSettings(config intrusionSettings) bool {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+
+	changed := config.banDuration != banDuration || config.failureLimit != authFailureLimit || config.failureWindow != authFailureWindow
+	banDuration, authFailureLimit, authFailureWindow = config.banDuration, config.failureLimit, config.failureWindow
+	return changed
+}
+
+// TripHoneypot alerts on a request to a decoy route and bans the client.
+// A trusted proxy is not banned, since that would shut out everyone behind
+// it; the alert still names it.
+func TripHoneypot(client, method, path string) {
+	message := fmt.Sprintf("%s requested decoy route %s %s", client, method, path)
+	raiseAlert(AlertHoneypotTripped, "", message)
+
+	details := map[string]interface{}{"client": client, "method": method, "path": path}
+	if isTrustedProxy(client) {
+		details["banned"] = false
+		recordAudit("intrusion.honeypot", message+"; not banned: trusted proxy", details)
+		return
+	}
+
+	details["banned"] = true
+	recordAudit("intrusion.honeypot", message, details)
+	banClient(client, fmt.Sprintf("requested decoy route %s", path))
+}
+
+// RecordAuthFailure counts a failed authentication by client and raises an
+// alert when AUTH_FAILURE_LIMIT (default 10) fail within AUTH_FAILURE_WINDOW
+// (default five minutes). The count then starts again, so a sustained attack
+// raises one alert per limit reached rather than one per attempt.
+func RecordAuthFailure(client string) {
+	bansMu.Lock()
+	now, window := time.Now(), authFailureWindow
+	var recent []time.Time
+	for _, at := range authFailures[client] {
+		if now.Sub(at) < window {
+			recent = append(recent, at)
+		}
+	}
+	recent = append(recent, now)
+
+	tripped := len(recent) >= authFailureLimit
+	if tripped {
+		delete(authFailures, client)
+	} else {
+		authFailures[client] = recent
+	}
+	for other, attempts := range authFailures {
+		if now.Sub(attempts[len(attempts)-1]) >= window {
+			delete(authFailures, other)
+		}
+	}
+	bansMu.Unlock()
+
+	if !tripped {
+		return
+	}
+
+	message := fmt.Sprintf("%d failed authentications from %s within %s", len(recent), client, window)
+	raiseAlert(AlertAuthFailures, "", message)
+	recordAudit("intrusion.auth_failures", message, map[string]interface{}{"client": client, "failures": len(recent)})
+}
+
+func ListBans() ([]*Ban, error) {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+
+	if err := loadBans(); err != nil {
+		return nil, err
+	}
+
+	var active []*Ban
+	for _, ban := range bans {
+		if time.Now().Before(ban.ExpiresAt) {
+			active = append(active, ban)
+		}
+	}
+
+	return active, nil
+}
+
+// LiftBan lets a banned client back in before its ban expires.
+func LiftBan(client string) error {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+
+	if err := loadBans(); err != nil {
+		return err
+	}
+	if _, ok := bans[client]; !ok {
+		return ErrBanNotFound
+	}
+
+	delete(bans, client)
+	if err := writeBans(); err != nil {
+		return err
+	}
+
+	recordAudit("intrusion.ban_lifted", fmt.Sprintf("ban on %s lifted", client), map[string]interface{}{"client": client})
+	return nil
+}
+
+func banClient(client, reason string) {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+
+	if err := loadBans(); err != nil {
+		log.Printf("failed to ban %s: %v", client, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	bans[client] = &Ban{Client: client, Reason: reason, CreatedAt: now, ExpiresAt: now.Add(banDuration)}
+	if err := writeBans(); err != nil {
+		log.Printf("failed to save ban on %s: %v", client, err)
+	}
+}
+
+// activeBan returns the client's ban, or nil if it is not banned.
+func activeBan(client string) (*Ban, error) {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+
+	if err := loadBans(); err != nil {
+		return nil, err
+	}
+
+	ban, ok := bans[client]
+	if !ok || time.Now().After(ban.ExpiresAt) {
+		return nil, nil
+	}
+
+	return ban, nil
+}
+
+// loadBans reads the ban list on first use; afterwards the copy in memory
+// is authoritative. It must be called with bansMu held.
+func loadBans() error {
+	if bans != nil {
+		return nil
+	}
+
+	var stored []*Ban
+	if err := readJSONFile(bansFile, &stored); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	bans = map[string]*Ban{}
+	for _, ban := range stored {
+		bans[ban.Client] = ban
+	}
+
+	return nil
+}
+
+// writeBans saves the unexpired bans. It must be called with bansMu held.
+func writeBans() error {
+	stored := []*Ban{}
+	for client, ban := range bans {
+		if time.Now().After(ban.ExpiresAt) {
+			delete(bans, client)
+			continue
+		}
+		stored = append(stored, ban)
+	}
+
+	return writeJSONFile(bansFile, stored)
+}
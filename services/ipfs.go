@@ -0,0 +1,228 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PinStatusQueued = "queued"
+	PinStatusPinned = "pinned"
+	PinStatusFailed = "failed"
+
+	pinRetryInterval = 30 * time.Second
+	maxPinAttempts   = 10
+)
+
+type IPFSPin struct {
+	CID       string     `json:"cid"`
+	Name      string     `json:"name"`
+	Status    string     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	PinnedAt  *time.Time `json:"pinned_at,omitempty"`
+}
+
+var (
+	ipfsPinsFile = "ipfs_pins.json"
+	ipfsMu       sync.Mutex
+	ipfsClient   = &http.Client{Timeout: 60 * time.Second}
+)
+
+var ErrPinNotFound = errors.New("pin not found")
+
+// UploadToIPFS adds data through the IPFS HTTP API and queues it for pinning.
+// The pin is attempted immediately and retried in the background on failure.
+func UploadToIPFS(name string, data []byte) (*IPFSPin, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	var added struct {
+		Hash string `json:"Hash"`
+	}
+	if err := ipfsCall("add", url.Values{"pin": {"false"}, "cid-version": {"1"}}, form.FormDataContentType(), &body, &added); err != nil {
+		return nil, err
+	}
+	if added.Hash == "" {
+		return nil, errors.New("IPFS add returned no CID")
+	}
+
+	pin := &IPFSPin{
+		CID:       added.Hash,
+		Name:      name,
+		Status:    PinStatusQueued,
+		CreatedAt: time.Now().UTC(),
+	}
+	attemptPin(pin)
+
+	ipfsMu.Lock()
+	defer ipfsMu.Unlock()
+
+	pins, err := readIPFSPins()
+	if err != nil {
+		return nil, err
+	}
+
+	pins = append(pins, pin)
+	if err := writeJSONFile(ipfsPinsFile, pins); err != nil {
+		return nil, err
+	}
+
+	return pin, nil
+}
+
+func UploadJSONToIPFS(name string, v interface{}) (*IPFSPin, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return UploadToIPFS(name, data)
+}
+
+func ListIPFSPins() ([]*IPFSPin, error) {
+	ipfsMu.Lock()
+	defer ipfsMu.Unlock()
+
+	return readIPFSPins()
+}
+
+func GetIPFSPin(cid string) (*IPFSPin, error) {
+	pins, err := ListIPFSPins()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pin := range pins {
+		if pin.CID == cid {
+			return pin, nil
+		}
+	}
+
+	return nil, ErrPinNotFound
+}
+
+func StartIPFSPinner() {
+	go func() {
+		ticker := time.NewTicker(pinRetryInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := retryPins(); err != nil {
+				log.Printf("ipfs pinner: %v", err)
+			}
+		}
+	}()
+}
+
+func retryPins() error {
+	ipfsMu.Lock()
+	defer ipfsMu.Unlock()
+
+	pins, err := readIPFSPins()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, pin := range pins {
+		if pin.Status != PinStatusQueued {
+			continue
+		}
+		attemptPin(pin)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return writeJSONFile(ipfsPinsFile, pins)
+}
+
+func attemptPin(pin *IPFSPin) {
+	pin.Attempts++
+	if err := ipfsCall("pin/add", url.Values{"arg": {pin.CID}}, "", nil, nil); err != nil {
+		pin.LastError = err.Error()
+		if pin.Attempts >= maxPinAttempts {
+			pin.Status = PinStatusFailed
+		}
+		return
+	}
+
+	now := time.Now().UTC()
+	pin.Status = PinStatusPinned
+	pin.PinnedAt = &now
+	pin.LastError = ""
+}
+
+func ipfsCall(command string, query url.Values, contentType string, body io.Reader, out interface{}) error {
+	endpoint := strings.TrimRight(ipfsAPIURL(), "/") + "/api/v0/" + command + "?" + query.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token := os.Getenv("IPFS_API_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := ipfsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("IPFS %s failed: %s: %s", command, resp.Status, strings.TrimSpace(string(snippet)))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func ipfsAPIURL() string {
+	if apiURL := os.Getenv("IPFS_API_URL"); apiURL != "" {
+		return apiURL
+	}
+
+	return "http://127.0.0.1:5001"
+}
+
+func readIPFSPins() ([]*IPFSPin, error) {
+	var pins []*IPFSPin
+	if err := readJSONFile(ipfsPinsFile, &pins); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return pins, nil
+}
@@ -0,0 +1,565 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Jobs are recurring work run on a cron schedule: payments, sweeps,
+// statements and pruning. Each run is at most once: a job's next run is
+// set before it starts, so a run interrupted by a restart is not repeated,
+// and a failed run waits for the next one. A run missed while the wallet was
+// down happens once when it starts again.
+//
+// At most JOBS_MAX_CONCURRENT jobs (default 2) run at a time, and a job
+// never overlaps its own previous run; a due job waiting for a slot runs on
+// a later tick.
+
+const (
+	JobKindPayment   = "payment"
+	JobKindSweep     = "sweep"
+	JobKindStatement = "statement"
+	JobKindPrune     = "prune"
+
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+
+	jobsInterval        = 15 * time.Second
+	defaultJobsParallel = 2
+	maxJobJitter        = time.Hour
+	maxJobRuns          = 20
+)
+
+// Job is a recurring task. ChainID and Account are resolved when the job is
+// created, so a payment keeps going to the same chain and from the same
+// account when another network or account is selected.
+type Job struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Kind     string `json:"kind"`
+	Schedule string `json:"schedule"`
+	Timezone string `json:"timezone,omitempty"`
+	Jitter   string `json:"jitter,omitempty"`
+
+	ChainID uint64 `json:"chain_id,omitempty"`
+	Account string `json:"account,omitempty"`
+	To      string `json:"to,omitempty"`
+	// Value is a payment's amount in wei.
+	Value string `json:"value,omitempty"`
+	// Keep is the wei a sweep leaves behind.
+	Keep string `json:"keep,omitempty"`
+
+	Paused    bool       `json:"paused"`
+	Running   bool       `json:"running"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	Runs      []JobRun   `json:"runs,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// JobRun is one run of a job, most recent first in Job.Runs.
+type JobRun struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Status     string    `json:"status"`
+	Result     string    `json:"result,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+var (
+	jobsFile = "jobs.json"
+	jobsMu   sync.Mutex
+
+	// jobsRunning and jobSlots are guarded by jobsMu.
+	jobsRunning = map[string]bool{}
+	jobSlots    = make(chan struct{}, defaultJobsParallel)
+)
+
+var (
+	ErrInvalidJob  = errors.New("invalid job")
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobRunning  = errors.New("job is already running")
+	ErrJobPaused   = errors.New("job is paused")
+)
+
+var jobKinds = map[string]func(*Job, time.Time) (string, error){
+	JobKindPayment:   runPaymentJob,
+	JobKindSweep:     runSweepJob,
+	JobKindStatement: runStatementJob,
+	JobKindPrune:     runPruneJob,
+}
+
+// CreateJob schedules job on chain, which is ignored for prune jobs.
+func CreateJob(chain *Chain, job Job) (*Job, error) {
+	if _, ok := jobKinds[job.Kind]; !ok {
+		return nil, fmt.Errorf("%w: kind must be payment, sweep, statement or prune", ErrInvalidJob)
+	}
+
+	if job.Kind != JobKindPrune {
+		account, err := AccountAddress(job.Account)
+		if err != nil {
+			return nil, err
+		}
+		job.ChainID, job.Account = chain.ID.Uint64(), account
+	}
+
+	switch job.Kind {
+	case JobKindPayment, JobKindSweep:
+		if !common.IsHexAddress(job.To) {
+			return nil, fmt.Errorf("%w: to must be an address", ErrInvalidJob)
+		}
+		job.To = common.HexToAddress(job.To).Hex()
+	}
+	if job.Kind == JobKindPayment {
+		if value, ok := new(big.Int).SetString(job.Value, 10); !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: value must be a positive amount of wei", ErrInvalidJob)
+		}
+	}
+	if job.Kind == JobKindSweep && job.Keep != "" {
+		if keep, ok := new(big.Int).SetString(job.Keep, 10); !ok || keep.Sign() < 0 {
+			return nil, fmt.Errorf("%w: keep must be an amount of wei", ErrInvalidJob)
+		}
+	}
+
+	now := time.Now().UTC()
+	job.ID, job.CreatedAt = newID(), now
+	job.Paused, job.Running, job.Runs = false, false, nil
+
+	next, err := job.nextRun(now)
+	if err != nil {
+		return nil, err
+	}
+	if next == nil {
+		return nil, fmt.Errorf("%w: schedule %q never fires", ErrInvalidJob, job.Schedule)
+	}
+	job.NextRun = next
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	jobs, err := readJobs()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeJSONFile(jobsFile, append(jobs, &job)); err != nil {
+		return nil, err
+	}
+
+	recordAudit("job.created", fmt.Sprintf("created %s job %s (%s)", job.Kind, job.ID, job.Schedule),
+		map[string]interface{}{"job_id": job.ID, "kind": job.Kind, "schedule": job.Schedule})
+	return &job, nil
+}
+
+func ListJobs() ([]*Job, error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	jobs, err := readJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	for _, job := range jobs {
+		job.Running = jobsRunning[job.ID]
+	}
+
+	return jobs, nil
+}
+
+func GetJob(id string) (*Job, error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	jobs, err := readJobs()
+	if err != nil {
+		return nil, err
+	}
+	job, err := findJob(jobs, id)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Running = jobsRunning[job.ID]
+	return job, nil
+}
+
+// DeleteJob removes a job. A run already under way finishes.
+func DeleteJob(id string) error {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	jobs, err := readJobs()
+	if err != nil {
+		return err
+	}
+
+	for i, job := range jobs {
+		if job.ID != id {
+			continue
+		}
+
+		if err := writeJSONFile(jobsFile, append(jobs[:i], jobs[i+1:]...)); err != nil {
+			return err
+		}
+		recordAudit("job.deleted", "deleted job "+id, map[string]interface{}{"job_id": id, "kind": job.Kind})
+		return nil
+	}
+
+	return ErrJobNotFound
+}
+
+// RunJob makes a job due now. It runs on the next tick, once a slot is
+// free, and its schedule carries on from there.
+func RunJob(id string) (*Job, error) {
+	return updateJob(id, func(job *Job) error {
+		if jobsRunning[job.ID] {
+			return ErrJobRunning
+		}
+		if job.Paused {
+			return ErrJobPaused
+		}
+
+		now := time.Now().UTC()
+		job.NextRun = &now
+		return nil
+	})
+}
+
+// PauseJob stops a job's runs until it is resumed.
+func PauseJob(id string) (*Job, error) {
+	return updateJob(id, func(job *Job) error {
+		job.Paused = true
+		return nil
+	})
+}
+
+// ResumeJob restarts a paused job's schedule from now, skipping the runs
+// missed while it was paused.
+func ResumeJob(id string) (*Job, error) {
+	return updateJob(id, func(job *Job) error {
+		next, err := job.nextRun(time.Now())
+		if err != nil {
+			return err
+		}
+
+		job.Paused, job.NextRun = false, next
+		return nil
+	})
+}
+
+func updateJob(id string, update func(*Job) error) (*Job, error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	jobs, err := readJobs()
+	if err != nil {
+		return nil, err
+	}
+	job, err := findJob(jobs, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := update(job); err != nil {
+		return nil, err
+	}
+	if err := writeJSONFile(jobsFile, jobs); err != nil {
+		return nil, err
+	}
+
+	job.Running = jobsRunning[job.ID]
+	return job, nil
+}
+
+// StartJobs runs due jobs every 15 seconds, at most JOBS_MAX_CONCURRENT at
+// a time.
+func StartJobs() {
+	if raw := os.Getenv("JOBS_MAX_CONCURRENT"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			jobsMu.Lock()
+			jobSlots = make(chan struct{}, n)
+			jobsMu.Unlock()
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(jobsInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := runDueJobs(); err != nil {
+				log.Printf("jobs: %v", err)
+			}
+		}
+	}()
+}
+
+// runDueJobs starts the due jobs there are slots for. Their next runs are
+// written before any of them starts. Jobs that fall due during maintenance
+// run once it ends.
+func runDueJobs() error {
+	if InMaintenance() {
+		return nil
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	jobs, err := readJobs()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var due []Job
+	for _, job := range jobs {
+		if job.Paused || job.NextRun == nil || now.Before(*job.NextRun) || jobsRunning[job.ID] {
+			continue
+		}
+		if len(due) == cap(jobSlots)-len(jobSlots) {
+			break
+		}
+
+		next, err := job.nextRun(now)
+		if err != nil {
+			// The schedule was valid when the job was created, so this
+			// is a time zone that has since gone from the system.
+			log.Printf("jobs: %s: %v", job.ID, err)
+			continue
+		}
+		job.NextRun = next
+		due = append(due, *job)
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	if err := writeJSONFile(jobsFile, jobs); err != nil {
+		return err
+	}
+
+	for _, job := range due {
+		jobsRunning[job.ID] = true
+		jobSlots <- struct{}{}
+		go runJob(job, jobSlots)
+	}
+
+	return nil
+}
+
+func runJob(job Job, slots chan struct{}) {
+	defer func() { <-slots }()
+
+	run := JobRun{StartedAt: time.Now().UTC()}
+	result, err := jobKinds[job.Kind](&job, run.StartedAt)
+	run.FinishedAt = time.Now().UTC()
+	run.Status, run.Result = JobRunSucceeded, result
+	if err != nil {
+		run.Status, run.Error = JobRunFailed, err.Error()
+	}
+
+	details := map[string]interface{}{"job_id": job.ID, "kind": job.Kind, "status": run.Status}
+	if err != nil {
+		recordAudit("job.failed", fmt.Sprintf("%s job %s failed: %v", job.Kind, job.ID, err), details)
+	} else {
+		recordAudit("job.run", fmt.Sprintf("%s job %s: %s", job.Kind, job.ID, result), details)
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	delete(jobsRunning, job.ID)
+	jobs, err := readJobs()
+	if err != nil {
+		log.Printf("jobs: failed to record run of %s: %v", job.ID, err)
+		return
+	}
+	stored, err := findJob(jobs, job.ID)
+	if err != nil {
+		// Deleted while it ran.
+		return
+	}
+
+	stored.Runs = append([]JobRun{run}, stored.Runs...)
+	if len(stored.Runs) > maxJobRuns {
+		stored.Runs = stored.Runs[:maxJobRuns]
+	}
+	if err := writeJSONFile(jobsFile, jobs); err != nil {
+		log.Printf("jobs: failed to record run of %s: %v", job.ID, err)
+	}
+}
+
+// nextRun is when the job next runs after after, plus up to its jitter, or
+// nil if its schedule never fires again.
+func (j *Job) nextRun(after time.Time) (*time.Time, error) {
+	location := time.UTC
+	if j.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(j.Timezone); err != nil {
+			return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidJob, j.Timezone)
+		}
+	}
+
+	schedule, err := parseCron(j.Schedule, location)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+
+	var jitter time.Duration
+	if j.Jitter != "" {
+		if jitter, err = time.ParseDuration(j.Jitter); err != nil || jitter < 0 || jitter > maxJobJitter {
+			return nil, fmt.Errorf("%w: jitter must be a duration of at most %s", ErrInvalidJob, maxJobJitter)
+		}
+	}
+
+	next := schedule.next(after)
+	if next.IsZero() {
+		return nil, nil
+	}
+	delay, err := randomDuration(0, jitter)
+	if err != nil {
+		return nil, err
+	}
+
+	next = next.Add(delay).UTC()
+	return &next, nil
+}
+
+// lastSucceeded is when the job's last successful run started, or when it
+// was created.
+func (j *Job) lastSucceeded() time.Time {
+	for _, run := range j.Runs {
+		if run.Status == JobRunSucceeded {
+			return run.StartedAt
+		}
+	}
+
+	return j.CreatedAt
+}
+
+func runPaymentJob(job *Job, _ time.Time) (string, error) {
+	value, ok := new(big.Int).SetString(job.Value, 10)
+	if !ok {
+		return "", errors.New("invalid payment value")
+	}
+
+	signer, err := accountSigner(job.Account)
+	if err != nil {
+		return "", err
+	}
+	chain, err := chainByID(context.Background(), job.ChainID)
+	if err != nil {
+		return "", err
+	}
+	gasPrice, err := chain.currentGasPrice(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := sendTransaction(chain, signer, common.HexToAddress(job.To), value, 21000, gasPrice, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return "sent " + hash, nil
+}
+
+// runSweepJob sends the account's pending balance, less Keep and the fee,
+// so that transactions already in the mempool are left enough.
+func runSweepJob(job *Job, _ time.Time) (string, error) {
+	ctx := context.Background()
+	chain, err := chainByID(ctx, job.ChainID)
+	if err != nil {
+		return "", err
+	}
+
+	balance, err := chain.client.PendingBalanceAt(ctx, common.HexToAddress(job.Account))
+	if err != nil {
+		return "", err
+	}
+	gasPrice, err := chain.currentGasPrice(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	amount := new(big.Int).Sub(balance, new(big.Int).Mul(gasPrice, big.NewInt(21000)))
+	if job.Keep != "" {
+		keep, _ := new(big.Int).SetString(job.Keep, 10)
+		amount.Sub(amount, keep)
+	}
+	if amount.Sign() <= 0 {
+		return "nothing to sweep", nil
+	}
+
+	signer, err := accountSigner(job.Account)
+	if err != nil {
+		return "", err
+	}
+	hash, err := sendTransaction(chain, signer, common.HexToAddress(job.To), amount, 21000, gasPrice, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("swept %s wei in %s", amount, hash), nil
+}
+
+func runStatementJob(job *Job, started time.Time) (string, error) {
+	statement, err := createStatement(job, job.lastSucceeded(), started)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("statement %s with %d transactions", statement.ID, len(statement.Transactions)), nil
+}
+
+func runPruneJob(_ *Job, _ time.Time) (string, error) {
+	report, err := PruneNow()
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, dataset := range report.Datasets {
+		if dataset.Error != "" {
+			return "", fmt.Errorf("%s was not pruned: %s", dataset.Dataset, dataset.Error)
+		}
+		parts = append(parts, fmt.Sprintf("%d %s", dataset.Pruned, dataset.Dataset))
+	}
+	if len(parts) == 0 {
+		return "no retention rules", nil
+	}
+
+	return "pruned " + strings.Join(parts, ", "), nil
+}
+
+func findJob(jobs []*Job, id string) (*Job, error) {
+	for _, job := range jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+
+	return nil, ErrJobNotFound
+}
+
+func readJobs() ([]*Job, error) {
+	var jobs []*Job
+	if err := readJSONFile(jobsFile, &jobs); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return jobs, nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Stages of a signing journal entry. Intent and signed are unresolved: the
+// process may have died before learning what became of the nonce.
+const (
+	JournalIntent    = "intent"
+	JournalSigned    = "signed"
+	JournalBroadcast = "broadcast"
+	JournalQueued    = "queued"
+	JournalRejected  = "rejected"
+	JournalAbandoned = "abandoned"
+
+	journalRetention = 7 * 24 * time.Hour
+)
+
+// SigningJournalEntry tracks one send from nonce reservation to broadcast.
+// The intent is written before signing and the signed transaction before it
+// is broadcast, so after a crash the wallet knows which nonces it handed out
+// and which transactions may already be on their way, instead of numbering
+// new sends from whatever the node happens to report.
+type SigningJournalEntry struct {
+	ID        string    `json:"id"`
+	Boot      string    `json:"boot"`
+	ChainID   uint64    `json:"chain_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Value     string    `json:"value"`
+	Nonce     uint64    `json:"nonce"`
+	Stage     string    `json:"stage"`
+	Hash      string    `json:"hash,omitempty"`
+	RawTx     string    `json:"raw_transaction,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Recovered bool      `json:"recovered,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var (
+	journalFile = "signing_journal.json"
+	journalMu   sync.Mutex
+
+	// bootID tells this process's entries apart from those left by an
+	// earlier one, which are the only ones recovery touches.
+	bootID = newID()
+)
+
+func ListSigningJournal(includeResolved bool) ([]*SigningJournalEntry, error) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	entries, err := readJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*SigningJournalEntry
+	for _, entry := range entries {
+		if includeResolved || !entry.resolved() {
+			matched = append(matched, entry)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	return matched, nil
+}
+
+// reserveNonce picks the nonce for from, the one requested if not nil, and
+// journals the intent to sign with it. Unresolved entries keep their nonces,
+// so neither a concurrent send nor one made after a crash can reuse a nonce
+// that may be in flight.
+func reserveNonce(ctx context.Context, chain *Chain, from, to common.Address, value *big.Int, requested *uint64) (*SigningJournalEntry, error) {
+	n := noncesFor(chain.ID.Uint64(), from)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	nonce, err := n.assign(ctx, chain, from, requested)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := journalIntent(chain, from, to, value, nonce)
+	if err != nil {
+		delete(n.inFlight, nonce)
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// reserveReplacement journals the intent to sign a transaction replacing
+// one already sent with nonce, which must not have been mined yet.
+func reserveReplacement(ctx context.Context, chain *Chain, from, to common.Address, value *big.Int, nonce uint64) (*SigningJournalEntry, error) {
+	n := noncesFor(chain.ID.Uint64(), from)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	mined, err := chain.client.NonceAt(ctx, from, nil)
+	if err != nil {
+		return nil, err
+	}
+	if mined > nonce {
+		return nil, fmt.Errorf("%w: nonce %d was already mined", ErrNotReplaceable, nonce)
+	}
+
+	return journalIntent(chain, from, to, value, nonce)
+}
+
+func journalIntent(chain *Chain, from, to common.Address, value *big.Int, nonce uint64) (*SigningJournalEntry, error) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	entries, err := readJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	entry := &SigningJournalEntry{
+		ID:        newID(),
+		Boot:      bootID,
+		ChainID:   chain.ID.Uint64(),
+		From:      from.Hex(),
+		To:        to.Hex(),
+		Value:     value.String(),
+		Nonce:     nonce,
+		Stage:     JournalIntent,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	entries = append(entries, entry)
+	if err := writeJournal(entries); err != nil {
+		return nil, fmt.Errorf("failed to journal signing intent: %w", err)
+	}
+
+	return entry, nil
+}
+
+// journalSigned records the signed transaction. It must succeed before the
+// transaction is broadcast.
+func journalSigned(id string, tx *types.Transaction) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	err = updateJournal(id, func(entry *SigningJournalEntry) {
+		entry.Stage = JournalSigned
+		entry.Hash = tx.Hash().Hex()
+		entry.RawTx = hexutil.Encode(raw)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to journal signed transaction: %w", err)
+	}
+
+	return nil
+}
+
+// journalOutcome resolves an entry. Failures are logged: by now the outcome
+// is also recorded in history or the broadcast queue.
+func journalOutcome(id, stage string, outcome error) {
+	var updated SigningJournalEntry
+	err := updateJournal(id, func(entry *SigningJournalEntry) {
+		entry.Stage = stage
+		if outcome != nil {
+			entry.Error = outcome.Error()
+		}
+		updated = *entry
+	})
+	if err != nil {
+		log.Printf("failed to journal outcome of %s: %v", id, err)
+		return
+	}
+
+	// A nonce that never reached the node is free again.
+	if stage == JournalRejected || stage == JournalAbandoned {
+		releaseNonce(updated.ChainID, common.HexToAddress(updated.From), updated.Nonce)
+	}
+}
+
+// recoverJournal settles unresolved entries from earlier processes and
+// returns how many are still unresolved, which the reconciler retries.
+//
+// An intent that was never signed gave up its nonce. A signed transaction
+// the node knows about was broadcast. One it does not know about is put
+// back in the broadcast queue, which keeps its nonce, unless the account's
+// nonce has already moved past it.
+func recoverJournal() (int, error) {
+	journalMu.Lock()
+	entries, err := readJournal()
+	journalMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	unresolved := 0
+	for _, entry := range entries {
+		if entry.resolved() || entry.Boot == bootID {
+			continue
+		}
+
+		if entry.Stage == JournalIntent {
+			journalRecovered(entry.ID, JournalAbandoned, "never signed before restart")
+			continue
+		}
+
+		stage, reason, err := recoverSigned(entry)
+		if err != nil {
+			log.Printf("signing journal: cannot settle %s yet: %v", entry.Hash, err)
+			unresolved++
+			continue
+		}
+		journalRecovered(entry.ID, stage, reason)
+	}
+
+	return unresolved, nil
+}
+
+// recoverSigned returns the stage a signed entry settles at and why, or an
+// error if its chain cannot be checked yet.
+func recoverSigned(entry *SigningJournalEntry) (string, string, error) {
+	raw, err := hexutil.Decode(entry.RawTx)
+	if err != nil {
+		return JournalAbandoned, err.Error(), nil
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return JournalAbandoned, err.Error(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcReadTimeout)
+	defer cancel()
+
+	chain, err := chainByID(ctx, entry.ChainID)
+	if err != nil {
+		return "", "", err
+	}
+
+	record := signedBy(TransactionRecord{
+		Hash:      entry.Hash,
+		ChainID:   entry.ChainID,
+		From:      entry.From,
+		To:        entry.To,
+		Value:     entry.Value,
+		Status:    StatusPending,
+		CreatedAt: entry.CreatedAt,
+	}, tx)
+
+	if _, _, err := chain.client.TransactionByHash(ctx, tx.Hash()); err == nil {
+		return JournalBroadcast, "", recordTransactionOnce(record)
+	}
+
+	from := common.HexToAddress(entry.From)
+	mined, err := chain.client.NonceAt(ctx, from, nil)
+	if err != nil {
+		return "", "", err
+	}
+	if mined > entry.Nonce {
+		return JournalRejected, "nonce was used by another transaction", nil
+	}
+
+	if err := queueBroadcast(tx, from, errors.New("recovered from signing journal after restart")); err != nil {
+		return "", "", err
+	}
+	record.Status = StatusQueued
+	return JournalQueued, "", recordTransactionOnce(record)
+}
+
+func journalRecovered(id, stage, reason string) {
+	err := updateJournal(id, func(entry *SigningJournalEntry) {
+		entry.Stage = stage
+		entry.Recovered = true
+		entry.Error = reason
+	})
+	if err != nil {
+		log.Printf("signing journal: failed to record recovery of %s: %v", id, err)
+		return
+	}
+
+	log.Printf("signing journal: recovered %s as %s", id, stage)
+}
+
+func updateJournal(id string, update func(*SigningJournalEntry)) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	entries, err := readJournal()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.ID == id {
+			update(entry)
+			entry.UpdatedAt = time.Now().UTC()
+			return writeJournal(entries)
+		}
+	}
+
+	return fmt.Errorf("journal entry %s not found", id)
+}
+
+func (e *SigningJournalEntry) resolved() bool {
+	return e.Stage != JournalIntent && e.Stage != JournalSigned
+}
+
+func readJournal() ([]*SigningJournalEntry, error) {
+	var entries []*SigningJournalEntry
+	if err := readJSONFile(journalFile, &entries); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// writeJournal must be called with journalMu held. Resolved entries older
+// than journalRetention are dropped.
+func writeJournal(entries []*SigningJournalEntry) error {
+	cutoff := time.Now().Add(-journalRetention)
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if !entry.resolved() || entry.UpdatedAt.After(cutoff) {
+			kept = append(kept, entry)
+		}
+	}
+
+	return writeJSONFile(journalFile, kept)
+}
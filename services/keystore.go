@@ -0,0 +1,305 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+// Account keys are kept in go-ethereum's V3 keystore format, encrypted with
+// scrypt under the password given when the key was created, so the files can
+// be used with geth or any other wallet that reads a keystore. Signing needs
+// the key unlocked first; an unlocked key is held in memory only, until it
+// expires or is locked again.
+
+const defaultUnlockDuration = 5 * time.Minute
+
+// Key storage reported for an account.
+const (
+	KeyStorageKeystore  = "keystore"
+	KeyStoragePlaintext = "plaintext"
+	KeyStorageHD        = "hd"
+	KeyStorageHardware  = "hardware"
+	KeyStorageWatchOnly = "watch-only"
+)
+
+var (
+	ErrAccountLocked    = errors.New("account is locked; unlock it with its password")
+	ErrPasswordRequired = errors.New("a password is required")
+	ErrWrongPassword    = errors.New("wrong password")
+	ErrNotInKeystore    = errors.New("account key is not in the keystore")
+	ErrAlreadyEncrypted = errors.New("account key is already encrypted")
+)
+
+type unlockedKey struct {
+	privateKey *ecdsa.PrivateKey
+	expires    time.Time
+}
+
+var (
+	unlockedMu   sync.Mutex
+	unlockedKeys = map[common.Address]unlockedKey{}
+)
+
+// UnlockAccount decrypts an account's key, the selected account's if address
+// is empty, and keeps it for duration, five minutes if zero, so that it can
+// sign. An HD address's key is derived from its account's seed, decrypted
+// for the purpose; only the derived key is kept. Unlocking an unlocked
+// account extends it. It returns when the key will be locked again.
+func UnlockAccount(address, password string, duration time.Duration) (time.Time, error) {
+	account, err := keystoreAccount(address)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if duration <= 0 {
+		duration = defaultUnlockDuration
+	}
+
+	privateKey, err := decryptAccountKey(account, password)
+	if errors.Is(err, ErrWrongPassword) {
+		recordAudit("account.unlock_failed", "wrong password unlocking "+account.Hex(), map[string]interface{}{"address": account.Hex()})
+		return time.Time{}, err
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	expires := time.Now().UTC().Add(duration)
+	unlockedMu.Lock()
+	unlockedKeys[account] = unlockedKey{privateKey: privateKey, expires: expires}
+	unlockedMu.Unlock()
+
+	recordAudit("account.unlocked", "unlocked "+account.Hex(),
+		map[string]interface{}{"address": account.Hex(), "expires_at": expires})
+	return expires, nil
+}
+
+// decryptAccountKey decrypts an account's keystore key, or derives an HD
+// address's key from its encrypted seed.
+func decryptAccountKey(account common.Address, password string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(keystorePath(account))
+	if os.IsNotExist(err) {
+		return unlockHDAddressKey(account, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keystore.DecryptKey(data, password)
+	if errors.Is(err, keystore.ErrDecrypt) {
+		return nil, ErrWrongPassword
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.Address != account {
+		return nil, fmt.Errorf("keystore file for %s holds the key of %s", account.Hex(), key.Address.Hex())
+	}
+
+	return key.PrivateKey, nil
+}
+
+// LockAccount forgets an account's decrypted key, the selected account's if
+// address is empty.
+func LockAccount(address string) error {
+	account, err := keystoreAccount(address)
+	if err != nil {
+		return err
+	}
+
+	unlockedMu.Lock()
+	delete(unlockedKeys, account)
+	unlockedMu.Unlock()
+
+	recordAudit("account.locked", "locked "+account.Hex(), map[string]interface{}{"address": account.Hex()})
+	return nil
+}
+
+// EncryptAccountKey moves a key still stored in plain text, such as one
+// migrated from private_key.txt, into the keystore under password, and
+// removes the plain-text file. For an HD address it is the account's seed
+// that is encrypted, which covers all of its addresses.
+func EncryptAccountKey(address, password string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	account, err := keystoreAccount(address)
+	if err != nil {
+		return err
+	}
+
+	if hdAddressStorage(account) != "" {
+		if err := encryptHDAddressSeed(account, password); err != nil {
+			return err
+		}
+		recordAudit("account.encrypted", "encrypted the HD seed of "+account.Hex(),
+			map[string]interface{}{"address": account.Hex()})
+		return nil
+	}
+
+	if _, err := os.Stat(keystorePath(account)); err == nil {
+		return ErrAlreadyEncrypted
+	}
+	privateKey, err := readPlaintextKey(account)
+	if err != nil {
+		return err
+	}
+
+	data, err := encryptKey(privateKey, password)
+	if err != nil {
+		return err
+	}
+	if err := writeKeystore(account, data); err != nil {
+		return err
+	}
+	if err := os.Remove(accountKeyPath(account.Hex())); err != nil {
+		return err
+	}
+
+	recordAudit("account.encrypted", "moved the key of "+account.Hex()+" into the keystore",
+		map[string]interface{}{"address": account.Hex()})
+	return nil
+}
+
+// AccountKeyStorage reports how an account's key is stored and whether it
+// can sign now, which keystore keys only can while unlocked.
+func AccountKeyStorage(address string) (storage string, unlocked bool) {
+	account := common.HexToAddress(address)
+	if _, err := os.Stat(keystorePath(account)); err == nil {
+		_, unlocked = unlockedAccountKey(account)
+		return KeyStorageKeystore, unlocked
+	}
+	if _, err := os.Stat(accountKeyPath(account.Hex())); err == nil {
+		return KeyStoragePlaintext, true
+	}
+	switch hdAddressStorage(account) {
+	case KeyStorageHD:
+		_, unlocked = unlockedAccountKey(account)
+		return KeyStorageHD, unlocked
+	case KeyStoragePlaintext:
+		return KeyStoragePlaintext, true
+	}
+	// Neither a key store's keys nor a hardware wallet's are unlocked by
+	// the wallet.
+	if ref, err := findKeyRef(account); ref != nil && err == nil {
+		return ref.Store, true
+	}
+	if hardware, err := findHardwareAccount(account); hardware != nil && err == nil {
+		return KeyStorageHardware, true
+	}
+	if watchOnly, err := isWatchOnly(account); watchOnly && err == nil {
+		return KeyStorageWatchOnly, false
+	}
+
+	return "", false
+}
+
+// PlaintextKeys lists the accounts whose keys are still stored unencrypted.
+func PlaintextKeys() ([]string, error) {
+	accounts, _, err := ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var plaintext []string
+	for _, account := range accounts {
+		if storage, _ := AccountKeyStorage(account.Address); storage == KeyStoragePlaintext {
+			plaintext = append(plaintext, account.Address)
+		}
+	}
+
+	return plaintext, nil
+}
+
+func unlockedAccountKey(account common.Address) (*ecdsa.PrivateKey, bool) {
+	unlockedMu.Lock()
+	defer unlockedMu.Unlock()
+
+	key, ok := unlockedKeys[account]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(key.expires) {
+		delete(unlockedKeys, account)
+		return nil, false
+	}
+
+	return key.privateKey, true
+}
+
+// keystoreAccount resolves the account an unlock, lock or encrypt is for.
+func keystoreAccount(address string) (common.Address, error) {
+	resolved, err := AccountAddress(address)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return common.HexToAddress(resolved), nil
+}
+
+// encryptKey seals a key as V3 keystore JSON. It is slow by design, so it is
+// done before taking any lock.
+func encryptKey(privateKey *ecdsa.PrivateKey, password string) ([]byte, error) {
+	if password == "" {
+		return nil, ErrPasswordRequired
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	key := &keystore.Key{Id: id, Address: addressOf(privateKey), PrivateKey: privateKey}
+
+	scryptN, scryptP := keystoreScrypt()
+	return keystore.EncryptKey(key, password, scryptN, scryptP)
+}
+
+// keystoreScrypt returns the scrypt cost keys and seeds are encrypted with,
+// light with KEYSTORE_LIGHT_KDF=true.
+func keystoreScrypt() (n, p int) {
+	if os.Getenv("KEYSTORE_LIGHT_KDF") == "true" {
+		return keystore.LightScryptN, keystore.LightScryptP
+	}
+
+	return keystore.StandardScryptN, keystore.StandardScryptP
+}
+
+func writeKeystore(account common.Address, data []byte) error {
+	if err := os.MkdirAll(keysDir, 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(keystorePath(account), data, 0600)
+}
+
+func readPlaintextKey(account common.Address) (*ecdsa.PrivateKey, error) {
+	privateKeyHex, err := readKeyFile(accountKeyPath(account.Hex()))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: no key is held for %s", ErrAccountNotFound, account.Hex())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyBytes, err := hex.DecodeString(strings.TrimSpace(string(privateKeyHex)))
+	if err != nil {
+		return nil, err
+	}
+
+	return crypto.ToECDSA(privateKeyBytes)
+}
+
+func keystorePath(account common.Address) string {
+	return filepath.Join(keysDir, strings.ToLower(account.Hex())+".json")
+}
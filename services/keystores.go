@@ -0,0 +1,372 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Key stores, selected with KEY_STORE.
+const (
+	KeyStoreFile   = "file"
+	KeyStoreVault  = "vault"
+	KeyStoreAWSKMS = "aws-kms"
+	KeyStoreGCPKMS = "gcp-kms"
+)
+
+// KeyStore keeps account keys and signs with them. The file store keeps
+// them in the keystore directory, encrypted under their passwords. The
+// others keep them off the wallet's disk: Vault wraps them with a transit
+// key, to be unwrapped in memory for each signature, and AWS KMS and GCP
+// Cloud KMS create them and sign with them without their ever leaving the
+// KMS.
+type KeyStore interface {
+	// Name is the store's KEY_STORE value.
+	Name() string
+
+	// CreateKey makes a key. It returns its address and the function that
+	// keeps it, to be called once the address is known to be a new account.
+	// password encrypts the key in the file store, and is unused by others.
+	CreateKey(password string) (common.Address, func() error, error)
+
+	// ImportKey returns the function that keeps a key made elsewhere.
+	ImportKey(privateKey *ecdsa.PrivateKey, password string) (func() error, error)
+
+	// Signer returns the signer of a key the store keeps.
+	Signer(address common.Address) (Signer, error)
+}
+
+// kmsKeyStore is a key store whose keys can also be made outside the
+// wallet, such as by the infrastructure's provisioning, and then added.
+type kmsKeyStore interface {
+	KeyStore
+
+	// AddKey returns the address of a KMS key and the function that keeps
+	// a reference to it.
+	AddKey(keyID string) (common.Address, func() error, error)
+}
+
+// KeyRef records where the key of an address kept outside the file store
+// is. KeyID is a KMS key: an AWS key ARN, or a GCP key version's resource
+// name. A Vault key has Ciphertext instead, the key wrapped by the transit
+// key.
+type KeyRef struct {
+	Address    string    `json:"address"`
+	Store      string    `json:"store"`
+	KeyID      string    `json:"key_id,omitempty"`
+	Ciphertext string    `json:"ciphertext,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+var (
+	keyRefsFile = "key_refs.json"
+	keyRefsMu   sync.Mutex
+)
+
+var (
+	ErrUnknownKeyStore     = errors.New("unknown key store")
+	ErrKeyStoreUnavailable = errors.New("key store unavailable")
+	ErrRemoteKey           = errors.New("the account's key is kept in a key store that only signs")
+	ErrKeyNotExportable    = errors.New("the key store does not hand out private keys")
+	ErrKeyNotImportable    = errors.New("the key store cannot import private keys")
+	ErrInvalidKMSKey       = errors.New("invalid KMS key")
+)
+
+// CheckKeyStoreConfig checks that KEY_STORE names a store and that the
+// store's settings are all there, so that a misconfigured wallet fails at
+// startup rather than at its first signature.
+func CheckKeyStoreConfig() error {
+	_, err := ActiveKeyStore()
+	return err
+}
+
+// ActiveKeyStore returns the store new keys go to, per KEY_STORE, the file
+// store if unset. Keys already kept by another store stay there.
+func ActiveKeyStore() (KeyStore, error) {
+	name := os.Getenv("KEY_STORE")
+	if name == "" {
+		name = KeyStoreFile
+	}
+
+	return keyStoreNamed(name)
+}
+
+// KeyStoreKeys lists the keys kept outside the file store, without their
+// wrapped Vault keys.
+func KeyStoreKeys() ([]KeyRef, error) {
+	keyRefsMu.Lock()
+	defer keyRefsMu.Unlock()
+
+	refs, err := readKeyRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]KeyRef, 0, len(refs))
+	for _, ref := range refs {
+		key := *ref
+		key.Ciphertext = ""
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// AddKMSKey adds a key created in the active KMS as an account, without
+// selecting it, unless no account is selected yet.
+func AddKMSKey(keyID, name string) (Account, error) {
+	keyID = strings.TrimSpace(keyID)
+	if keyID == "" {
+		return Account{}, fmt.Errorf("%w: a key ID is required", ErrInvalidKMSKey)
+	}
+	store, err := ActiveKeyStore()
+	if err != nil {
+		return Account{}, err
+	}
+	kms, ok := store.(kmsKeyStore)
+	if !ok {
+		return Account{}, fmt.Errorf("%w: the %s key store has no KMS keys to add", ErrInvalidKMSKey, store.Name())
+	}
+
+	address, storeKey, err := kms.AddKey(keyID)
+	if err != nil {
+		return Account{}, err
+	}
+	account, err := addAccountEntry(name, address, false, storeKey)
+	if err != nil {
+		return Account{}, err
+	}
+
+	recordAudit("account.kms", fmt.Sprintf("Added %s from %s key %s", account.Address, store.Name(), keyID),
+		map[string]interface{}{"address": account.Address, "store": store.Name(), "key_id": keyID})
+	return account, nil
+}
+
+func keyStoreNamed(name string) (KeyStore, error) {
+	switch name {
+	case KeyStoreFile:
+		return fileKeyStore{}, nil
+	case KeyStoreVault:
+		return newVaultKeyStore()
+	case KeyStoreAWSKMS:
+		return newAWSKeyStore()
+	case KeyStoreGCPKMS:
+		return newGCPKeyStore()
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKeyStore, name)
+}
+
+// keyStoreOf returns the store that keeps the key of address.
+func keyStoreOf(address common.Address) (KeyStore, error) {
+	ref, err := findKeyRef(address)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return fileKeyStore{}, nil
+	}
+
+	return keyStoreNamed(ref.Store)
+}
+
+type fileKeyStore struct{}
+
+func (fileKeyStore) Name() string {
+	return KeyStoreFile
+}
+
+func (s fileKeyStore) CreateKey(password string) (common.Address, func() error, error) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	storeKey, err := s.ImportKey(privateKey, password)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	return addressOf(privateKey), storeKey, nil
+}
+
+func (fileKeyStore) ImportKey(privateKey *ecdsa.PrivateKey, password string) (func() error, error) {
+	keystoreJSON, err := encryptKey(privateKey, password)
+	if err != nil {
+		return nil, err
+	}
+
+	address := addressOf(privateKey)
+	return func() error {
+		return writeKeystore(address, keystoreJSON)
+	}, nil
+}
+
+func (fileKeyStore) Signer(address common.Address) (Signer, error) {
+	privateKey, err := loadAccountKey(address.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	return newKeySigner(privateKey), nil
+}
+
+// vaultKeyStore wraps keys with a Vault transit key, VAULT_TRANSIT_KEY of
+// the transit engine mounted at VAULT_TRANSIT_MOUNT on VAULT_ADDR. Vault
+// has no secp256k1 keys to sign with, so the wallet signs, with a key
+// unwrapped for each signature and never written out.
+type vaultKeyStore struct {
+	transit *transitKMS
+}
+
+func newVaultKeyStore() (KeyStore, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, errors.New("VAULT_ADDR is required for the vault key store")
+	}
+	mount := os.Getenv("VAULT_TRANSIT_MOUNT")
+	if mount == "" {
+		mount = "transit"
+	}
+	key := os.Getenv("VAULT_TRANSIT_KEY")
+	if key == "" {
+		key = "go-wallet-keys"
+	}
+
+	return vaultKeyStore{transit: &transitKMS{
+		url:   strings.TrimSuffix(addr, "/") + "/v1/" + strings.Trim(mount, "/"),
+		key:   key,
+		token: os.Getenv("VAULT_TOKEN"),
+	}}, nil
+}
+
+func (vaultKeyStore) Name() string {
+	return KeyStoreVault
+}
+
+func (s vaultKeyStore) CreateKey(password string) (common.Address, func() error, error) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	storeKey, err := s.ImportKey(privateKey, password)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	return addressOf(privateKey), storeKey, nil
+}
+
+func (s vaultKeyStore) ImportKey(privateKey *ecdsa.PrivateKey, _ string) (func() error, error) {
+	ciphertext, err := s.transit.encrypt(crypto.FromECDSA(privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyStoreUnavailable, err)
+	}
+
+	return addKeyRef(&KeyRef{Address: addressOf(privateKey).Hex(), Store: KeyStoreVault, Ciphertext: ciphertext}), nil
+}
+
+func (s vaultKeyStore) Signer(address common.Address) (Signer, error) {
+	ref, err := storedKeyRef(address, KeyStoreVault)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := s.transit.decrypt(ref.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyStoreUnavailable, err)
+	}
+	privateKey, err := crypto.ToECDSA(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if addressOf(privateKey) != address {
+		return nil, fmt.Errorf("Vault unwrapped a key for %s instead of %s", addressOf(privateKey).Hex(), address.Hex())
+	}
+
+	return newKeySigner(privateKey), nil
+}
+
+// storedKeyRef returns the reference to the key of address, which store
+// must keep.
+func storedKeyRef(address common.Address, store string) (*KeyRef, error) {
+	ref, err := findKeyRef(address)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil || ref.Store != store {
+		return nil, fmt.Errorf("the %s key store has no key for %s", store, address.Hex())
+	}
+
+	return ref, nil
+}
+
+// addKeyRef returns the function that records ref, for addAccountEntry.
+func addKeyRef(ref *KeyRef) func() error {
+	return func() error {
+		keyRefsMu.Lock()
+		defer keyRefsMu.Unlock()
+
+		refs, err := readKeyRefs()
+		if err != nil {
+			return err
+		}
+		ref.CreatedAt = time.Now().UTC()
+		return writeJSONFile(keyRefsFile, append(refs, ref))
+	}
+}
+
+// removeKeyRef forgets where the key of address is. The key itself stays
+// in its store, which the wallet never deletes keys from.
+func removeKeyRef(address common.Address) error {
+	keyRefsMu.Lock()
+	defer keyRefsMu.Unlock()
+
+	refs, err := readKeyRefs()
+	if err != nil {
+		return err
+	}
+	kept := refs[:0]
+	for _, ref := range refs {
+		if common.HexToAddress(ref.Address) != address {
+			kept = append(kept, ref)
+		}
+	}
+	if len(kept) == len(refs) {
+		return nil
+	}
+
+	return writeJSONFile(keyRefsFile, kept)
+}
+
+func findKeyRef(address common.Address) (*KeyRef, error) {
+	keyRefsMu.Lock()
+	defer keyRefsMu.Unlock()
+
+	refs, err := readKeyRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if common.HexToAddress(ref.Address) == address {
+			return ref, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func readKeyRefs() ([]*KeyRef, error) {
+	var refs []*KeyRef
+	if err := readJSONFile(keyRefsFile, &refs); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return refs, nil
+}
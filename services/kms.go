@@ -0,0 +1,487 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// remoteSigner signs with a KMS key, which signs the hashes it is sent and
+// answers with DER-encoded ECDSA signatures.
+type remoteSigner struct {
+	address common.Address
+	sign    func(digest []byte) ([]byte, error)
+}
+
+func (s remoteSigner) Address() common.Address {
+	return s.address
+}
+
+func (s remoteSigner) SignTx(chainID *big.Int, tx *types.Transaction) (*types.Transaction, error) {
+	signer := signerForChain(chainID)
+	hash := signer.Hash(tx)
+	signature, err := s.SignHash(hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.WithSignature(signer, signature)
+}
+
+func (s remoteSigner) SignHash(hash []byte) ([]byte, error) {
+	der, err := s.sign(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return recoverableSignature(der, hash, s.address)
+}
+
+// recoverableSignature turns a DER-encoded signature into the 65-byte form
+// Ethereum uses. A KMS neither gives the recovery ID nor keeps s in the low
+// half of the curve order, as Ethereum requires, so s is flipped if need be
+// and the recovery ID is the one that recovers address.
+func recoverableSignature(der, hash []byte, address common.Address) ([]byte, error) {
+	var parsed struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &parsed); err != nil {
+		return nil, fmt.Errorf("%w: malformed signature: %v", ErrKeyStoreUnavailable, err)
+	}
+
+	order := crypto.S256().Params().N
+	if parsed.S.Cmp(new(big.Int).Rsh(order, 1)) > 0 {
+		parsed.S.Sub(order, parsed.S)
+	}
+
+	signature := make([]byte, crypto.SignatureLength)
+	parsed.R.FillBytes(signature[:32])
+	parsed.S.FillBytes(signature[32:64])
+	for v := byte(0); v < 2; v++ {
+		signature[crypto.RecoveryIDOffset] = v
+		if recovered, ok := recoverAddress(hash, signature); ok && recovered == address {
+			return signature, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: the KMS signature is not from %s", ErrKeyStoreUnavailable, address.Hex())
+}
+
+// publicKeyAddress returns the address of a DER-encoded secp256k1 public
+// key, which crypto/x509 cannot parse, not knowing the curve.
+func publicKeyAddress(der []byte) (common.Address, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return common.Address{}, fmt.Errorf("%w: malformed public key: %v", ErrInvalidKMSKey, err)
+	}
+	publicKey, err := crypto.UnmarshalPubkey(info.PublicKey.Bytes)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: not a secp256k1 key: %v", ErrInvalidKMSKey, err)
+	}
+
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+// awsKeyStore keeps keys in AWS KMS in AWS_REGION, as ECC_SECG_P256K1 keys
+// that sign digests, with the credentials AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and, for temporary ones, AWS_SESSION_TOKEN.
+// AWS_KMS_ENDPOINT overrides the regional endpoint, such as for a VPC
+// endpoint.
+type awsKeyStore struct {
+	endpoint     string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func newAWSKeyStore() (KeyStore, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, errors.New("AWS_REGION is required for the aws-kms key store")
+	}
+	store := awsKeyStore{
+		endpoint:     os.Getenv("AWS_KMS_ENDPOINT"),
+		region:       region,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if store.accessKey == "" || store.secretKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for the aws-kms key store")
+	}
+	if store.endpoint == "" {
+		store.endpoint = "https://kms." + region + ".amazonaws.com"
+	}
+	store.endpoint = strings.TrimSuffix(store.endpoint, "/")
+
+	return store, nil
+}
+
+func (awsKeyStore) Name() string {
+	return KeyStoreAWSKMS
+}
+
+func (s awsKeyStore) CreateKey(_ string) (common.Address, func() error, error) {
+	var created struct {
+		KeyMetadata struct {
+			Arn string `json:"Arn"`
+		} `json:"KeyMetadata"`
+	}
+	err := s.call("CreateKey", map[string]string{
+		"KeySpec":     "ECC_SECG_P256K1",
+		"KeyUsage":    "SIGN_VERIFY",
+		"Description": "go-wallet account key",
+	}, &created)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	return s.AddKey(created.KeyMetadata.Arn)
+}
+
+func (awsKeyStore) ImportKey(*ecdsa.PrivateKey, string) (func() error, error) {
+	return nil, fmt.Errorf("%w: AWS KMS creates its keys itself", ErrKeyNotImportable)
+}
+
+// AddKey takes a key ID, ARN or alias. The key's ARN is recorded, aliases
+// being repointable.
+func (s awsKeyStore) AddKey(keyID string) (common.Address, func() error, error) {
+	var key struct {
+		KeyID     string `json:"KeyId"`
+		KeySpec   string `json:"KeySpec"`
+		PublicKey string `json:"PublicKey"`
+	}
+	if err := s.call("GetPublicKey", map[string]string{"KeyId": keyID}, &key); err != nil {
+		return common.Address{}, nil, err
+	}
+	if key.KeySpec != "ECC_SECG_P256K1" {
+		return common.Address{}, nil, fmt.Errorf("%w: %s is a %s key, not ECC_SECG_P256K1", ErrInvalidKMSKey, keyID, key.KeySpec)
+	}
+	der, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("%w: malformed public key: %v", ErrInvalidKMSKey, err)
+	}
+	address, err := publicKeyAddress(der)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	return address, addKeyRef(&KeyRef{Address: address.Hex(), Store: KeyStoreAWSKMS, KeyID: key.KeyID}), nil
+}
+
+func (s awsKeyStore) Signer(address common.Address) (Signer, error) {
+	ref, err := storedKeyRef(address, KeyStoreAWSKMS)
+	if err != nil {
+		return nil, err
+	}
+
+	return remoteSigner{address: address, sign: func(digest []byte) ([]byte, error) {
+		var signed struct {
+			Signature string `json:"Signature"`
+		}
+		err := s.call("Sign", map[string]string{
+			"KeyId":            ref.KeyID,
+			"Message":          base64.StdEncoding.EncodeToString(digest),
+			"MessageType":      "DIGEST",
+			"SigningAlgorithm": "ECDSA_SHA_256",
+		}, &signed)
+		if err != nil {
+			return nil, err
+		}
+
+		return base64.StdEncoding.DecodeString(signed.Signature)
+	}}, nil
+}
+
+// call runs a KMS action, signing the request with Signature Version 4.
+func (s awsKeyStore) call(action string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	s.signRequest(req, body, time.Now().UTC())
+
+	return kmsRoundTrip("AWS KMS "+action, req, response)
+}
+
+func (s awsKeyStore) signRequest(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + s.region + "/kms/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	// The signed headers are listed in sorted order.
+	signed := []string{"content-type", "host", "x-amz-date"}
+	if s.sessionToken != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	signed = append(signed, "x-amz-target")
+	var headers strings.Builder
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	payloadHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		req.Method, "/", "", headers.String(), signedHeaders, hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{now.Format("20060102"), s.region, "kms", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// gcpKeyStore keeps keys in Cloud KMS, in the key ring GCP_KMS_KEY_RING
+// (projects/P/locations/L/keyRings/R), as HSM-protected
+// EC_SIGN_SECP256K1_SHA256 keys. It authenticates with GCP_ACCESS_TOKEN if
+// set, and otherwise as the instance's service account, through the
+// metadata server.
+type gcpKeyStore struct {
+	endpoint string
+	keyRing  string
+}
+
+var (
+	gcpTokenMu      sync.Mutex
+	gcpToken        string
+	gcpTokenExpires time.Time
+)
+
+// gcpMetadataURL is the metadata server's token endpoint.
+var gcpMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+func newGCPKeyStore() (KeyStore, error) {
+	keyRing := strings.Trim(os.Getenv("GCP_KMS_KEY_RING"), "/")
+	if keyRing == "" {
+		return nil, errors.New("GCP_KMS_KEY_RING is required for the gcp-kms key store")
+	}
+	endpoint := os.Getenv("GCP_KMS_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://cloudkms.googleapis.com"
+	}
+
+	return gcpKeyStore{endpoint: strings.TrimSuffix(endpoint, "/"), keyRing: keyRing}, nil
+}
+
+func (gcpKeyStore) Name() string {
+	return KeyStoreGCPKMS
+}
+
+func (s gcpKeyStore) CreateKey(_ string) (common.Address, func() error, error) {
+	var created struct {
+		Name string `json:"name"`
+	}
+	request := map[string]interface{}{
+		"purpose": "ASYMMETRIC_SIGN",
+		"versionTemplate": map[string]string{
+			"algorithm":       "EC_SIGN_SECP256K1_SHA256",
+			"protectionLevel": "HSM",
+		},
+	}
+	path := "/v1/" + s.keyRing + "/cryptoKeys?cryptoKeyId=" + url.QueryEscape("go-wallet-"+newID())
+	if err := s.call(http.MethodPost, path, request, &created); err != nil {
+		return common.Address{}, nil, err
+	}
+
+	// The first version is generated along with the key, but an HSM takes
+	// a moment to make it.
+	version := created.Name + "/cryptoKeyVersions/1"
+	var err error
+	for attempt := 0; attempt < 10; attempt++ {
+		var address common.Address
+		var storeKey func() error
+		if address, storeKey, err = s.AddKey(version); err == nil {
+			return address, storeKey, nil
+		}
+		time.Sleep(time.Second)
+	}
+
+	return common.Address{}, nil, err
+}
+
+func (gcpKeyStore) ImportKey(*ecdsa.PrivateKey, string) (func() error, error) {
+	return nil, fmt.Errorf("%w: Cloud KMS keys are created in Cloud KMS", ErrKeyNotImportable)
+}
+
+// AddKey takes a key version's resource name,
+// projects/P/locations/L/keyRings/R/cryptoKeys/K/cryptoKeyVersions/V.
+func (s gcpKeyStore) AddKey(keyID string) (common.Address, func() error, error) {
+	keyID = strings.Trim(keyID, "/")
+	if !strings.Contains(keyID, "/cryptoKeyVersions/") {
+		return common.Address{}, nil, fmt.Errorf("%w: %s is not a key version's resource name", ErrInvalidKMSKey, keyID)
+	}
+
+	var key struct {
+		Pem       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := s.call(http.MethodGet, "/v1/"+keyID+"/publicKey", nil, &key); err != nil {
+		return common.Address{}, nil, err
+	}
+	if key.Algorithm != "EC_SIGN_SECP256K1_SHA256" {
+		return common.Address{}, nil, fmt.Errorf("%w: %s is a %s key, not EC_SIGN_SECP256K1_SHA256", ErrInvalidKMSKey, keyID, key.Algorithm)
+	}
+	block, _ := pem.Decode([]byte(key.Pem))
+	if block == nil {
+		return common.Address{}, nil, fmt.Errorf("%w: malformed public key", ErrInvalidKMSKey)
+	}
+	address, err := publicKeyAddress(block.Bytes)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	return address, addKeyRef(&KeyRef{Address: address.Hex(), Store: KeyStoreGCPKMS, KeyID: keyID}), nil
+}
+
+func (s gcpKeyStore) Signer(address common.Address) (Signer, error) {
+	ref, err := storedKeyRef(address, KeyStoreGCPKMS)
+	if err != nil {
+		return nil, err
+	}
+
+	return remoteSigner{address: address, sign: func(digest []byte) ([]byte, error) {
+		var signed struct {
+			Signature string `json:"signature"`
+		}
+		request := map[string]interface{}{
+			"digest": map[string]string{"sha256": base64.StdEncoding.EncodeToString(digest)},
+		}
+		if err := s.call(http.MethodPost, "/v1/"+ref.KeyID+":asymmetricSign", request, &signed); err != nil {
+			return nil, err
+		}
+
+		return base64.StdEncoding.DecodeString(signed.Signature)
+	}}, nil
+}
+
+func (s gcpKeyStore) call(method, path string, request, response interface{}) error {
+	var body io.Reader
+	if request != nil {
+		encoded, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, s.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	token, err := gcpAccessToken()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return kmsRoundTrip("Cloud KMS", req, response)
+}
+
+// gcpAccessToken returns GCP_ACCESS_TOKEN, or the service account's token
+// from the metadata server, kept until shortly before it expires.
+func gcpAccessToken() (string, error) {
+	if token := os.Getenv("GCP_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	gcpTokenMu.Lock()
+	defer gcpTokenMu.Unlock()
+
+	if gcpToken != "" && time.Now().Before(gcpTokenExpires) {
+		return gcpToken, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, gcpMetadataURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := kmsRoundTrip("the GCP metadata server", req, &token); err != nil {
+		return "", err
+	}
+
+	gcpToken = token.AccessToken
+	gcpTokenExpires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return gcpToken, nil
+}
+
+// kmsRoundTrip sends a request to a KMS, decoding its JSON response. Any
+// failure is ErrKeyStoreUnavailable, with the KMS's own message when it
+// gives one.
+func kmsRoundTrip(service string, req *http.Request, response interface{}) error {
+	resp, err := kmsClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrKeyStoreUnavailable, service, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrKeyStoreUnavailable, service, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s responded %s: %s", ErrKeyStoreUnavailable, service, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, response)
+}
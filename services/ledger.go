@@ -0,0 +1,394 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Directions of a ledger entry, as the wallet sees the movement.
+const (
+	DirectionOutgoing = "outgoing"
+	DirectionIncoming = "incoming"
+	DirectionInternal = "internal"
+)
+
+// Counterparty categories other than an address book label.
+const (
+	CategoryInternal         = "internal"
+	CategoryExchange         = "exchange"
+	CategoryAddressBook      = "address_book"
+	CategoryContractCreation = "contract_creation"
+	CategoryExternal         = "external"
+)
+
+// Ledger account names. A wallet address has an asset account of its own;
+// the other side of a movement is booked to its counterparty category, and
+// network fees to one expense account.
+const (
+	ledgerWalletPrefix       = "wallet:"
+	ledgerCounterpartyPrefix = "counterparty:"
+	LedgerFeesAccount        = "expenses:network_fees"
+)
+
+const ledgerInterval = 30 * time.Second
+
+// LedgerEntry books one confirmed or failed transaction as a balanced
+// journal entry: its postings' debits and credits, in wei of the chain's
+// native currency, add up to the same amount. A failed transaction moves
+// only its fee. The counterparty's category is the one it had when the
+// entry was booked.
+type LedgerEntry struct {
+	ID           string          `json:"id"`
+	ChainID      uint64          `json:"chain_id"`
+	Direction    string          `json:"direction"`
+	Counterparty string          `json:"counterparty"`
+	Category     string          `json:"category"`
+	Value        string          `json:"value"`
+	Fee          string          `json:"fee"`
+	Status       string          `json:"status"`
+	Postings     []LedgerPosting `json:"postings"`
+	MinedAt      *time.Time      `json:"mined_at,omitempty"`
+	BookedAt     time.Time       `json:"booked_at"`
+}
+
+// LedgerPosting is one line of an entry. Exactly one of Debit and Credit is
+// set. Debits increase a wallet's asset account and the fee and
+// counterparty accounts; credits decrease them.
+type LedgerPosting struct {
+	Account string `json:"account"`
+	Debit   string `json:"debit,omitempty"`
+	Credit  string `json:"credit,omitempty"`
+}
+
+// LedgerBalance is the sum of one account's postings on one chain. Balance
+// is debits less credits.
+type LedgerBalance struct {
+	Account string `json:"account"`
+	ChainID uint64 `json:"chain_id"`
+	Debits  string `json:"debits"`
+	Credits string `json:"credits"`
+	Balance string `json:"balance"`
+}
+
+var (
+	ledgerFile = "ledger.json"
+	ledgerMu   sync.Mutex
+)
+
+var ErrLedgerDisabled = errors.New("the ledger is not enabled")
+
+// LedgerEnabled reports whether LEDGER=true, which books transactions as
+// they are confirmed.
+func LedgerEnabled() bool {
+	return os.Getenv("LEDGER") == "true"
+}
+
+// LedgerWalletAccount names the asset account of a wallet address.
+func LedgerWalletAccount(address string) string {
+	return ledgerWalletPrefix + common.HexToAddress(address).Hex()
+}
+
+// StartLedger books the transactions confirmed or failed since the last
+// run, every 30 seconds, if the ledger is enabled.
+func StartLedger() {
+	if !LedgerEnabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(ledgerInterval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := BookLedger(); err != nil {
+				log.Printf("ledger: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// ListLedgerEntries returns the entries on chainID, every chain if zero,
+// with a posting to account if it is given, in the order they were booked.
+func ListLedgerEntries(chainID uint64, account string) ([]*LedgerEntry, error) {
+	if !LedgerEnabled() {
+		return nil, ErrLedgerDisabled
+	}
+	if _, err := BookLedger(); err != nil {
+		return nil, err
+	}
+
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+
+	entries, err := readLedger()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []*LedgerEntry{}
+	for _, entry := range entries {
+		if chainID != 0 && entry.ChainID != chainID {
+			continue
+		}
+		if account != "" && !entry.posts(account) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+
+	return matched, nil
+}
+
+// LedgerBalances sums the postings of every account on chainID, every chain
+// if zero, for the transactions mined by until, or all of them if it is
+// zero.
+func LedgerBalances(chainID uint64, until time.Time) ([]*LedgerBalance, error) {
+	entries, err := ListLedgerEntries(chainID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		account string
+		chainID uint64
+	}
+	debits := map[key]*big.Int{}
+	credits := map[key]*big.Int{}
+	for _, entry := range entries {
+		if !until.IsZero() && entry.MinedAt != nil && entry.MinedAt.After(until) {
+			continue
+		}
+		for _, posting := range entry.Postings {
+			k := key{posting.Account, entry.ChainID}
+			if debits[k] == nil {
+				debits[k], credits[k] = new(big.Int), new(big.Int)
+			}
+			if amount, ok := new(big.Int).SetString(posting.Debit, 10); ok {
+				debits[k].Add(debits[k], amount)
+			}
+			if amount, ok := new(big.Int).SetString(posting.Credit, 10); ok {
+				credits[k].Add(credits[k], amount)
+			}
+		}
+	}
+
+	balances := []*LedgerBalance{}
+	for k, debit := range debits {
+		balances = append(balances, &LedgerBalance{
+			Account: k.account,
+			ChainID: k.chainID,
+			Debits:  debit.String(),
+			Credits: credits[k].String(),
+			Balance: new(big.Int).Sub(debit, credits[k]).String(),
+		})
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].ChainID != balances[j].ChainID {
+			return balances[i].ChainID < balances[j].ChainID
+		}
+		return balances[i].Account < balances[j].Account
+	})
+
+	return balances, nil
+}
+
+// BookLedger books every confirmed or failed transaction in the history not
+// yet in the ledger, returning how many it booked. Entries are keyed by the
+// transaction hash, so a transaction is only ever booked once.
+func BookLedger() (int, error) {
+	historyMu.Lock()
+	var records []TransactionRecord
+	for _, status := range []string{StatusConfirmed, StatusFailed} {
+		found, err := history.list(TransactionFilter{Status: status})
+		if err != nil {
+			historyMu.Unlock()
+			return 0, err
+		}
+		records = append(records, found...)
+	}
+	historyMu.Unlock()
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+
+	entries, err := readLedger()
+	if err != nil {
+		return 0, err
+	}
+	booked := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		booked[entry.ID] = true
+	}
+
+	var categorize func(uint64, common.Address) string
+	added := 0
+	for _, record := range records {
+		if booked[strings.ToLower(record.Hash)] {
+			continue
+		}
+		if categorize == nil {
+			if categorize, err = counterpartyCategories(); err != nil {
+				return 0, err
+			}
+		}
+		entry := ledgerEntryFor(record, categorize)
+		if entry == nil {
+			continue
+		}
+		entries = append(entries, entry)
+		booked[entry.ID] = true
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	if err := writeJSONFile(ledgerFile, entries); err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+// ledgerEntryFor makes the entry for a transaction, or nil for one that
+// neither side of is a wallet address.
+func ledgerEntryFor(record TransactionRecord, categorize func(uint64, common.Address) string) *LedgerEntry {
+	from, to := common.HexToAddress(record.From), common.HexToAddress(record.To)
+	fromCategory, toCategory := categorize(record.ChainID, from), categorize(record.ChainID, to)
+	if record.ContractAddress != "" {
+		toCategory = CategoryContractCreation
+	}
+
+	value, ok := new(big.Int).SetString(record.Value, 10)
+	if !ok || record.Status == StatusFailed {
+		value = new(big.Int)
+	}
+	fee := new(big.Int)
+	if price, ok := new(big.Int).SetString(record.EffectiveGasPrice, 10); ok {
+		fee.Mul(new(big.Int).SetUint64(record.GasUsed), price)
+	}
+
+	entry := &LedgerEntry{
+		ID:       strings.ToLower(record.Hash),
+		ChainID:  record.ChainID,
+		Value:    value.String(),
+		Fee:      fee.String(),
+		Status:   record.Status,
+		MinedAt:  record.MinedAt,
+		BookedAt: time.Now().UTC(),
+	}
+	var postings []LedgerPosting
+	debit := func(account string, amount *big.Int) {
+		if amount.Sign() > 0 {
+			postings = append(postings, LedgerPosting{Account: account, Debit: amount.String()})
+		}
+	}
+	credit := func(account string, amount *big.Int) {
+		if amount.Sign() > 0 {
+			postings = append(postings, LedgerPosting{Account: account, Credit: amount.String()})
+		}
+	}
+
+	// The sender pays the fee, so it is only the wallet's when the sender
+	// is a wallet address.
+	switch {
+	case fromCategory == CategoryInternal && toCategory == CategoryInternal:
+		entry.Direction, entry.Counterparty, entry.Category = DirectionInternal, to.Hex(), CategoryInternal
+		debit(LedgerWalletAccount(to.Hex()), value)
+		debit(LedgerFeesAccount, fee)
+		credit(LedgerWalletAccount(from.Hex()), new(big.Int).Add(value, fee))
+	case fromCategory == CategoryInternal:
+		entry.Direction, entry.Counterparty, entry.Category = DirectionOutgoing, to.Hex(), toCategory
+		debit(ledgerCounterpartyPrefix+toCategory, value)
+		debit(LedgerFeesAccount, fee)
+		credit(LedgerWalletAccount(from.Hex()), new(big.Int).Add(value, fee))
+	case toCategory == CategoryInternal:
+		entry.Direction, entry.Counterparty, entry.Category = DirectionIncoming, from.Hex(), fromCategory
+		entry.Fee = "0"
+		debit(LedgerWalletAccount(to.Hex()), value)
+		credit(ledgerCounterpartyPrefix+fromCategory, value)
+	default:
+		return nil
+	}
+	entry.Postings = postings
+	if entry.Postings == nil {
+		entry.Postings = []LedgerPosting{}
+	}
+
+	return entry
+}
+
+// counterpartyCategories returns a function that puts an address on a chain
+// in its category: internal for a wallet address, exchange for a known
+// exchange deposit address, the first label of its address book entry (or
+// address_book without one), and external otherwise.
+func counterpartyCategories() (func(uint64, common.Address) string, error) {
+	wallet, err := walletAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	exchangesMu.Lock()
+	exchanges, err := readExchanges()
+	exchangesMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	addressBookMu.Lock()
+	book, err := readAddressBook()
+	addressBookMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(chainID uint64, address common.Address) string {
+		if wallet[address] {
+			return CategoryInternal
+		}
+		for _, exchange := range exchanges {
+			if exchange.Address == address.Hex() && (exchange.ChainID == 0 || exchange.ChainID == chainID) {
+				return CategoryExchange
+			}
+		}
+		for _, entry := range book {
+			if entry.Address == address.Hex() && (entry.ChainID == 0 || entry.ChainID == chainID) {
+				if len(entry.Labels) > 0 {
+					return entry.Labels[0]
+				}
+				return CategoryAddressBook
+			}
+		}
+		return CategoryExternal
+	}, nil
+}
+
+// posts reports whether the entry has a posting to account.
+func (e *LedgerEntry) posts(account string) bool {
+	for _, posting := range e.Postings {
+		if strings.EqualFold(posting.Account, account) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readLedger() ([]*LedgerEntry, error) {
+	var entries []*LedgerEntry
+	if err := readJSONFile(ledgerFile, &entries); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return entries, nil
+}
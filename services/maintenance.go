@@ -0,0 +1,548 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maintenance mode keeps the wallet answering reads while nothing is signed,
+// for instance while a node is upgraded or keys are rotated. Requests that
+// would sign or send are accepted and held, in the order they arrived, and
+// are carried out as their caller once maintenance ends, unless they expire
+// first. Scheduled transactions and jobs wait for the end of maintenance too.
+
+// Statuses of a held request.
+const (
+	HeldStatusQueued    = "queued"
+	HeldStatusCompleted = "completed"
+	HeldStatusExpired   = "expired"
+	HeldStatusCancelled = "cancelled"
+)
+
+const (
+	defaultHoldTTL   = time.Hour
+	defaultHoldLimit = 1000
+
+	// heldRetention is how long the outcome of a held request stays
+	// available after it is carried out, expires or is cancelled.
+	heldRetention = 24 * time.Hour
+
+	maintenanceInterval = 5 * time.Second
+)
+
+// Maintenance is whether the wallet is in maintenance. Until, when set, ends
+// it on its own.
+type Maintenance struct {
+	Enabled   bool       `json:"enabled"`
+	Reason    string     `json:"reason,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Held      int        `json:"held"`
+}
+
+// HeldRequest is a request accepted during maintenance. The caller's
+// credentials are not kept, only who they were, and a request is not held
+// past the expiry of the token it was made with. A body carrying a password
+// or a key is kept in memory only, as InMemory says, and the request expires
+// if the wallet restarts while it is queued. Position counts from 1 at the
+// front of the queue while it is queued.
+type HeldRequest struct {
+	ID          string            `json:"id"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	Header      map[string]string `json:"header,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+	InMemory    bool              `json:"in_memory,omitempty"`
+	RemoteAddr  string            `json:"remote_addr,omitempty"`
+	Principal   *Principal        `json:"principal,omitempty"`
+	Status      string            `json:"status"`
+	Position    int               `json:"position,omitempty"`
+	Response    *HeldResponse     `json:"response,omitempty"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+	CreatedAt   time.Time         `json:"created_at"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+}
+
+// HeldResponse is what a held request got when it was carried out.
+type HeldResponse struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type maintenanceState struct {
+	Maintenance Maintenance    `json:"maintenance"`
+	Held        []*HeldRequest `json:"held"`
+}
+
+var (
+	maintenanceFile = "maintenance.json"
+	maintenanceMu   sync.Mutex
+
+	// heldBodies are the bodies of held requests that carry secrets, by ID.
+	heldBodies = map[string][]byte{}
+
+	// maintenanceEnded wakes the queue as soon as maintenance ends.
+	maintenanceEnded = make(chan struct{}, 1)
+)
+
+var (
+	ErrNotInMaintenance   = errors.New("the wallet is not in maintenance")
+	ErrHeldQueueFull      = errors.New("too many requests are held for maintenance")
+	ErrHeldNotFound       = errors.New("held request not found")
+	ErrHeldNotQueued      = errors.New("held request is no longer queued")
+	ErrInvalidMaintenance = errors.New("invalid maintenance")
+)
+
+// GetMaintenance returns the maintenance state, counting the requests held.
+func GetMaintenance() (*Maintenance, error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	state, err := readMaintenance()
+	if err != nil {
+		return nil, err
+	}
+
+	return maintenanceSummary(state), nil
+}
+
+// InMaintenance reports whether the wallet is in maintenance. It errs
+// towards yes, so that a data file that cannot be read holds sends back
+// rather than letting them through.
+func InMaintenance() bool {
+	maintenance, err := GetMaintenance()
+	return err != nil || maintenance.Enabled
+}
+
+// StartMaintenance puts the wallet in maintenance, until ended or, if until
+// is set, until then. Starting it again changes the reason and end time.
+func StartMaintenance(reason string, until *time.Time) (*Maintenance, error) {
+	now := time.Now().UTC()
+	if until != nil && !until.After(now) {
+		return nil, fmt.Errorf("%w: until must be in the future", ErrInvalidMaintenance)
+	}
+
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	state, err := readMaintenance()
+	if err != nil {
+		return nil, err
+	}
+
+	if !state.Maintenance.Enabled {
+		state.Maintenance = Maintenance{Enabled: true, StartedAt: &now}
+	}
+	state.Maintenance.Reason = reason
+	state.Maintenance.Until = until
+	if err := writeJSONFile(maintenanceFile, state); err != nil {
+		return nil, err
+	}
+
+	recordAudit("maintenance.started", fmt.Sprintf("maintenance started: %s", reason),
+		map[string]interface{}{"reason": reason, "until": until})
+	return maintenanceSummary(state), nil
+}
+
+// EndMaintenance ends maintenance and lets the held requests go ahead.
+func EndMaintenance() (*Maintenance, error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	state, err := readMaintenance()
+	if err != nil {
+		return nil, err
+	}
+	if !state.Maintenance.Enabled {
+		return nil, ErrNotInMaintenance
+	}
+
+	endMaintenance(state, "api")
+	if err := writeJSONFile(maintenanceFile, state); err != nil {
+		return nil, err
+	}
+
+	return maintenanceSummary(state), nil
+}
+
+func endMaintenance(state *maintenanceState, trigger string) {
+	now := time.Now().UTC()
+	state.Maintenance.Enabled = false
+	state.Maintenance.Until = nil
+	state.Maintenance.EndedAt = &now
+
+	recordAudit("maintenance.ended", fmt.Sprintf("maintenance ended (%s)", trigger),
+		map[string]interface{}{"trigger": trigger, "held": len(queuedRequests(state))})
+
+	select {
+	case maintenanceEnded <- struct{}{}:
+	default:
+	}
+}
+
+// HoldRequest holds a request until maintenance ends, for MAINTENANCE_HOLD_TTL
+// (default an hour) at most. It fails with ErrNotInMaintenance if
+// maintenance has ended, when the request can go ahead as usual.
+func HoldRequest(held HeldRequest) (*HeldRequest, error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	state, err := readMaintenance()
+	if err != nil {
+		return nil, err
+	}
+	if !state.Maintenance.Enabled {
+		return nil, ErrNotInMaintenance
+	}
+
+	queued := queuedRequests(state)
+	if len(queued) >= holdLimit() {
+		return nil, ErrHeldQueueFull
+	}
+
+	now := time.Now().UTC()
+	held.ID = newID()
+	held.Status = HeldStatusQueued
+	held.CreatedAt = now
+	held.ExpiresAt = now.Add(holdTTL())
+	if held.Principal != nil && held.Principal.ExpiresAt != nil && held.Principal.ExpiresAt.Before(held.ExpiresAt) {
+		held.ExpiresAt = held.Principal.ExpiresAt.UTC()
+	}
+
+	if carriesSecret(held.Body) {
+		heldBodies[held.ID] = held.Body
+		held.Body = nil
+		held.InMemory = true
+	}
+
+	state.Held = append(state.Held, &held)
+	if err := writeJSONFile(maintenanceFile, state); err != nil {
+		delete(heldBodies, held.ID)
+		return nil, err
+	}
+
+	recordAudit("maintenance.held", fmt.Sprintf("%s %s held for maintenance", held.Method, held.Path),
+		map[string]interface{}{"held_id": held.ID, "position": len(queued) + 1})
+	return heldView(&held, len(queued)+1), nil
+}
+
+// ListHeldRequests lists the queued requests in the order they will be
+// carried out, then those already finished with, without their bodies.
+func ListHeldRequests() ([]*HeldRequest, error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	state, err := readMaintenance()
+	if err != nil {
+		return nil, err
+	}
+
+	listed := []*HeldRequest{}
+	queued := queuedRequests(state)
+	for i, held := range queued {
+		listed = append(listed, heldView(held, i+1))
+	}
+	for _, held := range state.Held {
+		if held.Status != HeldStatusQueued {
+			listed = append(listed, heldView(held, 0))
+		}
+	}
+
+	return listed, nil
+}
+
+func GetHeldRequest(id string) (*HeldRequest, error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	state, err := readMaintenance()
+	if err != nil {
+		return nil, err
+	}
+
+	return findHeld(state, id)
+}
+
+// CancelHeldRequest drops a queued request, so it is never carried out.
+func CancelHeldRequest(id string) (*HeldRequest, error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	state, err := readMaintenance()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, held := range state.Held {
+		if held.ID != id {
+			continue
+		}
+		if held.Status != HeldStatusQueued {
+			return nil, ErrHeldNotQueued
+		}
+
+		now := time.Now().UTC()
+		held.Status = HeldStatusCancelled
+		held.CompletedAt = &now
+		if err := writeJSONFile(maintenanceFile, state); err != nil {
+			return nil, err
+		}
+		delete(heldBodies, id)
+
+		recordAudit("maintenance.cancelled", fmt.Sprintf("held request %s cancelled", id),
+			map[string]interface{}{"held_id": id})
+		return heldView(held, 0), nil
+	}
+
+	return nil, ErrHeldNotFound
+}
+
+// StartMaintenanceQueue ends maintenance when its end time comes, expires
+// held requests and, once maintenance is over, carries out the rest one at a
+// time in the order they arrived, with replay.
+func StartMaintenanceQueue(replay func(*HeldRequest) HeldResponse) {
+	go func() {
+		ticker := time.NewTicker(maintenanceInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := releaseHeldRequests(replay); err != nil {
+				log.Printf("maintenance: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-maintenanceEnded:
+			}
+		}
+	}()
+}
+
+func releaseHeldRequests(replay func(*HeldRequest) HeldResponse) error {
+	for {
+		held, err := nextHeldRequest()
+		if err != nil || held == nil {
+			return err
+		}
+
+		response := replay(held)
+		if err := completeHeldRequest(held.ID, response); err != nil {
+			return err
+		}
+	}
+}
+
+// nextHeldRequest tidies the queue and returns the request to carry out
+// next, or nil if there is none or maintenance is still on.
+func nextHeldRequest() (*HeldRequest, error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	state, err := readMaintenance()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	changed := false
+	if state.Maintenance.Enabled && state.Maintenance.Until != nil && !now.Before(*state.Maintenance.Until) {
+		endMaintenance(state, "until")
+		changed = true
+	}
+
+	kept := state.Held[:0]
+	for _, held := range state.Held {
+		_, inMemory := heldBodies[held.ID]
+		lost := held.InMemory && !inMemory
+		if held.Status == HeldStatusQueued && (!now.Before(held.ExpiresAt) || lost) {
+			held.Status = HeldStatusExpired
+			held.CompletedAt = &now
+			held.Body = nil
+			delete(heldBodies, held.ID)
+			changed = true
+			reason := "expired"
+			if lost {
+				reason = "lost its body when the wallet restarted"
+			}
+			recordAudit("maintenance.expired", fmt.Sprintf("held request %s %s", held.ID, reason),
+				map[string]interface{}{"held_id": held.ID})
+		}
+		if held.CompletedAt != nil && now.Sub(*held.CompletedAt) > heldRetention {
+			changed = true
+			continue
+		}
+		kept = append(kept, held)
+	}
+	state.Held = kept
+
+	if changed {
+		if err := writeJSONFile(maintenanceFile, state); err != nil {
+			return nil, err
+		}
+	}
+
+	queued := queuedRequests(state)
+	if state.Maintenance.Enabled || len(queued) == 0 {
+		return nil, nil
+	}
+
+	next := queued[0]
+	if next.InMemory {
+		next.Body = heldBodies[next.ID]
+	}
+	return next, nil
+}
+
+func completeHeldRequest(id string, response HeldResponse) error {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	state, err := readMaintenance()
+	if err != nil {
+		return err
+	}
+
+	var held *HeldRequest
+	for _, stored := range state.Held {
+		if stored.ID == id {
+			held = stored
+		}
+	}
+	if held == nil {
+		return ErrHeldNotFound
+	}
+
+	now := time.Now().UTC()
+	held.Status = HeldStatusCompleted
+	held.Response = &response
+	held.CompletedAt = &now
+	held.Body = nil
+	if err := writeJSONFile(maintenanceFile, state); err != nil {
+		return err
+	}
+	delete(heldBodies, id)
+
+	recordAudit("maintenance.released", fmt.Sprintf("held request %s carried out: %d", id, response.Status),
+		map[string]interface{}{"held_id": id, "status": response.Status})
+	return nil
+}
+
+func findHeld(state *maintenanceState, id string) (*HeldRequest, error) {
+	for i, held := range queuedRequests(state) {
+		if held.ID == id {
+			return heldView(held, i+1), nil
+		}
+	}
+	for _, held := range state.Held {
+		if held.ID == id {
+			return heldView(held, 0), nil
+		}
+	}
+
+	return nil, ErrHeldNotFound
+}
+
+func queuedRequests(state *maintenanceState) []*HeldRequest {
+	var queued []*HeldRequest
+	for _, held := range state.Held {
+		if held.Status == HeldStatusQueued {
+			queued = append(queued, held)
+		}
+	}
+
+	return queued
+}
+
+// heldView is a copy of a held request to hand out, with its position and
+// without the request it holds.
+func heldView(held *HeldRequest, position int) *HeldRequest {
+	view := *held
+	view.Position = position
+	view.Header = nil
+	view.Body = nil
+	view.RemoteAddr = ""
+	return &view
+}
+
+// secretFields are the parts of a field name that mark a request body as
+// carrying a secret.
+var secretFields = []string{"password", "passphrase", "mnemonic", "private_key", "privatekey", "seed", "secret"}
+
+// carriesSecret reports whether a JSON body has a field named like a
+// secret, at any depth.
+func carriesSecret(body []byte) bool {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return false
+	}
+
+	var walk func(v interface{}) bool
+	walk = func(v interface{}) bool {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				name := strings.ToLower(key)
+				for _, field := range secretFields {
+					if strings.Contains(name, field) {
+						return true
+					}
+				}
+				if walk(value) {
+					return true
+				}
+			}
+		case []interface{}:
+			for _, value := range v {
+				if walk(value) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	return walk(v)
+}
+
+func maintenanceSummary(state *maintenanceState) *Maintenance {
+	summary := state.Maintenance
+	summary.Held = len(queuedRequests(state))
+	return &summary
+}
+
+func holdTTL() time.Duration {
+	if raw := os.Getenv("MAINTENANCE_HOLD_TTL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+
+	return defaultHoldTTL
+}
+
+func holdLimit() int {
+	if raw := os.Getenv("MAINTENANCE_HOLD_LIMIT"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			return n
+		}
+	}
+
+	return defaultHoldLimit
+}
+
+func readMaintenance() (*maintenanceState, error) {
+	state := &maintenanceState{}
+	if err := readJSONFile(maintenanceFile, state); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return state, nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jabbala-dev/go-wallet/models"
+)
+
+var ErrInvalidMemo = errors.New("invalid memo")
+
+// MemoData checks a memo for a plain transfer to toAddress and returns it
+// as the transaction's data. Only accounts without code take one: a
+// contract would receive the memo as a call, which it is likely to reject
+// or, worse, act on.
+func MemoData(chain *Chain, toAddress, memo string) ([]byte, error) {
+	switch {
+	case !utf8.ValidString(memo):
+		return nil, fmt.Errorf("%w: not UTF-8", ErrInvalidMemo)
+	case len(memo) > models.MaxMemoBytes:
+		return nil, fmt.Errorf("%w: longer than %d bytes", ErrInvalidMemo, models.MaxMemoBytes)
+	case !common.IsHexAddress(toAddress):
+		return nil, errors.New("invalid recipient address")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcReadTimeout)
+	defer cancel()
+
+	contract, err := isContract(ctx, chain, common.HexToAddress(toAddress))
+	if err != nil {
+		return nil, err
+	}
+	if contract {
+		return nil, fmt.Errorf("%w: the recipient is a contract, which would take the memo as a call", ErrInvalidMemo)
+	}
+
+	return []byte(memo), nil
+}
+
+// MemoGas is what carrying data costs on top of a plain transfer.
+func MemoGas(data []byte) uint64 {
+	return AnalyzeCalldata(data).CalldataGas
+}
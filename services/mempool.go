@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const broadcastInterval = 15 * time.Second
+
+// PendingBroadcast is a signed transaction the node could not be reached to
+// accept. It keeps its nonce slot: later sends from the same account are
+// numbered after it, and it is rebroadcast once the endpoint is reachable.
+type PendingBroadcast struct {
+	Hash      string    `json:"hash"`
+	ChainID   uint64    `json:"chain_id,omitempty"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Value     string    `json:"value"`
+	Nonce     uint64    `json:"nonce"`
+	RawTx     string    `json:"raw_transaction"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var (
+	broadcastFile = "broadcast_queue.json"
+	broadcastMu   sync.Mutex
+)
+
+func ListPendingBroadcasts() ([]*PendingBroadcast, error) {
+	broadcastMu.Lock()
+	defer broadcastMu.Unlock()
+
+	return readBroadcastQueue()
+}
+
+func StartBroadcaster() {
+	go func() {
+		ticker := time.NewTicker(broadcastInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := rebroadcastQueued(); err != nil {
+				log.Printf("broadcaster: %v", err)
+			}
+		}
+	}()
+}
+
+// isConnectivityError reports whether a failed broadcast may have never reached
+// the node. Errors the node itself returned are final and are not queued.
+func isConnectivityError(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return false
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+
+	return true
+}
+
+func queueBroadcast(tx *types.Transaction, from common.Address, sendErr error) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	broadcastMu.Lock()
+	defer broadcastMu.Unlock()
+
+	queue, err := readBroadcastQueue()
+	if err != nil {
+		return err
+	}
+
+	queue = append(queue, &PendingBroadcast{
+		Hash:      tx.Hash().Hex(),
+		ChainID:   tx.ChainId().Uint64(),
+		From:      from.Hex(),
+		To:        tx.To().Hex(),
+		Value:     tx.Value().String(),
+		Nonce:     tx.Nonce(),
+		RawTx:     hexutil.Encode(raw),
+		Attempts:  1,
+		LastError: sendErr.Error(),
+		CreatedAt: time.Now().UTC(),
+	})
+
+	return writeJSONFile(broadcastFile, queue)
+}
+
+func rebroadcastQueued() error {
+	broadcastMu.Lock()
+	defer broadcastMu.Unlock()
+
+	queue, err := readBroadcastQueue()
+	if err != nil || len(queue) == 0 {
+		return err
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		return queue[i].Nonce < queue[j].Nonce
+	})
+
+	var remaining []*PendingBroadcast
+	blocked := map[uint64]bool{}
+	for _, pending := range queue {
+		if blocked[pending.ChainID] {
+			remaining = append(remaining, pending)
+			continue
+		}
+
+		status, err := rebroadcast(pending)
+		if err != nil {
+			// The chain's endpoint is still unreachable, so the rest of its
+			// queue would fail too.
+			pending.Attempts++
+			pending.LastError = err.Error()
+			remaining = append(remaining, pending)
+			blocked[pending.ChainID] = true
+			continue
+		}
+
+		if err := setTransactionStatus(pending.Hash, status); err != nil {
+			log.Printf("broadcaster: failed to update %s: %v", pending.Hash, err)
+		}
+	}
+
+	return writeJSONFile(broadcastFile, remaining)
+}
+
+// rebroadcast returns the history status the transaction moves to, or an
+// error if it should stay queued.
+func rebroadcast(pending *PendingBroadcast) (string, error) {
+	raw, err := hexutil.Decode(pending.RawTx)
+	if err != nil {
+		log.Printf("broadcaster: dropping %s: %v", pending.Hash, err)
+		return StatusFailed, nil
+	}
+
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		log.Printf("broadcaster: dropping %s: %v", pending.Hash, err)
+		return StatusFailed, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcReadTimeout)
+	defer cancel()
+
+	chain, err := chainByID(ctx, pending.ChainID)
+	if err != nil {
+		return "", err
+	}
+
+	err = chain.client.SendTransaction(ctx, tx)
+	if err == nil {
+		return StatusPending, nil
+	}
+	if isConnectivityError(err) {
+		return "", err
+	}
+
+	// A rejection such as "already known" or "nonce too low" may simply mean
+	// an earlier attempt got through before its response was lost.
+	if _, _, lookupErr := chain.client.TransactionByHash(ctx, tx.Hash()); lookupErr == nil {
+		return StatusPending, nil
+	}
+
+	log.Printf("broadcaster: %s rejected: %v", pending.Hash, err)
+	return StatusFailed, nil
+}
+
+func readBroadcastQueue() ([]*PendingBroadcast, error) {
+	var queue []*PendingBroadcast
+	if err := readJSONFile(broadcastFile, &queue); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return queue, nil
+}
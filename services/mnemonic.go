@@ -0,0 +1,94 @@
+package services
+
+import (
+	"github.com/jabbala-dev/go-wallet/hdwallet"
+)
+
+const defaultMnemonicWords = 12
+
+// MnemonicAccount is an HD account created from a new mnemonic. The
+// mnemonic is only ever returned here: the wallet keeps the seed, not the
+// words, so they must be written down now.
+type MnemonicAccount struct {
+	Mnemonic string     `json:"mnemonic"`
+	Account  *HDAccount `json:"account"`
+	Address  string     `json:"address"`
+}
+
+// GenerateMnemonic creates an HD account from a new BIP-39 mnemonic of
+// words words (12 if zero) and optional passphrase, its seed encrypted under
+// password, derives its first address (m/44'/60'/0'/0/0) and selects it.
+func GenerateMnemonic(name string, words int, passphrase, password string) (*MnemonicAccount, error) {
+	if words == 0 {
+		words = defaultMnemonicWords
+	}
+
+	mnemonic, err := hdwallet.GenerateMnemonic(words)
+	if err != nil {
+		return nil, err
+	}
+
+	hd, err := newSeededHDAccount(name, hdwallet.MnemonicToSeed(mnemonic, passphrase), password)
+	if err != nil {
+		return nil, err
+	}
+	address, err := DeriveHDAddress(hd.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := SelectAccount(address.Address); err != nil {
+		return nil, err
+	}
+
+	hd, err = GetHDAccount(hd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MnemonicAccount{Mnemonic: mnemonic, Account: hd, Address: address.Address}, nil
+}
+
+// RecoverMnemonic restores the HD account of a BIP-39 mnemonic and optional
+// passphrase, its seed encrypted under password, and scans it for used
+// addresses as RestoreHDAccount does.
+// Unlike a restore, the mnemonic must pass the BIP-39 checksum, which
+// catches a mistyped or misordered word before it silently yields a
+// different, empty wallet. Recovering a mnemonic the wallet already has
+// rescans the existing account. The first address is always registered, so
+// even a wallet with no activity yet can sign.
+func RecoverMnemonic(name, mnemonic, passphrase, password string, limit int) (*HDScanResult, error) {
+	if err := hdwallet.ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	seed := hdwallet.MnemonicToSeed(mnemonic, passphrase)
+
+	existing, err := findSeededHDAccount(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *HDScanResult
+	if existing != nil {
+		result, err = ScanHDAccount(existing.ID, limit)
+	} else {
+		var hd *HDAccount
+		if hd, err = newSeededHDAccount(name, seed, password); err != nil {
+			return nil, err
+		}
+		result, err = ScanHDAccount(hd.ID, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Account.Addresses) == 0 {
+		address, err := DeriveHDAddress(result.Account.ID)
+		if err != nil {
+			return nil, err
+		}
+		result.Account.Addresses = append(result.Account.Addresses, *address)
+		result.Registered = append(result.Registered, address.Address)
+	}
+
+	return result, nil
+}
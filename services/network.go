@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Network is a well-known chain that can be configured by name, in NETWORKS
+// or as the network of an RPC_CONFIG entry, instead of spelling out its RPC
+// URL and chain ID. Its RPC URL is <NAME>_RPC_URL if set, such as
+// SEPOLIA_RPC_URL, or else Infura's endpoint for INFURA_PROJECT_ID.
+// ShortName is its EIP-3770 address prefix, from ethereum-lists/chains.
+type Network struct {
+	Name      string `json:"name"`
+	ChainID   uint64 `json:"chain_id"`
+	ShortName string `json:"short_name"`
+	Currency  string `json:"currency"`
+
+	infura string
+}
+
+// NetworkInfo describes a network for API responses. Configured networks are
+// served by an RPC endpoint, named Endpoint, and can be picked by a request's
+// chain_id or selected for all requests that do not pick one.
+type NetworkInfo struct {
+	Name       string `json:"name"`
+	ChainID    uint64 `json:"chain_id"`
+	ShortName  string `json:"short_name,omitempty"`
+	Currency   string `json:"currency,omitempty"`
+	Configured bool   `json:"configured"`
+	Endpoint   string `json:"endpoint,omitempty"`
+	Selected   bool   `json:"selected"`
+}
+
+// networkSelection is the network requests go to when they do not pick one.
+// It is kept by chain ID, so renaming an endpoint does not lose it.
+type networkSelection struct {
+	ChainID uint64 `json:"chain_id"`
+}
+
+var knownNetworks = []Network{
+	{Name: "mainnet", ChainID: 1, ShortName: "eth", Currency: "ETH", infura: "mainnet"},
+	{Name: "sepolia", ChainID: 11155111, ShortName: "sep", Currency: "ETH", infura: "sepolia"},
+	{Name: "holesky", ChainID: 17000, ShortName: "holesky", Currency: "ETH", infura: "holesky"},
+	{Name: "polygon", ChainID: 137, ShortName: "pol", Currency: "POL", infura: "polygon-mainnet"},
+	{Name: "arbitrum", ChainID: 42161, ShortName: "arb1", Currency: "ETH", infura: "arbitrum-mainnet"},
+	{Name: "optimism", ChainID: 10, ShortName: "oeth", Currency: "ETH", infura: "optimism-mainnet"},
+}
+
+// legacyShortNames are prefixes retired from ethereum-lists but still
+// written by wallets, such as the Safe UI's "matic:".
+var legacyShortNames = map[string]uint64{"matic": 137}
+
+var (
+	networkFile = "network.json"
+	networkMu   sync.Mutex
+)
+
+var (
+	ErrUnknownNetwork = errors.New("unknown network")
+	ErrChainMismatch  = errors.New("address is for another chain")
+)
+
+// ListNetworks describes the well-known networks, then any other configured
+// chains.
+func ListNetworks() ([]NetworkInfo, error) {
+	ctx := context.Background()
+
+	chains, err := chainRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedChain(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	configured := make(map[uint64]*Chain, len(chains))
+	for _, chain := range chains {
+		configured[chain.ID.Uint64()] = chain
+	}
+
+	infos := make([]NetworkInfo, 0, len(knownNetworks)+len(chains))
+	for _, network := range knownNetworks {
+		info := NetworkInfo{Name: network.Name, ChainID: network.ChainID, ShortName: network.ShortName, Currency: network.Currency}
+		if chain, ok := configured[network.ChainID]; ok {
+			info.Configured, info.Endpoint = true, chain.Name
+			delete(configured, network.ChainID)
+		}
+		infos = append(infos, info)
+	}
+	for _, chain := range chains {
+		if _, ok := configured[chain.ID.Uint64()]; ok {
+			infos = append(infos, NetworkInfo{Name: chain.Name, ChainID: chain.ID.Uint64(), ShortName: chain.ShortName, Configured: true, Endpoint: chain.Name})
+		}
+	}
+
+	for i := range infos {
+		infos[i].Selected = infos[i].Configured && infos[i].ChainID == selected.ID.Uint64()
+	}
+
+	return infos, nil
+}
+
+// SelectNetwork makes the configured chain given by ID, endpoint name or
+// network name the one requests go to when they do not pick one.
+func SelectNetwork(selector string) (*ChainInfo, error) {
+	if strings.TrimSpace(selector) == "" {
+		return nil, fmt.Errorf("%w: a network is required", ErrUnknownChain)
+	}
+
+	chain, err := ResolveChain(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	networkMu.Lock()
+	err = writeJSONFile(networkFile, networkSelection{ChainID: chain.ID.Uint64()})
+	networkMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit("network.selected", fmt.Sprintf("selected chain %s (%s)", chain.ID, chain.Name),
+		map[string]interface{}{"chain_id": chain.ID.Uint64(), "name": chain.Name})
+	return &ChainInfo{ChainID: chain.ID.Uint64(), Name: chain.Name, ShortName: chain.ShortName, Default: true}, nil
+}
+
+// selectedChain is the chain requests without a chain_id go to: the selected
+// network, or the first endpoint's chain if none is selected. A selection
+// whose chain is no longer configured is ignored.
+func selectedChain(ctx context.Context) (*Chain, error) {
+	var selection networkSelection
+	networkMu.Lock()
+	err := readJSONFile(networkFile, &selection)
+	networkMu.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if selection.ChainID == 0 {
+		return defaultChain(ctx)
+	}
+
+	chain, err := chainByID(ctx, selection.ChainID)
+	if errors.Is(err, ErrUnknownChain) {
+		return defaultChain(ctx)
+	}
+
+	return chain, err
+}
+
+// ParseChainAddress strips the EIP-3770 prefix from an address given for
+// chain, such as "oeth:" in "oeth:0x...". The prefix must be chain's short
+// name, so that an address copied for one chain is refused rather than paid
+// on another. Values without a prefix, including ENS names, are returned
+// as they are.
+func ParseChainAddress(chain *Chain, value string) (string, error) {
+	prefix, address, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok {
+		return value, nil
+	}
+	if !common.IsHexAddress(address) {
+		return "", errors.New("invalid address")
+	}
+
+	if chain.ShortName != "" && prefix == chain.ShortName {
+		return address, nil
+	}
+	if id, ok := legacyShortNames[prefix]; ok && chain.ID.IsUint64() && chain.ID.Uint64() == id {
+		return address, nil
+	}
+
+	if chain.ShortName == "" {
+		return "", fmt.Errorf("%w: chain %s (%s) has no short name to check %s: against", ErrChainMismatch, chain.ID, chain.Name, prefix)
+	}
+	return "", fmt.Errorf("%w: %s: is not chain %s (%s), whose prefix is %s:", ErrChainMismatch, prefix, chain.ID, chain.Name, chain.ShortName)
+}
+
+// FormatChainAddress prefixes an address with chain's short name, or returns
+// it as it is if the chain has none.
+func FormatChainAddress(chain *Chain, address string) string {
+	if chain.ShortName == "" || !common.IsHexAddress(address) {
+		return address
+	}
+
+	return chain.ShortName + ":" + common.HexToAddress(address).Hex()
+}
+
+func knownNetwork(name string) (Network, bool) {
+	for _, network := range knownNetworks {
+		if strings.EqualFold(network.Name, strings.TrimSpace(name)) {
+			return network, true
+		}
+	}
+
+	return Network{}, false
+}
+
+func knownNetworkByID(id *big.Int) (Network, bool) {
+	for _, network := range knownNetworks {
+		if id.IsUint64() && id.Uint64() == network.ChainID {
+			return network, true
+		}
+	}
+
+	return Network{}, false
+}
+
+// applyNetwork fills in the name, URL and chain ID of an endpoint that names
+// a well-known network, leaving any it sets itself.
+func (e *RPCEndpoint) applyNetwork(s settings) error {
+	if e.Network == "" {
+		return nil
+	}
+
+	network, ok := knownNetwork(e.Network)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownNetwork, e.Network)
+	}
+	if e.ChainID != 0 && e.ChainID != network.ChainID {
+		return fmt.Errorf("RPC endpoint %s: chain ID %d is not %s's", e.Name, e.ChainID, network.Name)
+	}
+
+	if e.Name == "" {
+		e.Name = network.Name
+	}
+	if e.URL == "" {
+		e.URL = s.get(strings.ToUpper(network.Name) + "_RPC_URL")
+	}
+	if e.URL == "" {
+		e.URL = "https://" + network.infura + ".infura.io/v3/" + s.get("INFURA_PROJECT_ID")
+	}
+	e.ChainID = network.ChainID
+
+	return nil
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// NFTCollection is a contract on one chain; mints always go to that chain.
+type NFTCollection struct {
+	Name        string          `json:"name"`
+	ChainID     uint64          `json:"chain_id,omitempty"`
+	Address     string          `json:"address"`
+	ABI         json.RawMessage `json:"abi"`
+	MintMethod  string          `json:"mint_method"`
+	PriceMethod string          `json:"price_method,omitempty"`
+}
+
+// NFTToken is a token an account holds, either minted through a registered
+// collection or found by ScanNFTs. Balance is how many of an ERC-1155 token
+// the account holds.
+type NFTToken struct {
+	Collection string     `json:"collection,omitempty"`
+	ChainID    uint64     `json:"chain_id,omitempty"`
+	Contract   string     `json:"contract"`
+	Standard   string     `json:"standard,omitempty"`
+	TokenID    string     `json:"token_id"`
+	Balance    string     `json:"balance,omitempty"`
+	Owner      string     `json:"owner"`
+	TxHash     string     `json:"transaction_hash,omitempty"`
+	MintedAt   *time.Time `json:"minted_at,omitempty"`
+	ScannedAt  *time.Time `json:"scanned_at,omitempty"`
+}
+
+type MintResult struct {
+	TxHash   string `json:"transaction_hash"`
+	Value    string `json:"value"`
+	TokenURI string `json:"token_uri,omitempty"`
+}
+
+var (
+	nftCollectionsFile = "nft_collections.json"
+	nftInventoryFile   = "nft_inventory.json"
+	nftMu              sync.Mutex
+)
+
+var (
+	ErrCollectionNotFound = errors.New("collection not found")
+
+	erc721TransferTopic   = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	erc1155TransferSingle = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+	erc1155TransferBatch  = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+)
+
+func RegisterNFTCollection(collection NFTCollection) (*NFTCollection, error) {
+	if collection.Name == "" {
+		return nil, errors.New("collection name is required")
+	}
+	if !common.IsHexAddress(collection.Address) {
+		return nil, errors.New("invalid collection address")
+	}
+	if collection.MintMethod == "" {
+		collection.MintMethod = "mint"
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(string(collection.ABI)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ABI: %w", err)
+	}
+	if _, ok := parsed.Methods[collection.MintMethod]; !ok {
+		return nil, fmt.Errorf("ABI has no method %q", collection.MintMethod)
+	}
+	if collection.PriceMethod != "" {
+		if _, ok := parsed.Methods[collection.PriceMethod]; !ok {
+			return nil, fmt.Errorf("ABI has no method %q", collection.PriceMethod)
+		}
+	}
+
+	collection.Address = common.HexToAddress(collection.Address).Hex()
+
+	nftMu.Lock()
+	defer nftMu.Unlock()
+
+	collections, err := readNFTCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	collections[collection.Name] = &collection
+	if err := writeJSONFile(nftCollectionsFile, collections); err != nil {
+		return nil, err
+	}
+
+	return &collection, nil
+}
+
+func ListNFTCollections() ([]*NFTCollection, error) {
+	nftMu.Lock()
+	defer nftMu.Unlock()
+
+	collections, err := readNFTCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*NFTCollection, 0, len(collections))
+	for _, collection := range collections {
+		list = append(list, collection)
+	}
+
+	return list, nil
+}
+
+// MintNFT calls the collection's mint method. When value is nil and the
+// collection declares a price method, the current price is read on-chain and
+// attached to the transaction. Minted token IDs are recorded once the receipt
+// arrives. If metadata is given it is uploaded to IPFS first and its ipfs://
+// URI is appended as the last mint argument.
+func MintNFT(name string, rawArgs []json.RawMessage, value *big.Int, metadata json.RawMessage) (*MintResult, error) {
+	nftMu.Lock()
+	collections, err := readNFTCollections()
+	nftMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	collection, ok := collections[name]
+	if !ok {
+		return nil, ErrCollectionNotFound
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(string(collection.ABI)))
+	if err != nil {
+		return nil, err
+	}
+
+	var tokenURI string
+	if len(metadata) > 0 {
+		pin, err := UploadToIPFS(collection.Name+"-metadata.json", metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload metadata: %w", err)
+		}
+		tokenURI = "ipfs://" + pin.CID
+
+		uriArg, _ := json.Marshal(tokenURI)
+		rawArgs = append(rawArgs, uriArg)
+	}
+
+	method := parsed.Methods[collection.MintMethod]
+	args, err := packJSONArgs(method.Inputs, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := chainByID(context.Background(), collection.ChainID)
+	if err != nil {
+		return nil, err
+	}
+
+	contract := common.HexToAddress(collection.Address)
+	if value == nil {
+		value = big.NewInt(0)
+		if collection.PriceMethod != "" {
+			out, err := callContract(chain, contract, parsed, collection.PriceMethod)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read mint price: %w", err)
+			}
+			price, ok := out[0].(*big.Int)
+			if !ok {
+				return nil, errors.New("mint price method did not return uint256")
+			}
+			value = price
+		}
+	}
+	if value.Sign() > 0 && !method.IsPayable() {
+		return nil, fmt.Errorf("method %q is not payable", collection.MintMethod)
+	}
+
+	data, err := parsed.Pack(collection.MintMethod, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	txHash, err := sendContractTransaction(chain, signer, contract, value, data)
+	if err != nil {
+		return nil, err
+	}
+
+	go trackMintedTokens(chain, collection.Name, signer.Address(), common.HexToHash(txHash))
+
+	return &MintResult{TxHash: txHash, Value: value.String(), TokenURI: tokenURI}, nil
+}
+
+func ListNFTs(owner string) ([]NFTToken, error) {
+	nftMu.Lock()
+	defer nftMu.Unlock()
+
+	inventory, err := readNFTInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	if owner == "" {
+		return inventory, nil
+	}
+
+	var owned []NFTToken
+	for _, token := range inventory {
+		if strings.EqualFold(token.Owner, owner) {
+			owned = append(owned, token)
+		}
+	}
+
+	return owned, nil
+}
+
+func trackMintedTokens(chain *Chain, collection string, owner common.Address, txHash common.Hash) {
+	ctx, cancel := context.WithTimeout(context.Background(), receiptTimeout)
+	defer cancel()
+
+	receipt, err := waitForReceipt(ctx, chain, txHash)
+	if err != nil {
+		log.Printf("mint %s: %v", txHash.Hex(), err)
+		return
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		log.Printf("mint %s reverted", txHash.Hex())
+		return
+	}
+
+	minted := mintedTokenIDs(receipt, owner)
+	if len(minted) == 0 {
+		return
+	}
+
+	nftMu.Lock()
+	defer nftMu.Unlock()
+
+	inventory, err := readNFTInventory()
+	if err != nil {
+		log.Printf("mint %s: %v", txHash.Hex(), err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, token := range minted {
+		token.Collection = collection
+		token.ChainID = chain.ID.Uint64()
+		token.TxHash = txHash.Hex()
+		token.MintedAt = &now
+		inventory = append(inventory, token)
+	}
+
+	if err := writeJSONFile(nftInventoryFile, inventory); err != nil {
+		log.Printf("mint %s: %v", txHash.Hex(), err)
+	}
+}
+
+// mintedTokenIDs extracts ERC-721 Transfer and ERC-1155 TransferSingle events
+// minting from the zero address to owner.
+func mintedTokenIDs(receipt *types.Receipt, owner common.Address) []NFTToken {
+	var minted []NFTToken
+	for _, entry := range receipt.Logs {
+		switch {
+		case len(entry.Topics) == 4 && entry.Topics[0] == erc721TransferTopic:
+			from := common.BytesToAddress(entry.Topics[1].Bytes())
+			to := common.BytesToAddress(entry.Topics[2].Bytes())
+			if from != (common.Address{}) || to != owner {
+				continue
+			}
+			minted = append(minted, NFTToken{
+				Contract: entry.Address.Hex(),
+				Standard: NFTStandardERC721,
+				TokenID:  entry.Topics[3].Big().String(),
+				Owner:    to.Hex(),
+			})
+
+		case len(entry.Topics) == 4 && entry.Topics[0] == erc1155TransferSingle && len(entry.Data) >= 64:
+			from := common.BytesToAddress(entry.Topics[2].Bytes())
+			to := common.BytesToAddress(entry.Topics[3].Bytes())
+			if from != (common.Address{}) || to != owner {
+				continue
+			}
+			minted = append(minted, NFTToken{
+				Contract: entry.Address.Hex(),
+				Standard: NFTStandardERC1155,
+				TokenID:  new(big.Int).SetBytes(entry.Data[:32]).String(),
+				Balance:  new(big.Int).SetBytes(entry.Data[32:64]).String(),
+				Owner:    to.Hex(),
+			})
+		}
+	}
+
+	return minted
+}
+
+func readNFTCollections() (map[string]*NFTCollection, error) {
+	collections := map[string]*NFTCollection{}
+	if err := readJSONFile(nftCollectionsFile, &collections); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+func readNFTInventory() ([]NFTToken, error) {
+	var inventory []NFTToken
+	if err := readJSONFile(nftInventoryFile, &inventory); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return inventory, nil
+}
@@ -0,0 +1,526 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	NFTStandardERC721  = "erc721"
+	NFTStandardERC1155 = "erc1155"
+
+	// defaultNFTScanBlocks is how far back ScanNFTs looks for transfers to
+	// an account unless NFT_SCAN_BLOCKS says otherwise, and nftScanChunk how
+	// many blocks each log query covers, which endpoints limit.
+	defaultNFTScanBlocks = 50000
+	nftScanChunk         = 5000
+
+	// maxNFTMetadataBytes bounds a token's metadata document.
+	maxNFTMetadataBytes = 1 << 20
+)
+
+const erc721ABIJSON = `[
+	{"type":"function","name":"supportsInterface","stateMutability":"view","inputs":[{"name":"interfaceId","type":"bytes4"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"ownerOf","stateMutability":"view","inputs":[{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"tokenURI","stateMutability":"view","inputs":[{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"safeTransferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"id","type":"uint256"}],"outputs":[]},
+	{"type":"function","name":"safeTransferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"id","type":"uint256"},{"name":"data","type":"bytes"}],"outputs":[]}
+]`
+
+const erc1155ABIJSON = `[
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"uri","stateMutability":"view","inputs":[{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"safeTransferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"id","type":"uint256"},{"name":"amount","type":"uint256"},{"name":"data","type":"bytes"}],"outputs":[]},
+	{"type":"function","name":"safeBatchTransferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"ids","type":"uint256[]"},{"name":"amounts","type":"uint256[]"},{"name":"data","type":"bytes"}],"outputs":[]},
+	{"type":"event","name":"TransferBatch","anonymous":false,"inputs":[{"name":"operator","type":"address","indexed":true},{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"ids","type":"uint256[]","indexed":false},{"name":"values","type":"uint256[]","indexed":false}]}
+]`
+
+var (
+	erc721ABI  = mustParseABI(erc721ABIJSON)
+	erc1155ABI = mustParseABI(erc1155ABIJSON)
+
+	// ERC-165 interface IDs of the two standards.
+	erc721InterfaceID  = [4]byte{0x80, 0xac, 0x58, 0xcd}
+	erc1155InterfaceID = [4]byte{0xd9, 0xb6, 0x7a, 0x26}
+)
+
+var (
+	ErrNotNFT             = errors.New("not an ERC-721 or ERC-1155 contract")
+	ErrInvalidNFTTransfer = errors.New("invalid NFT transfer")
+	ErrNFTMetadata        = errors.New("NFT metadata unavailable")
+)
+
+// NFTMetadata is a token's metadata document as its contract points to it.
+// TokenURI is what the contract returns, MetadataURL where it was fetched
+// from and ImageURL the document's image made fetchable the same way.
+type NFTMetadata struct {
+	Contract    string          `json:"contract"`
+	Standard    string          `json:"standard"`
+	TokenID     string          `json:"token_id"`
+	TokenURI    string          `json:"token_uri"`
+	MetadataURL string          `json:"metadata_url,omitempty"`
+	ImageURL    string          `json:"image_url,omitempty"`
+	Metadata    json.RawMessage `json:"metadata"`
+}
+
+type NFTTransferResult struct {
+	TxHash   string   `json:"transaction_hash"`
+	Standard string   `json:"standard"`
+	Contract string   `json:"contract"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	TokenIDs []string `json:"token_ids"`
+	Amounts  []string `json:"amounts,omitempty"`
+}
+
+// ScanNFTs finds the NFTs an account, the selected one if empty, holds on
+// chain: tokens sent to it by ERC-721 Transfer or ERC-1155 TransferSingle
+// and TransferBatch events in the last NFT_SCAN_BLOCKS blocks, and those
+// already in the inventory, each confirmed by ownerOf or balanceOf. The
+// account's inventory on the chain is replaced with what is found, so
+// tokens it has since sent away drop out.
+func ScanNFTs(chain *Chain, account string) ([]NFTToken, error) {
+	ctx := context.Background()
+	started := time.Now().UTC()
+
+	address, err := AccountAddress(account)
+	if err != nil {
+		return nil, err
+	}
+	owner := common.HexToAddress(address)
+
+	nftMu.Lock()
+	inventory, err := readNFTInventory()
+	nftMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	type tokenKey struct {
+		contract common.Address
+		id       string
+	}
+	candidates := map[tokenKey]NFTToken{}
+	var order []tokenKey
+	add := func(token NFTToken) {
+		key := tokenKey{common.HexToAddress(token.Contract), token.TokenID}
+		if _, ok := candidates[key]; !ok {
+			order = append(order, key)
+		}
+		candidates[key] = token
+	}
+	for _, token := range inventory {
+		if token.ChainID == chain.ID.Uint64() && strings.EqualFold(token.Owner, owner.Hex()) {
+			add(token)
+		}
+	}
+
+	received, err := receivedNFTs(ctx, chain, owner)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range received {
+		if _, ok := candidates[tokenKey{common.HexToAddress(token.Contract), token.TokenID}]; !ok {
+			add(token)
+		}
+	}
+
+	held := []NFTToken{}
+	for _, key := range order {
+		token := candidates[key]
+		id, _ := new(big.Int).SetString(token.TokenID, 10)
+		if id == nil {
+			continue
+		}
+		if token.Standard == "" {
+			if token.Standard, err = nftStandard(ctx, chain, key.contract); err != nil {
+				if isConnectivityError(err) {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		balance, err := nftBalance(chain, key.contract, token.Standard, owner, id)
+		if err != nil {
+			if isConnectivityError(err) {
+				return nil, err
+			}
+			continue
+		}
+		if balance.Sign() == 0 {
+			continue
+		}
+		if token.Standard == NFTStandardERC1155 {
+			token.Balance = balance.String()
+		}
+		token.ChainID = chain.ID.Uint64()
+		token.Contract = key.contract.Hex()
+		token.Owner = owner.Hex()
+		token.ScannedAt = &started
+		held = append(held, token)
+	}
+
+	nftMu.Lock()
+	defer nftMu.Unlock()
+
+	// Read again and keep mints recorded while the chain was being asked.
+	inventory, err = readNFTInventory()
+	if err != nil {
+		return nil, err
+	}
+	kept := inventory[:0]
+	for _, token := range inventory {
+		mintedSince := token.MintedAt != nil && token.MintedAt.After(started)
+		if token.ChainID != chain.ID.Uint64() || !strings.EqualFold(token.Owner, owner.Hex()) || mintedSince {
+			kept = append(kept, token)
+		}
+	}
+	if err := writeJSONFile(nftInventoryFile, append(kept, held...)); err != nil {
+		return nil, err
+	}
+
+	return held, nil
+}
+
+// receivedNFTs lists the tokens transfer events in the scan window sent to
+// owner. ERC-20 Transfer events share the ERC-721 topic and are told apart
+// by their token amount not being indexed.
+func receivedNFTs(ctx context.Context, chain *Chain, owner common.Address) ([]NFTToken, error) {
+	head, err := chain.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	from := uint64(0)
+	if window := nftScanBlocks(); head > window {
+		from = head - window
+	}
+
+	topic := common.BytesToHash(owner.Bytes())
+	var tokens []NFTToken
+	for start := from; start <= head; start += nftScanChunk {
+		end := start + nftScanChunk - 1
+		if end > head {
+			end = head
+		}
+		for _, topics := range [][][]common.Hash{
+			{{erc721TransferTopic}, nil, {topic}},
+			{{erc1155TransferSingle, erc1155TransferBatch}, nil, nil, {topic}},
+		} {
+			logs, err := chain.client.FilterLogs(ctx, ethereum.FilterQuery{
+				FromBlock: new(big.Int).SetUint64(start),
+				ToBlock:   new(big.Int).SetUint64(end),
+				Topics:    topics,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, entry := range logs {
+				contract := entry.Address.Hex()
+				switch {
+				case entry.Topics[0] == erc721TransferTopic && len(entry.Topics) == 4:
+					tokens = append(tokens, NFTToken{Contract: contract, Standard: NFTStandardERC721, TokenID: entry.Topics[3].Big().String()})
+
+				case entry.Topics[0] == erc1155TransferSingle && len(entry.Data) >= 64:
+					tokens = append(tokens, NFTToken{Contract: contract, Standard: NFTStandardERC1155, TokenID: new(big.Int).SetBytes(entry.Data[:32]).String()})
+
+				case entry.Topics[0] == erc1155TransferBatch:
+					out, err := erc1155ABI.Unpack("TransferBatch", entry.Data)
+					if err != nil || len(out) != 2 {
+						continue
+					}
+					ids, _ := out[0].([]*big.Int)
+					for _, id := range ids {
+						tokens = append(tokens, NFTToken{Contract: contract, Standard: NFTStandardERC1155, TokenID: id.String()})
+					}
+				}
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+func nftScanBlocks() uint64 {
+	if raw := os.Getenv("NFT_SCAN_BLOCKS"); raw != "" {
+		if blocks, err := strconv.ParseUint(raw, 10, 64); err == nil && blocks > 0 {
+			return blocks
+		}
+	}
+
+	return defaultNFTScanBlocks
+}
+
+// nftStandard asks a contract by ERC-165 which standard it implements.
+func nftStandard(ctx context.Context, chain *Chain, contract common.Address) (string, error) {
+	for _, standard := range []string{NFTStandardERC721, NFTStandardERC1155} {
+		id := erc721InterfaceID
+		if standard == NFTStandardERC1155 {
+			id = erc1155InterfaceID
+		}
+		out, err := callContract(chain, contract, erc721ABI, "supportsInterface", id)
+		if err != nil {
+			if isConnectivityError(err) {
+				return "", err
+			}
+			return "", fmt.Errorf("%w: %s", ErrNotNFT, contract.Hex())
+		}
+		if supported, _ := out[0].(bool); supported {
+			return standard, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrNotNFT, contract.Hex())
+}
+
+// nftBalance is how many of a token owner holds: 0 or 1 for ERC-721.
+func nftBalance(chain *Chain, contract common.Address, standard string, owner common.Address, id *big.Int) (*big.Int, error) {
+	if standard == NFTStandardERC1155 {
+		out, err := callContract(chain, contract, erc1155ABI, "balanceOf", owner, id)
+		if err != nil {
+			return nil, err
+		}
+		return out[0].(*big.Int), nil
+	}
+
+	out, err := callContract(chain, contract, erc721ABI, "ownerOf", id)
+	if err != nil {
+		// ownerOf reverts for a burned token.
+		if isRevert(err) {
+			return new(big.Int), nil
+		}
+		return nil, err
+	}
+	if out[0].(common.Address) != owner {
+		return new(big.Int), nil
+	}
+
+	return big.NewInt(1), nil
+}
+
+// GetNFTMetadata fetches the metadata document a token's tokenURI, or for
+// ERC-1155 its uri with {id} filled in, points to. IPFS and Arweave URIs go
+// through the same gateways as ENS avatars, and data: URIs are decoded.
+func GetNFTMetadata(chain *Chain, contractAddress string, tokenID *big.Int) (*NFTMetadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcReadTimeout)
+	defer cancel()
+
+	if !common.IsHexAddress(contractAddress) {
+		return nil, fmt.Errorf("%w: %q is not an address", ErrNotNFT, contractAddress)
+	}
+	contract := common.HexToAddress(contractAddress)
+	standard, err := nftStandard(ctx, chain, contract)
+	if err != nil {
+		return nil, err
+	}
+
+	var uri string
+	if standard == NFTStandardERC1155 {
+		out, err := callContract(chain, contract, erc1155ABI, "uri", tokenID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNFTMetadata, err)
+		}
+		uri = strings.ReplaceAll(out[0].(string), "{id}", fmt.Sprintf("%064x", tokenID))
+	} else {
+		out, err := callContract(chain, contract, erc721ABI, "tokenURI", tokenID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNFTMetadata, err)
+		}
+		uri = out[0].(string)
+	}
+
+	metadata := &NFTMetadata{Contract: contract.Hex(), Standard: standard, TokenID: tokenID.String(), TokenURI: uri}
+	if strings.HasPrefix(uri, "data:") {
+		metadata.Metadata, err = decodeDataURI(uri)
+	} else if metadata.MetadataURL, err = gatewayURL(uri); err == nil {
+		metadata.Metadata, err = fetchNFTMetadata(ctx, metadata.MetadataURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNFTMetadata, err)
+	}
+
+	var document struct {
+		Image    string `json:"image"`
+		ImageURL string `json:"image_url"`
+	}
+	if json.Unmarshal(metadata.Metadata, &document) == nil {
+		image := document.Image
+		if image == "" {
+			image = document.ImageURL
+		}
+		if image != "" {
+			metadata.ImageURL, _ = gatewayURL(image)
+		}
+	}
+
+	return metadata, nil
+}
+
+func fetchNFTMetadata(ctx context.Context, metadataURL string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ensHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata responded %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxNFTMetadataBytes))
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(body) {
+		return nil, errors.New("metadata is not JSON")
+	}
+
+	return body, nil
+}
+
+// decodeDataURI reads the JSON of a data: URI, base64 or percent-encoded, as
+// contracts that keep their metadata on-chain return it.
+func decodeDataURI(uri string) (json.RawMessage, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok {
+		return nil, errors.New("malformed data URI")
+	}
+
+	var body []byte
+	var err error
+	if strings.HasSuffix(header, ";base64") {
+		body, err = base64.StdEncoding.DecodeString(payload)
+	} else {
+		var unescaped string
+		unescaped, err = url.PathUnescape(payload)
+		body = []byte(unescaped)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(body) {
+		return nil, errors.New("metadata is not JSON")
+	}
+
+	return body, nil
+}
+
+// TransferNFT sends tokens from an account, the selected one if empty, with
+// safeTransferFrom, which a contract recipient must accept or the transfer
+// fails. An ERC-721 transfer moves one token; an ERC-1155 one moves amounts
+// of each token, one of each if amounts is empty, in a single
+// safeBatchTransferFrom call when there are several. The account must hold
+// them all.
+func TransferNFT(chain *Chain, account, contractAddress, toAddress string, tokenIDs, amounts []*big.Int, data []byte) (*NFTTransferResult, error) {
+	ctx := context.Background()
+
+	if !common.IsHexAddress(contractAddress) {
+		return nil, fmt.Errorf("%w: %q is not an address", ErrInvalidNFTTransfer, contractAddress)
+	}
+	if !common.IsHexAddress(toAddress) {
+		return nil, fmt.Errorf("%w: invalid recipient address", ErrInvalidNFTTransfer)
+	}
+	if len(tokenIDs) == 0 {
+		return nil, fmt.Errorf("%w: at least one token ID is required", ErrInvalidNFTTransfer)
+	}
+	contract, to := common.HexToAddress(contractAddress), common.HexToAddress(toAddress)
+
+	standard, err := nftStandard(ctx, chain, contract)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := loadSignerFor(account)
+	if err != nil {
+		return nil, err
+	}
+	from := signer.Address()
+	if to == from {
+		return nil, fmt.Errorf("%w: the recipient is the sender", ErrInvalidNFTTransfer)
+	}
+
+	var call []byte
+	switch standard {
+	case NFTStandardERC721:
+		if len(tokenIDs) != 1 || len(amounts) > 1 || (len(amounts) == 1 && amounts[0].Cmp(big.NewInt(1)) != 0) {
+			return nil, fmt.Errorf("%w: an ERC-721 transfer moves exactly one token", ErrInvalidNFTTransfer)
+		}
+		amounts = nil
+		if len(data) > 0 {
+			call, err = erc721ABI.Pack("safeTransferFrom0", from, to, tokenIDs[0], data)
+		} else {
+			call, err = erc721ABI.Pack("safeTransferFrom", from, to, tokenIDs[0])
+		}
+
+	case NFTStandardERC1155:
+		if len(amounts) == 0 {
+			for range tokenIDs {
+				amounts = append(amounts, big.NewInt(1))
+			}
+		}
+		if len(amounts) != len(tokenIDs) {
+			return nil, fmt.Errorf("%w: %d amounts for %d token IDs", ErrInvalidNFTTransfer, len(amounts), len(tokenIDs))
+		}
+		if data == nil {
+			data = []byte{}
+		}
+		if len(tokenIDs) == 1 {
+			call, err = erc1155ABI.Pack("safeTransferFrom", from, to, tokenIDs[0], amounts[0], data)
+		} else {
+			call, err = erc1155ABI.Pack("safeBatchTransferFrom", from, to, tokenIDs, amounts, data)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNFTTransfer, err)
+	}
+
+	for i, id := range tokenIDs {
+		balance, err := nftBalance(chain, contract, standard, from, id)
+		if err != nil {
+			return nil, err
+		}
+		want := big.NewInt(1)
+		if amounts != nil {
+			want = amounts[i]
+		}
+		if want.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: the amount of token %s must be positive", ErrInvalidNFTTransfer, id)
+		}
+		if balance.Cmp(want) < 0 {
+			return nil, fmt.Errorf("%w: %s holds %s of token %s", ErrInvalidNFTTransfer, from.Hex(), balance, id)
+		}
+	}
+
+	txHash, err := sendContractTransaction(chain, signer, contract, big.NewInt(0), call)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &NFTTransferResult{TxHash: txHash, Standard: standard, Contract: contract.Hex(), From: from.Hex(), To: to.Hex()}
+	for i, id := range tokenIDs {
+		result.TokenIDs = append(result.TokenIDs, id.String())
+		if amounts != nil {
+			result.Amounts = append(result.Amounts, amounts[i].String())
+		}
+	}
+
+	return result, nil
+}
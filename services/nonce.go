@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// nonceInFlightTTL is how long a nonce handed out and broadcast is held
+// while the node does not count it. That covers a node behind a load
+// balancer that has not seen the transaction yet; past it, the transaction
+// is taken to have been dropped and its nonce is a gap to fill.
+const nonceInFlightTTL = 10 * time.Minute
+
+var (
+	ErrNonceTooLow = errors.New("nonce already used")
+	ErrNonceInUse  = errors.New("nonce held by a transaction in flight")
+)
+
+// accountNonces hands out one account's nonces on one chain. mu is held
+// from choosing a nonce until it is journalled, so sends from the account
+// take their turn while other accounts go ahead.
+type accountNonces struct {
+	mu sync.Mutex
+	// inFlight are the nonces this process handed out that the node did
+	// not count yet when last asked, with when they were handed out.
+	inFlight map[uint64]time.Time
+}
+
+type nonceKey struct {
+	chainID uint64
+	account common.Address
+}
+
+var (
+	noncesMu sync.Mutex
+	nonces   = map[nonceKey]*accountNonces{}
+)
+
+func noncesFor(chainID uint64, account common.Address) *accountNonces {
+	noncesMu.Lock()
+	defer noncesMu.Unlock()
+
+	key := nonceKey{chainID: chainID, account: account}
+	n, ok := nonces[key]
+	if !ok {
+		n = &accountNonces{inFlight: map[uint64]time.Time{}}
+		nonces[key] = n
+	}
+
+	return n
+}
+
+// NonceStatus is how an account's nonces stand on a chain. Pending is the
+// node's next nonce; InFlight are those above it the wallet has handed out
+// and not seen mined or rejected; Gaps are unused nonces below the highest
+// in flight, which hold back everything above them until filled. Next is
+// the nonce the next send gets, the lowest gap if there is one.
+type NonceStatus struct {
+	ChainID  uint64   `json:"chain_id"`
+	Account  string   `json:"account"`
+	Pending  uint64   `json:"pending"`
+	Next     uint64   `json:"next"`
+	InFlight []uint64 `json:"in_flight"`
+	Gaps     []uint64 `json:"gaps"`
+}
+
+// GetNonceStatus reports an account's nonces, the selected account's if
+// empty.
+func GetNonceStatus(chain *Chain, account string) (*NonceStatus, error) {
+	address, err := AccountAddress(account)
+	if err != nil {
+		return nil, err
+	}
+	from := common.HexToAddress(address)
+
+	n := noncesFor(chain.ID.Uint64(), from)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	pending, held, err := n.held(context.Background(), chain, from)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &NonceStatus{
+		ChainID:  chain.ID.Uint64(),
+		Account:  from.Hex(),
+		Pending:  pending,
+		Next:     lowestFree(pending, held),
+		InFlight: []uint64{},
+		Gaps:     []uint64{},
+	}
+	for nonce := range held {
+		status.InFlight = append(status.InFlight, nonce)
+	}
+	sort.Slice(status.InFlight, func(i, j int) bool { return status.InFlight[i] < status.InFlight[j] })
+	if len(status.InFlight) > 0 {
+		for nonce := pending; nonce < status.InFlight[len(status.InFlight)-1]; nonce++ {
+			if !held[nonce] {
+				status.Gaps = append(status.Gaps, nonce)
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// assign picks the nonce for a send from the account: the one asked for,
+// if it is free, or the lowest free one, which fills a gap before going
+// past the highest in flight. It must be called with n.mu held.
+func (n *accountNonces) assign(ctx context.Context, chain *Chain, from common.Address, requested *uint64) (uint64, error) {
+	pending, held, err := n.held(ctx, chain, from)
+	if err != nil {
+		return 0, err
+	}
+
+	nonce := lowestFree(pending, held)
+	if requested != nil {
+		switch {
+		case *requested < pending:
+			return 0, fmt.Errorf("%w: the account's next nonce is %d", ErrNonceTooLow, pending)
+		case held[*requested]:
+			return 0, fmt.Errorf("%w: %d", ErrNonceInUse, *requested)
+		}
+		nonce = *requested
+	}
+
+	n.inFlight[nonce] = time.Now()
+	return nonce, nil
+}
+
+// held asks the node for the account's pending nonce and returns it with
+// the nonces above it that are taken: those handed out by this process,
+// those journalled but not yet broadcast, and those waiting in the
+// broadcast queue. It must be called with n.mu held.
+func (n *accountNonces) held(ctx context.Context, chain *Chain, from common.Address) (uint64, map[uint64]bool, error) {
+	pending, err := chain.client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	held := map[uint64]bool{}
+	for nonce, at := range n.inFlight {
+		if nonce < pending || time.Since(at) > nonceInFlightTTL {
+			delete(n.inFlight, nonce)
+			continue
+		}
+		held[nonce] = true
+	}
+
+	journalMu.Lock()
+	entries, err := readJournal()
+	journalMu.Unlock()
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, entry := range entries {
+		if !entry.resolved() && entry.ChainID == chain.ID.Uint64() && common.HexToAddress(entry.From) == from && entry.Nonce >= pending {
+			held[entry.Nonce] = true
+		}
+	}
+
+	broadcastMu.Lock()
+	queue, err := readBroadcastQueue()
+	broadcastMu.Unlock()
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, queued := range queue {
+		if queued.ChainID == chain.ID.Uint64() && common.HexToAddress(queued.From) == from && queued.Nonce >= pending {
+			held[queued.Nonce] = true
+		}
+	}
+
+	return pending, held, nil
+}
+
+// release gives back a nonce whose transaction was never broadcast, so that
+// the next send takes it rather than leaving a gap.
+func releaseNonce(chainID uint64, from common.Address, nonce uint64) {
+	n := noncesFor(chainID, from)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.inFlight, nonce)
+}
+
+func lowestFree(from uint64, held map[uint64]bool) uint64 {
+	for held[from] {
+		from++
+	}
+
+	return from
+}
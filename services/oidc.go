@@ -0,0 +1,712 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// accessTokenIssuer marks tokens the wallet issued itself.
+	accessTokenIssuer = "go-wallet"
+
+	defaultAccessTokenTTL = 15 * time.Minute
+	loginStateTTL         = 10 * time.Minute
+
+	// oidcClockSkew is tolerated on ID token times.
+	oidcClockSkew = time.Minute
+)
+
+// OIDCConfig is read from OIDC_* variables. Roles come from the groups claim
+// (OIDC_GROUPS_CLAIM, default "groups") through OIDC_ROLE_MAP, a list such as
+// "wallet-admins=admin,wallet-ops=operator"; a user in several mapped groups
+// gets the highest role, and one in none gets OIDC_DEFAULT_ROLE or is refused.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string
+	RoleMap      map[string]string
+	DefaultRole  string
+	TokenTTL     time.Duration
+}
+
+// AccessToken is a short-lived wallet token issued after an OIDC login.
+type AccessToken struct {
+	Token     string     `json:"access_token"`
+	TokenType string     `json:"token_type"`
+	ExpiresIn int64      `json:"expires_in"`
+	Principal *Principal `json:"principal"`
+}
+
+type oidcProvider struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	keys map[string]crypto.PublicKey
+}
+
+type loginState struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+var (
+	oidcOnce   sync.Once
+	oidcConfig *OIDCConfig
+	oidcErr    error
+
+	oidcMu       sync.Mutex
+	provider     *oidcProvider
+	loginStates  = map[string]loginState{}
+	oidcClient   = &http.Client{Timeout: 10 * time.Second}
+	sessionKey   []byte
+	sessionKeyMu sync.Mutex
+)
+
+var (
+	ErrOIDCDisabled    = errors.New("OIDC login is not configured")
+	ErrOIDCLogin       = errors.New("OIDC login failed")
+	ErrNoRoleForGroups = errors.New("no wallet role is mapped to the user's groups")
+)
+
+// sessionKeyFile holds the HMAC key access tokens are signed with. Like the
+// identity key it signs nothing else.
+var sessionKeyFile = "session_key.txt"
+
+func OIDCEnabled() bool {
+	config, _ := loadOIDCConfig()
+	return config != nil
+}
+
+func loadOIDCConfig() (*OIDCConfig, error) {
+	oidcOnce.Do(func() {
+		issuer := os.Getenv("OIDC_ISSUER")
+		if issuer == "" {
+			return
+		}
+
+		config := &OIDCConfig{
+			Issuer:       strings.TrimSuffix(issuer, "/"),
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Scopes:       []string{"openid", "profile", "email"},
+			GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+			RoleMap:      map[string]string{},
+			DefaultRole:  os.Getenv("OIDC_DEFAULT_ROLE"),
+			TokenTTL:     defaultAccessTokenTTL,
+		}
+		if config.GroupsClaim == "" {
+			config.GroupsClaim = "groups"
+		}
+		if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+			config.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+		if raw := os.Getenv("OIDC_TOKEN_TTL"); raw != "" {
+			ttl, err := time.ParseDuration(raw)
+			if err != nil || ttl <= 0 {
+				oidcErr = fmt.Errorf("OIDC_TOKEN_TTL %q is not a positive duration", raw)
+				return
+			}
+			config.TokenTTL = ttl
+		}
+		if config.DefaultRole != "" && roleRank(config.DefaultRole) < 0 {
+			oidcErr = fmt.Errorf("OIDC_DEFAULT_ROLE: %w: %q", ErrInvalidRole, config.DefaultRole)
+			return
+		}
+		for _, pair := range strings.Split(os.Getenv("OIDC_ROLE_MAP"), ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			group, role, ok := strings.Cut(pair, "=")
+			role = strings.TrimSpace(role)
+			if !ok || roleRank(role) < 0 {
+				oidcErr = fmt.Errorf("OIDC_ROLE_MAP: %q must be group=%s", pair, strings.Join(roles, "|"))
+				return
+			}
+			config.RoleMap[strings.TrimSpace(group)] = role
+		}
+		if config.ClientID == "" || config.RedirectURL == "" {
+			oidcErr = errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER")
+			return
+		}
+
+		oidcConfig = config
+	})
+
+	return oidcConfig, oidcErr
+}
+
+// CheckOIDCConfig reports a malformed OIDC configuration at startup rather
+// than on the first login.
+func CheckOIDCConfig() error {
+	_, err := loadOIDCConfig()
+	return err
+}
+
+// OIDCLoginURL starts an authorization code flow with PKCE and returns the
+// identity provider URL to send the user to.
+func OIDCLoginURL() (string, error) {
+	config, err := loadOIDCConfig()
+	if err != nil {
+		return "", err
+	}
+	if config == nil {
+		return "", ErrOIDCDisabled
+	}
+
+	p, err := discoverProvider(config)
+	if err != nil {
+		return "", err
+	}
+
+	state, nonce, verifier := randomToken(), randomToken(), randomToken()
+	challenge := sha256.Sum256([]byte(verifier))
+
+	oidcMu.Lock()
+	now := time.Now()
+	for key, pending := range loginStates {
+		if now.After(pending.expires) {
+			delete(loginStates, key)
+		}
+	}
+	loginStates[state] = loginState{nonce: nonce, verifier: verifier, expires: now.Add(loginStateTTL)}
+	oidcMu.Unlock()
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {config.ClientID},
+		"redirect_uri":          {config.RedirectURL},
+		"scope":                 {strings.Join(config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// CompleteOIDCLogin exchanges the authorization code returned to the
+// redirect URL, verifies the ID token and issues a wallet access token.
+func CompleteOIDCLogin(state, code string) (*AccessToken, error) {
+	config, err := loadOIDCConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, ErrOIDCDisabled
+	}
+
+	oidcMu.Lock()
+	pending, ok := loginStates[state]
+	delete(loginStates, state)
+	oidcMu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		return nil, fmt.Errorf("%w: unknown or expired login state", ErrOIDCLogin)
+	}
+
+	p, err := discoverProvider(config)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {config.RedirectURL},
+		"client_id":     {config.ClientID},
+		"code_verifier": {pending.verifier},
+	}
+	if config.ClientSecret != "" {
+		form.Set("client_secret", config.ClientSecret)
+	}
+
+	resp, err := oidcClient.PostForm(p.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLogin, err)
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLogin, err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: token endpoint responded %s %s", ErrOIDCLogin, resp.Status, tokens.Error)
+	}
+
+	return issueForIDToken(config, tokens.IDToken, pending.nonce)
+}
+
+// ExchangeIDToken issues a wallet access token for an ID token the caller
+// obtained from the identity provider itself, for clients that cannot follow
+// a browser redirect.
+func ExchangeIDToken(idToken string) (*AccessToken, error) {
+	config, err := loadOIDCConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, ErrOIDCDisabled
+	}
+
+	return issueForIDToken(config, idToken, "")
+}
+
+func issueForIDToken(config *OIDCConfig, idToken, nonce string) (*AccessToken, error) {
+	claims, err := verifyIDToken(config, idToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	if email, ok := claims["email"].(string); ok && email != "" {
+		subject = email
+	}
+	groups := claimStrings(claims[config.GroupsClaim])
+
+	role := config.DefaultRole
+	for _, group := range groups {
+		if mapped, ok := config.RoleMap[group]; ok && roleRank(mapped) > roleRank(role) {
+			role = mapped
+		}
+	}
+	if role == "" {
+		recordAudit("auth.login_refused", fmt.Sprintf("OIDC login by %s refused: no role for groups %v", subject, groups),
+			map[string]interface{}{"subject": subject})
+		return nil, ErrNoRoleForGroups
+	}
+
+	expires := time.Now().Add(config.TokenTTL).UTC().Truncate(time.Second)
+	principal := &Principal{
+		Kind:      PrincipalOIDC,
+		Subject:   subject,
+		Role:      role,
+		Scopes:    RoleScopes(role),
+		Groups:    groups,
+		ExpiresAt: &expires,
+	}
+
+	token, err := signAccessToken(principal)
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit("auth.login", fmt.Sprintf("%s signed in through OIDC as %s", subject, role),
+		map[string]interface{}{"subject": subject, "role": role})
+	return &AccessToken{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresIn: int64(config.TokenTTL.Seconds()),
+		Principal: principal,
+	}, nil
+}
+
+// verifyIDToken checks an ID token's signature against the provider's keys
+// and its issuer, audience, expiry and, for a browser login, nonce.
+func verifyIDToken(config *OIDCConfig, raw, nonce string) (map[string]interface{}, error) {
+	header, claims, signed, signature, err := splitJWT(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLogin, err)
+	}
+
+	p, err := discoverProvider(config)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := p.key(header.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLogin, err)
+	}
+	if err := verifyJWTSignature(header.Algorithm, key, signed, signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLogin, err)
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != config.Issuer {
+		return nil, fmt.Errorf("%w: token issued by %q", ErrOIDCLogin, iss)
+	}
+	audiences := claimStrings(claims["aud"])
+	found := false
+	for _, aud := range audiences {
+		found = found || aud == config.ClientID
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: token is not for this client", ErrOIDCLogin)
+	}
+	if exp, ok := claims["exp"].(float64); !ok || time.Now().Add(-oidcClockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("%w: token has expired", ErrOIDCLogin)
+	}
+	if nonce != "" {
+		if got, _ := claims["nonce"].(string); !subtleEqual(got, nonce) {
+			return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCLogin)
+		}
+	}
+
+	return claims, nil
+}
+
+// signAccessToken issues an HS256 JWT for a principal, setting its
+// TokenID to the token's ID. A principal with an API key carries the key
+// ID, so the token stops working when the key is revoked.
+func signAccessToken(principal *Principal) (string, error) {
+	key, err := loadSessionKey()
+	if err != nil {
+		return "", err
+	}
+
+	principal.TokenID = newID()
+	claims := map[string]interface{}{
+		"iss":    accessTokenIssuer,
+		"sub":    principal.Subject,
+		"kind":   principal.Kind,
+		"role":   principal.Role,
+		"scope":  strings.Join(principal.Scopes, " "),
+		"groups": principal.Groups,
+		"iat":    time.Now().Unix(),
+		"exp":    principal.ExpiresAt.Unix(),
+		"jti":    principal.TokenID,
+	}
+	if principal.KeyID != "" {
+		claims["key"] = principal.KeyID
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func verifyAccessToken(raw string) (*Principal, error) {
+	header, claims, signed, signature, err := splitJWT(raw)
+	if err != nil || header.Algorithm != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := loadSessionKey()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	if iss, _ := claims["iss"].(string); iss != accessTokenIssuer {
+		return nil, ErrInvalidToken
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Now().After(time.Unix(int64(exp), 0)) {
+		return nil, ErrInvalidToken
+	}
+
+	subject, _ := claims["sub"].(string)
+	role, _ := claims["role"].(string)
+	if roleRank(role) < 0 {
+		return nil, ErrInvalidToken
+	}
+	expires := time.Unix(int64(exp), 0).UTC()
+
+	scope, _ := claims["scope"].(string)
+	scopes := strings.Fields(scope)
+	if err := checkScopes(role, scopes); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Tokens issued before they named their kind all came from OIDC logins.
+	kind, _ := claims["kind"].(string)
+	switch kind {
+	case "":
+		kind = PrincipalOIDC
+	case PrincipalOIDC, PrincipalAPIKey:
+	default:
+		return nil, ErrInvalidToken
+	}
+	keyID, _ := claims["key"].(string)
+	tokenID, _ := claims["jti"].(string)
+
+	principal := &Principal{
+		Kind:      kind,
+		Subject:   subject,
+		Role:      role,
+		Scopes:    scopes,
+		KeyID:     keyID,
+		TokenID:   tokenID,
+		Groups:    claimStrings(claims["groups"]),
+		ExpiresAt: &expires,
+	}
+	if err := RecheckPrincipal(principal); err != nil {
+		return nil, err
+	}
+
+	return principal, nil
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+func splitJWT(raw string) (jwtHeader, map[string]interface{}, string, []byte, error) {
+	var header jwtHeader
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return header, nil, "", nil, errors.New("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return header, nil, "", nil, errors.New("malformed token header")
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return header, nil, "", nil, errors.New("malformed token header")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return header, nil, "", nil, errors.New("malformed token payload")
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return header, nil, "", nil, errors.New("malformed token payload")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return header, nil, "", nil, errors.New("malformed token signature")
+	}
+
+	return header, claims, parts[0] + "." + parts[1], signature, nil
+}
+
+func verifyJWTSignature(algorithm string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch algorithm {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(algorithm, "RS") {
+			return errors.New("algorithm does not match key")
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(algorithm, "ES") || len(signature) != 2*size {
+			return errors.New("algorithm does not match key")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	return errors.New("unsupported key type")
+}
+
+// discoverProvider reads the provider's discovery document once.
+func discoverProvider(config *OIDCConfig) (*oidcProvider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if provider != nil {
+		return provider, nil
+	}
+
+	p := &oidcProvider{}
+	if err := getJSON(config.Issuer+"/.well-known/openid-configuration", p); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is incomplete")
+	}
+
+	provider = p
+	return provider, nil
+}
+
+// key returns the provider's signing key with the given ID, refetching the
+// key set once if it is not known, since providers rotate keys.
+func (p *oidcProvider) key(id string) (crypto.PublicKey, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if key, ok := p.keys[id]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			KeyID string `json:"kid"`
+			Type  string `json:"kty"`
+			Use   string `json:"use"`
+			N     string `json:"n"`
+			E     string `json:"e"`
+			Curve string `json:"crv"`
+			X     string `json:"x"`
+			Y     string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(p.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	p.keys = map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Type {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			p.keys[jwk.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[jwk.Curve]
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if curve == nil || errX != nil || errY != nil {
+				continue
+			}
+			p.keys[jwk.KeyID] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", id)
+	}
+	return key, nil
+}
+
+func loadSessionKey() ([]byte, error) {
+	sessionKeyMu.Lock()
+	defer sessionKeyMu.Unlock()
+
+	if sessionKey != nil {
+		return sessionKey, nil
+	}
+
+	raw, err := readKeyFile(sessionKeyFile)
+	if os.IsNotExist(err) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := writeKeyFile(sessionKeyFile, []byte(hex.EncodeToString(key))); err != nil {
+			return nil, err
+		}
+		sessionKey = key
+		return sessionKey, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid session key file")
+	}
+
+	sessionKey = key
+	return sessionKey, nil
+}
+
+func getJSON(url string, v interface{}) error {
+	resp, err := oidcClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// claimStrings reads a claim that may be a single string or a list.
+func claimStrings(claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		return []string{claim}
+	case []interface{}:
+		var values []string
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func subtleEqual(a, b string) bool {
+	return hmac.Equal([]byte(a), []byte(b))
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const outboxInterval = 2 * time.Second
+
+// outboxEntry is an event waiting to be dispatched. The event is written to
+// the outbox under the same lock as the state change it announces, before
+// that change is written; the worker takes the lock again and checks Ref
+// before dispatching. An event whose change was committed is therefore
+// dispatched even if the process dies straight after the write, and one whose
+// change never made it to disk is dropped instead of announcing something that
+// did not happen.
+type outboxEntry struct {
+	Event     *WebhookEvent `json:"event"`
+	Ref       outboxRef     `json:"ref"`
+	Attempts  int           `json:"attempts,omitempty"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// outboxRef names the state change an event announces.
+type outboxRef struct {
+	Store  string `json:"store"`
+	Key    string `json:"key"`
+	Status string `json:"status,omitempty"`
+}
+
+const (
+	refHistory = "history"
+	refAlert   = "alert"
+)
+
+var (
+	outboxFile = "outbox.json"
+	outboxMu   sync.Mutex
+	outboxWake = make(chan struct{}, 1)
+)
+
+// StartOutbox dispatches outbox events to webhooks. On start it also resumes
+// webhook deliveries that were logged but never attempted before a restart.
+func StartOutbox() {
+	go func() {
+		resumePendingDeliveries()
+
+		ticker := time.NewTicker(outboxInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := dispatchOutbox(); err != nil {
+				log.Printf("outbox: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-outboxWake:
+			}
+		}
+	}()
+}
+
+// enqueueEvent adds an event to the outbox. It must be called with the lock
+// of the store named by ref held, before the store is written.
+func enqueueEvent(eventType string, chainID uint64, accounts []string, data interface{}, ref outboxRef) {
+	entry := outboxEntry{
+		Event: &WebhookEvent{
+			ID:        newID(),
+			Type:      eventType,
+			ChainID:   chainID,
+			Accounts:  accounts,
+			CreatedAt: time.Now().UTC(),
+			Data:      data,
+		},
+		Ref: ref,
+	}
+
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	entries, err := readOutbox()
+	if err == nil {
+		entries = append(entries, entry)
+		err = writeJSONFile(outboxFile, entries)
+	}
+	if err != nil {
+		log.Printf("outbox: failed to enqueue %s event: %v", eventType, err)
+		return
+	}
+
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+func dispatchOutbox() error {
+	outboxMu.Lock()
+	entries, err := readOutbox()
+	outboxMu.Unlock()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	// Store locks are taken while checking commits, so outboxMu must not be
+	// held here: writers hold their store lock while enqueueing.
+	done := map[string]bool{}
+	failed := map[string]string{}
+	for _, entry := range entries {
+		if !entry.Ref.committed() {
+			log.Printf("outbox: dropping %s event %s; its state change was never committed", entry.Event.Type, entry.Event.ID)
+			done[entry.Event.ID] = true
+			continue
+		}
+
+		if entry.Ref.Store == refHistory {
+			wakeTransactionWaiters(entry.Ref.Key)
+			publishTransactionEvent(entry.Event)
+		}
+		if err := dispatchEvent(entry.Event); err != nil {
+			failed[entry.Event.ID] = err.Error()
+			continue
+		}
+		done[entry.Event.ID] = true
+	}
+
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	// Re-read: events may have been enqueued while dispatching.
+	if entries, err = readOutbox(); err != nil {
+		return err
+	}
+
+	remaining := entries[:0]
+	for _, entry := range entries {
+		if done[entry.Event.ID] {
+			continue
+		}
+		if reason, ok := failed[entry.Event.ID]; ok {
+			entry.Attempts++
+			entry.LastError = reason
+		}
+		remaining = append(remaining, entry)
+	}
+
+	return writeJSONFile(outboxFile, remaining)
+}
+
+// dispatchEvent logs a delivery for every matching webhook and starts
+// attempting them. Logging is idempotent per webhook and event, so an event
+// dispatched again after a crash is not delivered twice.
+func dispatchEvent(event *WebhookEvent) error {
+	webhooksMu.Lock()
+	webhooks, err := readWebhooks()
+	webhooksMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.matches(event) {
+			continue
+		}
+
+		delivery, created, err := logDelivery(webhook.ID, event)
+		if err != nil {
+			return err
+		}
+		if created {
+			go attemptDelivery(webhook, delivery, false)
+		}
+	}
+
+	return nil
+}
+
+// committed reports whether the state change named by r is on disk.
+func (r outboxRef) committed() bool {
+	switch r.Store {
+	case refHistory:
+		historyMu.Lock()
+		defer historyMu.Unlock()
+
+		record, err := history.get(r.Key)
+		if err != nil {
+			return true
+		}
+		return record != nil && (r.Status == "" || record.Status == r.Status)
+
+	case refAlert:
+		alertsMu.Lock()
+		defer alertsMu.Unlock()
+
+		alerts, err := readAlerts()
+		if err != nil {
+			return true
+		}
+		for _, alert := range alerts {
+			if alert.ID == r.Key {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func readOutbox() ([]outboxEntry, error) {
+	var entries []outboxEntry
+	if err := readJSONFile(outboxFile, &entries); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return entries, nil
+}
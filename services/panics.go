@@ -0,0 +1,166 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// PanicReport is a panic recovered while serving a request. Panic and
+// Stack are scrubbed of anything that looks like a secret before the
+// report is logged or sent anywhere.
+type PanicReport struct {
+	RequestID string    `json:"request_id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Panic     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+	Time      time.Time `json:"time"`
+	frames    []runtime.Frame
+}
+
+var secretPatterns = []*regexp.Regexp{
+	// Private keys, and anything else of their length.
+	regexp.MustCompile(`(?i)\b(0x)?[0-9a-f]{64}\b`),
+	// Values of fields that hold secrets, as JSON or key=value.
+	regexp.MustCompile(`(?i)("?(?:password|passphrase|secret|token|mnemonic|private_?key|api_?key)"?\s*[:=]\s*)("[^"]*"|[^\s,&}]+)`),
+	regexp.MustCompile(`(?i)(bearer\s+)[^\s"]+`),
+}
+
+// scrubSecrets masks what may be key material, passwords or tokens.
+func scrubSecrets(text string) string {
+	text = secretPatterns[0].ReplaceAllString(text, "[redacted]")
+	for _, pattern := range secretPatterns[1:] {
+		text = pattern.ReplaceAllString(text, "${1}[redacted]")
+	}
+
+	return text
+}
+
+// NewPanicReport describes a recovered panic. It must be called from the
+// deferred function that recovered it, so that the stack is the panic's.
+func NewPanicReport(requestID, method, path string, recovered interface{}, stack []byte) *PanicReport {
+	pcs := make([]uintptr, 64)
+	// Skip runtime.Callers, this function and the deferred recover.
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	report := &PanicReport{
+		RequestID: requestID,
+		Method:    method,
+		Path:      scrubSecrets(path),
+		Panic:     scrubSecrets(fmt.Sprint(recovered)),
+		Stack:     scrubSecrets(string(stack)),
+		Time:      time.Now().UTC(),
+	}
+	for {
+		frame, more := frames.Next()
+		report.frames = append(report.frames, frame)
+		if !more {
+			break
+		}
+	}
+
+	return report
+}
+
+// ReportPanic logs a panic as one JSON line and, if SENTRY_DSN is set,
+// sends it to Sentry or any service taking its store API.
+func ReportPanic(report *PanicReport) {
+	line, err := json.Marshal(struct {
+		Level string `json:"level"`
+		*PanicReport
+	}{"error", report})
+	if err != nil {
+		log.Printf("panic serving %s %s (request %s): %s", report.Method, report.Path, report.RequestID, report.Panic)
+	} else {
+		log.Printf("%s", line)
+	}
+
+	if dsn := os.Getenv("SENTRY_DSN"); dsn != "" {
+		go func() {
+			if err := sendToSentry(dsn, report); err != nil {
+				log.Printf("sentry: %v", err)
+			}
+		}()
+	}
+}
+
+var sentryClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendToSentry posts the report to the store endpoint of the project a DSN
+// (https://<key>@<host>/<project>) names.
+func sendToSentry(dsn string, report *PanicReport) error {
+	parsed, err := url.Parse(dsn)
+	if err != nil || parsed.User == nil || parsed.Host == "" {
+		return fmt.Errorf("invalid SENTRY_DSN")
+	}
+	path := strings.Trim(parsed.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return fmt.Errorf("invalid SENTRY_DSN: no project")
+	}
+	endpoint := fmt.Sprintf("%s://%s/%sapi/%s/store/", parsed.Scheme, parsed.Host, path[:slash+1], project)
+
+	// Sentry lists frames oldest first.
+	type frame struct {
+		Function string `json:"function"`
+		Filename string `json:"filename"`
+		Lineno   int    `json:"lineno"`
+	}
+	frames := make([]frame, 0, len(report.frames))
+	for i := len(report.frames) - 1; i >= 0; i-- {
+		f := report.frames[i]
+		frames = append(frames, frame{Function: f.Function, Filename: f.File, Lineno: f.Line})
+	}
+
+	event := map[string]interface{}{
+		"event_id":  newID(),
+		"timestamp": report.Time.Format(time.RFC3339),
+		"level":     "error",
+		"platform":  "go",
+		"logger":    "go-wallet",
+		"message":   report.Panic,
+		"tags":      map[string]string{"request_id": report.RequestID},
+		"request":   map[string]string{"method": report.Method, "url": report.Path},
+		"exception": map[string]interface{}{
+			"values": []interface{}{map[string]interface{}{
+				"type":       "panic",
+				"value":      report.Panic,
+				"stacktrace": map[string]interface{}{"frames": frames},
+			}},
+		},
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=go-wallet/1.0, sentry_key=%s", parsed.User.Username()))
+
+	response, err := sentryClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("store returned %s", response.Status)
+	}
+
+	return nil
+}
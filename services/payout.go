@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// A payout batch pays many recipients from the selected account through the
+// scheduler. Its privacy options make the batch harder to link together in
+// the mempool and on chain: the order, and so the nonce each payout gets, is
+// shuffled; sends are spread out by a random delay; and each payout can be
+// sent from its own fresh HD address, funded from the account just before.
+
+const (
+	maxBatchPayouts = 500
+	maxPayoutJitter = 24 * time.Hour
+
+	// A payout from a derived sender is released at least this long after
+	// the sender is funded, for the funding to be mined first.
+	derivedSenderDelay = time.Minute
+)
+
+// PayoutPrivacy are a batch's linkability options, all off by default.
+// Jitter finer than the scheduler's tick is rounded up to it.
+type PayoutPrivacy struct {
+	Shuffle   bool   `json:"shuffle,omitempty"`
+	JitterMin string `json:"jitter_min,omitempty"`
+	JitterMax string `json:"jitter_max,omitempty"`
+
+	// DeriveSenders is the ID of a seed-backed HD account to derive a new
+	// sender address from for each payout.
+	DeriveSenders string `json:"derive_senders,omitempty"`
+}
+
+type Payout struct {
+	To    string `json:"to"`
+	Value string `json:"value"`
+
+	Sender     string `json:"sender,omitempty"`
+	FundingID  string `json:"funding_id,omitempty"`
+	ScheduleID string `json:"schedule_id"`
+	Status     string `json:"status,omitempty"`
+	TxHash     string `json:"transaction_hash,omitempty"`
+}
+
+type PayoutBatch struct {
+	ID        string        `json:"id"`
+	ChainID   uint64        `json:"chain_id"`
+	From      string        `json:"from"`
+	Total     string        `json:"total"`
+	Privacy   PayoutPrivacy `json:"privacy"`
+	Payouts   []Payout      `json:"payouts"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+var (
+	payoutsFile = "payouts.json"
+	payoutsMu   sync.Mutex
+)
+
+var (
+	ErrPayoutBatchNotFound = errors.New("payout batch not found")
+	ErrInvalidPayoutBatch  = errors.New("invalid payout batch")
+)
+
+// CreatePayoutBatch schedules payouts from the selected account, applying
+// privacy. Each payout is an ordinary scheduled transaction, checked against
+// the policy when it is sent.
+func CreatePayoutBatch(chain *Chain, payouts []Payout, privacy PayoutPrivacy) (*PayoutBatch, error) {
+	if len(payouts) == 0 || len(payouts) > maxBatchPayouts {
+		return nil, fmt.Errorf("%w: between 1 and %d payouts are needed", ErrInvalidPayoutBatch, maxBatchPayouts)
+	}
+	jitterMin, jitterMax, err := payoutJitter(privacy)
+	if err != nil {
+		return nil, err
+	}
+
+	total := new(big.Int)
+	values := make([]*big.Int, len(payouts))
+	for i, payout := range payouts {
+		if !common.IsHexAddress(payout.To) {
+			return nil, fmt.Errorf("%w: payout %d: invalid recipient address", ErrInvalidPayoutBatch, i)
+		}
+		value, ok := new(big.Int).SetString(payout.Value, 10)
+		if !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: payout %d: invalid value", ErrInvalidPayoutBatch, i)
+		}
+		values[i] = value
+		total.Add(total, value)
+	}
+
+	from, err := SelectedAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	// Derived senders are funded with twice today's fee, so that their
+	// payout still goes through if gas gets dearer in between. What is left
+	// over stays with the derived address.
+	var fee *big.Int
+	if privacy.DeriveSenders != "" {
+		hd, err := GetHDAccount(privacy.DeriveSenders)
+		if err != nil {
+			return nil, err
+		}
+		if hd.WatchOnly {
+			return nil, ErrWatchOnly
+		}
+
+		gasPrice, err := chain.currentGasPrice(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		fee = new(big.Int).Mul(gasPrice, big.NewInt(2*21000))
+	}
+
+	order := make([]int, len(payouts))
+	for i := range order {
+		order[i] = i
+	}
+	if privacy.Shuffle {
+		if err := shuffle(order); err != nil {
+			return nil, err
+		}
+	}
+
+	batch := &PayoutBatch{
+		ID:        newID(),
+		ChainID:   chain.ID.Uint64(),
+		From:      from,
+		Total:     total.String(),
+		Privacy:   privacy,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	var scheduled []*ScheduledTransaction
+	at := batch.CreatedAt
+	for _, i := range order {
+		delay, err := randomDuration(jitterMin, jitterMax)
+		if err != nil {
+			return nil, err
+		}
+		at = at.Add(delay)
+
+		payout := Payout{To: common.HexToAddress(payouts[i].To).Hex(), Value: values[i].String()}
+		sender, release := from, at
+		if fee != nil {
+			derived, err := DeriveHDAddress(privacy.DeriveSenders)
+			if err != nil {
+				return nil, err
+			}
+			sender = derived.Address
+
+			funding := batch.scheduled(from, sender, new(big.Int).Add(values[i], fee), at)
+			scheduled = append(scheduled, funding)
+			payout.Sender, payout.FundingID = sender, funding.ID
+
+			if delay < derivedSenderDelay {
+				delay = derivedSenderDelay
+			}
+			release = at.Add(delay)
+		}
+
+		entry := batch.scheduled(sender, payout.To, values[i], release)
+		scheduled = append(scheduled, entry)
+		payout.ScheduleID, payout.Status = entry.ID, entry.Status
+		batch.Payouts = append(batch.Payouts, payout)
+	}
+
+	payoutsMu.Lock()
+	defer payoutsMu.Unlock()
+
+	batches, err := readPayoutBatches()
+	if err != nil {
+		return nil, err
+	}
+	if err := appendScheduled(scheduled...); err != nil {
+		return nil, err
+	}
+	batches = append(batches, batch)
+	if err := writeJSONFile(payoutsFile, batches); err != nil {
+		return nil, err
+	}
+
+	recordAudit("payout.batch_created", fmt.Sprintf("scheduled %d payouts totalling %s wei from %s", len(batch.Payouts), batch.Total, from),
+		map[string]interface{}{"batch_id": batch.ID, "payouts": len(batch.Payouts), "total": batch.Total, "chain_id": batch.ChainID,
+			"shuffle": privacy.Shuffle, "jitter_max": privacy.JitterMax, "derive_senders": privacy.DeriveSenders != ""})
+	return batch, nil
+}
+
+// GetPayoutBatch returns a batch with each payout's progress.
+func GetPayoutBatch(id string) (*PayoutBatch, error) {
+	payoutsMu.Lock()
+	batches, err := readPayoutBatches()
+	payoutsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, batch := range batches {
+		if batch.ID == id {
+			return batch, batch.fillStatus()
+		}
+	}
+
+	return nil, ErrPayoutBatchNotFound
+}
+
+// CancelPayoutBatch cancels the payouts of a batch, and fundings of their
+// senders, not yet sent. It returns how many were cancelled.
+func CancelPayoutBatch(id string) (int, error) {
+	batch, err := GetPayoutBatch(id)
+	if err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	for _, payout := range batch.Payouts {
+		for _, scheduleID := range []string{payout.FundingID, payout.ScheduleID} {
+			if scheduleID == "" {
+				continue
+			}
+			err := CancelScheduledTransaction(scheduleID)
+			if errors.Is(err, ErrScheduleReleased) {
+				continue
+			}
+			if err != nil {
+				return cancelled, err
+			}
+			cancelled++
+		}
+	}
+
+	recordAudit("payout.batch_cancelled", fmt.Sprintf("cancelled %d unsent transactions of payout batch %s", cancelled, id),
+		map[string]interface{}{"batch_id": id, "cancelled": cancelled})
+	return cancelled, nil
+}
+
+func (b *PayoutBatch) scheduled(from, to string, value *big.Int, notBefore time.Time) *ScheduledTransaction {
+	return &ScheduledTransaction{
+		ID:        newID(),
+		ChainID:   b.ChainID,
+		From:      from,
+		To:        to,
+		Value:     value.String(),
+		NotBefore: notBefore.UTC(),
+		Status:    ScheduleStatusScheduled,
+		BatchID:   b.ID,
+		CreatedAt: b.CreatedAt,
+	}
+}
+
+func (b *PayoutBatch) fillStatus() error {
+	schedule, err := ListScheduledTransactions()
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]*ScheduledTransaction, len(schedule))
+	for _, scheduled := range schedule {
+		byID[scheduled.ID] = scheduled
+	}
+	for i := range b.Payouts {
+		if scheduled, ok := byID[b.Payouts[i].ScheduleID]; ok {
+			b.Payouts[i].Status = scheduled.Status
+			b.Payouts[i].TxHash = scheduled.TxHash
+		}
+	}
+
+	return nil
+}
+
+func payoutJitter(privacy PayoutPrivacy) (time.Duration, time.Duration, error) {
+	var jitterMin, jitterMax time.Duration
+	var err error
+	if privacy.JitterMin != "" {
+		if jitterMin, err = time.ParseDuration(privacy.JitterMin); err != nil || jitterMin < 0 {
+			return 0, 0, fmt.Errorf("%w: jitter_min %q is not a duration", ErrInvalidPayoutBatch, privacy.JitterMin)
+		}
+	}
+	if privacy.JitterMax != "" {
+		if jitterMax, err = time.ParseDuration(privacy.JitterMax); err != nil || jitterMax < 0 {
+			return 0, 0, fmt.Errorf("%w: jitter_max %q is not a duration", ErrInvalidPayoutBatch, privacy.JitterMax)
+		}
+	} else {
+		jitterMax = jitterMin
+	}
+	if jitterMax < jitterMin || jitterMax > maxPayoutJitter {
+		return 0, 0, fmt.Errorf("%w: jitter_max must be at least jitter_min and at most %s", ErrInvalidPayoutBatch, maxPayoutJitter)
+	}
+
+	return jitterMin, jitterMax, nil
+}
+
+// randomDuration is uniform between low and high, from crypto/rand so that
+// the gaps between sends cannot be predicted.
+func randomDuration(low, high time.Duration) (time.Duration, error) {
+	if high <= low {
+		return low, nil
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(high-low)+1))
+	if err != nil {
+		return 0, err
+	}
+
+	return low + time.Duration(n.Int64()), nil
+}
+
+// shuffle permutes order in place with a Fisher-Yates shuffle.
+func shuffle(order []int) error {
+	for i := len(order) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i)+1))
+		if err != nil {
+			return err
+		}
+		order[i], order[j.Int64()] = order[j.Int64()], order[i]
+	}
+
+	return nil
+}
+
+func readPayoutBatches() ([]*PayoutBatch, error) {
+	var batches []*PayoutBatch
+	if err := readJSONFile(payoutsFile, &batches); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return batches, nil
+}
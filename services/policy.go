@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Policy holds the rules checked before any transaction is signed. Amounts
+// are decimal wei strings; an empty value disables the rule.
+type Policy struct {
+	// Contract interactions sending more than this value must target a
+	// contract the explorer reports as verified.
+	RequireVerifiedAbove string `json:"require_verified_above,omitempty"`
+
+	// An alert is raised when an account idle for at least this long (a Go
+	// duration such as "720h") is used again.
+	DormantAlertAfter string `json:"dormant_alert_after,omitempty"`
+
+	// AnomalyAction is "alert" or "require_approval" for sends that stand out
+	// from the account's history; AnomalyValueFactor is how many times the
+	// typical send size counts as unusually large (default 10).
+	AnomalyAction      string  `json:"anomaly_action,omitempty"`
+	AnomalyValueFactor float64 `json:"anomaly_value_factor,omitempty"`
+
+	// AllowedDelegates are the contracts an account may delegate to with
+	// EIP-7702. Delegation hands the contract full control of the account,
+	// so it is refused for any contract not listed.
+	AllowedDelegates []string `json:"allowed_delegates,omitempty"`
+
+	// RequireExchangeMemo refuses sends to a known exchange deposit address
+	// that needs a memo or destination tag when none is given, rather than
+	// warning about them.
+	RequireExchangeMemo bool `json:"require_exchange_memo,omitempty"`
+
+	// AddressBookOnly refuses transactions to any address without an entry
+	// in the address book for the chain.
+	AddressBookOnly bool `json:"address_book_only,omitempty"`
+}
+
+var (
+	policyFile = "policy.json"
+	policyMu   sync.Mutex
+)
+
+var (
+	ErrPolicyViolation = errors.New("blocked by policy")
+	ErrInvalidPolicy   = errors.New("invalid policy")
+)
+
+func GetPolicy() (*Policy, error) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+
+	return readPolicy()
+}
+
+func SetPolicy(policy Policy) (*Policy, error) {
+	if policy.RequireVerifiedAbove != "" {
+		if _, err := policyAmount(policy.RequireVerifiedAbove); err != nil {
+			return nil, err
+		}
+	}
+	if policy.DormantAlertAfter != "" {
+		if idle, err := time.ParseDuration(policy.DormantAlertAfter); err != nil || idle <= 0 {
+			return nil, fmt.Errorf("%w: %q is not a positive duration", ErrInvalidPolicy, policy.DormantAlertAfter)
+		}
+	}
+
+	switch policy.AnomalyAction {
+	case "", AnomalyActionAlert, AnomalyActionRequireApproval:
+	default:
+		return nil, fmt.Errorf("%w: unknown anomaly action %q", ErrInvalidPolicy, policy.AnomalyAction)
+	}
+	if policy.AnomalyValueFactor < 0 {
+		return nil, fmt.Errorf("%w: anomaly value factor must be positive", ErrInvalidPolicy)
+	}
+	for _, delegate := range policy.AllowedDelegates {
+		if !common.IsHexAddress(delegate) {
+			return nil, fmt.Errorf("%w: %q is not a delegate address", ErrInvalidPolicy, delegate)
+		}
+	}
+
+	policyMu.Lock()
+	defer policyMu.Unlock()
+
+	if err := writeJSONFile(policyFile, policy); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// enforcePolicy is called for every outgoing transaction before it is signed.
+func enforcePolicy(ctx context.Context, chain *Chain, from, to common.Address, value *big.Int) error {
+	policy, err := GetPolicy()
+	if err != nil {
+		return err
+	}
+
+	if policy.RequireVerifiedAbove != "" {
+		threshold, err := policyAmount(policy.RequireVerifiedAbove)
+		if err != nil {
+			return err
+		}
+		if value.Cmp(threshold) > 0 {
+			if err := requireVerified(ctx, chain, to); err != nil {
+				return err
+			}
+		}
+	}
+
+	return checkSpending(policy, from, to, value)
+}
+
+func requireVerified(ctx context.Context, chain *Chain, to common.Address) error {
+	contract, err := isContract(ctx, chain, to)
+	if err != nil || !contract {
+		return err
+	}
+
+	// Fail closed: an interaction the rule covers is not sent unless the
+	// explorer confirms the contract is verified.
+	info, err := LookupContract(ctx, chain, to)
+	if err != nil {
+		return fmt.Errorf("%w: cannot confirm contract %s is verified: %v", ErrPolicyViolation, to.Hex(), err)
+	}
+	if !info.Verified {
+		return fmt.Errorf("%w: contract %s is not verified", ErrPolicyViolation, to.Hex())
+	}
+
+	return nil
+}
+
+func policyAmount(value string) (*big.Int, error) {
+	amount, ok := new(big.Int).SetString(value, 10)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("%w: %q is not a wei amount", ErrInvalidPolicy, value)
+	}
+
+	return amount, nil
+}
+
+func readPolicy() (*Policy, error) {
+	policy := &Policy{}
+	if err := readJSONFile(policyFile, policy); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return policy, nil
+}
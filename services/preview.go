@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const previewTTL = 5 * time.Minute
+
+type TransactionPreview struct {
+	ID        string    `json:"id"`
+	ChainID   uint64    `json:"chain_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Value     string    `json:"value"`
+	GasLimit  uint64    `json:"gas_limit"`
+	GasPrice  string    `json:"gas_price"`
+	Fee       string    `json:"fee"`
+	Total     string    `json:"total"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Summary   string    `json:"summary,omitempty"`
+	// Provenance describes Recipient for people, as Summary does the rest.
+	Provenance string        `json:"provenance,omitempty"`
+	Data       string        `json:"data,omitempty"`
+	Calldata   *CalldataCost `json:"calldata,omitempty"`
+	Contract   *ContractInfo `json:"contract,omitempty"`
+	// Warnings flag a recipient that is a contract here but not on other
+	// configured chains, or the other way round.
+	Warnings []AddressWarning `json:"warnings,omitempty"`
+	// Recipient is how the recipient was resolved when it was given as a
+	// name. The preview is approved for the address it resolved to then,
+	// whatever the name points to by the time it is approved.
+	Recipient *NameResolution `json:"recipient,omitempty"`
+
+	chain    *Chain
+	value    *big.Int
+	gasPrice *big.Int
+	data     []byte
+}
+
+var (
+	previews   = map[string]*TransactionPreview{}
+	previewsMu sync.Mutex
+)
+
+var ErrPreviewNotFound = errors.New("transaction preview not found or expired")
+
+// PreviewTransaction prices a transaction to toAddress, which may also be
+// an ENS name or a DNS name imported into ENS.
+func PreviewTransaction(chain *Chain, toAddress string, value int64, data []byte) (*TransactionPreview, error) {
+	var recipient *NameResolution
+	if IsENSName(toAddress) {
+		var err error
+		if recipient, err = ResolveRecipient(chain, toAddress); err != nil {
+			return nil, err
+		}
+		toAddress = recipient.Address
+	}
+	if !common.IsHexAddress(toAddress) {
+		return nil, errors.New("invalid recipient address")
+	}
+
+	from, err := SelectedAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	amount := big.NewInt(value)
+	to := common.HexToAddress(toAddress)
+
+	_, gasLimit, err := estimateGasLimit(context.Background(), chain, common.HexToAddress(from), to, amount, data)
+	if err != nil {
+		return nil, err
+	}
+
+	gasPrice, err := chain.currentGasPrice(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))
+
+	contract, err := isContract(context.Background(), chain, to)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &TransactionPreview{
+		ID:        newID(),
+		ChainID:   chain.ID.Uint64(),
+		From:      from,
+		To:        to.Hex(),
+		Value:     amount.String(),
+		GasLimit:  gasLimit,
+		GasPrice:  gasPrice.String(),
+		Fee:       fee.String(),
+		Total:     new(big.Int).Add(amount, fee).String(),
+		ExpiresAt: time.Now().Add(previewTTL).UTC(),
+		Recipient: recipient,
+		Warnings:  crossChainWarnings(chain, to, contract),
+		chain:     chain,
+		value:     amount,
+		gasPrice:  gasPrice,
+		data:      data,
+	}
+	if len(data) > 0 {
+		cost := AnalyzeCalldata(data)
+		preview.Data = hexutil.Encode(data)
+		preview.Calldata = &cost
+	}
+	if contract {
+		info, err := LookupContract(context.Background(), chain, to)
+		if err != nil {
+			info = &ContractInfo{Address: to.Hex(), Error: err.Error()}
+		}
+		preview.Contract = info
+	}
+
+	previewsMu.Lock()
+	defer previewsMu.Unlock()
+
+	prunePreviews()
+	previews[preview.ID] = preview
+
+	return preview, nil
+}
+
+func ApproveTransaction(id string) (string, error) {
+	preview, err := takePreview(id)
+	if err != nil {
+		return "", err
+	}
+
+	signer, err := accountSigner(preview.From)
+	if err != nil {
+		return "", err
+	}
+
+	return sendTransaction(preview.chain, signer, common.HexToAddress(preview.To), preview.value, preview.GasLimit, preview.gasPrice, preview.data, nil)
+}
+
+// GetPreview returns a pending preview without taking it.
+func GetPreview(id string) (*TransactionPreview, error) {
+	previewsMu.Lock()
+	defer previewsMu.Unlock()
+
+	prunePreviews()
+	preview, ok := previews[id]
+	if !ok {
+		return nil, ErrPreviewNotFound
+	}
+
+	return preview, nil
+}
+
+func RejectTransaction(id string) error {
+	_, err := takePreview(id)
+	return err
+}
+
+func takePreview(id string) (*TransactionPreview, error) {
+	previewsMu.Lock()
+	defer previewsMu.Unlock()
+
+	prunePreviews()
+	preview, ok := previews[id]
+	if !ok {
+		return nil, ErrPreviewNotFound
+	}
+
+	delete(previews, id)
+	return preview, nil
+}
+
+func prunePreviews() {
+	now := time.Now()
+	for id, preview := range previews {
+		if now.After(preview.ExpiresAt) {
+			delete(previews, id)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// APIKeyQuota bounds what an API key can do, separately from the policy on
+// the accounts it signs for, so a leaked key can only do limited damage.
+// Zero fields are unlimited. ValuePerDay is decimal wei of native value sent
+// in any 24 hours; token amounts do not count towards it.
+type APIKeyQuota struct {
+	SignsPerHour    int    `json:"signs_per_hour,omitempty"`
+	ValuePerDay     string `json:"value_per_day,omitempty"`
+	MaxTransactions int    `json:"max_transactions,omitempty"`
+}
+
+// QuotaCharge is what one request uses. Every transaction is also a
+// signature.
+type QuotaCharge struct {
+	Signs        int
+	Transactions int
+	Value        *big.Int
+}
+
+// QuotaUsage is how much of its quota a key has used.
+type QuotaUsage struct {
+	Quota         *APIKeyQuota `json:"quota,omitempty"`
+	SignsLastHour int          `json:"signs_last_hour"`
+	ValueLastDay  string       `json:"value_last_day"`
+	Transactions  int          `json:"transactions"`
+}
+
+// keyUsage is the stored record of a key's recent use.
+type keyUsage struct {
+	Signs        []time.Time `json:"signs,omitempty"`
+	Sends        []quotaSend `json:"sends,omitempty"`
+	Transactions int         `json:"transactions"`
+}
+
+type quotaSend struct {
+	At    time.Time `json:"at"`
+	Value string    `json:"value"`
+}
+
+var (
+	quotaUsageFile = "api_key_usage.json"
+	quotaMu        sync.Mutex
+)
+
+var (
+	ErrQuotaExceeded = errors.New("API key quota exceeded")
+	ErrInvalidQuota  = errors.New("invalid quota")
+)
+
+func validateQuota(quota *APIKeyQuota) error {
+	if quota == nil {
+		return nil
+	}
+	if quota.SignsPerHour < 0 || quota.MaxTransactions < 0 {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalidQuota)
+	}
+	if quota.ValuePerDay != "" {
+		if value, ok := new(big.Int).SetString(quota.ValuePerDay, 10); !ok || value.Sign() < 0 {
+			return fmt.Errorf("%w: value_per_day %q is not a wei amount", ErrInvalidQuota, quota.ValuePerDay)
+		}
+	}
+
+	return nil
+}
+
+// SetAPIKeyQuota replaces a key's quota; nil removes it. Usage so far still
+// counts against the new limits.
+func SetAPIKeyQuota(id string, quota *APIKeyQuota) (*APIKey, error) {
+	if err := validateQuota(quota); err != nil {
+		return nil, err
+	}
+
+	apiKeysMu.Lock()
+	defer apiKeysMu.Unlock()
+
+	keys, err := readAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if key.ID != id {
+			continue
+		}
+
+		key.Quota = quota
+		if err := writeJSONFile(apiKeysFile, keys); err != nil {
+			return nil, err
+		}
+		recordAudit("apikey.quota_updated", fmt.Sprintf("quota for API key %q updated", key.Name),
+			map[string]interface{}{"key_id": id})
+
+		updated := *key
+		updated.Hash = ""
+		return &updated, nil
+	}
+
+	return nil, ErrAPIKeyNotFound
+}
+
+func GetAPIKeyUsage(id string) (*QuotaUsage, error) {
+	key, err := findAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+
+	usage, err := readQuotaUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &QuotaUsage{Quota: key.Quota, ValueLastDay: "0"}
+	if u := usage[id]; u != nil {
+		u.prune(time.Now())
+		report.SignsLastHour = len(u.Signs)
+		report.ValueLastDay = u.valueSent().String()
+		report.Transactions = u.Transactions
+	}
+
+	return report, nil
+}
+
+// ChargeQuota records a request's use against the quota of the API key it
+// was authenticated with, or fails with ErrQuotaExceeded if that would go
+// over a limit. Callers without an API key are not limited. The returned
+// refund gives the charge back, for a request that then fails.
+func ChargeQuota(principal *Principal, charge QuotaCharge) (func(), error) {
+	refund := func() {}
+	if principal == nil || principal.KeyID == "" {
+		return refund, nil
+	}
+
+	key, err := findAPIKey(principal.KeyID)
+	if err != nil {
+		return refund, err
+	}
+
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+
+	usage, err := readQuotaUsage()
+	if err != nil {
+		return refund, err
+	}
+	u := usage[key.ID]
+	if u == nil {
+		u = &keyUsage{}
+		usage[key.ID] = u
+	}
+
+	now := time.Now().UTC()
+	u.prune(now)
+	value := charge.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+
+	if quota := key.Quota; quota != nil {
+		if quota.SignsPerHour > 0 && len(u.Signs)+charge.Signs > quota.SignsPerHour {
+			return refund, fmt.Errorf("%w: %d signatures per hour", ErrQuotaExceeded, quota.SignsPerHour)
+		}
+		if quota.MaxTransactions > 0 && u.Transactions+charge.Transactions > quota.MaxTransactions {
+			return refund, fmt.Errorf("%w: %d transactions", ErrQuotaExceeded, quota.MaxTransactions)
+		}
+		if limit, ok := new(big.Int).SetString(quota.ValuePerDay, 10); ok && value.Sign() > 0 {
+			if new(big.Int).Add(u.valueSent(), value).Cmp(limit) > 0 {
+				return refund, fmt.Errorf("%w: %s wei per day", ErrQuotaExceeded, quota.ValuePerDay)
+			}
+		}
+	}
+
+	for i := 0; i < charge.Signs; i++ {
+		u.Signs = append(u.Signs, now)
+	}
+	u.Transactions += charge.Transactions
+	if value.Sign() > 0 {
+		u.Sends = append(u.Sends, quotaSend{At: now, Value: value.String()})
+	}
+	if err := writeJSONFile(quotaUsageFile, usage); err != nil {
+		return refund, err
+	}
+
+	refund = func() {
+		quotaMu.Lock()
+		defer quotaMu.Unlock()
+
+		usage, err := readQuotaUsage()
+		if err != nil || usage[key.ID] == nil {
+			return
+		}
+		u := usage[key.ID]
+		u.Signs = removeTimes(u.Signs, now, charge.Signs)
+		u.Transactions -= charge.Transactions
+		if u.Transactions < 0 {
+			u.Transactions = 0
+		}
+		for i, send := range u.Sends {
+			if send.At.Equal(now) && send.Value == value.String() {
+				u.Sends = append(u.Sends[:i], u.Sends[i+1:]...)
+				break
+			}
+		}
+		writeJSONFile(quotaUsageFile, usage)
+	}
+
+	return refund, nil
+}
+
+// prune drops signatures older than an hour and sends older than a day.
+func (u *keyUsage) prune(now time.Time) {
+	var signs []time.Time
+	for _, at := range u.Signs {
+		if now.Sub(at) < time.Hour {
+			signs = append(signs, at)
+		}
+	}
+	u.Signs = signs
+
+	var sends []quotaSend
+	for _, send := range u.Sends {
+		if now.Sub(send.At) < 24*time.Hour {
+			sends = append(sends, send)
+		}
+	}
+	u.Sends = sends
+}
+
+func (u *keyUsage) valueSent() *big.Int {
+	total := new(big.Int)
+	for _, send := range u.Sends {
+		if value, ok := new(big.Int).SetString(send.Value, 10); ok {
+			total.Add(total, value)
+		}
+	}
+
+	return total
+}
+
+func removeTimes(times []time.Time, at time.Time, n int) []time.Time {
+	var kept []time.Time
+	for _, t := range times {
+		if n > 0 && t.Equal(at) {
+			n--
+			continue
+		}
+		kept = append(kept, t)
+	}
+
+	return kept
+}
+
+func findAPIKey(id string) (*APIKey, error) {
+	apiKeysMu.Lock()
+	defer apiKeysMu.Unlock()
+
+	keys, err := readAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+
+	return nil, ErrAPIKeyNotFound
+}
+
+// forgetQuotaUsage drops a revoked key's usage.
+func forgetQuotaUsage(id string) {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+
+	usage, err := readQuotaUsage()
+	if err != nil || usage[id] == nil {
+		return
+	}
+
+	delete(usage, id)
+	writeJSONFile(quotaUsageFile, usage)
+}
+
+func readQuotaUsage() (map[string]*keyUsage, error) {
+	usage := map[string]*keyUsage{}
+	if err := readJSONFile(quotaUsageFile, &usage); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	ErrInvalidUnsignedTx = errors.New("invalid unsigned transaction")
+	ErrInvalidRawTx      = errors.New("invalid signed transaction")
+)
+
+// UnsignedTransaction is a transaction built for signing elsewhere. Unsigned
+// is its RLP signing payload: for a legacy transaction the EIP-155 list
+// ending in the chain ID, for an EIP-1559 one the typed payload without
+// signature. SigningHash is the Keccak-256 hash of it, which is what gets
+// signed.
+type UnsignedTransaction struct {
+	Type                 string `json:"tx_type"`
+	ChainID              uint64 `json:"chain_id"`
+	From                 string `json:"from"`
+	To                   string `json:"to"`
+	Value                string `json:"value"`
+	Data                 string `json:"data,omitempty"`
+	Nonce                uint64 `json:"nonce"`
+	Gas                  uint64 `json:"gas"`
+	GasPrice             string `json:"gas_price,omitempty"`
+	MaxFeePerGas         string `json:"max_fee_per_gas,omitempty"`
+	MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas,omitempty"`
+	Unsigned             string `json:"unsigned_transaction"`
+	SigningHash          string `json:"signing_hash"`
+}
+
+// SignedTransaction is a transaction signed but not broadcast.
+type SignedTransaction struct {
+	Hash  string `json:"transaction_hash"`
+	From  string `json:"from"`
+	RawTx string `json:"raw_transaction"`
+}
+
+// unsignedLegacyTx and unsignedDynamicFeeTx are the RLP layouts of the
+// signing payloads.
+type unsignedLegacyTx struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+	To       *common.Address `rlp:"nil"`
+	Value    *big.Int
+	Data     []byte
+	ChainID  *big.Int
+	R, S     uint
+}
+
+type unsignedDynamicFeeTx struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasTipCap  *big.Int
+	GasFeeCap  *big.Int
+	Gas        uint64
+	To         *common.Address `rlp:"nil"`
+	Value      *big.Int
+	Data       []byte
+	AccessList types.AccessList
+}
+
+// BuildTransaction builds a transaction from an account, the selected one if
+// empty, without signing it: the nonce is the one asked for or the account's
+// next free one, which is not reserved, and the gas and fees are filled in as
+// CreateAndSendTransaction would.
+func BuildTransaction(chain *Chain, account, toAddress string, value *big.Int, data []byte, fees FeeOptions) (*UnsignedTransaction, error) {
+	ctx := context.Background()
+
+	if !common.IsHexAddress(toAddress) {
+		return nil, errors.New("invalid recipient address")
+	}
+	status, err := GetNonceStatus(chain, account)
+	if err != nil {
+		return nil, err
+	}
+	from, to := common.HexToAddress(status.Account), common.HexToAddress(toAddress)
+
+	nonce := status.Next
+	if fees.Nonce != nil {
+		if *fees.Nonce < status.Pending {
+			return nil, fmt.Errorf("%w: the account's next nonce is %d", ErrNonceTooLow, status.Pending)
+		}
+		nonce = *fees.Nonce
+	}
+
+	_, gasLimit, err := estimateGasLimit(ctx, chain, from, to, value, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var txData types.TxData
+	switch fees.Type {
+	case "", TxTypeLegacy:
+		if fees.MaxFeePerGas != nil || fees.MaxPriorityFeePerGas != nil {
+			return nil, fmt.Errorf("%w: max fees only apply to %s transactions", ErrInvalidFees, TxTypeDynamicFee)
+		}
+		gasPrice, err := chain.currentGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		txData = &types.LegacyTx{Nonce: nonce, To: &to, Value: value, Gas: gasLimit, GasPrice: gasPrice, Data: data}
+	case TxTypeDynamicFee:
+		feeCap, tip, err := chain.dynamicFees(ctx, fees)
+		if err != nil {
+			return nil, err
+		}
+		txData = &types.DynamicFeeTx{ChainID: chain.ID, Nonce: nonce, GasTipCap: tip, GasFeeCap: feeCap, Gas: gasLimit, To: &to, Value: value, Data: data}
+	default:
+		return nil, fmt.Errorf("%w: unknown transaction type %q", ErrInvalidFees, fees.Type)
+	}
+
+	unsigned, err := describeUnsigned(types.NewTx(txData), chain.ID)
+	if err != nil {
+		return nil, err
+	}
+	unsigned.From = from.Hex()
+
+	return unsigned, nil
+}
+
+func describeUnsigned(tx *types.Transaction, chainID *big.Int) (*UnsignedTransaction, error) {
+	unsigned := &UnsignedTransaction{
+		ChainID: chainID.Uint64(),
+		To:      tx.To().Hex(),
+		Value:   tx.Value().String(),
+		Nonce:   tx.Nonce(),
+		Gas:     tx.Gas(),
+	}
+	if len(tx.Data()) > 0 {
+		unsigned.Data = hexutil.Encode(tx.Data())
+	}
+
+	var payload []byte
+	var err error
+	if tx.Type() == types.DynamicFeeTxType {
+		unsigned.Type = TxTypeDynamicFee
+		unsigned.MaxFeePerGas = tx.GasFeeCap().String()
+		unsigned.MaxPriorityFeePerGas = tx.GasTipCap().String()
+		payload, err = rlp.EncodeToBytes(&unsignedDynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      tx.Nonce(),
+			GasTipCap:  tx.GasTipCap(),
+			GasFeeCap:  tx.GasFeeCap(),
+			Gas:        tx.Gas(),
+			To:         tx.To(),
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		})
+		payload = append([]byte{types.DynamicFeeTxType}, payload...)
+	} else {
+		unsigned.Type = TxTypeLegacy
+		unsigned.GasPrice = tx.GasPrice().String()
+		payload, err = rlp.EncodeToBytes(&unsignedLegacyTx{
+			Nonce:    tx.Nonce(),
+			GasPrice: tx.GasPrice(),
+			Gas:      tx.Gas(),
+			To:       tx.To(),
+			Value:    tx.Value(),
+			Data:     tx.Data(),
+			ChainID:  chainID,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	unsigned.Unsigned = hexutil.Encode(payload)
+	unsigned.SigningHash = signerForChain(chainID).Hash(tx).Hex()
+	return unsigned, nil
+}
+
+// decodeUnsigned reads a signing payload back into a transaction and the
+// chain it is for.
+func decodeUnsigned(payloadHex string) (types.TxData, *big.Int, error) {
+	payload, err := hexutil.Decode(payloadHex)
+	if err != nil || len(payload) == 0 {
+		return nil, nil, fmt.Errorf("%w: not 0x-prefixed hex", ErrInvalidUnsignedTx)
+	}
+
+	if payload[0] == types.DynamicFeeTxType {
+		var tx unsignedDynamicFeeTx
+		if err := rlp.DecodeBytes(payload[1:], &tx); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidUnsignedTx, err)
+		}
+		if tx.To == nil || tx.ChainID == nil || tx.ChainID.Sign() == 0 {
+			return nil, nil, fmt.Errorf("%w: a recipient and chain ID are required", ErrInvalidUnsignedTx)
+		}
+		return &types.DynamicFeeTx{
+			ChainID:    tx.ChainID,
+			Nonce:      tx.Nonce,
+			GasTipCap:  tx.GasTipCap,
+			GasFeeCap:  tx.GasFeeCap,
+			Gas:        tx.Gas,
+			To:         tx.To,
+			Value:      tx.Value,
+			Data:       tx.Data,
+			AccessList: tx.AccessList,
+		}, tx.ChainID, nil
+	}
+
+	var tx unsignedLegacyTx
+	if err := rlp.DecodeBytes(payload, &tx); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidUnsignedTx, err)
+	}
+	if tx.To == nil || tx.ChainID == nil || tx.ChainID.Sign() == 0 || tx.R != 0 || tx.S != 0 {
+		return nil, nil, fmt.Errorf("%w: a recipient and EIP-155 chain ID are required", ErrInvalidUnsignedTx)
+	}
+
+	return &types.LegacyTx{
+		Nonce:    tx.Nonce,
+		GasPrice: tx.GasPrice,
+		Gas:      tx.Gas,
+		To:       tx.To,
+		Value:    tx.Value,
+		Data:     tx.Data,
+	}, tx.ChainID, nil
+}
+
+// SignUnsignedTransaction signs a transaction built by BuildTransaction, or
+// anything else with the same payload, with an account's key, the selected
+// one if empty. It needs no node and broadcasts nothing, so it can run on
+// an air-gapped wallet; the spending anomaly check still applies.
+func SignUnsignedTransaction(account, unsignedHex string) (*SignedTransaction, error) {
+	txData, chainID, err := decodeUnsigned(unsignedHex)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := loadSignerFor(account)
+	if err != nil {
+		return nil, err
+	}
+	from := signer.Address()
+
+	tx := types.NewTx(txData)
+	policy, err := GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSpending(policy, from, *tx.To(), tx.Value()); err != nil {
+		return nil, err
+	}
+
+	signedTx, err := signer.SignTx(chainID, tx)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signedTx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	recordSignature(from)
+	return &SignedTransaction{Hash: signedTx.Hash().Hex(), From: from.Hex(), RawTx: hexutil.Encode(raw)}, nil
+}
+
+// BroadcastRawTransaction sends a transaction signed elsewhere to the chain
+// it names and records it in the history. If the node cannot be reached it
+// is queued and rebroadcast like the wallet's own sends.
+func BroadcastRawTransaction(rawHex string) (string, string, error) {
+	signedTx, err := decodeRawTransaction(strings.TrimSpace(rawHex))
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidRawTx, err)
+	}
+
+	chainID := uint64(0)
+	if signedTx.Protected() {
+		chainID = signedTx.ChainId().Uint64()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcReadTimeout)
+	defer cancel()
+	chain, err := chainByID(ctx, chainID)
+	if err != nil {
+		return "", "", err
+	}
+
+	from, err := types.Sender(signerForChain(chain.ID), signedTx)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidRawTx, err)
+	}
+
+	status := StatusPending
+	if err := chain.client.SendTransaction(context.Background(), signedTx); err != nil {
+		if !isConnectivityError(err) {
+			return "", "", err
+		}
+		if err := queueBroadcast(signedTx, from, err); err != nil {
+			return "", "", err
+		}
+		status = StatusQueued
+	}
+
+	to := ""
+	if signedTx.To() != nil {
+		to = signedTx.To().Hex()
+	}
+	txHash := signedTx.Hash().Hex()
+	err = recordTransactionOnce(signedBy(TransactionRecord{
+		Hash:      txHash,
+		ChainID:   chain.ID.Uint64(),
+		From:      from.Hex(),
+		To:        to,
+		Value:     signedTx.Value().String(),
+		Status:    status,
+		CreatedAt: time.Now().UTC(),
+	}, signedTx))
+	if err != nil {
+		log.Printf("failed to record transaction %s: %v", txHash, err)
+	}
+
+	return txHash, status, nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jabbala-dev/go-wallet/models"
+)
+
+const receiptWatchInterval = 15 * time.Second
+
+// confirmationDepth is how many blocks, counting the one it is in, must hold
+// a transaction before it is confirmed or failed. CONFIRMATION_DEPTH sets it
+// (default 1).
+var confirmationDepth atomic.Uint64
+
+func init() {
+	confirmationDepth.Store(1)
+}
+
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// ConfirmationDepth returns the number of blocks a transaction waits for.
+func ConfirmationDepth() uint64 {
+	return confirmationDepth.Load()
+}
+
+// confirmations counts the blocks from the one at number up to head.
+func confirmations(head, number uint64) uint64 {
+	if number == 0 || head < number {
+		return 0
+	}
+
+	return head - number + 1
+}
+
+type TransactionStatus = models.TransactionStatus
+
+// GetTransactionStatus looks a transaction up in the history, checking a
+// pending one for its receipt first.
+func GetTransactionStatus(hash string) (*TransactionStatus, error) {
+	historyMu.Lock()
+	record, err := history.get(hash)
+	if err == nil && record != nil && refreshPendingStatus(record) {
+		err = history.update(*record)
+	}
+	historyMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrTransactionNotFound
+	}
+
+	status := &TransactionStatus{Transaction: *record, RequiredConfirmations: ConfirmationDepth()}
+	if record.BlockNumber == 0 {
+		return status, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcReadTimeout)
+	defer cancel()
+
+	chain, err := chainByID(ctx, record.ChainID)
+	if err != nil {
+		return status, nil
+	}
+	if head, err := chain.client.BlockNumber(ctx); err == nil {
+		status.Confirmations = confirmations(head, record.BlockNumber)
+	}
+
+	return status, nil
+}
+
+var (
+	transactionWaitersMu sync.Mutex
+	// transactionWaiters are the channels of requests waiting on each
+	// transaction, by lowercased hash.
+	transactionWaiters = map[string][]chan struct{}{}
+)
+
+// WaitForTransactionStatus is GetTransactionStatus, except that a
+// transaction not yet confirmed, failed or replaced is waited on, for up to wait or
+// until ctx is done, and reported as it is then. The wait ends early when an
+// event for the transaction leaves the outbox.
+func WaitForTransactionStatus(ctx context.Context, hash string, wait time.Duration) (*TransactionStatus, error) {
+	changed, stop := watchTransaction(hash)
+	defer stop()
+
+	status, err := GetTransactionStatus(hash)
+	if err != nil || wait <= 0 || status.Status == StatusConfirmed || status.Status == StatusFailed || status.Status == StatusReplaced {
+		return status, err
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-changed:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	return GetTransactionStatus(hash)
+}
+
+// watchTransaction returns a channel that is closed on the next event for
+// the transaction, and a function to stop watching.
+func watchTransaction(hash string) (<-chan struct{}, func()) {
+	key := strings.ToLower(hash)
+	changed := make(chan struct{})
+
+	transactionWaitersMu.Lock()
+	transactionWaiters[key] = append(transactionWaiters[key], changed)
+	transactionWaitersMu.Unlock()
+
+	return changed, func() {
+		transactionWaitersMu.Lock()
+		defer transactionWaitersMu.Unlock()
+
+		waiters := transactionWaiters[key]
+		for i, waiter := range waiters {
+			if waiter == changed {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(transactionWaiters, key)
+		} else {
+			transactionWaiters[key] = waiters
+		}
+	}
+}
+
+// wakeTransactionWaiters ends the waits on a transaction. Each waiter is
+// woken once and then forgotten.
+func wakeTransactionWaiters(hash string) {
+	key := strings.ToLower(hash)
+
+	transactionWaitersMu.Lock()
+	defer transactionWaitersMu.Unlock()
+
+	for _, waiter := range transactionWaiters[key] {
+		close(waiter)
+	}
+	delete(transactionWaiters, key)
+}
+
+// StartReceiptWatcher checks pending transactions for their receipts every
+// 15 seconds, so that they are confirmed whether or not anyone asks.
+func StartReceiptWatcher() {
+	if raw := os.Getenv("CONFIRMATION_DEPTH"); raw != "" {
+		if depth, err := strconv.ParseUint(raw, 10, 64); err == nil && depth > 0 {
+			confirmationDepth.Store(depth)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(receiptWatchInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := watchReceipts(); err != nil {
+				log.Printf("receipt watcher: %v", err)
+			}
+		}
+	}()
+}
+
+func watchReceipts() error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	records, err := history.list(TransactionFilter{Status: StatusPending})
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if refreshPendingStatus(&record) {
+			if err := history.update(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
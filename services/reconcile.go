@@ -0,0 +1,486 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Kinds of drift between local state and the chain found at startup.
+const (
+	// DriftMissedReceipt: a queued or pending transaction was mined while
+	// the wallet was not watching. Its status is updated from the receipt.
+	DriftMissedReceipt = "missed_receipt"
+	// DriftInPool: a transaction still queued for broadcast is already in
+	// the node's pending pool. It is taken off the queue.
+	DriftInPool = "already_in_pool"
+	// DriftNonceUsed: another transaction was mined with the nonce of a
+	// queued or pending one, which can therefore never be mined. It is
+	// marked failed and taken off the queue.
+	DriftNonceUsed = "nonce_used"
+	// DriftDropped: a pending transaction is unknown to the node. If the
+	// signed transaction is still journalled it is queued for rebroadcast.
+	DriftDropped = "dropped"
+	// DriftNonceGap: the lowest nonce waiting to be broadcast is above the
+	// node's pending nonce, so nothing queued can be mined until the gap is
+	// filled. Only reported.
+	DriftNonceGap = "nonce_gap"
+
+	reconcileInterval = time.Minute
+	// reconcileChainTimeout bounds the checks of one chain in one run.
+	reconcileChainTimeout = 2 * time.Minute
+)
+
+// Discrepancy is one difference found between local state and the chain.
+// Fixed is set when the wallet corrected its own state to match.
+type Discrepancy struct {
+	Kind    string    `json:"kind"`
+	ChainID uint64    `json:"chain_id,omitempty"`
+	Account string    `json:"account,omitempty"`
+	Hash    string    `json:"hash,omitempty"`
+	Nonce   *uint64   `json:"nonce,omitempty"`
+	Detail  string    `json:"detail"`
+	Fixed   bool      `json:"fixed"`
+	FoundAt time.Time `json:"found_at"`
+}
+
+// Reconciliation is the outcome of checking local state against the chain
+// at startup. Completed is only set once every chain with local state to
+// check could be reached.
+type Reconciliation struct {
+	Completed     bool          `json:"completed"`
+	StartedAt     time.Time     `json:"started_at"`
+	CompletedAt   *time.Time    `json:"completed_at,omitempty"`
+	Checked       int           `json:"checked"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+	Unreachable   []uint64      `json:"unreachable_chains,omitempty"`
+	LastError     string        `json:"last_error,omitempty"`
+}
+
+var (
+	reconcileMu sync.Mutex
+	reconciled  = Reconciliation{Discrepancies: []Discrepancy{}}
+
+	// reconciledChains are the chains already checked, so a retry after
+	// another chain was unreachable does not report the same drift twice.
+	reconciledChains = map[uint64]bool{}
+)
+
+// ReconciliationStatus returns the startup reconciliation so far.
+func ReconciliationStatus() Reconciliation {
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	status := reconciled
+	status.Discrepancies = append([]Discrepancy{}, reconciled.Discrepancies...)
+	status.Unreachable = append([]uint64(nil), reconciled.Unreachable...)
+	return status
+}
+
+// StartReconciler settles what an earlier process left behind and then checks
+// queued and pending transactions and nonces against the node, retrying until
+// every chain involved could be checked. The signing journal is recovered
+// first, since that may put transactions back in the broadcast queue.
+func StartReconciler() {
+	reconcileMu.Lock()
+	reconciled.StartedAt = time.Now().UTC()
+	reconcileMu.Unlock()
+
+	go func() {
+		for {
+			err := reconcile()
+			if err != nil {
+				log.Printf("reconciliation: %v", err)
+			}
+
+			reconcileMu.Lock()
+			done := reconciled.Completed
+			if err != nil {
+				reconciled.LastError = err.Error()
+			}
+			reconcileMu.Unlock()
+			if done {
+				return
+			}
+			time.Sleep(reconcileInterval)
+		}
+	}()
+}
+
+func reconcile() error {
+	unresolved, err := recoverJournal()
+	if err != nil {
+		return fmt.Errorf("signing journal: %w", err)
+	}
+
+	historyMu.Lock()
+	records, err := readHistory()
+	historyMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	broadcastMu.Lock()
+	queue, err := readBroadcastQueue()
+	broadcastMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	journalMu.Lock()
+	entries, err := readJournal()
+	journalMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	r := &reconciler{
+		queued:  map[string]bool{},
+		journal: map[string]*SigningJournalEntry{},
+	}
+	for _, pending := range queue {
+		r.queued[strings.ToLower(pending.Hash)] = true
+	}
+	for _, entry := range entries {
+		if entry.RawTx != "" {
+			r.journal[strings.ToLower(entry.Hash)] = entry
+		}
+	}
+
+	chainIDs := map[uint64]bool{}
+	byChain := map[uint64][]TransactionRecord{}
+	for _, record := range records {
+		if record.Status == StatusQueued || record.Status == StatusPending {
+			chainIDs[record.ChainID] = true
+			byChain[record.ChainID] = append(byChain[record.ChainID], record)
+		}
+	}
+	queueByChain := map[uint64][]*PendingBroadcast{}
+	for _, pending := range queue {
+		chainIDs[pending.ChainID] = true
+		queueByChain[pending.ChainID] = append(queueByChain[pending.ChainID], pending)
+	}
+
+	var unreachable []uint64
+	for id := range chainIDs {
+		reconcileMu.Lock()
+		done := reconciledChains[id]
+		reconcileMu.Unlock()
+		if done {
+			continue
+		}
+
+		if err := r.reconcileChain(id, queueByChain[id], byChain[id]); err != nil {
+			log.Printf("reconciliation: chain %d: %v", id, err)
+			unreachable = append(unreachable, id)
+			continue
+		}
+
+		reconcileMu.Lock()
+		reconciledChains[id] = true
+		reconcileMu.Unlock()
+	}
+	sort.Slice(unreachable, func(i, j int) bool { return unreachable[i] < unreachable[j] })
+
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	reconciled.Checked += r.checked
+	reconciled.Discrepancies = append(reconciled.Discrepancies, r.found...)
+	reconciled.Unreachable = unreachable
+	if len(unreachable) > 0 || unresolved > 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	reconciled.Completed = true
+	reconciled.CompletedAt = &now
+	reconciled.LastError = ""
+
+	fixed := 0
+	for _, found := range reconciled.Discrepancies {
+		if found.Fixed {
+			fixed++
+		}
+	}
+	recordAudit("reconciliation.completed",
+		fmt.Sprintf("checked %d transactions against the chain; %d discrepancies, %d fixed", reconciled.Checked, len(reconciled.Discrepancies), fixed),
+		map[string]interface{}{"checked": reconciled.Checked, "discrepancies": len(reconciled.Discrepancies), "fixed": fixed})
+
+	return nil
+}
+
+type reconciler struct {
+	queued  map[string]bool
+	journal map[string]*SigningJournalEntry
+	checked int
+	found   []Discrepancy
+}
+
+// reconcileChain checks one chain's broadcast queue and then the history
+// records the queue does not cover. It returns an error, leaving the chain to
+// the next run, if the node cannot be asked.
+func (r *reconciler) reconcileChain(id uint64, queue []*PendingBroadcast, records []TransactionRecord) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileChainTimeout)
+	defer cancel()
+
+	chain, err := chainByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	mined := map[common.Address]uint64{}
+	minedNonce := func(account common.Address) (uint64, error) {
+		if nonce, ok := mined[account]; ok {
+			return nonce, nil
+		}
+		nonce, err := chain.client.NonceAt(ctx, account, nil)
+		if err != nil {
+			return 0, err
+		}
+		mined[account] = nonce
+		return nonce, nil
+	}
+
+	sort.Slice(queue, func(i, j int) bool { return queue[i].Nonce < queue[j].Nonce })
+
+	drop := map[string]bool{}
+	lowest := map[common.Address]uint64{}
+	for _, pending := range queue {
+		r.checked++
+		from := common.HexToAddress(pending.From)
+		nonce := pending.Nonce
+		found := Discrepancy{ChainID: id, Account: from.Hex(), Hash: pending.Hash, Nonce: &nonce}
+
+		status, known, err := r.lookup(ctx, chain, pending.Hash)
+		if err != nil {
+			return err
+		}
+		switch {
+		case status != "":
+			found.Kind = DriftMissedReceipt
+			found.Detail = "queued transaction was mined as " + status
+			r.fix(found, pending.Hash, status)
+			drop[pending.Hash] = true
+			continue
+		case known:
+			found.Kind = DriftInPool
+			found.Detail = "queued transaction is already in the node's pending pool"
+			r.fix(found, pending.Hash, StatusPending)
+			drop[pending.Hash] = true
+			continue
+		}
+
+		used, err := minedNonce(from)
+		if err != nil {
+			return err
+		}
+		if used > pending.Nonce {
+			found.Kind = DriftNonceUsed
+			found.Detail = fmt.Sprintf("nonce %d was used by another transaction", pending.Nonce)
+			r.fix(found, pending.Hash, StatusFailed)
+			drop[pending.Hash] = true
+			continue
+		}
+
+		if _, ok := lowest[from]; !ok {
+			lowest[from] = pending.Nonce
+		}
+	}
+
+	if err := dropQueued(drop); err != nil {
+		return err
+	}
+
+	for from, nonce := range lowest {
+		next, err := chain.client.PendingNonceAt(ctx, from)
+		if err != nil {
+			return err
+		}
+		if nonce > next {
+			nonce := nonce
+			r.report(Discrepancy{
+				Kind:    DriftNonceGap,
+				ChainID: id,
+				Account: from.Hex(),
+				Nonce:   &nonce,
+				Detail:  fmt.Sprintf("node's next nonce is %d but the lowest queued nonce is %d", next, nonce),
+			})
+		}
+	}
+
+	for _, record := range records {
+		if r.queued[strings.ToLower(record.Hash)] {
+			// The queue check above covered it.
+			continue
+		}
+		r.checked++
+		found := Discrepancy{ChainID: id, Account: record.From, Hash: record.Hash}
+
+		status, known, err := r.lookup(ctx, chain, record.Hash)
+		if err != nil {
+			return err
+		}
+		switch {
+		case status != "":
+			found.Kind = DriftMissedReceipt
+			found.Detail = fmt.Sprintf("%s transaction was mined as %s", record.Status, status)
+			r.fix(found, record.Hash, status)
+			continue
+		case known:
+			if record.Status == StatusQueued {
+				found.Kind = DriftInPool
+				found.Detail = "queued transaction is already in the node's pending pool"
+				r.fix(found, record.Hash, StatusPending)
+			}
+			continue
+		}
+
+		if err := r.resolveUnknown(ctx, found, minedNonce); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveUnknown handles a transaction the node has neither mined nor holds
+// in its pool. Without the signed transaction its nonce is unknown, so the
+// drift can only be reported.
+func (r *reconciler) resolveUnknown(ctx context.Context, found Discrepancy, minedNonce func(common.Address) (uint64, error)) error {
+	found.Kind = DriftDropped
+
+	entry, ok := r.journal[strings.ToLower(found.Hash)]
+	if !ok {
+		found.Detail = "transaction is unknown to the node and its signed form was not kept, so it cannot be rebroadcast"
+		r.report(found)
+		return nil
+	}
+
+	raw, err := hexutil.Decode(entry.RawTx)
+	tx := new(types.Transaction)
+	if err == nil {
+		err = tx.UnmarshalBinary(raw)
+	}
+	if err != nil {
+		found.Detail = "transaction is unknown to the node and its journalled form is unreadable: " + err.Error()
+		r.report(found)
+		return nil
+	}
+
+	nonce := tx.Nonce()
+	found.Nonce = &nonce
+
+	from := common.HexToAddress(entry.From)
+	used, err := minedNonce(from)
+	if err != nil {
+		return err
+	}
+	if used > nonce {
+		found.Kind = DriftNonceUsed
+		found.Detail = fmt.Sprintf("nonce %d was used by another transaction", nonce)
+		r.fix(found, found.Hash, StatusFailed)
+		return nil
+	}
+
+	if err := queueBroadcast(tx, from, errors.New("dropped from the node's pending pool; found at startup")); err != nil {
+		return err
+	}
+	found.Detail = "transaction is unknown to the node; queued for rebroadcast"
+	r.fix(found, found.Hash, StatusQueued)
+	return nil
+}
+
+// lookup returns the final status of a mined transaction, or whether the node
+// knows it at all when it is not mined yet.
+func (r *reconciler) lookup(ctx context.Context, chain *Chain, hash string) (string, bool, error) {
+	receipt, err := chain.client.TransactionReceipt(ctx, common.HexToHash(hash))
+	if err == nil {
+		if receipt.Status == types.ReceiptStatusSuccessful {
+			return StatusConfirmed, true, nil
+		}
+		return StatusFailed, true, nil
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return "", false, err
+	}
+
+	_, _, err = chain.client.TransactionByHash(ctx, common.HexToHash(hash))
+	if err == nil {
+		return "", true, nil
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return "", false, err
+	}
+
+	return "", false, nil
+}
+
+// fix corrects the history status of hash and reports what was corrected.
+func (r *reconciler) fix(found Discrepancy, hash, status string) {
+	if err := setTransactionStatus(hash, status); err != nil {
+		found.Detail += "; failed to update history: " + err.Error()
+		r.report(found)
+		return
+	}
+
+	found.Fixed = true
+	r.report(found)
+}
+
+func (r *reconciler) report(found Discrepancy) {
+	found.FoundAt = time.Now().UTC()
+	r.found = append(r.found, found)
+
+	details := map[string]interface{}{
+		"kind":  found.Kind,
+		"fixed": found.Fixed,
+	}
+	if found.ChainID != 0 {
+		details["chain_id"] = found.ChainID
+	}
+	if found.Account != "" {
+		details["account"] = found.Account
+	}
+	if found.Hash != "" {
+		details["hash"] = found.Hash
+	}
+	if found.Nonce != nil {
+		details["nonce"] = *found.Nonce
+	}
+	recordAudit("reconciliation.discrepancy", found.Detail, details)
+}
+
+// dropQueued takes transactions off the broadcast queue.
+func dropQueued(hashes map[string]bool) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	broadcastMu.Lock()
+	defer broadcastMu.Unlock()
+
+	queue, err := readBroadcastQueue()
+	if err != nil {
+		return err
+	}
+
+	kept := queue[:0]
+	for _, pending := range queue {
+		if !hashes[pending.Hash] {
+			kept = append(kept, pending)
+		}
+	}
+
+	return writeJSONFile(broadcastFile, kept)
+}
@@ -0,0 +1,612 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Social recovery is done by a module the smart account has enabled, at
+// SOCIAL_RECOVERY_MODULE. The module keeps each account's guardians and
+// threshold, which only the account itself can change, and replaces the
+// account's owner once threshold guardians have signed an EIP-712 Recovery
+// for it. Signatures are passed ordered by guardian address.
+const recoveryModuleABIJSON = `[
+	{"type":"function","name":"getGuardians","stateMutability":"view","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"address[]"}]},
+	{"type":"function","name":"threshold","stateMutability":"view","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"recoveryNonce","stateMutability":"view","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"addGuardian","stateMutability":"nonpayable","inputs":[{"name":"guardian","type":"address"}],"outputs":[]},
+	{"type":"function","name":"removeGuardian","stateMutability":"nonpayable","inputs":[{"name":"guardian","type":"address"}],"outputs":[]},
+	{"type":"function","name":"setThreshold","stateMutability":"nonpayable","inputs":[{"name":"threshold","type":"uint256"}],"outputs":[]},
+	{"type":"function","name":"executeRecovery","stateMutability":"nonpayable","inputs":[{"name":"account","type":"address"},{"name":"newOwner","type":"address"},{"name":"signatures","type":"bytes[]"}],"outputs":[]}
+]`
+
+var recoveryModuleABI = mustParseABI(recoveryModuleABIJSON)
+
+const (
+	RecoveryCollecting = "collecting"
+	RecoverySubmitted  = "submitted"
+	RecoveryCompleted  = "completed"
+	RecoveryFailed     = "failed"
+)
+
+// GuardianSet is a smart account's guardians and how many of them must sign
+// a recovery, as the module has them on one chain.
+type GuardianSet struct {
+	Account   string   `json:"account"`
+	ChainID   uint64   `json:"chain_id"`
+	Module    string   `json:"module"`
+	Guardians []string `json:"guardians"`
+	Threshold uint64   `json:"threshold"`
+}
+
+// Recovery is a request to rotate a smart account's owner, collecting
+// guardian signatures until it can be executed.
+type Recovery struct {
+	ID         string              `json:"id"`
+	Account    string              `json:"account"`
+	NewOwner   string              `json:"new_owner"`
+	ChainID    uint64              `json:"chain_id"`
+	Module     string              `json:"module"`
+	Nonce      string              `json:"nonce"`
+	Hash       string              `json:"hash"`
+	Status     string              `json:"status"`
+	Signatures []GuardianSignature `json:"signatures"`
+	TxHash     string              `json:"tx_hash,omitempty"`
+	CreatedAt  time.Time           `json:"created_at"`
+	ExecutedAt *time.Time          `json:"executed_at,omitempty"`
+
+	// TypedData is what guardians sign, filled in when a recovery is read.
+	TypedData *apitypes.TypedData `json:"typed_data,omitempty"`
+}
+
+type GuardianSignature struct {
+	Guardian  string    `json:"guardian"`
+	Signature string    `json:"signature"`
+	SignedAt  time.Time `json:"signed_at"`
+}
+
+var (
+	recoveriesFile = "recoveries.json"
+	recoveriesMu   sync.Mutex
+)
+
+var (
+	ErrRecoveryUnavailable   = errors.New("social recovery is not available")
+	ErrRecoveryNotFound      = errors.New("recovery not found")
+	ErrNotGuardian           = errors.New("not a guardian of this account")
+	ErrInvalidThreshold      = errors.New("invalid guardian threshold")
+	ErrThresholdNotMet       = errors.New("not enough guardian signatures")
+	ErrRecoveryStale         = errors.New("the account's recovery nonce has changed; start a new recovery")
+	ErrRecoveryNotCollecting = errors.New("recovery is no longer collecting signatures")
+)
+
+// GetGuardians reads a smart account's guardians and threshold on chain.
+func GetGuardians(chain *Chain, address string) (*GuardianSet, error) {
+	account, err := findSmartAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	module, err := recoveryModule(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	guardians, threshold, err := guardianSet(chain, module, common.HexToAddress(account.Address))
+	if err != nil {
+		return nil, err
+	}
+
+	set := &GuardianSet{
+		Account:   account.Address,
+		ChainID:   chain.ID.Uint64(),
+		Module:    module.Hex(),
+		Guardians: make([]string, len(guardians)),
+		Threshold: threshold,
+	}
+	for i, guardian := range guardians {
+		set.Guardians[i] = guardian.Hex()
+	}
+
+	return set, nil
+}
+
+// AddGuardian has a smart account add a guardian, in a UserOperation.
+func AddGuardian(chain *Chain, address, guardian string) (*UserOperationResult, error) {
+	if !common.IsHexAddress(guardian) {
+		return nil, errors.New("invalid guardian address")
+	}
+
+	return sendGuardianChange(chain, address, "guardian.added", "addGuardian", common.HexToAddress(guardian))
+}
+
+// RemoveGuardian has a smart account remove a guardian. It is refused if
+// the threshold would then exceed the guardians left.
+func RemoveGuardian(chain *Chain, address, guardian string) (*UserOperationResult, error) {
+	if !common.IsHexAddress(guardian) {
+		return nil, errors.New("invalid guardian address")
+	}
+
+	account, err := findSmartAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	module, err := recoveryModule(chain)
+	if err != nil {
+		return nil, err
+	}
+	guardians, threshold, err := guardianSet(chain, module, common.HexToAddress(account.Address))
+	if err != nil {
+		return nil, err
+	}
+	if !containsAddress(guardians, common.HexToAddress(guardian)) {
+		return nil, ErrNotGuardian
+	}
+	if uint64(len(guardians)-1) < threshold {
+		return nil, fmt.Errorf("%w: lower the threshold of %d before removing a guardian", ErrInvalidThreshold, threshold)
+	}
+
+	return sendGuardianChange(chain, address, "guardian.removed", "removeGuardian", common.HexToAddress(guardian))
+}
+
+// SetGuardianThreshold has a smart account change how many guardians must
+// sign a recovery, between one and the number of guardians.
+func SetGuardianThreshold(chain *Chain, address string, threshold uint64) (*UserOperationResult, error) {
+	account, err := findSmartAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	module, err := recoveryModule(chain)
+	if err != nil {
+		return nil, err
+	}
+	guardians, _, err := guardianSet(chain, module, common.HexToAddress(account.Address))
+	if err != nil {
+		return nil, err
+	}
+	if threshold < 1 || threshold > uint64(len(guardians)) {
+		return nil, fmt.Errorf("%w: must be between 1 and %d, the number of guardians", ErrInvalidThreshold, len(guardians))
+	}
+
+	return sendGuardianChange(chain, address, "guardian.threshold_set", "setThreshold", new(big.Int).SetUint64(threshold))
+}
+
+func sendGuardianChange(chain *Chain, address, kind, method string, arg interface{}) (*UserOperationResult, error) {
+	module, err := recoveryModule(chain)
+	if err != nil {
+		return nil, err
+	}
+	data, err := recoveryModuleABI.Pack(method, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := SendUserOperation(chain, address, module.Hex(), nil, data)
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(kind, fmt.Sprintf("%s %v for smart account %s", method, arg, result.Sender),
+		map[string]interface{}{"account": result.Sender, "change": fmt.Sprint(arg), "user_op_hash": result.Hash, "chain_id": chain.ID.Uint64()})
+	return result, nil
+}
+
+// StartRecovery opens a recovery of a smart account to newOwner. Guardians
+// sign the returned typed data and their signatures are added with
+// AddRecoverySignature.
+func StartRecovery(chain *Chain, address, newOwner string) (*Recovery, error) {
+	if !common.IsHexAddress(newOwner) {
+		return nil, errors.New("invalid owner address")
+	}
+	account, err := findSmartAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	module, err := recoveryModule(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := recoveryNonce(chain, module, common.HexToAddress(account.Address))
+	if err != nil {
+		return nil, err
+	}
+
+	recovery := &Recovery{
+		ID:         newID(),
+		Account:    account.Address,
+		NewOwner:   common.HexToAddress(newOwner).Hex(),
+		ChainID:    chain.ID.Uint64(),
+		Module:     module.Hex(),
+		Nonce:      nonce.String(),
+		Status:     RecoveryCollecting,
+		Signatures: []GuardianSignature{},
+		CreatedAt:  time.Now().UTC(),
+	}
+	typedData := recovery.typedData()
+	hash, _, err := apitypes.TypedDataAndHash(*typedData)
+	if err != nil {
+		return nil, err
+	}
+	recovery.Hash = hexutil.Encode(hash)
+
+	recoveriesMu.Lock()
+	defer recoveriesMu.Unlock()
+
+	recoveries, err := readRecoveries()
+	if err != nil {
+		return nil, err
+	}
+	recoveries = append(recoveries, recovery)
+	if err := writeJSONFile(recoveriesFile, recoveries); err != nil {
+		return nil, err
+	}
+
+	recordAudit("recovery.started", fmt.Sprintf("recovery of %s to owner %s", recovery.Account, recovery.NewOwner),
+		map[string]interface{}{"recovery_id": recovery.ID, "account": recovery.Account, "new_owner": recovery.NewOwner, "chain_id": recovery.ChainID})
+
+	recovery.TypedData = typedData
+	return recovery, nil
+}
+
+// GetRecovery returns a recovery with the typed data guardians sign. A
+// submitted recovery is settled here once its transaction is mined, and the
+// smart account's owner is updated if it succeeded.
+func GetRecovery(address, id string) (*Recovery, error) {
+	recoveriesMu.Lock()
+	defer recoveriesMu.Unlock()
+
+	recoveries, err := readRecoveries()
+	if err != nil {
+		return nil, err
+	}
+	recovery, err := findRecovery(recoveries, address, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if recovery.Status == RecoverySubmitted {
+		settled, err := settleRecovery(recovery)
+		if err != nil {
+			return nil, err
+		}
+		if settled {
+			if err := writeJSONFile(recoveriesFile, recoveries); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	recovery.TypedData = recovery.typedData()
+	return recovery, nil
+}
+
+// AddRecoverySignature adds a guardian's signature over the recovery's
+// typed data. Without a signature the wallet signs, which it can only do
+// for a guardian that is one of its own accounts.
+func AddRecoverySignature(address, id, guardian, signature string) (*Recovery, error) {
+	if !common.IsHexAddress(guardian) {
+		return nil, errors.New("invalid guardian address")
+	}
+	signer := common.HexToAddress(guardian)
+
+	recoveriesMu.Lock()
+	defer recoveriesMu.Unlock()
+
+	recoveries, err := readRecoveries()
+	if err != nil {
+		return nil, err
+	}
+	recovery, err := findRecovery(recoveries, address, id)
+	if err != nil {
+		return nil, err
+	}
+	if recovery.Status != RecoveryCollecting {
+		return nil, ErrRecoveryNotCollecting
+	}
+
+	chain, err := chainByID(context.Background(), recovery.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	guardians, _, err := guardianSet(chain, common.HexToAddress(recovery.Module), common.HexToAddress(recovery.Account))
+	if err != nil {
+		return nil, err
+	}
+	if !containsAddress(guardians, signer) {
+		return nil, ErrNotGuardian
+	}
+
+	hash := common.FromHex(recovery.Hash)
+	var sig []byte
+	if signature == "" {
+		guardian, err := accountSigner(signer.Hex())
+		if err != nil {
+			return nil, err
+		}
+		if sig, err = guardian.SignHash(hash); err != nil {
+			return nil, err
+		}
+		sig[crypto.RecoveryIDOffset] += 27
+		recordSignature(signer)
+	} else {
+		if sig, err = hexutil.Decode(signature); err != nil || len(sig) != crypto.SignatureLength {
+			return nil, errors.New("invalid signature")
+		}
+		if recovered, err := recoverSigner(hash, sig); err != nil || recovered != signer {
+			return nil, fmt.Errorf("invalid signature: not signed by %s", signer.Hex())
+		}
+	}
+
+	recovery.Signatures = removeGuardianSignature(recovery.Signatures, signer)
+	recovery.Signatures = append(recovery.Signatures, GuardianSignature{
+		Guardian:  signer.Hex(),
+		Signature: hexutil.Encode(sig),
+		SignedAt:  time.Now().UTC(),
+	})
+	if err := writeJSONFile(recoveriesFile, recoveries); err != nil {
+		return nil, err
+	}
+
+	recordAudit("recovery.signed", fmt.Sprintf("guardian %s signed the recovery of %s", signer.Hex(), recovery.Account),
+		map[string]interface{}{"recovery_id": recovery.ID, "account": recovery.Account, "guardian": signer.Hex()})
+
+	recovery.TypedData = recovery.typedData()
+	return recovery, nil
+}
+
+// ExecuteRecovery submits a recovery with enough guardian signatures to the
+// module, from the selected account, which pays the gas. Signatures from
+// addresses no longer guardians are left out.
+func ExecuteRecovery(address, id string) (*Recovery, error) {
+	recoveriesMu.Lock()
+	defer recoveriesMu.Unlock()
+
+	recoveries, err := readRecoveries()
+	if err != nil {
+		return nil, err
+	}
+	recovery, err := findRecovery(recoveries, address, id)
+	if err != nil {
+		return nil, err
+	}
+	if recovery.Status != RecoveryCollecting {
+		return nil, ErrRecoveryNotCollecting
+	}
+
+	chain, err := chainByID(context.Background(), recovery.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	module := common.HexToAddress(recovery.Module)
+	account := common.HexToAddress(recovery.Account)
+
+	nonce, err := recoveryNonce(chain, module, account)
+	if err != nil {
+		return nil, err
+	}
+	if nonce.String() != recovery.Nonce {
+		return nil, ErrRecoveryStale
+	}
+	guardians, threshold, err := guardianSet(chain, module, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var valid []GuardianSignature
+	for _, signature := range recovery.Signatures {
+		if containsAddress(guardians, common.HexToAddress(signature.Guardian)) {
+			valid = append(valid, signature)
+		}
+	}
+	if threshold == 0 || uint64(len(valid)) < threshold {
+		return nil, fmt.Errorf("%w: %d of %d", ErrThresholdNotMet, len(valid), threshold)
+	}
+	sort.Slice(valid, func(i, j int) bool {
+		return bytes.Compare(common.HexToAddress(valid[i].Guardian).Bytes(), common.HexToAddress(valid[j].Guardian).Bytes()) < 0
+	})
+
+	signatures := make([][]byte, len(valid))
+	for i, signature := range valid {
+		signatures[i] = common.FromHex(signature.Signature)
+	}
+	data, err := recoveryModuleABI.Pack("executeRecovery", account, common.HexToAddress(recovery.NewOwner), signatures)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		return nil, err
+	}
+	txHash, err := sendContractTransaction(chain, signer, module, big.NewInt(0), data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	recovery.Status = RecoverySubmitted
+	recovery.TxHash = txHash
+	recovery.ExecutedAt = &now
+	if err := writeJSONFile(recoveriesFile, recoveries); err != nil {
+		return nil, err
+	}
+
+	recordAudit("recovery.executed", fmt.Sprintf("submitted the recovery of %s to owner %s", recovery.Account, recovery.NewOwner),
+		map[string]interface{}{"recovery_id": recovery.ID, "account": recovery.Account, "new_owner": recovery.NewOwner,
+			"guardians": len(valid), "tx_hash": txHash})
+
+	recovery.TypedData = recovery.typedData()
+	return recovery, nil
+}
+
+// settleRecovery checks a submitted recovery's transaction, reporting
+// whether it has been mined.
+func settleRecovery(recovery *Recovery) (bool, error) {
+	chain, err := chainByID(context.Background(), recovery.ChainID)
+	if err != nil {
+		return false, err
+	}
+
+	receipt, err := chain.client.TransactionReceipt(context.Background(), common.HexToHash(recovery.TxHash))
+	if errors.Is(err, ethereum.NotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		recovery.Status = RecoveryFailed
+		return true, nil
+	}
+
+	if err := setSmartAccountOwner(recovery.Account, recovery.NewOwner); err != nil {
+		return false, err
+	}
+	recovery.Status = RecoveryCompleted
+	recordAudit("recovery.completed", fmt.Sprintf("smart account %s is now owned by %s", recovery.Account, recovery.NewOwner),
+		map[string]interface{}{"recovery_id": recovery.ID, "account": recovery.Account, "new_owner": recovery.NewOwner})
+	return true, nil
+}
+
+func (r *Recovery) typedData() *apitypes.TypedData {
+	return &apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Recovery": {
+				{Name: "account", Type: "address"},
+				{Name: "newOwner", Type: "address"},
+				{Name: "nonce", Type: "uint256"},
+			},
+		},
+		PrimaryType: "Recovery",
+		Domain: apitypes.TypedDataDomain{
+			Name:              "SocialRecovery",
+			Version:           "1",
+			ChainId:           (*math.HexOrDecimal256)(new(big.Int).SetUint64(r.ChainID)),
+			VerifyingContract: r.Module,
+		},
+		Message: apitypes.TypedDataMessage{
+			"account":  r.Account,
+			"newOwner": r.NewOwner,
+			"nonce":    r.Nonce,
+		},
+	}
+}
+
+func recoveryModule(chain *Chain) (common.Address, error) {
+	raw := os.Getenv("SOCIAL_RECOVERY_MODULE")
+	if !common.IsHexAddress(raw) {
+		return common.Address{}, fmt.Errorf("%w: set SOCIAL_RECOVERY_MODULE", ErrRecoveryUnavailable)
+	}
+	module := common.HexToAddress(raw)
+
+	code, err := chain.client.CodeAt(context.Background(), module, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(code) == 0 {
+		return common.Address{}, fmt.Errorf("%w: no recovery module at %s on chain %s", ErrRecoveryUnavailable, module.Hex(), chain.ID)
+	}
+
+	return module, nil
+}
+
+func guardianSet(chain *Chain, module, account common.Address) ([]common.Address, uint64, error) {
+	out, err := callContract(chain, module, recoveryModuleABI, "getGuardians", account)
+	if err != nil {
+		return nil, 0, err
+	}
+	guardians := out[0].([]common.Address)
+
+	out, err = callContract(chain, module, recoveryModuleABI, "threshold", account)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return guardians, out[0].(*big.Int).Uint64(), nil
+}
+
+func recoveryNonce(chain *Chain, module, account common.Address) (*big.Int, error) {
+	out, err := callContract(chain, module, recoveryModuleABI, "recoveryNonce", account)
+	if err != nil {
+		return nil, err
+	}
+
+	return out[0].(*big.Int), nil
+}
+
+func recoverSigner(hash, signature []byte) (common.Address, error) {
+	sig := append([]byte{}, signature...)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	publicKey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+func removeGuardianSignature(signatures []GuardianSignature, guardian common.Address) []GuardianSignature {
+	kept := signatures[:0]
+	for _, signature := range signatures {
+		if common.HexToAddress(signature.Guardian) != guardian {
+			kept = append(kept, signature)
+		}
+	}
+
+	return kept
+}
+
+func containsAddress(addresses []common.Address, address common.Address) bool {
+	for _, candidate := range addresses {
+		if candidate == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+func findRecovery(recoveries []*Recovery, address, id string) (*Recovery, error) {
+	for _, recovery := range recoveries {
+		if recovery.ID == id && strings.EqualFold(recovery.Account, address) {
+			return recovery, nil
+		}
+	}
+
+	return nil, ErrRecoveryNotFound
+}
+
+func readRecoveries() ([]*Recovery, error) {
+	var recoveries []*Recovery
+	if err := readJSONFile(recoveriesFile, &recoveries); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return recoveries, nil
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// defaultFeeBumpPercent is also the least nodes accept: a replacement paying
+// less than 10% more than the transaction it replaces is refused as
+// underpriced.
+const defaultFeeBumpPercent = 10
+
+var ErrNotReplaceable = errors.New("transaction cannot be replaced")
+
+// feeBumpPercent is how much more a replacement pays, FEE_BUMP_PERCENT or
+// 10.
+func feeBumpPercent() int64 {
+	if raw := os.Getenv("FEE_BUMP_PERCENT"); raw != "" {
+		if percent, err := strconv.ParseInt(raw, 10, 64); err == nil && percent >= defaultFeeBumpPercent && percent <= 1000 {
+			return percent
+		}
+	}
+
+	return defaultFeeBumpPercent
+}
+
+// SpeedUpTransaction resends a pending transaction with the same nonce and
+// higher fees, returning the replacement's hash.
+func SpeedUpTransaction(hash string) (string, error) {
+	return replaceTransaction(hash, false)
+}
+
+// CancelTransaction replaces a pending transaction with an empty transfer
+// from the account to itself, with the same nonce and higher fees, so that
+// the original is never mined. It returns the replacement's hash.
+func CancelTransaction(hash string) (string, error) {
+	return replaceTransaction(hash, true)
+}
+
+// ReplacementValue is what replacing a transaction sends: the original's
+// value to speed it up, nothing to cancel it.
+func ReplacementValue(hash string, cancel bool) (*big.Int, error) {
+	historyMu.Lock()
+	record, err := history.get(hash)
+	historyMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrTransactionNotFound
+	}
+	if cancel {
+		return new(big.Int), nil
+	}
+
+	value, ok := new(big.Int).SetString(record.Value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid value %q recorded for %s", record.Value, record.Hash)
+	}
+	return value, nil
+}
+
+func replaceTransaction(hash string, cancel bool) (string, error) {
+	ctx := context.Background()
+
+	historyMu.Lock()
+	record, err := history.get(hash)
+	historyMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if record == nil {
+		return "", ErrTransactionNotFound
+	}
+	switch {
+	case record.ReplacedBy != "":
+		return "", fmt.Errorf("%w: already replaced by %s", ErrNotReplaceable, record.ReplacedBy)
+	case record.Status != StatusPending:
+		return "", fmt.Errorf("%w: it is %s", ErrNotReplaceable, record.Status)
+	}
+
+	original, err := journalledTransaction(record.Hash)
+	if err != nil {
+		return "", err
+	}
+	chain, err := chainByID(ctx, record.ChainID)
+	if err != nil {
+		return "", err
+	}
+	signer, err := accountSigner(record.From)
+	if err != nil {
+		return "", err
+	}
+	from := signer.Address()
+
+	to, value, gasLimit, data := *original.To(), original.Value(), original.Gas(), original.Data()
+	if cancel {
+		to, value, gasLimit, data = from, new(big.Int), transferGas, nil
+	}
+
+	build, maxGasPrice, err := bumpedFees(ctx, chain, original, to, value, gasLimit, data)
+	if err != nil {
+		return "", err
+	}
+	// A replacement is a send like any other, so it is held to the policy
+	// and counted the same way.
+	if err := enforcePolicy(ctx, chain, from, to, value); err != nil {
+		return "", err
+	}
+	if err := checkFunds(ctx, chain, from, value, gasLimit, maxGasPrice); err != nil {
+		return "", err
+	}
+
+	entry, err := reserveReplacement(ctx, chain, from, to, value, original.Nonce())
+	if err != nil {
+		return "", err
+	}
+	signedTx, status, err := signAndBroadcast(chain, signer, entry, build)
+	if err != nil {
+		return "", err
+	}
+
+	recordSend(from, value)
+	learnSpending(from, to, value)
+
+	txHash := signedTx.Hash().Hex()
+	err = recordTransaction(signedBy(TransactionRecord{
+		Hash:      txHash,
+		ChainID:   chain.ID.Uint64(),
+		From:      from.Hex(),
+		To:        to.Hex(),
+		Value:     value.String(),
+		Status:    status,
+		Replaces:  record.Hash,
+		CreatedAt: time.Now().UTC(),
+	}, signedTx))
+	if err != nil {
+		log.Printf("failed to record transaction %s: %v", txHash, err)
+	}
+	if err := markReplaced(record.Hash, txHash); err != nil {
+		log.Printf("failed to mark %s replaced by %s: %v", record.Hash, txHash, err)
+	}
+
+	return txHash, nil
+}
+
+// bumpedFees raises the original's fees by FEE_BUMP_PERCENT, or to what the
+// chain currently asks if that is more, keeping its type. It returns the
+// builder of the replacement and the most it pays per gas.
+func bumpedFees(ctx context.Context, chain *Chain, original *types.Transaction, to common.Address, value *big.Int, gasLimit uint64, data []byte) (func(nonce uint64) (types.TxData, error), *big.Int, error) {
+	if original.Type() == types.DynamicFeeTxType {
+		feeCap, tip, err := chain.dynamicFees(ctx, FeeOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		tip = maxBig(bump(original.GasTipCap()), tip)
+		feeCap = maxBig(bump(original.GasFeeCap()), feeCap)
+		if feeCap.Cmp(tip) < 0 {
+			feeCap = tip
+		}
+
+		return func(nonce uint64) (types.TxData, error) {
+			return &types.DynamicFeeTx{
+				ChainID:   chain.ID,
+				Nonce:     nonce,
+				GasTipCap: tip,
+				GasFeeCap: feeCap,
+				Gas:       gasLimit,
+				To:        &to,
+				Value:     value,
+				Data:      data,
+			}, nil
+		}, feeCap, nil
+	}
+
+	current, err := chain.currentGasPrice(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	gasPrice := maxBig(bump(original.GasPrice()), current)
+
+	return func(nonce uint64) (types.TxData, error) {
+		return &types.LegacyTx{Nonce: nonce, To: &to, Value: value, Gas: gasLimit, GasPrice: gasPrice, Data: data}, nil
+	}, gasPrice, nil
+}
+
+// bump raises a fee by FEE_BUMP_PERCENT, rounding up so that the node never
+// sees less than the minimum increase.
+func bump(fee *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(100+feeBumpPercent()))
+	bumped.Add(bumped, big.NewInt(99))
+	return bumped.Div(bumped, big.NewInt(100))
+}
+
+func maxBig(a, b *big.Int) *big.Int {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
+
+// journalledTransaction decodes a transaction this wallet signed from the
+// signing journal.
+func journalledTransaction(hash string) (*types.Transaction, error) {
+	journalMu.Lock()
+	entries, err := readJournal()
+	journalMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.RawTx == "" || !strings.EqualFold(entry.Hash, hash) {
+			continue
+		}
+		raw, err := hexutil.Decode(entry.RawTx)
+		if err != nil {
+			return nil, err
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(raw); err != nil {
+			return nil, err
+		}
+		if tx.To() == nil {
+			return nil, fmt.Errorf("%w: contract creations are not replaced", ErrNotReplaceable)
+		}
+		return tx, nil
+	}
+
+	return nil, fmt.Errorf("%w: it is no longer in the signing journal", ErrNotReplaceable)
+}
+
+func markReplaced(hash, replacement string) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	record, err := history.get(hash)
+	if err != nil || record == nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	record.ReplacedBy = replacement
+	record.UpdatedAt = &now
+	return history.update(*record)
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Datasets a retention policy can prune.
+const (
+	DatasetHistory           = "history"
+	DatasetAudit             = "audit"
+	DatasetWebhookDeliveries = "webhook_deliveries"
+)
+
+// RetentionPolicy bounds how much of each dataset is kept. Records pruned
+// are exported first, to ExportDir and/or ExportURL, and a dataset is left
+// untouched if its export fails, so nothing is deleted that was not handed
+// off. Records kept after a failed export are exported again next run.
+type RetentionPolicy struct {
+	History           RetentionRule `json:"history"`
+	Audit             RetentionRule `json:"audit"`
+	WebhookDeliveries RetentionRule `json:"webhook_deliveries"`
+
+	// ExportDir receives one JSON file per dataset and pruning run.
+	ExportDir string `json:"export_dir,omitempty"`
+
+	// ExportURL is sent each batch of pruned records as a JSON POST and
+	// must answer 2xx for the prune to go ahead.
+	ExportURL string `json:"export_url,omitempty"`
+}
+
+// RetentionRule prunes records older than MaxAge (a Go duration such as
+// "2160h") and the oldest beyond the newest MaxRecords. An empty rule keeps
+// everything. Transactions still queued or pending and webhook deliveries not
+// yet attempted are never pruned, and do not count towards MaxRecords.
+type RetentionRule struct {
+	MaxAge     string `json:"max_age,omitempty"`
+	MaxRecords int    `json:"max_records,omitempty"`
+}
+
+// PruneReport is the outcome of one pruning run.
+type PruneReport struct {
+	StartedAt time.Time      `json:"started_at"`
+	Datasets  []DatasetPrune `json:"datasets"`
+}
+
+type DatasetPrune struct {
+	Dataset string `json:"dataset"`
+	Pruned  int    `json:"pruned"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PruneExport is what an export hook receives.
+type PruneExport struct {
+	Dataset  string      `json:"dataset"`
+	PrunedAt time.Time   `json:"pruned_at"`
+	Records  interface{} `json:"records"`
+}
+
+var (
+	retentionFile = "retention.json"
+	retentionMu   sync.Mutex
+
+	// pruneMu keeps scheduled and requested runs from overlapping.
+	pruneMu   sync.Mutex
+	lastPrune *PruneReport
+
+	pruneInterval = time.Hour
+	exportClient  = &http.Client{Timeout: 30 * time.Second}
+)
+
+var ErrInvalidRetention = errors.New("invalid retention policy")
+
+func GetRetentionPolicy() (*RetentionPolicy, error) {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+
+	return readRetention()
+}
+
+func SetRetentionPolicy(policy RetentionPolicy) (*RetentionPolicy, error) {
+	rules := map[string]RetentionRule{
+		DatasetHistory:           policy.History,
+		DatasetAudit:             policy.Audit,
+		DatasetWebhookDeliveries: policy.WebhookDeliveries,
+	}
+	for dataset, rule := range rules {
+		if rule.MaxAge != "" {
+			if age, err := time.ParseDuration(rule.MaxAge); err != nil || age <= 0 {
+				return nil, fmt.Errorf("%w: %s max_age %q is not a positive duration", ErrInvalidRetention, dataset, rule.MaxAge)
+			}
+		}
+		if rule.MaxRecords < 0 {
+			return nil, fmt.Errorf("%w: %s max_records must not be negative", ErrInvalidRetention, dataset)
+		}
+	}
+
+	if policy.ExportURL != "" {
+		parsed, err := url.Parse(policy.ExportURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("%w: export_url must be an http or https URL", ErrInvalidRetention)
+		}
+	}
+
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+
+	if err := writeJSONFile(retentionFile, policy); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// LastPrune returns the most recent pruning run, or nil before the first.
+func LastPrune() *PruneReport {
+	pruneMu.Lock()
+	defer pruneMu.Unlock()
+
+	return lastPrune
+}
+
+// StartPruner applies the retention policy every PRUNE_INTERVAL (default one
+// hour). PRUNE_INTERVAL=off leaves pruning to a prune job.
+func StartPruner() {
+	raw := os.Getenv("PRUNE_INTERVAL")
+	if raw == "off" {
+		return
+	}
+	if raw != "" {
+		if interval, err := time.ParseDuration(raw); err == nil && interval > 0 {
+			pruneInterval = interval
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := PruneNow(); err != nil {
+				log.Printf("pruner: %v", err)
+			}
+		}
+	}()
+}
+
+// PruneNow applies the retention policy to every dataset. A dataset whose
+// export or write fails is reported and left as it was; the others are still
+// pruned.
+func PruneNow() (*PruneReport, error) {
+	policy, err := GetRetentionPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	pruneMu.Lock()
+	defer pruneMu.Unlock()
+
+	report := &PruneReport{StartedAt: time.Now().UTC()}
+	datasets := []struct {
+		name  string
+		rule  RetentionRule
+		prune func(string, RetentionRule, *RetentionPolicy) (int, error)
+	}{
+		{DatasetHistory, policy.History, historyRetention.prune},
+		{DatasetAudit, policy.Audit, auditRetention.prune},
+		{DatasetWebhookDeliveries, policy.WebhookDeliveries, deliveriesRetention.prune},
+	}
+
+	for _, dataset := range datasets {
+		if dataset.rule.MaxAge == "" && dataset.rule.MaxRecords == 0 {
+			continue
+		}
+
+		pruned, err := dataset.prune(dataset.name, dataset.rule, policy)
+		result := DatasetPrune{Dataset: dataset.name, Pruned: pruned}
+		if err != nil {
+			result.Error = err.Error()
+			recordAudit("retention.prune_failed", fmt.Sprintf("%s was not pruned: %v", dataset.name, err),
+				map[string]interface{}{"dataset": dataset.name})
+		} else if pruned > 0 {
+			recordAudit("retention.pruned", fmt.Sprintf("pruned %d %s records", pruned, dataset.name),
+				map[string]interface{}{"dataset": dataset.name, "pruned": pruned})
+		}
+		report.Datasets = append(report.Datasets, result)
+	}
+
+	if report.Datasets == nil {
+		report.Datasets = []DatasetPrune{}
+	}
+	lastPrune = report
+	return report, nil
+}
+
+// retentionStore describes a dataset to the pruner. Datasets that are not
+// rewritten whole set remove, which deletes records by key, in place of
+// write.
+type retentionStore[T any] struct {
+	mu        *sync.Mutex
+	read      func() ([]T, error)
+	write     func([]T) error
+	remove    func(keys []string) (int, error)
+	key       func(T) string
+	createdAt func(T) time.Time
+	// retained reports records that are never pruned.
+	retained func(T) bool
+}
+
+var (
+	historyRetention = retentionStore[TransactionRecord]{
+		mu:        &historyMu,
+		read:      readHistory,
+		remove:    func(hashes []string) (int, error) { return history.remove(hashes) },
+		key:       func(r TransactionRecord) string { return r.Hash },
+		createdAt: func(r TransactionRecord) time.Time { return r.CreatedAt },
+		retained: func(r TransactionRecord) bool {
+			return r.Status == StatusQueued || r.Status == StatusPending
+		},
+	}
+
+	auditRetention = retentionStore[AuditEvent]{
+		mu:   &auditMu,
+		read: readAudit,
+		write: func(events []AuditEvent) error {
+			return writeJSONFile(auditFile, events)
+		},
+		key:       func(e AuditEvent) string { return e.ID },
+		createdAt: func(e AuditEvent) time.Time { return e.CreatedAt },
+		retained:  func(e AuditEvent) bool { return !auditExported(e) },
+	}
+
+	deliveriesRetention = retentionStore[*WebhookDelivery]{
+		mu:   &deliveriesMu,
+		read: readDeliveries,
+		write: func(deliveries []*WebhookDelivery) error {
+			return writeJSONFile(deliveriesFile, deliveries)
+		},
+		key:       func(d *WebhookDelivery) string { return d.ID },
+		createdAt: func(d *WebhookDelivery) time.Time { return d.CreatedAt },
+		retained:  func(d *WebhookDelivery) bool { return d.Status == DeliveryPending },
+	}
+)
+
+// prune exports the records the rule expires and then removes them. The
+// store lock is not held during the export, so records are removed by key
+// from a fresh read rather than by writing back the snapshot.
+func (s retentionStore[T]) prune(dataset string, rule RetentionRule, policy *RetentionPolicy) (int, error) {
+	s.mu.Lock()
+	records, err := s.read()
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	expired := s.expired(records, rule, time.Now())
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	if err := exportPruned(policy, dataset, expired); err != nil {
+		return 0, fmt.Errorf("export failed: %w", err)
+	}
+
+	drop := make(map[string]bool, len(expired))
+	keys := make([]string, 0, len(expired))
+	for _, record := range expired {
+		drop[s.key(record)] = true
+		keys = append(keys, s.key(record))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.remove != nil {
+		return s.remove(keys)
+	}
+
+	if records, err = s.read(); err != nil {
+		return 0, err
+	}
+
+	kept := make([]T, 0, len(records))
+	for _, record := range records {
+		if !drop[s.key(record)] {
+			kept = append(kept, record)
+		}
+	}
+
+	return len(records) - len(kept), s.write(kept)
+}
+
+func (s retentionStore[T]) expired(records []T, rule RetentionRule, now time.Time) []T {
+	var candidates []T
+	for _, record := range records {
+		if !s.retained(record) {
+			candidates = append(candidates, record)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return s.createdAt(candidates[i]).Before(s.createdAt(candidates[j]))
+	})
+
+	excess := 0
+	if rule.MaxRecords > 0 && len(candidates) > rule.MaxRecords {
+		excess = len(candidates) - rule.MaxRecords
+	}
+
+	var cutoff time.Time
+	if age, err := time.ParseDuration(rule.MaxAge); err == nil {
+		cutoff = now.Add(-age)
+	}
+
+	var expired []T
+	for i, record := range candidates {
+		if i < excess || s.createdAt(record).Before(cutoff) {
+			expired = append(expired, record)
+		}
+	}
+
+	return expired
+}
+
+// exportPruned hands records about to be pruned to the configured export
+// hooks. With neither configured the records are simply dropped.
+func exportPruned(policy *RetentionPolicy, dataset string, records interface{}) error {
+	export := PruneExport{
+		Dataset:  dataset,
+		PrunedAt: time.Now().UTC(),
+		Records:  records,
+	}
+
+	if policy.ExportDir != "" {
+		name := fmt.Sprintf("%s-%s.json", dataset, export.PrunedAt.Format("20060102T150405.000000000Z"))
+		if err := writeJSONFile(filepath.Join(policy.ExportDir, name), export); err != nil {
+			return err
+		}
+	}
+
+	if policy.ExportURL != "" {
+		body, err := json.Marshal(export)
+		if err != nil {
+			return err
+		}
+
+		resp, err := exportClient.Post(policy.ExportURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("export hook responded %s", resp.Status)
+		}
+	}
+
+	return nil
+}
+
+func readRetention() (*RetentionPolicy, error) {
+	policy := &RetentionPolicy{}
+	if err := readJSONFile(retentionFile, policy); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return policy, nil
+}
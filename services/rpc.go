@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+)
+
+// RPCEndpoint describes how to reach one node. Private node providers often
+// require bearer tokens, basic auth or custom headers, and enterprise setups
+// may need to go through a proxy. ChainID may be given to skip asking the
+// node for it. Network names a well-known network to fill in the name, URL and
+// chain ID from. ShortName is the chain's EIP-3770 address prefix, needed
+// only for chains that are not well-known networks.
+type RPCEndpoint struct {
+	Name        string            `json:"name"`
+	Network     string            `json:"network,omitempty"`
+	URL         string            `json:"url"`
+	ChainID     uint64            `json:"chain_id,omitempty"`
+	ShortName   string            `json:"short_name,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	BearerToken string            `json:"bearer_token,omitempty"`
+	BasicAuth   *BasicAuth        `json:"basic_auth,omitempty"`
+	Proxy       string            `json:"proxy,omitempty"`
+}
+
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// loadRPCEndpoints reads endpoints from the JSON file named by RPC_CONFIG.
+// Without one, the default endpoint is RPC_URL with the RPC_* auth variables,
+// followed by the well-known networks listed in NETWORKS (comma-separated).
+// If neither RPC_URL nor NETWORKS is set, the default is Ethereum mainnet.
+func loadRPCEndpoints(s settings) ([]RPCEndpoint, error) {
+	if path := os.Getenv("RPC_CONFIG"); path != "" {
+		var endpoints []RPCEndpoint
+		if err := readJSONFile(path, &endpoints); err != nil {
+			return nil, fmt.Errorf("failed to read RPC config: %w", err)
+		}
+		if len(endpoints) == 0 {
+			return nil, errors.New("RPC config has no endpoints")
+		}
+		for i := range endpoints {
+			if err := endpoints[i].applyNetwork(s); err != nil {
+				return nil, err
+			}
+		}
+		return endpoints, nil
+	}
+
+	var endpoints []RPCEndpoint
+	networks := strings.TrimSpace(s.get("NETWORKS"))
+	if s.get("RPC_URL") != "" || networks == "" {
+		endpoint, err := envRPCEndpoint(s)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if networks != "" {
+		for _, name := range strings.Split(networks, ",") {
+			endpoint := RPCEndpoint{Network: strings.TrimSpace(name)}
+			if err := endpoint.applyNetwork(s); err != nil {
+				return nil, fmt.Errorf("NETWORKS: %w", err)
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	return endpoints, nil
+}
+
+// envRPCEndpoint builds the endpoint for RPC_URL, or mainnet, from the RPC_*
+// variables.
+func envRPCEndpoint(s settings) (RPCEndpoint, error) {
+	endpoint := RPCEndpoint{
+		Name:        "default",
+		URL:         s.get("RPC_URL"),
+		BearerToken: s.get("RPC_BEARER_TOKEN"),
+		Proxy:       s.get("RPC_PROXY"),
+	}
+	if endpoint.URL == "" {
+		endpoint.Name, endpoint.Network = "", "mainnet"
+		if err := endpoint.applyNetwork(s); err != nil {
+			return RPCEndpoint{}, err
+		}
+	}
+
+	if auth := s.get("RPC_BASIC_AUTH"); auth != "" {
+		username, password, ok := strings.Cut(auth, ":")
+		if !ok {
+			return RPCEndpoint{}, errors.New("RPC_BASIC_AUTH must be username:password")
+		}
+		endpoint.BasicAuth = &BasicAuth{Username: username, Password: password}
+	}
+
+	// RPC_HEADERS is a semicolon-separated list of "Name: value" pairs.
+	if raw := s.get("RPC_HEADERS"); raw != "" {
+		endpoint.Headers = map[string]string{}
+		for _, pair := range strings.Split(raw, ";") {
+			name, value, ok := strings.Cut(pair, ":")
+			if !ok {
+				return RPCEndpoint{}, fmt.Errorf("invalid RPC_HEADERS entry %q", pair)
+			}
+			endpoint.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+
+	return endpoint, nil
+}
+
+func dialRPC(ctx context.Context, endpoint RPCEndpoint) (*ethclient.Client, error) {
+	headers := http.Header{}
+	for name, value := range endpoint.Headers {
+		headers.Set(name, value)
+	}
+	if endpoint.BearerToken != "" {
+		headers.Set("Authorization", "Bearer "+endpoint.BearerToken)
+	}
+	if endpoint.BasicAuth != nil {
+		credentials := endpoint.BasicAuth.Username + ":" + endpoint.BasicAuth.Password
+		headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if endpoint.Proxy != "" {
+		proxyURL, err := url.Parse(endpoint.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy for RPC endpoint %s: %w", endpoint.Name, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+
+	breaker := &breakerTransport{next: transport, breaker: newCircuitBreaker(endpointName(endpoint))}
+
+	options := []rpc.ClientOption{
+		rpc.WithHeaders(headers),
+		rpc.WithHTTPClient(&http.Client{Transport: breaker, Timeout: 30 * time.Second}),
+		rpc.WithWebsocketDialer(websocket.Dialer{Proxy: proxy, HandshakeTimeout: 30 * time.Second}),
+	}
+
+	client, err := rpc.DialOptions(ctx, endpoint.URL, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ethclient.NewClient(client), nil
+}
+
+// endpointHost names an endpoint without leaking credentials embedded in its
+// URL (such as an Infura project ID in the path).
+func endpointHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return "rpc"
+	}
+
+	return parsed.Host
+}
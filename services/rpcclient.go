@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultRPCCacheTTL = 2 * time.Second
+	rpcReadTimeout     = 15 * time.Second
+
+	// maxStaleness bounds how old a cached read may be when it is served in
+	// place of a live one because the endpoint's circuit breaker is open.
+	maxStaleness = 5 * time.Minute
+)
+
+// rpcClient wraps ethclient.Client so identical concurrent reads collapse into
+// one request and their results are reused for a short TTL. Writes and nonce
+// lookups are never cached and pass straight through to the embedded client;
+// pending balances are never cached either.
+// While the endpoint's circuit breaker is open, reads fall back to the last
+// cached value if it is recent enough.
+type rpcClient struct {
+	*ethclient.Client
+
+	ttl   time.Duration
+	group singleflight.Group
+
+	mu    sync.Mutex
+	cache map[string]cachedRead
+}
+
+type cachedRead struct {
+	value   interface{}
+	fetched time.Time
+}
+
+func newRPCClient(client *ethclient.Client) *rpcClient {
+	ttl := defaultRPCCacheTTL
+	if raw := os.Getenv("RPC_CACHE_TTL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil {
+			ttl = parsed
+		}
+	}
+
+	return &rpcClient{Client: client, ttl: ttl, cache: map[string]cachedRead{}}
+}
+
+func (c *rpcClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return readAs[*big.Int](c, ctx, "eth_gasPrice", func(ctx context.Context) (interface{}, error) {
+		return c.Client.SuggestGasPrice(ctx)
+	})
+}
+
+func (c *rpcClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return readAs[*big.Int](c, ctx, "eth_maxPriorityFeePerGas", func(ctx context.Context) (interface{}, error) {
+		return c.Client.SuggestGasTipCap(ctx)
+	})
+}
+
+func (c *rpcClient) NetworkID(ctx context.Context) (*big.Int, error) {
+	return readAs[*big.Int](c, ctx, "net_version", func(ctx context.Context) (interface{}, error) {
+		return c.Client.NetworkID(ctx)
+	})
+}
+
+func (c *rpcClient) ChainID(ctx context.Context) (*big.Int, error) {
+	return readAs[*big.Int](c, ctx, "eth_chainId", func(ctx context.Context) (interface{}, error) {
+		return c.Client.ChainID(ctx)
+	})
+}
+
+func (c *rpcClient) BlockNumber(ctx context.Context) (uint64, error) {
+	return readAs[uint64](c, ctx, "eth_blockNumber", func(ctx context.Context) (interface{}, error) {
+		return c.Client.BlockNumber(ctx)
+	})
+}
+
+func (c *rpcClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return readAs[*types.Header](c, ctx, "eth_getHeaderByNumber:"+blockKey(number), func(ctx context.Context) (interface{}, error) {
+		return c.Client.HeaderByNumber(ctx, number)
+	})
+}
+
+func (c *rpcClient) BalanceAt(ctx context.Context, account common.Address, number *big.Int) (*big.Int, error) {
+	return readAs[*big.Int](c, ctx, "eth_getBalance:"+account.Hex()+":"+blockKey(number), func(ctx context.Context) (interface{}, error) {
+		return c.Client.BalanceAt(ctx, account, number)
+	})
+}
+
+// PendingBalanceAt reads the balance live every time, since it moves with
+// the mempool. While the circuit breaker is open it falls back to the last
+// one read, like the cached reads do.
+func (c *rpcClient) PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	key := "eth_getBalance:" + account.Hex() + ":pending"
+
+	balance, err := c.Client.PendingBalanceAt(ctx, account)
+	if err != nil {
+		if errors.Is(err, ErrCircuitOpen) {
+			if value, ok := c.lookupStale(key); ok {
+				return value.(*big.Int), nil
+			}
+		}
+		return nil, err
+	}
+
+	c.store(key, balance)
+	return balance, nil
+}
+
+func (c *rpcClient) CodeAt(ctx context.Context, account common.Address, number *big.Int) ([]byte, error) {
+	return readAs[[]byte](c, ctx, "eth_getCode:"+account.Hex()+":"+blockKey(number), func(ctx context.Context) (interface{}, error) {
+		return c.Client.CodeAt(ctx, account, number)
+	})
+}
+
+func (c *rpcClient) CallContract(ctx context.Context, msg ethereum.CallMsg, number *big.Int) ([]byte, error) {
+	if msg.To == nil {
+		return c.Client.CallContract(ctx, msg, number)
+	}
+
+	key := fmt.Sprintf("eth_call:%s:%s:%s:%s:%s", msg.From.Hex(), msg.To.Hex(), hexutil.Encode(msg.Data), bigKey(msg.Value), blockKey(number))
+	return readAs[[]byte](c, ctx, key, func(ctx context.Context) (interface{}, error) {
+		return c.Client.CallContract(ctx, msg, number)
+	})
+}
+
+func (c *rpcClient) read(ctx context.Context, key string, fetch func(context.Context) (interface{}, error)) (interface{}, error) {
+	if value, ok := c.lookup(key); ok {
+		return value, nil
+	}
+
+	// The shared fetch must not be cancelled by whichever caller happened to
+	// start it, so it runs on a detached context with its own timeout.
+	result := c.group.DoChan(key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rpcReadTimeout)
+		defer cancel()
+
+		value, err := fetch(fetchCtx)
+		if err == nil {
+			c.store(key, value)
+		}
+		return value, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if errors.Is(res.Err, ErrCircuitOpen) {
+			if value, ok := c.lookupStale(key); ok {
+				return value, nil
+			}
+		}
+		return res.Val, res.Err
+	}
+}
+
+func (c *rpcClient) lookup(key string) (interface{}, bool) {
+	return c.lookupWithin(key, c.ttl)
+}
+
+func (c *rpcClient) lookupStale(key string) (interface{}, bool) {
+	return c.lookupWithin(key, maxStaleness)
+}
+
+func (c *rpcClient) lookupWithin(key string, age time.Duration) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.cache[key]
+	if !ok || time.Since(entry.fetched) > age {
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+func (c *rpcClient) store(key string, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.cache {
+		if now.Sub(entry.fetched) > maxStaleness {
+			delete(c.cache, k)
+		}
+	}
+	c.cache[key] = cachedRead{value: value, fetched: now}
+}
+
+func readAs[T any](c *rpcClient, ctx context.Context, key string, fetch func(context.Context) (interface{}, error)) (T, error) {
+	var zero T
+
+	value, err := c.read(ctx, key, fetch)
+	if err != nil {
+		return zero, err
+	}
+
+	typed, ok := value.(T)
+	if !ok {
+		return zero, fmt.Errorf("unexpected cached type for %s", key)
+	}
+
+	return typed, nil
+}
+
+func blockKey(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+
+	return number.String()
+}
+
+func bigKey(value *big.Int) string {
+	if value == nil {
+		return "0"
+	}
+
+	return value.String()
+}
@@ -0,0 +1,1029 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Safe multisig transactions are coordinated through a Safe Transaction
+// Service, the same one the official Safe UI uses, configured by
+// SAFE_TRANSACTION_SERVICE_URL. A service serves one chain. Transactions are
+// kept locally too: ones pulled from the service, so that they can be shown
+// and confirmed, and ones proposed here, until the service has accepted them.
+// The service is not trusted for what a transaction does: its hash is always
+// recomputed by the Safe contract before an owner signs it.
+
+const safeABIJSON = `[
+	{"type":"function","name":"getOwners","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address[]"}]},
+	{"type":"function","name":"getThreshold","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"nonce","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"getTransactionHash","stateMutability":"view","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"operation","type":"uint8"},{"name":"safeTxGas","type":"uint256"},{"name":"baseGas","type":"uint256"},{"name":"gasPrice","type":"uint256"},{"name":"gasToken","type":"address"},{"name":"refundReceiver","type":"address"},{"name":"_nonce","type":"uint256"}],"outputs":[{"name":"","type":"bytes32"}]},
+	{"type":"function","name":"execTransaction","stateMutability":"payable","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"operation","type":"uint8"},{"name":"safeTxGas","type":"uint256"},{"name":"baseGas","type":"uint256"},{"name":"gasPrice","type":"uint256"},{"name":"gasToken","type":"address"},{"name":"refundReceiver","type":"address"},{"name":"signatures","type":"bytes"}],"outputs":[{"name":"success","type":"bool"}]}
+]`
+
+var safeABI = mustParseABI(safeABIJSON)
+
+// Status of a Safe transaction known locally.
+const (
+	SafeTxPending = "pending"
+	// SafeTxClosed is a transaction whose nonce the Safe has used, whether
+	// by executing it or another transaction with the same nonce.
+	SafeTxClosed = "closed"
+)
+
+// safeOperationCall is a Safe transaction's operation for a plain call, as
+// opposed to a delegate call.
+const safeOperationCall = 0
+
+var (
+	ErrSafeServiceUnavailable = errors.New("Safe Transaction Service is not configured; set SAFE_TRANSACTION_SERVICE_URL")
+	ErrSafeTxNotFound         = errors.New("Safe transaction not found")
+	ErrNotSafeOwner           = errors.New("no wallet account is an owner of the Safe")
+	ErrSafeTxHashMismatch     = errors.New("Safe transaction hash does not match its fields")
+	ErrSafeTxClosed           = errors.New("the Safe has already used this transaction's nonce")
+	ErrAlreadyConfirmed       = errors.New("owner has already confirmed this transaction")
+)
+
+var (
+	safeTransactionsFile = "safe_transactions.json"
+	safeTransactionsMu   sync.Mutex
+
+	safeServiceClient = &http.Client{Timeout: 15 * time.Second}
+)
+
+// SafeInfo is a Safe with the wallet's accounts among its owners, as read
+// from the chain.
+type SafeInfo struct {
+	Address      string   `json:"address"`
+	ChainID      uint64   `json:"chain_id"`
+	Owners       []string `json:"owners"`
+	Threshold    uint64   `json:"threshold"`
+	Nonce        uint64   `json:"nonce"`
+	WalletOwners []string `json:"wallet_owners"`
+}
+
+// SafeTransaction is a multisig transaction of a Safe with the signatures
+// collected for it so far.
+type SafeTransaction struct {
+	SafeTxHash     string             `json:"safe_tx_hash"`
+	Safe           string             `json:"safe"`
+	ChainID        uint64             `json:"chain_id"`
+	To             string             `json:"to"`
+	Value          string             `json:"value"`
+	Data           string             `json:"data,omitempty"`
+	Operation      uint8              `json:"operation"`
+	SafeTxGas      string             `json:"safe_tx_gas"`
+	BaseGas        string             `json:"base_gas"`
+	GasPrice       string             `json:"gas_price"`
+	GasToken       string             `json:"gas_token"`
+	RefundReceiver string             `json:"refund_receiver"`
+	Nonce          uint64             `json:"nonce"`
+	Confirmations  []SafeConfirmation `json:"confirmations"`
+	Threshold      uint64             `json:"threshold,omitempty"`
+	Status         string             `json:"status"`
+
+	// ExecutionTxHash is the transaction that executed it from this wallet,
+	// once sent; Status stays pending until a sync sees the nonce used.
+	ExecutionTxHash string `json:"execution_tx_hash,omitempty"`
+
+	// Proposed is set for transactions proposed from this wallet, and
+	// Pushed once the service has accepted them.
+	Proposed  bool      `json:"proposed,omitempty"`
+	Pushed    bool      `json:"pushed"`
+	PushError string    `json:"push_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SafeConfirmation struct {
+	Owner     string `json:"owner"`
+	Signature string `json:"signature"`
+	// Pushed is false for a confirmation made here that the service has
+	// not accepted yet.
+	Pushed bool `json:"pushed"`
+}
+
+// SafeProposal is a call for a Safe to make. Nonce defaults to the next one
+// after the Safe's queued transactions, and Owner, the account that signs
+// the proposal, to the selected account or else the first wallet account
+// owning the Safe.
+type SafeProposal struct {
+	To    string
+	Value *big.Int
+	Data  []byte
+	Nonce *uint64
+	Owner string
+}
+
+// ListSafes returns the Safes the service reports any wallet account as an
+// owner of, each checked against the chain.
+func ListSafes(chain *Chain) ([]SafeInfo, error) {
+	accounts, _, err := ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[common.Address]bool{}
+	safes := []SafeInfo{}
+	for _, account := range accounts {
+		var owned struct {
+			Safes []string `json:"safes"`
+		}
+		if err := safeService(http.MethodGet, "/api/v1/owners/"+common.HexToAddress(account.Address).Hex()+"/safes/", nil, &owned); err != nil {
+			return nil, err
+		}
+
+		for _, raw := range owned.Safes {
+			if !common.IsHexAddress(raw) || seen[common.HexToAddress(raw)] {
+				continue
+			}
+			seen[common.HexToAddress(raw)] = true
+
+			info, err := GetSafe(chain, raw)
+			if errors.Is(err, ErrNotSafeOwner) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			safes = append(safes, *info)
+		}
+	}
+
+	return safes, nil
+}
+
+// GetSafe reads a Safe's owners, threshold and nonce from the chain. It
+// fails with ErrNotSafeOwner if no wallet account owns the Safe.
+func GetSafe(chain *Chain, address string) (*SafeInfo, error) {
+	if !common.IsHexAddress(address) {
+		return nil, errors.New("invalid Safe address")
+	}
+	safe := common.HexToAddress(address)
+
+	owners, threshold, nonce, err := safeState(chain, safe)
+	if err != nil {
+		return nil, err
+	}
+	walletOwners, err := walletSafeOwners(owners)
+	if err != nil {
+		return nil, err
+	}
+	if len(walletOwners) == 0 {
+		return nil, ErrNotSafeOwner
+	}
+
+	info := &SafeInfo{Address: safe.Hex(), ChainID: chain.ID.Uint64(), Threshold: threshold, Nonce: nonce}
+	for _, owner := range owners {
+		info.Owners = append(info.Owners, owner.Hex())
+	}
+	for _, owner := range walletOwners {
+		info.WalletOwners = append(info.WalletOwners, owner.Hex())
+	}
+
+	return info, nil
+}
+
+// ListSafeTransactions returns the transactions known locally for a Safe,
+// pending ones first, by nonce.
+func ListSafeTransactions(chain *Chain, address string) ([]*SafeTransaction, error) {
+	if !common.IsHexAddress(address) {
+		return nil, errors.New("invalid Safe address")
+	}
+	safe := common.HexToAddress(address).Hex()
+
+	safeTransactionsMu.Lock()
+	transactions, err := readSafeTransactions()
+	safeTransactionsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	list := []*SafeTransaction{}
+	for _, tx := range transactions {
+		if tx.Safe == safe && tx.ChainID == chain.ID.Uint64() {
+			list = append(list, tx)
+		}
+	}
+	sortSafeTransactions(list)
+
+	return list, nil
+}
+
+// SyncSafeTransactions pushes the Safe's transactions and confirmations
+// made here that the service has not accepted yet, then pulls the Safe's
+// pending transactions from it. Transactions whose nonce the Safe has used
+// are closed.
+func SyncSafeTransactions(chain *Chain, address string) ([]*SafeTransaction, error) {
+	if _, err := safeServiceURL(); err != nil {
+		return nil, err
+	}
+	info, err := GetSafe(chain, address)
+	if err != nil {
+		return nil, err
+	}
+	safe := common.HexToAddress(info.Address)
+
+	safeTransactionsMu.Lock()
+	defer safeTransactionsMu.Unlock()
+
+	transactions, err := readSafeTransactions()
+	if err != nil {
+		return nil, err
+	}
+
+	byHash := map[string]*SafeTransaction{}
+	for _, tx := range transactions {
+		if tx.Safe != safe.Hex() || tx.ChainID != info.ChainID {
+			continue
+		}
+		byHash[tx.SafeTxHash] = tx
+		if tx.Status == SafeTxPending && tx.Nonce < info.Nonce {
+			tx.Status = SafeTxClosed
+			tx.UpdatedAt = time.Now().UTC()
+		}
+		if tx.Status == SafeTxPending {
+			pushSafeTransaction(tx)
+		}
+	}
+
+	var page struct {
+		Results []safeServiceTransaction `json:"results"`
+	}
+	path := fmt.Sprintf("/api/v1/safes/%s/multisig-transactions/?executed=false&nonce__gte=%d&limit=100", safe.Hex(), info.Nonce)
+	if err := safeService(http.MethodGet, path, nil, &page); err != nil {
+		// Keep what was pushed, so it is not proposed again.
+		if writeErr := writeJSONFile(safeTransactionsFile, transactions); writeErr != nil {
+			return nil, writeErr
+		}
+		return nil, err
+	}
+
+	pulled, rejected := 0, 0
+	for _, remote := range page.Results {
+		tx, err := remote.transaction(info)
+		if err != nil {
+			return nil, err
+		}
+
+		// A transaction is taken from the service only if the hash worked
+		// out here, and confirmed by the Safe, is the one the service reports.
+		hash, err := safeTxHash(chain, tx)
+		if errors.Is(err, ErrSafeTxHashMismatch) {
+			rejected++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hash.Hex() != tx.SafeTxHash {
+			rejected++
+			continue
+		}
+
+		local, ok := byHash[tx.SafeTxHash]
+		if !ok {
+			transactions = append(transactions, tx)
+			byHash[tx.SafeTxHash] = tx
+			pulled++
+			continue
+		}
+		local.Pushed = true
+		local.PushError = ""
+		local.Threshold = info.Threshold
+		for _, confirmation := range tx.Confirmations {
+			local.addConfirmation(confirmation)
+		}
+		local.UpdatedAt = time.Now().UTC()
+	}
+
+	if err := writeJSONFile(safeTransactionsFile, transactions); err != nil {
+		return nil, err
+	}
+
+	recordAudit("safe.synced", fmt.Sprintf("synchronized Safe %s with the transaction service", safe.Hex()),
+		map[string]interface{}{"safe": safe.Hex(), "chain_id": info.ChainID, "fetched": len(page.Results), "new": pulled, "rejected": rejected})
+
+	list := []*SafeTransaction{}
+	for _, tx := range byHash {
+		list = append(list, tx)
+	}
+	sortSafeTransactions(list)
+
+	return list, nil
+}
+
+// ProposeSafeTransaction signs a call for a Safe with one of its owners and
+// pushes it to the service, for its co-signers to see and confirm. If the
+// service cannot be reached, the proposal is kept and pushed on the next
+// sync. Delegate calls, which run another contract's code as the Safe, are
+// refused.
+func ProposeSafeTransaction(chain *Chain, address string, proposal SafeProposal) (*SafeTransaction, error) {
+	info, err := GetSafe(chain, address)
+	if err != nil {
+		return nil, err
+	}
+	if !common.IsHexAddress(proposal.To) {
+		return nil, errors.New("invalid recipient address")
+	}
+	value := proposal.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	owner, err := safeSigner(info, proposal.Owner, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	safeTransactionsMu.Lock()
+	defer safeTransactionsMu.Unlock()
+
+	transactions, err := readSafeTransactions()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := info.Nonce
+	if proposal.Nonce != nil {
+		if *proposal.Nonce < info.Nonce {
+			return nil, ErrSafeTxClosed
+		}
+		nonce = *proposal.Nonce
+	} else {
+		for _, tx := range transactions {
+			if tx.Safe == info.Address && tx.ChainID == info.ChainID && tx.Status == SafeTxPending && tx.Nonce >= nonce {
+				nonce = tx.Nonce + 1
+			}
+		}
+	}
+
+	zero := common.Address{}.Hex()
+	tx := &SafeTransaction{
+		Safe:           info.Address,
+		ChainID:        info.ChainID,
+		To:             common.HexToAddress(proposal.To).Hex(),
+		Value:          value.String(),
+		Operation:      safeOperationCall,
+		SafeTxGas:      "0",
+		BaseGas:        "0",
+		GasPrice:       "0",
+		GasToken:       zero,
+		RefundReceiver: zero,
+		Nonce:          nonce,
+		Threshold:      info.Threshold,
+		Status:         SafeTxPending,
+		Proposed:       true,
+		UpdatedAt:      time.Now().UTC(),
+	}
+	if len(proposal.Data) > 0 {
+		tx.Data = hexutil.Encode(proposal.Data)
+	}
+
+	hash, err := safeTxHash(chain, tx)
+	if err != nil {
+		return nil, err
+	}
+	tx.SafeTxHash = hash.Hex()
+	for _, existing := range transactions {
+		if existing.SafeTxHash == tx.SafeTxHash {
+			return nil, fmt.Errorf("transaction %s has already been proposed", tx.SafeTxHash)
+		}
+	}
+
+	signature, err := signSafeTransaction(owner, hash)
+	if err != nil {
+		return nil, err
+	}
+	tx.Confirmations = []SafeConfirmation{{Owner: owner.Hex(), Signature: signature}}
+
+	pushSafeTransaction(tx)
+	transactions = append(transactions, tx)
+	if err := writeJSONFile(safeTransactionsFile, transactions); err != nil {
+		return nil, err
+	}
+
+	recordAudit("safe.proposed", fmt.Sprintf("%s proposed a transaction of Safe %s to %s for %s wei", owner.Hex(), tx.Safe, tx.To, tx.Value),
+		map[string]interface{}{"safe": tx.Safe, "safe_tx_hash": tx.SafeTxHash, "owner": owner.Hex(), "to": tx.To, "value": tx.Value,
+			"nonce": tx.Nonce, "chain_id": tx.ChainID, "pushed": tx.Pushed})
+	return tx, nil
+}
+
+// ConfirmSafeTransaction signs a pending Safe transaction with an owner, the
+// selected account or else the first wallet account owning the Safe that has
+// not confirmed it yet, and pushes the confirmation to the service.
+func ConfirmSafeTransaction(chain *Chain, address, txHash, owner string) (*SafeTransaction, error) {
+	info, err := GetSafe(chain, address)
+	if err != nil {
+		return nil, err
+	}
+
+	safeTransactionsMu.Lock()
+	defer safeTransactionsMu.Unlock()
+
+	transactions, err := readSafeTransactions()
+	if err != nil {
+		return nil, err
+	}
+	tx, hash, err := pendingSafeTransaction(chain, info, transactions, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := safeSigner(info, owner, tx.Confirmations)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signSafeTransaction(signer, hash)
+	if err != nil {
+		return nil, err
+	}
+	tx.addConfirmation(SafeConfirmation{Owner: signer.Hex(), Signature: signature})
+	tx.Threshold = info.Threshold
+	tx.UpdatedAt = time.Now().UTC()
+
+	pushSafeTransaction(tx)
+	if err := writeJSONFile(safeTransactionsFile, transactions); err != nil {
+		return nil, err
+	}
+
+	recordAudit("safe.confirmed", fmt.Sprintf("%s confirmed transaction %s of Safe %s", signer.Hex(), tx.SafeTxHash, tx.Safe),
+		map[string]interface{}{"safe": tx.Safe, "safe_tx_hash": tx.SafeTxHash, "owner": signer.Hex(), "nonce": tx.Nonce,
+			"chain_id": tx.ChainID, "pushed": tx.Pushed})
+	return tx, nil
+}
+
+// CollectSafeConfirmations signs a pending Safe transaction with each wallet
+// account owning the Safe that has not confirmed it yet, until it has as
+// many confirmations as the Safe's threshold, and pushes them to the
+// service. If any of those owners cannot sign, as when its key is locked,
+// none of the signatures are kept.
+func CollectSafeConfirmations(chain *Chain, address, txHash string) (*SafeTransaction, error) {
+	info, err := GetSafe(chain, address)
+	if err != nil {
+		return nil, err
+	}
+
+	safeTransactionsMu.Lock()
+	defer safeTransactionsMu.Unlock()
+
+	transactions, err := readSafeTransactions()
+	if err != nil {
+		return nil, err
+	}
+	tx, hash, err := pendingSafeTransaction(chain, info, transactions, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	signed, missing := safeSignedOwners(info, tx)
+	var collected []SafeConfirmation
+	for _, walletOwner := range info.WalletOwners {
+		if uint64(len(signed)+len(collected)) >= info.Threshold {
+			break
+		}
+		if !containsFold(missing, walletOwner) {
+			continue
+		}
+		signature, err := signSafeTransaction(common.HexToAddress(walletOwner), hash)
+		if err != nil {
+			return nil, fmt.Errorf("%s cannot confirm: %w", walletOwner, err)
+		}
+		collected = append(collected, SafeConfirmation{Owner: walletOwner, Signature: signature})
+	}
+	if len(collected) == 0 {
+		if uint64(len(signed)) >= info.Threshold {
+			return tx, nil
+		}
+		return nil, fmt.Errorf("%w: every wallet account owning the Safe has confirmed it", ErrAlreadyConfirmed)
+	}
+
+	owners := make([]string, len(collected))
+	for i, confirmation := range collected {
+		tx.addConfirmation(confirmation)
+		owners[i] = confirmation.Owner
+	}
+	tx.Threshold = info.Threshold
+	tx.UpdatedAt = time.Now().UTC()
+
+	pushSafeTransaction(tx)
+	if err := writeJSONFile(safeTransactionsFile, transactions); err != nil {
+		return nil, err
+	}
+
+	recordAudit("safe.confirmed", fmt.Sprintf("%s confirmed transaction %s of Safe %s", strings.Join(owners, ", "), tx.SafeTxHash, tx.Safe),
+		map[string]interface{}{"safe": tx.Safe, "safe_tx_hash": tx.SafeTxHash, "owners": owners, "nonce": tx.Nonce,
+			"chain_id": tx.ChainID, "pushed": tx.Pushed})
+	return tx, nil
+}
+
+// pendingSafeTransaction finds a pending transaction of a Safe, with its
+// hash checked against the Safe.
+func pendingSafeTransaction(chain *Chain, info *SafeInfo, transactions []*SafeTransaction, txHash string) (*SafeTransaction, common.Hash, error) {
+	var tx *SafeTransaction
+	for _, candidate := range transactions {
+		if candidate.Safe == info.Address && candidate.ChainID == info.ChainID && strings.EqualFold(candidate.SafeTxHash, txHash) {
+			tx = candidate
+			break
+		}
+	}
+	if tx == nil {
+		return nil, common.Hash{}, ErrSafeTxNotFound
+	}
+	if tx.Status != SafeTxPending || tx.Nonce < info.Nonce {
+		return nil, common.Hash{}, ErrSafeTxClosed
+	}
+
+	hash, err := safeTxHash(chain, tx)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	if hash.Hex() != tx.SafeTxHash {
+		return nil, common.Hash{}, ErrSafeTxHashMismatch
+	}
+
+	return tx, hash, nil
+}
+
+func (tx *SafeTransaction) addConfirmation(confirmation SafeConfirmation) {
+	for i, existing := range tx.Confirmations {
+		if strings.EqualFold(existing.Owner, confirmation.Owner) {
+			tx.Confirmations[i].Pushed = existing.Pushed || confirmation.Pushed
+			return
+		}
+	}
+
+	tx.Confirmations = append(tx.Confirmations, confirmation)
+}
+
+// pushSafeTransaction sends what the service does not have of tx yet: the
+// transaction itself, proposed with its first confirmation, and then any
+// other confirmations. A failure is recorded on tx, to be retried.
+func pushSafeTransaction(tx *SafeTransaction) {
+	tx.PushError = ""
+	if err := pushSafeTransactionTo(tx); err != nil {
+		tx.PushError = err.Error()
+	}
+}
+
+func pushSafeTransactionTo(tx *SafeTransaction) error {
+	if _, err := safeServiceURL(); err != nil {
+		return err
+	}
+
+	for i := range tx.Confirmations {
+		confirmation := &tx.Confirmations[i]
+		if confirmation.Pushed {
+			continue
+		}
+
+		if !tx.Pushed {
+			if err := safeService(http.MethodPost, "/api/v1/safes/"+tx.Safe+"/multisig-transactions/", tx.proposalBody(*confirmation), nil); err != nil {
+				return err
+			}
+			tx.Pushed = true
+		} else {
+			body := map[string]string{"signature": confirmation.Signature}
+			if err := safeService(http.MethodPost, "/api/v1/multisig-transactions/"+tx.SafeTxHash+"/confirmations/", body, nil); err != nil {
+				return err
+			}
+		}
+		confirmation.Pushed = true
+	}
+
+	return nil
+}
+
+func (tx *SafeTransaction) proposalBody(confirmation SafeConfirmation) map[string]interface{} {
+	var data interface{}
+	if tx.Data != "" {
+		data = tx.Data
+	}
+
+	return map[string]interface{}{
+		"safe":                    tx.Safe,
+		"to":                      tx.To,
+		"value":                   tx.Value,
+		"data":                    data,
+		"operation":               tx.Operation,
+		"safeTxGas":               json.Number(tx.SafeTxGas),
+		"baseGas":                 json.Number(tx.BaseGas),
+		"gasPrice":                tx.GasPrice,
+		"gasToken":                tx.GasToken,
+		"refundReceiver":          tx.RefundReceiver,
+		"nonce":                   tx.Nonce,
+		"contractTransactionHash": tx.SafeTxHash,
+		"sender":                  confirmation.Owner,
+		"signature":               confirmation.Signature,
+		"origin":                  "go-wallet",
+	}
+}
+
+// safeServiceTransaction is a multisig transaction as the service returns
+// it. Its gas fields are numbers or strings depending on the version.
+type safeServiceTransaction struct {
+	Safe           string      `json:"safe"`
+	To             string      `json:"to"`
+	Value          serviceUint `json:"value"`
+	Data           *string     `json:"data"`
+	Operation      uint8       `json:"operation"`
+	SafeTxGas      serviceUint `json:"safeTxGas"`
+	BaseGas        serviceUint `json:"baseGas"`
+	GasPrice       serviceUint `json:"gasPrice"`
+	GasToken       *string     `json:"gasToken"`
+	RefundReceiver *string     `json:"refundReceiver"`
+	Nonce          serviceUint `json:"nonce"`
+	SafeTxHash     string      `json:"safeTxHash"`
+	Confirmations  []struct {
+		Owner     string `json:"owner"`
+		Signature string `json:"signature"`
+	} `json:"confirmations"`
+}
+
+func (r safeServiceTransaction) transaction(info *SafeInfo) (*SafeTransaction, error) {
+	if !common.IsHexAddress(r.To) {
+		return nil, fmt.Errorf("Safe Transaction Service returned an invalid transaction %s", r.SafeTxHash)
+	}
+	nonce, err := strconv.ParseUint(string(r.Nonce), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Safe Transaction Service returned an invalid nonce for %s", r.SafeTxHash)
+	}
+
+	address := func(raw *string) string {
+		if raw == nil || !common.IsHexAddress(*raw) {
+			return common.Address{}.Hex()
+		}
+		return common.HexToAddress(*raw).Hex()
+	}
+	tx := &SafeTransaction{
+		SafeTxHash:     common.HexToHash(r.SafeTxHash).Hex(),
+		Safe:           info.Address,
+		ChainID:        info.ChainID,
+		To:             common.HexToAddress(r.To).Hex(),
+		Value:          r.Value.String(),
+		Operation:      r.Operation,
+		SafeTxGas:      r.SafeTxGas.String(),
+		BaseGas:        r.BaseGas.String(),
+		GasPrice:       r.GasPrice.String(),
+		GasToken:       address(r.GasToken),
+		RefundReceiver: address(r.RefundReceiver),
+		Nonce:          nonce,
+		Threshold:      info.Threshold,
+		Status:         SafeTxPending,
+		Pushed:         true,
+		UpdatedAt:      time.Now().UTC(),
+	}
+	if r.Data != nil && *r.Data != "" && *r.Data != "0x" {
+		tx.Data = *r.Data
+	}
+	for _, confirmation := range r.Confirmations {
+		tx.Confirmations = append(tx.Confirmations, SafeConfirmation{
+			Owner:     common.HexToAddress(confirmation.Owner).Hex(),
+			Signature: confirmation.Signature,
+			Pushed:    true,
+		})
+	}
+
+	return tx, nil
+}
+
+// serviceUint is an unsigned integer the service sends as either a JSON
+// number or a decimal string.
+type serviceUint string
+
+func (u *serviceUint) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*u = "0"
+		return nil
+	}
+
+	raw := strings.Trim(string(data), `"`)
+	if _, ok := new(big.Int).SetString(raw, 10); !ok {
+		return fmt.Errorf("invalid integer %s", data)
+	}
+	*u = serviceUint(raw)
+	return nil
+}
+
+func (u serviceUint) String() string {
+	if u == "" {
+		return "0"
+	}
+
+	return string(u)
+}
+
+var (
+	safeDomainTypeHash       = crypto.Keccak256Hash([]byte("EIP712Domain(uint256 chainId,address verifyingContract)"))
+	legacySafeDomainTypeHash = crypto.Keccak256Hash([]byte("EIP712Domain(address verifyingContract)"))
+	safeTxTypeHash           = crypto.Keccak256Hash([]byte("SafeTx(address to,uint256 value,bytes data,uint8 operation,uint256 safeTxGas,uint256 baseGas,uint256 gasPrice,address gasToken,address refundReceiver,uint256 nonce)"))
+)
+
+// safeTxParams are a Safe transaction's amounts and data as the contract
+// takes them.
+type safeTxParams struct {
+	value, safeTxGas, baseGas, gasPrice *big.Int
+	data                                []byte
+}
+
+func (tx *SafeTransaction) params() (safeTxParams, error) {
+	var params safeTxParams
+	for _, field := range []struct {
+		name  string
+		raw   string
+		value **big.Int
+	}{
+		{"value", tx.Value, &params.value},
+		{"safe_tx_gas", tx.SafeTxGas, &params.safeTxGas},
+		{"base_gas", tx.BaseGas, &params.baseGas},
+		{"gas_price", tx.GasPrice, &params.gasPrice},
+	} {
+		parsed, ok := new(big.Int).SetString(field.raw, 10)
+		if !ok || parsed.Sign() < 0 {
+			return safeTxParams{}, fmt.Errorf("invalid %s %q in Safe transaction %s", field.name, field.raw, tx.SafeTxHash)
+		}
+		*field.value = parsed
+	}
+
+	data, err := hexutil.Decode(orEmptyHex(tx.Data))
+	if err != nil {
+		return safeTxParams{}, fmt.Errorf("invalid data in Safe transaction %s: %w", tx.SafeTxHash, err)
+	}
+	params.data = data
+
+	return params, nil
+}
+
+// safeTxHash works out the EIP-712 hash of tx itself, so that a node cannot
+// choose what the wallet signs. Safes from 1.3.0 put the chain ID in their
+// domain and older ones do not; the Safe's own getTransactionHash says
+// which applies, and a Safe that gives neither hash is refused.
+func safeTxHash(chain *Chain, tx *SafeTransaction) (common.Hash, error) {
+	params, err := tx.params()
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	out, err := callContract(chain, common.HexToAddress(tx.Safe), safeABI, "getTransactionHash",
+		common.HexToAddress(tx.To), params.value, params.data, tx.Operation, params.safeTxGas, params.baseGas, params.gasPrice,
+		common.HexToAddress(tx.GasToken), common.HexToAddress(tx.RefundReceiver), new(big.Int).SetUint64(tx.Nonce))
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("getTransactionHash() failed: %w", err)
+	}
+	onChain, ok := out[0].([32]byte)
+	if !ok {
+		return common.Hash{}, errors.New("unexpected getTransactionHash() result")
+	}
+
+	for _, hash := range localSafeTxHashes(chain.ID, tx, params) {
+		if hash == common.Hash(onChain) {
+			return hash, nil
+		}
+	}
+
+	return common.Hash{}, fmt.Errorf("%w: the Safe's getTransactionHash() gives %s", ErrSafeTxHashMismatch, common.Hash(onChain).Hex())
+}
+
+// localSafeTxHashes is the EIP-712 hash of tx under the domain of Safes from
+// 1.3.0, with the chain ID, and under that of older ones, without.
+func localSafeTxHashes(chainID *big.Int, tx *SafeTransaction, params safeTxParams) []common.Hash {
+	word := func(value *big.Int) []byte { return common.LeftPadBytes(value.Bytes(), 32) }
+	address := func(hex string) []byte { return common.LeftPadBytes(common.HexToAddress(hex).Bytes(), 32) }
+
+	structHash := crypto.Keccak256(
+		safeTxTypeHash.Bytes(),
+		address(tx.To),
+		word(params.value),
+		crypto.Keccak256(params.data),
+		word(big.NewInt(int64(tx.Operation))),
+		word(params.safeTxGas),
+		word(params.baseGas),
+		word(params.gasPrice),
+		address(tx.GasToken),
+		address(tx.RefundReceiver),
+		word(new(big.Int).SetUint64(tx.Nonce)),
+	)
+	domains := [][]byte{
+		crypto.Keccak256(safeDomainTypeHash.Bytes(), word(chainID), address(tx.Safe)),
+		crypto.Keccak256(legacySafeDomainTypeHash.Bytes(), address(tx.Safe)),
+	}
+
+	hashes := make([]common.Hash, len(domains))
+	for i, domain := range domains {
+		hashes[i] = crypto.Keccak256Hash([]byte{0x19, 0x01}, domain, structHash)
+	}
+	return hashes
+}
+
+// signSafeTransaction signs a Safe transaction hash as an EOA owner does,
+// with v of 27 or 28.
+func signSafeTransaction(owner common.Address, hash common.Hash) (string, error) {
+	signer, err := accountSigner(owner.Hex())
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := signer.SignHash(hash.Bytes())
+	if err != nil {
+		return "", err
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	recordSignature(owner)
+
+	return hexutil.Encode(signature), nil
+}
+
+// safeSigner picks the wallet account to sign for a Safe: owner if given, or
+// the selected account, or the first wallet account owning the Safe, as
+// long as it has not signed already.
+func safeSigner(info *SafeInfo, owner string, confirmations []SafeConfirmation) (common.Address, error) {
+	confirmed := func(address string) bool {
+		for _, confirmation := range confirmations {
+			if strings.EqualFold(confirmation.Owner, address) {
+				return true
+			}
+		}
+		return false
+	}
+	isWalletOwner := func(address string) bool {
+		for _, walletOwner := range info.WalletOwners {
+			if strings.EqualFold(walletOwner, address) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if owner != "" {
+		resolved, err := AccountAddress(owner)
+		if err != nil {
+			return common.Address{}, err
+		}
+		if !isWalletOwner(resolved) {
+			return common.Address{}, fmt.Errorf("%w: %s is not an owner", ErrNotSafeOwner, resolved)
+		}
+		if confirmed(resolved) {
+			return common.Address{}, ErrAlreadyConfirmed
+		}
+		return common.HexToAddress(resolved), nil
+	}
+
+	if selected, err := SelectedAddress(); err == nil && isWalletOwner(selected) && !confirmed(selected) {
+		return common.HexToAddress(selected), nil
+	}
+	for _, walletOwner := range info.WalletOwners {
+		if !confirmed(walletOwner) {
+			return common.HexToAddress(walletOwner), nil
+		}
+	}
+
+	return common.Address{}, ErrAlreadyConfirmed
+}
+
+func safeState(chain *Chain, safe common.Address) ([]common.Address, uint64, uint64, error) {
+	out, err := callContract(chain, safe, safeABI, "getOwners")
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("getOwners() failed; is %s a Safe? %w", safe.Hex(), err)
+	}
+	owners, ok := out[0].([]common.Address)
+	if !ok {
+		return nil, 0, 0, errors.New("unexpected getOwners() result")
+	}
+
+	threshold, err := callUint(chain, safe, "getThreshold")
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	nonce, err := callUint(chain, safe, "nonce")
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	return owners, threshold, nonce, nil
+}
+
+func callUint(chain *Chain, safe common.Address, method string) (uint64, error) {
+	out, err := callContract(chain, safe, safeABI, method)
+	if err != nil {
+		return 0, fmt.Errorf("%s() failed: %w", method, err)
+	}
+	value, ok := out[0].(*big.Int)
+	if !ok || !value.IsUint64() {
+		return 0, fmt.Errorf("unexpected %s() result", method)
+	}
+
+	return value.Uint64(), nil
+}
+
+// walletSafeOwners returns the owners that are wallet accounts able to sign.
+func walletSafeOwners(owners []common.Address) ([]common.Address, error) {
+	accounts, _, err := ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var walletOwners []common.Address
+	for _, owner := range owners {
+		for _, account := range accounts {
+			if common.HexToAddress(account.Address) == owner && !account.WatchOnly {
+				walletOwners = append(walletOwners, owner)
+				break
+			}
+		}
+	}
+
+	return walletOwners, nil
+}
+
+func safeServiceURL() (string, error) {
+	url := strings.TrimRight(os.Getenv("SAFE_TRANSACTION_SERVICE_URL"), "/")
+	if url == "" {
+		return "", ErrSafeServiceUnavailable
+	}
+
+	return url, nil
+}
+
+// safeService makes a request to the service, sending body and decoding
+// the response into out when they are not nil.
+func safeService(method, path string, body, out interface{}) error {
+	base, err := safeServiceURL()
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := safeServiceClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Safe Transaction Service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Safe Transaction Service: %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func sortSafeTransactions(list []*SafeTransaction) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if (list[i].Status == SafeTxPending) != (list[j].Status == SafeTxPending) {
+			return list[i].Status == SafeTxPending
+		}
+		return list[i].Nonce < list[j].Nonce
+	})
+}
+
+func orEmptyHex(data string) string {
+	if data == "" {
+		return "0x"
+	}
+
+	return data
+}
+
+func readSafeTransactions() ([]*SafeTransaction, error) {
+	var transactions []*SafeTransaction
+	if err := readJSONFile(safeTransactionsFile, &transactions); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return transactions, nil
+}
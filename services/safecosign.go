@@ -0,0 +1,350 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Offline co-signing lets owners whose keys are not in the wallet, such as
+// one kept on an air-gapped machine, sign a Safe transaction without the
+// transaction service: its bundle is exported to them, their signatures
+// are imported back, and once the Safe's threshold of owners have signed,
+// the signatures are put together into the Safe's execTransaction call.
+
+// safeSigEthSign is what the Safe adds to the v of an eth_sign
+// (personal_sign) signature of the hash, to tell it from a signature of the
+// hash itself.
+const safeSigEthSign = 4
+
+var (
+	ErrInvalidSafeSignature = errors.New("invalid Safe signature")
+	ErrSafeThresholdNotMet  = errors.New("the Safe transaction does not have enough signatures")
+	ErrSafeTxNotNext        = errors.New("the Safe must execute its earlier nonces first")
+)
+
+// SafeSigningBundle is what an offline owner needs to sign a Safe
+// transaction. Transaction holds its fields, from which the signer's tool
+// recomputes SafeTxHash; TypedData is the same as EIP-712 typed data for
+// eth_signTypedData_v4, for Safes of version 1.3 or later. Signed and
+// Missing are the owners that have and have not signed it yet.
+type SafeSigningBundle struct {
+	Transaction *SafeTransaction    `json:"transaction"`
+	TypedData   *apitypes.TypedData `json:"typed_data,omitempty"`
+	Owners      []string            `json:"owners"`
+	Threshold   uint64              `json:"threshold"`
+	Signed      []string            `json:"signed"`
+	Missing     []string            `json:"missing"`
+	ExportedAt  time.Time           `json:"exported_at"`
+}
+
+// ExportSafeTransaction returns the bundle for offline owners to sign a
+// pending transaction of a Safe.
+func ExportSafeTransaction(chain *Chain, address, txHash string) (*SafeSigningBundle, error) {
+	info, err := GetSafe(chain, address)
+	if err != nil {
+		return nil, err
+	}
+
+	safeTransactionsMu.Lock()
+	defer safeTransactionsMu.Unlock()
+
+	transactions, err := readSafeTransactions()
+	if err != nil {
+		return nil, err
+	}
+	tx, hash, err := pendingSafeTransaction(chain, info, transactions, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &SafeSigningBundle{
+		Transaction: tx,
+		Owners:      info.Owners,
+		Threshold:   info.Threshold,
+		ExportedAt:  time.Now().UTC(),
+	}
+	bundle.Signed, bundle.Missing = safeSignedOwners(info, tx)
+
+	// Safes before 1.3 hash without the chain ID, so the typed data is
+	// only offered when it gives the hash the Safe does.
+	typedData := safeTypedData(tx)
+	if digest, err := typedDataHash(typedData); err == nil && bytes.Equal(digest, hash.Bytes()) {
+		bundle.TypedData = &typedData
+	}
+
+	return bundle, nil
+}
+
+// ImportSafeSignatures adds signatures of a pending Safe transaction made
+// by its owners elsewhere, hex-encoded and 65 bytes each: of the hash
+// itself, as eth_signTypedData_v4 makes, or by eth_sign or personal_sign,
+// with v of 0/1, 27/28 or, for eth_sign, 31/32. Each must recover to an
+// owner; one from an owner that has already signed is skipped. The new
+// confirmations are pushed to the service if one is configured.
+func ImportSafeSignatures(chain *Chain, address, txHash string, signatures []string) (*SafeTransaction, error) {
+	if len(signatures) == 0 {
+		return nil, fmt.Errorf("%w: no signatures given", ErrInvalidSafeSignature)
+	}
+	info, err := GetSafe(chain, address)
+	if err != nil {
+		return nil, err
+	}
+
+	safeTransactionsMu.Lock()
+	defer safeTransactionsMu.Unlock()
+
+	transactions, err := readSafeTransactions()
+	if err != nil {
+		return nil, err
+	}
+	tx, hash, err := pendingSafeTransaction(chain, info, transactions, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var imported []string
+	for i, signatureHex := range signatures {
+		owner, signature, err := safeSignatureOwner(info, hash, signatureHex)
+		if err != nil {
+			return nil, fmt.Errorf("signature %d: %w", i+1, err)
+		}
+		if signed, _ := safeSignedOwners(info, tx); containsFold(signed, owner.Hex()) {
+			continue
+		}
+		tx.addConfirmation(SafeConfirmation{Owner: owner.Hex(), Signature: signature})
+		imported = append(imported, owner.Hex())
+	}
+	if len(imported) == 0 {
+		return tx, nil
+	}
+	tx.Threshold = info.Threshold
+	tx.UpdatedAt = time.Now().UTC()
+
+	pushSafeTransaction(tx)
+	if err := writeJSONFile(safeTransactionsFile, transactions); err != nil {
+		return nil, err
+	}
+
+	recordAudit("safe.signatures_imported", fmt.Sprintf("imported signatures of %s for transaction %s of Safe %s", strings.Join(imported, ", "), tx.SafeTxHash, tx.Safe),
+		map[string]interface{}{"safe": tx.Safe, "safe_tx_hash": tx.SafeTxHash, "owners": imported, "nonce": tx.Nonce,
+			"chain_id": tx.ChainID, "pushed": tx.Pushed})
+	return tx, nil
+}
+
+// ExecuteSafeTransaction sends the Safe's execTransaction call for a
+// pending transaction that enough owners have signed, from a wallet
+// account, the selected one if empty, which pays the gas and need not be an
+// owner. The transaction must be the Safe's next nonce. A call the Safe
+// would refuse fails estimation and is not sent.
+func ExecuteSafeTransaction(chain *Chain, address, txHash, account string) (*SafeTransaction, error) {
+	info, err := GetSafe(chain, address)
+	if err != nil {
+		return nil, err
+	}
+
+	safeTransactionsMu.Lock()
+	defer safeTransactionsMu.Unlock()
+
+	transactions, err := readSafeTransactions()
+	if err != nil {
+		return nil, err
+	}
+	tx, _, err := pendingSafeTransaction(chain, info, transactions, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Nonce != info.Nonce {
+		return nil, fmt.Errorf("%w: its nonce is %d and the Safe's is %d", ErrSafeTxNotNext, tx.Nonce, info.Nonce)
+	}
+
+	signatures, err := aggregateSafeSignatures(info, tx)
+	if err != nil {
+		return nil, err
+	}
+	params, err := tx.params()
+	if err != nil {
+		return nil, err
+	}
+	call, err := safeABI.Pack("execTransaction", common.HexToAddress(tx.To), params.value, params.data, tx.Operation,
+		params.safeTxGas, params.baseGas, params.gasPrice, common.HexToAddress(tx.GasToken), common.HexToAddress(tx.RefundReceiver), signatures)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := loadSignerFor(account)
+	if err != nil {
+		return nil, err
+	}
+	executionHash, err := sendContractTransaction(chain, signer, common.HexToAddress(tx.Safe), big.NewInt(0), call)
+	if err != nil {
+		return nil, err
+	}
+	tx.ExecutionTxHash = executionHash
+	tx.UpdatedAt = time.Now().UTC()
+	if err := writeJSONFile(safeTransactionsFile, transactions); err != nil {
+		return nil, err
+	}
+
+	recordAudit("safe.executed", fmt.Sprintf("%s executed transaction %s of Safe %s", signer.Address().Hex(), tx.SafeTxHash, tx.Safe),
+		map[string]interface{}{"safe": tx.Safe, "safe_tx_hash": tx.SafeTxHash, "executor": signer.Address().Hex(),
+			"tx_hash": executionHash, "nonce": tx.Nonce, "chain_id": tx.ChainID})
+	return tx, nil
+}
+
+// aggregateSafeSignatures puts together the signatures of the Safe's
+// current owners in the order it checks them, by owner address ascending,
+// taking as many as its threshold.
+func aggregateSafeSignatures(info *SafeInfo, tx *SafeTransaction) ([]byte, error) {
+	var confirmations []SafeConfirmation
+	for _, confirmation := range tx.Confirmations {
+		if containsFold(info.Owners, confirmation.Owner) {
+			confirmations = append(confirmations, confirmation)
+		}
+	}
+	if uint64(len(confirmations)) < info.Threshold {
+		return nil, fmt.Errorf("%w: %d of %d", ErrSafeThresholdNotMet, len(confirmations), info.Threshold)
+	}
+	sort.Slice(confirmations, func(i, j int) bool {
+		return bytes.Compare(common.HexToAddress(confirmations[i].Owner).Bytes(), common.HexToAddress(confirmations[j].Owner).Bytes()) < 0
+	})
+
+	var signatures []byte
+	for _, confirmation := range confirmations[:info.Threshold] {
+		signature, err := hexutil.Decode(confirmation.Signature)
+		if err != nil || len(signature) != crypto.SignatureLength {
+			// Contract signatures carry data after the static part and
+			// cannot be packed in here.
+			return nil, fmt.Errorf("%w: the signature of %s is not a 65-byte owner signature", ErrInvalidSafeSignature, confirmation.Owner)
+		}
+		signatures = append(signatures, signature...)
+	}
+
+	return signatures, nil
+}
+
+// safeSignatureOwner recovers the owner of a signature of a Safe
+// transaction hash, returning the signature as the Safe takes it: v of
+// 27/28 for a signature of the hash, 31/32 for eth_sign. A signature with
+// v of 0/1 or 27/28 is tried as both.
+func safeSignatureOwner(info *SafeInfo, hash common.Hash, signatureHex string) (common.Address, string, error) {
+	signature, err := hexutil.Decode(strings.TrimSpace(signatureHex))
+	if err != nil || len(signature) != crypto.SignatureLength {
+		return common.Address{}, "", fmt.Errorf("%w: expected 65 hex-encoded bytes", ErrInvalidSafeSignature)
+	}
+	v := signature[crypto.RecoveryIDOffset]
+
+	candidates := []struct {
+		digest []byte
+		offset byte
+	}{
+		{hash.Bytes(), 27},
+		{accounts.TextHash(hash.Bytes()), 27 + safeSigEthSign},
+	}
+	switch {
+	case v < 2:
+	case v == 27 || v == 28:
+		v -= 27
+	case v == 27+safeSigEthSign || v == 28+safeSigEthSign:
+		v -= 27 + safeSigEthSign
+		candidates = candidates[1:]
+	default:
+		return common.Address{}, "", fmt.Errorf("%w: unsupported v %d", ErrInvalidSafeSignature, v)
+	}
+
+	for _, candidate := range candidates {
+		signer, ok := recoverAddress(candidate.digest, append(signature[:crypto.RecoveryIDOffset:crypto.RecoveryIDOffset], v))
+		if !ok || !containsFold(info.Owners, signer.Hex()) {
+			continue
+		}
+		normalized := append(signature[:crypto.RecoveryIDOffset:crypto.RecoveryIDOffset], v+candidate.offset)
+		return signer, hexutil.Encode(normalized), nil
+	}
+
+	return common.Address{}, "", fmt.Errorf("%w: it is not by an owner of the Safe", ErrInvalidSafeSignature)
+}
+
+// safeSignedOwners splits the Safe's owners into those with a confirmation
+// of tx and those without.
+func safeSignedOwners(info *SafeInfo, tx *SafeTransaction) (signed, missing []string) {
+	signed, missing = []string{}, []string{}
+	for _, owner := range info.Owners {
+		confirmed := false
+		for _, confirmation := range tx.Confirmations {
+			if strings.EqualFold(confirmation.Owner, owner) {
+				confirmed = true
+				break
+			}
+		}
+		if confirmed {
+			signed = append(signed, owner)
+		} else {
+			missing = append(missing, owner)
+		}
+	}
+
+	return signed, missing
+}
+
+// safeTypedData is a Safe transaction as the EIP-712 typed data Safes of
+// version 1.3 and later hash.
+func safeTypedData(tx *SafeTransaction) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"SafeTx": {
+				{Name: "to", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "data", Type: "bytes"},
+				{Name: "operation", Type: "uint8"},
+				{Name: "safeTxGas", Type: "uint256"},
+				{Name: "baseGas", Type: "uint256"},
+				{Name: "gasPrice", Type: "uint256"},
+				{Name: "gasToken", Type: "address"},
+				{Name: "refundReceiver", Type: "address"},
+				{Name: "nonce", Type: "uint256"},
+			},
+		},
+		PrimaryType: "SafeTx",
+		Domain: apitypes.TypedDataDomain{
+			ChainId:           math.NewHexOrDecimal256(int64(tx.ChainID)),
+			VerifyingContract: tx.Safe,
+		},
+		Message: apitypes.TypedDataMessage{
+			"to":             tx.To,
+			"value":          tx.Value,
+			"data":           orEmptyHex(tx.Data),
+			"operation":      fmt.Sprint(tx.Operation),
+			"safeTxGas":      tx.SafeTxGas,
+			"baseGas":        tx.BaseGas,
+			"gasPrice":       tx.GasPrice,
+			"gasToken":       tx.GasToken,
+			"refundReceiver": tx.RefundReceiver,
+			"nonce":          fmt.Sprint(tx.Nonce),
+		},
+	}
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	ScheduleStatusScheduled = "scheduled"
+	ScheduleStatusSent      = "sent"
+	ScheduleStatusCancelled = "cancelled"
+	ScheduleStatusFailed    = "failed"
+
+	schedulerInterval    = 15 * time.Second
+	maxScheduledAttempts = 5
+)
+
+type ScheduledTransaction struct {
+	ID             string    `json:"id"`
+	ChainID        uint64    `json:"chain_id,omitempty"`
+	From           string    `json:"from"`
+	To             string    `json:"to"`
+	Value          string    `json:"value"`
+	NotBefore      time.Time `json:"not_before"`
+	NotBeforeBlock uint64    `json:"not_before_block,omitempty"`
+	Status         string    `json:"status"`
+	TxHash         string    `json:"transaction_hash,omitempty"`
+	Attempts       int       `json:"attempts,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	BatchID        string    `json:"batch_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+var (
+	scheduleFile = "schedule.json"
+	scheduleMu   sync.Mutex
+)
+
+var (
+	ErrScheduleNotFound = errors.New("scheduled transaction not found")
+	ErrScheduleReleased = errors.New("scheduled transaction has already been released")
+	ErrScheduleNoLock   = errors.New("not_before or not_before_block is required")
+	ErrSchedulePast     = errors.New("release time must be in the future")
+)
+
+func ScheduleTransaction(chain *Chain, toAddress string, value int64, notBefore time.Time, notBeforeBlock uint64) (*ScheduledTransaction, error) {
+	if !common.IsHexAddress(toAddress) {
+		return nil, errors.New("invalid recipient address")
+	}
+	if notBefore.IsZero() && notBeforeBlock == 0 {
+		return nil, ErrScheduleNoLock
+	}
+	if !notBefore.IsZero() && !notBefore.After(time.Now()) {
+		return nil, ErrSchedulePast
+	}
+	if notBeforeBlock > 0 {
+		head, err := chain.client.BlockNumber(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		if notBeforeBlock <= head {
+			return nil, ErrSchedulePast
+		}
+	}
+
+	from, err := SelectedAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	scheduled := &ScheduledTransaction{
+		ID:             newID(),
+		ChainID:        chain.ID.Uint64(),
+		From:           from,
+		To:             common.HexToAddress(toAddress).Hex(),
+		Value:          big.NewInt(value).String(),
+		NotBefore:      notBefore.UTC(),
+		NotBeforeBlock: notBeforeBlock,
+		Status:         ScheduleStatusScheduled,
+		CreatedAt:      time.Now().UTC(),
+	}
+
+	if err := appendScheduled(scheduled); err != nil {
+		return nil, err
+	}
+
+	return scheduled, nil
+}
+
+// appendScheduled adds transactions to the schedule. Those released at the
+// same time are sent in the order given.
+func appendScheduled(scheduled ...*ScheduledTransaction) error {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	schedule, err := readSchedule()
+	if err != nil {
+		return err
+	}
+
+	schedule = append(schedule, scheduled...)
+	return writeJSONFile(scheduleFile, schedule)
+}
+
+func ListScheduledTransactions() ([]*ScheduledTransaction, error) {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	schedule, err := readSchedule()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(schedule, func(i, j int) bool {
+		return schedule[i].CreatedAt.Before(schedule[j].CreatedAt)
+	})
+
+	return schedule, nil
+}
+
+func CancelScheduledTransaction(id string) error {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	schedule, err := readSchedule()
+	if err != nil {
+		return err
+	}
+
+	for _, scheduled := range schedule {
+		if scheduled.ID != id {
+			continue
+		}
+
+		var head uint64
+		if scheduled.NotBeforeBlock > 0 {
+			head = currentBlock(scheduled.ChainID)
+		}
+
+		if scheduled.Status != ScheduleStatusScheduled || scheduled.released(head) {
+			return ErrScheduleReleased
+		}
+
+		scheduled.Status = ScheduleStatusCancelled
+		return writeJSONFile(scheduleFile, schedule)
+	}
+
+	return ErrScheduleNotFound
+}
+
+func StartScheduler() {
+	go func() {
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := runDueTransactions(); err != nil {
+				log.Printf("scheduler: %v", err)
+			}
+		}
+	}()
+}
+
+func runDueTransactions() error {
+	// Due transactions go out once maintenance ends.
+	if InMaintenance() {
+		return nil
+	}
+
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	schedule, err := readSchedule()
+	if err != nil {
+		return err
+	}
+
+	heads := map[uint64]uint64{}
+	for _, scheduled := range schedule {
+		if scheduled.Status != ScheduleStatusScheduled || scheduled.NotBeforeBlock == 0 {
+			continue
+		}
+		if _, ok := heads[scheduled.ChainID]; !ok {
+			heads[scheduled.ChainID] = currentBlock(scheduled.ChainID)
+		}
+	}
+
+	changed := false
+	for _, scheduled := range schedule {
+		if scheduled.Status != ScheduleStatusScheduled || !scheduled.released(heads[scheduled.ChainID]) {
+			continue
+		}
+
+		changed = true
+		txHash, err := executeScheduled(scheduled)
+		if err != nil {
+			scheduled.Attempts++
+			scheduled.LastError = err.Error()
+			if scheduled.Attempts >= maxScheduledAttempts {
+				scheduled.Status = ScheduleStatusFailed
+			}
+			continue
+		}
+
+		scheduled.Status = ScheduleStatusSent
+		scheduled.TxHash = txHash
+		scheduled.LastError = ""
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return writeJSONFile(scheduleFile, schedule)
+}
+
+func executeScheduled(scheduled *ScheduledTransaction) (string, error) {
+	signer, err := accountSigner(scheduled.From)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := new(big.Int).SetString(scheduled.Value, 10)
+	if !ok {
+		return "", errors.New("invalid scheduled value")
+	}
+
+	chain, err := chainByID(context.Background(), scheduled.ChainID)
+	if err != nil {
+		return "", err
+	}
+
+	gasPrice, err := chain.currentGasPrice(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	return sendTransaction(chain, signer, common.HexToAddress(scheduled.To), value, 21000, gasPrice, nil, nil)
+}
+
+// currentBlock returns 0 when the head cannot be fetched, which keeps
+// block-locked transactions locked rather than releasing them early.
+func currentBlock(chainID uint64) uint64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	chain, err := chainByID(ctx, chainID)
+	if err != nil {
+		return 0
+	}
+
+	head, err := chain.client.BlockNumber(ctx)
+	if err != nil {
+		return 0
+	}
+
+	return head
+}
+
+func (s *ScheduledTransaction) released(head uint64) bool {
+	if !s.NotBefore.IsZero() && time.Now().Before(s.NotBefore) {
+		return false
+	}
+	if s.NotBeforeBlock > 0 && head < s.NotBeforeBlock {
+		return false
+	}
+
+	return true
+}
+
+func readSchedule() ([]*ScheduledTransaction, error) {
+	var schedule []*ScheduledTransaction
+	if err := readJSONFile(scheduleFile, &schedule); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return schedule, nil
+}
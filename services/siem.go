@@ -0,0 +1,349 @@
+package services
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit export formats.
+const (
+	SIEMFormatJSON   = "json"
+	SIEMFormatSyslog = "syslog"
+	SIEMFormatCEF    = "cef"
+
+	siemInterval  = 5 * time.Second
+	siemBatchSize = 500
+
+	// siemFacility is syslog's "log audit" facility.
+	siemFacility = 13
+)
+
+// SIEMStatus describes the audit exporter. Backlog counts events recorded
+// but not yet sent; they stay in the audit log, and are kept from pruning,
+// until the collector takes them.
+type SIEMStatus struct {
+	Enabled        bool       `json:"enabled"`
+	Address        string     `json:"address,omitempty"`
+	Format         string     `json:"format,omitempty"`
+	Connected      bool       `json:"connected"`
+	Backlog        int        `json:"backlog"`
+	LastExportedAt *time.Time `json:"last_exported_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// siemCursor is the last audit event handed to the collector.
+type siemCursor struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type siemExporter struct {
+	address string
+	format  string
+	tls     bool
+
+	conn     net.Conn
+	hostname string
+}
+
+var (
+	siemFile = "siem_cursor.json"
+	siemMu   sync.Mutex
+	siem     *siemExporter
+	cursor   siemCursor
+
+	siemLastExport *time.Time
+	siemLastError  string
+
+	siemWake = make(chan struct{}, 1)
+)
+
+// StartSIEMExporter streams the audit log to the collector at SIEM_ADDR
+// (host:port, over TCP, with TLS if SIEM_TLS is true) as SIEM_FORMAT: json
+// (one event per line, the default), syslog (RFC 5424) or cef (CEF in a
+// syslog message). Events recorded while the collector is unreachable are
+// sent once it is back, oldest first.
+func StartSIEMExporter() {
+	address := os.Getenv("SIEM_ADDR")
+	if address == "" {
+		return
+	}
+
+	format := strings.ToLower(os.Getenv("SIEM_FORMAT"))
+	switch format {
+	case "":
+		format = SIEMFormatJSON
+	case SIEMFormatJSON, SIEMFormatSyslog, SIEMFormatCEF:
+	default:
+		log.Fatalf("SIEM_FORMAT must be %s, %s or %s", SIEMFormatJSON, SIEMFormatSyslog, SIEMFormatCEF)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	siemMu.Lock()
+	if err := readJSONFile(siemFile, &cursor); err != nil && !os.IsNotExist(err) {
+		log.Printf("siem: failed to read export cursor: %v", err)
+	}
+	siem = &siemExporter{
+		address:  address,
+		format:   format,
+		tls:      os.Getenv("SIEM_TLS") == "true",
+		hostname: hostname,
+	}
+	siemMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(siemInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := exportAudit(); err != nil {
+				log.Printf("siem: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-siemWake:
+			}
+		}
+	}()
+}
+
+func GetSIEMStatus() (*SIEMStatus, error) {
+	siemMu.Lock()
+	defer siemMu.Unlock()
+
+	if siem == nil {
+		return &SIEMStatus{}, nil
+	}
+
+	auditMu.Lock()
+	events, err := readAudit()
+	auditMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SIEMStatus{
+		Enabled:        true,
+		Address:        siem.address,
+		Format:         siem.format,
+		Connected:      siem.conn != nil,
+		Backlog:        len(unexported(events)),
+		LastExportedAt: siemLastExport,
+		LastError:      siemLastError,
+	}, nil
+}
+
+// auditExported reports whether an event may be pruned as far as the
+// exporter is concerned.
+func auditExported(event AuditEvent) bool {
+	siemMu.Lock()
+	defer siemMu.Unlock()
+
+	return siem == nil || !event.CreatedAt.After(cursor.CreatedAt)
+}
+
+func wakeSIEMExporter() {
+	select {
+	case siemWake <- struct{}{}:
+	default:
+	}
+}
+
+// exportAudit sends the events after the cursor, a batch at a time, and
+// advances the cursor past each event written.
+func exportAudit() error {
+	auditMu.Lock()
+	events, err := readAudit()
+	auditMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	siemMu.Lock()
+	defer siemMu.Unlock()
+
+	pending := unexported(events)
+	for len(pending) > 0 {
+		batch := pending
+		if len(batch) > siemBatchSize {
+			batch = batch[:siemBatchSize]
+		}
+		pending = pending[len(batch):]
+
+		written, err := siem.send(batch)
+		if written > 0 {
+			last := batch[written-1]
+			cursor = siemCursor{ID: last.ID, CreatedAt: last.CreatedAt}
+			now := time.Now().UTC()
+			siemLastExport = &now
+			if err := writeJSONFile(siemFile, cursor); err != nil {
+				log.Printf("siem: failed to save export cursor: %v", err)
+			}
+		}
+		if err != nil {
+			siemLastError = err.Error()
+			return err
+		}
+		siemLastError = ""
+	}
+
+	return nil
+}
+
+// unexported returns the events after the cursor, oldest first. It must be
+// called with siemMu held.
+func unexported(events []AuditEvent) []AuditEvent {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+
+	for i, event := range events {
+		if event.ID == cursor.ID {
+			return events[i+1:]
+		}
+	}
+
+	// The cursor's event has been pruned; fall back to its time.
+	for i, event := range events {
+		if event.CreatedAt.After(cursor.CreatedAt) {
+			return events[i:]
+		}
+	}
+
+	return nil
+}
+
+// send writes events to the collector, connecting first if needed, and
+// returns how many were written. A failed connection is dropped so the next
+// export reconnects.
+func (s *siemExporter) send(events []AuditEvent) (int, error) {
+	if s.conn != nil && !s.alive() {
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	if s.conn == nil {
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		var err error
+		if s.tls {
+			s.conn, err = tls.DialWithDialer(dialer, "tcp", s.address, nil)
+		} else {
+			s.conn, err = dialer.Dial("tcp", s.address)
+		}
+		if err != nil {
+			s.conn = nil
+			return 0, fmt.Errorf("cannot reach collector %s: %w", s.address, err)
+		}
+	}
+
+	for i, event := range events {
+		line, err := s.formatEvent(event)
+		if err != nil {
+			return i, err
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err := s.conn.Write(append(line, '\n')); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return i, fmt.Errorf("failed to write to collector %s: %w", s.address, err)
+		}
+	}
+
+	return len(events), nil
+}
+
+// alive checks that the collector has not closed the connection, since
+// writes to a closed connection can still appear to succeed once.
+func (s *siemExporter) alive() bool {
+	s.conn.SetReadDeadline(time.Now())
+	_, err := s.conn.Read(make([]byte, 1))
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (s *siemExporter) formatEvent(event AuditEvent) ([]byte, error) {
+	switch s.format {
+	case SIEMFormatSyslog:
+		return []byte(s.syslogHeader(event) + syslogData(event) + " " + event.Message), nil
+	case SIEMFormatCEF:
+		return []byte(s.syslogHeader(event) + "- " + cefMessage(event)), nil
+	}
+
+	return json.Marshal(event)
+}
+
+// syslogHeader is an RFC 5424 header up to the structured data. The process
+// ID is left out: events may have been recorded by an earlier process.
+func (s *siemExporter) syslogHeader(event AuditEvent) string {
+	priority := siemFacility*8 + auditSeverity(event.Kind)
+	return fmt.Sprintf("<%d>1 %s %s go-wallet - %s ", priority, event.CreatedAt.Format(time.RFC3339Nano), s.hostname, event.Kind)
+}
+
+// syslogData renders an event's details as RFC 5424 structured data.
+func syslogData(event AuditEvent) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+	var b strings.Builder
+	b.WriteString(`[audit@32473 id="` + event.ID + `"`)
+	for _, key := range sortedKeys(event.Details) {
+		fmt.Fprintf(&b, ` %s="%s"`, key, escape.Replace(fmt.Sprint(event.Details[key])))
+	}
+	b.WriteString("]")
+
+	return b.String()
+}
+
+// cefMessage renders an event in ArcSight Common Event Format.
+func cefMessage(event AuditEvent) string {
+	header := strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ")
+	extension := strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+	severity := 3
+	if auditSeverity(event.Kind) == 4 {
+		severity = 6
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|jabbala-dev|go-wallet|1|%s|%s|%d|", header.Replace(event.Kind), header.Replace(event.Message), severity)
+	fmt.Fprintf(&b, "rt=%d externalId=%s", event.CreatedAt.UnixMilli(), event.ID)
+	for _, key := range sortedKeys(event.Details) {
+		fmt.Fprintf(&b, " %s=%s", key, extension.Replace(fmt.Sprint(event.Details[key])))
+	}
+
+	return b.String()
+}
+
+// auditSeverity is the syslog severity of an audit event: warning for
+// problems found, notice otherwise.
+func auditSeverity(kind string) int {
+	if strings.HasSuffix(kind, ".discrepancy") || strings.HasSuffix(kind, "_failed") {
+		return 4
+	}
+	return 5
+}
+
+func sortedKeys(details map[string]interface{}) []string {
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signer signs for one address. A key the wallet holds signs in process; a
+// hardware wallet keeps its key on the device, which signs each transaction
+// only once it is confirmed on its screen; a cloud KMS signs hashes sent to
+// it, its keys never leaving it.
+type Signer interface {
+	Address() common.Address
+
+	// SignTx signs a transaction for the chain chainID.
+	SignTx(chainID *big.Int, tx *types.Transaction) (*types.Transaction, error)
+
+	// SignHash signs a 32-byte hash, returning a 65-byte signature with a
+	// 0/1 recovery ID.
+	SignHash(hash []byte) ([]byte, error)
+}
+
+type keySigner struct {
+	privateKey *ecdsa.PrivateKey
+}
+
+// newKeySigner signs with a key the wallet holds.
+func newKeySigner(privateKey *ecdsa.PrivateKey) Signer {
+	return keySigner{privateKey: privateKey}
+}
+
+func (s keySigner) Address() common.Address {
+	return addressOf(s.privateKey)
+}
+
+func (s keySigner) SignTx(chainID *big.Int, tx *types.Transaction) (*types.Transaction, error) {
+	return types.SignTx(tx, signerForChain(chainID), s.privateKey)
+}
+
+func (s keySigner) SignHash(hash []byte) ([]byte, error) {
+	return crypto.Sign(hash, s.privateKey)
+}
+
+// loadSigner returns the selected account's signer.
+func loadSigner() (Signer, error) {
+	return loadSignerFor("")
+}
+
+// loadSignerFor returns the signer of an account given by address or name,
+// the selected account's if empty.
+func loadSignerFor(account string) (Signer, error) {
+	address, err := AccountAddress(account)
+	if err != nil {
+		return nil, err
+	}
+
+	return accountSigner(address)
+}
+
+// accountSigner returns the signer of a wallet address: its hardware
+// wallet if it is on one, and otherwise the key store holding its key.
+// Watch-only accounts have none.
+func accountSigner(address string) (Signer, error) {
+	account := common.HexToAddress(address)
+	if watchOnly, err := isWatchOnly(account); watchOnly || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrWatchOnly, account.Hex())
+	}
+	if signer, err := hardwareSigner(account); signer != nil || err != nil {
+		return signer, err
+	}
+
+	store, err := keyStoreOf(account)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Signer(account)
+}
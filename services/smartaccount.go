@@ -0,0 +1,499 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Canonical deployments of the v0.7 EntryPoint and of the SimpleAccount
+// factory built against it. Both are at the same address on every chain.
+const (
+	entryPointAddress          = "0x0000000071727De22E5E9d8BAf0edAc6f37da032"
+	smartAccountFactoryAddress = "0x91E60e0613810449d098b0b5Ec8b51A0FE8c8985"
+)
+
+const entryPointABIJSON = `[
+	{"type":"function","name":"getNonce","stateMutability":"view","inputs":[{"name":"sender","type":"address"},{"name":"key","type":"uint192"}],"outputs":[{"name":"nonce","type":"uint256"}]}
+]`
+
+const smartAccountFactoryABIJSON = `[
+	{"type":"function","name":"getAddress","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"salt","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"createAccount","stateMutability":"nonpayable","inputs":[{"name":"owner","type":"address"},{"name":"salt","type":"uint256"}],"outputs":[{"name":"ret","type":"address"}]}
+]`
+
+const smartAccountABIJSON = `[
+	{"type":"function","name":"execute","stateMutability":"nonpayable","inputs":[{"name":"dest","type":"address"},{"name":"value","type":"uint256"},{"name":"func","type":"bytes"}],"outputs":[]}
+]`
+
+var (
+	entryPointABI          = mustParseABI(entryPointABIJSON)
+	smartAccountFactoryABI = mustParseABI(smartAccountFactoryABIJSON)
+	smartAccountABI        = mustParseABI(smartAccountABIJSON)
+)
+
+// dummySignature has the shape of a real ECDSA signature, so that gas is
+// estimated for the same validation path without having signed anything.
+var dummySignature = hexutil.MustDecode("0xfffffffffffffffffffffffffffffff0000000000000000000000000000000007aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa1c")
+
+// SmartAccount is an ERC-4337 SimpleAccount owned by one of the wallet's
+// accounts. Its address is counterfactual: it is known, and can receive
+// funds, before the contract exists. The contract is deployed by the first
+// UserOperation sent from it, through the operation's initCode.
+type SmartAccount struct {
+	ID        string    `json:"id"`
+	Address   string    `json:"address"`
+	Owner     string    `json:"owner"`
+	Factory   string    `json:"factory"`
+	Salt      string    `json:"salt"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SmartAccountStatus is a smart account as it stands on one chain.
+type SmartAccountStatus struct {
+	SmartAccount
+	ChainID  uint64 `json:"chain_id"`
+	Deployed bool   `json:"deployed"`
+	Balance  string `json:"balance"`
+}
+
+// UserOperationResult is a UserOperation accepted by the bundler. Deploys is
+// set when the operation carries initCode and so also deploys the account.
+type UserOperationResult struct {
+	Hash    string `json:"user_op_hash"`
+	Sender  string `json:"sender"`
+	Nonce   string `json:"nonce"`
+	Deploys bool   `json:"deploys"`
+}
+
+var (
+	smartAccountsFile = "smart_accounts.json"
+	smartAccountsMu   sync.Mutex
+)
+
+var (
+	ErrSmartAccountNotFound     = errors.New("smart account not found")
+	ErrSmartAccountExists       = errors.New("smart account already exists")
+	ErrSmartAccountMismatch     = errors.New("smart account address differs on this chain")
+	ErrSmartAccountsUnavailable = errors.New("smart accounts are not available on this chain")
+)
+
+// CreateSmartAccount computes the counterfactual address of a smart account
+// owned by the selected account, using the factory on chain, and records
+// it. Nothing is sent: the address can be given out and funded straight
+// away, and the account is deployed when it first sends. Without a salt the
+// owner's next unused one is taken, so each call yields a new account.
+func CreateSmartAccount(chain *Chain, salt *big.Int) (*SmartAccount, error) {
+	owner, err := SelectedAddress()
+	if err != nil {
+		return nil, err
+	}
+	ownerAddress := common.HexToAddress(owner)
+
+	smartAccountsMu.Lock()
+	defer smartAccountsMu.Unlock()
+
+	stored, err := readSmartAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	factory := smartAccountFactory()
+	if salt == nil {
+		salt = nextSmartAccountSalt(stored, ownerAddress, factory)
+	}
+
+	address, err := counterfactualAddress(chain, factory, ownerAddress, salt)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range stored {
+		if common.HexToAddress(account.Address) == address {
+			return nil, fmt.Errorf("%w: %s", ErrSmartAccountExists, address.Hex())
+		}
+	}
+
+	account := &SmartAccount{
+		ID:        newID(),
+		Address:   address.Hex(),
+		Owner:     ownerAddress.Hex(),
+		Factory:   factory.Hex(),
+		Salt:      salt.String(),
+		CreatedAt: time.Now().UTC(),
+	}
+	stored = append(stored, account)
+	if err := writeJSONFile(smartAccountsFile, stored); err != nil {
+		return nil, err
+	}
+
+	recordAudit("smart_account.created", fmt.Sprintf("smart account %s for %s", account.Address, account.Owner),
+		map[string]interface{}{"address": account.Address, "owner": account.Owner, "factory": account.Factory, "salt": account.Salt})
+	return account, nil
+}
+
+func ListSmartAccounts() ([]*SmartAccount, error) {
+	smartAccountsMu.Lock()
+	defer smartAccountsMu.Unlock()
+
+	return readSmartAccounts()
+}
+
+// GetSmartAccount returns a smart account with whether it is deployed on
+// chain yet and its balance there.
+func GetSmartAccount(chain *Chain, address string) (*SmartAccountStatus, error) {
+	account, err := findSmartAccount(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	sender := common.HexToAddress(account.Address)
+	deployed, err := isContract(ctx, chain, sender)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := chain.client.BalanceAt(ctx, sender, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SmartAccountStatus{
+		SmartAccount: *account,
+		ChainID:      chain.ID.Uint64(),
+		Deployed:     deployed,
+		Balance:      balance.String(),
+	}, nil
+}
+
+// SendUserOperation has a smart account call to with value and data, signed
+// by its owner and sent through the chain's bundler. Gas is paid from the
+// smart account's own balance. An account not yet deployed on chain is
+// deployed by this same operation, its initCode calling the factory.
+func SendUserOperation(chain *Chain, address, to string, value *big.Int, data []byte) (*UserOperationResult, error) {
+	if !common.IsHexAddress(to) {
+		return nil, errors.New("invalid recipient address")
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+
+	account, err := findSmartAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := accountSigner(account.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	sender := common.HexToAddress(account.Address)
+	recipient := common.HexToAddress(to)
+
+	if err := enforcePolicy(ctx, chain, sender, recipient, value); err != nil {
+		return nil, err
+	}
+
+	client, err := bundler(ctx, chain)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	callData, err := smartAccountABI.Pack("execute", recipient, value, data)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := smartAccountNonce(ctx, chain, sender)
+	if err != nil {
+		return nil, err
+	}
+	maxFee, err := chain.currentGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tip, err := chain.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tip.Cmp(maxFee) > 0 {
+		tip = maxFee
+	}
+
+	op := &userOperation{
+		Sender:               sender,
+		Nonce:                (*hexutil.Big)(nonce),
+		CallData:             callData,
+		CallGasLimit:         new(hexutil.Big),
+		VerificationGasLimit: new(hexutil.Big),
+		PreVerificationGas:   new(hexutil.Big),
+		MaxFeePerGas:         (*hexutil.Big)(maxFee),
+		MaxPriorityFeePerGas: (*hexutil.Big)(tip),
+		Signature:            dummySignature,
+	}
+
+	deployed, err := isContract(ctx, chain, sender)
+	if err != nil {
+		return nil, err
+	}
+	if !deployed {
+		if err := attachInitCode(chain, account, op); err != nil {
+			return nil, err
+		}
+	}
+
+	gas, err := estimateUserOperationGas(ctx, client, op)
+	if err != nil {
+		return nil, err
+	}
+	op.PreVerificationGas = gas.PreVerificationGas
+	op.VerificationGasLimit = gas.VerificationGasLimit
+	op.CallGasLimit = gas.CallGasLimit
+
+	// Without a paymaster the EntryPoint takes the gas up front from the
+	// account, so the balance must cover the value and the whole prefund.
+	total := new(big.Int).Add(gas.PreVerificationGas.ToInt(), gas.VerificationGasLimit.ToInt())
+	total.Add(total, gas.CallGasLimit.ToInt())
+	if err := checkFunds(ctx, chain, sender, value, total.Uint64(), maxFee); err != nil {
+		return nil, err
+	}
+
+	hash, err := userOperationHash(chain, op)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.SignHash(accounts.TextHash(hash.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	op.Signature = signature
+
+	opHash, err := sendUserOperation(ctx, client, op)
+	if err != nil {
+		return nil, err
+	}
+
+	recordSend(sender, value)
+	learnSpending(sender, recipient, value)
+
+	result := &UserOperationResult{Hash: opHash.Hex(), Sender: sender.Hex(), Nonce: nonce.String(), Deploys: !deployed}
+	recordAudit("smart_account.user_operation", fmt.Sprintf("user operation from %s to %s", result.Sender, recipient.Hex()),
+		map[string]interface{}{"user_op_hash": result.Hash, "sender": result.Sender, "to": recipient.Hex(),
+			"value": value.String(), "chain_id": chain.ID.Uint64(), "deploys": result.Deploys})
+	return result, nil
+}
+
+// GetUserOperationReceipt returns the receipt of a UserOperation from the
+// chain's bundler, or nil while it is not yet included.
+func GetUserOperationReceipt(chain *Chain, hash string) (*UserOperationReceipt, error) {
+	ctx := context.Background()
+	client, err := bundler(ctx, chain)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return userOperationReceipt(ctx, client, common.HexToHash(hash))
+}
+
+// attachInitCode sets the factory call that deploys account. The factory
+// is asked for the address first: if it differs on this chain the
+// operation would deploy some other account and fail validation, with the
+// funds at the recorded address out of reach.
+func attachInitCode(chain *Chain, account *SmartAccount, op *userOperation) error {
+	factory := common.HexToAddress(account.Factory)
+	owner := common.HexToAddress(account.Owner)
+	salt, ok := new(big.Int).SetString(account.Salt, 10)
+	if !ok {
+		return fmt.Errorf("invalid salt %q", account.Salt)
+	}
+
+	address, err := counterfactualAddress(chain, factory, owner, salt)
+	if err != nil {
+		return err
+	}
+	if address != op.Sender {
+		return fmt.Errorf("%w: the factory gives %s on chain %s", ErrSmartAccountMismatch, address.Hex(), chain.ID)
+	}
+
+	factoryData, err := smartAccountFactoryABI.Pack("createAccount", owner, salt)
+	if err != nil {
+		return err
+	}
+	op.Factory = &factory
+	op.FactoryData = factoryData
+	return nil
+}
+
+func counterfactualAddress(chain *Chain, factory, owner common.Address, salt *big.Int) (common.Address, error) {
+	code, err := chain.client.CodeAt(context.Background(), factory, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(code) == 0 {
+		return common.Address{}, fmt.Errorf("%w: no smart account factory at %s on chain %s", ErrSmartAccountsUnavailable, factory.Hex(), chain.ID)
+	}
+
+	out, err := callContract(chain, factory, smartAccountFactoryABI, "getAddress", owner, salt)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return out[0].(common.Address), nil
+}
+
+// smartAccountNonce reads the EntryPoint nonce uncached, as a cached read
+// could hand two operations sent in quick succession the same nonce.
+func smartAccountNonce(ctx context.Context, chain *Chain, sender common.Address) (*big.Int, error) {
+	contract := entryPoint()
+	data, err := entryPointABI.Pack("getNonce", sender, new(big.Int))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := chain.client.Client.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	out, err := entryPointABI.Unpack("getNonce", result)
+	if err != nil {
+		return nil, err
+	}
+
+	return out[0].(*big.Int), nil
+}
+
+// userOperationHash is the hash the account signs, as the v0.7 EntryPoint
+// computes it from the packed operation.
+func userOperationHash(chain *Chain, op *userOperation) (common.Hash, error) {
+	var initCode []byte
+	if op.Factory != nil {
+		initCode = append(op.Factory.Bytes(), op.FactoryData...)
+	}
+
+	bytes32, _ := abi.NewType("bytes32", "", nil)
+	uint256, _ := abi.NewType("uint256", "", nil)
+	address, _ := abi.NewType("address", "", nil)
+
+	packed, err := abi.Arguments{
+		{Type: address}, {Type: uint256}, {Type: bytes32}, {Type: bytes32},
+		{Type: bytes32}, {Type: uint256}, {Type: bytes32}, {Type: bytes32},
+	}.Pack(
+		op.Sender,
+		op.Nonce.ToInt(),
+		crypto.Keccak256Hash(initCode),
+		crypto.Keccak256Hash(op.CallData),
+		packUint128s(op.VerificationGasLimit.ToInt(), op.CallGasLimit.ToInt()),
+		op.PreVerificationGas.ToInt(),
+		packUint128s(op.MaxPriorityFeePerGas.ToInt(), op.MaxFeePerGas.ToInt()),
+		crypto.Keccak256Hash(nil),
+	)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	encoded, err := abi.Arguments{{Type: bytes32}, {Type: address}, {Type: uint256}}.Pack(
+		crypto.Keccak256Hash(packed), entryPoint(), chain.ID)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// packUint128s packs two 128-bit values into one word, high first.
+func packUint128s(high, low *big.Int) [32]byte {
+	var word [32]byte
+	high.FillBytes(word[:16])
+	low.FillBytes(word[16:])
+	return word
+}
+
+func nextSmartAccountSalt(stored []*SmartAccount, owner, factory common.Address) *big.Int {
+	salt := new(big.Int)
+	for _, account := range stored {
+		if common.HexToAddress(account.Owner) != owner || common.HexToAddress(account.Factory) != factory {
+			continue
+		}
+		if used, ok := new(big.Int).SetString(account.Salt, 10); ok && used.Cmp(salt) >= 0 {
+			salt = used.Add(used, big.NewInt(1))
+		}
+	}
+
+	return salt
+}
+
+func entryPoint() common.Address {
+	if raw := os.Getenv("ENTRYPOINT_ADDRESS"); common.IsHexAddress(raw) {
+		return common.HexToAddress(raw)
+	}
+
+	return common.HexToAddress(entryPointAddress)
+}
+
+func smartAccountFactory() common.Address {
+	if raw := os.Getenv("SMART_ACCOUNT_FACTORY"); common.IsHexAddress(raw) {
+		return common.HexToAddress(raw)
+	}
+
+	return common.HexToAddress(smartAccountFactoryAddress)
+}
+
+func findSmartAccount(address string) (*SmartAccount, error) {
+	smartAccountsMu.Lock()
+	defer smartAccountsMu.Unlock()
+
+	stored, err := readSmartAccounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range stored {
+		if strings.EqualFold(account.Address, address) {
+			return account, nil
+		}
+	}
+
+	return nil, ErrSmartAccountNotFound
+}
+
+// setSmartAccountOwner records a smart account's new owner once a recovery
+// has rotated it on chain, so that later operations are signed by it.
+func setSmartAccountOwner(address, owner string) error {
+	smartAccountsMu.Lock()
+	defer smartAccountsMu.Unlock()
+
+	stored, err := readSmartAccounts()
+	if err != nil {
+		return err
+	}
+	for _, account := range stored {
+		if strings.EqualFold(account.Address, address) {
+			account.Owner = common.HexToAddress(owner).Hex()
+			return writeJSONFile(smartAccountsFile, stored)
+		}
+	}
+
+	return ErrSmartAccountNotFound
+}
+
+func readSmartAccounts() ([]*SmartAccount, error) {
+	var stored []*SmartAccount
+	if err := readJSONFile(smartAccountsFile, &stored); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return stored, nil
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// Snapshot is the wallet's accounts as they stood at one block: each
+// balance and nonce read at that block, and the transactions the wallet
+// had sent that were not mined by it. It holds nothing that changes after
+// the block, so the same block and accounts always give the same snapshot,
+// and Digest, a SHA-256 over the rest, identifies it. Total is the sum of
+// the balances in wei.
+type Snapshot struct {
+	ChainID     uint64             `json:"chain_id"`
+	BlockNumber uint64             `json:"block_number"`
+	BlockHash   string             `json:"block_hash"`
+	BlockTime   time.Time          `json:"block_time"`
+	Accounts    []*AccountSnapshot `json:"accounts"`
+	Total       string             `json:"total"`
+	Digest      string             `json:"digest"`
+}
+
+// AccountSnapshot is one account in a snapshot, with its balance in wei.
+type AccountSnapshot struct {
+	Address string                `json:"address"`
+	Balance string                `json:"balance"`
+	Nonce   uint64                `json:"nonce"`
+	Pending []SnapshotTransaction `json:"pending"`
+}
+
+// SnapshotTransaction is a transaction the wallet had sent, and had not
+// seen mined, as of a snapshot's block.
+type SnapshotTransaction struct {
+	Hash  string `json:"hash"`
+	Nonce uint64 `json:"nonce"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+}
+
+// SnapshotDiff is what changed between two snapshots of the same chain.
+// Accounts lists only those that changed and are in both; Added and
+// Removed are those in only one of them.
+type SnapshotDiff struct {
+	ChainID     uint64           `json:"chain_id"`
+	FromBlock   uint64           `json:"from_block"`
+	ToBlock     uint64           `json:"to_block"`
+	FromDigest  string           `json:"from_digest"`
+	ToDigest    string           `json:"to_digest"`
+	TotalChange string           `json:"total_change"`
+	Accounts    []*AccountChange `json:"accounts"`
+	Added       []string         `json:"added"`
+	Removed     []string         `json:"removed"`
+	Unchanged   int              `json:"unchanged"`
+}
+
+// AccountChange is one account's difference between two snapshots.
+// Settled are the transactions pending in the first that are not in the
+// second, mined or dropped in between; NewlyPending the reverse.
+type AccountChange struct {
+	Address       string   `json:"address"`
+	BalanceBefore string   `json:"balance_before"`
+	BalanceAfter  string   `json:"balance_after"`
+	BalanceChange string   `json:"balance_change"`
+	NonceBefore   uint64   `json:"nonce_before"`
+	NonceAfter    uint64   `json:"nonce_after"`
+	Settled       []string `json:"settled"`
+	NewlyPending  []string `json:"newly_pending"`
+}
+
+// TakeSnapshot snapshots addresses, or every account in the wallet if none
+// are given, at block, or the latest block if nil. A block older than the
+// node keeps state for fails, unless it is an archive node.
+func TakeSnapshot(chain *Chain, addresses []string, block *big.Int) (*Snapshot, error) {
+	ctx := context.Background()
+
+	if len(addresses) == 0 {
+		accounts, _, err := ListAccounts()
+		if err != nil {
+			return nil, err
+		}
+		for _, account := range accounts {
+			addresses = append(addresses, account.Address)
+		}
+	}
+	seen := map[common.Address]bool{}
+	var accounts []common.Address
+	for _, address := range addresses {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("%w: %q is not an address", ErrInvalidSnapshot, address)
+		}
+		if addr := common.HexToAddress(address); !seen[addr] {
+			seen[addr] = true
+			accounts = append(accounts, addr)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Hex() < accounts[j].Hex() })
+
+	// Every read is made at the number of the block, so a snapshot of the
+	// latest block does not straddle a new one.
+	header, err := chain.client.HeaderByNumber(ctx, block)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, fmt.Errorf("block %s: %w", block, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	number := header.Number
+	blockTime := time.Unix(int64(header.Time), 0).UTC()
+
+	records, err := ListTransactions(TransactionFilter{ChainID: chain.ID.Uint64(), Until: blockTime})
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		ChainID:     chain.ID.Uint64(),
+		BlockNumber: number.Uint64(),
+		BlockHash:   header.Hash().Hex(),
+		BlockTime:   blockTime,
+		Accounts:    []*AccountSnapshot{},
+	}
+	total := new(big.Int)
+	for _, account := range accounts {
+		balance, err := chain.client.BalanceAt(ctx, account, number)
+		if err != nil {
+			return nil, err
+		}
+		nonce, err := chain.client.NonceAt(ctx, account, number)
+		if err != nil {
+			return nil, err
+		}
+		total.Add(total, balance)
+
+		entry := &AccountSnapshot{
+			Address: account.Hex(),
+			Balance: balance.String(),
+			Nonce:   nonce,
+			Pending: []SnapshotTransaction{},
+		}
+		// A transaction was outstanding at the block if it was sent by then
+		// and its nonce was not yet used. Records kept before nonces were
+		// cannot be placed and are left out.
+		for _, record := range records {
+			if record.Nonce == nil || *record.Nonce < nonce || common.HexToAddress(record.From) != account {
+				continue
+			}
+			entry.Pending = append(entry.Pending, SnapshotTransaction{
+				Hash:  record.Hash,
+				Nonce: *record.Nonce,
+				To:    record.To,
+				Value: record.Value,
+			})
+		}
+		sort.Slice(entry.Pending, func(i, j int) bool {
+			if entry.Pending[i].Nonce != entry.Pending[j].Nonce {
+				return entry.Pending[i].Nonce < entry.Pending[j].Nonce
+			}
+			return entry.Pending[i].Hash < entry.Pending[j].Hash
+		})
+		snapshot.Accounts = append(snapshot.Accounts, entry)
+	}
+	snapshot.Total = total.String()
+
+	if snapshot.Digest, err = snapshot.digest(); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// DiffSnapshots compares two snapshots of the same chain, each checked
+// against its digest so that an edited one is not reconciled.
+func DiffSnapshots(before, after *Snapshot) (*SnapshotDiff, error) {
+	for _, snapshot := range []*Snapshot{before, after} {
+		if snapshot == nil {
+			return nil, fmt.Errorf("%w: two snapshots are required", ErrInvalidSnapshot)
+		}
+		digest, err := snapshot.digest()
+		if err != nil {
+			return nil, err
+		}
+		if digest != snapshot.Digest {
+			return nil, fmt.Errorf("%w: the snapshot of block %d does not match its digest", ErrInvalidSnapshot, snapshot.BlockNumber)
+		}
+	}
+	if before.ChainID != after.ChainID {
+		return nil, fmt.Errorf("%w: the snapshots are of chains %d and %d", ErrInvalidSnapshot, before.ChainID, after.ChainID)
+	}
+
+	diff := &SnapshotDiff{
+		ChainID:    before.ChainID,
+		FromBlock:  before.BlockNumber,
+		ToBlock:    after.BlockNumber,
+		FromDigest: before.Digest,
+		ToDigest:   after.Digest,
+		Accounts:   []*AccountChange{},
+		Added:      []string{},
+		Removed:    []string{},
+	}
+	totalBefore, ok := new(big.Int).SetString(before.Total, 10)
+	if !ok {
+		return nil, fmt.Errorf("%w: total %q is not a wei amount", ErrInvalidSnapshot, before.Total)
+	}
+	totalAfter, ok := new(big.Int).SetString(after.Total, 10)
+	if !ok {
+		return nil, fmt.Errorf("%w: total %q is not a wei amount", ErrInvalidSnapshot, after.Total)
+	}
+	diff.TotalChange = new(big.Int).Sub(totalAfter, totalBefore).String()
+
+	earlier := map[string]*AccountSnapshot{}
+	for _, account := range before.Accounts {
+		earlier[account.Address] = account
+	}
+	for _, account := range after.Accounts {
+		previous, ok := earlier[account.Address]
+		if !ok {
+			diff.Added = append(diff.Added, account.Address)
+			continue
+		}
+		delete(earlier, account.Address)
+
+		change, err := diffAccount(previous, account)
+		if err != nil {
+			return nil, err
+		}
+		if change == nil {
+			diff.Unchanged++
+			continue
+		}
+		diff.Accounts = append(diff.Accounts, change)
+	}
+	for address := range earlier {
+		diff.Removed = append(diff.Removed, address)
+	}
+	sort.Strings(diff.Removed)
+
+	return diff, nil
+}
+
+// diffAccount returns how an account changed, or nil if it did not.
+func diffAccount(before, after *AccountSnapshot) (*AccountChange, error) {
+	balanceBefore, ok := new(big.Int).SetString(before.Balance, 10)
+	if !ok {
+		return nil, fmt.Errorf("%w: balance %q is not a wei amount", ErrInvalidSnapshot, before.Balance)
+	}
+	balanceAfter, ok := new(big.Int).SetString(after.Balance, 10)
+	if !ok {
+		return nil, fmt.Errorf("%w: balance %q is not a wei amount", ErrInvalidSnapshot, after.Balance)
+	}
+
+	change := &AccountChange{
+		Address:       after.Address,
+		BalanceBefore: before.Balance,
+		BalanceAfter:  after.Balance,
+		BalanceChange: new(big.Int).Sub(balanceAfter, balanceBefore).String(),
+		NonceBefore:   before.Nonce,
+		NonceAfter:    after.Nonce,
+		Settled:       pendingOnlyIn(before, after),
+		NewlyPending:  pendingOnlyIn(after, before),
+	}
+	if balanceBefore.Cmp(balanceAfter) == 0 && before.Nonce == after.Nonce &&
+		len(change.Settled) == 0 && len(change.NewlyPending) == 0 {
+		return nil, nil
+	}
+
+	return change, nil
+}
+
+// pendingOnlyIn lists the hashes pending in one snapshot of an account and
+// not in the other.
+func pendingOnlyIn(account, other *AccountSnapshot) []string {
+	in := map[string]bool{}
+	for _, tx := range other.Pending {
+		in[tx.Hash] = true
+	}
+
+	hashes := []string{}
+	for _, tx := range account.Pending {
+		if !in[tx.Hash] {
+			hashes = append(hashes, tx.Hash)
+		}
+	}
+
+	return hashes
+}
+
+// digest hashes the snapshot without its digest. Its fields marshal in a
+// fixed order and its lists are sorted, so the JSON is the same each time.
+func (s *Snapshot) digest() (string, error) {
+	unsigned := *s
+	unsigned.Digest = ""
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+
+	return fmt.Sprintf("0x%x", sum), nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Statement is an account's transactions on a chain over a period, made by
+// a statement job. Sent and Received total the value of the transactions
+// that did not fail; Balance is the confirmed balance when it was made.
+type Statement struct {
+	ID           string              `json:"id"`
+	JobID        string              `json:"job_id,omitempty"`
+	Account      string              `json:"account"`
+	ChainID      uint64              `json:"chain_id"`
+	From         time.Time           `json:"from"`
+	Until        time.Time           `json:"until"`
+	Balance      string              `json:"balance"`
+	Sent         string              `json:"sent"`
+	Received     string              `json:"received"`
+	Count        int                 `json:"transaction_count"`
+	Transactions []TransactionRecord `json:"transactions,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
+
+var (
+	statementsFile = "statements.json"
+	statementsMu   sync.Mutex
+)
+
+var ErrStatementNotFound = errors.New("statement not found")
+
+func createStatement(job *Job, from, until time.Time) (*Statement, error) {
+	chain, err := chainByID(context.Background(), job.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := chain.client.BalanceAt(context.Background(), common.HexToAddress(job.Account), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := ListTransactions(TransactionFilter{ChainID: job.ChainID, Address: job.Account, Since: from, Until: until})
+	if err != nil {
+		return nil, err
+	}
+
+	sent, received := new(big.Int), new(big.Int)
+	for _, record := range records {
+		value, ok := new(big.Int).SetString(record.Value, 10)
+		if !ok || record.Status == StatusFailed {
+			continue
+		}
+		if strings.EqualFold(record.From, job.Account) {
+			sent.Add(sent, value)
+		}
+		if strings.EqualFold(record.To, job.Account) {
+			received.Add(received, value)
+		}
+	}
+
+	statement := &Statement{
+		ID:           newID(),
+		JobID:        job.ID,
+		Account:      job.Account,
+		ChainID:      job.ChainID,
+		From:         from.UTC(),
+		Until:        until.UTC(),
+		Balance:      balance.String(),
+		Sent:         sent.String(),
+		Received:     received.String(),
+		Count:        len(records),
+		Transactions: records,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	statementsMu.Lock()
+	defer statementsMu.Unlock()
+
+	statements, err := readStatements()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeJSONFile(statementsFile, append(statements, statement)); err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+// ListStatements lists statements newest first, without their
+// transactions, optionally only those made by one job.
+func ListStatements(jobID string) ([]Statement, error) {
+	statementsMu.Lock()
+	defer statementsMu.Unlock()
+
+	statements, err := readStatements()
+	if err != nil {
+		return nil, err
+	}
+
+	listed := []Statement{}
+	for _, statement := range statements {
+		if jobID != "" && statement.JobID != jobID {
+			continue
+		}
+		summary := *statement
+		summary.Transactions = nil
+		listed = append(listed, summary)
+	}
+
+	sort.Slice(listed, func(i, j int) bool {
+		return listed[i].CreatedAt.After(listed[j].CreatedAt)
+	})
+
+	return listed, nil
+}
+
+func GetStatement(id string) (*Statement, error) {
+	statementsMu.Lock()
+	defer statementsMu.Unlock()
+
+	statements, err := readStatements()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statement := range statements {
+		if statement.ID == id {
+			return statement, nil
+		}
+	}
+
+	return nil, ErrStatementNotFound
+}
+
+func readStatements() ([]*Statement, error) {
+	var statements []*Statement
+	if err := readJSONFile(statementsFile, &statements); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return statements, nil
+}
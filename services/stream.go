@@ -0,0 +1,413 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Topics a stream can subscribe to.
+const (
+	TopicNewHeads     = "new_heads"
+	TopicIncoming     = "incoming"
+	TopicTransactions = "transactions"
+
+	// headPollInterval is how often a chain whose endpoint has no
+	// subscriptions is asked for its latest block.
+	headPollInterval = 5 * time.Second
+	// maxHeadCatchUp bounds how many blocks missed between polls are
+	// scanned for incoming transactions.
+	maxHeadCatchUp = 32
+	// streamBuffer is how many messages a subscriber may fall behind by
+	// before it is dropped.
+	streamBuffer = 256
+)
+
+var ErrInvalidSubscription = errors.New("invalid subscription")
+
+// StreamMessage is one message on a stream.
+type StreamMessage struct {
+	Topic   string      `json:"topic"`
+	ChainID uint64      `json:"chain_id,omitempty"`
+	Data    interface{} `json:"data"`
+}
+
+// StreamHead is a new block.
+type StreamHead struct {
+	Number     uint64 `json:"number"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parent_hash"`
+	Timestamp  uint64 `json:"timestamp"`
+	BaseFee    string `json:"base_fee,omitempty"`
+	GasUsed    uint64 `json:"gas_used"`
+	GasLimit   uint64 `json:"gas_limit"`
+}
+
+// IncomingTransaction is a transaction to one of the wallet's accounts,
+// pending or in a new block.
+type IncomingTransaction struct {
+	Hash        string `json:"hash"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Value       string `json:"value"`
+	Pending     bool   `json:"pending"`
+	BlockNumber uint64 `json:"block_number,omitempty"`
+}
+
+// Subscription receives the messages of its topics on C until it is closed,
+// or until it falls streamBuffer messages behind, when C is closed for it.
+type Subscription struct {
+	C <-chan StreamMessage
+
+	messages chan StreamMessage
+	chainID  uint64
+	topics   map[string]bool
+	// accounts limit incoming transactions and transaction events to
+	// these; empty means all the wallet's accounts.
+	accounts map[common.Address]bool
+	watches  bool
+	once     sync.Once
+}
+
+// headWatcher follows one chain's blocks for as long as any subscriber
+// wants its heads or incoming transactions.
+type headWatcher struct {
+	subscribers int
+	cancel      context.CancelFunc
+}
+
+var (
+	streamsMu    sync.Mutex
+	streams      = map[*Subscription]bool{}
+	headWatchers = map[uint64]*headWatcher{}
+)
+
+// Subscribe opens a stream of topics on chain. accounts, if any, narrow
+// incoming transactions and transaction events to those addresses.
+func Subscribe(chain *Chain, topics, accounts []string) (*Subscription, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("%w: at least one topic of %s, %s or %s is required", ErrInvalidSubscription, TopicNewHeads, TopicIncoming, TopicTransactions)
+	}
+
+	messages := make(chan StreamMessage, streamBuffer)
+	s := &Subscription{
+		C:        messages,
+		messages: messages,
+		chainID:  chain.ID.Uint64(),
+		topics:   map[string]bool{},
+		accounts: map[common.Address]bool{},
+	}
+	for _, topic := range topics {
+		switch topic {
+		case TopicNewHeads, TopicIncoming:
+			s.watches = true
+		case TopicTransactions:
+		default:
+			return nil, fmt.Errorf("%w: unknown topic %q", ErrInvalidSubscription, topic)
+		}
+		s.topics[topic] = true
+	}
+	for _, account := range accounts {
+		if !common.IsHexAddress(account) {
+			return nil, fmt.Errorf("%w: invalid account address %q", ErrInvalidSubscription, account)
+		}
+		s.accounts[common.HexToAddress(account)] = true
+	}
+
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+
+	streams[s] = true
+	if s.watches {
+		watcher := headWatchers[s.chainID]
+		if watcher == nil {
+			ctx, cancel := context.WithCancel(context.Background())
+			watcher = &headWatcher{cancel: cancel}
+			headWatchers[s.chainID] = watcher
+			go watchHeads(ctx, s.chainID)
+		}
+		watcher.subscribers++
+	}
+
+	return s, nil
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+
+	s.closeLocked()
+}
+
+func (s *Subscription) closeLocked() {
+	s.once.Do(func() {
+		delete(streams, s)
+		close(s.messages)
+
+		if watcher := headWatchers[s.chainID]; s.watches && watcher != nil {
+			watcher.subscribers--
+			if watcher.subscribers == 0 {
+				watcher.cancel()
+				delete(headWatchers, s.chainID)
+			}
+		}
+	})
+}
+
+func (s *Subscription) wants(topic string, chainID uint64, addresses []common.Address) bool {
+	if !s.topics[topic] || s.chainID != chainID {
+		return false
+	}
+	if len(s.accounts) == 0 || topic == TopicNewHeads {
+		return true
+	}
+	for _, address := range addresses {
+		if s.accounts[address] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// publish hands a message to every subscriber that wants it, dropping any
+// that has stopped keeping up rather than holding everyone else back.
+func publish(message StreamMessage, addresses ...common.Address) {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+
+	for s := range streams {
+		if !s.wants(message.Topic, message.ChainID, addresses) {
+			continue
+		}
+		select {
+		case s.messages <- message:
+		default:
+			log.Printf("stream: dropping a subscriber %d messages behind", streamBuffer)
+			s.closeLocked()
+		}
+	}
+}
+
+// publishTransactionEvent streams an event about a transaction in the
+// history as it leaves the outbox.
+func publishTransactionEvent(event *WebhookEvent) {
+	addresses := make([]common.Address, 0, len(event.Accounts))
+	for _, account := range event.Accounts {
+		addresses = append(addresses, common.HexToAddress(account))
+	}
+
+	publish(StreamMessage{Topic: TopicTransactions, ChainID: event.ChainID, Data: event}, addresses...)
+}
+
+func wantsTopic(chainID uint64, topic string) bool {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+
+	for s := range streams {
+		if s.chainID == chainID && s.topics[topic] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watchHeads follows a chain until ctx is done, by subscription where the
+// endpoint has them and by polling otherwise, looking the chain up again
+// whenever a reload retires it.
+func watchHeads(ctx context.Context, chainID uint64) {
+	for ctx.Err() == nil {
+		chain, err := chainByID(ctx, chainID)
+		if err == nil {
+			err = chain.followHeads(ctx)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("stream: chain %d: %v", chainID, err)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(headPollInterval):
+		}
+	}
+}
+
+func (c *Chain) followHeads(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go c.followPending(ctx)
+
+	heads := make(chan *types.Header)
+	sub, err := c.client.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return c.pollHeads(ctx)
+	}
+	defer sub.Unsubscribe()
+
+	retired := time.NewTicker(headPollInterval)
+	defer retired.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-sub.Err():
+			return err
+		case <-retired.C:
+			if c.retired.Load() {
+				return nil
+			}
+		case header := <-heads:
+			c.announceHead(ctx, header)
+		}
+	}
+}
+
+func (c *Chain) pollHeads(ctx context.Context) error {
+	ticker := time.NewTicker(headPollInterval)
+	defer ticker.Stop()
+
+	var last uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if c.retired.Load() {
+			return nil
+		}
+
+		header, err := c.client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return err
+		}
+		number := header.Number.Uint64()
+		if number <= last {
+			continue
+		}
+
+		// Blocks mined between polls are scanned too, up to a limit.
+		if last > 0 && number-last > 1 {
+			from := last + 1
+			if number-from > maxHeadCatchUp {
+				from = number - maxHeadCatchUp
+			}
+			for missed := from; missed < number; missed++ {
+				c.scanIncoming(ctx, missed)
+			}
+		}
+		c.announceHead(ctx, header)
+		last = number
+	}
+}
+
+func (c *Chain) announceHead(ctx context.Context, header *types.Header) {
+	head := StreamHead{
+		Number:     header.Number.Uint64(),
+		Hash:       header.Hash().Hex(),
+		ParentHash: header.ParentHash.Hex(),
+		Timestamp:  header.Time,
+		GasUsed:    header.GasUsed,
+		GasLimit:   header.GasLimit,
+	}
+	if header.BaseFee != nil {
+		head.BaseFee = header.BaseFee.String()
+	}
+	publish(StreamMessage{Topic: TopicNewHeads, ChainID: c.ID.Uint64(), Data: head})
+
+	c.scanIncoming(ctx, head.Number)
+}
+
+// scanIncoming streams the transactions of a block that pay the wallet's
+// accounts, if anyone is listening for them.
+func (c *Chain) scanIncoming(ctx context.Context, number uint64) {
+	if !wantsTopic(c.ID.Uint64(), TopicIncoming) {
+		return
+	}
+	accounts, err := walletAddresses()
+	if err != nil || len(accounts) == 0 {
+		return
+	}
+
+	block, err := c.client.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		log.Printf("stream: chain %d: block %d: %v", c.ID.Uint64(), number, err)
+		return
+	}
+	for _, tx := range block.Transactions() {
+		c.announceIncoming(tx, accounts, number)
+	}
+}
+
+// followPending streams pending transactions to the wallet's accounts where
+// the endpoint can subscribe to full pending transactions. Elsewhere only
+// mined ones are seen.
+func (c *Chain) followPending(ctx context.Context) {
+	pending := make(chan *types.Transaction)
+	sub, err := c.client.Client.Client().EthSubscribe(ctx, pending, "newPendingTransactions", true)
+	if err != nil {
+		return
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Err():
+			return
+		case tx := <-pending:
+			if !wantsTopic(c.ID.Uint64(), TopicIncoming) {
+				continue
+			}
+			if accounts, err := walletAddresses(); err == nil {
+				c.announceIncoming(tx, accounts, 0)
+			}
+		}
+	}
+}
+
+func (c *Chain) announceIncoming(tx *types.Transaction, accounts map[common.Address]bool, number uint64) {
+	if tx.To() == nil || !accounts[*tx.To()] {
+		return
+	}
+	from, err := types.Sender(c.signer(), tx)
+	if err != nil {
+		return
+	}
+
+	publish(StreamMessage{Topic: TopicIncoming, ChainID: c.ID.Uint64(), Data: IncomingTransaction{
+		Hash:        tx.Hash().Hex(),
+		From:        from.Hex(),
+		To:          tx.To().Hex(),
+		Value:       tx.Value().String(),
+		Pending:     number == 0,
+		BlockNumber: number,
+	}}, *tx.To())
+}
+
+func walletAddresses() (map[common.Address]bool, error) {
+	accounts, _, err := ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make(map[common.Address]bool, len(accounts))
+	for _, account := range accounts {
+		if common.IsHexAddress(account.Address) {
+			addresses[common.HexToAddress(account.Address)] = true
+		}
+	}
+
+	return addresses, nil
+}
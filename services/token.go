@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const erc20ABIJSON = `[
+	{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"symbol","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+	{"type":"function","name":"totalSupply","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"allowance","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"approve","stateMutability":"nonpayable","inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"transfer","stateMutability":"nonpayable","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"transferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"event","name":"Transfer","anonymous":false,"inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Approval","anonymous":false,"inputs":[{"name":"owner","type":"address","indexed":true},{"name":"spender","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}
+]`
+
+var erc20ABI = mustParseABI(erc20ABIJSON)
+
+var (
+	ErrInvalidTokenAddress = errors.New("invalid token address")
+	ErrInvalidTokenOwner   = errors.New("invalid owner address")
+)
+
+// AllowanceError is returned when a transferFrom would exceed what the owner
+// has approved (or holds), so callers can report the shortfall.
+type AllowanceError struct {
+	Reason    string
+	Available *big.Int
+	Required  *big.Int
+}
+
+func (e *AllowanceError) Error() string {
+	return fmt.Sprintf("%s: available %s, required %s", e.Reason, e.Available, e.Required)
+}
+
+// TokenInfo is an ERC-20 token's metadata. The total supply is given in base
+// units and in whole tokens.
+type TokenInfo struct {
+	Token              string `json:"token"`
+	ChainID            uint64 `json:"chain_id"`
+	Name               string `json:"name,omitempty"`
+	Symbol             string `json:"symbol"`
+	Decimals           uint8  `json:"decimals"`
+	TotalSupply        string `json:"total_supply,omitempty"`
+	DisplayTotalSupply string `json:"display_total_supply,omitempty"`
+}
+
+// TokenBalance is what an owner holds of a token, in base units and in
+// whole tokens.
+type TokenBalance struct {
+	Token          string `json:"token"`
+	ChainID        uint64 `json:"chain_id"`
+	Owner          string `json:"owner"`
+	Symbol         string `json:"symbol"`
+	Decimals       uint8  `json:"decimals"`
+	Balance        string `json:"balance"`
+	DisplayBalance string `json:"display_balance"`
+}
+
+func GetTokenInfo(chain *Chain, token string) (*TokenInfo, error) {
+	if !common.IsHexAddress(token) {
+		return nil, ErrInvalidTokenAddress
+	}
+	tokenAddress := common.HexToAddress(token)
+
+	info, err := tokenMetadata(chain, tokenAddress)
+	if err != nil {
+		return nil, err
+	}
+	supply, err := tokenUint(chain, tokenAddress, "totalSupply")
+	if err != nil {
+		return nil, fmt.Errorf("%w: totalSupply() failed: %v", ErrNotERC20, err)
+	}
+	info.TotalSupply = supply.String()
+	info.DisplayTotalSupply = FormatTokenAmount(supply, info.Decimals)
+
+	return info, nil
+}
+
+func GetTokenBalance(chain *Chain, token, owner string) (*TokenBalance, error) {
+	if !common.IsHexAddress(token) {
+		return nil, ErrInvalidTokenAddress
+	}
+	if !common.IsHexAddress(owner) {
+		return nil, ErrInvalidTokenOwner
+	}
+	tokenAddress := common.HexToAddress(token)
+	holder := common.HexToAddress(owner)
+
+	info, err := tokenMetadata(chain, tokenAddress)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := tokenUint(chain, tokenAddress, "balanceOf", holder)
+	if err != nil {
+		return nil, fmt.Errorf("%w: balanceOf() failed: %v", ErrNotERC20, err)
+	}
+
+	return &TokenBalance{
+		Token:          info.Token,
+		ChainID:        info.ChainID,
+		Owner:          holder.Hex(),
+		Symbol:         info.Symbol,
+		Decimals:       info.Decimals,
+		Balance:        balance.String(),
+		DisplayBalance: FormatTokenAmount(balance, info.Decimals),
+	}, nil
+}
+
+func TokenAllowance(chain *Chain, token, owner, spender string) (*big.Int, error) {
+	if !common.IsHexAddress(token) {
+		return nil, ErrInvalidTokenAddress
+	}
+	if !common.IsHexAddress(owner) || !common.IsHexAddress(spender) {
+		return nil, errors.New("invalid owner or spender address")
+	}
+
+	return tokenUint(chain, common.HexToAddress(token), "allowance", common.HexToAddress(owner), common.HexToAddress(spender))
+}
+
+// TransferFromERC20 pulls amount of token from an owner that has approved the
+// selected account as spender. The token, allowance and balance are checked
+// and the pull is simulated up front so a doomed pull is never broadcast.
+func TransferFromERC20(chain *Chain, token, from, to string, amount TokenAmount, guard ReceiveGuard) (string, *TokenCheck, error) {
+	if !common.IsHexAddress(token) {
+		return "", nil, ErrInvalidTokenAddress
+	}
+	if !common.IsHexAddress(from) || !common.IsHexAddress(to) {
+		return "", nil, errors.New("invalid from or to address")
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		return "", nil, err
+	}
+
+	tokenAddress := common.HexToAddress(token)
+	owner := common.HexToAddress(from)
+	recipient := common.HexToAddress(to)
+	spender := signer.Address()
+
+	check, err := inspectToken(chain, tokenAddress, owner, amount)
+	if err != nil {
+		return "", nil, err
+	}
+
+	allowance, err := tokenUint(chain, tokenAddress, "allowance", owner, spender)
+	if err != nil {
+		return "", nil, err
+	}
+	if allowance.Cmp(check.amount) < 0 {
+		return "", nil, &AllowanceError{Reason: "insufficient allowance", Available: allowance, Required: check.amount}
+	}
+	if check.balance.Cmp(check.amount) < 0 {
+		return "", nil, &AllowanceError{Reason: "insufficient owner balance", Available: check.balance, Required: check.amount}
+	}
+
+	data, err := erc20ABI.Pack("transferFrom", owner, recipient, check.amount)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := simulateTokenTransfer(chain, check, spender, owner, recipient, data); err != nil {
+		return "", nil, err
+	}
+	if err := check.enforce(guard); err != nil {
+		return "", nil, err
+	}
+
+	txHash, err := sendContractTransaction(chain, signer, tokenAddress, big.NewInt(0), data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return txHash, check, nil
+}
+
+func tokenUint(chain *Chain, token common.Address, method string, args ...interface{}) (*big.Int, error) {
+	out, err := callContract(chain, token, erc20ABI, method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := out[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("unexpected %s result", method)
+	}
+
+	return value, nil
+}
+
+func callContract(chain *Chain, contract common.Address, parsed abi.ABI, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := parsed.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := chain.client.CallContract(context.Background(), ethereum.CallMsg{To: &contract, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := parsed.Unpack(method, result)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s returned no data", method)
+	}
+
+	return out, nil
+}
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
@@ -0,0 +1,554 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Codes of the warnings a token check can return.
+const (
+	WarningFeeOnTransfer         = "fee_on_transfer"
+	WarningRebasing              = "rebasing"
+	WarningNoTransferEvent       = "no_transfer_event"
+	WarningMissingReturnValue    = "missing_return_value"
+	WarningRecipientIsToken      = "recipient_is_token"
+	WarningRecipientIsContract   = "recipient_is_contract"
+	WarningSimulationUnavailable = "simulation_unavailable"
+)
+
+var (
+	ErrTokenNoCode         = errors.New("token has no contract code; it was never deployed or has self-destructed")
+	ErrNotERC20            = errors.New("contract does not implement ERC-20")
+	ErrAmountPrecision     = errors.New("amount has more decimal places than the token supports")
+	ErrTransferWouldRevert = errors.New("token transfer would fail")
+	ErrInvalidSlippage     = errors.New("max_slippage_bps must be between 0 and 10000")
+	ErrReceivedUnverified  = errors.New("the amount received could not be simulated, so the minimum-received guard cannot be enforced")
+)
+
+// TokenAmount is an amount in base units, or in whole tokens (such as "1.5")
+// when Display is set, in which case it is converted with the token's
+// decimals.
+type TokenAmount struct {
+	Base    *big.Int
+	Display string
+}
+
+// ReceiveGuard sets the least the recipient must be credited, either as an
+// absolute base-unit amount or as a tolerance in basis points of the amount
+// sent. When both are set the stricter applies.
+type ReceiveGuard struct {
+	MinReceived    *big.Int
+	MaxSlippageBPS int64
+}
+
+// SlippageError is returned when the simulated transfer credits the recipient
+// less than the ReceiveGuard allows.
+type SlippageError struct {
+	Sent     *big.Int
+	Received *big.Int
+	Minimum  *big.Int
+}
+
+func (e *SlippageError) Error() string {
+	return fmt.Sprintf("recipient would receive %s, below the minimum of %s", e.Received, e.Minimum)
+}
+
+// TokenCheck is what was learned about a token, and how a transfer of it
+// would behave, before the transfer was built.
+type TokenCheck struct {
+	Token     string         `json:"token"`
+	ChainID   uint64         `json:"chain_id"`
+	Name      string         `json:"name,omitempty"`
+	Symbol    string         `json:"symbol"`
+	Decimals  uint8          `json:"decimals"`
+	Balance   string         `json:"balance"`
+	Amount    string         `json:"amount"`
+	Simulated bool           `json:"simulated"`
+	Received  string         `json:"received,omitempty"`
+	Delta     string         `json:"delta,omitempty"`
+	DeltaBPS  int64          `json:"delta_bps,omitempty"`
+	Minimum   string         `json:"min_received,omitempty"`
+	Warnings  []TokenWarning `json:"warnings,omitempty"`
+
+	amount   *big.Int
+	balance  *big.Int
+	received *big.Int
+}
+
+// TokenWarning flags token behaviour that does not stop a transfer but that
+// the caller should know about, such as the recipient being credited less
+// than was sent.
+type TokenWarning struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// CheckTokenTransfer runs the checks TransferERC20 makes without sending
+// anything. from defaults to the selected account.
+func CheckTokenTransfer(chain *Chain, token, from, to string, amount TokenAmount, guard ReceiveGuard) (*TokenCheck, error) {
+	if from == "" {
+		var err error
+		if from, err = SelectedAddress(); err != nil {
+			return nil, err
+		}
+	}
+	if !common.IsHexAddress(token) {
+		return nil, ErrInvalidTokenAddress
+	}
+	if !common.IsHexAddress(from) || !common.IsHexAddress(to) {
+		return nil, errors.New("invalid from or to address")
+	}
+
+	holder := common.HexToAddress(from)
+	recipient := common.HexToAddress(to)
+
+	check, err := inspectToken(chain, common.HexToAddress(token), holder, amount)
+	if err != nil {
+		return nil, err
+	}
+	if check.balance.Cmp(check.amount) < 0 {
+		return nil, &AllowanceError{Reason: "insufficient token balance", Available: check.balance, Required: check.amount}
+	}
+
+	data, err := erc20ABI.Pack("transfer", recipient, check.amount)
+	if err != nil {
+		return nil, err
+	}
+	if err := simulateTokenTransfer(chain, check, holder, holder, recipient, data); err != nil {
+		return nil, err
+	}
+	if err := check.enforce(guard); err != nil {
+		return nil, err
+	}
+
+	return check, nil
+}
+
+// TransferERC20 sends amount of token from the selected account. The token
+// and the transfer are checked first; warnings are returned alongside the
+// transaction hash rather than stopping the send, unless guard rejects the
+// simulated received amount.
+func TransferERC20(chain *Chain, token, to string, amount TokenAmount, guard ReceiveGuard) (string, *TokenCheck, error) {
+	signer, err := loadSigner()
+	if err != nil {
+		return "", nil, err
+	}
+
+	check, err := CheckTokenTransfer(chain, token, signer.Address().Hex(), to, amount, guard)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := erc20ABI.Pack("transfer", common.HexToAddress(to), check.amount)
+	if err != nil {
+		return "", nil, err
+	}
+
+	txHash, err := sendContractTransaction(chain, signer, common.HexToAddress(check.Token), big.NewInt(0), data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return txHash, check, nil
+}
+
+// ParseTokenAmount converts a whole-token amount such as "1.5" to base units.
+func ParseTokenAmount(value string, decimals uint8) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(value), ".")
+	if whole == "" {
+		whole = "0"
+	}
+	if len(fraction) > int(decimals) {
+		return nil, fmt.Errorf("%w (%d)", ErrAmountPrecision, decimals)
+	}
+
+	digits := whole + fraction + strings.Repeat("0", int(decimals)-len(fraction))
+	amount, ok := new(big.Int).SetString(digits, 10)
+	if !ok || amount.Sign() < 0 || strings.ContainsAny(digits, "+-") {
+		return nil, errors.New("invalid amount")
+	}
+
+	return amount, nil
+}
+
+// FormatTokenAmount converts a base-unit amount to whole tokens, the inverse
+// of ParseTokenAmount, without trailing zeros: 1500000 with 6 decimals is
+// "1.5".
+func FormatTokenAmount(value *big.Int, decimals uint8) string {
+	digits := value.String()
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+
+	split := len(digits) - int(decimals)
+	whole, fraction := digits[:split], strings.TrimRight(digits[split:], "0")
+	if fraction == "" {
+		return whole
+	}
+
+	return whole + "." + fraction
+}
+
+// inspectToken checks that token has code and answers the ERC-20 views a
+// transfer relies on, and resolves amount to base units.
+func inspectToken(chain *Chain, token, holder common.Address, amount TokenAmount) (*TokenCheck, error) {
+	metadata, err := tokenMetadata(chain, token)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := tokenUint(chain, token, "balanceOf", holder)
+	if err != nil {
+		return nil, fmt.Errorf("%w: balanceOf() failed: %v", ErrNotERC20, err)
+	}
+
+	value := amount.Base
+	if amount.Display != "" {
+		if value, err = ParseTokenAmount(amount.Display, metadata.Decimals); err != nil {
+			return nil, err
+		}
+	}
+	if value == nil || value.Sign() <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+
+	return &TokenCheck{
+		Token:    token.Hex(),
+		ChainID:  chain.ID.Uint64(),
+		Name:     metadata.Name,
+		Symbol:   metadata.Symbol,
+		Decimals: metadata.Decimals,
+		Balance:  balance.String(),
+		Amount:   value.String(),
+		amount:   value,
+		balance:  balance,
+	}, nil
+}
+
+// tokenMetadata checks that token has code and reads its decimals, symbol
+// and name.
+func tokenMetadata(chain *Chain, token common.Address) (*TokenInfo, error) {
+	contract, err := isContract(context.Background(), chain, token)
+	if err != nil {
+		return nil, err
+	}
+	if !contract {
+		return nil, ErrTokenNoCode
+	}
+
+	out, err := callContract(chain, token, erc20ABI, "decimals")
+	if err != nil {
+		return nil, fmt.Errorf("%w: decimals() failed: %v", ErrNotERC20, err)
+	}
+	decimals, ok := out[0].(uint8)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected decimals() result", ErrNotERC20)
+	}
+
+	symbol, err := tokenText(chain, token, "symbol")
+	if err != nil {
+		return nil, fmt.Errorf("%w: symbol() failed: %v", ErrNotERC20, err)
+	}
+	// name is optional in ERC-20, so a token without one is not rejected.
+	name, _ := tokenText(chain, token, "name")
+
+	return &TokenInfo{
+		Token:    token.Hex(),
+		ChainID:  chain.ID.Uint64(),
+		Name:     name,
+		Symbol:   symbol,
+		Decimals: decimals,
+	}, nil
+}
+
+// tokenText reads a string view. Some older tokens (MKR among them) return
+// bytes32 instead, which is decoded as a NUL-padded string.
+func tokenText(chain *Chain, token common.Address, method string) (string, error) {
+	data, err := erc20ABI.Pack(method)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := chain.client.CallContract(context.Background(), ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if out, err := erc20ABI.Unpack(method, result); err == nil && len(out) > 0 {
+		if text, ok := out[0].(string); ok {
+			return text, nil
+		}
+	}
+	if len(result) == 32 {
+		return strings.TrimRight(string(result), "\x00"), nil
+	}
+
+	return "", fmt.Errorf("unexpected %s result", method)
+}
+
+// callFrame is the subset of a callTracer frame the simulation reads.
+type callFrame struct {
+	Error        string        `json:"error"`
+	RevertReason string        `json:"revertReason"`
+	Output       hexutil.Bytes `json:"output"`
+	Logs         []callLog     `json:"logs"`
+	Calls        []callFrame   `json:"calls"`
+}
+
+type callLog struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    hexutil.Bytes  `json:"data"`
+}
+
+// simulateTokenTransfer traces the transfer call with debug_traceCall and
+// compares the Transfer events it emits with the requested amount, which
+// reveals fee-on-transfer and share-based (rebasing) tokens. Nodes without
+// the debug namespace fall back to a plain eth_call, which still catches
+// transfers that would revert.
+func simulateTokenTransfer(chain *Chain, check *TokenCheck, caller, holder, recipient common.Address, data []byte) error {
+	token := common.HexToAddress(check.Token)
+	ctx, cancel := context.WithTimeout(context.Background(), rpcReadTimeout)
+	defer cancel()
+
+	if recipient == token {
+		check.warn(TokenWarning{Code: WarningRecipientIsToken, Message: "the recipient is the token contract itself; tokens sent there are usually lost"})
+	} else if err := checkTokenRecipient(ctx, chain, check, recipient); err != nil {
+		return err
+	}
+
+	call := map[string]interface{}{"from": caller, "to": token, "data": hexutil.Bytes(data)}
+	tracer := map[string]interface{}{"tracer": "callTracer", "tracerConfig": map[string]interface{}{"withLog": true}}
+
+	var frame callFrame
+	if err := chain.client.Client.Client().CallContext(ctx, &frame, "debug_traceCall", call, "latest", tracer); err != nil {
+		output, err := chain.client.CallContract(ctx, ethereum.CallMsg{From: caller, To: &token, Data: data}, nil)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrTransferWouldRevert, err)
+		}
+		check.warn(TokenWarning{Code: WarningSimulationUnavailable, Message: "the node does not support debug_traceCall, so fee-on-transfer and rebasing behaviour was not checked"})
+		return checkTransferOutput(check, output)
+	}
+
+	if frame.Error != "" {
+		reason := frame.Error
+		if frame.RevertReason != "" {
+			reason = frame.RevertReason
+		}
+		return fmt.Errorf("%w: %s", ErrTransferWouldRevert, reason)
+	}
+	if err := checkTransferOutput(check, frame.Output); err != nil {
+		return err
+	}
+	check.Simulated = true
+
+	transferTopic := erc20ABI.Events["Transfer"].ID
+	received, debited := new(big.Int), new(big.Int)
+	var events, fees int
+	for _, log := range frame.collectLogs(nil) {
+		if log.Address != token || len(log.Topics) != 3 || log.Topics[0] != transferTopic {
+			continue
+		}
+		from := common.BytesToAddress(log.Topics[1].Bytes())
+		to := common.BytesToAddress(log.Topics[2].Bytes())
+		value := new(big.Int).SetBytes(log.Data)
+
+		events++
+		if to == recipient {
+			received.Add(received, value)
+		} else if from == holder {
+			fees++
+		}
+		if from == holder {
+			debited.Add(debited, value)
+		}
+	}
+	if events > 0 {
+		delta := new(big.Int).Sub(check.amount, received)
+		check.received = received
+		check.Received = received.String()
+		if delta.Sign() != 0 {
+			check.Delta = delta.String()
+			check.DeltaBPS = new(big.Int).Quo(new(big.Int).Mul(delta, big.NewInt(10000)), check.amount).Int64()
+		}
+	}
+
+	switch {
+	case events == 0:
+		check.warn(TokenWarning{Code: WarningNoTransferEvent, Message: "the simulated transfer emitted no Transfer event, so the amount received could not be confirmed"})
+	case received.Cmp(check.amount) < 0 && (fees > 0 || debited.Cmp(received) > 0):
+		check.warn(TokenWarning{
+			Code:     WarningFeeOnTransfer,
+			Message:  "the token takes a fee on transfer; the recipient receives less than the amount sent",
+			Expected: check.amount.String(),
+			Actual:   received.String(),
+		})
+	case received.Cmp(check.amount) != 0 || debited.Cmp(check.amount) > 0:
+		check.warn(TokenWarning{
+			Code:     WarningRebasing,
+			Message:  "the amount credited differs from the amount sent without a fee transfer, which suggests share-based (rebasing) balances",
+			Expected: check.amount.String(),
+			Actual:   received.String(),
+		})
+	}
+
+	return nil
+}
+
+// checkTokenRecipient warns when the recipient is a contract that shows no
+// sign of handling tokens: it holds none of this one, and no token moved to
+// or from it in the last tokenActivityBlocks blocks. Such a contract, most
+// often another token, usually has no way to send tokens on, so they are
+// lost.
+func checkTokenRecipient(ctx context.Context, chain *Chain, check *TokenCheck, recipient common.Address) error {
+	contract, err := isContract(ctx, chain, recipient)
+	if err != nil || !contract {
+		return err
+	}
+
+	if symbol, err := tokenText(chain, recipient, "symbol"); err == nil && symbol != "" {
+		if _, err := callContract(chain, recipient, erc20ABI, "decimals"); err == nil {
+			check.warn(TokenWarning{
+				Code:    WarningRecipientIsContract,
+				Message: fmt.Sprintf("the recipient is the contract of another token (%s); tokens sent there are usually lost", symbol),
+			})
+			return nil
+		}
+	}
+
+	if held, err := tokenUint(chain, common.HexToAddress(check.Token), "balanceOf", recipient); err == nil && held.Sign() > 0 {
+		return nil
+	}
+	if active, err := hasTokenActivity(ctx, chain, recipient); err != nil || active {
+		return err
+	}
+
+	check.warn(TokenWarning{
+		Code:    WarningRecipientIsContract,
+		Message: "the recipient is a contract with no recent token activity; unless it is built to receive this token, tokens sent there may be lost",
+	})
+
+	return nil
+}
+
+// tokenActivityBlocks is how far back checkTokenRecipient looks for
+// transfers of any token to or from a contract.
+const tokenActivityBlocks = 5000
+
+// hasTokenActivity reports whether any Transfer event in the recent blocks
+// names address as sender or recipient. A node that refuses the range is
+// taken to have found nothing.
+func hasTokenActivity(ctx context.Context, chain *Chain, address common.Address) (bool, error) {
+	head, err := chain.client.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	from := uint64(0)
+	if head > tokenActivityBlocks {
+		from = head - tokenActivityBlocks
+	}
+
+	transfer := erc20ABI.Events["Transfer"].ID
+	topic := common.BytesToHash(address.Bytes())
+	for _, topics := range [][][]common.Hash{
+		{{transfer}, {topic}},
+		{{transfer}, nil, {topic}},
+	} {
+		logs, err := chain.client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(head),
+			Topics:    topics,
+		})
+		if err != nil {
+			if isConnectivityError(err) {
+				return false, err
+			}
+			continue
+		}
+		if len(logs) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// checkTransferOutput rejects a transfer that returns false. Tokens that
+// return nothing at all (USDT among them) work but are not ERC-20 compliant.
+func checkTransferOutput(check *TokenCheck, output []byte) error {
+	if len(output) == 0 {
+		check.warn(TokenWarning{Code: WarningMissingReturnValue, Message: "transfer returns no value; the token is not fully ERC-20 compliant"})
+		return nil
+	}
+
+	if new(big.Int).SetBytes(output).Sign() == 0 {
+		return fmt.Errorf("%w: transfer returned false", ErrTransferWouldRevert)
+	}
+
+	return nil
+}
+
+// collectLogs gathers the logs of frame and its subcalls in execution order.
+// Logs of reverted subcalls are discarded, mirroring what would be mined.
+func (f callFrame) collectLogs(logs []callLog) []callLog {
+	if f.Error != "" {
+		return logs
+	}
+
+	logs = append(logs, f.Logs...)
+	for _, call := range f.Calls {
+		logs = call.collectLogs(logs)
+	}
+
+	return logs
+}
+
+// enforce applies guard to the simulated received amount. A guard cannot be
+// checked without a simulation, so in that case the transfer is refused
+// rather than sent unguarded.
+func (c *TokenCheck) enforce(guard ReceiveGuard) error {
+	if guard.MinReceived == nil && guard.MaxSlippageBPS == 0 {
+		return nil
+	}
+	if guard.MaxSlippageBPS < 0 || guard.MaxSlippageBPS > 10000 {
+		return ErrInvalidSlippage
+	}
+
+	minimum := new(big.Int)
+	if guard.MinReceived != nil {
+		minimum.Set(guard.MinReceived)
+	}
+	if guard.MaxSlippageBPS > 0 {
+		// Round the tolerance's minimum up so the guard is never looser
+		// than asked.
+		tolerated := new(big.Int).Mul(c.amount, big.NewInt(10000-guard.MaxSlippageBPS))
+		tolerated.Add(tolerated, big.NewInt(9999))
+		tolerated.Quo(tolerated, big.NewInt(10000))
+		if tolerated.Cmp(minimum) > 0 {
+			minimum = tolerated
+		}
+	}
+	c.Minimum = minimum.String()
+
+	if c.received == nil {
+		return ErrReceivedUnverified
+	}
+	if c.received.Cmp(minimum) < 0 {
+		return &SlippageError{Sent: c.amount, Received: c.received, Minimum: minimum}
+	}
+
+	return nil
+}
+
+func (c *TokenCheck) warn(warning TokenWarning) {
+	c.Warnings = append(c.Warnings, warning)
+}
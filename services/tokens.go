@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAccessTokenTTL bounds the lifetime of tokens issued by IssueAccessToken.
+const maxAccessTokenTTL = 24 * time.Hour
+
+var (
+	// revokedTokensFile maps the ID of each revoked access token to when it
+	// expires, after which it is refused anyway and is dropped.
+	revokedTokensFile = "revoked_tokens.json"
+	revokedTokensMu   sync.Mutex
+)
+
+var ErrInvalidTokenRequest = errors.New("invalid token request")
+
+// IssueAccessToken issues a bearer token for the caller, such as one to
+// hand a script or another service in place of an API key. It has scopes,
+// all of the caller's if none are given, and lasts ttl, fifteen minutes if
+// zero, but never outlasts the caller's own token. A token issued to an API
+// key stops working when the key is revoked.
+func IssueAccessToken(caller *Principal, scopes []string, ttl time.Duration) (*AccessToken, error) {
+	if ttl == 0 {
+		ttl = defaultAccessTokenTTL
+	}
+	if ttl < 0 || ttl > maxAccessTokenTTL {
+		return nil, fmt.Errorf("%w: the lifetime must be at most %s", ErrInvalidTokenRequest, maxAccessTokenTTL)
+	}
+	if len(scopes) == 0 {
+		scopes = caller.Scopes
+	}
+	for _, scope := range scopes {
+		if !caller.HasScope(scope) {
+			return nil, fmt.Errorf("%w: %q is not one of the caller's scopes", ErrInvalidScope, scope)
+		}
+	}
+
+	expires := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	if caller.ExpiresAt != nil && caller.ExpiresAt.Before(expires) {
+		expires = *caller.ExpiresAt
+	}
+	principal := &Principal{
+		Kind:      caller.Kind,
+		Subject:   caller.Subject,
+		Role:      caller.Role,
+		Scopes:    append([]string(nil), scopes...),
+		KeyID:     caller.KeyID,
+		Groups:    caller.Groups,
+		ExpiresAt: &expires,
+	}
+
+	token, err := signAccessToken(principal)
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit("token.issued", fmt.Sprintf("%s issued an access token with %s", caller.Subject, strings.Join(principal.Scopes, ", ")),
+		map[string]interface{}{"subject": caller.Subject, "token_id": principal.TokenID, "key_id": caller.KeyID, "expires_at": expires})
+	return &AccessToken{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresIn: int64(time.Until(expires).Seconds()),
+		Principal: principal,
+	}, nil
+}
+
+// RevokeAccessToken revokes an access token the wallet issued, whether from
+// an OIDC login or IssueAccessToken, so it is refused from then on. API
+// keys are revoked by ID instead.
+func RevokeAccessToken(token string) (*Principal, error) {
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		return nil, fmt.Errorf("%w: API keys are revoked at /apikeys", ErrInvalidTokenRequest)
+	}
+	principal, err := verifyAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if principal.TokenID == "" {
+		return nil, fmt.Errorf("%w: the token has no ID to revoke it by", ErrInvalidTokenRequest)
+	}
+
+	revokedTokensMu.Lock()
+	defer revokedTokensMu.Unlock()
+
+	revoked, err := readRevokedTokens()
+	if err != nil {
+		return nil, err
+	}
+	revoked[principal.TokenID] = *principal.ExpiresAt
+	if err := writeJSONFile(revokedTokensFile, revoked); err != nil {
+		return nil, err
+	}
+
+	recordAudit("token.revoked", fmt.Sprintf("Access token of %s revoked", principal.Subject),
+		map[string]interface{}{"subject": principal.Subject, "token_id": principal.TokenID})
+	return principal, nil
+}
+
+func tokenRevoked(id string) (bool, error) {
+	revokedTokensMu.Lock()
+	defer revokedTokensMu.Unlock()
+
+	revoked, err := readRevokedTokens()
+	if err != nil {
+		return false, err
+	}
+	_, ok := revoked[id]
+
+	return ok, nil
+}
+
+// readRevokedTokens loads the revoked tokens that have not yet expired.
+func readRevokedTokens() (map[string]time.Time, error) {
+	revoked := map[string]time.Time{}
+	if err := readJSONFile(revokedTokensFile, &revoked); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	now := time.Now()
+	for id, expires := range revoked {
+		if expires.Before(now) {
+			delete(revoked, id)
+		}
+	}
+
+	return revoked, nil
+}
@@ -2,64 +2,239 @@ package services
 
 import (
 	"context"
-	"crypto/ecdsa"
+	"errors"
+	"fmt"
 	"log"
 	"math/big"
-	"os"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-var ethClient *ethclient.Client
+// Transaction types CreateAndSendTransaction can send.
+const (
+	TxTypeLegacy     = "legacy"
+	TxTypeDynamicFee = "1559"
+)
+
+var (
+	ErrInvalidFees            = errors.New("invalid fees")
+	ErrDynamicFeesUnsupported = errors.New("chain does not support EIP-1559 transactions")
+)
 
-func init() {
-	var err error
-	ethClient, err = ethclient.Dial("https://mainnet.infura.io/v3/"+os.Getenv("INFURA_PROJECT_ID"))
+// FeeOptions choose a transaction's type, its nonce if Nonce is set, and,
+// for an EIP-1559 transaction, its fees. A fee left nil is filled in from
+// the chain: the tip from the node's suggestion, and the fee cap as twice
+// the latest base fee plus the tip, which stays valid through several full
+// blocks of base fee increases.
+type FeeOptions struct {
+	Type                 string
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	Nonce                *uint64
+}
+
+// CreateAndSendTransaction sends value and optional calldata, with the gas
+// limit estimated by the node plus GAS_LIMIT_MARGIN.
+func CreateAndSendTransaction(chain *Chain, account, toAddress string, value int64, data []byte, fees FeeOptions) (string, error) {
+
+	signer, err := loadSignerFor(account)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-}
 
-func CreateAndSendTransaction(toAddress string, value int64)(string, error){
+	to := common.HexToAddress(toAddress)
+	amount := big.NewInt(value)
+	if err := checkAddressBook(chain, to); err != nil {
+		return "", err
+	}
 
-	privateKey, err := loadKey()
+	// Estimation fails outright when the value alone is unaffordable, so
+	// check it first to report the shortfall.
+	if err := checkFunds(context.Background(), chain, signer.Address(), amount, 0, nil); err != nil {
+		return "", err
+	}
+	_, gasLimit, err := estimateGasLimit(context.Background(), chain, signer.Address(), to, amount, data)
 	if err != nil {
 		return "", err
 	}
 
-	publicKey := privateKey.Public().(*ecdsa.PublicKey)
-	fromAddress := crypto.PubkeyToAddress(*publicKey)
+	switch fees.Type {
+	case "", TxTypeLegacy:
+		if fees.MaxFeePerGas != nil || fees.MaxPriorityFeePerGas != nil {
+			return "", fmt.Errorf("%w: max fees only apply to %s transactions", ErrInvalidFees, TxTypeDynamicFee)
+		}
+	case TxTypeDynamicFee:
+		feeCap, tip, err := chain.dynamicFees(context.Background(), fees)
+		if err != nil {
+			return "", err
+		}
+		return sendDynamicFeeTransaction(chain, signer, to, amount, gasLimit, feeCap, tip, data, fees.Nonce)
+	default:
+		return "", fmt.Errorf("%w: unknown transaction type %q", ErrInvalidFees, fees.Type)
+	}
+
+	gasprice, err := chain.currentGasPrice(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	return sendTransaction(chain, signer, to, amount, gasLimit, gasprice, data, fees.Nonce)
+}
+
+func sendTransaction(chain *Chain, signer Signer, to common.Address, value *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, nonce *uint64) (string, error) {
+	return sendBuiltTransaction(chain, signer, to, value, gasLimit, gasPrice, nonce, func(nonce uint64) (types.TxData, error) {
+		return &types.LegacyTx{Nonce: nonce, To: &to, Value: value, Gas: gasLimit, GasPrice: gasPrice, Data: data}, nil
+	})
+}
+
+// sendDynamicFeeTransaction sends an EIP-1559 transaction. Funds are
+// checked against the fee cap, the most it can cost.
+func sendDynamicFeeTransaction(chain *Chain, signer Signer, to common.Address, value *big.Int, gasLimit uint64, feeCap, tip *big.Int, data []byte, nonce *uint64) (string, error) {
+	return sendBuiltTransaction(chain, signer, to, value, gasLimit, feeCap, nonce, func(nonce uint64) (types.TxData, error) {
+		return &types.DynamicFeeTx{
+			ChainID:   chain.ID,
+			Nonce:     nonce,
+			GasTipCap: tip,
+			GasFeeCap: feeCap,
+			Gas:       gasLimit,
+			To:        &to,
+			Value:     value,
+			Data:      data,
+		}, nil
+	})
+}
+
+// sendBuiltTransaction checks, signs and broadcasts a transaction of any
+// type, with the given nonce or, if nil, the next free one. build makes it
+// once the nonce is reserved, for fields that depend on the nonce.
+func sendBuiltTransaction(chain *Chain, signer Signer, to common.Address, value *big.Int, gasLimit uint64, gasPrice *big.Int, nonce *uint64, build func(nonce uint64) (types.TxData, error)) (string, error) {
+	fromAddress := signer.Address()
+
+	if err := enforcePolicy(context.Background(), chain, fromAddress, to, value); err != nil {
+		return "", err
+	}
+	if err := checkFunds(context.Background(), chain, fromAddress, value, gasLimit, gasPrice); err != nil {
+		return "", err
+	}
 
-	nonce, err := ethClient.PendingNonceAt(context.Background(), fromAddress)
+	entry, err := reserveNonce(context.Background(), chain, fromAddress, to, value, nonce)
 	if err != nil {
 		return "", err
 	}
 
-	gasLimit := uint64(21000)
-	gasprice, err := ethClient.SuggestGasPrice(context.Background())
+	signedTx, status, err := signAndBroadcast(chain, signer, entry, build)
 	if err != nil {
 		return "", err
 	}
 
-	to:= common.HexToAddress(toAddress)
-	chainID, err := ethClient.NetworkID(context.Background())
+	recordSend(fromAddress, value)
+	learnSpending(fromAddress, to, value)
+
+	txHash := signedTx.Hash().Hex()
+	err = recordTransaction(signedBy(TransactionRecord{
+		Hash:      txHash,
+		ChainID:   chain.ID.Uint64(),
+		From:      fromAddress.Hex(),
+		To:        to.Hex(),
+		Value:     value.String(),
+		Status:    status,
+		CreatedAt: time.Now().UTC(),
+	}, signedTx))
+	if err != nil {
+		log.Printf("failed to record transaction %s: %v", txHash, err)
+	}
+
+	return txHash, nil
+}
+
+// signAndBroadcast builds, signs and broadcasts the transaction of a
+// journalled intent, returning it with the status to record it under.
+func signAndBroadcast(chain *Chain, signer Signer, entry *SigningJournalEntry, build func(nonce uint64) (types.TxData, error)) (*types.Transaction, string, error) {
+	txData, err := build(entry.Nonce)
+	if err != nil {
+		journalOutcome(entry.ID, JournalAbandoned, err)
+		return nil, "", err
+	}
+	signedTx, err := signer.SignTx(chain.ID, types.NewTx(txData))
+	if err != nil {
+		journalOutcome(entry.ID, JournalAbandoned, err)
+		return nil, "", err
+	}
+	if err := journalSigned(entry.ID, signedTx); err != nil {
+		journalOutcome(entry.ID, JournalAbandoned, err)
+		return nil, "", err
+	}
+
+	// If the node cannot be reached the signed transaction is queued and
+	// rebroadcast later rather than giving up its nonce.
+	status := StatusPending
+	err = chain.client.SendTransaction(context.Background(), signedTx)
 	if err != nil {
+		if !isConnectivityError(err) {
+			journalOutcome(entry.ID, JournalRejected, err)
+			return nil, "", err
+		}
+		if err := queueBroadcast(signedTx, signer.Address(), err); err != nil {
+			return nil, "", err
+		}
+		status = StatusQueued
+	}
+	if status == StatusQueued {
+		journalOutcome(entry.ID, JournalQueued, nil)
+	} else {
+		journalOutcome(entry.ID, JournalBroadcast, nil)
+	}
+
+	return signedTx, status, nil
+}
+
+func sendContractTransaction(chain *Chain, signer Signer, contract common.Address, value *big.Int, data []byte) (string, error) {
+	from := signer.Address()
+
+	// Estimation fails outright when the value alone is unaffordable, so
+	// check it first to report the shortfall.
+	if err := checkFunds(context.Background(), chain, from, value, 0, nil); err != nil {
 		return "", err
 	}
 
-	tx := types.NewTransaction(nonce, to, big.NewInt(value), gasLimit, gasprice, nil)
-	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), privateKey)
+	_, gasLimit, err := estimateGasLimit(context.Background(), chain, from, contract, value, data)
 	if err != nil {
 		return "", err
 	}
 
-	err = ethClient.SendTransaction(context.Background(), signedTx)
+	gasPrice, err := chain.currentGasPrice(context.Background())
 	if err != nil {
 		return "", err
 	}
 
-	return signedTx.Hash().Hex(), nil
+	return sendTransaction(chain, signer, contract, value, gasLimit, gasPrice, data, nil)
+}
+
+const (
+	receiptPollInterval = 3 * time.Second
+	receiptTimeout      = 10 * time.Minute
+)
+
+func waitForReceipt(ctx context.Context, chain *Chain, txHash common.Hash) (*types.Receipt, error) {
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := chain.client.TransactionReceipt(ctx, txHash)
+		if err == nil {
+			return receipt, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
 }
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// TypedDataSignature is an EIP-712 signature as eth_signTypedData_v4 returns
+// it, 0x-prefixed with a 27/28 recovery ID, and split into r, s and v for
+// contracts that take them separately, such as EIP-2612 permit. Digest is
+// the hash that was signed.
+type TypedDataSignature struct {
+	Signer    string `json:"signer"`
+	Digest    string `json:"digest"`
+	Signature string `json:"signature"`
+	R         string `json:"r"`
+	S         string `json:"s"`
+	V         byte   `json:"v"`
+}
+
+var ErrInvalidTypedData = errors.New("invalid typed data")
+
+// eip712DomainFields are the domain fields in the order EIP-712 lists them,
+// which is the order wallets use when they derive the EIP712Domain type.
+var eip712DomainFields = []apitypes.Type{
+	{Name: "name", Type: "string"},
+	{Name: "version", Type: "string"},
+	{Name: "chainId", Type: "uint256"},
+	{Name: "verifyingContract", Type: "address"},
+	{Name: "salt", Type: "bytes32"},
+}
+
+// SignTypedData signs EIP-712 typed data with an account, the selected one
+// if empty. Types may leave out EIP712Domain, as ethers' signTypedData does;
+// it is then derived from the fields the domain sets.
+func SignTypedData(account string, typedData apitypes.TypedData) (*TypedDataSignature, error) {
+	hash, err := typedDataHash(typedData)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := loadSignerFor(account)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := signer.SignHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	recordSignature(signer.Address())
+
+	signature[crypto.RecoveryIDOffset] += 27
+	return &TypedDataSignature{
+		Signer:    signer.Address().Hex(),
+		Digest:    hexutil.Encode(hash),
+		Signature: hexutil.Encode(signature),
+		R:         hexutil.Encode(signature[:32]),
+		S:         hexutil.Encode(signature[32:64]),
+		V:         signature[crypto.RecoveryIDOffset],
+	}, nil
+}
+
+func typedDataHash(typedData apitypes.TypedData) ([]byte, error) {
+	if typedData.PrimaryType == "" || typedData.PrimaryType == "EIP712Domain" {
+		return nil, fmt.Errorf("%w: primaryType must name a type other than EIP712Domain", ErrInvalidTypedData)
+	}
+	if _, ok := typedData.Types[typedData.PrimaryType]; !ok {
+		return nil, fmt.Errorf("%w: primaryType %s is not in types", ErrInvalidTypedData, typedData.PrimaryType)
+	}
+
+	if _, ok := typedData.Types["EIP712Domain"]; !ok {
+		types := make(apitypes.Types, len(typedData.Types)+1)
+		for name, fields := range typedData.Types {
+			types[name] = fields
+		}
+		domain := typedData.Domain.Map()
+		for _, field := range eip712DomainFields {
+			if _, ok := domain[field.Name]; ok {
+				types["EIP712Domain"] = append(types["EIP712Domain"], field)
+			}
+		}
+		typedData.Types = types
+	}
+
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTypedData, err)
+	}
+
+	return hash, nil
+}
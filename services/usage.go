@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AccountUsage counts what each key has been used for. Signatures covers
+// every signing operation, including transactions; ValueMoved is the total
+// wei sent.
+type AccountUsage struct {
+	Signatures   int        `json:"signatures"`
+	Transactions int        `json:"transactions"`
+	ValueMoved   string     `json:"value_moved"`
+	LastUsed     *time.Time `json:"last_used,omitempty"`
+}
+
+var (
+	usageFile = "usage.json"
+	usageMu   sync.Mutex
+)
+
+func ListAccountUsage() (map[common.Address]AccountUsage, error) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	usage, err := readUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	byAddress := make(map[common.Address]AccountUsage, len(usage))
+	for address, counters := range usage {
+		byAddress[common.HexToAddress(address)] = *counters
+	}
+
+	return byAddress, nil
+}
+
+func recordSignature(address common.Address) {
+	recordUsage(address, false, nil)
+}
+
+func recordSend(address common.Address, value *big.Int) {
+	recordUsage(address, true, value)
+}
+
+// recordUsage updates the counters for address. A send counts as a signature
+// too. Errors are logged so bookkeeping never fails the operation itself.
+func recordUsage(address common.Address, sent bool, value *big.Int) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	usage, err := readUsage()
+	if err != nil {
+		log.Printf("failed to record usage for %s: %v", address.Hex(), err)
+		return
+	}
+
+	counters, ok := usage[address.Hex()]
+	if !ok {
+		counters = &AccountUsage{ValueMoved: "0"}
+		usage[address.Hex()] = counters
+	}
+
+	now := time.Now().UTC()
+	if counters.LastUsed != nil {
+		checkDormant(address, now.Sub(*counters.LastUsed))
+	}
+
+	counters.Signatures++
+	if sent {
+		counters.Transactions++
+		moved, _ := new(big.Int).SetString(counters.ValueMoved, 10)
+		if moved == nil {
+			moved = new(big.Int)
+		}
+		if value != nil {
+			moved.Add(moved, value)
+		}
+		counters.ValueMoved = moved.String()
+	}
+	counters.LastUsed = &now
+
+	if err := writeJSONFile(usageFile, usage); err != nil {
+		log.Printf("failed to record usage for %s: %v", address.Hex(), err)
+	}
+}
+
+func checkDormant(address common.Address, idle time.Duration) {
+	policy, err := GetPolicy()
+	if err != nil || policy.DormantAlertAfter == "" {
+		return
+	}
+
+	threshold, err := time.ParseDuration(policy.DormantAlertAfter)
+	if err != nil || idle < threshold {
+		return
+	}
+
+	raiseAlert(AlertDormantAccount, address.Hex(),
+		fmt.Sprintf("account %s was used after being idle for %s", address.Hex(), idle.Round(time.Second)))
+}
+
+func readUsage() (map[string]*AccountUsage, error) {
+	usage := map[string]*AccountUsage{}
+	if err := readJSONFile(usageFile, &usage); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return usage, nil
+}
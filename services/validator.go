@@ -0,0 +1,484 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jabbala-dev/go-wallet/bls"
+	"github.com/jabbala-dev/go-wallet/hdwallet"
+)
+
+// Validator keys are BLS12-381 keys that sign for the consensus layer. The
+// wallet keeps them in EIP-2335 keystores, one file per key, which validator
+// clients import as they are, and uses them to sign the deposit data that
+// registers a validator and the voluntary exit that retires it. Attesting
+// and proposing stay with the validator client.
+
+const (
+	// maxValidatorKeys bounds the keys one request creates, each keystore
+	// taking a full scrypt run.
+	maxValidatorKeys = 100
+
+	// minDepositGwei is the smallest deposit the deposit contract takes.
+	minDepositGwei = 1_000_000_000
+
+	defaultDepositGwei = 32_000_000_000
+
+	// depositCLIVersion is the staking-deposit-cli version whose deposit
+	// data format DepositData follows, which the staking launchpad checks.
+	depositCLIVersion = "2.7.0"
+)
+
+// Signature domain types of the consensus specs.
+var (
+	domainDeposit       = [4]byte{0x03, 0x00, 0x00, 0x00}
+	domainVoluntaryExit = [4]byte{0x04, 0x00, 0x00, 0x00}
+)
+
+// BeaconNetwork holds what a consensus network's signing domains are made
+// of. Deposits are signed for the genesis fork version; voluntary exits,
+// since EIP-7044, for the Capella fork version.
+type BeaconNetwork struct {
+	Name                  string
+	GenesisForkVersion    [4]byte
+	CapellaForkVersion    [4]byte
+	GenesisValidatorsRoot common.Hash
+}
+
+var beaconNetworks = map[string]BeaconNetwork{
+	"mainnet": {
+		Name:                  "mainnet",
+		GenesisForkVersion:    [4]byte{0x00, 0x00, 0x00, 0x00},
+		CapellaForkVersion:    [4]byte{0x03, 0x00, 0x00, 0x00},
+		GenesisValidatorsRoot: common.HexToHash("0x4b363db94e286120d76eb905340fdd4e54bfe9f06bf33ff6cf5ad27f511bfe95"),
+	},
+	"sepolia": {
+		Name:                  "sepolia",
+		GenesisForkVersion:    [4]byte{0x90, 0x00, 0x00, 0x69},
+		CapellaForkVersion:    [4]byte{0x90, 0x00, 0x00, 0x72},
+		GenesisValidatorsRoot: common.HexToHash("0xd8ea171f3c94aea21ebc42a1ed61052acf3f9209c00e4efbaaddac09ed9b8078"),
+	},
+	"holesky": {
+		Name:                  "holesky",
+		GenesisForkVersion:    [4]byte{0x01, 0x01, 0x70, 0x00},
+		CapellaForkVersion:    [4]byte{0x04, 0x01, 0x70, 0x00},
+		GenesisValidatorsRoot: common.HexToHash("0x9143aa7c615a7f7115e2b6aac319c03529df8242ae705fba9df39b79c59fa8b1"),
+	},
+}
+
+// ValidatorKey is a validator key the wallet keeps. Path is its EIP-2334
+// path if it was derived from a mnemonic.
+type ValidatorKey struct {
+	PublicKey string `json:"pubkey"`
+	Path      string `json:"path,omitempty"`
+}
+
+// DepositRequest is what a validator's deposit is for. The withdrawal
+// credentials are either given whole or made from WithdrawalAddress: 0x01
+// credentials, or 0x02 ones, which compound rewards, with Compounding.
+type DepositRequest struct {
+	Network               string `json:"network"`
+	WithdrawalAddress     string `json:"withdrawal_address"`
+	Compounding           bool   `json:"compounding"`
+	WithdrawalCredentials string `json:"withdrawal_credentials"`
+	AmountGwei            uint64 `json:"amount_gwei"`
+}
+
+// DepositData is a signed deposit in staking-deposit-cli's format, byte
+// strings in unprefixed hex, as the staking launchpad takes it.
+type DepositData struct {
+	PublicKey             string `json:"pubkey"`
+	WithdrawalCredentials string `json:"withdrawal_credentials"`
+	Amount                uint64 `json:"amount"`
+	Signature             string `json:"signature"`
+	DepositMessageRoot    string `json:"deposit_message_root"`
+	DepositDataRoot       string `json:"deposit_data_root"`
+	ForkVersion           string `json:"fork_version"`
+	NetworkName           string `json:"network_name"`
+	DepositCLIVersion     string `json:"deposit_cli_version"`
+}
+
+// SignedVoluntaryExit is a signed exit as the beacon API's
+// /eth/v1/beacon/pool/voluntary_exits takes it.
+type SignedVoluntaryExit struct {
+	Message   VoluntaryExit `json:"message"`
+	Signature string        `json:"signature"`
+}
+
+type VoluntaryExit struct {
+	Epoch          string `json:"epoch"`
+	ValidatorIndex string `json:"validator_index"`
+}
+
+var (
+	validatorKeysDir = "validator_keys"
+	validatorKeysMu  sync.Mutex
+)
+
+var (
+	ErrValidatorKeyNotFound    = errors.New("validator key not found")
+	ErrValidatorKeyExists      = errors.New("validator key already exists")
+	ErrInvalidValidatorRequest = errors.New("invalid validator request")
+)
+
+// CreateValidatorKeys creates count validator keys, each in a keystore
+// encrypted under password. With a mnemonic they are the keys of validators
+// start to start+count-1 at m/12381/3600/i/0/0, as staking-deposit-cli
+// derives them; otherwise they are random.
+func CreateValidatorKeys(password, mnemonic, passphrase string, start uint32, count int) ([]ValidatorKey, error) {
+	if password == "" {
+		return nil, ErrPasswordRequired
+	}
+	if count <= 0 {
+		count = 1
+	}
+	if count > maxValidatorKeys {
+		return nil, fmt.Errorf("%w: at most %d keys can be created at once", ErrInvalidValidatorRequest, maxValidatorKeys)
+	}
+	var seed []byte
+	if mnemonic != "" {
+		if err := hdwallet.ValidateMnemonic(mnemonic); err != nil {
+			return nil, err
+		}
+		seed = hdwallet.MnemonicToSeed(mnemonic, passphrase)
+	}
+
+	validatorKeysMu.Lock()
+	defer validatorKeysMu.Unlock()
+
+	created := make([]ValidatorKey, 0, count)
+	for i := 0; i < count; i++ {
+		var (
+			key  *bls.SecretKey
+			path string
+			err  error
+		)
+		if seed != nil {
+			path = bls.ValidatorPath(start + uint32(i))
+			key, err = bls.DeriveKey(seed, path)
+		} else {
+			key, err = bls.GenerateKey()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		keystore, err := bls.EncryptKeystore(key, password, path, validatorScryptN())
+		if err != nil {
+			return nil, err
+		}
+		if err := storeValidatorKeystore(keystore); err != nil {
+			return nil, err
+		}
+		created = append(created, ValidatorKey{PublicKey: "0x" + keystore.PublicKey, Path: path})
+	}
+
+	recordAudit("validator.keys_created", fmt.Sprintf("Created %d validator keys", len(created)),
+		map[string]interface{}{"count": len(created), "derived": seed != nil})
+	return created, nil
+}
+
+// ImportValidatorKeystore adds an EIP-2335 keystore, such as one made by
+// staking-deposit-cli, once password is shown to decrypt it. It is kept as
+// it is, under its own password.
+func ImportValidatorKeystore(keystore bls.Keystore, password string) (ValidatorKey, error) {
+	key, err := bls.DecryptKeystore(&keystore, password)
+	if errors.Is(err, bls.ErrWrongPassword) {
+		return ValidatorKey{}, ErrWrongPassword
+	}
+	if err != nil {
+		return ValidatorKey{}, fmt.Errorf("%w: %v", ErrInvalidValidatorRequest, err)
+	}
+	keystore.PublicKey = hex.EncodeToString(key.PublicKey())
+
+	validatorKeysMu.Lock()
+	defer validatorKeysMu.Unlock()
+
+	if err := storeValidatorKeystore(&keystore); err != nil {
+		return ValidatorKey{}, err
+	}
+
+	recordAudit("validator.key_imported", "Imported validator key 0x"+keystore.PublicKey,
+		map[string]interface{}{"pubkey": "0x" + keystore.PublicKey})
+	return ValidatorKey{PublicKey: "0x" + keystore.PublicKey, Path: keystore.Path}, nil
+}
+
+func ListValidatorKeys() ([]ValidatorKey, error) {
+	validatorKeysMu.Lock()
+	defer validatorKeysMu.Unlock()
+
+	entries, err := os.ReadDir(validatorKeysDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	keys := []ValidatorKey{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		var keystore bls.Keystore
+		if err := readJSONFile(filepath.Join(validatorKeysDir, entry.Name()), &keystore); err != nil {
+			return nil, err
+		}
+		keys = append(keys, ValidatorKey{PublicKey: "0x" + keystore.PublicKey, Path: keystore.Path})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].PublicKey < keys[j].PublicKey })
+
+	return keys, nil
+}
+
+// ValidatorKeystore returns a key's keystore, for a validator client to
+// import.
+func ValidatorKeystore(pubkey string) (*bls.Keystore, error) {
+	validatorKeysMu.Lock()
+	defer validatorKeysMu.Unlock()
+
+	return readValidatorKeystore(pubkey)
+}
+
+// SignDeposit signs the deposit that registers the validator of pubkey,
+// for the deposit contract or the staking launchpad.
+func SignDeposit(pubkey, password string, request DepositRequest) (*DepositData, error) {
+	network, err := beaconNetwork(request.Network)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := withdrawalCredentials(request)
+	if err != nil {
+		return nil, err
+	}
+	amount := request.AmountGwei
+	if amount == 0 {
+		amount = defaultDepositGwei
+	}
+	if amount < minDepositGwei {
+		return nil, fmt.Errorf("%w: a deposit is at least %d gwei", ErrInvalidValidatorRequest, minDepositGwei)
+	}
+
+	key, err := unlockValidatorKey(pubkey, password)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := key.PublicKey()
+
+	messageRoot := sszMerkleize(sszBytes(publicKey), credentials, sszUint64(amount))
+	domain := signingDomain(domainDeposit, network.GenesisForkVersion, common.Hash{})
+	signature, err := key.Sign(signingRoot(messageRoot, domain))
+	if err != nil {
+		return nil, err
+	}
+	dataRoot := sszMerkleize(sszBytes(publicKey), credentials, sszUint64(amount), sszBytes(signature))
+
+	recordAudit("validator.deposit_signed", fmt.Sprintf("Signed a %d gwei deposit for validator 0x%x on %s", amount, publicKey, network.Name),
+		map[string]interface{}{"pubkey": fmt.Sprintf("0x%x", publicKey), "network": network.Name, "amount_gwei": amount,
+			"withdrawal_credentials": hex.EncodeToString(credentials[:])})
+	return &DepositData{
+		PublicKey:             hex.EncodeToString(publicKey),
+		WithdrawalCredentials: hex.EncodeToString(credentials[:]),
+		Amount:                amount,
+		Signature:             hex.EncodeToString(signature),
+		DepositMessageRoot:    hex.EncodeToString(messageRoot[:]),
+		DepositDataRoot:       hex.EncodeToString(dataRoot[:]),
+		ForkVersion:           hex.EncodeToString(network.GenesisForkVersion[:]),
+		NetworkName:           network.Name,
+		DepositCLIVersion:     depositCLIVersion,
+	}, nil
+}
+
+// SignVoluntaryExit signs the exit of the validator at validatorIndex,
+// whose key is pubkey, valid from epoch. Once included on chain an exit
+// cannot be undone, so it is only returned, for the caller to submit to a
+// beacon node.
+func SignVoluntaryExit(pubkey, password, networkName string, validatorIndex, epoch uint64) (*SignedVoluntaryExit, error) {
+	network, err := beaconNetwork(networkName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := unlockValidatorKey(pubkey, password)
+	if err != nil {
+		return nil, err
+	}
+
+	exitRoot := sszMerkleize(sszUint64(epoch), sszUint64(validatorIndex))
+	domain := signingDomain(domainVoluntaryExit, network.CapellaForkVersion, network.GenesisValidatorsRoot)
+	signature, err := key.Sign(signingRoot(exitRoot, domain))
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit("validator.exit_signed", fmt.Sprintf("Signed the exit of validator %d on %s from epoch %d", validatorIndex, network.Name, epoch),
+		map[string]interface{}{"pubkey": fmt.Sprintf("0x%x", key.PublicKey()), "network": network.Name,
+			"validator_index": validatorIndex, "epoch": epoch})
+	return &SignedVoluntaryExit{
+		Message: VoluntaryExit{
+			Epoch:          strconv.FormatUint(epoch, 10),
+			ValidatorIndex: strconv.FormatUint(validatorIndex, 10),
+		},
+		Signature: fmt.Sprintf("0x%x", signature),
+	}, nil
+}
+
+func unlockValidatorKey(pubkey, password string) (*bls.SecretKey, error) {
+	if password == "" {
+		return nil, ErrPasswordRequired
+	}
+
+	validatorKeysMu.Lock()
+	keystore, err := readValidatorKeystore(pubkey)
+	validatorKeysMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := bls.DecryptKeystore(keystore, password)
+	if errors.Is(err, bls.ErrWrongPassword) {
+		return nil, ErrWrongPassword
+	}
+	return key, err
+}
+
+func beaconNetwork(name string) (BeaconNetwork, error) {
+	if name == "" {
+		name = "mainnet"
+	}
+	network, ok := beaconNetworks[strings.ToLower(name)]
+	if !ok {
+		return BeaconNetwork{}, fmt.Errorf("%w: unknown network %q", ErrInvalidValidatorRequest, name)
+	}
+
+	return network, nil
+}
+
+func withdrawalCredentials(request DepositRequest) ([32]byte, error) {
+	var credentials [32]byte
+	switch {
+	case request.WithdrawalCredentials != "" && request.WithdrawalAddress != "":
+		return credentials, fmt.Errorf("%w: give either withdrawal credentials or a withdrawal address, not both", ErrInvalidValidatorRequest)
+	case request.WithdrawalCredentials != "":
+		raw, err := hex.DecodeString(strings.TrimPrefix(request.WithdrawalCredentials, "0x"))
+		if err != nil || len(raw) != 32 {
+			return credentials, fmt.Errorf("%w: withdrawal credentials must be 32 bytes of hex", ErrInvalidValidatorRequest)
+		}
+		copy(credentials[:], raw)
+	case common.IsHexAddress(request.WithdrawalAddress):
+		credentials[0] = 0x01
+		if request.Compounding {
+			credentials[0] = 0x02
+		}
+		copy(credentials[12:], common.HexToAddress(request.WithdrawalAddress).Bytes())
+	default:
+		return credentials, fmt.Errorf("%w: a withdrawal address is required", ErrInvalidValidatorRequest)
+	}
+
+	return credentials, nil
+}
+
+// storeValidatorKeystore must be called with validatorKeysMu held.
+func storeValidatorKeystore(keystore *bls.Keystore) error {
+	path := validatorKeyPath(keystore.PublicKey)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%w: 0x%s", ErrValidatorKeyExists, keystore.PublicKey)
+	}
+
+	return writeJSONFile(path, keystore)
+}
+
+// readValidatorKeystore must be called with validatorKeysMu held.
+func readValidatorKeystore(pubkey string) (*bls.Keystore, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(pubkey, "0x"))
+	if err != nil || len(raw) != bls.PublicKeyLength {
+		return nil, fmt.Errorf("%w: a public key is 48 bytes of hex", ErrInvalidValidatorRequest)
+	}
+
+	var keystore bls.Keystore
+	if err := readJSONFile(validatorKeyPath(hex.EncodeToString(raw)), &keystore); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: 0x%x", ErrValidatorKeyNotFound, raw)
+		}
+		return nil, err
+	}
+
+	return &keystore, nil
+}
+
+func validatorKeyPath(pubkey string) string {
+	return filepath.Join(validatorKeysDir, strings.ToLower(strings.TrimPrefix(pubkey, "0x"))+".json")
+}
+
+func validatorScryptN() int {
+	if os.Getenv("KEYSTORE_LIGHT_KDF") == "true" {
+		return bls.LightScryptN
+	}
+
+	return bls.StandardScryptN
+}
+
+// signingDomain is the consensus specs' compute_domain: the domain type
+// followed by the first 28 bytes of the fork data root.
+func signingDomain(domainType, forkVersion [4]byte, genesisValidatorsRoot common.Hash) [32]byte {
+	var version [32]byte
+	copy(version[:], forkVersion[:])
+	forkDataRoot := sszMerkleize(version, [32]byte(genesisValidatorsRoot))
+
+	var domain [32]byte
+	copy(domain[:4], domainType[:])
+	copy(domain[4:], forkDataRoot[:28])
+	return domain
+}
+
+// signingRoot is the root of SigningData, what a BLS signature covers.
+func signingRoot(objectRoot, domain [32]byte) []byte {
+	root := sszMerkleize(objectRoot, domain)
+	return root[:]
+}
+
+func sszUint64(v uint64) [32]byte {
+	var chunk [32]byte
+	binary.LittleEndian.PutUint64(chunk[:], v)
+	return chunk
+}
+
+// sszBytes is the root of a fixed-length byte vector.
+func sszBytes(b []byte) [32]byte {
+	chunks := make([][32]byte, (len(b)+31)/32)
+	for i := range chunks {
+		copy(chunks[i][:], b[i*32:])
+	}
+
+	return sszMerkleize(chunks...)
+}
+
+// sszMerkleize hashes chunks into a binary tree, padded with zero chunks to
+// a power of two.
+func sszMerkleize(chunks ...[32]byte) [32]byte {
+	if len(chunks) == 1 {
+		return chunks[0]
+	}
+
+	width := 1
+	for width < len(chunks) {
+		width *= 2
+	}
+	level := make([][32]byte, width)
+	copy(level, chunks)
+	for len(level) > 1 {
+		next := make([][32]byte, len(level)/2)
+		for i := range next {
+			next[i] = sha256.Sum256(append(level[2*i][:], level[2*i+1][:]...))
+		}
+		level = next
+	}
+
+	return level[0]
+}
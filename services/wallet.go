@@ -5,95 +5,189 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
-	"io/ioutil"
-	"os"
+	"fmt"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jabbala-dev/go-wallet/hdwallet"
+	"github.com/jabbala-dev/go-wallet/models"
+)
+
+const (
+	SignSchemeSHA256   = models.SignSchemeSHA256
+	SignSchemePersonal = models.SignSchemePersonal
 )
 
 var privateKeyFile = "private_key.txt"
 
-func GenerateKeyPair() (string, string, error) {
-	privateKey, err := crypto.GenerateKey()
+var (
+	ErrUnknownSignScheme = models.ErrUnknownSignScheme
+	ErrInvalidSignature  = errors.New("invalid signature")
+)
+
+// GenerateKeyPair creates and selects a new account and hands out its key,
+// so only the file key store allows it. With mnemonicWords set, the key is
+// the first address of a new HD account, whose mnemonic is returned too;
+// otherwise it is a random key in the keystore. Either is encrypted under
+// password.
+func GenerateKeyPair(mnemonicWords int, password string) (privateKeyHex, address, mnemonic string, err error) {
+	store, err := ActiveKeyStore()
 	if err != nil {
-		return "", "", err
+		return "", "", "", err
+	}
+	if store.Name() != KeyStoreFile {
+		return "", "", "", fmt.Errorf("%w: create accounts with POST /accounts instead", ErrKeyNotExportable)
 	}
 
-	publicKey := privateKey.Public().(*ecdsa.PublicKey)
-	address := crypto.PubkeyToAddress(*publicKey).Hex()
+	var privateKey *ecdsa.PrivateKey
+	if mnemonicWords > 0 {
+		generated, err := GenerateMnemonic("", mnemonicWords, "", password)
+		if err != nil {
+			return "", "", "", err
+		}
+		seed := hdwallet.MnemonicToSeed(generated.Mnemonic, "")
+		if privateKey, err = hdChildKey(generated.Account, seed, 0); err != nil {
+			return "", "", "", err
+		}
+		mnemonic = generated.Mnemonic
+	} else {
+		if privateKey, err = crypto.GenerateKey(); err != nil {
+			return "", "", "", err
+		}
+		if _, err := addAccount("", privateKey, password, true); err != nil {
+			return "", "", "", err
+		}
+	}
 
-	privateKeyHex := hex.EncodeToString(crypto.FromECDSA(privateKey))
+	publicKey := privateKey.Public().(*ecdsa.PublicKey)
+	address = crypto.PubkeyToAddress(*publicKey).Hex()
+	privateKeyHex = hex.EncodeToString(crypto.FromECDSA(privateKey))
 
-	err = ioutil.WriteFile(privateKeyFile, []byte(privateKeyHex), 0600)
-	if err != nil {
-		return "", "", err
-	}
+	return privateKeyHex, address, mnemonic, nil
+}
 
-	return privateKeyHex, address, nil
+// GetAddress returns an account's address, given by address or name, the
+// selected account's if empty. It needs no unlocking.
+func GetAddress(account string) (string, error) {
+	return AccountAddress(account)
 }
 
-func GetAddress() (string, error) {
-	privateKey, err := loadKey()
+// SignMessage signs a message with an account given by address or name, the
+// selected one if empty, under scheme, SHA-256 if empty.
+func SignMessage(account, message, scheme string) (string, error) {
+	hash, err := messageHash(message, scheme)
 	if err != nil {
 		return "", err
 	}
 
-	publicKey := privateKey.Public().(*ecdsa.PublicKey)
-	address := crypto.PubkeyToAddress(*publicKey).Hex()
-
-	return address, nil
-}
-
-func SignMessage(message string) (string, error) {
-	privateKey, err := loadKey()
+	signer, err := loadSignerFor(account)
 	if err != nil {
 		return "", err
 	}
 
-	hash := sha256.Sum256([]byte(message))
-	signature, err := crypto.Sign(hash[:], privateKey)
+	return signMessage(signer, hash, scheme)
+}
+
+// signMessage signs a hash from messageHash. Personal signatures are encoded
+// as personal_sign returns them, 0x-prefixed with a 27/28 recovery ID.
+func signMessage(signer Signer, hash []byte, scheme string) (string, error) {
+	signature, err := signer.SignHash(hash)
 	if err != nil {
 		return "", err
 	}
 
+	recordSignature(signer.Address())
+
+	if scheme == SignSchemePersonal {
+		signature[crypto.RecoveryIDOffset] += 27
+		return hexutil.Encode(signature), nil
+	}
 	return hex.EncodeToString(signature), nil
 }
 
-func VerifyMessage(message, signatureHex string) (bool, error) {
-	privateKey, err := loadKey()
+func messageHash(message, scheme string) ([]byte, error) {
+	switch scheme {
+	case "", SignSchemeSHA256:
+		hash := sha256.Sum256([]byte(message))
+		return hash[:], nil
+	case SignSchemePersonal:
+		return accounts.TextHash([]byte(message)), nil
+	}
+
+	return nil, models.CheckSignScheme(scheme)
+}
+
+// VerifyMessage checks a signature from SignMessage, or from any
+// personal_sign implementation for the personal scheme, against an account,
+// the selected one if empty. It recovers the signer rather than loading the
+// key, so a locked account can still verify.
+func VerifyMessage(account, message, signatureHex, scheme string) (bool, error) {
+	hash, err := messageHash(message, scheme)
 	if err != nil {
 		return false, err
 	}
 
-	publicKey := privateKey.Public().(*ecdsa.PublicKey)
-	hash := sha256.Sum256([]byte(message))
-	signature, err := hex.DecodeString(signatureHex)
+	address, err := AccountAddress(account)
+	if err != nil {
+		return false, err
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(signatureHex, "0x"))
 	if err != nil {
 		return false, err
 	}
 
-	return crypto.VerifySignature(crypto.FromECDSAPub(publicKey), hash[:], signature[:len(signature)-1]), nil
+	signer, ok := recoverAddress(hash, signature)
+	return ok && signer == common.HexToAddress(address), nil
 }
 
-func loadKey() (*ecdsa.PrivateKey, error) {
-	if _, err := os.Stat(privateKeyFile); os.IsNotExist(err) {
-		return nil, errors.New("private key file does not exist")
+// RecoverSigner returns the address that signed a message under scheme,
+// SHA-256 if empty. No key is involved, so it checks signatures made by
+// anyone, such as a counterparty's personal_sign signature.
+func RecoverSigner(message, signatureHex, scheme string) (string, error) {
+	hash, err := messageHash(message, scheme)
+	if err != nil {
+		return "", err
 	}
 
-	privateKeyHex, err := ioutil.ReadFile(privateKeyFile)
+	signature, err := hex.DecodeString(strings.TrimPrefix(signatureHex, "0x"))
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("%w: not hex", ErrInvalidSignature)
+	}
+	if len(signature) != crypto.SignatureLength {
+		return "", fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidSignature, crypto.SignatureLength, len(signature))
 	}
 
-	privateKeyBytes, err := hex.DecodeString(string(privateKeyHex))
-	if err != nil {
-		return nil, err
+	signer, ok := recoverAddress(hash, signature)
+	if !ok {
+		return "", fmt.Errorf("%w: no signer can be recovered", ErrInvalidSignature)
 	}
 
-	privateKey, err := crypto.ToECDSA(privateKeyBytes)
+	return signer.Hex(), nil
+}
+
+// recoverAddress recovers the signer of a hash from a 65-byte signature with
+// a 0/1 or 27/28 recovery ID.
+func recoverAddress(hash, signature []byte) (common.Address, bool) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, false
+	}
+	signature = append([]byte(nil), signature...)
+	if signature[crypto.RecoveryIDOffset] >= 27 {
+		signature[crypto.RecoveryIDOffset] -= 27
+	}
+
+	publicKey, err := crypto.SigToPub(hash, signature)
 	if err != nil {
-		return nil, err
+		return common.Address{}, false
 	}
 
-	return privateKey, nil
+	return crypto.PubkeyToAddress(*publicKey), true
+}
+
+func addressOf(privateKey *ecdsa.PrivateKey) common.Address {
+	return crypto.PubkeyToAddress(privateKey.PublicKey)
 }
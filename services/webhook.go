@@ -0,0 +1,406 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Event types a webhook can subscribe to.
+const (
+	EventTransactionSent      = "transaction.sent"
+	EventTransactionConfirmed = "transaction.confirmed"
+	EventTransactionFailed    = "transaction.failed"
+	EventAlertRaised          = "alert.raised"
+)
+
+var webhookEventTypes = []string{EventTransactionSent, EventTransactionConfirmed, EventTransactionFailed, EventAlertRaised}
+
+// Webhook is a subscription to wallet events. Each scope that is left empty
+// matches everything, so a webhook with no scopes receives every event.
+// Alerts are not tied to a chain, so a webhook scoped to chains does not
+// receive them.
+// Deliveries are signed with the webhook's own secret, which is only
+// returned when the webhook is created or the secret rotated.
+type Webhook struct {
+	ID          string        `json:"id"`
+	URL         string        `json:"url"`
+	Description string        `json:"description,omitempty"`
+	Accounts    []string      `json:"accounts,omitempty"`
+	ChainIDs    []uint64      `json:"chain_ids,omitempty"`
+	Events      []string      `json:"events,omitempty"`
+	Secret      string        `json:"secret,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Status      WebhookStatus `json:"status"`
+}
+
+// WebhookStatus summarises a webhook's deliveries so far.
+type WebhookStatus struct {
+	Delivered           int        `json:"delivered"`
+	Failed              int        `json:"failed"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastAttemptAt       *time.Time `json:"last_attempt_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	LastStatusCode      int        `json:"last_status_code,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// WebhookEvent is the body of a delivery.
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	ChainID   uint64      `json:"chain_id,omitempty"`
+	Accounts  []string    `json:"accounts,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+var (
+	webhooksFile  = "webhooks.json"
+	webhooksMu    sync.Mutex
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+	// webhookRetryDelays are the waits before each retry of a failed
+	// delivery.
+	webhookRetryDelays = []time.Duration{5 * time.Second, 30 * time.Second}
+)
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+)
+
+func CreateWebhook(webhook Webhook) (*Webhook, error) {
+	if err := validateWebhook(&webhook); err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.ID = newID()
+	webhook.Secret = secret
+	webhook.CreatedAt = time.Now().UTC()
+	webhook.Status = WebhookStatus{}
+
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	webhooks, err := readWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks = append(webhooks, &webhook)
+	if err := writeJSONFile(webhooksFile, webhooks); err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// ListWebhooks returns every webhook with its delivery status. Secrets are
+// left out.
+func ListWebhooks() ([]*Webhook, error) {
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	webhooks, err := readWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	return webhooks, nil
+}
+
+func GetWebhook(id string) (*Webhook, error) {
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	webhook, _, err := findWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+// UpdateWebhook replaces a webhook's URL, description and scopes. Its secret
+// and delivery status are kept.
+func UpdateWebhook(id string, update Webhook) (*Webhook, error) {
+	if err := validateWebhook(&update); err != nil {
+		return nil, err
+	}
+
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	webhook, webhooks, err := findWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.URL = update.URL
+	webhook.Description = update.Description
+	webhook.Accounts = update.Accounts
+	webhook.ChainIDs = update.ChainIDs
+	webhook.Events = update.Events
+	if err := writeJSONFile(webhooksFile, webhooks); err != nil {
+		return nil, err
+	}
+
+	updated := *webhook
+	updated.Secret = ""
+	return &updated, nil
+}
+
+func DeleteWebhook(id string) error {
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	webhooks, err := readWebhooks()
+	if err != nil {
+		return err
+	}
+
+	for i, webhook := range webhooks {
+		if webhook.ID == id {
+			webhooks = append(webhooks[:i], webhooks[i+1:]...)
+			if err := writeJSONFile(webhooksFile, webhooks); err != nil {
+				return err
+			}
+			return dropDeliveries(id)
+		}
+	}
+
+	return ErrWebhookNotFound
+}
+
+// RotateWebhookSecret replaces a webhook's secret and returns the webhook
+// with the new one. Deliveries already in flight keep the old signature.
+func RotateWebhookSecret(id string) (*Webhook, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	webhook, webhooks, err := findWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.Secret = secret
+	if err := writeJSONFile(webhooksFile, webhooks); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+// attemptDelivery makes a delivery, retrying failures after
+// webhookRetryDelays.
+func attemptDelivery(webhook *Webhook, delivery *WebhookDelivery, replay bool) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		log.Printf("webhooks: failed to encode event %s: %v", delivery.Event.ID, err)
+		return
+	}
+
+	for attempt := 0; attempt <= len(webhookRetryDelays); attempt++ {
+		if attempt > 0 {
+			time.Sleep(webhookRetryDelays[attempt-1])
+			// A replay may have got it through in the meantime.
+			if deliveryStatus(delivery.ID) == DeliveryDelivered {
+				return
+			}
+		}
+
+		result := postWebhook(webhook, delivery, body)
+		result.Replay = replay
+		recordWebhookAttempt(webhook.ID, delivery.ID, result)
+		if result.Error == "" {
+			return
+		}
+		log.Printf("webhooks: delivery %s to %s failed: %s", delivery.ID, webhook.ID, result.Error)
+	}
+}
+
+// postWebhook sends one delivery. The body is signed with HMAC-SHA256 over
+// "<timestamp>.<body>" so consumers can reject replays of old deliveries.
+// Replays of a delivery keep its ID so consumers can deduplicate them.
+func postWebhook(webhook *Webhook, delivery *WebhookDelivery, body []byte) DeliveryAttempt {
+	started := time.Now()
+	result := DeliveryAttempt{AttemptedAt: started.UTC()}
+
+	timestamp := fmt.Sprint(started.Unix())
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", webhook.ID)
+	req.Header.Set("X-Webhook-Event", delivery.Event.Type)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := webhookClient.Do(req)
+	result.LatencyMS = time.Since(started).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, responseSnippetSize))
+	result.StatusCode = resp.StatusCode
+	result.Response = string(snippet)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result.Error = "consumer responded " + resp.Status
+	}
+
+	return result
+}
+
+// recordWebhookAttempt updates the webhook's status and appends the attempt
+// to the delivery log.
+func recordWebhookAttempt(id, deliveryID string, result DeliveryAttempt) {
+	appendDeliveryAttempt(deliveryID, result)
+
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	webhook, webhooks, err := findWebhook(id)
+	if err != nil {
+		// Deleted while the delivery was in flight.
+		return
+	}
+
+	status := &webhook.Status
+	status.LastAttemptAt = &result.AttemptedAt
+	status.LastStatusCode = result.StatusCode
+	if result.Error != "" {
+		status.Failed++
+		status.ConsecutiveFailures++
+		status.LastError = result.Error
+	} else {
+		status.Delivered++
+		status.ConsecutiveFailures = 0
+		status.LastSuccessAt = &result.AttemptedAt
+		status.LastError = ""
+	}
+
+	if err := writeJSONFile(webhooksFile, webhooks); err != nil {
+		log.Printf("webhooks: failed to record delivery status: %v", err)
+	}
+}
+
+func (w *Webhook) matches(event *WebhookEvent) bool {
+	if len(w.Events) > 0 && !slices.Contains(w.Events, event.Type) {
+		return false
+	}
+
+	if len(w.ChainIDs) > 0 && !slices.Contains(w.ChainIDs, event.ChainID) {
+		return false
+	}
+
+	if len(w.Accounts) > 0 {
+		found := false
+		for _, account := range event.Accounts {
+			for _, scoped := range w.Accounts {
+				found = found || strings.EqualFold(account, scoped)
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func validateWebhook(webhook *Webhook) error {
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: url must be an http or https URL", ErrInvalidWebhook)
+	}
+
+	for _, account := range webhook.Accounts {
+		if !common.IsHexAddress(account) {
+			return fmt.Errorf("%w: %q is not an address", ErrInvalidWebhook, account)
+		}
+	}
+
+	for _, eventType := range webhook.Events {
+		if !slices.Contains(webhookEventTypes, eventType) {
+			return fmt.Errorf("%w: unknown event type %q (expected one of %s)", ErrInvalidWebhook, eventType, strings.Join(webhookEventTypes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// findWebhook must be called with webhooksMu held.
+func findWebhook(id string) (*Webhook, []*Webhook, error) {
+	webhooks, err := readWebhooks()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, webhook := range webhooks {
+		if webhook.ID == id {
+			return webhook, webhooks, nil
+		}
+	}
+
+	return nil, nil, ErrWebhookNotFound
+}
+
+func readWebhooks() ([]*Webhook, error) {
+	var webhooks []*Webhook
+	if err := readJSONFile(webhooksFile, &webhooks); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+
+	// responseSnippetSize bounds how much of a consumer's response is kept.
+	responseSnippetSize = 512
+
+	// maxWebhookDeliveries bounds the delivery log; the oldest deliveries
+	// are dropped first.
+	maxWebhookDeliveries = 10000
+)
+
+// WebhookDelivery is one event sent to one webhook, with every attempt made
+// to deliver it, replays included.
+type WebhookDelivery struct {
+	ID        string            `json:"id"`
+	WebhookID string            `json:"webhook_id"`
+	Status    string            `json:"status"`
+	Event     *WebhookEvent     `json:"event"`
+	Attempts  []DeliveryAttempt `json:"attempts"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type DeliveryAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	LatencyMS   int64     `json:"latency_ms"`
+	Response    string    `json:"response,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Replay      bool      `json:"replay,omitempty"`
+}
+
+// DeliveryFilter selects deliveries of one webhook. IDs, when given, pick
+// deliveries directly; otherwise Status and Since narrow the log.
+type DeliveryFilter struct {
+	IDs    []string
+	Status string
+	Since  time.Time
+}
+
+var (
+	deliveriesFile = "webhook_deliveries.json"
+	deliveriesMu   sync.Mutex
+)
+
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+// ListWebhookDeliveries returns a webhook's deliveries, newest first.
+func ListWebhookDeliveries(webhookID string, filter DeliveryFilter) ([]*WebhookDelivery, error) {
+	if _, err := GetWebhook(webhookID); err != nil {
+		return nil, err
+	}
+
+	deliveriesMu.Lock()
+	defer deliveriesMu.Unlock()
+
+	deliveries, err := readDeliveries()
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := filter.apply(webhookID, deliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	return matched, nil
+}
+
+// ReplayWebhookDeliveries re-sends the selected deliveries in the order they
+// were first made, signed with the webhook's current secret. With no IDs and
+// no status it replays every failed delivery. The replays run in the
+// background; their attempts are appended to the deliveries' logs.
+func ReplayWebhookDeliveries(webhookID string, filter DeliveryFilter) ([]string, error) {
+	webhooksMu.Lock()
+	webhook, _, err := findWebhook(webhookID)
+	webhooksMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(filter.IDs) == 0 && filter.Status == "" {
+		filter.Status = DeliveryFailed
+	}
+
+	deliveriesMu.Lock()
+	deliveries, err := readDeliveries()
+	if err == nil {
+		deliveries, err = filter.apply(webhookID, deliveries)
+	}
+	deliveriesMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+	})
+
+	ids := make([]string, len(deliveries))
+	for i, delivery := range deliveries {
+		ids[i] = delivery.ID
+	}
+
+	go func() {
+		for _, delivery := range deliveries {
+			attemptDelivery(webhook, delivery, true)
+		}
+	}()
+
+	return ids, nil
+}
+
+// logDelivery records a delivery of event to a webhook. If the event was
+// already logged for that webhook the existing delivery is returned instead,
+// with created false.
+func logDelivery(webhookID string, event *WebhookEvent) (*WebhookDelivery, bool, error) {
+	delivery := &WebhookDelivery{
+		ID:        newID(),
+		WebhookID: webhookID,
+		Status:    DeliveryPending,
+		Event:     event,
+		Attempts:  []DeliveryAttempt{},
+		CreatedAt: time.Now().UTC(),
+	}
+
+	deliveriesMu.Lock()
+	defer deliveriesMu.Unlock()
+
+	deliveries, err := readDeliveries()
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, existing := range deliveries {
+		if existing.WebhookID == webhookID && existing.Event.ID == event.ID {
+			return existing, false, nil
+		}
+	}
+
+	deliveries = append(deliveries, delivery)
+	if len(deliveries) > maxWebhookDeliveries {
+		deliveries = deliveries[len(deliveries)-maxWebhookDeliveries:]
+	}
+
+	return delivery, true, writeJSONFile(deliveriesFile, deliveries)
+}
+
+// resumePendingDeliveries attempts deliveries that were logged but never
+// attempted, which happens when the process stops right after dispatch.
+func resumePendingDeliveries() {
+	deliveriesMu.Lock()
+	deliveries, err := readDeliveries()
+	deliveriesMu.Unlock()
+	if err != nil {
+		log.Printf("webhooks: failed to read delivery log: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if delivery.Status != DeliveryPending {
+			continue
+		}
+
+		webhooksMu.Lock()
+		webhook, _, err := findWebhook(delivery.WebhookID)
+		webhooksMu.Unlock()
+		if err != nil {
+			continue
+		}
+
+		go attemptDelivery(webhook, delivery, false)
+	}
+}
+
+func appendDeliveryAttempt(id string, attempt DeliveryAttempt) {
+	deliveriesMu.Lock()
+	defer deliveriesMu.Unlock()
+
+	deliveries, err := readDeliveries()
+	if err != nil {
+		log.Printf("webhooks: failed to read delivery log: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if delivery.ID != id {
+			continue
+		}
+
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		delivery.Status = DeliveryDelivered
+		if attempt.Error != "" {
+			delivery.Status = DeliveryFailed
+		}
+		if err := writeJSONFile(deliveriesFile, deliveries); err != nil {
+			log.Printf("webhooks: failed to record delivery attempt: %v", err)
+		}
+		return
+	}
+}
+
+func deliveryStatus(id string) string {
+	deliveriesMu.Lock()
+	defer deliveriesMu.Unlock()
+
+	deliveries, err := readDeliveries()
+	if err != nil {
+		return ""
+	}
+
+	for _, delivery := range deliveries {
+		if delivery.ID == id {
+			return delivery.Status
+		}
+	}
+
+	return ""
+}
+
+func dropDeliveries(webhookID string) error {
+	deliveriesMu.Lock()
+	defer deliveriesMu.Unlock()
+
+	deliveries, err := readDeliveries()
+	if err != nil {
+		return err
+	}
+
+	kept := deliveries[:0]
+	for _, delivery := range deliveries {
+		if delivery.WebhookID != webhookID {
+			kept = append(kept, delivery)
+		}
+	}
+
+	return writeJSONFile(deliveriesFile, kept)
+}
+
+func (f DeliveryFilter) apply(webhookID string, deliveries []*WebhookDelivery) ([]*WebhookDelivery, error) {
+	if len(f.IDs) > 0 {
+		byID := map[string]*WebhookDelivery{}
+		for _, delivery := range deliveries {
+			if delivery.WebhookID == webhookID {
+				byID[delivery.ID] = delivery
+			}
+		}
+
+		matched := make([]*WebhookDelivery, 0, len(f.IDs))
+		for _, id := range f.IDs {
+			delivery, ok := byID[id]
+			if !ok {
+				return nil, ErrDeliveryNotFound
+			}
+			matched = append(matched, delivery)
+		}
+		return matched, nil
+	}
+
+	var matched []*WebhookDelivery
+	for _, delivery := range deliveries {
+		if delivery.WebhookID != webhookID {
+			continue
+		}
+		if f.Status != "" && delivery.Status != f.Status {
+			continue
+		}
+		if !f.Since.IsZero() && delivery.CreatedAt.Before(f.Since) {
+			continue
+		}
+		matched = append(matched, delivery)
+	}
+
+	return matched, nil
+}
+
+func readDeliveries() ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	if err := readJSONFile(deliveriesFile, &deliveries); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
@@ -1,11 +1,16 @@
 package utils
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 
 	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/scrypt"
 )
 
 func GenerateKeyPair() (*ecdsa.PrivateKey, error) {
@@ -45,3 +50,57 @@ func VerifyMessage(publicKey *ecdsa.PublicKey, message, signatureHex string) (bo
 	}
 	return crypto.VerifySignature(crypto.FromECDSAPub(publicKey), hash[:], signature[:len(signature)-1]), nil
 }
+
+// EncryptWithPassphrase seals plaintext with AES-256-GCM under a scrypt-derived
+// key. The output is salt || nonce || ciphertext.
+func EncryptWithPassphrase(plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := passphraseCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(salt, nonce...)
+	return gcm.Seal(sealed, nonce, plaintext, nil), nil
+}
+
+func DecryptWithPassphrase(sealed []byte, passphrase string) ([]byte, error) {
+	if len(sealed) < 16 {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	gcm, err := passphraseCipher(passphrase, sealed[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	rest := sealed[16:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], nil)
+}
+
+func passphraseCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}